@@ -1,17 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 
 	"zplus-saas/apps/backend/api-gateway/internal/handlers"
 	"zplus-saas/apps/backend/api-gateway/internal/middleware"
 	"zplus-saas/apps/backend/shared/config"
 	"zplus-saas/apps/backend/shared/database"
+	"zplus-saas/apps/backend/shared/entitlements"
+	"zplus-saas/apps/backend/shared/featureflags"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -43,6 +48,11 @@ func main() {
 	// }
 	// defer mongo.Client().Disconnect(context.Background())
 
+	trustedProxies, err := sharedmiddleware.ParseIPSet(strings.Split(cfg.TrustedProxies, ","))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
 		AppName:      "Zplus SaaS API Gateway v" + cfg.AppVersion,
@@ -65,10 +75,11 @@ func main() {
 		Format: "[${time}] ${status} - ${method} ${path} - ${latency}\n",
 	}))
 	app.Use(recover.New())
+	app.Use(sharedmiddleware.ResolveClientIP(trustedProxies))
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:3000,http://localhost:3001,http://localhost:3002",
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-API-Key",
 		AllowCredentials: true,
 	}))
 
@@ -76,11 +87,19 @@ func main() {
 	app.Use(middleware.TenantResolver())
 	app.Use(middleware.SecurityHeaders())
 
+	// Feature flags are evaluated locally and reload when tenant-service
+	// announces a change
+	flags := featureflags.NewClient(cfg, redis)
+	flagsCtx, stopFlags := context.WithCancel(context.Background())
+	defer stopFlags()
+	go flags.Run(flagsCtx)
+
 	// Initialize handlers
-	handlers := handlers.New(db, redis, nil, cfg)
+	tenantEntitlements := entitlements.NewClient(cfg)
+	handlers := handlers.New(db, redis, nil, flags, tenantEntitlements, cfg)
 
 	// Routes
-	setupRoutes(app, handlers)
+	setupRoutes(app, handlers, middleware.NewIPAllowlistStore(db), middleware.NewTenantStatusStore(db), middleware.NewAPIKeyExchanger(cfg.AuthServiceURL), tenantEntitlements, cfg)
 
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -115,51 +134,103 @@ func main() {
 	fmt.Println("Server shutdown complete.")
 }
 
-func setupRoutes(app *fiber.App, h *handlers.Handlers) {
-	api := app.Group("/api/v1")
+func setupRoutes(app *fiber.App, h *handlers.Handlers, ipAllowlists *middleware.IPAllowlistStore, tenantStatuses *middleware.TenantStatusStore, apiKeys *middleware.APIKeyExchanger, tenantEntitlements entitlements.Source, cfg *config.Config) {
+	// API key được đổi thành access token trước tiên. Mọi request có access
+	// token hợp lệ đều phải đến từ IP trong allowlist của tenant, kể cả các
+	// route proxy xác thực ở service phía sau. Tenant bị tạm ngưng chỉ được đọc
+	api := app.Group("/api/v1", middleware.APIKeyAuth(apiKeys), sharedmiddleware.OptionalJWTAuth(cfg), middleware.IPAllowlistRequired(ipAllowlists), middleware.TenantReadOnly(tenantStatuses))
 
 	// Authentication routes
 	auth := api.Group("/auth")
 	auth.Post("/register", h.Auth.Register)
 	auth.Post("/login", h.Auth.Login)
 	auth.Post("/refresh", h.Auth.RefreshToken)
+	auth.Post("/password/expired", sharedmiddleware.RejectImpersonation(), h.Auth.ChangeExpiredPassword)
+	auth.Post("/unlock", h.Auth.Unlock)
+	auth.Post("/users/:id/unlock", h.Auth.Unlock)
 	auth.Post("/logout", h.Auth.Logout)
-	auth.Get("/profile", middleware.AuthRequired(), h.Auth.Profile)
-	auth.Put("/profile", middleware.AuthRequired(), h.Auth.UpdateProfile)
+	auth.Get("/tenants", h.Auth.Tenants)
+	auth.Post("/switch-tenant", h.Auth.Tenants)
+	auth.Get("/oidc/*", h.Auth.OIDC)
+	auth.All("/saml/*", h.Auth.SAML)
+	auth.All("/scim/*", h.Auth.SCIM)
+	auth.All("/roles*", h.Auth.RBAC)
+	auth.All("/permissions*", h.Auth.RBAC)
+	auth.All("/users/:id/roles", h.Auth.RBAC)
+	auth.All("/api-keys*", sharedmiddleware.RejectImpersonation(), h.Auth.APIKeys)
+	auth.All("/service-accounts*", sharedmiddleware.RejectImpersonation(), h.Auth.APIKeys)
+	auth.All("/privacy*", h.Auth.Privacy)
+	auth.All("/retention*", h.Auth.Retention)
+	auth.Get("/profile", middleware.AuthRequired(cfg), h.Auth.Profile)
+	auth.Put("/profile", middleware.AuthRequired(cfg), h.Auth.UpdateProfile)
 
 	// Admin authentication routes
 	admin := api.Group("/admin")
 	adminAuth := admin.Group("/auth")
 	adminAuth.Post("/login", h.Auth.AdminLogin)
 	adminAuth.Post("/create", h.Auth.CreateAdmin)
-	adminAuth.Get("/validate", middleware.AuthRequired(), h.Auth.ValidateAdmin)
+	adminAuth.Get("/validate", middleware.AuthRequired(cfg), h.Auth.ValidateAdmin)
 
 	// Admin dashboard routes
-	admin.Get("/stats", middleware.AuthRequired(), h.Auth.AdminStats)
-	admin.Get("/activities", middleware.AuthRequired(), h.Auth.AdminActivities)
-	admin.Get("/health", middleware.AuthRequired(), h.Auth.AdminHealth)
+	admin.Get("/stats", middleware.AuthRequired(cfg), h.Auth.AdminStats)
+	admin.Get("/activities", middleware.AuthRequired(cfg), h.Auth.AdminActivities)
+	admin.Get("/health", middleware.AuthRequired(cfg), h.Auth.AdminHealth)
+	admin.Post("/impersonate", middleware.AuthRequired(cfg), middleware.SystemAdminRequired(), h.Auth.Impersonate)
 
 	// Tenant management (System level)
-	tenants := api.Group("/tenants", middleware.AuthRequired(), middleware.SystemAdminRequired())
+	tenants := api.Group("/tenants", middleware.AuthRequired(cfg), middleware.SystemAdminRequired())
 	tenants.Get("/", h.Tenant.List)
 	tenants.Post("/", h.Tenant.Create)
+	tenants.Post("/provisioning", h.Tenant.Provision)
+	tenants.Get("/provisioning/:id", h.Tenant.GetProvisioning)
+	tenants.Get("/invoices/:invoice_id", h.Tenant.GetInvoice)
+	tenants.Post("/invoices/:invoice_id/pay", h.Tenant.PayInvoice)
+	tenants.Post("/invoices/:invoice_id/payment-failed", h.Tenant.RecordPaymentFailure)
 	tenants.Get("/:id", h.Tenant.GetByID)
 	tenants.Put("/:id", h.Tenant.Update)
 	tenants.Delete("/:id", h.Tenant.Delete)
-
-	// Module management
-	modules := api.Group("/modules", middleware.AuthRequired())
-	modules.Get("/", h.Module.List)
-	modules.Get("/:module", h.Module.GetStatus)
-	modules.Post("/:module/enable", middleware.TenantAdminRequired(), h.Module.Enable)
-	modules.Post("/:module/disable", middleware.TenantAdminRequired(), h.Module.Disable)
-
-	// Proxy routes to microservices
-	api.All("/crm/*", h.Proxy.CRM)
-	api.All("/hrm/*", h.Proxy.HRM)
-	api.All("/pos/*", h.Proxy.POS)
-	api.All("/lms/*", h.Proxy.LMS)
-	api.All("/checkin/*", h.Proxy.Checkin)
-	api.All("/payment/*", h.Proxy.Payment)
+	tenants.Get("/:id/subscription", h.Tenant.GetSubscription)
+	tenants.Put("/:id/subscription", h.Tenant.UpdateSubscription)
+	tenants.Post("/:id/subscription/change-plan", h.Tenant.ChangePlan)
+	tenants.Get("/:id/invoices", h.Tenant.ListInvoices)
+	tenants.Get("/:id/dunning", h.Tenant.ListDunningCases)
+	tenants.Get("/:id/usage", h.Tenant.GetUsage)
+	tenants.Get("/:id/metered-usage", h.Tenant.GetMeteredUsage)
+	tenants.Get("/:id/entitlements", h.Tenant.GetEntitlements)
+	tenants.Get("/:id/entitlements/override", h.Tenant.GetEntitlementOverride)
+	tenants.Put("/:id/entitlements/override", h.Tenant.SetEntitlementOverride)
+	tenants.Delete("/:id/entitlements/override", h.Tenant.DeleteEntitlementOverride)
+
+	// Feature flags (System level)
+	featureFlags := api.Group("/feature-flags", middleware.AuthRequired(cfg), middleware.SystemAdminRequired())
+	featureFlags.All("/*", h.Tenant.ProxyFeatureFlags)
+
+	// Flag của người dùng hiện tại, tính tại gateway từ ruleset đã cache
+	api.Get("/flags", middleware.AuthRequired(cfg), h.Flags.Evaluate)
+
+	// Billing of the caller's own tenant
+	billing := api.Group("/billing", middleware.AuthRequired(cfg))
+	billing.Get("/usage", middleware.PermissionRequired("tenant.settings.manage"), h.Tenant.GetOwnUsage)
+	billing.Get("/metered-usage", middleware.PermissionRequired("tenant.settings.manage"), h.Tenant.GetOwnMeteredUsage)
+	// Mọi thành viên đều xem được entitlements để ẩn tính năng ngoài gói
+	billing.Get("/entitlements", h.Tenant.GetOwnEntitlements)
+
+	// Module management, handled by tenant-service
+	modules := api.Group("/modules", middleware.AuthRequired(cfg))
+	modules.All("/rollouts*", middleware.SystemAdminRequired(), h.Tenant.ProxyModules)
+	modules.Get("/*", h.Tenant.ProxyModules)
+	modules.All("/*", middleware.PermissionRequired("tenant.modules.manage"), h.Tenant.ProxyModules)
+
+	// SCIM 2.0 provisioning, authenticated by auth-service with per-tenant tokens
+	api.All("/scim/v2/*", h.Auth.SCIM)
+
+	// Proxy routes to microservices. Tenant chỉ dùng được các module có
+	// trong gói của mình
+	api.All("/crm/*", entitlements.RequireModule(tenantEntitlements, "crm"), h.Proxy.CRM)
+	api.All("/hrm/*", entitlements.RequireModule(tenantEntitlements, "hrm"), h.Proxy.HRM)
+	api.All("/pos/*", entitlements.RequireModule(tenantEntitlements, "pos"), h.Proxy.POS)
+	api.All("/lms/*", entitlements.RequireModule(tenantEntitlements, "lms"), h.Proxy.LMS)
+	api.All("/checkin/*", entitlements.RequireModule(tenantEntitlements, "checkin"), h.Proxy.Checkin)
+	api.All("/payment/*", sharedmiddleware.RejectImpersonation(), h.Proxy.Payment)
 	api.All("/files/*", h.Proxy.Files)
 }
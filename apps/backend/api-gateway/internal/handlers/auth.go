@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gofiber/fiber/v2"
@@ -29,6 +30,10 @@ func NewAuthHandler(db *sql.DB, redis *redis.Client, cfg *config.Config) *AuthHa
 		cfg:   cfg,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
+			// Pass redirects (e.g. SSO) through to the client instead of following them
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
 		},
 	}
 }
@@ -49,6 +54,24 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	return h.proxyToAuthService(c, path)
 }
 
+// ChangeExpiredPassword proxies password rotation after a login rejected for an expired password
+func (h *AuthHandler) ChangeExpiredPassword(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// Unlock proxies account unlocks, by emailed token or by a tenant admin
+func (h *AuthHandler) Unlock(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// Tenants proxies listing the user's tenants and switching to another one
+func (h *AuthHandler) Tenants(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
 	return h.proxyToAuthService(c, path)
@@ -64,6 +87,46 @@ func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
 	return h.proxyToAuthService(c, path)
 }
 
+func (h *AuthHandler) OIDC(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+func (h *AuthHandler) SAML(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// SCIM proxies SCIM 2.0 provisioning and SCIM token management to auth-service
+func (h *AuthHandler) SCIM(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// RBAC proxies role, permission and role assignment management to auth-service
+func (h *AuthHandler) RBAC(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// APIKeys proxies API key, service account and API key exchange requests to auth-service
+func (h *AuthHandler) APIKeys(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// Privacy proxies GDPR data subject requests and export downloads to auth-service
+func (h *AuthHandler) Privacy(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
+// Retention proxies data retention policies, legal holds and reports to auth-service
+func (h *AuthHandler) Retention(c *fiber.Ctx) error {
+	path := "/api" + strings.TrimPrefix(c.Path(), "/api/v1")
+	return h.proxyToAuthService(c, path)
+}
+
 func (h *AuthHandler) AdminLogin(c *fiber.Ctx) error {
 	// Convert /api/v1/admin/auth/login to /api/admin/auth/login
 	path := strings.Replace(c.Path(), "/api/v1/admin", "/api/admin", 1)
@@ -100,6 +163,12 @@ func (h *AuthHandler) AdminHealth(c *fiber.Ctx) error {
 	return h.proxyToAuthService(c, path)
 }
 
+func (h *AuthHandler) Impersonate(c *fiber.Ctx) error {
+	// Convert /api/v1/admin/impersonate to /api/admin/impersonate
+	path := strings.Replace(c.Path(), "/api/v1/admin", "/api/admin", 1)
+	return h.proxyToAuthService(c, path)
+}
+
 // proxyToAuthService proxies request to auth service with custom path
 func (h *AuthHandler) proxyToAuthService(c *fiber.Ctx, customPath string) error {
 	// Prepare the request URL with custom path
@@ -128,6 +197,9 @@ func (h *AuthHandler) proxyToAuthService(c *fiber.Ctx, customPath string) error
 			req.Header.Set(keyStr, string(value))
 		}
 	})
+	// auth-service throttles logins and checks IP allowlists per client IP;
+	// replace whatever the client sent so the address cannot be spoofed
+	req.Header.Set(fiber.HeaderXForwardedFor, sharedmiddleware.ClientIP(c))
 
 	// Make the request
 	resp, err := h.httpClient.Do(req)
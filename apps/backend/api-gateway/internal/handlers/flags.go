@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"zplus-saas/apps/backend/shared/entitlements"
+	"zplus-saas/apps/backend/shared/featureflags"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FlagHandler struct {
+	flags        *featureflags.Client
+	entitlements entitlements.Source
+}
+
+func NewFlagHandler(flags *featureflags.Client, tenantEntitlements entitlements.Source) *FlagHandler {
+	return &FlagHandler{
+		flags:        flags,
+		entitlements: tenantEntitlements,
+	}
+}
+
+// Evaluate returns every feature flag evaluated for the caller, from the
+// gateway's cached ruleset, so the frontend can dark-launch features
+func (h *FlagHandler) Evaluate(c *fiber.Ctx) error {
+	evalCtx := featureflags.Context{}
+	evalCtx.TenantID, _ = c.Locals("tenant_id").(string)
+	evalCtx.UserID, _ = c.Locals("user_id").(string)
+	evalCtx.Role, _ = c.Locals("user_role").(string)
+
+	// Without the plan, rules targeting plans just do not match
+	if evalCtx.TenantID != "" {
+		if resolved, err := h.entitlements.Entitlements(c.Context(), evalCtx.TenantID); err == nil && resolved.PlanID != nil {
+			evalCtx.PlanID = resolved.PlanID.String()
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"version": h.flags.Version(),
+		"flags":   h.flags.EvaluateAll(evalCtx),
+	})
+}
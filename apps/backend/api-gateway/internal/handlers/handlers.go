@@ -4,6 +4,8 @@ import (
 	"database/sql"
 
 	"zplus-saas/apps/backend/shared/config"
+	"zplus-saas/apps/backend/shared/entitlements"
+	"zplus-saas/apps/backend/shared/featureflags"
 
 	"github.com/go-redis/redis/v8"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,15 +14,15 @@ import (
 type Handlers struct {
 	Auth   *AuthHandler
 	Tenant *TenantHandler
-	Module *ModuleHandler
 	Proxy  *ProxyHandler
+	Flags  *FlagHandler
 }
 
-func New(db *sql.DB, redis *redis.Client, mongo *mongo.Database, cfg *config.Config) *Handlers {
+func New(db *sql.DB, redis *redis.Client, mongo *mongo.Database, flags *featureflags.Client, tenantEntitlements entitlements.Source, cfg *config.Config) *Handlers {
 	return &Handlers{
 		Auth:   NewAuthHandler(db, redis, cfg),
 		Tenant: NewTenantHandler(db, cfg),
-		Module: NewModuleHandler(db, cfg),
 		Proxy:  NewProxyHandler(cfg),
+		Flags:  NewFlagHandler(flags, tenantEntitlements),
 	}
 }
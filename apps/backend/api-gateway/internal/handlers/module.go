@@ -1,118 +0,0 @@
-package handlers
-
-import (
-	"database/sql"
-
-	"zplus-saas/apps/backend/shared/config"
-
-	"github.com/gofiber/fiber/v2"
-)
-
-type ModuleHandler struct {
-	db  *sql.DB
-	cfg *config.Config
-}
-
-func NewModuleHandler(db *sql.DB, cfg *config.Config) *ModuleHandler {
-	return &ModuleHandler{
-		db:  db,
-		cfg: cfg,
-	}
-}
-
-func (h *ModuleHandler) List(c *fiber.Ctx) error {
-	// Available modules
-	modules := []fiber.Map{
-		{
-			"name":        "CRM",
-			"key":         "crm",
-			"description": "Customer Relationship Management",
-			"status":      "available",
-			"version":     "1.0.0",
-		},
-		{
-			"name":        "HRM",
-			"key":         "hrm",
-			"description": "Human Resource Management",
-			"status":      "available",
-			"version":     "1.0.0",
-		},
-		{
-			"name":        "POS",
-			"key":         "pos",
-			"description": "Point of Sale System",
-			"status":      "available",
-			"version":     "1.0.0",
-		},
-		{
-			"name":        "LMS",
-			"key":         "lms",
-			"description": "Learning Management System",
-			"status":      "available",
-			"version":     "1.0.0",
-		},
-		{
-			"name":        "Check-in",
-			"key":         "checkin",
-			"description": "Attendance Tracking System",
-			"status":      "available",
-			"version":     "1.0.0",
-		},
-		{
-			"name":        "Payment",
-			"key":         "payment",
-			"description": "Payment Processing",
-			"status":      "available",
-			"version":     "1.0.0",
-		},
-		{
-			"name":        "Accounting",
-			"key":         "accounting",
-			"description": "Accounting & Finance",
-			"status":      "development",
-			"version":     "0.1.0",
-		},
-		{
-			"name":        "E-commerce",
-			"key":         "ecommerce",
-			"description": "E-commerce Platform",
-			"status":      "planned",
-			"version":     "0.0.0",
-		},
-	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    modules,
-	})
-}
-
-func (h *ModuleHandler) GetStatus(c *fiber.Ctx) error {
-	module := c.Params("module")
-	// TODO: Get module status for current tenant
-	return c.JSON(fiber.Map{
-		"module":  module,
-		"enabled": false, // TODO: Check from database
-		"status":  "coming_soon",
-	})
-}
-
-func (h *ModuleHandler) Enable(c *fiber.Ctx) error {
-	module := c.Params("module")
-	// TODO: Enable module for tenant
-	return c.JSON(fiber.Map{
-		"message": "Enable module endpoint - TODO: Implement",
-		"module":  module,
-		"status":  "coming_soon",
-	})
-}
-
-func (h *ModuleHandler) Disable(c *fiber.Ctx) error {
-	module := c.Params("module")
-	// TODO: Disable module for tenant
-	return c.JSON(fiber.Map{
-		"message": "Disable module endpoint - TODO: Implement",
-		"module":  module,
-		"status":  "coming_soon",
-	})
-}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -55,6 +56,8 @@ func (h *ProxyHandler) proxyRequest(c *fiber.Ctx, serviceURL, pathPrefix string)
 		}
 	}
 
+	req.Header.Set(fiber.HeaderXForwardedFor, sharedmiddleware.ClientIP(c))
+
 	// Add tenant ID header if available
 	if tenantID := c.Locals("tenantID"); tenantID != nil {
 		req.Header.Set("X-Tenant-ID", tenantID.(string))
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"zplus-saas/apps/backend/shared/config"
@@ -51,6 +52,122 @@ func (h *TenantHandler) Delete(c *fiber.Ctx) error {
 	return h.proxyToTenantService(c, "/api/tenants/"+tenantID)
 }
 
+// Provision provisions a tenant through tenant-service's tracked saga
+func (h *TenantHandler) Provision(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/provisioning")
+}
+
+func (h *TenantHandler) GetProvisioning(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/provisioning/"+c.Params("id"))
+}
+
+func (h *TenantHandler) GetSubscription(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+c.Params("id"))
+}
+
+func (h *TenantHandler) UpdateSubscription(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+c.Params("id"))
+}
+
+func (h *TenantHandler) ChangePlan(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+c.Params("id")+"/change-plan")
+}
+
+func (h *TenantHandler) ListInvoices(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+c.Params("id")+"/invoices")
+}
+
+func (h *TenantHandler) GetInvoice(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/invoices/"+c.Params("invoice_id"))
+}
+
+func (h *TenantHandler) PayInvoice(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/invoices/"+c.Params("invoice_id")+"/pay")
+}
+
+func (h *TenantHandler) RecordPaymentFailure(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/invoices/"+c.Params("invoice_id")+"/payment-failed")
+}
+
+func (h *TenantHandler) ListDunningCases(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+c.Params("id")+"/dunning")
+}
+
+func (h *TenantHandler) GetUsage(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/tenants/"+c.Params("id")+"/usage")
+}
+
+// GetOwnUsage returns the usage and plan limits of the caller's tenant for
+// its billing page
+func (h *TenantHandler) GetOwnUsage(c *fiber.Ctx) error {
+	tenantID, _ := c.Locals("tenant_id").(string)
+	if tenantID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Tenant required",
+			"message": "Sign in to an organization to see its usage",
+		})
+	}
+	return h.proxyToTenantService(c, "/api/tenants/"+tenantID+"/usage")
+}
+
+func (h *TenantHandler) GetMeteredUsage(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+c.Params("id")+"/metered-usage")
+}
+
+// GetOwnMeteredUsage returns the metered usage of the caller's tenant in its
+// current billing period and what it will be billed for it
+func (h *TenantHandler) GetOwnMeteredUsage(c *fiber.Ctx) error {
+	tenantID, _ := c.Locals("tenant_id").(string)
+	if tenantID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Tenant required",
+			"message": "Sign in to an organization to see its usage",
+		})
+	}
+	return h.proxyToTenantService(c, "/api/subscriptions/tenant/"+tenantID+"/metered-usage")
+}
+
+func (h *TenantHandler) GetEntitlements(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/tenants/"+c.Params("id")+"/entitlements")
+}
+
+func (h *TenantHandler) GetEntitlementOverride(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/tenants/"+c.Params("id")+"/entitlements/override")
+}
+
+func (h *TenantHandler) SetEntitlementOverride(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/tenants/"+c.Params("id")+"/entitlements/override")
+}
+
+func (h *TenantHandler) DeleteEntitlementOverride(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/tenants/"+c.Params("id")+"/entitlements/override")
+}
+
+// GetOwnEntitlements returns the features, limits and modules of the
+// caller's tenant, so the frontend can hide what its plan does not include
+func (h *TenantHandler) GetOwnEntitlements(c *fiber.Ctx) error {
+	tenantID, _ := c.Locals("tenant_id").(string)
+	if tenantID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Tenant required",
+			"message": "Sign in to an organization to see its entitlements",
+		})
+	}
+	return h.proxyToTenantService(c, "/api/tenants/"+tenantID+"/entitlements")
+}
+
+// ProxyFeatureFlags proxies the management of feature flags
+func (h *TenantHandler) ProxyFeatureFlags(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/flags/"+c.Params("*"))
+}
+
+// ProxyModules proxies the module management of the caller's tenant, which
+// tenant-service scopes to the tenant in the access token. The path is taken
+// from the request since the routes mounting it match different prefixes.
+func (h *TenantHandler) ProxyModules(c *fiber.Ctx) error {
+	return h.proxyToTenantService(c, "/api/modules"+strings.TrimPrefix(c.Path(), "/api/v1/modules"))
+}
+
 // proxyToTenantService proxies request to tenant service
 func (h *TenantHandler) proxyToTenantService(c *fiber.Ctx, path string) error {
 	// Build URL with query parameters
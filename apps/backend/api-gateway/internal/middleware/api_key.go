@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// apiKeyPrefix mở đầu mọi API key do auth-service cấp
+	apiKeyPrefix = "zpk_"
+	// apiKeyExchangePath là route đổi API key lấy access token của auth-service
+	apiKeyExchangePath = "/api/auth/api-keys/token"
+	// apiKeyTokenRefreshMargin: token trong cache được đổi mới trước khi hết
+	// hạn khoảng thời gian này để request không mang token sắp hết hạn
+	apiKeyTokenRefreshMargin = 30 * time.Second
+)
+
+// errInvalidAPIKey là lỗi khi auth-service từ chối key (không tồn tại, hết hạn hoặc đã thu hồi)
+var errInvalidAPIKey = errors.New("invalid API key")
+
+type cachedAPIKeyToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// APIKeyExchanger đổi API key lấy access token ngắn hạn từ auth-service và
+// cache theo hash của key, nên mỗi key chỉ gọi auth-service vài phút một lần.
+// Key bị thu hồi vẫn dùng được tối đa đến khi token trong cache hết hạn.
+type APIKeyExchanger struct {
+	authServiceURL string
+	client         *http.Client
+	mu             sync.RWMutex
+	cache          map[string]cachedAPIKeyToken
+}
+
+func NewAPIKeyExchanger(authServiceURL string) *APIKeyExchanger {
+	return &APIKeyExchanger{
+		authServiceURL: strings.TrimSuffix(authServiceURL, "/"),
+		client:         &http.Client{Timeout: 10 * time.Second},
+		cache:          make(map[string]cachedAPIKeyToken),
+	}
+}
+
+// Exchange trả về access token cho key, lấy từ cache nếu còn hạn
+func (e *APIKeyExchanger) Exchange(ctx context.Context, key, clientIP string) (string, error) {
+	sum := sha256.Sum256([]byte(key))
+	cacheKey := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	e.mu.RLock()
+	cached, ok := e.cache[cacheKey]
+	e.mu.RUnlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.authServiceURL+apiKeyExchangePath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set(fiber.HeaderXForwardedFor, clientIP)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("auth service unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return "", errInvalidAPIKey
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("auth service returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.AccessToken == "" {
+		return "", fmt.Errorf("invalid response from auth service")
+	}
+
+	ttl := time.Duration(body.ExpiresIn)*time.Second - apiKeyTokenRefreshMargin
+	if ttl > 0 {
+		e.mu.Lock()
+		// Dọn các token đã hết hạn để cache không lớn dần theo số key từng dùng
+		for k, v := range e.cache {
+			if now.After(v.expiresAt) {
+				delete(e.cache, k)
+			}
+		}
+		e.cache[cacheKey] = cachedAPIKeyToken{token: body.AccessToken, expiresAt: now.Add(ttl)}
+		e.mu.Unlock()
+	}
+
+	return body.AccessToken, nil
+}
+
+// APIKeyAuth middleware cho phép dùng API key thay cho Bearer JWT. Key được
+// gửi qua header X-API-Key hoặc "Authorization: Bearer zpk_..."; middleware
+// đổi key lấy access token rồi thay vào header Authorization, nên các
+// middleware và service phía sau chỉ thấy JWT. Phải chạy trước OptionalJWTAuth.
+func APIKeyAuth(exchanger *APIKeyExchanger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("X-API-Key")
+		if key == "" {
+			if bearer := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); strings.HasPrefix(bearer, apiKeyPrefix) {
+				key = bearer
+			}
+		}
+		if key == "" || strings.HasSuffix(c.Path(), "/auth/api-keys/token") {
+			return c.Next()
+		}
+
+		token, err := exchanger.Exchange(c.UserContext(), key, sharedmiddleware.ClientIP(c))
+		if err != nil {
+			if errors.Is(err, errInvalidAPIKey) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+					"error": "Invalid API key",
+					"code":  "INVALID_API_KEY",
+				})
+			}
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "API key could not be verified",
+				"code":  "AUTH_SERVICE_UNAVAILABLE",
+			})
+		}
+
+		c.Request().Header.Del("X-API-Key")
+		c.Request().Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+
+		return c.Next()
+	}
+}
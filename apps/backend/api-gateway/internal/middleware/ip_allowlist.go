@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"time"
+
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ipAllowlistCacheTTL là thời gian cache allowlist của mỗi tenant, thay đổi
+// cấu hình có hiệu lực sau tối đa khoảng thời gian này
+const ipAllowlistCacheTTL = 30 * time.Second
+
+type cachedIPAllowlist struct {
+	allowlist *sharedmiddleware.IPAllowlist
+	expiresAt time.Time
+}
+
+// IPAllowlistStore đọc allowed_ips của tenant từ tenant_configurations và
+// cache trong bộ nhớ để không truy vấn database ở mỗi request
+type IPAllowlistStore struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	cache map[string]cachedIPAllowlist
+}
+
+func NewIPAllowlistStore(db *sql.DB) *IPAllowlistStore {
+	return &IPAllowlistStore{
+		db:    db,
+		cache: make(map[string]cachedIPAllowlist),
+	}
+}
+
+// Load trả về allowlist của tenant; tenant chưa có cấu hình thì không bị giới hạn
+func (s *IPAllowlistStore) Load(ctx context.Context, tenantID string) (*sharedmiddleware.IPAllowlist, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[tenantID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.allowlist, nil
+	}
+
+	var raw string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(allowed_ips::text, '') FROM tenant_configurations WHERE tenant_id = $1`,
+		tenantID,
+	).Scan(&raw)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	allowlist, err := sharedmiddleware.ParseIPAllowlist(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[tenantID] = cachedIPAllowlist{allowlist: allowlist, expiresAt: time.Now().Add(ipAllowlistCacheTTL)}
+	s.mu.Unlock()
+
+	return allowlist, nil
+}
+
+// IPAllowlistRequired middleware để chặn request từ IP ngoài allowlist của
+// tenant. Chỉ áp dụng cho request đã xác thực (cần OptionalJWTAuth hoặc
+// AuthRequired chạy trước); các route quản trị dùng danh sách admin.
+func IPAllowlistRequired(store *IPAllowlistStore) fiber.Handler {
+	return sharedmiddleware.RequireAllowedIP(store.Load, isAdminRoute)
+}
+
+// tenantAdminRoutes là các route quản trị tenant, mỗi route ứng với quyền mà
+// service phía sau yêu cầu. Route chỉ cần quyền đọc của mọi thành viên (như
+// GET /modules hay /billing/entitlements) không nằm trong danh sách này.
+var tenantAdminRoutes = []struct {
+	prefix string
+	writes bool // chỉ các request ghi là quản trị
+}{
+	{prefix: "/api/v1/auth/roles"},            // roles.read, roles.write
+	{prefix: "/api/v1/auth/permissions"},      // roles.read
+	{prefix: "/api/v1/auth/api-keys"},         // phiên đăng nhập, không dùng API key
+	{prefix: "/api/v1/auth/service-accounts"}, // api_keys.manage
+	{prefix: "/api/v1/auth/saml/connection"},  // sso.manage
+	{prefix: "/api/v1/auth/scim/tokens"},      // scim.manage
+	{prefix: "/api/v1/auth/privacy"},          // privacy.manage
+	{prefix: "/api/v1/auth/retention"},        // retention.manage
+	{prefix: "/api/v1/billing/usage"},         // tenant.settings.manage
+	{prefix: "/api/v1/billing/metered-usage"}, // tenant.settings.manage
+	{prefix: "/api/v1/modules/rollouts"},      // system admin
+	{prefix: "/api/v1/modules", writes: true}, // tenant.modules.manage
+}
+
+// isAdminRoute cho biết request có đến route quản trị nền tảng hay quản trị
+// tenant không
+func isAdminRoute(c *fiber.Ctx) bool {
+	path := c.Path()
+	if isPlatformAdminRoute(path) {
+		return true
+	}
+
+	// Gán vai trò (roles.write) và mở khóa tài khoản (users.write):
+	// /api/v1/auth/users/:id/roles và /api/v1/auth/users/:id/unlock
+	if rest, ok := strings.CutPrefix(path, "/api/v1/auth/users/"); ok {
+		if _, action, found := strings.Cut(rest, "/"); found && (action == "roles" || action == "unlock") {
+			return true
+		}
+	}
+
+	write := c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead && c.Method() != fiber.MethodOptions
+	for _, route := range tenantAdminRoutes {
+		if hasPathPrefix(path, route.prefix) && (write || !route.writes) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPlatformAdminRoute cho biết path có thuộc các route của system admin không
+func isPlatformAdminRoute(path string) bool {
+	return hasPathPrefix(path, "/api/v1/admin") || hasPathPrefix(path, "/api/v1/tenants")
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
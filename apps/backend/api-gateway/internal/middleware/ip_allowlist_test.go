@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPAllowlistUsesAdminListOnTenantAdminRoutes(t *testing.T) {
+	allowlist, err := sharedmiddleware.ParseIPAllowlist(`{"default": ["0.0.0.0/0"], "admin": ["203.0.113.0/24"]}`)
+	require.NoError(t, err)
+	// Allowlist đã có trong cache nên store không cần database
+	store := &IPAllowlistStore{cache: map[string]cachedIPAllowlist{
+		"tenant-1": {allowlist: allowlist, expiresAt: time.Now().Add(time.Hour)},
+	}}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		c.Locals("tenant_id", "tenant-1")
+		c.Locals("user_role", "admin")
+		c.Locals("client_ip", "198.51.100.7")
+		return c.Next()
+	})
+	app.Use(IPAllowlistRequired(store))
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{fiber.MethodPost, "/api/v1/auth/roles", fiber.StatusForbidden},
+		{fiber.MethodPut, "/api/v1/auth/users/user-2/roles", fiber.StatusForbidden},
+		{fiber.MethodPost, "/api/v1/auth/users/user-2/unlock", fiber.StatusForbidden},
+		{fiber.MethodPost, "/api/v1/auth/api-keys", fiber.StatusForbidden},
+		{fiber.MethodGet, "/api/v1/auth/service-accounts", fiber.StatusForbidden},
+		{fiber.MethodPut, "/api/v1/auth/retention/policies", fiber.StatusForbidden},
+		{fiber.MethodGet, "/api/v1/billing/usage", fiber.StatusForbidden},
+		{fiber.MethodPost, "/api/v1/modules/crm/install", fiber.StatusForbidden},
+		{fiber.MethodGet, "/api/v1/admin/stats", fiber.StatusForbidden},
+		// Route của mọi thành viên dùng danh sách mặc định
+		{fiber.MethodGet, "/api/v1/modules", fiber.StatusOK},
+		{fiber.MethodGet, "/api/v1/billing/entitlements", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/auth/unlock", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/auth/roles-export", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/crm/leads", fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+		require.NoError(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, "%s %s", tt.method, tt.path)
+	}
+}
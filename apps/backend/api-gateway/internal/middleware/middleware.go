@@ -3,6 +3,9 @@ package middleware
 import (
 	"strings"
 
+	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -47,50 +50,20 @@ func SecurityHeaders() fiber.Handler {
 	}
 }
 
-// AuthRequired middleware để kiểm tra authentication
-func AuthRequired() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		auth := c.Get("Authorization")
-		if auth == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Authorization header required",
-				"code":  "UNAUTHORIZED",
-			})
-		}
-
-		// Extract token from "Bearer <token>"
-		if !strings.HasPrefix(auth, "Bearer ") {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization format",
-				"code":  "INVALID_AUTH_FORMAT",
-			})
-		}
-
-		token := strings.TrimPrefix(auth, "Bearer ")
-		if token == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Token required",
-				"code":  "TOKEN_REQUIRED",
-			})
-		}
-
-		// TODO: Validate JWT token and extract user info
-		// For now, we'll just set some dummy user data
-		c.Locals("user_id", "user-123")
-		c.Locals("user_role", "user")
-		c.Locals("token", token)
-
-		return c.Next()
-	}
+// AuthRequired middleware để kiểm tra authentication. Token được xác thực
+// bằng JWT secret dùng chung với auth-service, user context và permissions
+// được lấy từ claims.
+func AuthRequired(cfg *config.Config) fiber.Handler {
+	return sharedmiddleware.JWTAuth(cfg)
 }
 
-// SystemAdminRequired middleware để kiểm tra quyền system admin
+// SystemAdminRequired middleware để kiểm tra quyền super admin của platform
 func SystemAdminRequired() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userRole := c.Locals("user_role")
-		if userRole != "system_admin" {
+		if userRole != "super_admin" {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "System admin role required",
+				"error": "Super admin role required",
 				"code":  "INSUFFICIENT_PRIVILEGES",
 			})
 		}
@@ -99,17 +72,7 @@ func SystemAdminRequired() fiber.Handler {
 	}
 }
 
-// TenantAdminRequired middleware để kiểm tra quyền tenant admin
-func TenantAdminRequired() fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		userRole := c.Locals("user_role")
-		if userRole != "tenant_admin" && userRole != "system_admin" {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-				"error": "Tenant admin role required",
-				"code":  "INSUFFICIENT_PRIVILEGES",
-			})
-		}
-
-		return c.Next()
-	}
+// PermissionRequired middleware để kiểm tra permission (vd. "tenant.modules.manage")
+func PermissionRequired(permissions ...string) fiber.Handler {
+	return sharedmiddleware.RequirePermission(permissions...)
 }
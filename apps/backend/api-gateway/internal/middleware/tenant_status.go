@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tenantStatusCacheTTL là thời gian cache trạng thái của mỗi tenant, tenant
+// bị tạm ngưng hoặc kích hoạt lại có hiệu lực sau tối đa khoảng thời gian này
+const tenantStatusCacheTTL = 30 * time.Second
+
+type cachedTenantStatus struct {
+	status    string
+	expiresAt time.Time
+}
+
+// TenantStatusStore đọc trạng thái của tenant từ bảng tenants và cache trong
+// bộ nhớ để không truy vấn database ở mỗi request
+type TenantStatusStore struct {
+	db    *sql.DB
+	mu    sync.RWMutex
+	cache map[string]cachedTenantStatus
+}
+
+func NewTenantStatusStore(db *sql.DB) *TenantStatusStore {
+	return &TenantStatusStore{
+		db:    db,
+		cache: make(map[string]cachedTenantStatus),
+	}
+}
+
+// Load trả về trạng thái của tenant; tenant không tồn tại có trạng thái rỗng
+func (s *TenantStatusStore) Load(ctx context.Context, tenantID string) (string, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[tenantID]
+	s.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.status, nil
+	}
+
+	var status string
+	err := s.db.QueryRowContext(ctx, `SELECT status FROM tenants WHERE id::text = $1`, tenantID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	s.mu.Lock()
+	s.cache[tenantID] = cachedTenantStatus{status: status, expiresAt: time.Now().Add(tenantStatusCacheTTL)}
+	s.mu.Unlock()
+
+	return status, nil
+}
+
+// readOnlyExemptPaths là các route vẫn cho phép ghi khi tenant bị tạm ngưng:
+// đăng nhập, làm mới token, đăng xuất, chuyển tenant và thanh toán, để tenant
+// trả hóa đơn quá hạn và được kích hoạt lại
+var readOnlyExemptPaths = []string{
+	"/api/v1/auth/login",
+	"/api/v1/auth/refresh",
+	"/api/v1/auth/logout",
+	"/api/v1/auth/switch-tenant",
+	"/api/v1/auth/password/expired",
+	"/api/v1/auth/oidc/",
+	"/api/v1/auth/saml/",
+	"/api/v1/payment",
+	"/api/v1/payment/",
+}
+
+// TenantReadOnly middleware để chuyển tenant bị tạm ngưng (ví dụ do chưa
+// thanh toán hóa đơn) sang chế độ chỉ đọc thay vì khóa hoàn toàn: người dùng
+// vẫn đăng nhập và xem dữ liệu được, chỉ các request ghi bị từ chối. Chỉ áp
+// dụng cho request đã xác thực; system admin và các route quản trị không bị
+// giới hạn.
+func TenantReadOnly(store *TenantStatusStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		userID, _ := c.Locals("user_id").(string)
+		tenantID, _ := c.Locals("tenant_id").(string)
+		if userID == "" || tenantID == "" || isPlatformAdminRoute(c.Path()) || isReadOnlyExempt(c.Path()) {
+			return c.Next()
+		}
+		if role, _ := c.Locals("user_role").(string); role == "super_admin" {
+			return c.Next()
+		}
+
+		status, err := store.Load(c.Context(), tenantID)
+		if err != nil {
+			// Chế độ chỉ đọc là biện pháp thu tiền, không phải kiểm soát bảo
+			// mật, nên lỗi database không chặn request
+			log.Printf("Failed to load status of tenant %s: %v", tenantID, err)
+			return c.Next()
+		}
+		if status != "suspended" {
+			return c.Next()
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Tenant is read-only",
+			"message": "Your organization is suspended and read-only until its overdue invoice is paid",
+		})
+	}
+}
+
+func isReadOnlyExempt(path string) bool {
+	for _, exempt := range readOnlyExemptPaths {
+		if path == exempt || strings.HasSuffix(exempt, "/") && strings.HasPrefix(path, exempt) {
+			return true
+		}
+	}
+	return false
+}
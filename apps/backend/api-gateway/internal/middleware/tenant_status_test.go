@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantReadOnlyLetsSuspendedTenantPay(t *testing.T) {
+	// Trạng thái đã có trong cache nên store không cần database
+	store := &TenantStatusStore{cache: map[string]cachedTenantStatus{
+		"tenant-1": {status: "suspended", expiresAt: time.Now().Add(time.Hour)},
+	}}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", "user-1")
+		c.Locals("tenant_id", "tenant-1")
+		c.Locals("user_role", "admin")
+		return c.Next()
+	})
+	app.Use(TenantReadOnly(store))
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{fiber.MethodPost, "/api/v1/payment", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/payment/", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/payment/invoices/inv-1/pay", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/auth/login", fiber.StatusOK},
+		{fiber.MethodGet, "/api/v1/crm/leads", fiber.StatusOK},
+		{fiber.MethodPost, "/api/v1/crm/leads", fiber.StatusForbidden},
+		{fiber.MethodPost, "/api/v1/payments-export", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+		require.NoError(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, "%s %s", tt.method, tt.path)
+	}
+
+	// Tenant đang hoạt động ghi được ở mọi route
+	store.cache["tenant-1"] = cachedTenantStatus{status: "active", expiresAt: time.Now().Add(time.Hour)}
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/api/v1/crm/leads", nil))
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
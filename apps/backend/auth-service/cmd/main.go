@@ -1,17 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"zplus-saas/apps/backend/auth-service/internal/handlers"
 	"zplus-saas/apps/backend/auth-service/internal/middleware"
+	"zplus-saas/apps/backend/auth-service/internal/models"
 	"zplus-saas/apps/backend/auth-service/internal/repositories"
 	"zplus-saas/apps/backend/auth-service/internal/services"
 	"zplus-saas/apps/backend/shared/config"
 	"zplus-saas/apps/backend/shared/database"
+	"zplus-saas/apps/backend/shared/metering"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -30,21 +35,80 @@ func main() {
 	}
 	defer db.Close()
 
+	// Connect to Redis (failed-login counters and lockouts)
+	redisClient, err := database.NewRedisClient(cfg.RedisURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	defer redisClient.Close()
+
 	// Initialize repositories
 	userRepo := repositories.NewUserRepository(db)
 	tenantRepo := repositories.NewTenantRepository(db)
+	membershipRepo := repositories.NewMembershipRepository(db)
 	refreshTokenRepo := repositories.NewRefreshTokenRepository(db)
+	tenantConfigRepo := repositories.NewTenantConfigRepository(db)
+	oidcRepo := repositories.NewOIDCRepository(db)
+	identityRepo := repositories.NewIdentityRepository(db)
+	samlRepo := repositories.NewSAMLRepository(db)
+	scimRepo := repositories.NewSCIMRepository(db)
+	roleRepo := repositories.NewRoleRepository(db)
+	passwordHistoryRepo := repositories.NewPasswordHistoryRepository(db)
+	auditRepo := repositories.NewAuditRepository(db)
+	loginAttemptRepo := repositories.NewLoginAttemptRepository(redisClient)
+	emailOutboxRepo := repositories.NewEmailOutboxRepository(db)
+	apiKeyRepo := repositories.NewAPIKeyRepository(db)
+	statsRepo := repositories.NewStatsRepository(db)
+	statsCache := repositories.NewStatsCache(redisClient)
+	dataSubjectRepo := repositories.NewDataSubjectRepository(db)
+	retentionRepo := repositories.NewRetentionRepository(db)
 
 	// Initialize services
 	jwtService := services.NewJWTService(cfg)
-	authService := services.NewAuthService(userRepo, tenantRepo, refreshTokenRepo, jwtService, cfg)
+	passwordPolicyService := services.NewPasswordPolicyService(tenantConfigRepo, passwordHistoryRepo, services.NewBreachChecker(cfg.BreachedPasswordsDir))
+	emailService, err := services.NewOutboxEmailService(emailOutboxRepo, userRepo, tenantRepo, tenantConfigRepo, cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize email service: %v", err)
+	}
+	emailDriver, err := services.NewEmailDriver(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize email driver: %v", err)
+	}
+	loginProtectionService := services.NewLoginProtectionService(loginAttemptRepo, tenantConfigRepo, userRepo, auditRepo, emailService)
+	tenantClient := services.NewTenantClient(cfg)
+	authService := services.NewAuthService(userRepo, tenantRepo, membershipRepo, refreshTokenRepo, samlRepo, roleRepo, passwordPolicyService, loginProtectionService, jwtService, tenantClient, cfg)
+	oidcService := services.NewOIDCService(userRepo, tenantConfigRepo, oidcRepo, identityRepo, authService, tenantClient, cfg)
+	samlService := services.NewSAMLService(userRepo, tenantRepo, samlRepo, identityRepo, authService, tenantClient, cfg)
+	hrmClient := services.NewHRMClient(cfg, jwtService)
+	scimService := services.NewSCIMService(userRepo, scimRepo, refreshTokenRepo, tenantConfigRepo, passwordPolicyService, hrmClient, tenantClient, cfg)
+	rbacService := services.NewRBACService(userRepo, roleRepo)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo, roleRepo, rbacService, jwtService)
+	impersonationService := services.NewImpersonationService(userRepo, roleRepo, auditRepo, jwtService)
+	adminStatsService := services.NewAdminStatsService(statsRepo, statsCache, tenantClient)
+	privacyService := services.NewPrivacyService(dataSubjectRepo, userRepo, auditRepo)
+	retentionService := services.NewRetentionService(retentionRepo, auditRepo)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
-	adminHandler := handlers.NewAdminHandler(authService)
+	adminHandler := handlers.NewAdminHandler(authService, impersonationService, adminStatsService)
+	oidcHandler := handlers.NewOIDCHandler(oidcService)
+	samlHandler := handlers.NewSAMLHandler(samlService)
+	scimHandler := handlers.NewSCIMHandler(scimService)
+	roleHandler := handlers.NewRoleHandler(rbacService)
+	lockoutHandler := handlers.NewLockoutHandler(loginProtectionService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	privacyHandler := handlers.NewPrivacyHandler(privacyService)
+	retentionHandler := handlers.NewRetentionHandler(retentionService)
+	internalHandler := handlers.NewInternalHandler(authService, services.NewTenantNotificationService(userRepo, emailService))
 
 	// Initialize middleware
 	authMiddleware := middleware.NewAuthMiddleware(jwtService)
+	scimMiddleware := middleware.NewSCIMMiddleware(scimService)
+
+	trustedProxies, err := sharedmiddleware.ParseIPSet(strings.Split(cfg.TrustedProxies, ","))
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -65,6 +129,9 @@ func main() {
 
 	// Middleware
 	app.Use(recover.New())
+	// Client IPs feed login throttling and IP allowlists, so X-Forwarded-For
+	// is only honoured when it comes from the API gateway
+	app.Use(sharedmiddleware.ResolveClientIP(trustedProxies))
 	app.Use(logger.New(logger.Config{
 		Format: "[${time}] ${status} - ${method} ${path} - ${latency}\n",
 	}))
@@ -92,13 +159,105 @@ func main() {
 	auth.Post("/register", authHandler.Register)
 	auth.Post("/login", authHandler.Login)
 	auth.Post("/refresh", authHandler.RefreshToken)
+	// Passwords cannot be changed with an impersonation token. The route is
+	// reached without one, so the token is only read when it is sent.
+	auth.Post("/password/expired", sharedmiddleware.OptionalJWTAuth(cfg), sharedmiddleware.RejectImpersonation(), authHandler.ChangeExpiredPassword)
+	auth.Post("/unlock", lockoutHandler.UnlockAccount)
+	auth.Post("/api-keys/token", apiKeyHandler.ExchangeAPIKey)
+
+	// SSO routes
+	auth.Get("/oidc/callback", oidcHandler.Callback)
+	auth.Get("/oidc/:tenant_id/:provider/login", oidcHandler.Login)
+	auth.Get("/saml/:tenant_id/metadata", samlHandler.Metadata)
+	auth.Get("/saml/:tenant_id/login", samlHandler.Login)
+	auth.Post("/saml/:tenant_id/acs", samlHandler.ACS)
 
 	// Protected routes
 	authProtected := auth.Use(authMiddleware.RequireAuth)
-	authProtected.Post("/logout", authHandler.Logout)
+	authProtected.Post("/logout", authMiddleware.RequireSession, authHandler.Logout)
+	authProtected.Get("/tenants", authHandler.ListTenants)
+	authProtected.Post("/switch-tenant", authMiddleware.RequireSession, authHandler.SwitchTenant)
 	authProtected.Get("/profile", authHandler.GetProfile)
 	authProtected.Put("/profile", authHandler.UpdateProfile)
 
+	// Roles and permissions
+	authProtected.Get("/permissions/me", roleHandler.MyPermissions)
+	authProtected.Get("/permissions", sharedmiddleware.RequirePermission(models.PermissionRolesRead), roleHandler.ListPermissions)
+	roles := authProtected.Group("/roles")
+	roles.Get("/", sharedmiddleware.RequirePermission(models.PermissionRolesRead), roleHandler.ListRoles)
+	roles.Post("/", sharedmiddleware.RequirePermission(models.PermissionRolesWrite), roleHandler.CreateRole)
+	roles.Get("/:id", sharedmiddleware.RequirePermission(models.PermissionRolesRead), roleHandler.GetRole)
+	roles.Put("/:id", sharedmiddleware.RequirePermission(models.PermissionRolesWrite), roleHandler.UpdateRole)
+	roles.Delete("/:id", sharedmiddleware.RequirePermission(models.PermissionRolesWrite), roleHandler.DeleteRole)
+	authProtected.Get("/users/:id/roles", sharedmiddleware.RequirePermission(models.PermissionRolesRead), roleHandler.GetUserRoles)
+	authProtected.Put("/users/:id/roles", sharedmiddleware.RequirePermission(models.PermissionRolesWrite), roleHandler.AssignUserRoles)
+	authProtected.Post("/users/:id/unlock", sharedmiddleware.RequirePermission(models.PermissionUsersWrite), lockoutHandler.UnlockUser)
+
+	// SAML connection management
+	samlAdmin := authProtected.Group("/saml/connection", sharedmiddleware.RequirePermission(models.PermissionSSOManage))
+	samlAdmin.Get("/", samlHandler.GetConnection)
+	samlAdmin.Put("/", samlHandler.ConfigureConnection)
+	samlAdmin.Delete("/", samlHandler.DeleteConnection)
+
+	// SCIM token management
+	scimTokens := authProtected.Group("/scim/tokens", sharedmiddleware.RequirePermission(models.PermissionSCIMManage))
+	scimTokens.Get("/", scimHandler.ListTokens)
+	scimTokens.Post("/", scimHandler.CreateToken)
+	scimTokens.Delete("/:id", scimHandler.DeleteToken)
+
+	// API keys and service accounts. Keys cannot manage keys, so a leaked key
+	// cannot mint itself a successor.
+	apiKeys := authProtected.Group("/api-keys", authMiddleware.RequireSession)
+	apiKeys.Get("/", apiKeyHandler.ListAPIKeys)
+	apiKeys.Post("/", apiKeyHandler.CreateAPIKey)
+	apiKeys.Post("/:id/rotate", apiKeyHandler.RotateAPIKey)
+	apiKeys.Delete("/:id", apiKeyHandler.RevokeAPIKey)
+	serviceAccounts := authProtected.Group("/service-accounts", authMiddleware.RequireSession, sharedmiddleware.RequirePermission(models.PermissionAPIKeysManage))
+	serviceAccounts.Get("/", apiKeyHandler.ListServiceAccounts)
+	serviceAccounts.Post("/", apiKeyHandler.CreateServiceAccount)
+	serviceAccounts.Delete("/:id", apiKeyHandler.DeleteServiceAccount)
+
+	// GDPR data subject requests, processed in the background
+	privacy := authProtected.Group("/privacy/requests", authMiddleware.RequireSession, sharedmiddleware.RequirePermission(models.PermissionPrivacyManage))
+	privacy.Get("/", privacyHandler.ListRequests)
+	privacy.Post("/", privacyHandler.CreateRequest)
+	privacy.Get("/:id", privacyHandler.GetRequest)
+	privacy.Get("/:id/export", privacyHandler.DownloadExport)
+
+	// Data retention policies, legal holds and reports
+	retention := authProtected.Group("/retention", authMiddleware.RequireSession, sharedmiddleware.RequirePermission(models.PermissionRetentionManage))
+	retention.Get("/policies", retentionHandler.GetPolicies)
+	retention.Put("/policies", retentionHandler.UpdatePolicy)
+	retention.Get("/holds", retentionHandler.ListHolds)
+	retention.Post("/holds", retentionHandler.PlaceHold)
+	retention.Delete("/holds/:id", retentionHandler.ReleaseHold)
+	retention.Post("/dry-run", retentionHandler.DryRun)
+	retention.Get("/runs", retentionHandler.ListRuns)
+	retention.Get("/metrics", retentionHandler.Metrics)
+
+	// SCIM 2.0 provisioning (per-tenant bearer tokens)
+	scim := api.Group("/scim/v2", scimMiddleware.RequireToken)
+	scim.Get("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+	scim.Get("/Users", scimHandler.ListUsers)
+	scim.Post("/Users", scimHandler.CreateUser)
+	scim.Get("/Users/:id", scimHandler.GetUser)
+	scim.Put("/Users/:id", scimHandler.ReplaceUser)
+	scim.Patch("/Users/:id", scimHandler.PatchUser)
+	scim.Delete("/Users/:id", scimHandler.DeleteUser)
+	scim.Get("/Groups", scimHandler.ListGroups)
+	scim.Post("/Groups", scimHandler.CreateGroup)
+	scim.Get("/Groups/:id", scimHandler.GetGroup)
+	scim.Put("/Groups/:id", scimHandler.ReplaceGroup)
+	scim.Patch("/Groups/:id", scimHandler.PatchGroup)
+	scim.Delete("/Groups/:id", scimHandler.DeleteGroup)
+
+	// Internal routes, called by other services with service tokens and not
+	// exposed by the API gateway
+	internal := api.Group("/internal", sharedmiddleware.JWTAuth(cfg), sharedmiddleware.RequireService())
+	internal.Post("/tenants/:tenant_id/admin", internalHandler.CreateTenantAdmin)
+	internal.Delete("/tenants/:tenant_id/users/:id", internalHandler.DeleteTenantUser)
+	internal.Post("/tenants/:tenant_id/notifications", internalHandler.NotifyTenantAdmins)
+
 	// Admin routes
 	admin := api.Group("/admin")
 	adminAuth := admin.Group("/auth")
@@ -111,15 +270,23 @@ func main() {
 
 	// Admin dashboard routes
 	adminDashboard := admin.Use(authMiddleware.RequireAuth)
-	adminDashboard.Get("/stats", adminHandler.AdminStats)
+	adminDashboard.Get("/stats", authMiddleware.RequireRole(models.RoleSuperAdmin), adminHandler.AdminStats)
 	adminDashboard.Get("/activities", adminHandler.AdminActivities)
 	adminDashboard.Get("/health", adminHandler.AdminHealth)
+	adminDashboard.Post("/impersonate", authMiddleware.RequireSession, authMiddleware.RequireRole(models.RoleSuperAdmin), adminHandler.Impersonate)
 
 	// Legacy admin routes (for future use)
 	adminProtected2 := api.Group("/admin")
 	adminProtected2.Use(authMiddleware.RequireAuth)
 	adminProtected2.Use(authMiddleware.RequireRole("admin", "super_admin"))
 
+	// Deliver queued emails in the background
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go services.NewEmailOutboxWorker(emailOutboxRepo, emailDriver, metering.NewClient(cfg, "auth-service")).Run(workerCtx)
+	go services.NewDataSubjectWorker(dataSubjectRepo, auditRepo, repositories.NewPersonalDataSources(db)).Run(workerCtx)
+	go services.NewRetentionWorker(retentionRepo).Run(workerCtx)
+
 	// Start server
 	go func() {
 		port := os.Getenv("AUTH_SERVICE_PORT")
@@ -142,6 +309,7 @@ func main() {
 	<-quit
 
 	log.Println("🔄 Shutting down server...")
+	stopWorkers()
 	if err := app.Shutdown(); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
@@ -1,17 +1,21 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 
 	"zplus-saas/apps/backend/auth-service/internal/models"
 	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
 
 type AdminHandler struct {
-	authService services.AuthService
+	authService          services.AuthService
+	impersonationService services.ImpersonationService
+	statsService         services.AdminStatsService
 }
 
 // AdminCreateRequest represents admin creation request
@@ -23,9 +27,11 @@ type AdminCreateRequest struct {
 	Role      string `json:"role" validate:"required,oneof=admin super_admin"`
 }
 
-func NewAdminHandler(authService services.AuthService) *AdminHandler {
+func NewAdminHandler(authService services.AuthService, impersonationService services.ImpersonationService, statsService services.AdminStatsService) *AdminHandler {
 	return &AdminHandler{
-		authService: authService,
+		authService:          authService,
+		impersonationService: impersonationService,
+		statsService:         statsService,
 	}
 }
 
@@ -39,6 +45,8 @@ func NewAdminHandler(authService services.AuthService) *AdminHandler {
 // @Success 200 {object} models.TokenResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Router /api/admin/auth/login [post]
 func (h *AdminHandler) AdminLogin(c *fiber.Ctx) error {
 	var req models.LoginRequest
@@ -56,9 +64,17 @@ func (h *AdminHandler) AdminLogin(c *fiber.Ctx) error {
 			Message: "Email and password are required",
 		})
 	}
+	req.IPAddress = sharedmiddleware.ClientIP(c)
+	req.AdminLogin = true
 
 	// Login through auth service
 	tokens, err := h.authService.Login(c.Context(), &req)
+	if blocked, ok := loginBlocked(err); ok {
+		return blockedLoginResponse(c, blocked)
+	}
+	if tenantAccessDenied(err) {
+		return tenantAccessDeniedResponse(c, err)
+	}
 	if err != nil {
 		log.Printf("Admin login error: %v", err)
 		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
@@ -67,16 +83,8 @@ func (h *AdminHandler) AdminLogin(c *fiber.Ctx) error {
 		})
 	}
 
-	// Additional check for admin role
-	user, err := h.authService.GetUserByID(c.Context(), tokens.User.ID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
-			Error:   "Failed to verify user",
-			Message: err.Error(),
-		})
-	}
-
-	if user.Role != "admin" && user.Role != "super_admin" {
+	// Additional check for admin role, in the tenant the user signed in to
+	if tokens.User.Role != "admin" && tokens.User.Role != "super_admin" {
 		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
 			Error:   "Access denied",
 			Message: "Admin access required",
@@ -184,28 +192,82 @@ func (h *AdminHandler) ValidateAdmin(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// Impersonate godoc
+// @Summary Impersonate a tenant user
+// @Description Issue a short-lived access token acting as a tenant user, for support. Super admin only; any user except super admins can be impersonated. The token carries an "act" claim naming the admin, has no refresh token, cannot change passwords or make payments, and every session is recorded in the audit log.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.ImpersonationRequest true "Impersonation request"
+// @Success 201 {object} models.ImpersonationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/admin/impersonate [post]
+func (h *AdminHandler) Impersonate(c *fiber.Ctx) error {
+	tenantID, actorID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User not authenticated",
+		})
+	}
+
+	var req models.ImpersonationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	session, err := h.impersonationService.Start(c.Context(), actorID, tenantID, sharedmiddleware.ClientIP(c), &req)
+	if errors.Is(err, services.ErrImpersonationForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Access denied",
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Impersonation error: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Impersonation failed",
+			Message: err.Error(),
+		})
+	}
+
+	log.Printf("Admin %s started impersonating user %s (session %s)", actorID, session.User.ID, session.SessionID)
+
+	return c.Status(fiber.StatusCreated).JSON(session)
+}
+
 // AdminStats godoc
 // @Summary Get admin dashboard stats
-// @Description Get dashboard statistics for admin panel
+// @Description Platform statistics for the admin panel: tenants by status, users and recent signups, active subscriptions with MRR/ARR, and growth against the preceding period. Cached for a minute. Super admin only.
 // @Tags admin
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} map[string]interface{}
+// @Param period query string false "Period in days, e.g. 7d, 30d, 90d (max 365d)" default(30d)
+// @Success 200 {object} models.AdminStats
+// @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /api/admin/stats [get]
 func (h *AdminHandler) AdminStats(c *fiber.Ctx) error {
-	// For now, return mock data
-	stats := map[string]interface{}{
-		"totalTenants":        25,
-		"totalUsers":          1500,
-		"totalRevenue":        125000,
-		"activeSubscriptions": 23,
-		"growth": map[string]interface{}{
-			"tenants": 15.5,
-			"users":   23.2,
-			"revenue": 18.7,
-		},
+	stats, err := h.statsService.GetStats(c.Context(), c.Query("period", services.DefaultStatsPeriod))
+	if errors.Is(err, services.ErrInvalidStatsPeriod) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid period",
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("Admin stats error: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to get stats",
+			Message: err.Error(),
+		})
 	}
 
 	return c.JSON(stats)
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type APIKeyHandler struct {
+	apiKeyService services.APIKeyService
+}
+
+func NewAPIKeyHandler(apiKeyService services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateServiceAccount godoc
+// @Summary Create service account
+// @Description Create a non-human principal for integrations. It can only hold permissions the caller holds.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateServiceAccountRequest true "Service account"
+// @Success 201 {object} models.ServiceAccount
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/service-accounts [post]
+func (h *APIKeyHandler) CreateServiceAccount(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.CreateServiceAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	account, err := h.apiKeyService.CreateServiceAccount(c.Context(), tenantID, userID, currentPermissions(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to create service account",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(account)
+}
+
+// ListServiceAccounts godoc
+// @Summary List service accounts
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.ServiceAccount
+// @Router /api/auth/service-accounts [get]
+func (h *APIKeyHandler) ListServiceAccounts(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	accounts, err := h.apiKeyService.ListServiceAccounts(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list service accounts",
+			Message: err.Error(),
+		})
+	}
+
+	if accounts == nil {
+		accounts = []*models.ServiceAccount{}
+	}
+
+	return c.JSON(accounts)
+}
+
+// DeleteServiceAccount godoc
+// @Summary Delete service account
+// @Description Delete a service account and revoke all of its keys
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Service account ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/service-accounts/{id} [delete]
+func (h *APIKeyHandler) DeleteServiceAccount(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid service account ID",
+			Message: err.Error(),
+		})
+	}
+
+	err = h.apiKeyService.DeleteServiceAccount(c.Context(), tenantID, id, currentPermissions(c))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to delete service account",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Message: "Service account deleted",
+	})
+}
+
+// CreateAPIKey godoc
+// @Summary Create API key
+// @Description Issue a personal API key, or a key for a service account (requires api_keys.manage). The key is only returned once.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateAPIKeyRequest true "API key"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	key, err := h.apiKeyService.CreateKey(c.Context(), tenantID, userID, currentPermissions(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to create API key",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List the caller's personal keys, or every key of the tenant with api_keys.manage
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.APIKey
+// @Router /api/auth/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	keys, err := h.apiKeyService.ListKeys(c.Context(), tenantID, userID, currentPermissions(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list API keys",
+			Message: err.Error(),
+		})
+	}
+
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+
+	return c.JSON(keys)
+}
+
+// RotateAPIKey godoc
+// @Summary Rotate API key
+// @Description Issue a replacement key with the same settings. The old key keeps working for the grace period.
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Param request body models.RotateAPIKeyRequest false "Grace period"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/api-keys/{id}/rotate [post]
+func (h *APIKeyHandler) RotateAPIKey(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid API key ID",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.RotateAPIKeyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+				Error:   "Invalid request body",
+				Message: err.Error(),
+			})
+		}
+	}
+
+	key, err := h.apiKeyService.RotateKey(c.Context(), tenantID, id, userID, currentPermissions(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to rotate API key",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(key)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Tags api-keys
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "API key ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid API key ID",
+			Message: err.Error(),
+		})
+	}
+
+	err = h.apiKeyService.RevokeKey(c.Context(), tenantID, id, userID, currentPermissions(c))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "Failed to revoke API key",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Message: "API key revoked",
+	})
+}
+
+// ExchangeAPIKey godoc
+// @Summary Exchange API key for an access token
+// @Description Exchange an API key, sent as X-API-Key or as a Bearer token, for a short-lived access token. The API gateway does this for every request carrying a key.
+// @Tags api-keys
+// @Produce json
+// @Param X-API-Key header string false "API key"
+// @Success 200 {object} models.APIKeyTokenResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/auth/api-keys/token [post]
+func (h *APIKeyHandler) ExchangeAPIKey(c *fiber.Ctx) error {
+	key := c.Get("X-API-Key")
+	if key == "" {
+		key = strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+	}
+
+	token, err := h.apiKeyService.Exchange(c.Context(), key, sharedmiddleware.ClientIP(c))
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			status = fiber.StatusUnauthorized
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "API key exchange failed",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(token)
+}
+
+func currentTenantAndUser(c *fiber.Ctx) (uuid.UUID, uuid.UUID, error) {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	currentUserID, _ := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(currentUserID)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	return tenantID, userID, nil
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"log"
+	"math"
+	"strconv"
 
 	"zplus-saas/apps/backend/auth-service/internal/models"
 	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -22,7 +26,7 @@ func NewAuthHandler(authService services.AuthService) *AuthHandler {
 
 // Register godoc
 // @Summary Register a new user
-// @Description Create a new user account
+// @Description Create a new user account. An existing user registering with their own password joins the tenant, or creates a new organization, with the same account.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -30,6 +34,7 @@ func NewAuthHandler(authService services.AuthService) *AuthHandler {
 // @Success 201 {object} models.TokenResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 409 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Router /api/auth/register [post]
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req models.RegisterRequest
@@ -48,8 +53,24 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
+	req.IPAddress = sharedmiddleware.ClientIP(c)
+
 	tokens, err := h.authService.Register(c.Context(), &req)
+	if blocked, ok := loginBlocked(err); ok {
+		return blockedLoginResponse(c, blocked)
+	}
 	if err != nil {
+		var policyErr *models.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(passwordPolicyErrorResponse(policyErr))
+		}
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+				Error:   "Quota exceeded",
+				Message: err.Error(),
+			})
+		}
+
 		log.Printf("Registration error: %v", err)
 		return c.Status(fiber.StatusConflict).JSON(ErrorResponse{
 			Error:   "Registration failed",
@@ -70,6 +91,8 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 // @Success 200 {object} models.TokenResponse
 // @Failure 400 {object} ErrorResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse "Password expired (rotate it with /api/auth/password/expired), not a member of the requested tenant or IP address not allowed"
+// @Failure 429 {object} ErrorResponse "Too many failed attempts, see the Retry-After header"
 // @Router /api/auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req models.LoginRequest
@@ -87,8 +110,21 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 			Message: "Email and password are required",
 		})
 	}
+	req.IPAddress = sharedmiddleware.ClientIP(c)
 
 	tokens, err := h.authService.Login(c.Context(), &req)
+	if blocked, ok := loginBlocked(err); ok {
+		return blockedLoginResponse(c, blocked)
+	}
+	if tenantAccessDenied(err) {
+		return tenantAccessDeniedResponse(c, err)
+	}
+	if errors.Is(err, services.ErrPasswordExpired) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Password expired",
+			Message: err.Error(),
+		})
+	}
 	if err != nil {
 		log.Printf("Login error: %v", err)
 		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
@@ -100,6 +136,65 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	return c.JSON(tokens)
 }
 
+// ChangeExpiredPassword godoc
+// @Summary Change an expired password
+// @Description Rotate a password that has exceeded the tenant's maximum age and sign in
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ChangeExpiredPasswordRequest true "Change expired password request"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /api/auth/password/expired [post]
+func (h *AuthHandler) ChangeExpiredPassword(c *fiber.Ctx) error {
+	var req models.ChangeExpiredPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	if req.Email == "" || req.CurrentPassword == "" || req.NewPassword == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing required fields",
+			Message: "Email, current_password and new_password are required",
+		})
+	}
+	req.IPAddress = sharedmiddleware.ClientIP(c)
+
+	tokens, err := h.authService.ChangeExpiredPassword(c.Context(), &req)
+	if blocked, ok := loginBlocked(err); ok {
+		return blockedLoginResponse(c, blocked)
+	}
+	if tenantAccessDenied(err) {
+		return tenantAccessDeniedResponse(c, err)
+	}
+	if errors.Is(err, services.ErrPasswordNotExpired) {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Password not expired",
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		var policyErr *models.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return c.Status(fiber.StatusBadRequest).JSON(passwordPolicyErrorResponse(policyErr))
+		}
+
+		log.Printf("Change expired password error: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "Authentication failed",
+			Message: "Invalid credentials",
+		})
+	}
+
+	return c.JSON(tokens)
+}
+
 // RefreshToken godoc
 // @Summary Refresh access token
 // @Description Get new access token using refresh token
@@ -127,7 +222,10 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 		})
 	}
 
-	tokens, err := h.authService.RefreshToken(c.Context(), req.RefreshToken)
+	tokens, err := h.authService.RefreshToken(c.Context(), req.RefreshToken, sharedmiddleware.ClientIP(c))
+	if tenantAccessDenied(err) {
+		return tenantAccessDeniedResponse(c, err)
+	}
 	if err != nil {
 		log.Printf("Refresh token error: %v", err)
 		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
@@ -180,6 +278,91 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	})
 }
 
+// ListTenants godoc
+// @Summary List the user's tenants
+// @Description List the tenants the signed-in user belongs to, with their role in each
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.TenantMembership
+// @Failure 401 {object} ErrorResponse
+// @Router /api/auth/tenants [get]
+func (h *AuthHandler) ListTenants(c *fiber.Ctx) error {
+	rawUserID, _ := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(rawUserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User not authenticated",
+		})
+	}
+
+	tenants, err := h.authService.ListTenants(c.Context(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list tenants",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(tenants)
+}
+
+// SwitchTenant godoc
+// @Summary Switch tenant
+// @Description Issue a token pair scoped to another tenant the signed-in user belongs to
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SwitchTenantRequest true "Switch tenant request"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/auth/switch-tenant [post]
+func (h *AuthHandler) SwitchTenant(c *fiber.Ctx) error {
+	rawUserID, _ := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(rawUserID)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "Unauthorized",
+			Message: "User not authenticated",
+		})
+	}
+
+	var req models.SwitchTenantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	if req.TenantID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing required fields",
+			Message: "tenant_id is required",
+		})
+	}
+	req.IPAddress = sharedmiddleware.ClientIP(c)
+	req.SSOTenantID, _ = c.Locals("sso_tenant_id").(string)
+
+	tokens, err := h.authService.SwitchTenant(c.Context(), userID, &req)
+	if tenantAccessDenied(err) {
+		return tenantAccessDeniedResponse(c, err)
+	}
+	if err != nil {
+		log.Printf("Switch tenant error: %v", err)
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Tenant switch failed",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(tokens)
+}
+
 // GetProfile godoc
 // @Summary Get user profile
 // @Description Get current user profile information
@@ -298,9 +481,9 @@ func SetupUserManagementRoutes(app *fiber.App, handler *UserManagementHandler) {
 
 	// Password management routes
 	password := api.Group("/password")
-	password.Post("/reset/request", handler.RequestPasswordReset) // POST /api/password/reset/request
-	password.Post("/reset/confirm", handler.ResetPassword)        // POST /api/password/reset/confirm
-	password.Post("/change", handler.ChangePassword)              // POST /api/password/change (authenticated)
+	password.Post("/reset/request", handler.RequestPasswordReset)                            // POST /api/password/reset/request
+	password.Post("/reset/confirm", handler.ResetPassword)                                   // POST /api/password/reset/confirm
+	password.Post("/change", sharedmiddleware.RejectImpersonation(), handler.ChangePassword) // POST /api/password/change (authenticated, not while impersonating)
 
 	// Email verification routes
 	email := api.Group("/email")
@@ -324,8 +507,50 @@ type UpdateProfileRequest struct {
 }
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error      string                     `json:"error"`
+	Message    string                     `json:"message"`
+	Violations []models.PasswordViolation `json:"violations,omitempty"`
+}
+
+func loginBlocked(err error) (*models.LoginBlockedError, bool) {
+	var blocked *models.LoginBlockedError
+	return blocked, errors.As(err, &blocked)
+}
+
+// blockedLoginResponse answers a throttled or locked-out login with 429 and
+// a Retry-After header in whole seconds
+func blockedLoginResponse(c *fiber.Ctx, blocked *models.LoginBlockedError) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{
+		Error:   "Too many login attempts",
+		Message: blocked.Error(),
+	})
+}
+
+// tenantAccessDenied reports whether a login was refused by the target
+// tenant: the user is not a member or the IP address is not allowed
+func tenantAccessDenied(err error) bool {
+	return errors.Is(err, services.ErrIPNotAllowed) || errors.Is(err, services.ErrNotTenantMember)
+}
+
+func tenantAccessDeniedResponse(c *fiber.Ctx, err error) error {
+	title := "IP address not allowed"
+	if errors.Is(err, services.ErrNotTenantMember) {
+		title = "Not a member of this organization"
+	}
+
+	return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+		Error:   title,
+		Message: err.Error(),
+	})
+}
+
+func passwordPolicyErrorResponse(err *models.PasswordPolicyError) ErrorResponse {
+	return ErrorResponse{
+		Error:      "Password policy violation",
+		Message:    err.Error(),
+		Violations: err.Violations,
+	}
 }
 
 type SuccessResponse struct {
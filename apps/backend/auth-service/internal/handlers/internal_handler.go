@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// InternalHandler serves the endpoints other services call with service
+// tokens. A service token only acts on the tenant it was issued for.
+type InternalHandler struct {
+	authService   services.AuthService
+	notifications services.TenantNotificationService
+}
+
+func NewInternalHandler(authService services.AuthService, notifications services.TenantNotificationService) *InternalHandler {
+	return &InternalHandler{
+		authService:   authService,
+		notifications: notifications,
+	}
+}
+
+// CreateTenantAdmin godoc
+// @Summary Create a provisioned tenant's first admin
+// @Description Called by tenant-service while provisioning a tenant. The password must satisfy the tenant's password policy.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tenant_id path string true "Tenant ID"
+// @Param request body models.CreateTenantAdminRequest true "Admin user"
+// @Success 201 {object} models.User
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/internal/tenants/{tenant_id}/admin [post]
+func (h *InternalHandler) CreateTenantAdmin(c *fiber.Ctx) error {
+	tenantID, ok := serviceTenantID(c)
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Tenant mismatch",
+			Message: "The service token was not issued for this tenant",
+		})
+	}
+
+	var req models.CreateTenantAdminRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+	if req.Email == "" || req.FirstName == "" || req.LastName == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: "email, first_name, last_name and password are required",
+		})
+	}
+
+	user, err := h.authService.CreateTenantAdmin(c.Context(), tenantID, &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case err.Error() == "tenant not found":
+			status = fiber.StatusNotFound
+		case strings.HasSuffix(err.Error(), "already exists"):
+			status = fiber.StatusConflict
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to create admin user",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(user)
+}
+
+// DeleteTenantUser godoc
+// @Summary Delete a provisioned tenant's user
+// @Description Called by tenant-service to roll back a failed provisioning. Deleting a user that no longer exists succeeds.
+// @Tags internal
+// @Security BearerAuth
+// @Param tenant_id path string true "Tenant ID"
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/internal/tenants/{tenant_id}/users/{id} [delete]
+func (h *InternalHandler) DeleteTenantUser(c *fiber.Ctx) error {
+	tenantID, ok := serviceTenantID(c)
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Tenant mismatch",
+			Message: "The service token was not issued for this tenant",
+		})
+	}
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	if err := h.authService.DeleteTenantUser(c.Context(), tenantID, userID); err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "user does not belong to this tenant" {
+			status = fiber.StatusForbidden
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to delete user",
+			Message: err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// NotifyTenantAdmins godoc
+// @Summary Email a tenant's admins
+// @Description Called by tenant-service to send billing notices such as payment_failed, tenant_suspended and tenant_reactivated to every active admin of the tenant
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param tenant_id path string true "Tenant ID"
+// @Param request body models.TenantNotificationRequest true "Notice"
+// @Success 202 {object} map[string]int
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/internal/tenants/{tenant_id}/notifications [post]
+func (h *InternalHandler) NotifyTenantAdmins(c *fiber.Ctx) error {
+	tenantID, ok := serviceTenantID(c)
+	if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Tenant mismatch",
+			Message: "The service token was not issued for this tenant",
+		})
+	}
+
+	var req models.TenantNotificationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	notified, err := h.notifications.NotifyTenantAdmins(c.Context(), tenantID, &req)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if strings.HasPrefix(err.Error(), "unknown notification template") {
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to notify tenant admins",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"notified": notified})
+}
+
+// serviceTenantID returns the tenant in the path if the service token was
+// issued for it
+func serviceTenantID(c *fiber.Ctx) (uuid.UUID, bool) {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return uuid.Nil, false
+	}
+
+	tokenTenant, _ := c.Locals("tenant_id").(string)
+	return tenantID, tokenTenant == tenantID.String()
+}
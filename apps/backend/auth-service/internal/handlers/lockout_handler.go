@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type LockoutHandler struct {
+	loginProtection services.LoginProtectionService
+}
+
+func NewLockoutHandler(loginProtection services.LoginProtectionService) *LockoutHandler {
+	return &LockoutHandler{
+		loginProtection: loginProtection,
+	}
+}
+
+// UnlockAccount godoc
+// @Summary Unlock account
+// @Description Unlock an account locked after failed logins, using the token from the lockout email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.UnlockAccountRequest true "Unlock request"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/unlock [post]
+func (h *LockoutHandler) UnlockAccount(c *fiber.Ctx) error {
+	var req models.UnlockAccountRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	if req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing unlock token",
+			Message: "token is required",
+		})
+	}
+
+	if err := h.loginProtection.UnlockWithToken(c.Context(), req.Token, sharedmiddleware.ClientIP(c)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to unlock account",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{Message: "Account unlocked"})
+}
+
+// UnlockUser godoc
+// @Summary Unlock user
+// @Description Lift a login lockout on a user of the tenant
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/users/{id}/unlock [post]
+func (h *LockoutHandler) UnlockUser(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: err.Error(),
+		})
+	}
+
+	currentUserID, _ := c.Locals("user_id").(string)
+	actorID, err := uuid.Parse(currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: err.Error(),
+		})
+	}
+
+	if err := h.loginProtection.Unlock(c.Context(), tenantID, userID, actorID, sharedmiddleware.ClientIP(c)); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "Failed to unlock user",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{Message: "User unlocked"})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/url"
+	"strconv"
+
+	"zplus-saas/apps/backend/auth-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type OIDCHandler struct {
+	oidcService services.OIDCService
+}
+
+func NewOIDCHandler(oidcService services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+	}
+}
+
+// Login godoc
+// @Summary Start OIDC login
+// @Description Redirect to the tenant's configured identity provider
+// @Tags auth
+// @Param tenant_id path string true "Tenant ID"
+// @Param provider path string true "Provider name (google, microsoft or a custom key)"
+// @Param redirect_uri query string false "Frontend URL to return the tokens to"
+// @Success 302
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/oidc/{tenant_id}/{provider}/login [get]
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	authURL, err := h.oidcService.AuthorizationURL(c.Context(), tenantID, c.Params("provider"), c.Query("redirect_uri"))
+	if err != nil {
+		log.Printf("OIDC login error: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "SSO login unavailable",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Callback godoc
+// @Summary OIDC callback
+// @Description Complete an OIDC login and return tokens
+// @Tags auth
+// @Produce json
+// @Param state query string true "Authorization state"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/auth/oidc/callback [get]
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	if idpError := c.Query("error"); idpError != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "SSO login failed",
+			Message: idpError + ": " + c.Query("error_description"),
+		})
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+	if state == "" || code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing required parameters",
+			Message: "state and code are required",
+		})
+	}
+
+	result, err := h.oidcService.HandleCallback(c.Context(), state, code)
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Quota exceeded",
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		log.Printf("OIDC callback error: %v", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "SSO login failed",
+			Message: err.Error(),
+		})
+	}
+
+	return respondSSOLogin(c, result)
+}
+
+// respondSSOLogin returns the tokens of a completed SSO login. Browser flows get the
+// tokens back in the URL fragment, which is never sent to servers.
+func respondSSOLogin(c *fiber.Ctx, result *services.SSOLoginResult) error {
+	if result.RedirectURI != nil {
+		fragment := url.Values{}
+		fragment.Set("access_token", result.Tokens.AccessToken)
+		fragment.Set("refresh_token", result.Tokens.RefreshToken)
+		fragment.Set("token_type", result.Tokens.TokenType)
+		fragment.Set("expires_in", strconv.FormatInt(result.Tokens.ExpiresIn, 10))
+		return c.Redirect(*result.RedirectURI+"#"+fragment.Encode(), fiber.StatusFound)
+	}
+
+	return c.JSON(result.Tokens)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type PrivacyHandler struct {
+	privacyService services.PrivacyService
+}
+
+func NewPrivacyHandler(privacyService services.PrivacyService) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+	}
+}
+
+// CreateRequest godoc
+// @Summary Create data subject request
+// @Description Queue an export or erasure of a user's personal data across all services
+// @Tags privacy
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateDataSubjectRequest true "Data subject request"
+// @Success 202 {object} models.DataSubjectRequest
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/privacy/requests [post]
+func (h *PrivacyHandler) CreateRequest(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.CreateDataSubjectRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	request, err := h.privacyService.CreateRequest(c.Context(), tenantID, userID, sharedmiddleware.ClientIP(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to create request",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(request)
+}
+
+// ListRequests godoc
+// @Summary List data subject requests
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.DataSubjectRequest
+// @Router /api/auth/privacy/requests [get]
+func (h *PrivacyHandler) ListRequests(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	requests, err := h.privacyService.ListRequests(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list requests",
+			Message: err.Error(),
+		})
+	}
+
+	if requests == nil {
+		requests = []*models.DataSubjectRequest{}
+	}
+
+	return c.JSON(requests)
+}
+
+// GetRequest godoc
+// @Summary Get data subject request
+// @Description Get the status and per-service result of a data subject request
+// @Tags privacy
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Request ID"
+// @Success 200 {object} models.DataSubjectRequest
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/privacy/requests/{id} [get]
+func (h *PrivacyHandler) GetRequest(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request ID",
+			Message: err.Error(),
+		})
+	}
+
+	request, err := h.privacyService.GetRequest(c.Context(), tenantID, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "Request not found",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(request)
+}
+
+// DownloadExport godoc
+// @Summary Download data export
+// @Description Download the zip archive of a completed export. Archives expire after seven days.
+// @Tags privacy
+// @Produce application/zip
+// @Security BearerAuth
+// @Param id path string true "Request ID"
+// @Success 200 {file} file
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/privacy/requests/{id}/export [get]
+func (h *PrivacyHandler) DownloadExport(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request ID",
+			Message: err.Error(),
+		})
+	}
+
+	archive, err := h.privacyService.GetArchive(c.Context(), tenantID, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "Export not available",
+			Message: err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="data-export-%s.zip"`, id))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Send(archive)
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type RetentionHandler struct {
+	retentionService services.RetentionService
+}
+
+func NewRetentionHandler(retentionService services.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+	}
+}
+
+// GetPolicies godoc
+// @Summary Get retention policies
+// @Description Get the retention applied to each data class. Classes without an override use the tenant's data retention days.
+// @Tags retention
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.RetentionPolicy
+// @Router /api/auth/retention/policies [get]
+func (h *RetentionHandler) GetPolicies(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	policies, err := h.retentionService.GetPolicies(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to get retention policies",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(policies)
+}
+
+// UpdatePolicy godoc
+// @Summary Update retention policy
+// @Description Override the retention of one data class, or remove the override with a null retention_days
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.UpdateRetentionPolicyRequest true "Retention policy"
+// @Success 200 {array} models.RetentionPolicy
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/retention/policies [put]
+func (h *RetentionHandler) UpdatePolicy(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.UpdateRetentionPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	policies, err := h.retentionService.UpdatePolicy(c.Context(), tenantID, userID, sharedmiddleware.ClientIP(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to update retention policy",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(policies)
+}
+
+// ListHolds godoc
+// @Summary List legal holds
+// @Description List active and released legal holds, active first
+// @Tags retention
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.LegalHold
+// @Router /api/auth/retention/holds [get]
+func (h *RetentionHandler) ListHolds(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	holds, err := h.retentionService.ListHolds(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list legal holds",
+			Message: err.Error(),
+		})
+	}
+
+	if holds == nil {
+		holds = []*models.LegalHold{}
+	}
+
+	return c.JSON(holds)
+}
+
+// PlaceHold godoc
+// @Summary Place legal hold
+// @Description Exempt the whole tenant, a data class or one entity from retention until the hold is released
+// @Tags retention
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateLegalHoldRequest true "Legal hold"
+// @Success 201 {object} models.LegalHold
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/retention/holds [post]
+func (h *RetentionHandler) PlaceHold(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.CreateLegalHoldRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	hold, err := h.retentionService.PlaceHold(c.Context(), tenantID, userID, sharedmiddleware.ClientIP(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to place legal hold",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(hold)
+}
+
+// ReleaseHold godoc
+// @Summary Release legal hold
+// @Tags retention
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Legal hold ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/retention/holds/{id} [delete]
+func (h *RetentionHandler) ReleaseHold(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid legal hold ID",
+			Message: err.Error(),
+		})
+	}
+
+	if err := h.retentionService.ReleaseHold(c.Context(), tenantID, userID, sharedmiddleware.ClientIP(c), id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "Failed to release legal hold",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Message: "Legal hold released",
+	})
+}
+
+// DryRun godoc
+// @Summary Retention dry run
+// @Description Report what retention would remove from the tenant now, per data class, without removing anything
+// @Tags retention
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.RetentionRun
+// @Router /api/auth/retention/dry-run [post]
+func (h *RetentionHandler) DryRun(c *fiber.Ctx) error {
+	tenantID, userID, err := currentTenantAndUser(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token context",
+			Message: err.Error(),
+		})
+	}
+
+	run, err := h.retentionService.DryRun(c.Context(), tenantID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to run retention dry run",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(run)
+}
+
+// ListRuns godoc
+// @Summary List retention runs
+// @Description List the tenant's latest retention runs and dry runs with what each removed
+// @Tags retention
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.RetentionRun
+// @Router /api/auth/retention/runs [get]
+func (h *RetentionHandler) ListRuns(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	runs, err := h.retentionService.ListRuns(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list retention runs",
+			Message: err.Error(),
+		})
+	}
+
+	if runs == nil {
+		runs = []*models.RetentionRun{}
+	}
+
+	return c.JSON(runs)
+}
+
+// Metrics godoc
+// @Summary Retention metrics
+// @Description Total rows removed by retention per data class over the last days
+// @Tags retention
+// @Produce json
+// @Security BearerAuth
+// @Param days query int false "Period in days (1-365, default 30)"
+// @Success 200 {object} models.RetentionMetrics
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/retention/metrics [get]
+func (h *RetentionHandler) Metrics(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	metrics, err := h.retentionService.Metrics(c.Context(), tenantID, c.QueryInt("days", 30))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to get retention metrics",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(metrics)
+}
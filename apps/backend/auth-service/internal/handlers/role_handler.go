@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type RoleHandler struct {
+	rbacService services.RBACService
+}
+
+func NewRoleHandler(rbacService services.RBACService) *RoleHandler {
+	return &RoleHandler{
+		rbacService: rbacService,
+	}
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List the built-in system roles and the tenant's custom roles
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Role
+// @Router /api/auth/roles [get]
+func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	roles, err := h.rbacService.ListRoles(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list roles",
+			Message: err.Error(),
+		})
+	}
+
+	if roles == nil {
+		roles = []*models.Role{}
+	}
+
+	return c.JSON(roles)
+}
+
+// GetRole godoc
+// @Summary Get role
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Success 200 {object} models.Role
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/roles/{id} [get]
+func (h *RoleHandler) GetRole(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid role ID",
+			Message: err.Error(),
+		})
+	}
+
+	role, err := h.rbacService.GetRole(c.Context(), tenantID, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "Role not found",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(role)
+}
+
+// CreateRole godoc
+// @Summary Create custom role
+// @Description Create a tenant role from permission strings such as crm.lead.write or crm.*
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateRoleRequest true "Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/roles [post]
+func (h *RoleHandler) CreateRole(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.CreateRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	role, err := h.rbacService.CreateRole(c.Context(), tenantID, currentPermissions(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to create role",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(role)
+}
+
+// UpdateRole godoc
+// @Summary Update custom role
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Param request body models.UpdateRoleRequest true "Role changes"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/roles/{id} [put]
+func (h *RoleHandler) UpdateRole(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid role ID",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.UpdateRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	role, err := h.rbacService.UpdateRole(c.Context(), tenantID, id, currentPermissions(c), &req)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to update role",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(role)
+}
+
+// DeleteRole godoc
+// @Summary Delete custom role
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/roles/{id} [delete]
+func (h *RoleHandler) DeleteRole(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid role ID",
+			Message: err.Error(),
+		})
+	}
+
+	err = h.rbacService.DeleteRole(c.Context(), tenantID, id)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to delete role",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Message: "Role deleted",
+	})
+}
+
+// ListPermissions godoc
+// @Summary List permissions
+// @Description List every permission that can be granted to a custom role
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Permission
+// @Router /api/auth/permissions [get]
+func (h *RoleHandler) ListPermissions(c *fiber.Ctx) error {
+	permissions, err := h.rbacService.ListPermissions(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list permissions",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(permissions)
+}
+
+// MyPermissions godoc
+// @Summary Get current user's permissions
+// @Description Resolve the current user's effective permissions from the database
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.UserPermissions
+// @Router /api/auth/permissions/me [get]
+func (h *RoleHandler) MyPermissions(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	currentUserID, _ := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: err.Error(),
+		})
+	}
+
+	permissions, err := h.rbacService.GetUserPermissions(c.Context(), tenantID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "User not found",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(permissions)
+}
+
+// GetUserRoles godoc
+// @Summary Get user's roles
+// @Tags roles
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.UserPermissions
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/users/{id}/roles [get]
+func (h *RoleHandler) GetUserRoles(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: err.Error(),
+		})
+	}
+
+	permissions, err := h.rbacService.GetUserPermissions(c.Context(), tenantID, userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "User not found",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(permissions)
+}
+
+// AssignUserRoles godoc
+// @Summary Assign custom roles to user
+// @Description Replace the custom roles granted to a user. Changes apply to tokens issued afterwards.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.AssignRolesRequest true "Role IDs"
+// @Success 200 {object} models.UserPermissions
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/users/{id}/roles [put]
+func (h *RoleHandler) AssignUserRoles(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.AssignRolesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	permissions, err := h.rbacService.AssignRoles(c.Context(), tenantID, userID, currentPermissions(c), req.RoleIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Failed to assign roles",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(permissions)
+}
+
+func currentPermissions(c *fiber.Ctx) []string {
+	permissions, _ := c.Locals("permissions").([]string)
+	return permissions
+}
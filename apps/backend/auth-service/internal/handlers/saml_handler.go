@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type SAMLHandler struct {
+	samlService services.SAMLService
+}
+
+func NewSAMLHandler(samlService services.SAMLService) *SAMLHandler {
+	return &SAMLHandler{
+		samlService: samlService,
+	}
+}
+
+// Metadata godoc
+// @Summary SAML service provider metadata
+// @Description Get the tenant's SP metadata to register with its identity provider
+// @Tags auth
+// @Produce xml
+// @Param tenant_id path string true "Tenant ID"
+// @Success 200 {string} string "SP metadata XML"
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/saml/{tenant_id}/metadata [get]
+func (h *SAMLHandler) Metadata(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	metadata, err := h.samlService.Metadata(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "SAML not configured",
+			Message: err.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return c.Send(metadata)
+}
+
+// Login godoc
+// @Summary Start SAML login
+// @Description Redirect to the tenant's SAML identity provider
+// @Tags auth
+// @Param tenant_id path string true "Tenant ID"
+// @Param redirect_uri query string false "Frontend URL to return the tokens to"
+// @Success 302
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/saml/{tenant_id}/login [get]
+func (h *SAMLHandler) Login(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	authURL, err := h.samlService.AuthorizationURL(c.Context(), tenantID, c.Query("redirect_uri"))
+	if err != nil {
+		log.Printf("SAML login error: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "SSO login unavailable",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// ACS godoc
+// @Summary SAML assertion consumer service
+// @Description Validate a signed SAML response and return tokens
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param SAMLResponse formData string true "Base64 encoded SAML response"
+// @Param RelayState formData string false "Relay state"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/auth/saml/{tenant_id}/acs [post]
+func (h *SAMLHandler) ACS(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	samlResponse := c.FormValue("SAMLResponse")
+	if samlResponse == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing required parameters",
+			Message: "SAMLResponse is required",
+		})
+	}
+
+	result, err := h.samlService.HandleACS(c.Context(), tenantID, samlResponse, c.FormValue("RelayState"))
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return c.Status(fiber.StatusForbidden).JSON(ErrorResponse{
+			Error:   "Quota exceeded",
+			Message: err.Error(),
+		})
+	}
+	if err != nil {
+		// Validation details stay in the logs, they help attackers more than users
+		log.Printf("SAML ACS error for tenant %s: %v", tenantID, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(ErrorResponse{
+			Error:   "SSO login failed",
+			Message: "The SAML response could not be validated",
+		})
+	}
+
+	return respondSSOLogin(c, result)
+}
+
+// GetConnection godoc
+// @Summary Get SAML connection
+// @Description Get the SAML connection of the current tenant
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.SAMLConnection
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/saml/connection [get]
+func (h *SAMLHandler) GetConnection(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	connection, err := h.samlService.GetConnection(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "SAML not configured",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(connection)
+}
+
+// ConfigureConnection godoc
+// @Summary Configure SAML connection
+// @Description Upload IdP metadata and configure SAML login for the current tenant
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SAMLConnectionRequest true "SAML connection"
+// @Success 200 {object} models.SAMLConnection
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/saml/connection [put]
+func (h *SAMLHandler) ConfigureConnection(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.SAMLConnectionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	if req.IdPMetadata == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing required fields",
+			Message: "idp_metadata is required",
+		})
+	}
+
+	connection, err := h.samlService.ConfigureConnection(c.Context(), tenantID, &req)
+	if err != nil {
+		log.Printf("SAML configuration error: %v", err)
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "SAML configuration failed",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(connection)
+}
+
+// DeleteConnection godoc
+// @Summary Delete SAML connection
+// @Description Remove SAML login (and SSO-only mode) from the current tenant
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/saml/connection [delete]
+func (h *SAMLHandler) DeleteConnection(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	err = h.samlService.DeleteConnection(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "SAML not configured",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Message: "SAML connection deleted",
+	})
+}
+
+// currentTenantID returns the authenticated user's tenant
+func currentTenantID(c *fiber.Ctx) (uuid.UUID, error) {
+	tenantID, _ := c.Locals("tenant_id").(string)
+	return uuid.Parse(tenantID)
+}
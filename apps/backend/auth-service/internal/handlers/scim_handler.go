@@ -0,0 +1,558 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const scimContentType = "application/scim+json"
+
+type SCIMHandler struct {
+	scimService services.SCIMService
+}
+
+func NewSCIMHandler(scimService services.SCIMService) *SCIMHandler {
+	return &SCIMHandler{
+		scimService: scimService,
+	}
+}
+
+// ServiceProviderConfig godoc
+// @Summary SCIM service provider configuration
+// @Description Describe the SCIM features supported by this service
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /api/scim/v2/ServiceProviderConfig [get]
+func (h *SCIMHandler) ServiceProviderConfig(c *fiber.Ctx) error {
+	return respondSCIM(c, fiber.StatusOK, fiber.Map{
+		"schemas":        []string{models.SCIMSchemaServiceProvider},
+		"patch":          fiber.Map{"supported": true},
+		"bulk":           fiber.Map{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         fiber.Map{"supported": true, "maxResults": 200},
+		"changePassword": fiber.Map{"supported": false},
+		"sort":           fiber.Map{"supported": false},
+		"etag":           fiber.Map{"supported": false},
+		"authenticationSchemes": []fiber.Map{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "Per-tenant SCIM token issued by a tenant admin",
+			"primary":     true,
+		}},
+	})
+}
+
+// ListUsers godoc
+// @Summary List SCIM users
+// @Description List the tenant's users, optionally filtered
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param filter query string false "SCIM filter, e.g. userName eq \"jane@example.com\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Page size"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Users [get]
+func (h *SCIMHandler) ListUsers(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	list, err := h.scimService.ListUsers(c.Context(), tenantID, c.Query("filter"), c.QueryInt("startIndex", 1), c.QueryInt("count", 100))
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusOK, list)
+}
+
+// GetUser godoc
+// @Summary Get SCIM user
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} models.SCIMUser
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Users/{id} [get]
+func (h *SCIMHandler) GetUser(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	user, err := h.scimService.GetUser(c.Context(), tenantID, c.Params("id"))
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusOK, user)
+}
+
+// CreateUser godoc
+// @Summary Provision SCIM user
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SCIMUser true "SCIM user"
+// @Success 201 {object} models.SCIMUser
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 409 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Users [post]
+func (h *SCIMHandler) CreateUser(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	var req models.SCIMUser
+	if err := parseSCIMBody(c, &req); err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	user, err := h.scimService.CreateUser(c.Context(), tenantID, &req)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusCreated, user)
+}
+
+// ReplaceUser godoc
+// @Summary Replace SCIM user
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.SCIMUser true "SCIM user"
+// @Success 200 {object} models.SCIMUser
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Users/{id} [put]
+func (h *SCIMHandler) ReplaceUser(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	var req models.SCIMUser
+	if err := parseSCIMBody(c, &req); err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	user, err := h.scimService.ReplaceUser(c.Context(), tenantID, c.Params("id"), &req)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusOK, user)
+}
+
+// PatchUser godoc
+// @Summary Patch SCIM user
+// @Description Apply add, replace and remove operations, e.g. active=false to deactivate
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body models.SCIMPatchRequest true "Patch operations"
+// @Success 200 {object} models.SCIMUser
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Users/{id} [patch]
+func (h *SCIMHandler) PatchUser(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	var req models.SCIMPatchRequest
+	if err := parseSCIMBody(c, &req); err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	user, err := h.scimService.PatchUser(c.Context(), tenantID, c.Params("id"), &req)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusOK, user)
+}
+
+// DeleteUser godoc
+// @Summary Delete SCIM user
+// @Tags scim
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Users/{id} [delete]
+func (h *SCIMHandler) DeleteUser(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	err = h.scimService.DeleteUser(c.Context(), tenantID, c.Params("id"))
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListGroups godoc
+// @Summary List SCIM groups
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param filter query string false "SCIM filter, e.g. displayName eq \"Admins\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Page size"
+// @Param excludedAttributes query string false "Set to members to omit group members"
+// @Success 200 {object} models.SCIMListResponse
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Groups [get]
+func (h *SCIMHandler) ListGroups(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	list, err := h.scimService.ListGroups(c.Context(), tenantID, c.Query("filter"), c.QueryInt("startIndex", 1), c.QueryInt("count", 100))
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	if excludesMembers(c) {
+		for _, group := range list.Resources.([]*models.SCIMGroupResource) {
+			group.Members = nil
+		}
+	}
+
+	return respondSCIM(c, fiber.StatusOK, list)
+}
+
+// GetGroup godoc
+// @Summary Get SCIM group
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Success 200 {object} models.SCIMGroupResource
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Groups/{id} [get]
+func (h *SCIMHandler) GetGroup(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	group, err := h.scimService.GetGroup(c.Context(), tenantID, c.Params("id"))
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	if excludesMembers(c) {
+		group.Members = nil
+	}
+
+	return respondSCIM(c, fiber.StatusOK, group)
+}
+
+// CreateGroup godoc
+// @Summary Provision SCIM group
+// @Description Members of groups mapped to a role receive that role
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.SCIMGroupResource true "SCIM group"
+// @Success 201 {object} models.SCIMGroupResource
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 409 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Groups [post]
+func (h *SCIMHandler) CreateGroup(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	var req models.SCIMGroupResource
+	if err := parseSCIMBody(c, &req); err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	group, err := h.scimService.CreateGroup(c.Context(), tenantID, &req)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusCreated, group)
+}
+
+// ReplaceGroup godoc
+// @Summary Replace SCIM group
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Param request body models.SCIMGroupResource true "SCIM group"
+// @Success 200 {object} models.SCIMGroupResource
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Groups/{id} [put]
+func (h *SCIMHandler) ReplaceGroup(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	var req models.SCIMGroupResource
+	if err := parseSCIMBody(c, &req); err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	group, err := h.scimService.ReplaceGroup(c.Context(), tenantID, c.Params("id"), &req)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusOK, group)
+}
+
+// PatchGroup godoc
+// @Summary Patch SCIM group
+// @Description Add, replace or remove members and rename the group
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Param request body models.SCIMPatchRequest true "Patch operations"
+// @Success 200 {object} models.SCIMGroupResource
+// @Failure 400 {object} models.SCIMErrorResponse
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Groups/{id} [patch]
+func (h *SCIMHandler) PatchGroup(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	var req models.SCIMPatchRequest
+	if err := parseSCIMBody(c, &req); err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	group, err := h.scimService.PatchGroup(c.Context(), tenantID, c.Params("id"), &req)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return respondSCIM(c, fiber.StatusOK, group)
+}
+
+// DeleteGroup godoc
+// @Summary Delete SCIM group
+// @Tags scim
+// @Security BearerAuth
+// @Param id path string true "Group ID"
+// @Success 204
+// @Failure 404 {object} models.SCIMErrorResponse
+// @Router /api/scim/v2/Groups/{id} [delete]
+func (h *SCIMHandler) DeleteGroup(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	err = h.scimService.DeleteGroup(c.Context(), tenantID, c.Params("id"))
+	if err != nil {
+		return respondSCIMError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateToken godoc
+// @Summary Create SCIM token
+// @Description Issue a bearer token for the tenant's identity provider. The token is only returned once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body models.CreateSCIMTokenRequest true "Token name"
+// @Success 201 {object} models.CreateSCIMTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/auth/scim/tokens [post]
+func (h *SCIMHandler) CreateToken(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	currentUserID, _ := c.Locals("user_id").(string)
+	userID, err := uuid.Parse(currentUserID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid user ID",
+			Message: err.Error(),
+		})
+	}
+
+	var req models.CreateSCIMTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	if req.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Missing required fields",
+			Message: "name is required",
+		})
+	}
+
+	token, err := h.scimService.CreateToken(c.Context(), tenantID, userID, req.Name)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to create SCIM token",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(token)
+}
+
+// ListTokens godoc
+// @Summary List SCIM tokens
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.SCIMToken
+// @Router /api/auth/scim/tokens [get]
+func (h *SCIMHandler) ListTokens(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	tokens, err := h.scimService.ListTokens(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list SCIM tokens",
+			Message: err.Error(),
+		})
+	}
+
+	if tokens == nil {
+		tokens = []*models.SCIMToken{}
+	}
+
+	return c.JSON(tokens)
+}
+
+// DeleteToken godoc
+// @Summary Revoke SCIM token
+// @Tags auth
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 200 {object} SuccessResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/auth/scim/tokens/{id} [delete]
+func (h *SCIMHandler) DeleteToken(c *fiber.Ctx) error {
+	tenantID, err := currentTenantID(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: err.Error(),
+		})
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid token ID",
+			Message: err.Error(),
+		})
+	}
+
+	err = h.scimService.DeleteToken(c.Context(), tenantID, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(ErrorResponse{
+			Error:   "SCIM token not found",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(SuccessResponse{
+		Message: "SCIM token revoked",
+	})
+}
+
+// parseSCIMBody decodes a JSON body regardless of the application/scim+json content type
+func parseSCIMBody(c *fiber.Ctx, v interface{}) error {
+	if err := json.Unmarshal(c.Body(), v); err != nil {
+		return &services.SCIMError{Status: fiber.StatusBadRequest, Type: "invalidSyntax", Detail: err.Error()}
+	}
+	return nil
+}
+
+func excludesMembers(c *fiber.Ctx) bool {
+	for _, attribute := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+func respondSCIM(c *fiber.Ctx, status int, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, scimContentType)
+	return c.Status(status).Send(body)
+}
+
+// respondSCIMError writes a SCIM error body; unexpected errors are logged and hidden
+func respondSCIMError(c *fiber.Ctx, err error) error {
+	var scimErr *services.SCIMError
+	if !errors.As(err, &scimErr) {
+		log.Printf("SCIM request %s %s failed: %v", c.Method(), c.Path(), err)
+		scimErr = &services.SCIMError{Status: fiber.StatusInternalServerError, Detail: "internal server error"}
+	}
+
+	return respondSCIM(c, scimErr.Status, models.SCIMErrorResponse{
+		Schemas:  []string{models.SCIMSchemaError},
+		Status:   strconv.Itoa(scimErr.Status),
+		ScimType: scimErr.Type,
+		Detail:   scimErr.Detail,
+	})
+}
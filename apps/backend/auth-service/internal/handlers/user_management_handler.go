@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -56,6 +58,9 @@ func (h *UserManagementHandler) InviteUser(c *fiber.Ctx) error {
 	}
 
 	invitation, err := h.invitationService.InviteUser(tenantID, userID, req.Email, req.Role)
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -99,8 +104,11 @@ func (h *UserManagementHandler) AcceptInvitation(c *fiber.Ctx) error {
 	}
 
 	user, err := h.invitationService.AcceptInvitation(token, &req)
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(passwordErrorMap(err))
 	}
 
 	return c.JSON(fiber.Map{
@@ -171,7 +179,7 @@ func (h *UserManagementHandler) ResetPassword(c *fiber.Ctx) error {
 
 	err := h.passwordResetService.ResetPassword(req.Token, req.NewPassword)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(passwordErrorMap(err))
 	}
 
 	return c.JSON(fiber.Map{"message": "Password reset successfully"})
@@ -195,7 +203,7 @@ func (h *UserManagementHandler) ChangePassword(c *fiber.Ctx) error {
 
 	err = h.passwordResetService.ChangePassword(userID, req.CurrentPassword, req.NewPassword)
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		return c.Status(400).JSON(passwordErrorMap(err))
 	}
 
 	return c.JSON(fiber.Map{"message": "Password changed successfully"})
@@ -272,3 +280,12 @@ func (h *UserManagementHandler) UpdateProfile(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"message": "Profile updated successfully"})
 }
+
+// passwordErrorMap reports password policy violations rule by rule
+func passwordErrorMap(err error) fiber.Map {
+	var policyErr *models.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return fiber.Map{"error": policyErr.Error(), "violations": policyErr.Violations}
+	}
+	return fiber.Map{"error": err.Error()}
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"zplus-saas/apps/backend/auth-service/internal/services"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -77,7 +78,33 @@ func (m *AuthMiddleware) RequireAuth(c *fiber.Ctx) error {
 	c.Locals("tenant_id", claims.TenantID)
 	c.Locals("user_email", claims.Email)
 	c.Locals("user_role", claims.Role)
+	c.Locals("permissions", claims.Permissions)
 	c.Locals("is_verified", claims.IsVerified)
+	c.Locals("api_key_id", claims.APIKeyID)
+	c.Locals("sso_tenant_id", claims.SSOTenantID)
+	sharedmiddleware.SetImpersonationLocals(c, claims.Act)
+
+	return c.Next()
+}
+
+// RequireSession rejects access tokens exchanged for an API key and
+// impersonation tokens. Routes that mint credentials (switching tenant,
+// managing keys, impersonating) or end the user's sessions need the user's
+// own sign-in, so a leaked key cannot be turned into a longer-lived one and
+// support staff cannot act beyond the impersonation session.
+func (m *AuthMiddleware) RequireSession(c *fiber.Ctx) error {
+	if apiKeyID, _ := c.Locals("api_key_id").(string); apiKeyID != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Session required",
+			"message": "This endpoint cannot be used with an API key",
+		})
+	}
+	if sharedmiddleware.Impersonator(c) != "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Session required",
+			"message": "This endpoint cannot be used while impersonating a user",
+		})
+	}
 
 	return c.Next()
 }
@@ -163,6 +190,7 @@ func (m *AuthMiddleware) OptionalAuth(c *fiber.Ctx) error {
 	c.Locals("tenant_id", claims.TenantID)
 	c.Locals("user_email", claims.Email)
 	c.Locals("user_role", claims.Role)
+	c.Locals("permissions", claims.Permissions)
 	c.Locals("is_verified", claims.IsVerified)
 
 	return c.Next()
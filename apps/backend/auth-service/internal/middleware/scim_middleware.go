@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type SCIMMiddleware struct {
+	scimService services.SCIMService
+}
+
+func NewSCIMMiddleware(scimService services.SCIMService) *SCIMMiddleware {
+	return &SCIMMiddleware{
+		scimService: scimService,
+	}
+}
+
+// RequireToken validates a tenant's SCIM bearer token and sets the tenant context
+func (m *SCIMMiddleware) RequireToken(c *fiber.Ctx) error {
+	authHeader := c.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return scimUnauthorized(c, "Bearer token required")
+	}
+
+	token, err := m.scimService.Authenticate(c.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return scimUnauthorized(c, err.Error())
+	}
+
+	c.Locals("tenant_id", token.TenantID.String())
+	c.Locals("scim_token_id", token.ID.String())
+
+	return c.Next()
+}
+
+func scimUnauthorized(c *fiber.Ctx, detail string) error {
+	body, _ := json.Marshal(models.SCIMErrorResponse{
+		Schemas: []string{models.SCIMSchemaError},
+		Status:  strconv.Itoa(fiber.StatusUnauthorized),
+		Detail:  detail,
+	})
+
+	c.Set(fiber.HeaderContentType, "application/scim+json")
+	c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+	return c.Status(fiber.StatusUnauthorized).Send(body)
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// TenantStats is the tenant and subscription summary computed by
+// tenant-service for the last Days days. The Previous fields cover the Days
+// days before that.
+type TenantStats struct {
+	Days                int                    `json:"days"`
+	TotalTenants        int                    `json:"total_tenants"`
+	TenantsByStatus     map[string]int         `json:"tenants_by_status"`
+	NewTenants          int                    `json:"new_tenants"`
+	PreviousNewTenants  int                    `json:"previous_new_tenants"`
+	ActiveSubscriptions int                    `json:"active_subscriptions"`
+	TrialSubscriptions  int                    `json:"trial_subscriptions"`
+	Revenue             []*SubscriptionRevenue `json:"revenue"`
+}
+
+// SubscriptionRevenue is the recurring revenue of paying subscriptions in one currency
+type SubscriptionRevenue struct {
+	Currency      string  `json:"currency"`
+	Subscriptions int     `json:"subscriptions"`
+	MRR           float64 `json:"mrr"`
+	ARR           float64 `json:"arr"`
+	PreviousMRR   float64 `json:"previous_mrr"`
+}
+
+// AdminStatsGrowth holds percentage changes between the selected period and
+// the one before it
+type AdminStatsGrowth struct {
+	Tenants float64 `json:"tenants"` // new tenants
+	Users   float64 `json:"users"`   // new users
+	Revenue float64 `json:"revenue"` // MRR in RevenueCurrency
+}
+
+// AdminStats is the platform admin dashboard summary. Field names are
+// camelCase, as the admin app has always read them. TotalRevenue is the MRR
+// in RevenueCurrency; other currencies are only listed in Revenue.
+type AdminStats struct {
+	Period              string                 `json:"period"`
+	TotalTenants        int                    `json:"totalTenants"`
+	TenantsByStatus     map[string]int         `json:"tenantsByStatus"`
+	NewTenants          int                    `json:"newTenants"`
+	TotalUsers          int                    `json:"totalUsers"`
+	ActiveUsers         int                    `json:"activeUsers"`
+	NewUsers            int                    `json:"newUsers"`
+	RecentSignups       []*User                `json:"recentSignups"`
+	ActiveSubscriptions int                    `json:"activeSubscriptions"`
+	TrialSubscriptions  int                    `json:"trialSubscriptions"`
+	TotalRevenue        float64                `json:"totalRevenue"`
+	RevenueCurrency     string                 `json:"revenueCurrency"`
+	MRR                 float64                `json:"mrr"`
+	ARR                 float64                `json:"arr"`
+	Revenue             []*SubscriptionRevenue `json:"revenue"`
+	Growth              AdminStatsGrowth       `json:"growth"`
+	// Partial is set when tenant-service could not be reached: tenant and
+	// revenue figures are then missing, and the result is not cached
+	Partial     bool      `json:"partial"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Roles carried by access tokens exchanged for an API key. The user ID of a
+// service account token is the service account's ID.
+const (
+	RoleAPIKey         = "api_key"
+	RoleServiceAccount = "service_account"
+)
+
+// APIKeyPrefix starts every API key, so gateways can tell keys from JWTs
+const APIKeyPrefix = "zpk_"
+
+// ServiceAccount is a non-human principal of a tenant. Its permissions are
+// fixed by an admin when it is created; it never logs in, it only owns keys.
+type ServiceAccount struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	TenantID    uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	Name        string     `json:"name" db:"name"`
+	Description string     `json:"description" db:"description"`
+	Permissions []string   `json:"permissions" db:"permissions"`
+	IsActive    bool       `json:"is_active" db:"is_active"`
+	CreatedBy   *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// APIKey belongs either to a user (a personal key) or to a service account.
+// Scopes narrow what the owner may do; the key never grants more than its
+// owner currently holds.
+type APIKey struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	TenantID         uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	UserID           *uuid.UUID `json:"user_id,omitempty" db:"user_id"`
+	ServiceAccountID *uuid.UUID `json:"service_account_id,omitempty" db:"service_account_id"`
+	Name             string     `json:"name" db:"name"`
+	Prefix           string     `json:"prefix" db:"prefix"`
+	KeyHash          string     `json:"-" db:"key_hash"`
+	Scopes           []string   `json:"scopes" db:"scopes"`
+	ExpiresAt        time.Time  `json:"expires_at" db:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP       *string    `json:"last_used_ip" db:"last_used_ip"`
+	RevokedAt        *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedBy        *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateServiceAccountRequest creates a service account
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name" validate:"required,max=100"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" validate:"required,min=1"`
+}
+
+// CreateAPIKeyRequest creates an API key. Without a service account the key
+// belongs to the caller. Scopes default to everything the owner holds.
+type CreateAPIKeyRequest struct {
+	Name             string   `json:"name" validate:"required,max=100"`
+	ServiceAccountID string   `json:"service_account_id,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+	ExpiresInDays    int      `json:"expires_in_days,omitempty"`
+}
+
+// RotateAPIKeyRequest replaces a key. The old key keeps working for the
+// grace period so integrations can be switched over without downtime.
+type RotateAPIKeyRequest struct {
+	GracePeriodMinutes int `json:"grace_period_minutes,omitempty"`
+}
+
+// CreateAPIKeyResponse returns the plaintext key, which is only shown once
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyTokenResponse is the short-lived access token exchanged for an API key
+type APIKeyTokenResponse struct {
+	AccessToken string   `json:"access_token"`
+	TokenType   string   `json:"token_type"`
+	ExpiresIn   int64    `json:"expires_in"`
+	Permissions []string `json:"permissions"`
+}
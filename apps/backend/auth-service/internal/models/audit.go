@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audit log actions
+const (
+	AuditActionAccountLocked   = "account.locked"
+	AuditActionAccountUnlocked = "account.unlocked"
+	AuditActionLoginIPBlocked  = "login.ip_blocked"
+	AuditActionLoginIPDenied   = "login.ip_denied"
+	AuditActionLoginIPBypassed = "login.ip_allowlist_bypassed"
+	AuditActionImpersonation   = "impersonation.started"
+	AuditActionPrivacyRequest  = "privacy.requested"
+	AuditActionPrivacyExport   = "privacy.exported"
+	AuditActionPrivacyErase    = "privacy.erased"
+	AuditActionPrivacyFailed   = "privacy.failed"
+	AuditActionRetentionPolicy = "retention.policy_updated"
+	AuditActionLegalHoldPlaced = "retention.hold_placed"
+	AuditActionLegalHoldLifted = "retention.hold_released"
+)
+
+// AuditLog records a security-relevant event. ActorID is nil for events the
+// system triggers itself, such as a lockout after failed logins.
+type AuditLog struct {
+	ID           uuid.UUID              `json:"id" db:"id"`
+	TenantID     *uuid.UUID             `json:"tenant_id,omitempty" db:"tenant_id"`
+	ActorID      *uuid.UUID             `json:"actor_id,omitempty" db:"actor_id"`
+	TargetUserID *uuid.UUID             `json:"target_user_id,omitempty" db:"target_user_id"`
+	Action       string                 `json:"action" db:"action"`
+	IPAddress    string                 `json:"ip_address,omitempty" db:"ip_address"`
+	Details      map[string]interface{} `json:"details,omitempty" db:"details"`
+	CreatedAt    time.Time              `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Email templates, one per transactional email
+const (
+	EmailTemplateInvitation    = "invitation"
+	EmailTemplatePasswordReset = "password_reset"
+	EmailTemplateVerification  = "verification"
+	EmailTemplateAccountLocked = "account_locked"
+
+	// Billing notices tenant-service sends to a tenant's admins
+	EmailTemplatePaymentFailed     = "payment_failed"
+	EmailTemplateTenantSuspended   = "tenant_suspended"
+	EmailTemplateTenantReactivated = "tenant_reactivated"
+)
+
+// TenantNotificationRequest asks auth-service to email a tenant's admins one
+// of the notices other services may send
+type TenantNotificationRequest struct {
+	Template string            `json:"template" validate:"required"`
+	Params   map[string]string `json:"params"`
+}
+
+// Email outbox statuses
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSending = "sending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+)
+
+// EmailMessage is a rendered email waiting in, or delivered from, the outbox
+type EmailMessage struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	TenantID      *uuid.UUID `json:"tenant_id,omitempty" db:"tenant_id"`
+	Template      string     `json:"template" db:"template"`
+	Language      string     `json:"language" db:"language"`
+	From          string     `json:"from" db:"from_address"`
+	To            string     `json:"to" db:"to_address"`
+	Subject       string     `json:"subject" db:"subject"`
+	HTMLBody      string     `json:"html_body" db:"html_body"`
+	TextBody      string     `json:"text_body" db:"text_body"`
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	MaxAttempts   int        `json:"max_attempts" db:"max_attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     *string    `json:"last_error,omitempty" db:"last_error"`
+	SentAt        *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// BrandingConfig is the decoded form of TenantConfiguration.BrandingConfig.
+// Empty fields fall back to the platform defaults.
+type BrandingConfig struct {
+	CompanyName     string `json:"company_name,omitempty"`
+	LogoURL         string `json:"logo_url,omitempty"`
+	PrimaryColor    string `json:"primary_color,omitempty"` // hex, e.g. #2563eb
+	SupportEmail    string `json:"support_email,omitempty"`
+	FooterText      string `json:"footer_text,omitempty"`
+	DefaultLanguage string `json:"default_language,omitempty"` // for recipients without a profile language
+	EmailFromName   string `json:"email_from_name,omitempty"`
+}
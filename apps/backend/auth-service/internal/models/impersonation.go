@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ImpersonationRequest asks for a token to act as a tenant user. Reason is
+// required and kept in the audit log.
+type ImpersonationRequest struct {
+	UserID          uuid.UUID `json:"user_id" validate:"required"`
+	TenantID        uuid.UUID `json:"tenant_id" validate:"required"`
+	Reason          string    `json:"reason" validate:"required"`
+	DurationMinutes int       `json:"duration_minutes,omitempty"`
+}
+
+// ImpersonationActor is the admin behind an impersonation session
+type ImpersonationActor struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+// ImpersonationResponse is an access token acting as User. There is no
+// refresh token: when it expires the admin has to start a new session.
+type ImpersonationResponse struct {
+	AccessToken   string             `json:"access_token"`
+	TokenType     string             `json:"token_type"`
+	ExpiresIn     int64              `json:"expires_in"`
+	ExpiresAt     time.Time          `json:"expires_at"`
+	SessionID     uuid.UUID          `json:"session_id"`
+	User          *User              `json:"user"`
+	Permissions   []string           `json:"permissions"`
+	Impersonation bool               `json:"impersonation"`
+	Actor         ImpersonationActor `json:"actor"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TenantMembership grants a user identity access to a tenant with a role in
+// that tenant. Users carry the membership of their home tenant in User.TenantID
+// and User.Role; tokens for another tenant are issued with that membership's
+// tenant and role instead.
+type TenantMembership struct {
+	UserID          uuid.UUID `json:"user_id" db:"user_id"`
+	TenantID        uuid.UUID `json:"tenant_id" db:"tenant_id"`
+	TenantName      string    `json:"tenant_name" db:"tenant_name"`
+	TenantSubdomain string    `json:"tenant_subdomain" db:"tenant_subdomain"`
+	Role            string    `json:"role" db:"role"`
+	IsActive        bool      `json:"is_active" db:"is_active"`
+	IsHome          bool      `json:"is_home" db:"is_home"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// SwitchTenantRequest selects the tenant for a new tenant-scoped token pair
+type SwitchTenantRequest struct {
+	TenantID    string `json:"tenant_id" validate:"required,uuid"`
+	IPAddress   string `json:"-"`
+	SSOTenantID string `json:"-"` // from the caller's token
+}
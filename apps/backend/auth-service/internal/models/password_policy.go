@@ -0,0 +1,70 @@
+package models
+
+import (
+	"strings"
+)
+
+// PasswordPolicy is the decoded form of tenant_configurations.password_policy.
+// Keys missing from a tenant's policy keep the DefaultPasswordPolicy values.
+type PasswordPolicy struct {
+	MinLength           int  `json:"minLength"`
+	RequireUppercase    bool `json:"requireUppercase"`
+	RequireLowercase    bool `json:"requireLowercase"`
+	RequireNumbers      bool `json:"requireNumbers"`
+	RequireSpecialChars bool `json:"requireSpecialChars"`
+	HistoryCount        int  `json:"historyCount"`  // reject the last N passwords, 0 disables
+	MaxAgeDays          int  `json:"maxAgeDays"`    // force rotation after N days, 0 disables
+	CheckBreached       bool `json:"checkBreached"` // reject passwords found in the breached-password list
+}
+
+// DefaultPasswordPolicy applies to tenants without a configured policy and
+// to registrations that create a new tenant
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:        8,
+	RequireUppercase: true,
+	RequireLowercase: true,
+	RequireNumbers:   true,
+	HistoryCount:     5,
+	CheckBreached:    true,
+}
+
+// Password policy rules reported in PasswordViolation.Rule
+const (
+	PasswordRuleMinLength   = "min_length"
+	PasswordRuleMaxLength   = "max_length"
+	PasswordRuleUppercase   = "uppercase"
+	PasswordRuleLowercase   = "lowercase"
+	PasswordRuleNumber      = "number"
+	PasswordRuleSpecialChar = "special_char"
+	PasswordRuleHistory     = "history"
+	PasswordRuleBreached    = "breached"
+)
+
+// PasswordViolation is one password policy rule a password fails
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a password fails
+type PasswordPolicyError struct {
+	Violations []PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Message
+	}
+	return "password does not meet the password policy: " + strings.Join(messages, "; ")
+}
+
+// ChangeExpiredPasswordRequest rotates a password that expired under the
+// tenant's maxAgeDays and signs the user in
+type ChangeExpiredPasswordRequest struct {
+	Email           string `json:"email" validate:"required,email"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+	TenantID        string `json:"tenant_id,omitempty"` // defaults to the home tenant
+	IPAddress       string `json:"-"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Data subject request types
+const (
+	DataSubjectRequestExport = "export"
+	DataSubjectRequestErase  = "erase"
+)
+
+// Data subject request statuses
+const (
+	DataSubjectStatusPending   = "pending"
+	DataSubjectStatusRunning   = "running"
+	DataSubjectStatusCompleted = "completed"
+	DataSubjectStatusFailed    = "failed"
+)
+
+// DataSubject identifies whose personal data a request covers: a user of the
+// tenant. Services that do not store user IDs are matched by email.
+type DataSubject struct {
+	TenantID uuid.UUID
+	UserID   uuid.UUID
+	Email    string
+}
+
+// DataSubjectRequest is an export or erasure of one user's personal data in
+// one tenant. Result holds, per data source, the number of records exported
+// or erased, or the reason the source was skipped.
+type DataSubjectRequest struct {
+	ID               uuid.UUID              `json:"id" db:"id"`
+	TenantID         uuid.UUID              `json:"tenant_id" db:"tenant_id"`
+	SubjectUserID    uuid.UUID              `json:"subject_user_id" db:"subject_user_id"`
+	SubjectEmail     *string                `json:"subject_email,omitempty" db:"subject_email"`
+	Type             string                 `json:"type" db:"type"`
+	Status           string                 `json:"status" db:"status"`
+	Reason           string                 `json:"reason" db:"reason"`
+	RequestedBy      *uuid.UUID             `json:"requested_by,omitempty" db:"requested_by"`
+	Attempts         int                    `json:"attempts" db:"attempts"`
+	Result           map[string]interface{} `json:"result" db:"result"`
+	LastError        *string                `json:"last_error,omitempty" db:"last_error"`
+	HasArchive       bool                   `json:"has_archive" db:"-"`
+	ArchiveExpiresAt *time.Time             `json:"archive_expires_at,omitempty" db:"archive_expires_at"`
+	StartedAt        *time.Time             `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt      *time.Time             `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt        time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time              `json:"updated_at" db:"updated_at"`
+}
+
+// CreateDataSubjectRequest asks for an export or erasure of a user's data
+type CreateDataSubjectRequest struct {
+	UserID uuid.UUID `json:"user_id" validate:"required"`
+	Type   string    `json:"type" validate:"required,oneof=export erase"`
+	Reason string    `json:"reason"`
+}
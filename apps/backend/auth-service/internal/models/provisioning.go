@@ -0,0 +1,51 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// ProvisionTenantRequest asks tenant-service to provision a tenant. Without
+// an admin the caller makes an existing user the tenant's admin.
+type ProvisionTenantRequest struct {
+	Name  string                    `json:"name"`
+	Admin *CreateTenantAdminRequest `json:"admin,omitempty"`
+}
+
+// TenantProvisioning is the outcome of a tenant provisioning in tenant-service
+type TenantProvisioning struct {
+	ID          uuid.UUID  `json:"id"`
+	TenantID    *uuid.UUID `json:"tenant_id,omitempty"`
+	Status      string     `json:"status"`
+	AdminUserID *uuid.UUID `json:"admin_user_id,omitempty"`
+	Error       *string    `json:"error,omitempty"`
+}
+
+// CreateTenantAdminRequest creates the first admin of a tenant being
+// provisioned. Only tenant-service calls it.
+type CreateTenantAdminRequest struct {
+	Email     string `json:"email" validate:"required,email"`
+	FirstName string `json:"first_name" validate:"required"`
+	LastName  string `json:"last_name" validate:"required"`
+	Password  string `json:"password" validate:"required"`
+}
+
+// Quota resources checked by auth-service
+const (
+	QuotaResourceUsers = "users"
+)
+
+// QuotaCheckRequest asks tenant-service whether a tenant may add amount of
+// a resource
+type QuotaCheckRequest struct {
+	Resource string `json:"resource"`
+	Amount   int64  `json:"amount"`
+}
+
+// QuotaCheck is tenant-service's answer to a QuotaCheckRequest. A nil limit
+// is unlimited.
+type QuotaCheck struct {
+	Resource string `json:"resource"`
+	Used     int64  `json:"used"`
+	Limit    *int64 `json:"limit"`
+	Allowed  bool   `json:"allowed"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Permissions owned by auth-service. Module permissions (e.g. "crm.lead.write")
+// are registered by tenant-service in the module_permissions table.
+const (
+	PermissionUsersRead            = "users.read"
+	PermissionUsersWrite           = "users.write"
+	PermissionRolesRead            = "roles.read"
+	PermissionRolesWrite           = "roles.write"
+	PermissionSSOManage            = "sso.manage"
+	PermissionSCIMManage           = "scim.manage"
+	PermissionAPIKeysManage        = "api_keys.manage"
+	PermissionPrivacyManage        = "privacy.manage"
+	PermissionRetentionManage      = "retention.manage"
+	PermissionTenantModulesManage  = "tenant.modules.manage"
+	PermissionTenantSettingsManage = "tenant.settings.manage"
+)
+
+// CorePermissions describes the permissions owned by auth-service
+var CorePermissions = []Permission{
+	{Name: PermissionUsersRead, Module: "core", Category: "users", Description: "View users of the tenant"},
+	{Name: PermissionUsersWrite, Module: "core", Category: "users", Description: "Invite, edit and deactivate users"},
+	{Name: PermissionRolesRead, Module: "core", Category: "roles", Description: "View roles and role assignments"},
+	{Name: PermissionRolesWrite, Module: "core", Category: "roles", Description: "Create, edit and assign roles"},
+	{Name: PermissionSSOManage, Module: "core", Category: "security", Description: "Configure single sign-on connections"},
+	{Name: PermissionSCIMManage, Module: "core", Category: "security", Description: "Manage SCIM provisioning tokens"},
+	{Name: PermissionAPIKeysManage, Module: "core", Category: "security", Description: "Manage service accounts and every API key of the tenant"},
+	{Name: PermissionPrivacyManage, Module: "core", Category: "security", Description: "Export and erase users' personal data (GDPR requests)"},
+	{Name: PermissionRetentionManage, Module: "core", Category: "security", Description: "Set data retention per data class and place legal holds"},
+	{Name: PermissionTenantModulesManage, Module: "core", Category: "tenant", Description: "Enable and disable modules"},
+	{Name: PermissionTenantSettingsManage, Module: "core", Category: "tenant", Description: "Change tenant settings"},
+}
+
+// Role is a named set of permissions. System roles (TenantID nil) back the
+// users.role column; custom roles belong to a tenant and are granted on top.
+type Role struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	TenantID    *uuid.UUID `json:"tenant_id,omitempty" db:"tenant_id"`
+	Name        string     `json:"name" db:"name"`
+	DisplayName string     `json:"display_name" db:"display_name"`
+	Description string     `json:"description" db:"description"`
+	Permissions []string   `json:"permissions" db:"permissions"`
+	IsSystem    bool       `json:"is_system" db:"is_system"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Permission describes a permission that can be granted to a role
+type Permission struct {
+	Name        string `json:"name"`
+	Module      string `json:"module"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+}
+
+// CreateRoleRequest represents a request to create a custom role
+type CreateRoleRequest struct {
+	Name        string   `json:"name" validate:"required,min=2,max=50"`
+	DisplayName string   `json:"display_name" validate:"required,max=100"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" validate:"required,min=1"`
+}
+
+// UpdateRoleRequest represents a request to update a custom role
+type UpdateRoleRequest struct {
+	DisplayName *string  `json:"display_name,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// AssignRolesRequest replaces the custom roles granted to a user
+type AssignRolesRequest struct {
+	RoleIDs []string `json:"role_ids"`
+}
+
+// UserPermissions is a user's base role, custom roles and effective permissions
+type UserPermissions struct {
+	UserID      uuid.UUID `json:"user_id"`
+	Role        string    `json:"role"`
+	Roles       []*Role   `json:"roles"`
+	Permissions []string  `json:"permissions"`
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Data classes subject to retention
+const (
+	RetentionClassCheckinPhotos      = "checkin_photos"
+	RetentionClassCheckinRecords     = "checkin_records"
+	RetentionClassContactActivities  = "contact_activities"
+	RetentionClassDeletedFiles       = "deleted_files"
+	RetentionClassExpiredInvitations = "expired_invitations"
+	RetentionClassPasswordResets     = "password_resets"
+	RetentionClassRefreshTokens      = "refresh_tokens"
+)
+
+// RetentionClasses lists every data class in the order retention runs them.
+// Photos go before records so a shorter photo policy is applied first.
+var RetentionClasses = []string{
+	RetentionClassCheckinPhotos,
+	RetentionClassCheckinRecords,
+	RetentionClassContactActivities,
+	RetentionClassDeletedFiles,
+	RetentionClassExpiredInvitations,
+	RetentionClassPasswordResets,
+	RetentionClassRefreshTokens,
+}
+
+// Entity types a legal hold can cover
+const (
+	LegalHoldEntityEmployee = "employee"
+	LegalHoldEntityCustomer = "customer"
+	LegalHoldEntityLead     = "lead"
+	LegalHoldEntityFile     = "file"
+	LegalHoldEntityUser     = "user"
+)
+
+// LegalHoldEntityClasses maps each entity type to the data classes it can hold
+var LegalHoldEntityClasses = map[string][]string{
+	LegalHoldEntityEmployee: {RetentionClassCheckinPhotos, RetentionClassCheckinRecords},
+	LegalHoldEntityCustomer: {RetentionClassContactActivities},
+	LegalHoldEntityLead:     {RetentionClassContactActivities},
+	LegalHoldEntityFile:     {RetentionClassDeletedFiles},
+	LegalHoldEntityUser:     {RetentionClassDeletedFiles, RetentionClassPasswordResets, RetentionClassRefreshTokens},
+}
+
+// TenantRetention is a tenant's retention policy: DefaultDays comes from the
+// tenant configuration and Overrides set it per data class. A default of
+// zero or less keeps data without an override forever.
+type TenantRetention struct {
+	TenantID    uuid.UUID
+	DefaultDays int
+	Overrides   map[string]int
+}
+
+// Days returns the retention of a data class, or 0 if it is kept forever
+func (r *TenantRetention) Days(dataClass string) int {
+	if days, ok := r.Overrides[dataClass]; ok {
+		return days
+	}
+	if r.DefaultDays < 0 {
+		return 0
+	}
+	return r.DefaultDays
+}
+
+// RetentionPolicy is the retention applied to one data class of a tenant
+type RetentionPolicy struct {
+	DataClass     string `json:"data_class"`
+	RetentionDays int    `json:"retention_days"`
+	Overridden    bool   `json:"overridden"`
+}
+
+// UpdateRetentionPolicyRequest overrides the retention of a data class. A nil
+// RetentionDays removes the override.
+type UpdateRetentionPolicyRequest struct {
+	DataClass     string `json:"data_class" validate:"required"`
+	RetentionDays *int   `json:"retention_days"`
+}
+
+// LegalHold exempts data from retention. A hold without an entity covers the
+// whole tenant; a hold without a data class covers every class.
+type LegalHold struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	TenantID   uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	DataClass  *string    `json:"data_class,omitempty" db:"data_class"`
+	EntityType *string    `json:"entity_type,omitempty" db:"entity_type"`
+	EntityID   *string    `json:"entity_id,omitempty" db:"entity_id"`
+	Reason     string     `json:"reason" db:"reason"`
+	CreatedBy  *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ReleasedBy *uuid.UUID `json:"released_by,omitempty" db:"released_by"`
+	ReleasedAt *time.Time `json:"released_at,omitempty" db:"released_at"`
+}
+
+// CreateLegalHoldRequest places a legal hold
+type CreateLegalHoldRequest struct {
+	DataClass  *string `json:"data_class"`
+	EntityType *string `json:"entity_type"`
+	EntityID   *string `json:"entity_id"`
+	Reason     string  `json:"reason" validate:"required"`
+}
+
+// RetentionClassReport is what retention did, or would do, to one data class
+type RetentionClassReport struct {
+	RetentionDays int        `json:"retention_days"`
+	Cutoff        *time.Time `json:"cutoff,omitempty"`
+	Removed       int64      `json:"removed"`
+	Skipped       string     `json:"skipped,omitempty"`
+}
+
+// RetentionRun is one tenant's retention pass. A dry run counts the rows that
+// would be removed without removing them.
+type RetentionRun struct {
+	ID           uuid.UUID                        `json:"id" db:"id"`
+	TenantID     uuid.UUID                        `json:"tenant_id" db:"tenant_id"`
+	DryRun       bool                             `json:"dry_run" db:"dry_run"`
+	Report       map[string]*RetentionClassReport `json:"report" db:"report"`
+	TotalRemoved int64                            `json:"total_removed" db:"total_removed"`
+	TriggeredBy  *uuid.UUID                       `json:"triggered_by,omitempty" db:"triggered_by"`
+	StartedAt    time.Time                        `json:"started_at" db:"started_at"`
+	CompletedAt  time.Time                        `json:"completed_at" db:"completed_at"`
+}
+
+// RetentionMetrics totals the rows retention removed per data class since
+// the start of the period
+type RetentionMetrics struct {
+	Since   time.Time        `json:"since"`
+	Runs    int              `json:"runs"`
+	Removed map[string]int64 `json:"removed"`
+	Total   int64            `json:"total"`
+}
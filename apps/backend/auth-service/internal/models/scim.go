@@ -0,0 +1,159 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SCIM schema URNs
+const (
+	SCIMSchemaUser            = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMSchemaGroup           = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMSchemaEnterpriseUser  = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SCIMSchemaListResponse    = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMSchemaPatchOp         = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMSchemaError           = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SCIMSchemaServiceProvider = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// SCIMProvider is the provider name used for directory external IDs in user_identities
+const SCIMProvider = "scim"
+
+// SCIMConfig is the SCIM section of a tenant's integration config
+type SCIMConfig struct {
+	DefaultRole         string            `json:"default_role,omitempty"`
+	GroupRoleMapping    map[string]string `json:"group_role_mapping,omitempty"` // group displayName -> role
+	CreateEmployees     bool              `json:"create_employees"`
+	DefaultDepartmentID int               `json:"default_department_id,omitempty"`
+}
+
+// SCIMToken is a per-tenant bearer token used by an identity provider's SCIM client
+type SCIMToken struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	TenantID   uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	Name       string     `json:"name" db:"name"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	CreatedBy  *uuid.UUID `json:"created_by" db:"created_by"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// CreateSCIMTokenRequest creates a SCIM bearer token
+type CreateSCIMTokenRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// CreateSCIMTokenResponse returns the plaintext token, which is only shown once
+type CreateSCIMTokenResponse struct {
+	SCIMToken
+	Token string `json:"token"`
+}
+
+// SCIMUserRecord is a user together with the external ID assigned by the directory
+type SCIMUserRecord struct {
+	User
+	ExternalID *string `json:"external_id" db:"external_id"`
+}
+
+// SCIMGroup is a directory group. Groups listed in the tenant's group role mapping
+// grant that role to their members.
+type SCIMGroup struct {
+	ID          uuid.UUID   `json:"id" db:"id"`
+	TenantID    uuid.UUID   `json:"tenant_id" db:"tenant_id"`
+	DisplayName string      `json:"display_name" db:"display_name"`
+	ExternalID  *string     `json:"external_id" db:"external_id"`
+	Role        *string     `json:"role" db:"role"`
+	MemberIDs   []uuid.UUID `json:"member_ids" db:"-"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at" db:"updated_at"`
+}
+
+// SCIMUser is the SCIM 2.0 wire representation of a User
+type SCIMUser struct {
+	Schemas     []string            `json:"schemas"`
+	ID          string              `json:"id,omitempty"`
+	ExternalID  string              `json:"externalId,omitempty"`
+	UserName    string              `json:"userName"`
+	Name        *SCIMName           `json:"name,omitempty"`
+	DisplayName string              `json:"displayName,omitempty"`
+	Title       string              `json:"title,omitempty"`
+	Emails      []SCIMMultiValue    `json:"emails,omitempty"`
+	Active      *bool               `json:"active,omitempty"`
+	Password    string              `json:"password,omitempty"`
+	Roles       []SCIMMultiValue    `json:"roles,omitempty"`
+	Groups      []SCIMMultiValue    `json:"groups,omitempty"`
+	Enterprise  *SCIMEnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta        *SCIMMeta           `json:"meta,omitempty"`
+}
+
+// SCIMName is the SCIM name complex attribute
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMEnterpriseUser is the subset of the enterprise user extension we consume
+type SCIMEnterpriseUser struct {
+	EmployeeNumber string `json:"employeeNumber,omitempty"`
+	Department     string `json:"department,omitempty"`
+}
+
+// SCIMMultiValue is a SCIM multi-valued attribute entry (emails, roles, groups, members)
+type SCIMMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// SCIMGroupResource is the SCIM 2.0 wire representation of a Group
+type SCIMGroupResource struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	ExternalID  string           `json:"externalId,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []SCIMMultiValue `json:"members,omitempty"`
+	Meta        *SCIMMeta        `json:"meta,omitempty"`
+}
+
+// SCIMMeta is the SCIM resource metadata
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+// SCIMListResponse is a page of SCIM resources
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// SCIMPatchRequest is a SCIM PATCH request body
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+// SCIMPatchOperation is a single add, replace or remove operation
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMErrorResponse is the SCIM error body
+type SCIMErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+// SecurityConfig is the decoded form of tenant_configurations.security_config
+type SecurityConfig struct {
+	Lockout *LockoutPolicy `json:"lockout,omitempty"`
+}
+
+// LockoutPolicy sets the brute-force thresholds for password logins. Keys
+// missing from a tenant's policy keep the DefaultLockoutPolicy values.
+type LockoutPolicy struct {
+	MaxFailedAttempts      int `json:"max_failed_attempts"`        // failures per account before it is locked
+	MaxFailedAttemptsPerIP int `json:"max_failed_attempts_per_ip"` // failures per client IP before it is blocked
+	FailureWindowMinutes   int `json:"failure_window_minutes"`     // failures older than this are forgotten
+	LockoutMinutes         int `json:"lockout_minutes"`
+	DelayAfterAttempts     int `json:"delay_after_attempts"` // failures before progressive delays start, 0 disables them
+	MaxDelaySeconds        int `json:"max_delay_seconds"`
+}
+
+// DefaultLockoutPolicy applies to tenants without a configured policy and to
+// logins for unknown email addresses
+var DefaultLockoutPolicy = LockoutPolicy{
+	MaxFailedAttempts:      5,
+	MaxFailedAttemptsPerIP: 20,
+	FailureWindowMinutes:   15,
+	LockoutMinutes:         15,
+	DelayAfterAttempts:     2,
+	MaxDelaySeconds:        30,
+}
+
+func (p LockoutPolicy) FailureWindow() time.Duration {
+	return time.Duration(p.FailureWindowMinutes) * time.Minute
+}
+
+func (p LockoutPolicy) LockoutDuration() time.Duration {
+	return time.Duration(p.LockoutMinutes) * time.Minute
+}
+
+// Reasons reported in LoginBlockedError.Reason
+const (
+	LoginBlockedAccountLocked = "account_locked"
+	LoginBlockedIPBlocked     = "ip_blocked"
+	LoginBlockedThrottled     = "throttled"
+)
+
+// LoginBlockedError is returned when a login attempt is refused before the
+// password is checked
+type LoginBlockedError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	switch e.Reason {
+	case LoginBlockedAccountLocked:
+		return "account is temporarily locked after too many failed login attempts"
+	case LoginBlockedIPBlocked:
+		return "too many failed login attempts from this address"
+	default:
+		return "too many failed login attempts, slow down"
+	}
+}
+
+// UnlockAccountRequest unlocks an account with the token from the lockout email
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required"`
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TenantConfiguration holds the tenant-level settings enforced by auth-service.
+// The row itself is owned by tenant-service (tenant_configurations table).
+type TenantConfiguration struct {
+	TenantID          uuid.UUID `json:"tenant_id" db:"tenant_id"`
+	IntegrationConfig string    `json:"integration_config" db:"integration_config"` // JSON
+	PasswordPolicy    string    `json:"password_policy" db:"password_policy"`       // JSON
+	SecurityConfig    string    `json:"security_config" db:"security_config"`       // JSON
+	AllowedIPs        string    `json:"allowed_ips" db:"allowed_ips"`               // JSON
+	BrandingConfig    string    `json:"branding_config" db:"branding_config"`       // JSON
+	CustomDomain      string    `json:"custom_domain" db:"custom_domain"`
+}
+
+// IntegrationConfig is the decoded form of TenantConfiguration.IntegrationConfig
+type IntegrationConfig struct {
+	OIDC map[string]OIDCProviderConfig `json:"oidc,omitempty"`
+	SCIM *SCIMConfig                   `json:"scim,omitempty"`
+}
+
+// OIDCProviderConfig configures one OpenID Connect identity provider for a tenant
+type OIDCProviderConfig struct {
+	Type                 string   `json:"type"`   // google, microsoft, generic
+	Issuer               string   `json:"issuer"` // required for generic providers
+	ClientID             string   `json:"client_id"`
+	ClientSecret         string   `json:"client_secret"`
+	DirectoryTenant      string   `json:"directory_tenant,omitempty"` // microsoft only, defaults to "organizations"
+	Scopes               []string `json:"scopes,omitempty"`
+	DefaultRole          string   `json:"default_role,omitempty"`
+	JITProvisioning      bool     `json:"jit_provisioning"`
+	AllowedDomains       []string `json:"allowed_domains,omitempty"`
+	AllowedRedirectURIs  []string `json:"allowed_redirect_uris,omitempty"`
+	TrustUnverifiedEmail bool     `json:"trust_unverified_email"`
+	Disabled             bool     `json:"disabled"`
+}
+
+// OIDCAuthState represents a pending OIDC authorization request
+type OIDCAuthState struct {
+	ID           uuid.UUID `json:"id" db:"id"`
+	State        string    `json:"state" db:"state"`
+	Nonce        string    `json:"-" db:"nonce"`
+	CodeVerifier string    `json:"-" db:"code_verifier"`
+	TenantID     uuid.UUID `json:"tenant_id" db:"tenant_id"`
+	Provider     string    `json:"provider" db:"provider"`
+	RedirectURI  *string   `json:"redirect_uri" db:"redirect_uri"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external identity provider
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	TenantID    uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"subject" db:"subject"`
+	Email       string     `json:"email" db:"email"`
+	LastLoginAt *time.Time `json:"last_login_at" db:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// OIDC provider types
+const (
+	OIDCProviderGoogle    = "google"
+	OIDCProviderMicrosoft = "microsoft"
+	OIDCProviderGeneric   = "generic"
+)
+
+// SAMLConnection is a tenant's SAML 2.0 identity provider. Each tenant acts as its
+// own service provider with a dedicated key pair.
+type SAMLConnection struct {
+	ID                  uuid.UUID            `json:"id" db:"id"`
+	TenantID            uuid.UUID            `json:"tenant_id" db:"tenant_id"`
+	IdPEntityID         string               `json:"idp_entity_id" db:"idp_entity_id"`
+	IdPMetadata         string               `json:"idp_metadata" db:"idp_metadata"`
+	SPPrivateKey        string               `json:"-" db:"sp_private_key"`
+	SPCertificate       string               `json:"sp_certificate" db:"sp_certificate"`
+	AttributeMapping    SAMLAttributeMapping `json:"attribute_mapping" db:"attribute_mapping"`
+	RoleMapping         map[string]string    `json:"role_mapping" db:"role_mapping"`
+	DefaultRole         string               `json:"default_role" db:"default_role"`
+	JITProvisioning     bool                 `json:"jit_provisioning" db:"jit_provisioning"`
+	SSOOnly             bool                 `json:"sso_only" db:"sso_only"`
+	AllowIDPInitiated   bool                 `json:"allow_idp_initiated" db:"allow_idp_initiated"`
+	AllowedRedirectURIs []string             `json:"allowed_redirect_uris" db:"allowed_redirect_uris"`
+	Enabled             bool                 `json:"enabled" db:"enabled"`
+	CreatedAt           time.Time            `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time            `json:"updated_at" db:"updated_at"`
+}
+
+// SAMLAttributeMapping names the assertion attributes that map to user fields.
+// Empty fields fall back to common attribute names.
+type SAMLAttributeMapping struct {
+	Email     string `json:"email,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+// SAMLConnectionRequest configures a tenant's SAML connection
+type SAMLConnectionRequest struct {
+	IdPMetadata         string               `json:"idp_metadata" validate:"required"`
+	AttributeMapping    SAMLAttributeMapping `json:"attribute_mapping"`
+	RoleMapping         map[string]string    `json:"role_mapping"`
+	DefaultRole         string               `json:"default_role"`
+	JITProvisioning     bool                 `json:"jit_provisioning"`
+	SSOOnly             bool                 `json:"sso_only"`
+	AllowIDPInitiated   bool                 `json:"allow_idp_initiated"`
+	AllowedRedirectURIs []string             `json:"allowed_redirect_uris"`
+	Enabled             *bool                `json:"enabled"`
+}
+
+// SAMLAuthRequest represents a pending SP-initiated SAML authentication request
+type SAMLAuthRequest struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	RequestID   string    `json:"request_id" db:"request_id"`
+	RelayState  string    `json:"relay_state" db:"relay_state"`
+	TenantID    uuid.UUID `json:"tenant_id" db:"tenant_id"`
+	RedirectURI *string   `json:"redirect_uri" db:"redirect_uri"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// SAMLProvider is the provider name used for SAML identities
+const SAMLProvider = "saml"
@@ -20,6 +20,8 @@ type User struct {
 	LastLoginAt *time.Time `json:"last_login_at" db:"last_login_at"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+
+	PasswordChangedAt time.Time `json:"-" db:"password_changed_at"`
 }
 
 // Tenant represents a tenant/organization in the system
@@ -47,8 +49,11 @@ type RefreshToken struct {
 
 // LoginRequest represents login request payload
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,min=6"`
+	TenantID   string `json:"tenant_id,omitempty"` // tenant to sign in to, defaults to the home tenant
+	IPAddress  string `json:"-"`                   // set by the handler, used for per-IP throttling and IP allowlists
+	AdminLogin bool   `json:"-"`                   // set by the admin handler, selects the tenant's admin IP allowlist
 }
 
 // RegisterRequest represents registration request payload
@@ -58,15 +63,18 @@ type RegisterRequest struct {
 	FirstName string `json:"first_name" validate:"required,min=2"`
 	LastName  string `json:"last_name" validate:"required,min=2"`
 	TenantID  string `json:"tenant_id,omitempty"`
+	IPAddress string `json:"-"`
 }
 
 // TokenResponse represents token response
 type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	TokenType    string `json:"token_type"`
-	ExpiresIn    int64  `json:"expires_in"`
-	User         *User  `json:"user"`
+	AccessToken  string              `json:"access_token"`
+	RefreshToken string              `json:"refresh_token"`
+	TokenType    string              `json:"token_type"`
+	ExpiresIn    int64               `json:"expires_in"`
+	User         *User               `json:"user"`
+	Permissions  []string            `json:"permissions"`
+	Tenants      []*TenantMembership `json:"tenants,omitempty"` // every tenant the user can switch to
 }
 
 // UserInvitation represents a user invitation
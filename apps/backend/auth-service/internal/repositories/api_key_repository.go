@@ -0,0 +1,301 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// APIKeyRepository stores service accounts and the API keys of users and
+// service accounts. Deleting a service account deletes its keys.
+type APIKeyRepository interface {
+	CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error
+	GetServiceAccount(ctx context.Context, tenantID, id uuid.UUID) (*models.ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context, tenantID uuid.UUID) ([]*models.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, tenantID, id uuid.UUID) error
+
+	CreateKey(ctx context.Context, key *models.APIKey) error
+	GetKey(ctx context.Context, tenantID, id uuid.UUID) (*models.APIKey, error)
+	GetKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	// ListKeys lists the tenant's keys, or only userID's personal keys when userID is set
+	ListKeys(ctx context.Context, tenantID uuid.UUID, userID *uuid.UUID) ([]*models.APIKey, error)
+	SetKeyExpiry(ctx context.Context, tenantID, id uuid.UUID, expiresAt time.Time) error
+	RevokeKey(ctx context.Context, tenantID, id uuid.UUID, revokedAt time.Time) error
+	TouchKey(ctx context.Context, id uuid.UUID, ip string, usedAt time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+const serviceAccountColumns = `id, tenant_id, name, description, permissions, is_active, created_by, created_at, updated_at`
+
+const apiKeyColumns = `id, tenant_id, user_id, service_account_id, name, prefix, key_hash, scopes, expires_at,
+	last_used_at, last_used_ip, revoked_at, created_by, created_at`
+
+func (r *apiKeyRepository) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	query := `
+		INSERT INTO service_accounts (id, tenant_id, name, description, permissions, is_active, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+	`
+
+	permissions, err := json.Marshal(account.Permissions)
+	if err != nil {
+		return err
+	}
+
+	account.ID = uuid.New()
+	account.IsActive = true
+	account.CreatedAt = time.Now()
+	account.UpdatedAt = account.CreatedAt
+
+	_, err = r.db.ExecContext(ctx, query,
+		account.ID,
+		account.TenantID,
+		account.Name,
+		account.Description,
+		permissions,
+		account.IsActive,
+		account.CreatedBy,
+		account.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *apiKeyRepository) GetServiceAccount(ctx context.Context, tenantID, id uuid.UUID) (*models.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts WHERE id = $1 AND tenant_id = $2`
+
+	account, err := scanServiceAccount(r.db.QueryRowContext(ctx, query, id, tenantID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("service account not found")
+		}
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (r *apiKeyRepository) ListServiceAccounts(ctx context.Context, tenantID uuid.UUID) ([]*models.ServiceAccount, error) {
+	query := `SELECT ` + serviceAccountColumns + ` FROM service_accounts WHERE tenant_id = $1 ORDER BY name`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*models.ServiceAccount
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+func (r *apiKeyRepository) DeleteServiceAccount(ctx context.Context, tenantID, id uuid.UUID) error {
+	query := `DELETE FROM service_accounts WHERE id = $1 AND tenant_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("service account not found")
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) CreateKey(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (id, tenant_id, user_id, service_account_id, name, prefix, key_hash, scopes, expires_at, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+
+	key.ID = uuid.New()
+	key.CreatedAt = time.Now()
+
+	_, err = r.db.ExecContext(ctx, query,
+		key.ID,
+		key.TenantID,
+		key.UserID,
+		key.ServiceAccountID,
+		key.Name,
+		key.Prefix,
+		key.KeyHash,
+		scopes,
+		key.ExpiresAt,
+		key.CreatedBy,
+		key.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *apiKeyRepository) GetKey(ctx context.Context, tenantID, id uuid.UUID) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1 AND tenant_id = $2`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, id, tenantID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (r *apiKeyRepository) GetKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (r *apiKeyRepository) ListKeys(ctx context.Context, tenantID uuid.UUID, userID *uuid.UUID) ([]*models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE tenant_id = $1 AND ($2::uuid IS NULL OR user_id = $2)
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepository) SetKeyExpiry(ctx context.Context, tenantID, id uuid.UUID, expiresAt time.Time) error {
+	query := `UPDATE api_keys SET expires_at = $1 WHERE id = $2 AND tenant_id = $3`
+	_, err := r.db.ExecContext(ctx, query, expiresAt, id, tenantID)
+	return err
+}
+
+func (r *apiKeyRepository) RevokeKey(ctx context.Context, tenantID, id uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND tenant_id = $3 AND revoked_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, revokedAt, id, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found")
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) TouchKey(ctx context.Context, id uuid.UUID, ip string, usedAt time.Time) error {
+	query := `UPDATE api_keys SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, usedAt, ip, id)
+	return err
+}
+
+func scanServiceAccount(row rowScanner) (*models.ServiceAccount, error) {
+	account := &models.ServiceAccount{}
+	var permissions []byte
+	err := row.Scan(
+		&account.ID,
+		&account.TenantID,
+		&account.Name,
+		&account.Description,
+		&permissions,
+		&account.IsActive,
+		&account.CreatedBy,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(permissions, &account.Permissions); err != nil {
+		return nil, fmt.Errorf("invalid service account permissions: %w", err)
+	}
+
+	return account, nil
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	var scopes []byte
+	err := row.Scan(
+		&key.ID,
+		&key.TenantID,
+		&key.UserID,
+		&key.ServiceAccountID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.RevokedAt,
+		&key.CreatedBy,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return nil, fmt.Errorf("invalid API key scopes: %w", err)
+	}
+
+	return key, nil
+}
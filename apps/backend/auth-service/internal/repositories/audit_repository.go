@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, entry *models.AuditLog) error
+}
+
+type auditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	detailsJSON, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_logs (tenant_id, actor_id, target_user_id, action, ip_address, details)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id, created_at
+	`
+
+	return r.db.QueryRowContext(ctx, query,
+		entry.TenantID,
+		entry.ActorID,
+		entry.TargetUserID,
+		entry.Action,
+		entry.IPAddress,
+		detailsJSON,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
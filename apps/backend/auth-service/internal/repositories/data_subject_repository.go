@@ -0,0 +1,213 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// DataSubjectRepository stores data subject requests and their export
+// archives. ClaimNext hands a pending request to one worker for the length
+// of the lease and counts the attempt; a request whose lease expires is
+// claimed again.
+type DataSubjectRepository interface {
+	Create(ctx context.Context, req *models.DataSubjectRequest) error
+	Get(ctx context.Context, tenantID, id uuid.UUID) (*models.DataSubjectRequest, error)
+	List(ctx context.Context, tenantID uuid.UUID) ([]*models.DataSubjectRequest, error)
+	// HasOpen reports whether the user already has a pending or running
+	// request of the given type in the tenant
+	HasOpen(ctx context.Context, tenantID, userID uuid.UUID, requestType string) (bool, error)
+	ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*models.DataSubjectRequest, error)
+	// Complete stores the result, and the archive of an export. clearEmail
+	// drops the subject's email from the request after an erasure.
+	Complete(ctx context.Context, id uuid.UUID, result map[string]interface{}, archive []byte, archiveExpiresAt *time.Time, clearEmail bool, at time.Time) error
+	MarkRetry(ctx context.Context, id uuid.UUID, lastError string) error
+	MarkFailed(ctx context.Context, id uuid.UUID, lastError string, at time.Time) error
+	// GetArchive returns the export archive if it has not expired
+	GetArchive(ctx context.Context, tenantID, id uuid.UUID, now time.Time) ([]byte, error)
+}
+
+type dataSubjectRepository struct {
+	db *sql.DB
+}
+
+func NewDataSubjectRepository(db *sql.DB) DataSubjectRepository {
+	return &dataSubjectRepository{db: db}
+}
+
+const dataSubjectColumns = `id, tenant_id, subject_user_id, subject_email, type, status, reason, requested_by, attempts,
+	result, last_error, archive IS NOT NULL, archive_expires_at, started_at, completed_at, created_at, updated_at`
+
+func (r *dataSubjectRepository) Create(ctx context.Context, req *models.DataSubjectRequest) error {
+	query := `
+		INSERT INTO data_subject_requests (id, tenant_id, subject_user_id, subject_email, type, status, reason, requested_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+	`
+
+	now := time.Now()
+	req.ID = uuid.New()
+	req.Status = models.DataSubjectStatusPending
+	req.Result = map[string]interface{}{}
+	req.CreatedAt = now
+	req.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		req.ID,
+		req.TenantID,
+		req.SubjectUserID,
+		req.SubjectEmail,
+		req.Type,
+		req.Status,
+		req.Reason,
+		req.RequestedBy,
+		now,
+	)
+	return err
+}
+
+func (r *dataSubjectRepository) Get(ctx context.Context, tenantID, id uuid.UUID) (*models.DataSubjectRequest, error) {
+	query := `SELECT ` + dataSubjectColumns + ` FROM data_subject_requests WHERE id = $1 AND tenant_id = $2`
+
+	req, err := scanDataSubjectRequest(r.db.QueryRowContext(ctx, query, id, tenantID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("request not found")
+	}
+	return req, err
+}
+
+func (r *dataSubjectRepository) List(ctx context.Context, tenantID uuid.UUID) ([]*models.DataSubjectRequest, error) {
+	query := `SELECT ` + dataSubjectColumns + ` FROM data_subject_requests WHERE tenant_id = $1 ORDER BY created_at DESC LIMIT 200`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*models.DataSubjectRequest
+	for rows.Next() {
+		req, err := scanDataSubjectRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, rows.Err()
+}
+
+func (r *dataSubjectRepository) HasOpen(ctx context.Context, tenantID, userID uuid.UUID, requestType string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM data_subject_requests
+			WHERE tenant_id = $1 AND subject_user_id = $2 AND type = $3 AND status IN ('pending', 'running')
+		)
+	`, tenantID, userID, requestType).Scan(&exists)
+	return exists, err
+}
+
+func (r *dataSubjectRepository) ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*models.DataSubjectRequest, error) {
+	query := `
+		UPDATE data_subject_requests
+		SET status = 'running', attempts = attempts + 1, lease_until = $2, started_at = COALESCE(started_at, $1)
+		WHERE id = (
+			SELECT id FROM data_subject_requests
+			WHERE status = 'pending' OR (status = 'running' AND lease_until <= $1)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + dataSubjectColumns
+
+	req, err := scanDataSubjectRequest(r.db.QueryRowContext(ctx, query, now, now.Add(lease)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return req, err
+}
+
+func (r *dataSubjectRepository) Complete(ctx context.Context, id uuid.UUID, result map[string]interface{}, archive []byte, archiveExpiresAt *time.Time, clearEmail bool, at time.Time) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE data_subject_requests
+		SET status = 'completed', result = $2, archive = $3, archive_expires_at = $4,
+		    subject_email = CASE WHEN $5 THEN NULL ELSE subject_email END,
+		    last_error = NULL, lease_until = NULL, completed_at = $6
+		WHERE id = $1
+	`, id, resultJSON, archive, archiveExpiresAt, clearEmail, at)
+	return err
+}
+
+func (r *dataSubjectRepository) MarkRetry(ctx context.Context, id uuid.UUID, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE data_subject_requests
+		SET status = 'pending', last_error = $2, lease_until = NULL
+		WHERE id = $1
+	`, id, lastError)
+	return err
+}
+
+func (r *dataSubjectRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE data_subject_requests
+		SET status = 'failed', last_error = $2, lease_until = NULL, completed_at = $3
+		WHERE id = $1
+	`, id, lastError, at)
+	return err
+}
+
+func (r *dataSubjectRepository) GetArchive(ctx context.Context, tenantID, id uuid.UUID, now time.Time) ([]byte, error) {
+	var archive []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT archive FROM data_subject_requests
+		WHERE id = $1 AND tenant_id = $2 AND archive IS NOT NULL AND archive_expires_at > $3
+	`, id, tenantID, now).Scan(&archive)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("archive not found")
+	}
+	return archive, err
+}
+
+func scanDataSubjectRequest(row rowScanner) (*models.DataSubjectRequest, error) {
+	req := &models.DataSubjectRequest{}
+	var resultJSON []byte
+	err := row.Scan(
+		&req.ID,
+		&req.TenantID,
+		&req.SubjectUserID,
+		&req.SubjectEmail,
+		&req.Type,
+		&req.Status,
+		&req.Reason,
+		&req.RequestedBy,
+		&req.Attempts,
+		&resultJSON,
+		&req.LastError,
+		&req.HasArchive,
+		&req.ArchiveExpiresAt,
+		&req.StartedAt,
+		&req.CompletedAt,
+		&req.CreatedAt,
+		&req.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(resultJSON, &req.Result); err != nil {
+		return nil, fmt.Errorf("invalid result of request %s: %w", req.ID, err)
+	}
+
+	return req, nil
+}
@@ -0,0 +1,130 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// EmailOutboxRepository stores rendered emails until a worker delivers them.
+// ClaimDue hands each due message to one worker for the length of the lease
+// and counts the attempt; a message whose lease expires is claimed again.
+type EmailOutboxRepository interface {
+	Enqueue(ctx context.Context, msg *models.EmailMessage) error
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.EmailMessage, error)
+	MarkSent(ctx context.Context, id uuid.UUID, sentAt time.Time) error
+	MarkRetry(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, lastError string) error
+	MarkFailed(ctx context.Context, id uuid.UUID, lastError string) error
+}
+
+type emailOutboxRepository struct {
+	db *sql.DB
+}
+
+func NewEmailOutboxRepository(db *sql.DB) EmailOutboxRepository {
+	return &emailOutboxRepository{db: db}
+}
+
+func (r *emailOutboxRepository) Enqueue(ctx context.Context, msg *models.EmailMessage) error {
+	query := `
+		INSERT INTO email_outbox (id, tenant_id, template, language, from_address, to_address, subject, html_body, text_body,
+		                          status, max_attempts, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $12, $12)
+	`
+
+	now := time.Now()
+	msg.ID = uuid.New()
+	msg.Status = models.EmailStatusPending
+	msg.NextAttemptAt = now
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+
+	_, err := r.db.ExecContext(ctx, query,
+		msg.ID,
+		msg.TenantID,
+		msg.Template,
+		msg.Language,
+		msg.From,
+		msg.To,
+		msg.Subject,
+		msg.HTMLBody,
+		msg.TextBody,
+		msg.Status,
+		msg.MaxAttempts,
+		now,
+	)
+	return err
+}
+
+func (r *emailOutboxRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.EmailMessage, error) {
+	query := `
+		UPDATE email_outbox
+		SET status = 'sending', attempts = attempts + 1, next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status IN ('pending', 'sending') AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, tenant_id, template, language, from_address, to_address, subject, html_body, text_body,
+		          status, attempts, max_attempts, next_attempt_at, last_error, sent_at, created_at, updated_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.EmailMessage
+	for rows.Next() {
+		msg := &models.EmailMessage{}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.TenantID,
+			&msg.Template,
+			&msg.Language,
+			&msg.From,
+			&msg.To,
+			&msg.Subject,
+			&msg.HTMLBody,
+			&msg.TextBody,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.MaxAttempts,
+			&msg.NextAttemptAt,
+			&msg.LastError,
+			&msg.SentAt,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+func (r *emailOutboxRepository) MarkSent(ctx context.Context, id uuid.UUID, sentAt time.Time) error {
+	query := `UPDATE email_outbox SET status = 'sent', sent_at = $1, last_error = NULL WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, sentAt, id)
+	return err
+}
+
+func (r *emailOutboxRepository) MarkRetry(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, lastError string) error {
+	query := `UPDATE email_outbox SET status = 'pending', next_attempt_at = $1, last_error = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, nextAttemptAt, lastError, id)
+	return err
+}
+
+func (r *emailOutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	query := `UPDATE email_outbox SET status = 'failed', last_error = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, lastError, id)
+	return err
+}
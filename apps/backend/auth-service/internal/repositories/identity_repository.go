@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// IdentityRepository stores the links between users and external identity providers
+type IdentityRepository interface {
+	Get(ctx context.Context, tenantID uuid.UUID, provider, subject string) (*models.UserIdentity, error)
+	Create(ctx context.Context, identity *models.UserIdentity) error
+	UpdateLastLogin(ctx context.Context, id uuid.UUID, email string) error
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+func NewIdentityRepository(db *sql.DB) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) Get(ctx context.Context, tenantID uuid.UUID, provider, subject string) (*models.UserIdentity, error) {
+	query := `
+		SELECT id, user_id, tenant_id, provider, subject, email, last_login_at, created_at
+		FROM user_identities
+		WHERE tenant_id = $1 AND provider = $2 AND subject = $3
+	`
+
+	identity := &models.UserIdentity{}
+	err := r.db.QueryRowContext(ctx, query, tenantID, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.TenantID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.LastLoginAt,
+		&identity.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("identity not found")
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (r *identityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, tenant_id, provider, subject, email, last_login_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	now := time.Now()
+	identity.ID = uuid.New()
+	identity.CreatedAt = now
+	identity.LastLoginAt = &now
+
+	_, err := r.db.ExecContext(ctx, query,
+		identity.ID,
+		identity.UserID,
+		identity.TenantID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		identity.LastLoginAt,
+		identity.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *identityRepository) UpdateLastLogin(ctx context.Context, id uuid.UUID, email string) error {
+	query := `UPDATE user_identities SET email = $1, last_login_at = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, email, time.Now(), id)
+	return err
+}
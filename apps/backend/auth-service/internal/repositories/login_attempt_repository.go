@@ -0,0 +1,101 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const loginAttemptKeyPrefix = "auth:login:"
+
+// LoginAttemptRepository keeps failed-login counters, temporary blocks and
+// account unlock tokens. Keys are chosen by the caller and expire on their own.
+type LoginAttemptRepository interface {
+	// IncrementFailures adds a failure to the counter and returns the new
+	// count. The counter expires window after its first failure.
+	IncrementFailures(ctx context.Context, key string, window time.Duration) (int, error)
+	ResetFailures(ctx context.Context, key string) error
+	Block(ctx context.Context, key string, duration time.Duration) error
+	// BlockedFor returns how long the block on key has left, 0 if there is none
+	BlockedFor(ctx context.Context, key string) (time.Duration, error)
+	Unblock(ctx context.Context, key string) error
+	SaveUnlockToken(ctx context.Context, token string, userID uuid.UUID, ttl time.Duration) error
+	// ConsumeUnlockToken returns the user an unlock token was issued for and
+	// deletes it
+	ConsumeUnlockToken(ctx context.Context, token string) (uuid.UUID, error)
+}
+
+type loginAttemptRepository struct {
+	redis *redis.Client
+}
+
+func NewLoginAttemptRepository(redis *redis.Client) LoginAttemptRepository {
+	return &loginAttemptRepository{redis: redis}
+}
+
+func (r *loginAttemptRepository) IncrementFailures(ctx context.Context, key string, window time.Duration) (int, error) {
+	key = loginAttemptKeyPrefix + "failures:" + key
+
+	var incr *redis.IntCmd
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		// NX keeps the window anchored at the first failure
+		pipe.ExpireNX(ctx, key, window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(incr.Val()), nil
+}
+
+func (r *loginAttemptRepository) ResetFailures(ctx context.Context, key string) error {
+	return r.redis.Del(ctx, loginAttemptKeyPrefix+"failures:"+key).Err()
+}
+
+func (r *loginAttemptRepository) Block(ctx context.Context, key string, duration time.Duration) error {
+	return r.redis.Set(ctx, loginAttemptKeyPrefix+"block:"+key, time.Now().Add(duration).Unix(), duration).Err()
+}
+
+func (r *loginAttemptRepository) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.redis.PTTL(ctx, loginAttemptKeyPrefix+"block:"+key).Result()
+	if err != nil {
+		return 0, err
+	}
+	// PTTL reports a missing key as a negative duration
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (r *loginAttemptRepository) Unblock(ctx context.Context, key string) error {
+	return r.redis.Del(ctx, loginAttemptKeyPrefix+"block:"+key).Err()
+}
+
+func (r *loginAttemptRepository) SaveUnlockToken(ctx context.Context, token string, userID uuid.UUID, ttl time.Duration) error {
+	return r.redis.Set(ctx, loginAttemptKeyPrefix+"unlock:"+token, userID.String(), ttl).Err()
+}
+
+func (r *loginAttemptRepository) ConsumeUnlockToken(ctx context.Context, token string) (uuid.UUID, error) {
+	key := loginAttemptKeyPrefix + "unlock:" + token
+
+	var get *redis.StringCmd
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err == redis.Nil {
+		return uuid.Nil, fmt.Errorf("unlock token not found")
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(get.Val())
+}
@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type MembershipRepository interface {
+	// AddMembership adds the user to a tenant, or reactivates the membership
+	// with the given role when it already exists
+	AddMembership(ctx context.Context, membership *models.TenantMembership) error
+	// ListMemberships returns the user's active memberships in active tenants,
+	// home tenant first
+	ListMemberships(ctx context.Context, userID uuid.UUID) ([]*models.TenantMembership, error)
+}
+
+type membershipRepository struct {
+	db *sql.DB
+}
+
+func NewMembershipRepository(db *sql.DB) MembershipRepository {
+	return &membershipRepository{db: db}
+}
+
+func (r *membershipRepository) AddMembership(ctx context.Context, membership *models.TenantMembership) error {
+	query := `
+		INSERT INTO tenant_memberships (user_id, tenant_id, role, is_active)
+		VALUES ($1, $2, $3, true)
+		ON CONFLICT (user_id, tenant_id) DO UPDATE SET role = EXCLUDED.role, is_active = true
+		RETURNING created_at
+	`
+
+	membership.IsActive = true
+	return r.db.QueryRowContext(ctx, query, membership.UserID, membership.TenantID, membership.Role).Scan(&membership.CreatedAt)
+}
+
+func (r *membershipRepository) ListMemberships(ctx context.Context, userID uuid.UUID) ([]*models.TenantMembership, error) {
+	query := `
+		SELECT m.user_id, m.tenant_id, t.name, t.subdomain, m.role, m.is_active,
+			   m.tenant_id = u.tenant_id, m.created_at
+		FROM tenant_memberships m
+		JOIN tenants t ON t.id = m.tenant_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = $1 AND m.is_active = true AND t.is_active = true
+		ORDER BY m.tenant_id = u.tenant_id DESC, t.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []*models.TenantMembership
+	for rows.Next() {
+		membership := &models.TenantMembership{}
+		if err := rows.Scan(
+			&membership.UserID,
+			&membership.TenantID,
+			&membership.TenantName,
+			&membership.TenantSubdomain,
+			&membership.Role,
+			&membership.IsActive,
+			&membership.IsHome,
+			&membership.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, membership)
+	}
+
+	return memberships, rows.Err()
+}
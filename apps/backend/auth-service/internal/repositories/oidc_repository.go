@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type OIDCRepository interface {
+	CreateState(ctx context.Context, state *models.OIDCAuthState) error
+	ConsumeState(ctx context.Context, state string) (*models.OIDCAuthState, error)
+	DeleteExpiredStates(ctx context.Context) error
+}
+
+type oidcRepository struct {
+	db *sql.DB
+}
+
+func NewOIDCRepository(db *sql.DB) OIDCRepository {
+	return &oidcRepository{db: db}
+}
+
+func (r *oidcRepository) CreateState(ctx context.Context, state *models.OIDCAuthState) error {
+	query := `
+		INSERT INTO oidc_auth_states (id, state, nonce, code_verifier, tenant_id, provider, redirect_uri, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	state.ID = uuid.New()
+	state.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		state.ID,
+		state.State,
+		state.Nonce,
+		state.CodeVerifier,
+		state.TenantID,
+		state.Provider,
+		state.RedirectURI,
+		state.ExpiresAt,
+		state.CreatedAt,
+	)
+
+	return err
+}
+
+// ConsumeState fetches and deletes a state in one statement so it can only be used once
+func (r *oidcRepository) ConsumeState(ctx context.Context, state string) (*models.OIDCAuthState, error) {
+	query := `
+		DELETE FROM oidc_auth_states
+		WHERE state = $1
+		RETURNING id, state, nonce, code_verifier, tenant_id, provider, redirect_uri, expires_at, created_at
+	`
+
+	authState := &models.OIDCAuthState{}
+	err := r.db.QueryRowContext(ctx, query, state).Scan(
+		&authState.ID,
+		&authState.State,
+		&authState.Nonce,
+		&authState.CodeVerifier,
+		&authState.TenantID,
+		&authState.Provider,
+		&authState.RedirectURI,
+		&authState.ExpiresAt,
+		&authState.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("authorization state not found")
+		}
+		return nil, err
+	}
+
+	return authState, nil
+}
+
+func (r *oidcRepository) DeleteExpiredStates(ctx context.Context) error {
+	query := `DELETE FROM oidc_auth_states WHERE expires_at < NOW()`
+	_, err := r.db.ExecContext(ctx, query)
+	return err
+}
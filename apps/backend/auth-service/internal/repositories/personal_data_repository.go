@@ -0,0 +1,400 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+)
+
+// ErrPersonalDataSourceUnavailable is returned when a source's tables do not
+// exist, because the service that owns them is not deployed
+var ErrPersonalDataSourceUnavailable = errors.New("data source not installed")
+
+// PersonalDataSource finds the personal data of a data subject in the tables
+// one service owns. Export returns the subject's records per table; Erase
+// removes or anonymizes them and returns the number of rows changed per
+// table. Records that other figures depend on (orders, timesheets, salaries)
+// are anonymized rather than deleted so aggregates stay correct. Erase is
+// idempotent.
+type PersonalDataSource interface {
+	Name() string
+	Export(ctx context.Context, subject *models.DataSubject) (map[string][]map[string]interface{}, error)
+	Erase(ctx context.Context, subject *models.DataSubject) (map[string]int64, error)
+}
+
+// NewPersonalDataSources returns every source, in the order they must be
+// erased: check-ins are matched through HRM employees, so they go first.
+// All services share one database; a source moves behind the owning
+// service's API if that changes.
+func NewPersonalDataSources(db *sql.DB) []PersonalDataSource {
+	return []PersonalDataSource{
+		newCRMPersonalData(db),
+		newPOSPersonalData(db),
+		newCheckinPersonalData(db),
+		newHRMPersonalData(db),
+		newFilePersonalData(db),
+		&accountPersonalData{db: db},
+	}
+}
+
+// personalDataQuery is one table's query. Arguments are picked by args from
+// the subject, since Postgres rejects parameters a query does not use.
+type personalDataQuery struct {
+	table string
+	query string
+	args  func(s *models.DataSubject) []interface{}
+}
+
+func byTenantEmail(s *models.DataSubject) []interface{} {
+	return []interface{}{s.TenantID.String(), s.Email}
+}
+
+func byTenantUser(s *models.DataSubject) []interface{} {
+	return []interface{}{s.TenantID.String(), s.UserID.String()}
+}
+
+func byTenantUserEmail(s *models.DataSubject) []interface{} {
+	return []interface{}{s.TenantID.String(), s.UserID.String(), s.Email}
+}
+
+// sqlPersonalData is a source defined only by its queries. Erase statements
+// run in order in one transaction.
+type sqlPersonalData struct {
+	db      *sql.DB
+	name    string
+	exports []personalDataQuery
+	erasure []personalDataQuery
+}
+
+func (s *sqlPersonalData) Name() string {
+	return s.name
+}
+
+func (s *sqlPersonalData) Export(ctx context.Context, subject *models.DataSubject) (map[string][]map[string]interface{}, error) {
+	data := make(map[string][]map[string]interface{})
+	for _, q := range s.exports {
+		records, err := queryRecords(ctx, s.db, q.query, q.args(subject)...)
+		if err != nil {
+			return nil, sourceError(q.table, err)
+		}
+		data[q.table] = records
+	}
+
+	return data, nil
+}
+
+func (s *sqlPersonalData) Erase(ctx context.Context, subject *models.DataSubject) (map[string]int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	changed := make(map[string]int64)
+	for _, q := range s.erasure {
+		res, err := tx.ExecContext(ctx, q.query, q.args(subject)...)
+		if err != nil {
+			return nil, sourceError(q.table, err)
+		}
+		n, _ := res.RowsAffected()
+		changed[q.table] += n
+	}
+
+	return changed, tx.Commit()
+}
+
+// CRM stores contacts by email; activities are erased first, while their
+// customer or lead can still be matched by email
+func newCRMPersonalData(db *sql.DB) PersonalDataSource {
+	customers := `SELECT id FROM customers WHERE tenant_id = $1 AND LOWER(email) = LOWER($2)`
+	leads := `SELECT id FROM leads WHERE tenant_id = $1 AND LOWER(email) = LOWER($2)`
+
+	return &sqlPersonalData{
+		db:   db,
+		name: "crm",
+		exports: []personalDataQuery{
+			{"customers", `SELECT * FROM customers WHERE tenant_id = $1 AND LOWER(email) = LOWER($2) ORDER BY id`, byTenantEmail},
+			{"leads", `SELECT * FROM leads WHERE tenant_id = $1 AND LOWER(email) = LOWER($2) ORDER BY id`, byTenantEmail},
+			{"contact_activities", `SELECT * FROM contact_activities WHERE tenant_id = $1 AND (customer_id IN (` + customers + `) OR lead_id IN (` + leads + `)) ORDER BY id`, byTenantEmail},
+		},
+		erasure: []personalDataQuery{
+			{"contact_activities", `
+				UPDATE contact_activities SET subject = '[erased]', description = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND (customer_id IN (` + customers + `) OR lead_id IN (` + leads + `))`, byTenantEmail},
+			{"customers", `
+				UPDATE customers SET name = 'Erased customer', email = 'erased-' || id || '@erased.invalid',
+				    phone = NULL, company = NULL, address = NULL, city = NULL, state = NULL, country = NULL,
+				    zip_code = NULL, tags = NULL, notes = NULL, status = 'inactive', updated_at = NOW()
+				WHERE tenant_id = $1 AND LOWER(email) = LOWER($2)`, byTenantEmail},
+			{"leads", `
+				UPDATE leads SET name = 'Erased lead', email = 'erased-' || id || '@erased.invalid',
+				    phone = NULL, company = NULL, title = NULL, notes = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND LOWER(email) = LOWER($2)`, byTenantEmail},
+		},
+	}
+}
+
+// POS orders keep their amounts; only the customer's contact details go
+func newPOSPersonalData(db *sql.DB) PersonalDataSource {
+	return &sqlPersonalData{
+		db:   db,
+		name: "pos",
+		exports: []personalDataQuery{
+			{"orders", `SELECT * FROM orders WHERE tenant_id = $1 AND LOWER(customer_email) = LOWER($2) ORDER BY id`, byTenantEmail},
+		},
+		erasure: []personalDataQuery{
+			{"orders", `
+				UPDATE orders SET customer_name = NULL, customer_phone = NULL, customer_email = NULL, notes = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND LOWER(customer_email) = LOWER($2)`, byTenantEmail},
+		},
+	}
+}
+
+// subjectEmployees matches the subject's HRM employee records by user link or email
+const subjectEmployees = `SELECT id FROM employees WHERE tenant_id = $1 AND (user_id = $2 OR LOWER(email) = LOWER($3))`
+
+// Check-ins keep their times, which timesheets are built from; names,
+// locations, photos and devices go
+func newCheckinPersonalData(db *sql.DB) PersonalDataSource {
+	return &sqlPersonalData{
+		db:   db,
+		name: "checkin",
+		exports: []personalDataQuery{
+			{"checkin_records", `SELECT * FROM checkin_records WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `) ORDER BY timestamp`, byTenantUserEmail},
+			{"attendance_summary", `SELECT * FROM attendance_summary WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `) ORDER BY date`, byTenantUserEmail},
+		},
+		erasure: []personalDataQuery{
+			{"checkin_records", `
+				UPDATE checkin_records SET employee_name = 'Erased', location = NULL, latitude = NULL, longitude = NULL,
+				    ip_address = NULL, device_info = NULL, photo = NULL, notes = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `)`, byTenantUserEmail},
+			{"attendance_summary", `
+				UPDATE attendance_summary SET employee_name = 'Erased', notes = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `)`, byTenantUserEmail},
+		},
+	}
+}
+
+// HRM employees keep department, position, dates and salary for payroll
+// totals; identity, contact and free-text fields go
+func newHRMPersonalData(db *sql.DB) PersonalDataSource {
+	return &sqlPersonalData{
+		db:   db,
+		name: "hrm",
+		exports: []personalDataQuery{
+			{"employees", `SELECT * FROM employees WHERE tenant_id = $1 AND (user_id = $2 OR LOWER(email) = LOWER($3)) ORDER BY id`, byTenantUserEmail},
+			{"leaves", `SELECT * FROM leaves WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `) ORDER BY id`, byTenantUserEmail},
+			{"performance_reviews", `SELECT * FROM performance_reviews WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `) ORDER BY id`, byTenantUserEmail},
+		},
+		erasure: []personalDataQuery{
+			{"leaves", `
+				UPDATE leaves SET reason = '[erased]', comments = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `)`, byTenantUserEmail},
+			{"performance_reviews", `
+				UPDATE performance_reviews SET goals = NULL, achievements = NULL, strengths = NULL,
+				    areas_for_improvement = NULL, comments = NULL, updated_at = NOW()
+				WHERE tenant_id = $1 AND employee_id IN (` + subjectEmployees + `)`, byTenantUserEmail},
+			{"employees", `
+				UPDATE employees SET first_name = 'Erased', last_name = 'Employee', email = 'erased-' || id || '@erased.invalid',
+				    phone = NULL, address = NULL, date_of_birth = NULL, gender = NULL, emergency_name = NULL,
+				    emergency_phone = NULL, user_id = NULL, is_active = false, updated_at = NOW()
+				WHERE tenant_id = $1 AND (user_id = $2 OR LOWER(email) = LOWER($3))`, byTenantUserEmail},
+		},
+	}
+}
+
+// Files uploaded by the subject are soft-deleted; file-service removes the
+// stored content of deleted files
+func newFilePersonalData(db *sql.DB) PersonalDataSource {
+	return &sqlPersonalData{
+		db:   db,
+		name: "files",
+		exports: []personalDataQuery{
+			{"files", `
+				SELECT id, original_filename, content_type, file_size, metadata, tags, is_public, created_at, updated_at, deleted_at
+				FROM files WHERE tenant_id::text = $1 AND upload_user_id::text = $2 ORDER BY created_at`, byTenantUser},
+			{"file_access_logs", `
+				SELECT file_id, action, ip_address, user_agent, accessed_at
+				FROM file_access_logs WHERE tenant_id::text = $1 AND user_id::text = $2 ORDER BY accessed_at`, byTenantUser},
+		},
+		erasure: []personalDataQuery{
+			{"files", `
+				UPDATE files SET original_filename = 'erased', metadata = '{}', tags = ARRAY[]::TEXT[],
+				    deleted_at = COALESCE(deleted_at, NOW()), updated_at = NOW()
+				WHERE tenant_id::text = $1 AND upload_user_id::text = $2`, byTenantUser},
+			{"file_access_logs", `DELETE FROM file_access_logs WHERE tenant_id::text = $1 AND user_id::text = $2`, byTenantUser},
+		},
+	}
+}
+
+// accountPersonalData is the user account itself. An account that also
+// belongs to other tenants is not this tenant's to erase: it only loses its
+// membership here. Otherwise it is anonymized and can no longer sign in.
+// Audit log entries are kept, without IP addresses.
+type accountPersonalData struct {
+	db *sql.DB
+}
+
+func (s *accountPersonalData) Name() string {
+	return "account"
+}
+
+func (s *accountPersonalData) Export(ctx context.Context, subject *models.DataSubject) (map[string][]map[string]interface{}, error) {
+	byUser := func(subject *models.DataSubject) []interface{} { return []interface{}{subject.UserID} }
+	byUserTenant := func(subject *models.DataSubject) []interface{} {
+		return []interface{}{subject.UserID, subject.TenantID}
+	}
+
+	source := &sqlPersonalData{
+		db: s.db,
+		exports: []personalDataQuery{
+			{"users", `
+				SELECT id, email, first_name, last_name, is_active, is_verified, last_login_at, created_at, updated_at
+				FROM users WHERE id = $1`, byUser},
+			{"user_profiles", `
+				SELECT avatar, phone, address, city, country, postal_code, date_of_birth, bio, language, timezone, created_at, updated_at
+				FROM user_profiles WHERE user_id = $1`, byUser},
+			{"tenant_memberships", `SELECT tenant_id, role, is_active, created_at FROM tenant_memberships WHERE user_id = $1 AND tenant_id = $2`, byUserTenant},
+			{"user_identities", `SELECT provider, email, last_login_at, created_at FROM user_identities WHERE user_id = $1 AND tenant_id = $2`, byUserTenant},
+			{"api_keys", `
+				SELECT name, prefix, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at
+				FROM api_keys WHERE user_id = $1 AND tenant_id = $2`, byUserTenant},
+			{"audit_logs", `
+				SELECT action, ip_address, details, created_at,
+				       CASE WHEN actor_id = $1 THEN 'actor' ELSE 'subject' END AS involvement
+				FROM audit_logs WHERE tenant_id = $2 AND (actor_id = $1 OR target_user_id = $1) ORDER BY created_at`, byUserTenant},
+		},
+	}
+
+	return source.Export(ctx, subject)
+}
+
+func (s *accountPersonalData) Erase(ctx context.Context, subject *models.DataSubject) (map[string]int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	changed := make(map[string]int64)
+	exec := func(table, query string, args ...interface{}) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return sourceError(table, err)
+		}
+		n, _ := res.RowsAffected()
+		changed[table] += n
+		return nil
+	}
+
+	var otherTenants int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tenant_memberships WHERE user_id = $1 AND tenant_id <> $2 AND is_active = true
+	`, subject.UserID, subject.TenantID).Scan(&otherTenants)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tenant-scoped records go in either case
+	tenantScoped := []struct{ table, query string }{
+		{"user_roles", `DELETE FROM user_roles WHERE user_id = $1 AND role_id IN (SELECT id FROM roles WHERE tenant_id = $2)`},
+		{"user_identities", `DELETE FROM user_identities WHERE user_id = $1 AND tenant_id = $2`},
+		{"api_keys", `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()), last_used_ip = NULL WHERE user_id = $1 AND tenant_id = $2 AND (revoked_at IS NULL OR last_used_ip IS NOT NULL)`},
+		{"audit_logs", `UPDATE audit_logs SET ip_address = NULL WHERE tenant_id = $2 AND (actor_id = $1 OR target_user_id = $1) AND ip_address IS NOT NULL`},
+	}
+	for _, q := range tenantScoped {
+		if err := exec(q.table, q.query, subject.UserID, subject.TenantID); err != nil {
+			return nil, err
+		}
+	}
+	if err := exec("user_invitations", `DELETE FROM user_invitations WHERE tenant_id = $1 AND LOWER(email) = LOWER($2)`, subject.TenantID, subject.Email); err != nil {
+		return nil, err
+	}
+
+	if otherTenants > 0 {
+		if err := exec("tenant_memberships", `DELETE FROM tenant_memberships WHERE user_id = $1 AND tenant_id = $2`, subject.UserID, subject.TenantID); err != nil {
+			return nil, err
+		}
+		// Move the home tenant to the oldest remaining membership
+		err := exec("users", `
+			UPDATE users u SET tenant_id = m.tenant_id, role = m.role
+			FROM (
+				SELECT tenant_id, role FROM tenant_memberships
+				WHERE user_id = $1 AND is_active = true
+				ORDER BY created_at LIMIT 1
+			) m
+			WHERE u.id = $1 AND u.tenant_id = $2`, subject.UserID, subject.TenantID)
+		if err != nil {
+			return nil, err
+		}
+
+		return changed, tx.Commit()
+	}
+
+	err = exec("users", `
+		UPDATE users SET email = 'erased-' || id || '@erased.invalid', first_name = 'Erased', last_name = 'User',
+		    password_hash = '', is_active = false, is_verified = false, last_login_at = NULL
+		WHERE id = $1 AND email <> 'erased-' || id || '@erased.invalid'`, subject.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range []string{"user_profiles", "refresh_tokens", "password_resets", "email_verifications", "password_history", "scim_group_members"} {
+		if err := exec(table, `DELETE FROM `+table+` WHERE user_id = $1`, subject.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if err := exec("tenant_memberships", `UPDATE tenant_memberships SET is_active = false WHERE user_id = $1 AND is_active = true`, subject.UserID); err != nil {
+		return nil, err
+	}
+
+	return changed, tx.Commit()
+}
+
+// queryRecords returns the rows of a query as column-to-value maps
+func queryRecords(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			// Text, numeric and JSON columns arrive as bytes
+			if b, ok := values[i].([]byte); ok {
+				record[column] = string(b)
+			} else {
+				record[column] = values[i]
+			}
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func sourceError(table string, err error) error {
+	if isUndefinedTable(err) {
+		return fmt.Errorf("%w: %s", ErrPersonalDataSourceUnavailable, table)
+	}
+	return fmt.Errorf("%s: %w", table, err)
+}
@@ -0,0 +1,447 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrRetentionDataUnavailable is returned when a data class's table does not
+// exist, because the service that owns it is not deployed
+var ErrRetentionDataUnavailable = errors.New("data class not installed")
+
+// defaultRetentionDays matches the tenant_configurations column default, for
+// tenants without a configuration row
+const defaultRetentionDays = 365
+
+// retentionLockKey is the advisory lock that keeps retention passes of
+// several auth-service instances from overlapping
+const retentionLockKey = 7_340_040
+
+// RetentionRepository stores retention policies, legal holds and run history,
+// and removes data past retention. Purge with dryRun only counts the rows.
+type RetentionRepository interface {
+	ListTenants(ctx context.Context) ([]*models.TenantRetention, error)
+	GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.TenantRetention, error)
+	// SetOverride sets the retention of a data class, or removes the
+	// override when days is nil
+	SetOverride(ctx context.Context, tenantID uuid.UUID, dataClass string, days *int, updatedBy uuid.UUID) error
+	ListHolds(ctx context.Context, tenantID uuid.UUID) ([]*models.LegalHold, error)
+	CreateHold(ctx context.Context, hold *models.LegalHold) error
+	ReleaseHold(ctx context.Context, tenantID, id, releasedBy uuid.UUID, at time.Time) error
+	Purge(ctx context.Context, tenantID uuid.UUID, dataClass string, cutoff time.Time, dryRun bool) (int64, error)
+	CreateRun(ctx context.Context, run *models.RetentionRun) error
+	ListRuns(ctx context.Context, tenantID uuid.UUID, limit int) ([]*models.RetentionRun, error)
+	Metrics(ctx context.Context, tenantID uuid.UUID, since time.Time) (*models.RetentionMetrics, error)
+	// LastRunAt returns the start of the latest retention pass that was not a
+	// dry run, or nil if there was none
+	LastRunAt(ctx context.Context) (*time.Time, error)
+	// Lock takes the retention lock if no other instance holds it. release
+	// must be called once the pass is done.
+	Lock(ctx context.Context) (release func(), acquired bool, err error)
+}
+
+type retentionRepository struct {
+	db *sql.DB
+}
+
+func NewRetentionRepository(db *sql.DB) RetentionRepository {
+	return &retentionRepository{db: db}
+}
+
+// retentionStatement removes one data class. where selects the rows past
+// retention with the tenant ID as text in $1 and the cutoff in $2; purge
+// removes them and its affected row count is the number removed.
+type retentionStatement struct {
+	table string
+	where string
+	purge string
+}
+
+// notHeld excludes rows of an entity under an active legal hold. Holds on the
+// whole tenant are checked before a class is purged.
+func notHeld(dataClass, entityType, column string) string {
+	return `NOT EXISTS (
+		SELECT 1 FROM legal_holds h
+		WHERE h.tenant_id::text = $1 AND h.released_at IS NULL
+			AND (h.data_class IS NULL OR h.data_class = '` + dataClass + `')
+			AND h.entity_type = '` + entityType + `' AND h.entity_id = ` + column + `)`
+}
+
+// retentionStatements are the statements per data class. Password resets
+// and refresh tokens carry no tenant and follow the user's home tenant.
+var retentionStatements = func() map[string]retentionStatement {
+	statements := map[string]retentionStatement{
+		models.RetentionClassCheckinPhotos: {
+			table: "checkin_records",
+			where: `tenant_id = $1 AND timestamp < $2 AND photo IS NOT NULL
+				AND ` + notHeld(models.RetentionClassCheckinPhotos, models.LegalHoldEntityEmployee, "checkin_records.employee_id::text"),
+		},
+		models.RetentionClassCheckinRecords: {
+			table: "checkin_records",
+			where: `tenant_id = $1 AND timestamp < $2
+				AND ` + notHeld(models.RetentionClassCheckinRecords, models.LegalHoldEntityEmployee, "checkin_records.employee_id::text"),
+		},
+		models.RetentionClassContactActivities: {
+			table: "contact_activities",
+			where: `tenant_id = $1 AND created_at < $2
+				AND ` + notHeld(models.RetentionClassContactActivities, models.LegalHoldEntityCustomer, "contact_activities.customer_id::text") + `
+				AND ` + notHeld(models.RetentionClassContactActivities, models.LegalHoldEntityLead, "contact_activities.lead_id::text"),
+		},
+		models.RetentionClassDeletedFiles: {
+			table: "files",
+			where: `tenant_id::text = $1 AND deleted_at < $2
+				AND ` + notHeld(models.RetentionClassDeletedFiles, models.LegalHoldEntityFile, "files.id::text") + `
+				AND ` + notHeld(models.RetentionClassDeletedFiles, models.LegalHoldEntityUser, "files.upload_user_id::text"),
+		},
+		models.RetentionClassExpiredInvitations: {
+			table: "user_invitations",
+			where: `tenant_id::text = $1 AND status <> 'accepted' AND expires_at < $2`,
+		},
+		models.RetentionClassPasswordResets: {
+			table: "password_resets",
+			where: `user_id IN (SELECT id FROM users WHERE tenant_id::text = $1) AND expires_at < $2
+				AND ` + notHeld(models.RetentionClassPasswordResets, models.LegalHoldEntityUser, "password_resets.user_id::text"),
+		},
+		models.RetentionClassRefreshTokens: {
+			table: "refresh_tokens",
+			where: `user_id IN (SELECT id FROM users WHERE tenant_id::text = $1) AND expires_at < $2
+				AND ` + notHeld(models.RetentionClassRefreshTokens, models.LegalHoldEntityUser, "refresh_tokens.user_id::text"),
+		},
+	}
+
+	for class, s := range statements {
+		switch class {
+		case models.RetentionClassCheckinPhotos:
+			s.purge = `UPDATE checkin_records SET photo = NULL, updated_at = NOW() WHERE ` + s.where
+		case models.RetentionClassDeletedFiles:
+			// file-service removes the blobs queued in file_blob_purges
+			s.purge = `
+				WITH purged AS (DELETE FROM files WHERE ` + s.where + ` RETURNING id, file_path),
+				logs AS (DELETE FROM file_access_logs WHERE file_id IN (SELECT id FROM purged))
+				INSERT INTO file_blob_purges (file_path) SELECT file_path FROM purged`
+		default:
+			s.purge = `DELETE FROM ` + s.table + ` WHERE ` + s.where
+		}
+		statements[class] = s
+	}
+	return statements
+}()
+
+func (r *retentionRepository) ListTenants(ctx context.Context) ([]*models.TenantRetention, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT t.id, COALESCE(c.data_retention_days, $1)
+		FROM tenants t
+		LEFT JOIN tenant_configurations c ON c.tenant_id = t.id
+		ORDER BY t.created_at
+	`, defaultRetentionDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []*models.TenantRetention
+	byID := make(map[uuid.UUID]*models.TenantRetention)
+	for rows.Next() {
+		tenant := &models.TenantRetention{Overrides: make(map[string]int)}
+		if err := rows.Scan(&tenant.TenantID, &tenant.DefaultDays); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+		byID[tenant.TenantID] = tenant
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	overrides, err := r.db.QueryContext(ctx, `SELECT tenant_id, data_class, retention_days FROM retention_policies`)
+	if err != nil {
+		return nil, err
+	}
+	defer overrides.Close()
+
+	for overrides.Next() {
+		var tenantID uuid.UUID
+		var dataClass string
+		var days int
+		if err := overrides.Scan(&tenantID, &dataClass, &days); err != nil {
+			return nil, err
+		}
+		if tenant, ok := byID[tenantID]; ok {
+			tenant.Overrides[dataClass] = days
+		}
+	}
+
+	return tenants, overrides.Err()
+}
+
+func (r *retentionRepository) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.TenantRetention, error) {
+	tenant := &models.TenantRetention{TenantID: tenantID, Overrides: make(map[string]int)}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(c.data_retention_days, $2)
+		FROM tenants t
+		LEFT JOIN tenant_configurations c ON c.tenant_id = t.id
+		WHERE t.id = $1
+	`, tenantID, defaultRetentionDays).Scan(&tenant.DefaultDays)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tenant not found")
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT data_class, retention_days FROM retention_policies WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dataClass string
+		var days int
+		if err := rows.Scan(&dataClass, &days); err != nil {
+			return nil, err
+		}
+		tenant.Overrides[dataClass] = days
+	}
+
+	return tenant, rows.Err()
+}
+
+func (r *retentionRepository) SetOverride(ctx context.Context, tenantID uuid.UUID, dataClass string, days *int, updatedBy uuid.UUID) error {
+	if days == nil {
+		_, err := r.db.ExecContext(ctx, `DELETE FROM retention_policies WHERE tenant_id = $1 AND data_class = $2`, tenantID, dataClass)
+		return err
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO retention_policies (tenant_id, data_class, retention_days, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (tenant_id, data_class)
+		DO UPDATE SET retention_days = EXCLUDED.retention_days, updated_by = EXCLUDED.updated_by, updated_at = NOW()
+	`, tenantID, dataClass, *days, updatedBy)
+	return err
+}
+
+func (r *retentionRepository) ListHolds(ctx context.Context, tenantID uuid.UUID) ([]*models.LegalHold, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, tenant_id, data_class, entity_type, entity_id, reason, created_by, created_at, released_by, released_at
+		FROM legal_holds
+		WHERE tenant_id = $1
+		ORDER BY released_at IS NULL DESC, created_at DESC
+		LIMIT 500
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []*models.LegalHold
+	for rows.Next() {
+		hold := &models.LegalHold{}
+		err := rows.Scan(
+			&hold.ID,
+			&hold.TenantID,
+			&hold.DataClass,
+			&hold.EntityType,
+			&hold.EntityID,
+			&hold.Reason,
+			&hold.CreatedBy,
+			&hold.CreatedAt,
+			&hold.ReleasedBy,
+			&hold.ReleasedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+
+	return holds, rows.Err()
+}
+
+func (r *retentionRepository) CreateHold(ctx context.Context, hold *models.LegalHold) error {
+	hold.ID = uuid.New()
+	hold.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO legal_holds (id, tenant_id, data_class, entity_type, entity_id, reason, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, hold.ID, hold.TenantID, hold.DataClass, hold.EntityType, hold.EntityID, hold.Reason, hold.CreatedBy, hold.CreatedAt)
+	return err
+}
+
+func (r *retentionRepository) ReleaseHold(ctx context.Context, tenantID, id, releasedBy uuid.UUID, at time.Time) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE legal_holds SET released_by = $3, released_at = $4
+		WHERE id = $1 AND tenant_id = $2 AND released_at IS NULL
+	`, id, tenantID, releasedBy, at)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("legal hold not found")
+	}
+	return nil
+}
+
+func (r *retentionRepository) Purge(ctx context.Context, tenantID uuid.UUID, dataClass string, cutoff time.Time, dryRun bool) (int64, error) {
+	statement, ok := retentionStatements[dataClass]
+	if !ok {
+		return 0, fmt.Errorf("unknown data class %q", dataClass)
+	}
+
+	var removed int64
+	if dryRun {
+		query := `SELECT COUNT(*) FROM ` + statement.table + ` WHERE ` + statement.where
+		if err := r.db.QueryRowContext(ctx, query, tenantID.String(), cutoff).Scan(&removed); err != nil {
+			return 0, retentionError(statement.table, err)
+		}
+		return removed, nil
+	}
+
+	res, err := r.db.ExecContext(ctx, statement.purge, tenantID.String(), cutoff)
+	if err != nil {
+		return 0, retentionError(statement.table, err)
+	}
+	removed, _ = res.RowsAffected()
+	return removed, nil
+}
+
+func (r *retentionRepository) CreateRun(ctx context.Context, run *models.RetentionRun) error {
+	report, err := json.Marshal(run.Report)
+	if err != nil {
+		return err
+	}
+	run.ID = uuid.New()
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO retention_runs (id, tenant_id, dry_run, report, total_removed, triggered_by, started_at, completed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, run.ID, run.TenantID, run.DryRun, report, run.TotalRemoved, run.TriggeredBy, run.StartedAt, run.CompletedAt)
+	return err
+}
+
+func (r *retentionRepository) ListRuns(ctx context.Context, tenantID uuid.UUID, limit int) ([]*models.RetentionRun, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, tenant_id, dry_run, report, total_removed, triggered_by, started_at, completed_at
+		FROM retention_runs
+		WHERE tenant_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+	`, tenantID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*models.RetentionRun
+	for rows.Next() {
+		run := &models.RetentionRun{}
+		var report []byte
+		err := rows.Scan(
+			&run.ID,
+			&run.TenantID,
+			&run.DryRun,
+			&report,
+			&run.TotalRemoved,
+			&run.TriggeredBy,
+			&run.StartedAt,
+			&run.CompletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(report, &run.Report); err != nil {
+			return nil, fmt.Errorf("invalid report of retention run %s: %w", run.ID, err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+func (r *retentionRepository) Metrics(ctx context.Context, tenantID uuid.UUID, since time.Time) (*models.RetentionMetrics, error) {
+	metrics := &models.RetentionMetrics{Since: since, Removed: make(map[string]int64)}
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(total_removed), 0)
+		FROM retention_runs
+		WHERE tenant_id = $1 AND dry_run = false AND started_at >= $2
+	`, tenantID, since).Scan(&metrics.Runs, &metrics.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT class.key, COALESCE(SUM((class.value->>'removed')::bigint), 0)
+		FROM retention_runs, jsonb_each(report) AS class
+		WHERE tenant_id = $1 AND dry_run = false AND started_at >= $2
+		GROUP BY class.key
+	`, tenantID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dataClass string
+		var removed int64
+		if err := rows.Scan(&dataClass, &removed); err != nil {
+			return nil, err
+		}
+		metrics.Removed[dataClass] = removed
+	}
+
+	return metrics, rows.Err()
+}
+
+func (r *retentionRepository) LastRunAt(ctx context.Context) (*time.Time, error) {
+	var last sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT MAX(started_at) FROM retention_runs WHERE dry_run = false`).Scan(&last)
+	if err != nil || !last.Valid {
+		return nil, err
+	}
+	return &last.Time, nil
+}
+
+func (r *retentionRepository) Lock(ctx context.Context) (func(), bool, error) {
+	// Advisory locks belong to a session, so hold one connection until release
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, retentionLockKey).Scan(&acquired); err != nil || !acquired {
+		conn.Close()
+		return nil, false, err
+	}
+
+	release := func() {
+		conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, retentionLockKey)
+		conn.Close()
+	}
+	return release, true, nil
+}
+
+func retentionError(table string, err error) error {
+	if isUndefinedTable(err) {
+		return fmt.Errorf("%w: %s", ErrRetentionDataUnavailable, table)
+	}
+	return fmt.Errorf("%s: %w", table, err)
+}
+
+// isUndefinedTable reports whether err is Postgres' undefined_table error
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
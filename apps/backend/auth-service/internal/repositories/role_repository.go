@@ -0,0 +1,297 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type RoleRepository interface {
+	ListRoles(ctx context.Context, tenantID uuid.UUID) ([]*models.Role, error)
+	GetRole(ctx context.Context, tenantID, id uuid.UUID) (*models.Role, error)
+	GetSystemRole(ctx context.Context, name string) (*models.Role, error)
+	CreateRole(ctx context.Context, role *models.Role) error
+	UpdateRole(ctx context.Context, role *models.Role) error
+	DeleteRole(ctx context.Context, tenantID, id uuid.UUID) error
+	GetUserRoles(ctx context.Context, tenantID, userID uuid.UUID) ([]*models.Role, error)
+	SetUserRoles(ctx context.Context, tenantID, userID uuid.UUID, roleIDs []uuid.UUID) error
+	ListModulePermissions(ctx context.Context) ([]models.Permission, error)
+}
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+func NewRoleRepository(db *sql.DB) RoleRepository {
+	return &roleRepository{db: db}
+}
+
+const roleColumns = `r.id, r.tenant_id, r.name, r.display_name, COALESCE(r.description, ''), r.permissions, r.is_system, r.created_at, r.updated_at`
+
+// ListRoles returns the system roles followed by the tenant's custom roles
+func (r *roleRepository) ListRoles(ctx context.Context, tenantID uuid.UUID) ([]*models.Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles r
+		WHERE r.tenant_id IS NULL OR r.tenant_id = $1
+		ORDER BY r.is_system DESC, r.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRoles(rows)
+}
+
+// GetRole returns a system role or one of the tenant's custom roles
+func (r *roleRepository) GetRole(ctx context.Context, tenantID, id uuid.UUID) (*models.Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles r
+		WHERE r.id = $1 AND (r.tenant_id IS NULL OR r.tenant_id = $2)
+	`
+
+	role, err := scanRole(r.db.QueryRowContext(ctx, query, id, tenantID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("role not found")
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (r *roleRepository) GetSystemRole(ctx context.Context, name string) (*models.Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles r
+		WHERE r.tenant_id IS NULL AND r.name = $1
+	`
+
+	role, err := scanRole(r.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("role not found")
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (r *roleRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	query := `
+		INSERT INTO roles (id, tenant_id, name, display_name, description, permissions, is_system, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, false, $7, $8)
+	`
+
+	permissions, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	role.ID = uuid.New()
+	role.IsSystem = false
+	role.CreatedAt = time.Now()
+	role.UpdatedAt = time.Now()
+
+	_, err = r.db.ExecContext(ctx, query,
+		role.ID,
+		role.TenantID,
+		role.Name,
+		role.DisplayName,
+		role.Description,
+		permissions,
+		role.CreatedAt,
+		role.UpdatedAt,
+	)
+
+	return err
+}
+
+// UpdateRole saves a tenant's custom role. System roles are never updated.
+func (r *roleRepository) UpdateRole(ctx context.Context, role *models.Role) error {
+	query := `
+		UPDATE roles
+		SET display_name = $3, description = $4, permissions = $5, updated_at = $6
+		WHERE id = $1 AND tenant_id = $2 AND is_system = false
+	`
+
+	permissions, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	role.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		role.ID,
+		role.TenantID,
+		role.DisplayName,
+		role.Description,
+		permissions,
+		role.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("role not found")
+	}
+
+	return nil
+}
+
+func (r *roleRepository) DeleteRole(ctx context.Context, tenantID, id uuid.UUID) error {
+	query := `DELETE FROM roles WHERE id = $1 AND tenant_id = $2 AND is_system = false`
+
+	result, err := r.db.ExecContext(ctx, query, id, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("role not found")
+	}
+
+	return nil
+}
+
+// GetUserRoles returns the custom roles of the tenant granted to a user
+func (r *roleRepository) GetUserRoles(ctx context.Context, tenantID, userID uuid.UUID) ([]*models.Role, error) {
+	query := `
+		SELECT ` + roleColumns + `
+		FROM roles r
+		JOIN user_roles ur ON ur.role_id = r.id
+		WHERE ur.user_id = $1 AND r.tenant_id = $2
+		ORDER BY r.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRoles(rows)
+}
+
+// SetUserRoles replaces the custom roles of the tenant granted to a user;
+// roles the user holds in other tenants are kept
+func (r *roleRepository) SetUserRoles(ctx context.Context, tenantID, userID uuid.UUID, roleIDs []uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM user_roles ur
+		USING roles r
+		WHERE r.id = ur.role_id AND ur.user_id = $1 AND r.tenant_id = $2
+	`, userID, tenantID)
+	if err != nil {
+		return err
+	}
+
+	for _, roleID := range roleIDs {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO user_roles (user_id, role_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			userID, roleID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListModulePermissions returns the permissions declared by active modules
+// (modules.permissions), described by tenant-service's module_permissions
+func (r *roleRepository) ListModulePermissions(ctx context.Context) ([]models.Permission, error) {
+	query := `
+		SELECT p.permission, m.name, COALESCE(mp.category, split_part(p.permission, '.', 2)), COALESCE(mp.description, '')
+		FROM modules m
+		CROSS JOIN LATERAL jsonb_array_elements_text(m.permissions::jsonb) AS p(permission)
+		LEFT JOIN module_permissions mp ON mp.module_id = m.id AND mp.permission = p.permission
+		WHERE m.is_active = true
+		ORDER BY m.name, p.permission
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []models.Permission
+	for rows.Next() {
+		var permission models.Permission
+		err := rows.Scan(&permission.Name, &permission.Module, &permission.Category, &permission.Description)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func scanRole(row rowScanner) (*models.Role, error) {
+	role := &models.Role{}
+	var permissions []byte
+	err := row.Scan(
+		&role.ID,
+		&role.TenantID,
+		&role.Name,
+		&role.DisplayName,
+		&role.Description,
+		&permissions,
+		&role.IsSystem,
+		&role.CreatedAt,
+		&role.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(permissions, &role.Permissions); err != nil {
+		return nil, fmt.Errorf("invalid role permissions: %w", err)
+	}
+
+	return role, nil
+}
+
+func scanRoles(rows *sql.Rows) ([]*models.Role, error) {
+	var roles []*models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
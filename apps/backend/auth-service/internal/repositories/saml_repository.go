@@ -0,0 +1,252 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type SAMLRepository interface {
+	GetConnection(ctx context.Context, tenantID uuid.UUID) (*models.SAMLConnection, error)
+	SaveConnection(ctx context.Context, connection *models.SAMLConnection) error
+	DeleteConnection(ctx context.Context, tenantID uuid.UUID) error
+	CreateAuthRequest(ctx context.Context, request *models.SAMLAuthRequest) error
+	ConsumeAuthRequest(ctx context.Context, tenantID uuid.UUID, relayState string) (*models.SAMLAuthRequest, error)
+	ConsumeAssertion(ctx context.Context, tenantID uuid.UUID, assertionID string, expiresAt time.Time) error
+	DeleteExpiredAuthRequests(ctx context.Context) error
+}
+
+type samlRepository struct {
+	db *sql.DB
+}
+
+func NewSAMLRepository(db *sql.DB) SAMLRepository {
+	return &samlRepository{db: db}
+}
+
+func (r *samlRepository) GetConnection(ctx context.Context, tenantID uuid.UUID) (*models.SAMLConnection, error) {
+	query := `
+		SELECT id, tenant_id, idp_entity_id, idp_metadata, sp_private_key, sp_certificate,
+		       attribute_mapping, role_mapping, default_role, jit_provisioning, sso_only,
+		       allow_idp_initiated, allowed_redirect_uris, enabled, created_at, updated_at
+		FROM saml_connections
+		WHERE tenant_id = $1
+	`
+
+	connection := &models.SAMLConnection{}
+	var attributeMapping, roleMapping, allowedRedirectURIs []byte
+	err := r.db.QueryRowContext(ctx, query, tenantID).Scan(
+		&connection.ID,
+		&connection.TenantID,
+		&connection.IdPEntityID,
+		&connection.IdPMetadata,
+		&connection.SPPrivateKey,
+		&connection.SPCertificate,
+		&attributeMapping,
+		&roleMapping,
+		&connection.DefaultRole,
+		&connection.JITProvisioning,
+		&connection.SSOOnly,
+		&connection.AllowIDPInitiated,
+		&allowedRedirectURIs,
+		&connection.Enabled,
+		&connection.CreatedAt,
+		&connection.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("SAML connection not found")
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(attributeMapping, &connection.AttributeMapping); err != nil {
+		return nil, fmt.Errorf("invalid attribute mapping: %w", err)
+	}
+	if err := json.Unmarshal(roleMapping, &connection.RoleMapping); err != nil {
+		return nil, fmt.Errorf("invalid role mapping: %w", err)
+	}
+	if err := json.Unmarshal(allowedRedirectURIs, &connection.AllowedRedirectURIs); err != nil {
+		return nil, fmt.Errorf("invalid allowed redirect URIs: %w", err)
+	}
+
+	return connection, nil
+}
+
+// SaveConnection creates or replaces the tenant's SAML connection
+func (r *samlRepository) SaveConnection(ctx context.Context, connection *models.SAMLConnection) error {
+	query := `
+		INSERT INTO saml_connections (
+			id, tenant_id, idp_entity_id, idp_metadata, sp_private_key, sp_certificate,
+			attribute_mapping, role_mapping, default_role, jit_provisioning, sso_only,
+			allow_idp_initiated, allowed_redirect_uris, enabled, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			idp_entity_id = EXCLUDED.idp_entity_id,
+			idp_metadata = EXCLUDED.idp_metadata,
+			sp_private_key = EXCLUDED.sp_private_key,
+			sp_certificate = EXCLUDED.sp_certificate,
+			attribute_mapping = EXCLUDED.attribute_mapping,
+			role_mapping = EXCLUDED.role_mapping,
+			default_role = EXCLUDED.default_role,
+			jit_provisioning = EXCLUDED.jit_provisioning,
+			sso_only = EXCLUDED.sso_only,
+			allow_idp_initiated = EXCLUDED.allow_idp_initiated,
+			allowed_redirect_uris = EXCLUDED.allowed_redirect_uris,
+			enabled = EXCLUDED.enabled,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at
+	`
+
+	attributeMapping, err := json.Marshal(connection.AttributeMapping)
+	if err != nil {
+		return err
+	}
+	roleMapping, err := json.Marshal(connection.RoleMapping)
+	if err != nil {
+		return err
+	}
+	allowedRedirectURIs, err := json.Marshal(connection.AllowedRedirectURIs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	connection.UpdatedAt = now
+
+	return r.db.QueryRowContext(ctx, query,
+		uuid.New(),
+		connection.TenantID,
+		connection.IdPEntityID,
+		connection.IdPMetadata,
+		connection.SPPrivateKey,
+		connection.SPCertificate,
+		attributeMapping,
+		roleMapping,
+		connection.DefaultRole,
+		connection.JITProvisioning,
+		connection.SSOOnly,
+		connection.AllowIDPInitiated,
+		allowedRedirectURIs,
+		connection.Enabled,
+		now,
+		now,
+	).Scan(&connection.ID, &connection.CreatedAt)
+}
+
+func (r *samlRepository) DeleteConnection(ctx context.Context, tenantID uuid.UUID) error {
+	query := `DELETE FROM saml_connections WHERE tenant_id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("SAML connection not found")
+	}
+
+	return nil
+}
+
+func (r *samlRepository) CreateAuthRequest(ctx context.Context, request *models.SAMLAuthRequest) error {
+	query := `
+		INSERT INTO saml_auth_requests (id, request_id, relay_state, tenant_id, redirect_uri, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	request.ID = uuid.New()
+	request.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		request.ID,
+		request.RequestID,
+		request.RelayState,
+		request.TenantID,
+		request.RedirectURI,
+		request.ExpiresAt,
+		request.CreatedAt,
+	)
+
+	return err
+}
+
+// ConsumeAuthRequest fetches and deletes a pending request in one statement so it can only be used once
+func (r *samlRepository) ConsumeAuthRequest(ctx context.Context, tenantID uuid.UUID, relayState string) (*models.SAMLAuthRequest, error) {
+	query := `
+		DELETE FROM saml_auth_requests
+		WHERE tenant_id = $1 AND relay_state = $2
+		RETURNING id, request_id, relay_state, tenant_id, redirect_uri, expires_at, created_at
+	`
+
+	request := &models.SAMLAuthRequest{}
+	err := r.db.QueryRowContext(ctx, query, tenantID, relayState).Scan(
+		&request.ID,
+		&request.RequestID,
+		&request.RelayState,
+		&request.TenantID,
+		&request.RedirectURI,
+		&request.ExpiresAt,
+		&request.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("authentication request not found")
+		}
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// ConsumeAssertion records an assertion ID until it expires and fails if the
+// tenant has already accepted it
+func (r *samlRepository) ConsumeAssertion(ctx context.Context, tenantID uuid.UUID, assertionID string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO saml_consumed_assertions (tenant_id, assertion_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id, assertion_id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE saml_consumed_assertions.expires_at < NOW()
+	`
+
+	result, err := r.db.ExecContext(ctx, query, tenantID, assertionID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record SAML assertion: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to record SAML assertion: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("SAML assertion has already been used")
+	}
+
+	return nil
+}
+
+// DeleteExpiredAuthRequests purges stale pending requests and the consumed
+// assertions that can no longer be replayed
+func (r *samlRepository) DeleteExpiredAuthRequests(ctx context.Context) error {
+	query := `DELETE FROM saml_auth_requests WHERE expires_at < NOW()`
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	query = `DELETE FROM saml_consumed_assertions WHERE expires_at < NOW()`
+	_, err := r.db.ExecContext(ctx, query)
+	return err
+}
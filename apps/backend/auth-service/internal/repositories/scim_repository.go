@@ -0,0 +1,526 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// SCIMRepository stores SCIM tokens and directory groups, and lists the members of
+// a tenant together with their directory external IDs. Filters are SQL conditions
+// over the aliases u (users), m (tenant_memberships) and i (user_identities) for
+// users, and g (scim_groups) for groups, with placeholders numbered from $2.
+type SCIMRepository interface {
+	CreateToken(ctx context.Context, token *models.SCIMToken) error
+	GetTokenByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error)
+	ListTokens(ctx context.Context, tenantID uuid.UUID) ([]*models.SCIMToken, error)
+	DeleteToken(ctx context.Context, tenantID, id uuid.UUID) error
+	TouchToken(ctx context.Context, id uuid.UUID) error
+
+	ListUsers(ctx context.Context, tenantID uuid.UUID, filter string, args []interface{}, offset, limit int) ([]*models.SCIMUserRecord, int, error)
+	GetUser(ctx context.Context, tenantID, userID uuid.UUID) (*models.SCIMUserRecord, error)
+	SetExternalID(ctx context.Context, tenantID, userID uuid.UUID, email string, externalID *string) error
+
+	ListGroups(ctx context.Context, tenantID uuid.UUID, filter string, args []interface{}, offset, limit int) ([]*models.SCIMGroup, int, error)
+	GetGroup(ctx context.Context, tenantID, id uuid.UUID) (*models.SCIMGroup, error)
+	GetGroupByName(ctx context.Context, tenantID uuid.UUID, displayName string) (*models.SCIMGroup, error)
+	CreateGroup(ctx context.Context, group *models.SCIMGroup) error
+	UpdateGroup(ctx context.Context, group *models.SCIMGroup) error
+	DeleteGroup(ctx context.Context, tenantID, id uuid.UUID) error
+	GetUserGroups(ctx context.Context, tenantID, userID uuid.UUID) ([]*models.SCIMGroup, error)
+}
+
+type scimRepository struct {
+	db *sql.DB
+}
+
+func NewSCIMRepository(db *sql.DB) SCIMRepository {
+	return &scimRepository{db: db}
+}
+
+func (r *scimRepository) CreateToken(ctx context.Context, token *models.SCIMToken) error {
+	query := `
+		INSERT INTO scim_tokens (id, tenant_id, name, token_hash, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		token.ID,
+		token.TenantID,
+		token.Name,
+		token.TokenHash,
+		token.CreatedBy,
+		token.CreatedAt,
+	)
+
+	return err
+}
+
+func (r *scimRepository) GetTokenByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error) {
+	query := `
+		SELECT id, tenant_id, name, token_hash, created_by, last_used_at, created_at
+		FROM scim_tokens
+		WHERE token_hash = $1
+	`
+
+	token := &models.SCIMToken{}
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.TenantID,
+		&token.Name,
+		&token.TokenHash,
+		&token.CreatedBy,
+		&token.LastUsedAt,
+		&token.CreatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("SCIM token not found")
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (r *scimRepository) ListTokens(ctx context.Context, tenantID uuid.UUID) ([]*models.SCIMToken, error) {
+	query := `
+		SELECT id, tenant_id, name, token_hash, created_by, last_used_at, created_at
+		FROM scim_tokens
+		WHERE tenant_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.SCIMToken
+	for rows.Next() {
+		token := &models.SCIMToken{}
+		err := rows.Scan(
+			&token.ID,
+			&token.TenantID,
+			&token.Name,
+			&token.TokenHash,
+			&token.CreatedBy,
+			&token.LastUsedAt,
+			&token.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (r *scimRepository) DeleteToken(ctx context.Context, tenantID, id uuid.UUID) error {
+	query := `DELETE FROM scim_tokens WHERE id = $1 AND tenant_id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, id, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("SCIM token not found")
+	}
+
+	return nil
+}
+
+func (r *scimRepository) TouchToken(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE scim_tokens SET last_used_at = $1 WHERE id = $2`
+	_, err := r.db.ExecContext(ctx, query, time.Now(), id)
+	return err
+}
+
+// scimUserFrom selects the tenant's members; like memberSelect, TenantID,
+// Role and the active status come from the membership
+const scimUserFrom = `
+	FROM users u
+	JOIN tenant_memberships m ON m.user_id = u.id
+	LEFT JOIN user_identities i ON i.user_id = u.id AND i.tenant_id = m.tenant_id AND i.provider = '` + models.SCIMProvider + `'
+	WHERE m.tenant_id = $1
+`
+
+const scimUserSelect = `
+	SELECT u.id, m.tenant_id, u.email, u.first_name, u.last_name, m.role,
+	       u.is_active AND m.is_active, u.is_verified, u.last_login_at, u.created_at, u.updated_at, i.subject
+`
+
+func (r *scimRepository) ListUsers(ctx context.Context, tenantID uuid.UUID, filter string, args []interface{}, offset, limit int) ([]*models.SCIMUserRecord, int, error) {
+	where := scimUserFrom
+	if filter != "" {
+		where += " AND " + filter
+	}
+	queryArgs := append([]interface{}{tenantID}, args...)
+
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) "+where, queryArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf("%s %s ORDER BY u.created_at, u.id LIMIT $%d OFFSET $%d",
+		scimUserSelect, where, len(queryArgs)+1, len(queryArgs)+2)
+
+	rows, err := r.db.QueryContext(ctx, query, append(queryArgs, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*models.SCIMUserRecord
+	for rows.Next() {
+		user, err := scanSCIMUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+func (r *scimRepository) GetUser(ctx context.Context, tenantID, userID uuid.UUID) (*models.SCIMUserRecord, error) {
+	query := scimUserSelect + scimUserFrom + " AND u.id = $2"
+
+	user, err := scanSCIMUser(r.db.QueryRowContext(ctx, query, tenantID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// SetExternalID replaces the user's directory external ID; nil removes it
+func (r *scimRepository) SetExternalID(ctx context.Context, tenantID, userID uuid.UUID, email string, externalID *string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND tenant_id = $2 AND provider = $3`, userID, tenantID, models.SCIMProvider)
+	if err != nil {
+		return err
+	}
+
+	if externalID != nil && *externalID != "" {
+		query := `
+			INSERT INTO user_identities (id, user_id, tenant_id, provider, subject, email, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+		_, err = tx.ExecContext(ctx, query, uuid.New(), userID, tenantID, models.SCIMProvider, *externalID, email, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSCIMUser(row rowScanner) (*models.SCIMUserRecord, error) {
+	user := &models.SCIMUserRecord{}
+	err := row.Scan(
+		&user.ID,
+		&user.TenantID,
+		&user.Email,
+		&user.FirstName,
+		&user.LastName,
+		&user.Role,
+		&user.IsActive,
+		&user.IsVerified,
+		&user.LastLoginAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.ExternalID,
+	)
+	return user, err
+}
+
+func (r *scimRepository) ListGroups(ctx context.Context, tenantID uuid.UUID, filter string, args []interface{}, offset, limit int) ([]*models.SCIMGroup, int, error) {
+	where := " FROM scim_groups g WHERE g.tenant_id = $1"
+	if filter != "" {
+		where += " AND " + filter
+	}
+	queryArgs := append([]interface{}{tenantID}, args...)
+
+	var total int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*)"+where, queryArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT g.id, g.tenant_id, g.display_name, g.external_id, g.role, g.created_at, g.updated_at
+		%s ORDER BY g.created_at, g.id LIMIT $%d OFFSET $%d`,
+		where, len(queryArgs)+1, len(queryArgs)+2)
+
+	groups, err := r.queryGroups(ctx, query, append(queryArgs, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, group := range groups {
+		group.MemberIDs, err = r.getMemberIDs(ctx, group.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return groups, total, nil
+}
+
+func (r *scimRepository) GetGroup(ctx context.Context, tenantID, id uuid.UUID) (*models.SCIMGroup, error) {
+	query := `
+		SELECT id, tenant_id, display_name, external_id, role, created_at, updated_at
+		FROM scim_groups
+		WHERE tenant_id = $1 AND id = $2
+	`
+
+	groups, err := r.queryGroups(ctx, query, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("group not found")
+	}
+
+	group := groups[0]
+	group.MemberIDs, err = r.getMemberIDs(ctx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return group, nil
+}
+
+// GetGroupByName finds a group by display name, ignoring case. Members are not loaded.
+func (r *scimRepository) GetGroupByName(ctx context.Context, tenantID uuid.UUID, displayName string) (*models.SCIMGroup, error) {
+	query := `
+		SELECT id, tenant_id, display_name, external_id, role, created_at, updated_at
+		FROM scim_groups
+		WHERE tenant_id = $1 AND LOWER(display_name) = LOWER($2)
+	`
+
+	groups, err := r.queryGroups(ctx, query, tenantID, displayName)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("group not found")
+	}
+
+	return groups[0], nil
+}
+
+func (r *scimRepository) CreateGroup(ctx context.Context, group *models.SCIMGroup) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO scim_groups (id, tenant_id, display_name, external_id, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	now := time.Now()
+	group.ID = uuid.New()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+
+	_, err = tx.ExecContext(ctx, query,
+		group.ID,
+		group.TenantID,
+		group.DisplayName,
+		group.ExternalID,
+		group.Role,
+		group.CreatedAt,
+		group.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = insertGroupMembers(ctx, tx, group)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateGroup saves the group attributes and replaces its members
+func (r *scimRepository) UpdateGroup(ctx context.Context, group *models.SCIMGroup) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE scim_groups
+		SET display_name = $3, external_id = $4, role = $5, updated_at = $6
+		WHERE tenant_id = $1 AND id = $2
+	`
+
+	group.UpdatedAt = time.Now()
+
+	result, err := tx.ExecContext(ctx, query,
+		group.TenantID,
+		group.ID,
+		group.DisplayName,
+		group.ExternalID,
+		group.Role,
+		group.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("group not found")
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM scim_group_members WHERE group_id = $1`, group.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertGroupMembers(ctx, tx, group)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *scimRepository) DeleteGroup(ctx context.Context, tenantID, id uuid.UUID) error {
+	query := `DELETE FROM scim_groups WHERE tenant_id = $1 AND id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("group not found")
+	}
+
+	return nil
+}
+
+func (r *scimRepository) GetUserGroups(ctx context.Context, tenantID, userID uuid.UUID) ([]*models.SCIMGroup, error) {
+	query := `
+		SELECT g.id, g.tenant_id, g.display_name, g.external_id, g.role, g.created_at, g.updated_at
+		FROM scim_groups g
+		JOIN scim_group_members m ON m.group_id = g.id
+		WHERE g.tenant_id = $1 AND m.user_id = $2
+		ORDER BY g.display_name
+	`
+
+	return r.queryGroups(ctx, query, tenantID, userID)
+}
+
+func (r *scimRepository) queryGroups(ctx context.Context, query string, args ...interface{}) ([]*models.SCIMGroup, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*models.SCIMGroup
+	for rows.Next() {
+		group := &models.SCIMGroup{}
+		err := rows.Scan(
+			&group.ID,
+			&group.TenantID,
+			&group.DisplayName,
+			&group.ExternalID,
+			&group.Role,
+			&group.CreatedAt,
+			&group.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+func (r *scimRepository) getMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT user_id FROM scim_group_members WHERE group_id = $1 ORDER BY created_at`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberIDs []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		memberIDs = append(memberIDs, id)
+	}
+
+	return memberIDs, rows.Err()
+}
+
+// insertGroupMembers adds the group's members, skipping users of other tenants
+func insertGroupMembers(ctx context.Context, tx *sql.Tx, group *models.SCIMGroup) error {
+	query := `
+		INSERT INTO scim_group_members (group_id, user_id)
+		SELECT $1, id FROM users WHERE id = $2 AND tenant_id = $3
+		ON CONFLICT DO NOTHING
+	`
+
+	for _, userID := range group.MemberIDs {
+		_, err := tx.ExecContext(ctx, query, group.ID, userID, group.TenantID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
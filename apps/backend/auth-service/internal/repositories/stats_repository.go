@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// StatsRepository computes user statistics for the admin dashboard
+type StatsRepository interface {
+	// CountUsers returns the number of users and of active users
+	CountUsers(ctx context.Context) (total int, active int, err error)
+	CountUsersCreatedBetween(ctx context.Context, from, to time.Time) (int, error)
+	RecentSignups(ctx context.Context, limit int) ([]*models.User, error)
+}
+
+type statsRepository struct {
+	db *sql.DB
+}
+
+func NewStatsRepository(db *sql.DB) StatsRepository {
+	return &statsRepository{db: db}
+}
+
+func (r *statsRepository) CountUsers(ctx context.Context) (int, int, error) {
+	var total, active int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE is_active)
+		FROM users
+	`).Scan(&total, &active)
+	return total, active, err
+}
+
+func (r *statsRepository) CountUsersCreatedBetween(ctx context.Context, from, to time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE created_at >= $1 AND created_at < $2`, from, to).Scan(&count)
+	return count, err
+}
+
+func (r *statsRepository) RecentSignups(ctx context.Context, limit int) ([]*models.User, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, tenant_id, email, first_name, last_name, role, is_active, is_verified, created_at
+		FROM users
+		ORDER BY created_at DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.TenantID,
+			&user.Email,
+			&user.FirstName,
+			&user.LastName,
+			&user.Role,
+			&user.IsActive,
+			&user.IsVerified,
+			&user.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+const statsCacheKeyPrefix = "auth:stats:"
+
+// StatsCache keeps computed statistics for a short time so dashboards that
+// poll do not recompute them on every request
+type StatsCache interface {
+	// Get decodes the cached value into dest and reports whether there was one
+	Get(ctx context.Context, key string, dest interface{}) (bool, error)
+	Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error
+}
+
+type statsCache struct {
+	redis *redis.Client
+}
+
+func NewStatsCache(redis *redis.Client) StatsCache {
+	return &statsCache{redis: redis}
+}
+
+func (c *statsCache) Get(ctx context.Context, key string, dest interface{}) (bool, error) {
+	data, err := c.redis.Get(ctx, statsCacheKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, dest)
+}
+
+func (c *statsCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return c.redis.Set(ctx, statsCacheKeyPrefix+key, data, ttl).Err()
+}
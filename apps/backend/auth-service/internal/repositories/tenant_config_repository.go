@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type TenantConfigRepository interface {
+	GetByTenantID(ctx context.Context, tenantID uuid.UUID) (*models.TenantConfiguration, error)
+}
+
+type tenantConfigRepository struct {
+	db *sql.DB
+}
+
+func NewTenantConfigRepository(db *sql.DB) TenantConfigRepository {
+	return &tenantConfigRepository{db: db}
+}
+
+func (r *tenantConfigRepository) GetByTenantID(ctx context.Context, tenantID uuid.UUID) (*models.TenantConfiguration, error) {
+	query := `
+		SELECT tenant_id, integration_config, COALESCE(password_policy, '{}'), security_config, COALESCE(allowed_ips::text, ''),
+		       COALESCE(branding_config, '{}'), COALESCE(custom_domain, '')
+		FROM tenant_configurations
+		WHERE tenant_id = $1
+	`
+
+	config := &models.TenantConfiguration{}
+	err := r.db.QueryRowContext(ctx, query, tenantID).Scan(
+		&config.TenantID,
+		&config.IntegrationConfig,
+		&config.PasswordPolicy,
+		&config.SecurityConfig,
+		&config.AllowedIPs,
+		&config.BrandingConfig,
+		&config.CustomDomain,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("tenant configuration not found")
+		}
+		return nil, err
+	}
+
+	return config, nil
+}
@@ -16,9 +16,17 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByEmailAndTenant(ctx context.Context, email string, tenantID uuid.UUID) (*models.User, error)
+	GetByIDAndTenant(ctx context.Context, id, tenantID uuid.UUID) (*models.User, error)
 	Update(ctx context.Context, user *models.User) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	// DeleteFromTenant removes the user from a tenant, deleting the user
+	// only when they belong to no other tenant
+	DeleteFromTenant(ctx context.Context, id, tenantID uuid.UUID) error
 	UpdateLastLogin(ctx context.Context, userID uuid.UUID) error
+	UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error
+	GetLanguage(ctx context.Context, userID uuid.UUID) (string, error)
+	// ListTenantAdmins returns the active admins of a tenant as its members
+	ListTenantAdmins(ctx context.Context, tenantID uuid.UUID) ([]*models.User, error)
 }
 
 type userRepository struct {
@@ -31,18 +39,25 @@ func NewUserRepository(db *sql.DB) UserRepository {
 
 func (r *userRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (id, tenant_id, email, password_hash, first_name, last_name, role, is_active, is_verified, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO users (id, tenant_id, email, password_hash, first_name, last_name, role, is_active, is_verified, created_at, updated_at, password_changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $10)
 	`
 
 	now := time.Now()
 	user.ID = uuid.New()
 	user.CreatedAt = now
 	user.UpdatedAt = now
+	user.PasswordChangedAt = now
 	user.IsActive = true
 	user.IsVerified = false
 
-	_, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query,
 		user.ID,
 		user.TenantID,
 		user.Email,
@@ -55,14 +70,26 @@ func (r *userRepository) Create(ctx context.Context, user *models.User) error {
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Every user is a member of their home tenant
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO tenant_memberships (user_id, tenant_id, role, created_at) VALUES ($1, $2, $3, $4)`,
+		user.ID, user.TenantID, user.Role, user.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	query := `
 		SELECT id, tenant_id, email, password_hash, first_name, last_name, role, 
-			   is_active, is_verified, last_login_at, created_at, updated_at
+			   is_active, is_verified, last_login_at, created_at, updated_at, password_changed_at
 		FROM users 
 		WHERE id = $1
 	`
@@ -81,6 +108,7 @@ func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 		&user.LastLoginAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.PasswordChangedAt,
 	)
 
 	if err != nil {
@@ -96,9 +124,11 @@ func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
 		SELECT id, tenant_id, email, password_hash, first_name, last_name, role, 
-			   is_active, is_verified, last_login_at, created_at, updated_at
+			   is_active, is_verified, last_login_at, created_at, updated_at, password_changed_at
 		FROM users 
 		WHERE email = $1
+		ORDER BY created_at
+		LIMIT 1
 	`
 
 	user := &models.User{}
@@ -115,6 +145,7 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.
 		&user.LastLoginAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.PasswordChangedAt,
 	)
 
 	if err != nil {
@@ -127,16 +158,68 @@ func (r *userRepository) GetByEmail(ctx context.Context, email string) (*models.
 	return user, nil
 }
 
+// memberSelect selects a user as a member of one tenant: TenantID and Role
+// come from the membership, and an inactive membership makes the user
+// inactive in that tenant
+const memberSelect = `
+	SELECT u.id, m.tenant_id, u.email, u.password_hash, u.first_name, u.last_name, m.role,
+		   u.is_active AND m.is_active, u.is_verified, u.last_login_at, u.created_at, u.updated_at, u.password_changed_at
+	FROM users u
+	JOIN tenant_memberships m ON m.user_id = u.id
+`
+
 func (r *userRepository) GetByEmailAndTenant(ctx context.Context, email string, tenantID uuid.UUID) (*models.User, error) {
-	query := `
-		SELECT id, tenant_id, email, password_hash, first_name, last_name, role, 
-			   is_active, is_verified, last_login_at, created_at, updated_at
-		FROM users 
-		WHERE email = $1 AND tenant_id = $2
+	return r.getMember(ctx, memberSelect+` WHERE u.email = $1 AND m.tenant_id = $2 ORDER BY u.created_at LIMIT 1`, email, tenantID)
+}
+
+// GetByIDAndTenant returns the user as a member of the tenant, or an error
+// when the user does not belong to it
+func (r *userRepository) GetByIDAndTenant(ctx context.Context, id, tenantID uuid.UUID) (*models.User, error) {
+	return r.getMember(ctx, memberSelect+` WHERE u.id = $1 AND m.tenant_id = $2`, id, tenantID)
+}
+
+func (r *userRepository) ListTenantAdmins(ctx context.Context, tenantID uuid.UUID) ([]*models.User, error) {
+	query := memberSelect + `
+		WHERE m.tenant_id = $1 AND m.role = $2 AND u.is_active AND m.is_active
+		ORDER BY u.created_at
 	`
 
+	rows, err := r.db.QueryContext(ctx, query, tenantID, models.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		user := &models.User{}
+		err := rows.Scan(
+			&user.ID,
+			&user.TenantID,
+			&user.Email,
+			&user.Password,
+			&user.FirstName,
+			&user.LastName,
+			&user.Role,
+			&user.IsActive,
+			&user.IsVerified,
+			&user.LastLoginAt,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&user.PasswordChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+func (r *userRepository) getMember(ctx context.Context, query string, args ...interface{}) (*models.User, error) {
 	user := &models.User{}
-	err := r.db.QueryRowContext(ctx, query, email, tenantID).Scan(
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
 		&user.ID,
 		&user.TenantID,
 		&user.Email,
@@ -149,6 +232,7 @@ func (r *userRepository) GetByEmailAndTenant(ctx context.Context, email string,
 		&user.LastLoginAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.PasswordChangedAt,
 	)
 
 	if err != nil {
@@ -161,17 +245,27 @@ func (r *userRepository) GetByEmailAndTenant(ctx context.Context, email string,
 	return user, nil
 }
 
+// Update saves the user's role and status on the membership of
+// user.TenantID. The identity itself (profile, email, account status and home
+// role) is only saved when that is the home tenant, so another tenant cannot
+// rename or disable a user it shares.
 func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users 
 		SET first_name = $2, last_name = $3, role = $4, is_active = $5, 
-			is_verified = $6, updated_at = $7
-		WHERE id = $1
+			is_verified = $6, updated_at = $7, email = $8
+		WHERE id = $1 AND tenant_id = $9
 	`
 
 	user.UpdatedAt = time.Now()
 
-	_, err := r.db.ExecContext(ctx, query,
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, query,
 		user.ID,
 		user.FirstName,
 		user.LastName,
@@ -179,9 +273,22 @@ func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 		user.IsActive,
 		user.IsVerified,
 		user.UpdatedAt,
+		user.Email,
+		user.TenantID,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	_, err = tx.ExecContext(ctx,
+		`UPDATE tenant_memberships SET role = $3, is_active = $4 WHERE user_id = $1 AND tenant_id = $2`,
+		user.ID, user.TenantID, user.Role, user.IsActive,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
@@ -190,9 +297,80 @@ func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+// DeleteFromTenant draws the same line as the erasure of personal data: a
+// user only loses the membership and the records scoped to this tenant when
+// it is not their home tenant or they are an active member of other tenants,
+// and a removed home tenant moves to the oldest remaining membership
+func (r *userRepository) DeleteFromTenant(ctx context.Context, id, tenantID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var isHome bool
+	var otherTenants int
+	err = tx.QueryRowContext(ctx, `
+		SELECT u.tenant_id = $2,
+			(SELECT COUNT(*) FROM tenant_memberships WHERE user_id = $1 AND tenant_id <> $2 AND is_active = true)
+		FROM users u WHERE u.id = $1
+	`, id, tenantID).Scan(&isHome, &otherTenants)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if isHome && otherTenants == 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	for _, query := range []string{
+		`DELETE FROM user_roles WHERE user_id = $1 AND role_id IN (SELECT id FROM roles WHERE tenant_id = $2)`,
+		`DELETE FROM user_identities WHERE user_id = $1 AND tenant_id = $2`,
+		`DELETE FROM scim_group_members WHERE user_id = $1 AND group_id IN (SELECT id FROM scim_groups WHERE tenant_id = $2)`,
+		`DELETE FROM tenant_memberships WHERE user_id = $1 AND tenant_id = $2`,
+		`UPDATE users u SET tenant_id = m.tenant_id, role = m.role
+		FROM (
+			SELECT tenant_id, role FROM tenant_memberships
+			WHERE user_id = $1 AND is_active = true
+			ORDER BY created_at LIMIT 1
+		) m
+		WHERE u.id = $1 AND u.tenant_id = $2`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, id, tenantID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (r *userRepository) UpdateLastLogin(ctx context.Context, userID uuid.UUID) error {
 	query := `UPDATE users SET last_login_at = $1 WHERE id = $2`
 	now := time.Now()
 	_, err := r.db.ExecContext(ctx, query, now, userID)
 	return err
 }
+
+// UpdatePassword sets a new password hash and restarts the password's age
+func (r *userRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $1, password_changed_at = $2, updated_at = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, passwordHash, time.Now(), userID)
+	return err
+}
+
+// GetLanguage returns the language from the user's profile, or an empty
+// string when the user has no profile
+func (r *userRepository) GetLanguage(ctx context.Context, userID uuid.UUID) (string, error) {
+	var language string
+	err := r.db.QueryRowContext(ctx, `SELECT language FROM user_profiles WHERE user_id = $1`, userID).Scan(&language)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return language, err
+}
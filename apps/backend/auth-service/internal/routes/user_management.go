@@ -2,6 +2,7 @@ package routes
 
 import (
 	"zplus-saas/apps/backend/auth-service/internal/handlers"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -20,9 +21,9 @@ func SetupUserManagementRoutes(app *fiber.App, handler *handlers.UserManagementH
 
 	// Password management routes
 	password := api.Group("/password")
-	password.Post("/reset/request", handler.RequestPasswordReset) // POST /api/password/reset/request
-	password.Post("/reset/confirm", handler.ResetPassword)        // POST /api/password/reset/confirm
-	password.Post("/change", handler.ChangePassword)              // POST /api/password/change (authenticated)
+	password.Post("/reset/request", handler.RequestPasswordReset)                            // POST /api/password/reset/request
+	password.Post("/reset/confirm", handler.ResetPassword)                                   // POST /api/password/reset/confirm
+	password.Post("/change", sharedmiddleware.RejectImpersonation(), handler.ChangePassword) // POST /api/password/change (authenticated, not while impersonating)
 
 	// Email verification routes
 	email := api.Group("/email")
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+)
+
+const (
+	// DefaultStatsPeriod is used when the dashboard does not pick a period
+	DefaultStatsPeriod = "30d"
+	// statsCacheTTL keeps polling dashboards cheap while figures stay fresh
+	statsCacheTTL = time.Minute
+	// statsRevenueCurrency is the plans' default currency, reported as
+	// totalRevenue
+	statsRevenueCurrency = "USD"
+	recentSignupsLimit   = 10
+	maxStatsPeriodDays   = 365
+)
+
+// ErrInvalidStatsPeriod is returned for periods that are not 1d to 365d
+var ErrInvalidStatsPeriod = errors.New("invalid period")
+
+// AdminStatsService computes the platform admin dashboard figures: tenants
+// and revenue from tenant-service, users from the users table. Results are
+// cached per period for a minute.
+type AdminStatsService interface {
+	// GetStats returns the figures for a period such as "7d" or "30d".
+	// Growth compares the period with the one of equal length before it.
+	GetStats(ctx context.Context, period string) (*models.AdminStats, error)
+}
+
+type adminStatsService struct {
+	statsRepo    repositories.StatsRepository
+	cache        repositories.StatsCache
+	tenantClient TenantClient
+	now          func() time.Time
+}
+
+func NewAdminStatsService(statsRepo repositories.StatsRepository, cache repositories.StatsCache, tenantClient TenantClient) AdminStatsService {
+	return &adminStatsService{
+		statsRepo:    statsRepo,
+		cache:        cache,
+		tenantClient: tenantClient,
+		now:          time.Now,
+	}
+}
+
+func (s *adminStatsService) GetStats(ctx context.Context, period string) (*models.AdminStats, error) {
+	if period == "" {
+		period = DefaultStatsPeriod
+	}
+	days, err := parseStatsPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	period = strconv.Itoa(days) + "d"
+
+	cacheKey := "admin:" + period
+	var cached models.AdminStats
+	if ok, err := s.cache.Get(ctx, cacheKey, &cached); err != nil {
+		log.Printf("Failed to read cached admin stats: %v", err)
+	} else if ok {
+		return &cached, nil
+	}
+
+	now := s.now()
+	since := now.AddDate(0, 0, -days)
+	stats := &models.AdminStats{
+		Period:          period,
+		TenantsByStatus: map[string]int{},
+		RevenueCurrency: statsRevenueCurrency,
+		Revenue:         []*models.SubscriptionRevenue{},
+		GeneratedAt:     now,
+	}
+
+	if stats.TotalUsers, stats.ActiveUsers, err = s.statsRepo.CountUsers(ctx); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if stats.NewUsers, err = s.statsRepo.CountUsersCreatedBetween(ctx, since, now); err != nil {
+		return nil, fmt.Errorf("failed to count new users: %w", err)
+	}
+	previousNewUsers, err := s.statsRepo.CountUsersCreatedBetween(ctx, since.AddDate(0, 0, -days), since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count new users: %w", err)
+	}
+	if stats.RecentSignups, err = s.statsRepo.RecentSignups(ctx, recentSignupsLimit); err != nil {
+		return nil, fmt.Errorf("failed to list recent signups: %w", err)
+	}
+	if stats.RecentSignups == nil {
+		stats.RecentSignups = []*models.User{}
+	}
+	stats.Growth.Users = growthPercent(float64(stats.NewUsers), float64(previousNewUsers))
+
+	// User figures are still worth showing when tenant-service is down
+	tenants, err := s.tenantClient.GetStats(ctx, days)
+	if err != nil {
+		log.Printf("Admin stats without tenant figures: %v", err)
+		stats.Partial = true
+		return stats, nil
+	}
+
+	stats.TotalTenants = tenants.TotalTenants
+	stats.NewTenants = tenants.NewTenants
+	stats.ActiveSubscriptions = tenants.ActiveSubscriptions
+	stats.TrialSubscriptions = tenants.TrialSubscriptions
+	stats.Growth.Tenants = growthPercent(float64(tenants.NewTenants), float64(tenants.PreviousNewTenants))
+	if tenants.TenantsByStatus != nil {
+		stats.TenantsByStatus = tenants.TenantsByStatus
+	}
+	if tenants.Revenue != nil {
+		stats.Revenue = tenants.Revenue
+	}
+	for _, revenue := range stats.Revenue {
+		if revenue.Currency == statsRevenueCurrency {
+			stats.MRR = revenue.MRR
+			stats.ARR = revenue.ARR
+			stats.TotalRevenue = revenue.MRR
+			stats.Growth.Revenue = growthPercent(revenue.MRR, revenue.PreviousMRR)
+		}
+	}
+
+	if err := s.cache.Set(ctx, cacheKey, stats, statsCacheTTL); err != nil {
+		log.Printf("Failed to cache admin stats: %v", err)
+	}
+
+	return stats, nil
+}
+
+// parseStatsPeriod reads a period of whole days, such as "7d" or "90d"
+func parseStatsPeriod(period string) (int, error) {
+	days, err := strconv.Atoi(strings.TrimSuffix(period, "d"))
+	if err != nil || !strings.HasSuffix(period, "d") || days < 1 || days > maxStatsPeriodDays {
+		return 0, fmt.Errorf("%w %q: use a number of days such as 7d, 30d or 90d (at most %dd)", ErrInvalidStatsPeriod, period, maxStatsPeriodDays)
+	}
+
+	return days, nil
+}
+
+// growthPercent returns the change from previous to current in percent,
+// rounded to one decimal. Growth from nothing counts as 100%.
+func growthPercent(current, previous float64) float64 {
+	if previous == 0 {
+		if current == 0 {
+			return 0
+		}
+		return 100
+	}
+
+	change := (current - previous) / previous * 100
+	return math.Round(change*10) / 10
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminStatsCombinesUsersTenantsAndRevenue(t *testing.T) {
+	now := time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC)
+	statsRepo := &fakeStatsRepository{total: 120, active: 100}
+	statsRepo.createdAt = append(statsRepo.createdAt,
+		now.AddDate(0, 0, -1), now.AddDate(0, 0, -3), now.AddDate(0, 0, -6), // this week
+		now.AddDate(0, 0, -9), now.AddDate(0, 0, -12), // the week before
+		now.AddDate(0, 0, -40),
+	)
+	tenants := &fakeTenantClient{stats: &models.TenantStats{
+		TotalTenants:        12,
+		TenantsByStatus:     map[string]int{"active": 9, "trial": 2, "suspended": 1},
+		NewTenants:          3,
+		PreviousNewTenants:  2,
+		ActiveSubscriptions: 8,
+		TrialSubscriptions:  2,
+		Revenue: []*models.SubscriptionRevenue{
+			{Currency: "EUR", Subscriptions: 1, MRR: 50, ARR: 600},
+			{Currency: "USD", Subscriptions: 7, MRR: 1100, ARR: 13200, PreviousMRR: 1000},
+		},
+	}}
+	svc := NewAdminStatsService(statsRepo, newFakeStatsCache(), tenants).(*adminStatsService)
+	svc.now = func() time.Time { return now }
+
+	stats, err := svc.GetStats(context.Background(), "7d")
+	require.NoError(t, err)
+	assert.Equal(t, "7d", stats.Period)
+	assert.False(t, stats.Partial)
+	assert.Equal(t, 120, stats.TotalUsers)
+	assert.Equal(t, 100, stats.ActiveUsers)
+	assert.Equal(t, 3, stats.NewUsers)
+	assert.Equal(t, 12, stats.TotalTenants)
+	assert.Equal(t, 1, stats.TenantsByStatus["suspended"])
+	assert.Equal(t, 8, stats.ActiveSubscriptions)
+	assert.Equal(t, 1100.0, stats.TotalRevenue)
+	assert.Equal(t, 1100.0, stats.MRR)
+	assert.Equal(t, 13200.0, stats.ARR)
+	assert.Len(t, stats.Revenue, 2)
+	assert.Equal(t, 50.0, stats.Growth.Users)
+	assert.Equal(t, 50.0, stats.Growth.Tenants)
+	assert.Equal(t, 10.0, stats.Growth.Revenue)
+	assert.Equal(t, 7, tenants.days)
+}
+
+func TestAdminStatsAreCachedPerPeriod(t *testing.T) {
+	tenants := &fakeTenantClient{stats: &models.TenantStats{TotalTenants: 4}}
+	cache := newFakeStatsCache()
+	svc := NewAdminStatsService(&fakeStatsRepository{}, cache, tenants)
+	ctx := context.Background()
+
+	_, err := svc.GetStats(ctx, "")
+	require.NoError(t, err)
+	tenants.stats.TotalTenants = 5
+
+	// Same period from the cache, another period computed afresh
+	stats, err := svc.GetStats(ctx, "30d")
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.TotalTenants)
+	assert.Equal(t, 1, tenants.calls)
+
+	stats, err = svc.GetStats(ctx, "90d")
+	require.NoError(t, err)
+	assert.Equal(t, 5, stats.TotalTenants)
+	assert.Equal(t, 2, tenants.calls)
+}
+
+func TestAdminStatsWithoutTenantServiceArePartialAndNotCached(t *testing.T) {
+	tenants := &fakeTenantClient{err: errors.New("connection refused")}
+	cache := newFakeStatsCache()
+	svc := NewAdminStatsService(&fakeStatsRepository{total: 3, active: 3}, cache, tenants)
+
+	stats, err := svc.GetStats(context.Background(), "30d")
+	require.NoError(t, err)
+	assert.True(t, stats.Partial)
+	assert.Equal(t, 3, stats.TotalUsers)
+	assert.Empty(t, cache.entries)
+}
+
+func TestAdminStatsRejectsInvalidPeriods(t *testing.T) {
+	svc := NewAdminStatsService(&fakeStatsRepository{}, newFakeStatsCache(), &fakeTenantClient{})
+
+	for _, period := range []string{"0d", "366d", "30", "1w", "-7d", "d"} {
+		_, err := svc.GetStats(context.Background(), period)
+		assert.ErrorIs(t, err, ErrInvalidStatsPeriod, period)
+	}
+}
+
+func TestGrowthPercent(t *testing.T) {
+	assert.Equal(t, 0.0, growthPercent(0, 0))
+	assert.Equal(t, 100.0, growthPercent(5, 0))
+	assert.Equal(t, -50.0, growthPercent(1, 2))
+	assert.Equal(t, 33.3, growthPercent(4, 3))
+}
+
+type fakeStatsRepository struct {
+	total     int
+	active    int
+	createdAt []time.Time
+}
+
+func (r *fakeStatsRepository) CountUsers(ctx context.Context) (int, int, error) {
+	return r.total, r.active, nil
+}
+
+func (r *fakeStatsRepository) CountUsersCreatedBetween(ctx context.Context, from, to time.Time) (int, error) {
+	count := 0
+	for _, createdAt := range r.createdAt {
+		if !createdAt.Before(from) && createdAt.Before(to) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *fakeStatsRepository) RecentSignups(ctx context.Context, limit int) ([]*models.User, error) {
+	var users []*models.User
+	for i := 0; i < len(r.createdAt) && i < limit; i++ {
+		users = append(users, &models.User{ID: uuid.New(), CreatedAt: r.createdAt[i]})
+	}
+	return users, nil
+}
+
+type fakeStatsCache struct {
+	entries map[string][]byte
+}
+
+func newFakeStatsCache() *fakeStatsCache {
+	return &fakeStatsCache{entries: make(map[string][]byte)}
+}
+
+func (c *fakeStatsCache) Get(ctx context.Context, key string, dest interface{}) (bool, error) {
+	data, ok := c.entries[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, dest)
+}
+
+func (c *fakeStatsCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	c.entries[key] = data
+	return nil
+}
+
+type fakeTenantClient struct {
+	stats     *models.TenantStats
+	err       error
+	days      int
+	calls     int
+	provision func(req *models.ProvisionTenantRequest) (*models.TenantProvisioning, error)
+	// quota answers quota checks; without it everything is allowed
+	quota *models.QuotaCheck
+}
+
+func (c *fakeTenantClient) GetStats(ctx context.Context, days int) (*models.TenantStats, error) {
+	c.days = days
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	copied := *c.stats
+	return &copied, nil
+}
+
+func (c *fakeTenantClient) Provision(ctx context.Context, req *models.ProvisionTenantRequest) (*models.TenantProvisioning, error) {
+	if c.provision == nil {
+		return nil, errors.New("failed to create organization: tenant-service unavailable")
+	}
+	return c.provision(req)
+}
+
+func (c *fakeTenantClient) CheckQuota(ctx context.Context, tenantID uuid.UUID, req *models.QuotaCheckRequest) (*models.QuotaCheck, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.quota == nil {
+		return &models.QuotaCheck{Resource: req.Resource, Allowed: true}, nil
+	}
+	copied := *c.quota
+	return &copied, nil
+}
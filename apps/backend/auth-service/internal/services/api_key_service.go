@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAPIKeyLifetime  = 90 * 24 * time.Hour
+	maxAPIKeyLifetime      = 365 * 24 * time.Hour
+	maxAPIKeyRotationGrace = 7 * 24 * time.Hour
+	// apiKeyTokenTTL bounds how long a revoked key or a removed permission
+	// keeps working through a token the gateway already cached
+	apiKeyTokenTTL = 5 * time.Minute
+)
+
+// ErrInvalidAPIKey is returned for unknown, expired and revoked keys alike,
+// so callers cannot probe which keys exist
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyService manages service accounts and API keys, and exchanges keys for
+// short-lived access tokens. granted is always the caller's permissions:
+// nobody can create a key or a service account that holds more than they do.
+type APIKeyService interface {
+	CreateServiceAccount(ctx context.Context, tenantID, createdBy uuid.UUID, granted []string, req *models.CreateServiceAccountRequest) (*models.ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context, tenantID uuid.UUID) ([]*models.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, tenantID, id uuid.UUID, granted []string) error
+
+	CreateKey(ctx context.Context, tenantID, callerID uuid.UUID, granted []string, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error)
+	ListKeys(ctx context.Context, tenantID, callerID uuid.UUID, granted []string) ([]*models.APIKey, error)
+	RotateKey(ctx context.Context, tenantID, id, callerID uuid.UUID, granted []string, req *models.RotateAPIKeyRequest) (*models.CreateAPIKeyResponse, error)
+	RevokeKey(ctx context.Context, tenantID, id, callerID uuid.UUID, granted []string) error
+
+	Exchange(ctx context.Context, key, ipAddress string) (*models.APIKeyTokenResponse, error)
+}
+
+type apiKeyService struct {
+	apiKeyRepo  repositories.APIKeyRepository
+	userRepo    repositories.UserRepository
+	roleRepo    repositories.RoleRepository
+	rbacService RBACService
+	jwtService  JWTService
+	now         func() time.Time
+}
+
+func NewAPIKeyService(
+	apiKeyRepo repositories.APIKeyRepository,
+	userRepo repositories.UserRepository,
+	roleRepo repositories.RoleRepository,
+	rbacService RBACService,
+	jwtService JWTService,
+) APIKeyService {
+	return &apiKeyService{
+		apiKeyRepo:  apiKeyRepo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		rbacService: rbacService,
+		jwtService:  jwtService,
+		now:         time.Now,
+	}
+}
+
+func (s *apiKeyService) CreateServiceAccount(ctx context.Context, tenantID, createdBy uuid.UUID, granted []string, req *models.CreateServiceAccountRequest) (*models.ServiceAccount, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("name is required and must be at most 100 characters")
+	}
+	if len(req.Permissions) == 0 {
+		return nil, fmt.Errorf("a service account must hold at least one permission")
+	}
+	for _, permission := range req.Permissions {
+		if strings.TrimSpace(permission) == sharedmiddleware.PermissionAll {
+			return nil, fmt.Errorf("service accounts cannot hold every permission, list the permissions they need")
+		}
+	}
+
+	permissions, err := s.validateScopes(ctx, granted, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.apiKeyRepo.ListServiceAccounts(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	for _, account := range accounts {
+		if strings.EqualFold(account.Name, name) {
+			return nil, fmt.Errorf("service account %s already exists", name)
+		}
+	}
+
+	account := &models.ServiceAccount{
+		TenantID:    tenantID,
+		Name:        name,
+		Description: req.Description,
+		Permissions: permissions,
+		CreatedBy:   &createdBy,
+	}
+
+	err = s.apiKeyRepo.CreateServiceAccount(ctx, account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	return account, nil
+}
+
+func (s *apiKeyService) ListServiceAccounts(ctx context.Context, tenantID uuid.UUID) ([]*models.ServiceAccount, error) {
+	return s.apiKeyRepo.ListServiceAccounts(ctx, tenantID)
+}
+
+// DeleteServiceAccount deletes a service account together with its keys
+func (s *apiKeyService) DeleteServiceAccount(ctx context.Context, tenantID, id uuid.UUID, granted []string) error {
+	account, err := s.apiKeyRepo.GetServiceAccount(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if err := requireHeld(granted, account.Permissions); err != nil {
+		return err
+	}
+
+	return s.apiKeyRepo.DeleteServiceAccount(ctx, tenantID, id)
+}
+
+// CreateKey issues a personal key for the caller or, for callers allowed to
+// manage API keys, a key for one of the tenant's service accounts
+func (s *apiKeyService) CreateKey(ctx context.Context, tenantID, callerID uuid.UUID, granted []string, req *models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("name is required and must be at most 100 characters")
+	}
+
+	lifetime := defaultAPIKeyLifetime
+	if req.ExpiresInDays != 0 {
+		lifetime = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+		if lifetime <= 0 || lifetime > maxAPIKeyLifetime {
+			return nil, fmt.Errorf("expires_in_days must be between 1 and %d", int(maxAPIKeyLifetime.Hours()/24))
+		}
+	}
+
+	key := &models.APIKey{
+		TenantID:  tenantID,
+		Name:      name,
+		ExpiresAt: s.now().Add(lifetime),
+		CreatedBy: &callerID,
+	}
+
+	// What the key may be scoped to: the service account's permissions, or
+	// for a personal key everything the caller holds
+	owned := granted
+	if req.ServiceAccountID != "" {
+		if !sharedmiddleware.HasPermission(granted, models.PermissionAPIKeysManage) {
+			return nil, fmt.Errorf("you cannot create keys for service accounts")
+		}
+		accountID, err := uuid.Parse(req.ServiceAccountID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account ID")
+		}
+		account, err := s.apiKeyRepo.GetServiceAccount(ctx, tenantID, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if !account.IsActive {
+			return nil, fmt.Errorf("service account is disabled")
+		}
+		key.ServiceAccountID = &account.ID
+		owned = account.Permissions
+	} else {
+		key.UserID = &callerID
+	}
+
+	if len(req.Scopes) == 0 {
+		key.Scopes = uniqueSorted(owned)
+	} else {
+		scopes, err := s.validateScopes(ctx, granted, req.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		for _, scope := range scopes {
+			if !sharedmiddleware.HasPermission(owned, scope) {
+				return nil, fmt.Errorf("scope %q is not held by the service account", scope)
+			}
+		}
+		key.Scopes = scopes
+	}
+	if err := requireHeld(granted, key.Scopes); err != nil {
+		return nil, err
+	}
+
+	return s.issueKey(ctx, key)
+}
+
+// ListKeys lists every key of the tenant for callers allowed to manage API
+// keys, and only the caller's personal keys otherwise
+func (s *apiKeyService) ListKeys(ctx context.Context, tenantID, callerID uuid.UUID, granted []string) ([]*models.APIKey, error) {
+	if sharedmiddleware.HasPermission(granted, models.PermissionAPIKeysManage) {
+		return s.apiKeyRepo.ListKeys(ctx, tenantID, nil)
+	}
+
+	return s.apiKeyRepo.ListKeys(ctx, tenantID, &callerID)
+}
+
+// RotateKey issues a replacement with the same owner, name and scopes and
+// expires the old key once the grace period is over
+func (s *apiKeyService) RotateKey(ctx context.Context, tenantID, id, callerID uuid.UUID, granted []string, req *models.RotateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	old, err := s.manageableKey(ctx, tenantID, id, callerID, granted)
+	if err != nil {
+		return nil, err
+	}
+
+	// The replacement is a new secret, so nobody may obtain one for another
+	// user's personal key, nor for scopes beyond their own
+	if old.UserID != nil && *old.UserID != callerID {
+		return nil, fmt.Errorf("only the owner can rotate a personal API key")
+	}
+	if err := requireHeld(granted, old.Scopes); err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	if old.RevokedAt != nil || !now.Before(old.ExpiresAt) {
+		return nil, fmt.Errorf("revoked or expired keys cannot be rotated")
+	}
+	grace := time.Duration(req.GracePeriodMinutes) * time.Minute
+	if grace < 0 || grace > maxAPIKeyRotationGrace {
+		return nil, fmt.Errorf("grace_period_minutes must be between 0 and %d", int(maxAPIKeyRotationGrace.Minutes()))
+	}
+
+	// The replacement lives as long as the old key was issued for
+	lifetime := old.ExpiresAt.Sub(old.CreatedAt)
+	if lifetime <= 0 || lifetime > maxAPIKeyLifetime {
+		lifetime = defaultAPIKeyLifetime
+	}
+
+	replacement, err := s.issueKey(ctx, &models.APIKey{
+		TenantID:         tenantID,
+		UserID:           old.UserID,
+		ServiceAccountID: old.ServiceAccountID,
+		Name:             old.Name,
+		Scopes:           old.Scopes,
+		ExpiresAt:        now.Add(lifetime),
+		CreatedBy:        &callerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if grace == 0 {
+		err = s.apiKeyRepo.RevokeKey(ctx, tenantID, old.ID, now)
+	} else if expiresAt := now.Add(grace); expiresAt.Before(old.ExpiresAt) {
+		err = s.apiKeyRepo.SetKeyExpiry(ctx, tenantID, old.ID, expiresAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire the old key: %w", err)
+	}
+
+	return replacement, nil
+}
+
+func (s *apiKeyService) RevokeKey(ctx context.Context, tenantID, id, callerID uuid.UUID, granted []string) error {
+	if _, err := s.manageableKey(ctx, tenantID, id, callerID, granted); err != nil {
+		return err
+	}
+
+	return s.apiKeyRepo.RevokeKey(ctx, tenantID, id, s.now())
+}
+
+// Exchange resolves a key to a short-lived access token. The token carries
+// the key's scopes narrowed to what its owner holds right now, so demoting a
+// user or editing a service account takes effect on the next exchange.
+func (s *apiKeyService) Exchange(ctx context.Context, plaintext, ipAddress string) (*models.APIKeyTokenResponse, error) {
+	if !strings.HasPrefix(plaintext, models.APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.GetKeyByHash(ctx, hashAPIKey(plaintext))
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	now := s.now()
+	if key.RevokedAt != nil || !now.Before(key.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var user *models.User
+	var held []string
+	if key.UserID != nil {
+		user, err = s.userRepo.GetByIDAndTenant(ctx, *key.UserID, key.TenantID)
+		if err != nil || !user.IsActive {
+			return nil, ErrInvalidAPIKey
+		}
+		held, err = resolvePermissions(ctx, s.roleRepo, user)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		account, err := s.apiKeyRepo.GetServiceAccount(ctx, key.TenantID, *key.ServiceAccountID)
+		if err != nil || !account.IsActive {
+			return nil, ErrInvalidAPIKey
+		}
+		held = account.Permissions
+	}
+
+	permissions := intersectPermissions(key.Scopes, held)
+	token, err := s.jwtService.GenerateAPIKeyToken(key, user, permissions, apiKeyTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.apiKeyRepo.TouchKey(ctx, key.ID, ipAddress, now); err != nil {
+		log.Printf("Failed to update API key %s: %v", key.ID, err)
+	}
+
+	return &models.APIKeyTokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(apiKeyTokenTTL.Seconds()),
+		Permissions: permissions,
+	}, nil
+}
+
+// manageableKey loads a key the caller may rotate or revoke: their own
+// personal key, or any key for callers allowed to manage API keys
+func (s *apiKeyService) manageableKey(ctx context.Context, tenantID, id, callerID uuid.UUID, granted []string) (*models.APIKey, error) {
+	key, err := s.apiKeyRepo.GetKey(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if key.UserID != nil && *key.UserID == callerID {
+		return key, nil
+	}
+	if !sharedmiddleware.HasPermission(granted, models.PermissionAPIKeysManage) {
+		return nil, fmt.Errorf("API key not found")
+	}
+
+	return key, nil
+}
+
+func (s *apiKeyService) issueKey(ctx context.Context, key *models.APIKey) (*models.CreateAPIKeyResponse, error) {
+	prefix, err := generateSecureToken(4)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	plaintext := models.APIKeyPrefix + prefix + "_" + secret
+	key.Prefix = models.APIKeyPrefix + prefix
+	key.KeyHash = hashAPIKey(plaintext)
+
+	err = s.apiKeyRepo.CreateKey(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: *key, Key: plaintext}, nil
+}
+
+// validateScopes normalizes scopes and checks that each one exists and is
+// held by the caller. Unlike custom roles, "*" is accepted for admins who
+// want a key that follows whatever they hold.
+func (s *apiKeyService) validateScopes(ctx context.Context, granted, requested []string) ([]string, error) {
+	catalog, err := s.rbacService.ListPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []string
+	for _, scope := range requested {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope != sharedmiddleware.PermissionAll && !knownPermission(catalog, scope) {
+			return nil, fmt.Errorf("unknown permission %q", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+
+	if err := requireHeld(granted, scopes); err != nil {
+		return nil, err
+	}
+
+	return uniqueSorted(scopes), nil
+}
+
+// intersectPermissions returns what both lists allow: the scopes the owner
+// holds, plus the owner's permissions that a wildcard scope covers
+func intersectPermissions(scopes, held []string) []string {
+	var permissions []string
+	for _, scope := range scopes {
+		if sharedmiddleware.HasPermission(held, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+	for _, permission := range held {
+		if sharedmiddleware.HasPermission(scopes, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+
+	return uniqueSorted(permissions)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
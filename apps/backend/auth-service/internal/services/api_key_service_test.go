@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type apiKeyTestFixture struct {
+	svc      *apiKeyService
+	repo     *fakeAPIKeyRepository
+	userRepo *fakeUserRepository
+	jwt      JWTService
+	tenantID uuid.UUID
+	now      time.Time
+}
+
+func newAPIKeyTestFixture(t *testing.T) *apiKeyTestFixture {
+	userRepo := newFakeUserRepository()
+	roleRepo := newFakeRoleRepository()
+	roleRepo.modulePermissions = []models.Permission{
+		{Name: "crm.lead.read", Module: "crm"},
+		{Name: "crm.lead.write", Module: "crm"},
+		{Name: "hrm.employee.read", Module: "hrm"},
+	}
+	jwtService := NewJWTService(&config.Config{JWTSecret: "test-secret"})
+
+	f := &apiKeyTestFixture{
+		repo:     newFakeAPIKeyRepository(),
+		userRepo: userRepo,
+		jwt:      jwtService,
+		tenantID: uuid.New(),
+		now:      time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC),
+	}
+	f.svc = NewAPIKeyService(f.repo, userRepo, roleRepo, NewRBACService(userRepo, roleRepo), jwtService).(*apiKeyService)
+	f.svc.now = func() time.Time { return f.now }
+	f.repo.now = f.svc.now
+
+	return f
+}
+
+func (f *apiKeyTestFixture) createUser(t *testing.T, role string) *models.User {
+	user := &models.User{TenantID: f.tenantID, Email: role + "@example.com", Role: role}
+	require.NoError(t, f.userRepo.Create(context.Background(), user))
+	return user
+}
+
+func (f *apiKeyTestFixture) claims(t *testing.T, accessToken string) *UserClaims {
+	token, err := f.jwt.ValidateToken(accessToken)
+	require.NoError(t, err)
+	claims, err := f.jwt.ParseUserClaims(token)
+	require.NoError(t, err)
+	return claims
+}
+
+func TestPersonalAPIKeyIsLimitedToScopesAndOwner(t *testing.T) {
+	f := newAPIKeyTestFixture(t)
+	ctx := context.Background()
+	manager := f.createUser(t, models.RoleManager)
+	granted := []string{"users.read", "roles.read", "crm.*"}
+
+	// Scopes the caller does not hold are refused
+	_, err := f.svc.CreateKey(ctx, f.tenantID, manager.ID, granted, &models.CreateAPIKeyRequest{
+		Name:   "export",
+		Scopes: []string{"hrm.employee.read"},
+	})
+	assert.Error(t, err)
+
+	created, err := f.svc.CreateKey(ctx, f.tenantID, manager.ID, granted, &models.CreateAPIKeyRequest{
+		Name:   "export",
+		Scopes: []string{"crm.*", "users.read"},
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix+"_"))
+	assert.Equal(t, f.now.Add(defaultAPIKeyLifetime), created.ExpiresAt)
+	assert.Equal(t, hashAPIKey(created.Key), f.repo.keys[created.ID].KeyHash)
+
+	token, err := f.svc.Exchange(ctx, created.Key, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crm.*", "users.read"}, token.Permissions)
+
+	claims := f.claims(t, token.AccessToken)
+	assert.Equal(t, manager.ID.String(), claims.UserID)
+	assert.Equal(t, f.tenantID.String(), claims.TenantID)
+	assert.Equal(t, models.RoleAPIKey, claims.Role)
+	assert.Equal(t, created.ID.String(), claims.APIKeyID)
+
+	stored := f.repo.keys[created.ID]
+	require.NotNil(t, stored.LastUsedAt)
+	assert.Equal(t, f.now, *stored.LastUsedAt)
+	assert.Equal(t, "203.0.113.7", *stored.LastUsedIP)
+
+	// Demoting the owner narrows the key on its next exchange
+	f.userRepo.users[manager.ID].Role = models.RoleUser
+	token, err = f.svc.Exchange(ctx, created.Key, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crm.lead.read"}, token.Permissions)
+
+	// Deactivated owners cannot use their keys
+	f.userRepo.users[manager.ID].IsActive = false
+	_, err = f.svc.Exchange(ctx, created.Key, "203.0.113.7")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	_, err = f.svc.Exchange(ctx, "zpk_unknown_secret", "203.0.113.7")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestServiceAccountKeys(t *testing.T) {
+	f := newAPIKeyTestFixture(t)
+	ctx := context.Background()
+	admin := f.createUser(t, models.RoleAdmin)
+	all := []string{"*"}
+
+	_, err := f.svc.CreateServiceAccount(ctx, f.tenantID, admin.ID, all, &models.CreateServiceAccountRequest{
+		Name:        "erp-sync",
+		Permissions: []string{"*"},
+	})
+	assert.Error(t, err)
+
+	_, err = f.svc.CreateServiceAccount(ctx, f.tenantID, admin.ID, all, &models.CreateServiceAccountRequest{
+		Name:        "erp-sync",
+		Permissions: []string{"crm.unknown"},
+	})
+	assert.Error(t, err)
+
+	account, err := f.svc.CreateServiceAccount(ctx, f.tenantID, admin.ID, all, &models.CreateServiceAccountRequest{
+		Name:        "erp-sync",
+		Permissions: []string{"crm.lead.read", "hrm.employee.read"},
+	})
+	require.NoError(t, err)
+
+	// Only callers allowed to manage API keys can issue service account keys
+	_, err = f.svc.CreateKey(ctx, f.tenantID, admin.ID, []string{"crm.*", "hrm.*"}, &models.CreateAPIKeyRequest{
+		Name:             "erp",
+		ServiceAccountID: account.ID.String(),
+	})
+	assert.Error(t, err)
+
+	// Scopes must stay within the service account's permissions
+	_, err = f.svc.CreateKey(ctx, f.tenantID, admin.ID, all, &models.CreateAPIKeyRequest{
+		Name:             "erp",
+		ServiceAccountID: account.ID.String(),
+		Scopes:           []string{"crm.lead.write"},
+	})
+	assert.Error(t, err)
+
+	created, err := f.svc.CreateKey(ctx, f.tenantID, admin.ID, all, &models.CreateAPIKeyRequest{
+		Name:             "erp",
+		ServiceAccountID: account.ID.String(),
+		ExpiresInDays:    30,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, created.UserID)
+	assert.Equal(t, []string{"crm.lead.read", "hrm.employee.read"}, created.Scopes)
+	assert.Equal(t, f.now.Add(30*24*time.Hour), created.ExpiresAt)
+
+	token, err := f.svc.Exchange(ctx, created.Key, "198.51.100.1")
+	require.NoError(t, err)
+	claims := f.claims(t, token.AccessToken)
+	assert.Equal(t, account.ID.String(), claims.UserID)
+	assert.Equal(t, models.RoleServiceAccount, claims.Role)
+	assert.Equal(t, []string{"crm.lead.read", "hrm.employee.read"}, claims.Permissions)
+
+	_, err = f.svc.CreateKey(ctx, f.tenantID, admin.ID, all, &models.CreateAPIKeyRequest{
+		Name:          "too-long",
+		ExpiresInDays: 366,
+	})
+	assert.Error(t, err)
+
+	// Deleting the service account takes its keys with it
+	require.NoError(t, f.svc.DeleteServiceAccount(ctx, f.tenantID, account.ID, all))
+	_, err = f.svc.Exchange(ctx, created.Key, "198.51.100.1")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestAPIKeyExpiryRotationAndRevocation(t *testing.T) {
+	f := newAPIKeyTestFixture(t)
+	ctx := context.Background()
+	owner := f.createUser(t, models.RoleUser)
+	other := f.createUser(t, models.RoleManager)
+	userPerms := []string{"crm.lead.read"}
+	keyManager := []string{"*"}
+
+	created, err := f.svc.CreateKey(ctx, f.tenantID, owner.ID, userPerms, &models.CreateAPIKeyRequest{Name: "script", ExpiresInDays: 10})
+	require.NoError(t, err)
+
+	// Other users see neither the key nor a way to touch it
+	keys, err := f.svc.ListKeys(ctx, f.tenantID, other.ID, []string{"crm.*"})
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	assert.Error(t, f.svc.RevokeKey(ctx, f.tenantID, created.ID, other.ID, []string{"crm.*"}))
+	_, err = f.svc.RotateKey(ctx, f.tenantID, created.ID, other.ID, keyManager, &models.RotateAPIKeyRequest{})
+	assert.Error(t, err, "a personal key is only rotated by its owner")
+
+	keys, err = f.svc.ListKeys(ctx, f.tenantID, other.ID, keyManager)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	// Rotation keeps the old key alive for the grace period only
+	rotated, err := f.svc.RotateKey(ctx, f.tenantID, created.ID, owner.ID, userPerms, &models.RotateAPIKeyRequest{GracePeriodMinutes: 15})
+	require.NoError(t, err)
+	assert.NotEqual(t, created.Key, rotated.Key)
+	assert.Equal(t, created.Scopes, rotated.Scopes)
+	assert.Equal(t, f.now.Add(10*24*time.Hour), rotated.ExpiresAt)
+
+	f.now = f.now.Add(10 * time.Minute)
+	_, err = f.svc.Exchange(ctx, created.Key, "192.0.2.1")
+	assert.NoError(t, err)
+	f.now = f.now.Add(10 * time.Minute)
+	_, err = f.svc.Exchange(ctx, created.Key, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = f.svc.Exchange(ctx, rotated.Key, "192.0.2.1")
+	assert.NoError(t, err)
+
+	// Key managers can revoke any key
+	require.NoError(t, f.svc.RevokeKey(ctx, f.tenantID, rotated.ID, other.ID, keyManager))
+	_, err = f.svc.Exchange(ctx, rotated.Key, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+	_, err = f.svc.RotateKey(ctx, f.tenantID, rotated.ID, owner.ID, userPerms, &models.RotateAPIKeyRequest{})
+	assert.Error(t, err)
+
+	// Keys stop working when they expire
+	fresh, err := f.svc.CreateKey(ctx, f.tenantID, owner.ID, userPerms, &models.CreateAPIKeyRequest{Name: "short", ExpiresInDays: 1})
+	require.NoError(t, err)
+	f.now = f.now.Add(24 * time.Hour)
+	_, err = f.svc.Exchange(ctx, fresh.Key, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+}
+
+func TestIntersectPermissions(t *testing.T) {
+	assert.Equal(t, []string{"crm.lead.read"}, intersectPermissions([]string{"crm.*"}, []string{"crm.lead.read", "hrm.employee.read"}))
+	assert.Equal(t, []string{"crm.*"}, intersectPermissions([]string{"crm.*"}, []string{"*"}))
+	assert.Equal(t, []string{"crm.lead.read", "users.read"}, intersectPermissions([]string{"*"}, []string{"users.read", "crm.lead.read"}))
+	assert.Empty(t, intersectPermissions([]string{"hrm.*"}, []string{"crm.lead.read"}))
+}
+
+// In-memory API key repository
+
+type fakeAPIKeyRepository struct {
+	accounts map[uuid.UUID]*models.ServiceAccount
+	keys     map[uuid.UUID]*models.APIKey
+	now      func() time.Time
+}
+
+func newFakeAPIKeyRepository() *fakeAPIKeyRepository {
+	return &fakeAPIKeyRepository{
+		accounts: make(map[uuid.UUID]*models.ServiceAccount),
+		keys:     make(map[uuid.UUID]*models.APIKey),
+		now:      time.Now,
+	}
+}
+
+func (r *fakeAPIKeyRepository) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	account.ID = uuid.New()
+	account.IsActive = true
+	copied := *account
+	r.accounts[account.ID] = &copied
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) GetServiceAccount(ctx context.Context, tenantID, id uuid.UUID) (*models.ServiceAccount, error) {
+	account, ok := r.accounts[id]
+	if !ok || account.TenantID != tenantID {
+		return nil, fmt.Errorf("service account not found")
+	}
+	copied := *account
+	return &copied, nil
+}
+
+func (r *fakeAPIKeyRepository) ListServiceAccounts(ctx context.Context, tenantID uuid.UUID) ([]*models.ServiceAccount, error) {
+	var accounts []*models.ServiceAccount
+	for _, account := range r.accounts {
+		if account.TenantID == tenantID {
+			accounts = append(accounts, account)
+		}
+	}
+	return accounts, nil
+}
+
+func (r *fakeAPIKeyRepository) DeleteServiceAccount(ctx context.Context, tenantID, id uuid.UUID) error {
+	if _, err := r.GetServiceAccount(ctx, tenantID, id); err != nil {
+		return err
+	}
+	delete(r.accounts, id)
+	for keyID, key := range r.keys {
+		if key.ServiceAccountID != nil && *key.ServiceAccountID == id {
+			delete(r.keys, keyID)
+		}
+	}
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) CreateKey(ctx context.Context, key *models.APIKey) error {
+	key.ID = uuid.New()
+	key.CreatedAt = r.now()
+	copied := *key
+	r.keys[key.ID] = &copied
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) GetKey(ctx context.Context, tenantID, id uuid.UUID) (*models.APIKey, error) {
+	key, ok := r.keys[id]
+	if !ok || key.TenantID != tenantID {
+		return nil, fmt.Errorf("API key not found")
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (r *fakeAPIKeyRepository) GetKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("API key not found")
+}
+
+func (r *fakeAPIKeyRepository) ListKeys(ctx context.Context, tenantID uuid.UUID, userID *uuid.UUID) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	for _, key := range r.keys {
+		if key.TenantID != tenantID {
+			continue
+		}
+		if userID != nil && (key.UserID == nil || *key.UserID != *userID) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepository) SetKeyExpiry(ctx context.Context, tenantID, id uuid.UUID, expiresAt time.Time) error {
+	if key, ok := r.keys[id]; ok && key.TenantID == tenantID {
+		key.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) RevokeKey(ctx context.Context, tenantID, id uuid.UUID, revokedAt time.Time) error {
+	key, ok := r.keys[id]
+	if !ok || key.TenantID != tenantID || key.RevokedAt != nil {
+		return fmt.Errorf("API key not found")
+	}
+	key.RevokedAt = &revokedAt
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) TouchKey(ctx context.Context, id uuid.UUID, ip string, usedAt time.Time) error {
+	if key, ok := r.keys[id]; ok {
+		key.LastUsedAt = &usedAt
+		key.LastUsedIP = &ip
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -16,32 +17,68 @@ import (
 type AuthService interface {
 	Register(ctx context.Context, req *models.RegisterRequest) (*models.TokenResponse, error)
 	Login(ctx context.Context, req *models.LoginRequest) (*models.TokenResponse, error)
-	RefreshToken(ctx context.Context, refreshToken string) (*models.TokenResponse, error)
+	RefreshToken(ctx context.Context, refreshToken, ipAddress string) (*models.TokenResponse, error)
 	Logout(ctx context.Context, userID uuid.UUID) error
 	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	IssueTokens(ctx context.Context, user *models.User) (*models.TokenResponse, error)
+	IssueSSOTokens(ctx context.Context, user *models.User) (*models.TokenResponse, error)
+	ChangeExpiredPassword(ctx context.Context, req *models.ChangeExpiredPasswordRequest) (*models.TokenResponse, error)
+	ListTenants(ctx context.Context, userID uuid.UUID) ([]*models.TenantMembership, error)
+	SwitchTenant(ctx context.Context, userID uuid.UUID, req *models.SwitchTenantRequest) (*models.TokenResponse, error)
+
+	// Tenant provisioning, called by tenant-service
+	CreateTenantAdmin(ctx context.Context, tenantID uuid.UUID, req *models.CreateTenantAdminRequest) (*models.User, error)
+	DeleteTenantUser(ctx context.Context, tenantID, userID uuid.UUID) error
 }
 
+// ErrNotTenantMember is returned when signing in or switching to a tenant the
+// user has no active membership in
+var ErrNotTenantMember = errors.New("you are not a member of this organization")
+
+// ErrSSOSessionSwitch is returned when a session signed in through a tenant's
+// identity provider tries to switch tenant. That IdP only vouches for the
+// user in its own tenant.
+var ErrSSOSessionSwitch = errors.New("single sign-on sessions cannot switch organization, sign in to the other organization instead")
+
 type authService struct {
 	userRepo         repositories.UserRepository
 	tenantRepo       repositories.TenantRepository
+	membershipRepo   repositories.MembershipRepository
 	refreshTokenRepo repositories.RefreshTokenRepository
+	samlRepo         repositories.SAMLRepository
+	roleRepo         repositories.RoleRepository
+	passwordPolicy   PasswordPolicyService
+	loginProtection  LoginProtectionService
 	jwtService       JWTService
+	tenantClient     TenantClient
 	config           *config.Config
 }
 
 func NewAuthService(
 	userRepo repositories.UserRepository,
 	tenantRepo repositories.TenantRepository,
+	membershipRepo repositories.MembershipRepository,
 	refreshTokenRepo repositories.RefreshTokenRepository,
+	samlRepo repositories.SAMLRepository,
+	roleRepo repositories.RoleRepository,
+	passwordPolicy PasswordPolicyService,
+	loginProtection LoginProtectionService,
 	jwtService JWTService,
+	tenantClient TenantClient,
 	config *config.Config,
 ) AuthService {
 	return &authService{
 		userRepo:         userRepo,
 		tenantRepo:       tenantRepo,
+		membershipRepo:   membershipRepo,
 		refreshTokenRepo: refreshTokenRepo,
+		samlRepo:         samlRepo,
+		roleRepo:         roleRepo,
+		passwordPolicy:   passwordPolicy,
+		loginProtection:  loginProtection,
 		jwtService:       jwtService,
+		tenantClient:     tenantClient,
 		config:           config,
 	}
 }
@@ -50,7 +87,7 @@ func (s *authService) Register(ctx context.Context, req *models.RegisterRequest)
 	// Check if user already exists
 	existingUser, err := s.userRepo.GetByEmail(ctx, req.Email)
 	if err == nil && existingUser != nil {
-		return nil, fmt.Errorf("user with email %s already exists", req.Email)
+		return s.registerExistingUser(ctx, existingUser, req)
 	}
 
 	// Parse tenant ID if provided
@@ -66,19 +103,20 @@ func (s *authService) Register(ctx context.Context, req *models.RegisterRequest)
 		if err != nil {
 			return nil, fmt.Errorf("tenant not found: %w", err)
 		}
-	} else {
-		// Create a new tenant for this user (first user becomes admin)
-		tenant := &models.Tenant{
-			Name:      fmt.Sprintf("%s %s's Organization", req.FirstName, req.LastName),
-			Subdomain: fmt.Sprintf("org-%s", uuid.New().String()[:8]),
-			PlanType:  models.PlanFree,
-		}
 
-		err = s.tenantRepo.Create(ctx, tenant)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create tenant: %w", err)
+		if err := checkSeats(ctx, s.tenantClient, tenantID, 1); err != nil {
+			return nil, err
 		}
-		tenantID = tenant.ID
+	}
+
+	// Validate before creating a tenant so a rejected password leaves nothing
+	// behind. New tenants get the default policy.
+	if err := s.passwordPolicy.Validate(ctx, tenantID, uuid.Nil, req.Password); err != nil {
+		return nil, err
+	}
+
+	if req.TenantID == "" {
+		return s.registerOrganization(ctx, req)
 	}
 
 	// Hash password
@@ -97,18 +135,17 @@ func (s *authService) Register(ctx context.Context, req *models.RegisterRequest)
 		Role:      models.RoleUser,
 	}
 
-	// If this is the first user in tenant, make them admin
-	if req.TenantID == "" {
-		user.Role = models.RoleAdmin
-	}
-
 	err = s.userRepo.Create(ctx, user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	if err := s.passwordPolicy.RecordPassword(ctx, user.ID, user.Password); err != nil {
+		fmt.Printf("Failed to record password history for user %s: %v\n", user.ID, err)
+	}
+
 	// Generate tokens
-	tokens, err := s.jwtService.GenerateTokens(user)
+	tokens, err := s.generateTokens(ctx, user, uuid.Nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tokens: %w", err)
 	}
@@ -129,21 +166,17 @@ func (s *authService) Register(ctx context.Context, req *models.RegisterRequest)
 }
 
 func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*models.TokenResponse, error) {
-	// Get user by email
-	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	user, err := s.authenticatePassword(ctx, req.Email, req.Password, req.IPAddress, req.TenantID, req.AdminLogin)
 	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, err
 	}
 
-	// Check if user is active
-	if !user.IsActive {
-		return nil, fmt.Errorf("account is deactivated")
+	if err := s.checkPasswordLoginAllowed(ctx, user); err != nil {
+		return nil, err
 	}
 
-	// Verify password
-	err = s.verifyPassword(req.Password, user.Password)
-	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+	if s.passwordPolicy.IsExpired(ctx, user) {
+		return nil, ErrPasswordExpired
 	}
 
 	// Update last login
@@ -154,7 +187,7 @@ func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 	}
 
 	// Generate tokens
-	tokens, err := s.jwtService.GenerateTokens(user)
+	tokens, err := s.generateTokens(ctx, user, uuid.Nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tokens: %w", err)
 	}
@@ -171,10 +204,13 @@ func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 		return nil, fmt.Errorf("failed to store refresh token: %w", err)
 	}
 
-	return tokens, nil
+	return s.withTenants(ctx, tokens), nil
 }
 
-func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*models.TokenResponse, error) {
+// RefreshToken rotates a refresh token. The tenant's IP allowlist and
+// SSO-only mode are checked again, so changing either ends sessions that no
+// longer satisfy it.
+func (s *authService) RefreshToken(ctx context.Context, refreshToken, ipAddress string) (*models.TokenResponse, error) {
 	// Validate refresh token
 	token, err := s.jwtService.ValidateToken(refreshToken)
 	if err != nil {
@@ -192,6 +228,15 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 		return nil, fmt.Errorf("invalid user ID in token: %w", err)
 	}
 
+	// Sessions signed in through an identity provider stay marked as such
+	ssoTenantID := uuid.Nil
+	if claims.SSOTenantID != "" {
+		ssoTenantID, err = uuid.Parse(claims.SSOTenantID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSO tenant ID in token: %w", err)
+		}
+	}
+
 	// Check if refresh token exists in database
 	storedToken, err := s.refreshTokenRepo.GetByToken(ctx, refreshToken)
 	if err != nil {
@@ -220,8 +265,26 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 		return nil, fmt.Errorf("account is deactivated")
 	}
 
+	// Stay in the tenant the session was issued for; a removed membership
+	// ends the session
+	user, err = s.enterTenant(ctx, user, claims.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loginProtection.CheckAllowedIP(ctx, user, ipAddress, false); err != nil {
+		return nil, err
+	}
+
+	// The tenant's own identity provider is the one way into SSO-only tenants
+	if ssoTenantID != user.TenantID {
+		if err := s.checkPasswordLoginAllowed(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
 	// Generate new tokens
-	tokens, err := s.jwtService.GenerateTokens(user)
+	tokens, err := s.generateTokens(ctx, user, ssoTenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate new tokens: %w", err)
 	}
@@ -269,7 +332,398 @@ func (s *authService) UpdateUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// IssueTokens issues a token pair for a user that was authenticated outside of
+// the login endpoint, e.g. on registration or after a password change
+func (s *authService) IssueTokens(ctx context.Context, user *models.User) (*models.TokenResponse, error) {
+	return s.issueTokens(ctx, user, uuid.Nil)
+}
+
+// IssueSSOTokens issues a token pair for a user their tenant's identity
+// provider authenticated. The session is tied to that tenant.
+func (s *authService) IssueSSOTokens(ctx context.Context, user *models.User) (*models.TokenResponse, error) {
+	return s.issueTokens(ctx, user, user.TenantID)
+}
+
+func (s *authService) issueTokens(ctx context.Context, user *models.User, ssoTenantID uuid.UUID) (*models.TokenResponse, error) {
+	if !user.IsActive {
+		return nil, fmt.Errorf("account is deactivated")
+	}
+
+	// Update last login
+	err := s.userRepo.UpdateLastLogin(ctx, user.ID)
+	if err != nil {
+		// Log error but don't fail the login
+		fmt.Printf("Failed to update last login for user %s: %v\n", user.ID, err)
+	}
+
+	// Generate tokens
+	tokens, err := s.generateTokens(ctx, user, ssoTenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tokens: %w", err)
+	}
+
+	// Store refresh token
+	refreshTokenRecord := &models.RefreshToken{
+		UserID:    user.ID,
+		Token:     tokens.RefreshToken,
+		ExpiresAt: time.Now().Add(168 * time.Hour), // 7 days
+	}
+
+	err = s.refreshTokenRepo.Create(ctx, refreshTokenRecord)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// ChangeExpiredPassword rotates a password that Login rejected with
+// ErrPasswordExpired and signs the user in with the new one. It is not a
+// second password login: tenants in SSO-only mode are refused as by Login,
+// and passwords that have not expired are left alone.
+func (s *authService) ChangeExpiredPassword(ctx context.Context, req *models.ChangeExpiredPasswordRequest) (*models.TokenResponse, error) {
+	user, err := s.authenticatePassword(ctx, req.Email, req.CurrentPassword, req.IPAddress, req.TenantID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPasswordLoginAllowed(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if !s.passwordPolicy.IsExpired(ctx, user) {
+		return nil, ErrPasswordNotExpired
+	}
+
+	if err := s.passwordPolicy.Validate(ctx, user.TenantID, user.ID, req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hashPassword(req.NewPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return nil, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := s.passwordPolicy.RecordPassword(ctx, user.ID, hashedPassword); err != nil {
+		fmt.Printf("Failed to record password history for user %s: %v\n", user.ID, err)
+	}
+
+	return s.IssueTokens(ctx, user)
+}
+
+func (s *authService) ListTenants(ctx context.Context, userID uuid.UUID) ([]*models.TenantMembership, error) {
+	memberships, err := s.membershipRepo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+
+	return memberships, nil
+}
+
+// SwitchTenant issues a token pair scoped to another tenant of the signed-in
+// user. The target tenant's IP allowlist and SSO-only mode apply as they do
+// for a password login. Sessions from a tenant's identity provider cannot
+// switch: a tenant admin controls that IdP and could assert any address.
+func (s *authService) SwitchTenant(ctx context.Context, userID uuid.UUID, req *models.SwitchTenantRequest) (*models.TokenResponse, error) {
+	if req.SSOTenantID != "" {
+		return nil, ErrSSOSessionSwitch
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	if !user.IsActive {
+		return nil, fmt.Errorf("account is deactivated")
+	}
+
+	if req.TenantID == "" {
+		return nil, ErrNotTenantMember
+	}
+
+	user, err = s.enterTenant(ctx, user, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loginProtection.CheckAllowedIP(ctx, user, req.IPAddress, false); err != nil {
+		return nil, err
+	}
+
+	if err := s.checkPasswordLoginAllowed(ctx, user); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.IssueTokens(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withTenants(ctx, tokens), nil
+}
+
 // Helper methods
+
+// registerExistingUser lets an existing user join a tenant or create a new
+// one, the same way a new user would register. The password must be the
+// account's own so registering cannot attach an address to someone else.
+func (s *authService) registerExistingUser(ctx context.Context, user *models.User, req *models.RegisterRequest) (*models.TokenResponse, error) {
+	exists := fmt.Errorf("user with email %s already exists", req.Email)
+
+	if err := s.loginProtection.Check(ctx, user, req.IPAddress); err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, exists
+	}
+	if err := s.verifyPassword(req.Password, user.Password); err != nil {
+		s.loginProtection.RecordFailure(ctx, user, req.IPAddress)
+		return nil, exists
+	}
+	s.loginProtection.RecordSuccess(ctx, user)
+
+	membership := &models.TenantMembership{UserID: user.ID, Role: models.RoleUser}
+	if req.TenantID != "" {
+		tenantID, err := uuid.Parse(req.TenantID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tenant ID: %w", err)
+		}
+
+		if _, err := s.tenantRepo.GetByID(ctx, tenantID); err != nil {
+			return nil, fmt.Errorf("tenant not found: %w", err)
+		}
+
+		if _, err := s.enterTenant(ctx, user, req.TenantID); err == nil {
+			return nil, fmt.Errorf("you are already a member of this organization")
+		}
+		if err := checkSeats(ctx, s.tenantClient, tenantID, 1); err != nil {
+			return nil, err
+		}
+		membership.TenantID = tenantID
+	} else {
+		provisioning, err := s.tenantClient.Provision(ctx, &models.ProvisionTenantRequest{
+			Name: organizationName(user.FirstName, user.LastName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		membership.TenantID = *provisioning.TenantID
+		membership.Role = models.RoleAdmin
+	}
+
+	if err := s.membershipRepo.AddMembership(ctx, membership); err != nil {
+		return nil, fmt.Errorf("failed to add membership: %w", err)
+	}
+
+	user.TenantID = membership.TenantID
+	user.Role = membership.Role
+
+	tokens, err := s.IssueTokens(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withTenants(ctx, tokens), nil
+}
+
+// registerOrganization registers a user without a tenant. tenant-service
+// provisions their organization and creates them as its first admin; a
+// failed provisioning is rolled back there and leaves no account behind.
+func (s *authService) registerOrganization(ctx context.Context, req *models.RegisterRequest) (*models.TokenResponse, error) {
+	provisioning, err := s.tenantClient.Provision(ctx, &models.ProvisionTenantRequest{
+		Name: organizationName(req.FirstName, req.LastName),
+		Admin: &models.CreateTenantAdminRequest{
+			Email:     req.Email,
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Password:  req.Password,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if provisioning.AdminUserID == nil {
+		return nil, fmt.Errorf("failed to create organization: no admin user was created")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, *provisioning.AdminUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	return s.IssueTokens(ctx, user)
+}
+
+// organizationName names the organization of a user who registers without one
+func organizationName(firstName, lastName string) string {
+	return fmt.Sprintf("%s %s's Organization", firstName, lastName)
+}
+
+// CreateTenantAdmin creates the first admin of a tenant being provisioned
+func (s *authService) CreateTenantAdmin(ctx context.Context, tenantID uuid.UUID, req *models.CreateTenantAdminRequest) (*models.User, error) {
+	if _, err := s.tenantRepo.GetByID(ctx, tenantID); err != nil {
+		return nil, fmt.Errorf("tenant not found")
+	}
+
+	if existing, err := s.userRepo.GetByEmail(ctx, req.Email); err == nil && existing != nil {
+		return nil, fmt.Errorf("user with email %s already exists", req.Email)
+	}
+
+	if err := s.passwordPolicy.Validate(ctx, tenantID, uuid.Nil, req.Password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hashPassword(req.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.User{
+		TenantID:  tenantID,
+		Email:     req.Email,
+		Password:  hashedPassword,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      models.RoleAdmin,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := s.passwordPolicy.RecordPassword(ctx, user.ID, user.Password); err != nil {
+		fmt.Printf("Failed to record password history for user %s: %v\n", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// DeleteTenantUser deletes a user created while provisioning a tenant that
+// is being rolled back. A user that is already gone is not an error.
+func (s *authService) DeleteTenantUser(ctx context.Context, tenantID, userID uuid.UUID) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil
+		}
+		return err
+	}
+	if user.TenantID != tenantID {
+		return fmt.Errorf("user does not belong to this tenant")
+	}
+
+	return s.userRepo.Delete(ctx, userID)
+}
+
+// enterTenant scopes a user to one of their tenants, taking the tenant and
+// role from the membership. An empty tenantID keeps the home tenant.
+func (s *authService) enterTenant(ctx context.Context, user *models.User, tenantID string) (*models.User, error) {
+	if tenantID == "" {
+		return user, nil
+	}
+
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return nil, ErrNotTenantMember
+	}
+	if id == user.TenantID {
+		return user, nil
+	}
+
+	member, err := s.userRepo.GetByIDAndTenant(ctx, user.ID, id)
+	if err != nil || !member.IsActive {
+		return nil, ErrNotTenantMember
+	}
+
+	return member, nil
+}
+
+// checkPasswordLoginAllowed refuses tenants in SSO-only mode, which must sign
+// in through their identity provider. Super admins are exempt so a broken IdP
+// cannot lock the platform out.
+func (s *authService) checkPasswordLoginAllowed(ctx context.Context, user *models.User) error {
+	if user.TenantID == uuid.Nil || user.Role == models.RoleSuperAdmin {
+		return nil
+	}
+
+	connection, err := s.samlRepo.GetConnection(ctx, user.TenantID)
+	if err == nil && connection.Enabled && connection.SSOOnly {
+		return fmt.Errorf("password login is disabled for this tenant, sign in with single sign-on")
+	}
+
+	return nil
+}
+
+// withTenants lists the user's tenants on a token response for the tenant
+// switcher. A failure leaves the list out rather than failing the sign-in.
+func (s *authService) withTenants(ctx context.Context, tokens *models.TokenResponse) *models.TokenResponse {
+	memberships, err := s.membershipRepo.ListMemberships(ctx, tokens.User.ID)
+	if err != nil {
+		fmt.Printf("Failed to list tenants for user %s: %v\n", tokens.User.ID, err)
+		return tokens
+	}
+
+	tokens.Tenants = memberships
+	return tokens
+}
+
+// authenticatePassword checks an email and password behind the brute-force
+// protection and scopes the user to the requested tenant. Locked accounts are
+// refused before the password is checked, and memberships and the tenant's IP
+// allowlist after it, so neither is revealed to callers without valid
+// credentials.
+func (s *authService) authenticatePassword(ctx context.Context, email, password, ip, tenantID string, admin bool) (*models.User, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if err := s.loginProtection.Check(ctx, nil, ip); err != nil {
+			return nil, err
+		}
+		s.loginProtection.RecordFailure(ctx, nil, ip)
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if err := s.loginProtection.Check(ctx, user, ip); err != nil {
+		return nil, err
+	}
+
+	// Check if user is active
+	if !user.IsActive {
+		return nil, fmt.Errorf("account is deactivated")
+	}
+
+	// Verify password
+	if err := s.verifyPassword(password, user.Password); err != nil {
+		s.loginProtection.RecordFailure(ctx, user, ip)
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	user, err = s.enterTenant(ctx, user, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loginProtection.CheckAllowedIP(ctx, user, ip, admin); err != nil {
+		return nil, err
+	}
+
+	s.loginProtection.RecordSuccess(ctx, user)
+
+	return user, nil
+}
+
+func (s *authService) generateTokens(ctx context.Context, user *models.User, ssoTenantID uuid.UUID) (*models.TokenResponse, error) {
+	permissions, err := resolvePermissions(ctx, s.roleRepo, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.jwtService.GenerateTokens(user, permissions, ssoTenantID)
+}
+
 func (s *authService) hashPassword(password string) (string, error) {
 	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
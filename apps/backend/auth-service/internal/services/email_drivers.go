@@ -0,0 +1,272 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+)
+
+// EmailDriver delivers one rendered email. The outbox worker retries
+// whatever a driver reports as failed.
+type EmailDriver interface {
+	Send(ctx context.Context, msg *models.EmailMessage) error
+}
+
+// NewEmailDriver builds the driver selected by EMAIL_DRIVER. Without an SMTP
+// host the smtp driver falls back to printing emails on stdout, as email
+// delivery did before it was configurable.
+func NewEmailDriver(cfg *config.Config) (EmailDriver, error) {
+	switch cfg.EmailDriver {
+	case "", "smtp":
+		if cfg.SMTPHost == "" {
+			log.Printf("SMTP not configured, emails are written to stdout")
+			return NewFileEmailDriver(""), nil
+		}
+		return NewSMTPEmailDriver(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword), nil
+	case "file":
+		return NewFileEmailDriver(cfg.EmailFileDir), nil
+	case "http":
+		if cfg.EmailHTTPEndpoint == "" {
+			return nil, fmt.Errorf("EMAIL_HTTP_ENDPOINT is required for the http email driver")
+		}
+		return NewHTTPEmailDriver(cfg.EmailHTTPEndpoint, cfg.EmailHTTPAPIKey), nil
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", cfg.EmailDriver)
+	}
+}
+
+// SMTPEmailDriver sends through an SMTP relay, upgrading to TLS when the
+// server offers STARTTLS and authenticating only when a username is set
+type SMTPEmailDriver struct {
+	host     string
+	port     string
+	username string
+	password string
+}
+
+func NewSMTPEmailDriver(host, port, username, password string) *SMTPEmailDriver {
+	return &SMTPEmailDriver{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+	}
+}
+
+func (d *SMTPEmailDriver) Send(ctx context.Context, msg *models.EmailMessage) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", msg.From, err)
+	}
+	body, err := buildMIMEMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(d.host, d.port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, d.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: d.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if d.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", d.username, d.password, d.host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM rejected: %w", err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("SMTP RCPT TO rejected: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA rejected: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected email: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// FileEmailDriver is the development sink: each email is written as an .eml
+// file to dir, or to stdout when dir is empty
+type FileEmailDriver struct {
+	dir string
+	out io.Writer
+}
+
+func NewFileEmailDriver(dir string) *FileEmailDriver {
+	return &FileEmailDriver{dir: dir, out: os.Stdout}
+}
+
+func (d *FileEmailDriver) Send(ctx context.Context, msg *models.EmailMessage) error {
+	body, err := buildMIMEMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	if d.dir == "" {
+		_, err := fmt.Fprintf(d.out, "----- EMAIL %s -----\n%s\n----- END EMAIL -----\n", msg.ID, body)
+		return err
+	}
+
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create email directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%s.eml", msg.CreatedAt.UTC().Format("20060102T150405"), msg.Template, msg.ID)
+	return os.WriteFile(filepath.Join(d.dir, name), body, 0o644)
+}
+
+// HTTPEmailDriver posts emails as JSON to a provider endpoint (or a relay in
+// front of one). The message ID is sent as Idempotency-Key so a retry after
+// a lost response does not deliver twice.
+type HTTPEmailDriver struct {
+	endpoint string
+	apiKey   string
+	client   *http.Client
+}
+
+// httpEmailPayload is the request body HTTPEmailDriver sends
+type httpEmailPayload struct {
+	ID      string `json:"id"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text,omitempty"`
+}
+
+func NewHTTPEmailDriver(endpoint, apiKey string) *HTTPEmailDriver {
+	return &HTTPEmailDriver{
+		endpoint: endpoint,
+		apiKey:   apiKey,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (d *HTTPEmailDriver) Send(ctx context.Context, msg *models.EmailMessage) error {
+	payload, err := json.Marshal(httpEmailPayload{
+		ID:      msg.ID.String(),
+		From:    msg.From,
+		To:      msg.To,
+		Subject: msg.Subject,
+		HTML:    msg.HTMLBody,
+		Text:    msg.TextBody,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", msg.ID.String())
+	if d.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+d.apiKey)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("email provider request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("email provider returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// buildMIMEMessage renders msg as a multipart/alternative message with a
+// plain text and an HTML part
+func buildMIMEMessage(msg *models.EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	domain := "localhost"
+	if from, err := mail.ParseAddress(msg.From); err == nil {
+		if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+			domain = from.Address[at+1:]
+		}
+	}
+
+	header := fmt.Sprintf("From: %s\r\n", stripHeaderBreaks(msg.From)) +
+		fmt.Sprintf("To: %s\r\n", stripHeaderBreaks(msg.To)) +
+		fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", msg.Subject)) +
+		fmt.Sprintf("Date: %s\r\n", msg.CreatedAt.Format(time.RFC1123Z)) +
+		fmt.Sprintf("Message-ID: <%s@%s>\r\n", msg.ID, domain) +
+		"MIME-Version: 1.0\r\n" +
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", msg.TextBody},
+		{"text/html; charset=UTF-8", msg.HTMLBody},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return append([]byte(header), buf.Bytes()...), nil
+}
+
+func stripHeaderBreaks(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/metering"
+)
+
+const (
+	emailOutboxInterval  = 5 * time.Second
+	emailOutboxBatchSize = 20
+	emailSendTimeout     = 30 * time.Second
+	// emailClaimLease must outlast a batch of sends so a slow batch is not
+	// picked up twice
+	emailClaimLease    = 15 * time.Minute
+	emailRetryBaseWait = time.Minute
+	emailRetryMaxWait  = time.Hour
+)
+
+// EmailOutboxWorker delivers queued emails through an EmailDriver, retrying
+// failures with exponential backoff until a message runs out of attempts.
+// Every email sent on behalf of a tenant is metered.
+type EmailOutboxWorker struct {
+	outbox repositories.EmailOutboxRepository
+	driver EmailDriver
+	meter  metering.Recorder
+	now    func() time.Time
+}
+
+func NewEmailOutboxWorker(outbox repositories.EmailOutboxRepository, driver EmailDriver, meter metering.Recorder) *EmailOutboxWorker {
+	return &EmailOutboxWorker{
+		outbox: outbox,
+		driver: driver,
+		meter:  meter,
+		now:    time.Now,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled
+func (w *EmailOutboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailOutboxInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			sent, err := w.ProcessDue(ctx)
+			if err != nil {
+				log.Printf("Email outbox: %v", err)
+			}
+			// A full batch means more may be waiting
+			if err != nil || sent < emailOutboxBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue claims one batch of due messages and attempts each once. It
+// returns how many messages it attempted.
+func (w *EmailOutboxWorker) ProcessDue(ctx context.Context) (int, error) {
+	messages, err := w.outbox.ClaimDue(ctx, w.now(), emailClaimLease, emailOutboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		w.deliver(ctx, msg)
+	}
+	return len(messages), nil
+}
+
+func (w *EmailOutboxWorker) deliver(ctx context.Context, msg *models.EmailMessage) {
+	// A worker that died after claiming the last attempt leaves the message
+	// to be claimed once more; give up on it without sending
+	if msg.Attempts > msg.MaxAttempts {
+		w.fail(ctx, msg, "delivery attempts exhausted")
+		return
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	err := w.driver.Send(sendCtx, msg)
+	cancel()
+
+	if err == nil {
+		if err := w.outbox.MarkSent(ctx, msg.ID, w.now()); err != nil {
+			log.Printf("Email outbox: failed to mark email %s sent: %v", msg.ID, err)
+		}
+		log.Printf("Email %s (%s) sent to %s", msg.ID, msg.Template, msg.To)
+		w.meterSend(ctx, msg)
+		return
+	}
+
+	if msg.Attempts >= msg.MaxAttempts {
+		w.fail(ctx, msg, err.Error())
+		return
+	}
+
+	next := w.now().Add(emailRetryDelay(msg.Attempts))
+	if err := w.outbox.MarkRetry(ctx, msg.ID, next, err.Error()); err != nil {
+		log.Printf("Email outbox: failed to reschedule email %s: %v", msg.ID, err)
+	}
+	log.Printf("Email %s to %s failed (attempt %d/%d), retrying at %s: %v",
+		msg.ID, msg.To, msg.Attempts, msg.MaxAttempts, next.Format(time.RFC3339), err)
+}
+
+func (w *EmailOutboxWorker) fail(ctx context.Context, msg *models.EmailMessage, reason string) {
+	if err := w.outbox.MarkFailed(ctx, msg.ID, reason); err != nil {
+		log.Printf("Email outbox: failed to mark email %s failed: %v", msg.ID, err)
+	}
+	log.Printf("Email %s to %s failed permanently after %d attempts: %s", msg.ID, msg.To, msg.MaxAttempts, reason)
+}
+
+// meterSend records a sent email as tenant usage. The message ID is the
+// idempotency key, so an email sent twice after a lost MarkSent is billed
+// once. Metering failures do not affect delivery.
+func (w *EmailOutboxWorker) meterSend(ctx context.Context, msg *models.EmailMessage) {
+	if msg.TenantID == nil {
+		return
+	}
+	err := w.meter.Record(ctx, metering.Event{
+		TenantID:       msg.TenantID.String(),
+		Metric:         metering.MetricEmailSends,
+		Quantity:       1,
+		OccurredAt:     w.now(),
+		IdempotencyKey: "email:" + msg.ID.String(),
+	})
+	if err != nil {
+		log.Printf("Email outbox: failed to meter email %s: %v", msg.ID, err)
+	}
+}
+
+// emailRetryDelay doubles the wait after every failed attempt, up to an hour
+func emailRetryDelay(attempts int) time.Duration {
+	delay := emailRetryBaseWait
+	for i := 1; i < attempts && delay < emailRetryMaxWait; i++ {
+		delay *= 2
+	}
+	if delay > emailRetryMaxWait {
+		delay = emailRetryMaxWait
+	}
+	return delay
+}
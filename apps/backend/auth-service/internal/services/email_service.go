@@ -1,202 +1,252 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
-	"net/smtp"
+	"net/mail"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
 )
 
-type SMTPEmailService struct {
-	host     string
-	port     string
-	username string
-	password string
-	from     string
-}
-
-func NewSMTPEmailService(host, port, username, password, from string) *SMTPEmailService {
-	return &SMTPEmailService{
-		host:     host,
-		port:     port,
-		username: username,
-		password: password,
-		from:     from,
-	}
-}
-
-// SendInvitationEmail sends user invitation email
-func (s *SMTPEmailService) SendInvitationEmail(email, token, inviterName, tenantName string) error {
-	subject := fmt.Sprintf("You're invited to join %s", tenantName)
-
-	body := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Team Invitation</title>
-</head>
-<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-        <h1 style="color: #2563eb;">You're Invited!</h1>
-        
-        <p>Hi there,</p>
-        
-        <p><strong>%s</strong> has invited you to join <strong>%s</strong>.</p>
-        
-        <p>Click the button below to accept your invitation and set up your account:</p>
-        
-        <div style="text-align: center; margin: 30px 0;">
-            <a href="http://localhost:3000/auth/accept-invitation?token=%s" 
-               style="background-color: #2563eb; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">
-                Accept Invitation
-            </a>
-        </div>
-        
-        <p>This invitation will expire in 7 days.</p>
-        
-        <p>If you didn't expect this invitation, you can safely ignore this email.</p>
-        
-        <hr style="margin: 30px 0;">
-        <p style="font-size: 12px; color: #666;">
-            If the button doesn't work, you can copy and paste this link into your browser:<br>
-            http://localhost:3000/auth/accept-invitation?token=%s
-        </p>
-    </div>
-</body>
-</html>`, inviterName, tenantName, token, token)
-
-	return s.sendEmail(email, subject, body)
-}
-
-// SendPasswordResetEmail sends password reset email
-func (s *SMTPEmailService) SendPasswordResetEmail(email, token, userName string) error {
-	subject := "Reset Your Password"
-
-	body := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Password Reset</title>
-</head>
-<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-        <h1 style="color: #dc2626;">Password Reset Request</h1>
-        
-        <p>Hi %s,</p>
-        
-        <p>We received a request to reset your password. If you made this request, click the button below to reset your password:</p>
-        
-        <div style="text-align: center; margin: 30px 0;">
-            <a href="http://localhost:3000/auth/reset-password?token=%s" 
-               style="background-color: #dc2626; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">
-                Reset Password
-            </a>
-        </div>
-        
-        <p>This link will expire in 1 hour for security reasons.</p>
-        
-        <p>If you didn't request a password reset, you can safely ignore this email. Your password will not be changed.</p>
-        
-        <hr style="margin: 30px 0;">
-        <p style="font-size: 12px; color: #666;">
-            If the button doesn't work, you can copy and paste this link into your browser:<br>
-            http://localhost:3000/auth/reset-password?token=%s
-        </p>
-    </div>
-</body>
-</html>`, userName, token, token)
-
-	return s.sendEmail(email, subject, body)
-}
-
-// SendVerificationEmail sends email verification email
-func (s *SMTPEmailService) SendVerificationEmail(email, token, userName string) error {
-	subject := "Verify Your Email Address"
-
-	body := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Email Verification</title>
-</head>
-<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
-    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
-        <h1 style="color: #059669;">Verify Your Email</h1>
-        
-        <p>Hi %s,</p>
-        
-        <p>Welcome! Please verify your email address to complete your account setup.</p>
-        
-        <div style="text-align: center; margin: 30px 0;">
-            <a href="http://localhost:3000/auth/verify-email?token=%s" 
-               style="background-color: #059669; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">
-                Verify Email
-            </a>
-        </div>
-        
-        <p>This verification link will expire in 24 hours.</p>
-        
-        <p>If you didn't create an account, you can safely ignore this email.</p>
-        
-        <hr style="margin: 30px 0;">
-        <p style="font-size: 12px; color: #666;">
-            If the button doesn't work, you can copy and paste this link into your browser:<br>
-            http://localhost:3000/auth/verify-email?token=%s
-        </p>
-    </div>
-</body>
-</html>`, userName, token, token)
-
-	return s.sendEmail(email, subject, body)
-}
-
-// sendEmail sends an email using SMTP
-func (s *SMTPEmailService) sendEmail(to, subject, body string) error {
-	// For development, just log the email
-	log.Printf("SEND EMAIL TO: %s", to)
-	log.Printf("SUBJECT: %s", subject)
-	log.Printf("BODY: %s", body)
-
-	// If SMTP is not configured, just return without error
-	if s.host == "" || s.username == "" {
-		log.Printf("SMTP not configured, email not sent")
-		return nil
-	}
-
-	// Build email message
-	message := s.buildMessage(s.from, to, subject, body)
-
-	// SMTP auth
-	auth := smtp.PlainAuth("", s.username, s.password, s.host)
-
-	// Send email
-	addr := fmt.Sprintf("%s:%s", s.host, s.port)
-	err := smtp.SendMail(addr, auth, s.from, []string{to}, []byte(message))
+// defaultEmailMaxAttempts spreads delivery over about two hours with the
+// worker's backoff
+const defaultEmailMaxAttempts = 8
+
+// OutboxEmailService renders emails with the recipient tenant's branding and
+// the recipient's language, then queues them in the outbox. Nothing is sent
+// while the request is handled; EmailOutboxWorker delivers and retries.
+type OutboxEmailService struct {
+	renderer    *emailRenderer
+	outbox      repositories.EmailOutboxRepository
+	userRepo    repositories.UserRepository
+	tenantRepo  repositories.TenantRepository
+	configRepo  repositories.TenantConfigRepository
+	from        string
+	fromName    string
+	appURL      *url.URL
+	baseDomain  string
+	maxAttempts int
+}
+
+// emailRequest describes one email before tenant settings are applied
+type emailRequest struct {
+	tenantID uuid.UUID
+	userID   uuid.UUID // uuid.Nil when the recipient has no account yet
+	to       string
+	name     string
+	template string
+	path     string
+	token    string
+	params   map[string]string
+}
+
+func NewOutboxEmailService(
+	outbox repositories.EmailOutboxRepository,
+	userRepo repositories.UserRepository,
+	tenantRepo repositories.TenantRepository,
+	configRepo repositories.TenantConfigRepository,
+	cfg *config.Config,
+) (*OutboxEmailService, error) {
+	renderer, err := newEmailRenderer()
 	if err != nil {
-		log.Printf("Failed to send email: %v", err)
-		return fmt.Errorf("failed to send email: %w", err)
+		return nil, err
+	}
+	appURL, err := url.Parse(cfg.AppURL)
+	if err != nil || appURL.Scheme == "" || appURL.Host == "" {
+		return nil, fmt.Errorf("invalid APP_URL %q", cfg.AppURL)
+	}
+
+	return &OutboxEmailService{
+		renderer:    renderer,
+		outbox:      outbox,
+		userRepo:    userRepo,
+		tenantRepo:  tenantRepo,
+		configRepo:  configRepo,
+		from:        cfg.SMTPFrom,
+		fromName:    cfg.SMTPFromName,
+		appURL:      appURL,
+		baseDomain:  strings.TrimPrefix(cfg.TenantBaseDomain, "."),
+		maxAttempts: defaultEmailMaxAttempts,
+	}, nil
+}
+
+// SendInvitationEmail queues an invitation to join tenantID
+func (s *OutboxEmailService) SendInvitationEmail(ctx context.Context, tenantID uuid.UUID, email, token, inviterName string) error {
+	return s.enqueue(ctx, &emailRequest{
+		tenantID: tenantID,
+		to:       email,
+		template: models.EmailTemplateInvitation,
+		path:     "/auth/accept-invitation",
+		token:    token,
+		params:   map[string]string{"inviter": inviterName},
+	})
+}
+
+// SendPasswordResetEmail queues a password reset link
+func (s *OutboxEmailService) SendPasswordResetEmail(ctx context.Context, user *models.User, token string) error {
+	return s.enqueue(ctx, userEmailRequest(user, models.EmailTemplatePasswordReset, "/auth/reset-password", token))
+}
+
+// SendVerificationEmail queues an email address verification link
+func (s *OutboxEmailService) SendVerificationEmail(ctx context.Context, user *models.User, token string) error {
+	return s.enqueue(ctx, userEmailRequest(user, models.EmailTemplateVerification, "/auth/verify-email", token))
+}
+
+// SendAccountLockedEmail tells a user their account was locked after failed
+// login attempts and links to an immediate unlock
+func (s *OutboxEmailService) SendAccountLockedEmail(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error {
+	req := userEmailRequest(user, models.EmailTemplateAccountLocked, "/auth/unlock-account", token)
+	req.params = map[string]string{"minutes": strconv.Itoa(int(lockedFor.Minutes()))}
+	return s.enqueue(ctx, req)
+}
+
+// SendTenantNoticeEmail queues a notice about the user's tenant, such as a
+// billing reminder, linking to the tenant's billing settings
+func (s *OutboxEmailService) SendTenantNoticeEmail(ctx context.Context, user *models.User, template string, params map[string]string) error {
+	req := userEmailRequest(user, template, "/settings/billing", "")
+	req.params = params
+	return s.enqueue(ctx, req)
+}
+
+func userEmailRequest(user *models.User, template, path, token string) *emailRequest {
+	return &emailRequest{
+		tenantID: user.TenantID,
+		userID:   user.ID,
+		to:       user.Email,
+		name:     strings.TrimSpace(user.FirstName + " " + user.LastName),
+		template: template,
+		path:     path,
+		token:    token,
 	}
+}
 
-	log.Printf("Email sent successfully to %s", to)
+func (s *OutboxEmailService) enqueue(ctx context.Context, req *emailRequest) error {
+	tenant, tenantConfig := s.tenantSettings(ctx, req.tenantID)
+
+	var branding models.BrandingConfig
+	if tenantConfig != nil && tenantConfig.BrandingConfig != "" {
+		if err := json.Unmarshal([]byte(tenantConfig.BrandingConfig), &branding); err != nil {
+			log.Printf("Invalid branding config for tenant %s, using defaults: %v", req.tenantID, err)
+			branding = models.BrandingConfig{}
+		}
+	}
+
+	var language string
+	if req.userID != uuid.Nil {
+		lang, err := s.userRepo.GetLanguage(ctx, req.userID)
+		if err != nil {
+			log.Printf("Failed to load language for user %s: %v", req.userID, err)
+		}
+		language = lang
+	}
+
+	params := map[string]string{}
+	if tenant != nil {
+		params["tenant"] = tenant.Name
+	}
+	for key, value := range req.params {
+		params[key] = value
+	}
+
+	rendered, err := s.renderer.Render(&emailContent{
+		Template:  req.template,
+		Language:  s.renderer.language(language, branding.DefaultLanguage),
+		Branding:  withBrandingDefaults(branding, s.fromName),
+		Name:      req.name,
+		ActionURL: s.link(tenant, tenantConfig, req.path, req.token),
+		Params:    params,
+	})
+	if err != nil {
+		return err
+	}
+
+	tenantID := req.tenantID
+	msg := &models.EmailMessage{
+		TenantID:    &tenantID,
+		Template:    req.template,
+		Language:    rendered.Language,
+		From:        s.sender(branding),
+		To:          req.to,
+		Subject:     rendered.Subject,
+		HTMLBody:    rendered.HTML,
+		TextBody:    rendered.Text,
+		MaxAttempts: s.maxAttempts,
+	}
+	if err := s.outbox.Enqueue(ctx, msg); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	log.Printf("Queued %s email %s to %s", req.template, msg.ID, req.to)
 	return nil
 }
 
-// buildMessage builds the email message
-func (s *SMTPEmailService) buildMessage(from, to, subject, body string) string {
-	var msg strings.Builder
+// tenantSettings loads what emails need from the tenant. Either result may be
+// nil, in which case the platform defaults apply.
+func (s *OutboxEmailService) tenantSettings(ctx context.Context, tenantID uuid.UUID) (*models.Tenant, *models.TenantConfiguration) {
+	if tenantID == uuid.Nil {
+		return nil, nil
+	}
 
-	msg.WriteString(fmt.Sprintf("From: %s\r\n", from))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
-	msg.WriteString("MIME-Version: 1.0\r\n")
-	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-	msg.WriteString("\r\n")
-	msg.WriteString(body)
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		log.Printf("Failed to load tenant %s for email: %v", tenantID, err)
+		tenant = nil
+	}
 
-	return msg.String()
+	tenantConfig, err := s.configRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		tenantConfig = nil
+	}
+
+	return tenant, tenantConfig
+}
+
+// link builds an absolute link on the tenant's own host: its custom domain,
+// else its subdomain under TENANT_BASE_DOMAIN, else APP_URL. The token, if
+// any, goes in the query string.
+func (s *OutboxEmailService) link(tenant *models.Tenant, tenantConfig *models.TenantConfiguration, path, token string) string {
+	link := *s.appURL
+	link.Path = strings.TrimSuffix(link.Path, "/") + path
+
+	host := ""
+	switch {
+	case tenantConfig != nil && tenantConfig.CustomDomain != "":
+		host = tenantConfig.CustomDomain
+	case tenant != nil && tenant.Domain != nil && *tenant.Domain != "":
+		host = *tenant.Domain
+	case tenant != nil && tenant.Subdomain != "" && s.baseDomain != "":
+		host = tenant.Subdomain + "." + s.baseDomain
+	}
+	if host != "" {
+		link.Host = host
+		link.Path = path
+	}
+
+	if token != "" {
+		link.RawQuery = url.Values{"token": {token}}.Encode()
+	}
+	return link.String()
+}
+
+// sender is the From header; the display name follows the tenant's branding
+func (s *OutboxEmailService) sender(branding models.BrandingConfig) string {
+	name := s.fromName
+	if branding.EmailFromName != "" {
+		name = branding.EmailFromName
+	} else if branding.CompanyName != "" {
+		name = branding.CompanyName
+	}
+	return (&mail.Address{Name: name, Address: s.from}).String()
 }
 
 // MockEmailService for testing and development
@@ -206,20 +256,32 @@ func NewMockEmailService() *MockEmailService {
 	return &MockEmailService{}
 }
 
-func (s *MockEmailService) SendInvitationEmail(email, token, inviterName, tenantName string) error {
+func (s *MockEmailService) SendInvitationEmail(ctx context.Context, tenantID uuid.UUID, email, token, inviterName string) error {
 	log.Printf("MOCK EMAIL - Invitation sent to %s from %s for tenant %s (token: %s)",
-		email, inviterName, tenantName, token)
+		email, inviterName, tenantID, token)
 	return nil
 }
 
-func (s *MockEmailService) SendPasswordResetEmail(email, token, userName string) error {
+func (s *MockEmailService) SendPasswordResetEmail(ctx context.Context, user *models.User, token string) error {
 	log.Printf("MOCK EMAIL - Password reset sent to %s for user %s (token: %s)",
-		email, userName, token)
+		user.Email, user.ID, token)
 	return nil
 }
 
-func (s *MockEmailService) SendVerificationEmail(email, token, userName string) error {
+func (s *MockEmailService) SendVerificationEmail(ctx context.Context, user *models.User, token string) error {
 	log.Printf("MOCK EMAIL - Verification sent to %s for user %s (token: %s)",
-		email, userName, token)
+		user.Email, user.ID, token)
+	return nil
+}
+
+func (s *MockEmailService) SendAccountLockedEmail(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error {
+	log.Printf("MOCK EMAIL - Account locked notice sent to %s for user %s, locked for %s (token: %s)",
+		user.Email, user.ID, lockedFor, token)
+	return nil
+}
+
+func (s *MockEmailService) SendTenantNoticeEmail(ctx context.Context, user *models.User, template string, params map[string]string) error {
+	log.Printf("MOCK EMAIL - %s notice sent to %s for tenant %s (params: %v)",
+		template, user.Email, user.TenantID, params)
 	return nil
 }
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+	"zplus-saas/apps/backend/shared/metering"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type emailFixture struct {
+	service    *OutboxEmailService
+	outbox     *fakeEmailOutboxRepository
+	userRepo   *fakeUserRepository
+	tenantRepo *fakeTenantRepository
+	configRepo *fakeTenantConfigRepository
+}
+
+func newEmailFixture(t *testing.T) *emailFixture {
+	t.Helper()
+
+	f := &emailFixture{
+		outbox:     newFakeEmailOutboxRepository(),
+		userRepo:   newFakeUserRepository(),
+		tenantRepo: &fakeTenantRepository{tenants: map[uuid.UUID]*models.Tenant{}},
+		configRepo: &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{}},
+	}
+	service, err := NewOutboxEmailService(f.outbox, f.userRepo, f.tenantRepo, f.configRepo, &config.Config{
+		SMTPFrom:         "noreply@zplus.test",
+		SMTPFromName:     "Zplus SaaS",
+		AppURL:           "https://app.zplus.test",
+		TenantBaseDomain: "zplus.test",
+	})
+	require.NoError(t, err)
+	f.service = service
+
+	return f
+}
+
+func TestOutboxEmailDeliversBrandedLocalizedEmailOverSMTP(t *testing.T) {
+	f := newEmailFixture(t)
+	ctx := context.Background()
+
+	tenantID := uuid.New()
+	f.tenantRepo.tenants[tenantID] = &models.Tenant{ID: tenantID, Name: "Acme", Subdomain: "acme", IsActive: true}
+	f.configRepo.configs[tenantID] = &models.TenantConfiguration{
+		TenantID:       tenantID,
+		CustomDomain:   "portal.acme.test",
+		BrandingConfig: `{"company_name": "Acme Consulting", "primary_color": "#ff6600", "support_email": "help@acme.test"}`,
+	}
+	user := &models.User{TenantID: tenantID, Email: "lan@acme.test", FirstName: "Lan", LastName: "Nguyen"}
+	require.NoError(t, f.userRepo.Create(ctx, user))
+	f.userRepo.languages[user.ID] = "vi-VN"
+
+	require.NoError(t, f.service.SendPasswordResetEmail(ctx, user, "reset-token"))
+
+	// Queuing does not deliver anything
+	queued := f.outbox.all()
+	require.Len(t, queued, 1)
+	assert.Equal(t, models.EmailStatusPending, queued[0].Status)
+	assert.Equal(t, "vi", queued[0].Language)
+
+	server := newSMTPStandIn(t)
+	host, port, err := net.SplitHostPort(server.addr)
+	require.NoError(t, err)
+	worker := NewEmailOutboxWorker(f.outbox, NewSMTPEmailDriver(host, port, "", ""), metering.Discard{})
+
+	sent, err := worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, models.EmailStatusSent, f.outbox.all()[0].Status)
+
+	received := server.messages()
+	require.Len(t, received, 1)
+	assert.Equal(t, "noreply@zplus.test", received[0].from)
+	assert.Equal(t, []string{"lan@acme.test"}, received[0].to)
+
+	email := parseTestEmail(t, received[0].data)
+	assert.Equal(t, "Đặt lại mật khẩu", email.subject)
+	assert.Contains(t, email.from, "Acme Consulting")
+	assert.Contains(t, email.html, "Xin chào Lan Nguyen,")
+	assert.Contains(t, email.html, "#ff6600")
+	assert.Contains(t, email.html, "help@acme.test")
+	assert.Contains(t, email.html, `href="https://portal.acme.test/auth/reset-password?token=reset-token"`)
+	assert.Contains(t, email.text, "https://portal.acme.test/auth/reset-password?token=reset-token")
+}
+
+func TestOutboxEmailFallsBackToSubdomainAndTenantLanguage(t *testing.T) {
+	f := newEmailFixture(t)
+	ctx := context.Background()
+
+	globex := uuid.New()
+	f.tenantRepo.tenants[globex] = &models.Tenant{ID: globex, Name: "Globex", Subdomain: "globex", IsActive: true}
+	initech := uuid.New()
+	f.tenantRepo.tenants[initech] = &models.Tenant{ID: initech, Name: "Initech", Subdomain: "initech", IsActive: true}
+	f.configRepo.configs[initech] = &models.TenantConfiguration{
+		TenantID:       initech,
+		BrandingConfig: `{"default_language": "vi", "primary_color": "red;background:url(x)"}`,
+	}
+
+	// Invitees have no profile, so the tenant's default language applies
+	require.NoError(t, f.service.SendInvitationEmail(ctx, globex, "eve@example.test", "invite-1", "<b>Eve</b>"))
+	require.NoError(t, f.service.SendInvitationEmail(ctx, initech, "bob@example.test", "invite-2", "Peter"))
+
+	queued := f.outbox.all()
+	require.Len(t, queued, 2)
+	byRecipient := map[string]*models.EmailMessage{queued[0].To: queued[0], queued[1].To: queued[1]}
+
+	english := byRecipient["eve@example.test"]
+	assert.Equal(t, "en", english.Language)
+	assert.Equal(t, "You're invited to join Globex", english.Subject)
+	assert.Equal(t, `"Zplus SaaS" <noreply@zplus.test>`, english.From)
+	assert.Contains(t, english.HTMLBody, `href="https://globex.zplus.test/auth/accept-invitation?token=invite-1"`)
+	assert.Contains(t, english.HTMLBody, "&lt;b&gt;Eve&lt;/b&gt; has invited you to join Globex.")
+	assert.Contains(t, english.HTMLBody, "Hi there,")
+
+	vietnamese := byRecipient["bob@example.test"]
+	assert.Equal(t, "vi", vietnamese.Language)
+	assert.Equal(t, "Bạn được mời tham gia Initech", vietnamese.Subject)
+	assert.Contains(t, vietnamese.HTMLBody, "https://initech.zplus.test/auth/accept-invitation?token=invite-2")
+	assert.Contains(t, vietnamese.HTMLBody, defaultEmailColor, "an invalid brand colour falls back to the default")
+	assert.NotContains(t, vietnamese.HTMLBody, "url(x)")
+}
+
+func TestTenantNoticeEmailsActiveAdminsOnly(t *testing.T) {
+	f := newEmailFixture(t)
+	ctx := context.Background()
+	notifications := NewTenantNotificationService(f.userRepo, f.service)
+
+	tenantID := uuid.New()
+	f.tenantRepo.tenants[tenantID] = &models.Tenant{ID: tenantID, Name: "Acme", Subdomain: "acme", IsActive: true}
+	admin := &models.User{TenantID: tenantID, Email: "admin@acme.test", FirstName: "Lan", Role: models.RoleAdmin}
+	member := &models.User{TenantID: tenantID, Email: "user@acme.test", Role: models.RoleUser}
+	inactive := &models.User{TenantID: tenantID, Email: "former@acme.test", Role: models.RoleAdmin}
+	for _, user := range []*models.User{admin, member, inactive} {
+		require.NoError(t, f.userRepo.Create(ctx, user))
+	}
+	inactive.IsActive = false
+	require.NoError(t, f.userRepo.Update(ctx, inactive))
+
+	notified, err := notifications.NotifyTenantAdmins(ctx, tenantID, &models.TenantNotificationRequest{
+		Template: models.EmailTemplateTenantSuspended,
+		Params:   map[string]string{"invoice": "INV-000042", "amount": "49.00 USD"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, notified)
+
+	queued := f.outbox.all()
+	require.Len(t, queued, 1)
+	assert.Equal(t, "admin@acme.test", queued[0].To)
+	assert.Equal(t, "Acme is now read-only", queued[0].Subject)
+	assert.Contains(t, queued[0].HTMLBody, "Invoice INV-000042 for 49.00 USD is still unpaid")
+	assert.Contains(t, queued[0].HTMLBody, `href="https://acme.zplus.test/settings/billing"`, "notices carry no token")
+
+	// Only notices may be sent on behalf of other services
+	_, err = notifications.NotifyTenantAdmins(ctx, tenantID, &models.TenantNotificationRequest{Template: models.EmailTemplatePasswordReset})
+	assert.Error(t, err)
+}
+
+func TestEmailOutboxWorkerRetriesWithBackoff(t *testing.T) {
+	outbox := newFakeEmailOutboxRepository()
+	ctx := context.Background()
+	tenantID := uuid.New()
+	require.NoError(t, outbox.Enqueue(ctx, &models.EmailMessage{
+		TenantID:    &tenantID,
+		Template:    models.EmailTemplateVerification,
+		From:        "noreply@zplus.test",
+		To:          "kim@example.test",
+		Subject:     "Verify Your Email Address",
+		HTMLBody:    "<p>Verify</p>",
+		MaxAttempts: 3,
+	}))
+
+	driver := &failingEmailDriver{err: fmt.Errorf("connection refused")}
+	worker := NewEmailOutboxWorker(outbox, driver, metering.Discard{})
+	now := time.Now()
+	worker.now = func() time.Time { return now }
+
+	sent, err := worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	msg := outbox.all()[0]
+	assert.Equal(t, models.EmailStatusPending, msg.Status)
+	assert.Equal(t, 1, msg.Attempts)
+	assert.Equal(t, now.Add(time.Minute), msg.NextAttemptAt)
+	require.NotNil(t, msg.LastError)
+	assert.Equal(t, "connection refused", *msg.LastError)
+
+	// Not due again until the backoff has passed
+	sent, err = worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	now = now.Add(time.Minute)
+	_, err = worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Minute), outbox.all()[0].NextAttemptAt)
+
+	now = now.Add(2 * time.Minute)
+	_, err = worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	msg = outbox.all()[0]
+	assert.Equal(t, models.EmailStatusFailed, msg.Status)
+	assert.Equal(t, 3, msg.Attempts)
+	assert.Equal(t, 3, driver.calls)
+
+	now = now.Add(24 * time.Hour)
+	sent, err = worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent, "failed emails are not retried")
+}
+
+func TestEmailRetryDelayIsCapped(t *testing.T) {
+	assert.Equal(t, time.Minute, emailRetryDelay(1))
+	assert.Equal(t, 8*time.Minute, emailRetryDelay(4))
+	assert.Equal(t, time.Hour, emailRetryDelay(7))
+	assert.Equal(t, time.Hour, emailRetryDelay(30))
+}
+
+type failingEmailDriver struct {
+	err   error
+	calls int
+}
+
+func (d *failingEmailDriver) Send(ctx context.Context, msg *models.EmailMessage) error {
+	d.calls++
+	return d.err
+}
+
+type fakeEmailOutboxRepository struct {
+	mu       sync.Mutex
+	messages map[uuid.UUID]*models.EmailMessage
+}
+
+func newFakeEmailOutboxRepository() *fakeEmailOutboxRepository {
+	return &fakeEmailOutboxRepository{messages: make(map[uuid.UUID]*models.EmailMessage)}
+}
+
+// all returns copies of the stored messages, oldest first
+func (r *fakeEmailOutboxRepository) all() []*models.EmailMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var messages []*models.EmailMessage
+	for _, msg := range r.messages {
+		copied := *msg
+		messages = append(messages, &copied)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].CreatedAt.Before(messages[j].CreatedAt) })
+	return messages
+}
+
+func (r *fakeEmailOutboxRepository) Enqueue(ctx context.Context, msg *models.EmailMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	msg.ID = uuid.New()
+	msg.Status = models.EmailStatusPending
+	msg.NextAttemptAt = now
+	msg.CreatedAt = now
+	msg.UpdatedAt = now
+	copied := *msg
+	r.messages[msg.ID] = &copied
+	return nil
+}
+
+func (r *fakeEmailOutboxRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.EmailMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var claimed []*models.EmailMessage
+	for _, msg := range r.messages {
+		if len(claimed) == limit {
+			break
+		}
+		if msg.Status != models.EmailStatusPending && msg.Status != models.EmailStatusSending {
+			continue
+		}
+		if msg.NextAttemptAt.After(now) {
+			continue
+		}
+		msg.Status = models.EmailStatusSending
+		msg.Attempts++
+		msg.NextAttemptAt = now.Add(lease)
+		copied := *msg
+		claimed = append(claimed, &copied)
+	}
+	return claimed, nil
+}
+
+func (r *fakeEmailOutboxRepository) MarkSent(ctx context.Context, id uuid.UUID, sentAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg := r.messages[id]
+	msg.Status = models.EmailStatusSent
+	msg.SentAt = &sentAt
+	msg.LastError = nil
+	return nil
+}
+
+func (r *fakeEmailOutboxRepository) MarkRetry(ctx context.Context, id uuid.UUID, nextAttemptAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg := r.messages[id]
+	msg.Status = models.EmailStatusPending
+	msg.NextAttemptAt = nextAttemptAt
+	msg.LastError = &lastError
+	return nil
+}
+
+func (r *fakeEmailOutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg := r.messages[id]
+	msg.Status = models.EmailStatusFailed
+	msg.LastError = &lastError
+	return nil
+}
+
+// smtpStandIn is a minimal SMTP server on the loopback interface that
+// accepts every message and records it
+type smtpStandIn struct {
+	addr     string
+	mu       sync.Mutex
+	received []smtpEnvelope
+}
+
+type smtpEnvelope struct {
+	from string
+	to   []string
+	data []byte
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &smtpStandIn{addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *smtpStandIn) messages() []smtpEnvelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpEnvelope(nil), s.received...)
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 stand-in ESMTP")
+
+	var envelope smtpEnvelope
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			text.PrintfLine("250-stand-in")
+			text.PrintfLine("250 8BITMIME")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			envelope = smtpEnvelope{from: smtpPath(line[len("MAIL FROM:"):])}
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			envelope.to = append(envelope.to, smtpPath(line[len("RCPT TO:"):]))
+			text.PrintfLine("250 OK")
+		case command == "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			envelope.data = data
+			s.mu.Lock()
+			s.received = append(s.received, envelope)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case command == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// smtpPath extracts the address from "<address> PARAMS"
+func smtpPath(arg string) string {
+	arg = strings.TrimSpace(arg)
+	if end := strings.Index(arg, ">"); strings.HasPrefix(arg, "<") && end > 0 {
+		return arg[1:end]
+	}
+	return arg
+}
+
+type testEmail struct {
+	from    string
+	subject string
+	text    string
+	html    string
+}
+
+// parseTestEmail decodes the headers and both parts of a message built by
+// buildMIMEMessage
+func parseTestEmail(t *testing.T, data []byte) *testEmail {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(data))))
+	require.NoError(t, err)
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	email := &testEmail{from: msg.Header.Get("From"), subject: subject}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		require.NoError(t, err)
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			email.text = string(body)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			email.html = string(body)
+		}
+	}
+	return email
+}
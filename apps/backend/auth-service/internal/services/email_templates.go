@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"path"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+)
+
+//go:embed templates/email
+var emailTemplateFS embed.FS
+
+const (
+	defaultEmailLanguage = "en"
+	defaultEmailColor    = "#2563eb"
+)
+
+var emailColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// emailCatalog holds one language's copy for every email. Placeholders such
+// as {name} or {tenant} are filled from the email's parameters.
+type emailCatalog struct {
+	Common struct {
+		Greeting          string `json:"greeting"`
+		GreetingAnonymous string `json:"greeting_anonymous"`
+		Fallback          string `json:"fallback"`
+		Footer            string `json:"footer"`
+		Support           string `json:"support"`
+	} `json:"common"`
+	Emails map[string]emailCopy `json:"emails"`
+}
+
+type emailCopy struct {
+	Subject    string   `json:"subject"`
+	Heading    string   `json:"heading"`
+	Paragraphs []string `json:"paragraphs"`
+	Action     string   `json:"action"`
+	Notes      []string `json:"notes"`
+}
+
+// emailContent is what a caller knows about an email before rendering
+type emailContent struct {
+	Template  string
+	Language  string
+	Branding  models.BrandingConfig
+	Name      string // recipient's display name, empty for invitations
+	ActionURL string
+	Params    map[string]string
+}
+
+type renderedEmail struct {
+	Language string
+	Subject  string
+	HTML     string
+	Text     string
+}
+
+// emailLayoutData is the data both layouts render
+type emailLayoutData struct {
+	Language     string
+	Subject      string
+	Heading      string
+	Greeting     string
+	Paragraphs   []string
+	ActionLabel  string
+	ActionURL    string
+	Notes        []string
+	FallbackText string
+	Footer       string
+	SupportText  string
+	Branding     models.BrandingConfig
+}
+
+// emailRenderer renders emails from the embedded layouts and translations.
+// Languages other than English may omit emails; those fall back to English.
+type emailRenderer struct {
+	html     *htmltemplate.Template
+	text     *texttemplate.Template
+	catalogs map[string]*emailCatalog
+}
+
+func newEmailRenderer() (*emailRenderer, error) {
+	html, err := htmltemplate.ParseFS(emailTemplateFS, "templates/email/layout.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML email layout: %w", err)
+	}
+	text, err := texttemplate.ParseFS(emailTemplateFS, "templates/email/layout.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse text email layout: %w", err)
+	}
+
+	files, err := emailTemplateFS.ReadDir("templates/email/locales")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email translations: %w", err)
+	}
+	catalogs := make(map[string]*emailCatalog)
+	for _, file := range files {
+		data, err := emailTemplateFS.ReadFile(path.Join("templates/email/locales", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		catalog := &emailCatalog{}
+		if err := json.Unmarshal(data, catalog); err != nil {
+			return nil, fmt.Errorf("invalid email translations %s: %w", file.Name(), err)
+		}
+		catalogs[strings.TrimSuffix(file.Name(), path.Ext(file.Name()))] = catalog
+	}
+
+	fallback, ok := catalogs[defaultEmailLanguage]
+	if !ok {
+		return nil, fmt.Errorf("missing %s email translations", defaultEmailLanguage)
+	}
+	for _, name := range []string{models.EmailTemplateInvitation, models.EmailTemplatePasswordReset, models.EmailTemplateVerification, models.EmailTemplateAccountLocked,
+		models.EmailTemplatePaymentFailed, models.EmailTemplateTenantSuspended, models.EmailTemplateTenantReactivated} {
+		if _, ok := fallback.Emails[name]; !ok {
+			return nil, fmt.Errorf("missing %s translations for email %s", defaultEmailLanguage, name)
+		}
+	}
+
+	return &emailRenderer{html: html, text: text, catalogs: catalogs}, nil
+}
+
+// language maps a profile language such as "vi-VN" to a supported catalog
+func (r *emailRenderer) language(preferred ...string) string {
+	for _, lang := range preferred {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if i := strings.IndexAny(lang, "-_"); i > 0 {
+			lang = lang[:i]
+		}
+		if _, ok := r.catalogs[lang]; ok {
+			return lang
+		}
+	}
+	return defaultEmailLanguage
+}
+
+func (r *emailRenderer) Render(content *emailContent) (*renderedEmail, error) {
+	lang := r.language(content.Language)
+	catalog := r.catalogs[lang]
+	body, ok := catalog.Emails[content.Template]
+	if !ok {
+		lang = defaultEmailLanguage
+		catalog = r.catalogs[lang]
+		if body, ok = catalog.Emails[content.Template]; !ok {
+			return nil, fmt.Errorf("unknown email template %s", content.Template)
+		}
+	}
+
+	pairs := []string{"{name}", content.Name, "{company}", content.Branding.CompanyName}
+	for key, value := range content.Params {
+		pairs = append(pairs, "{"+key+"}", value)
+	}
+	fill := strings.NewReplacer(pairs...).Replace
+	fillAll := func(lines []string) []string {
+		filled := make([]string, len(lines))
+		for i, line := range lines {
+			filled[i] = fill(line)
+		}
+		return filled
+	}
+
+	greeting := catalog.Common.GreetingAnonymous
+	if content.Name != "" {
+		greeting = catalog.Common.Greeting
+	}
+	data := &emailLayoutData{
+		Language:     lang,
+		Subject:      fill(body.Subject),
+		Heading:      fill(body.Heading),
+		Greeting:     fill(greeting),
+		Paragraphs:   fillAll(body.Paragraphs),
+		ActionLabel:  fill(body.Action),
+		ActionURL:    content.ActionURL,
+		Notes:        fillAll(body.Notes),
+		FallbackText: fill(catalog.Common.Fallback),
+		Footer:       fill(catalog.Common.Footer),
+		SupportText:  fill(catalog.Common.Support),
+		Branding:     content.Branding,
+	}
+
+	var html, text bytes.Buffer
+	if err := r.html.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("failed to render email %s: %w", content.Template, err)
+	}
+	if err := r.text.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render email %s: %w", content.Template, err)
+	}
+
+	return &renderedEmail{Language: lang, Subject: data.Subject, HTML: html.String(), Text: text.String()}, nil
+}
+
+// withBrandingDefaults fills what a tenant left out of its branding config.
+// Colours end up inside style attributes, so anything but a hex colour is
+// replaced.
+func withBrandingDefaults(branding models.BrandingConfig, companyName string) models.BrandingConfig {
+	if branding.CompanyName == "" {
+		branding.CompanyName = companyName
+	}
+	if !emailColorPattern.MatchString(branding.PrimaryColor) {
+		branding.PrimaryColor = defaultEmailColor
+	}
+	return branding
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -26,7 +27,7 @@ func NewEmailVerificationService(db *sqlx.DB, emailService EmailService) *EmailV
 func (s *EmailVerificationService) SendVerificationEmail(userID uuid.UUID) error {
 	// Get user info
 	var user models.User
-	err := s.db.Get(&user, "SELECT id, email, first_name, last_name, is_verified FROM users WHERE id = $1", userID)
+	err := s.db.Get(&user, "SELECT id, tenant_id, email, first_name, last_name, is_verified FROM users WHERE id = $1", userID)
 	if err != nil {
 		return fmt.Errorf("user not found")
 	}
@@ -67,9 +68,8 @@ func (s *EmailVerificationService) SendVerificationEmail(userID uuid.UUID) error
 		return fmt.Errorf("failed to save verification token: %w", err)
 	}
 
-	// Send verification email
-	userName := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
-	err = s.email.SendVerificationEmail(user.Email, token, userName)
+	// Queue verification email
+	err = s.email.SendVerificationEmail(context.Background(), &user, token)
 	if err != nil {
 		return fmt.Errorf("failed to send verification email: %w", err)
 	}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+)
+
+// HRMEmployee is the employee record created in hrm-service for provisioned users
+type HRMEmployee struct {
+	UserID       *string   `json:"user_id,omitempty"`
+	EmployeeCode string    `json:"employee_code"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Email        string    `json:"email"`
+	DepartmentID int       `json:"department_id"`
+	Position     string    `json:"position"`
+	HireDate     time.Time `json:"hire_date"`
+	Salary       float64   `json:"salary"`
+	Status       string    `json:"status"`
+}
+
+// HRMClient talks to hrm-service on behalf of a tenant
+type HRMClient interface {
+	EmployeeExists(ctx context.Context, tenantID uuid.UUID, email string) (bool, error)
+	FindDepartmentID(ctx context.Context, tenantID uuid.UUID, name string) (int, error)
+	CreateEmployee(ctx context.Context, tenantID uuid.UUID, employee *HRMEmployee) error
+}
+
+// hrmServicePermissions are granted to the service tokens the client sends.
+// Provisioning has to see every employee of the tenant to avoid duplicates.
+var hrmServicePermissions = []string{
+	"hrm.employee.read",
+	"hrm.employee.write",
+	"hrm.employee.scope.tenant",
+	"hrm.department.read",
+}
+
+const hrmServiceTokenTTL = time.Minute
+
+type hrmClient struct {
+	baseURL    string
+	jwtService JWTService
+	httpClient *http.Client
+}
+
+func NewHRMClient(cfg *config.Config, jwtService JWTService) HRMClient {
+	return &hrmClient{
+		baseURL:    strings.TrimSuffix(cfg.HRMServiceURL, "/"),
+		jwtService: jwtService,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c *hrmClient) EmployeeExists(ctx context.Context, tenantID uuid.UUID, email string) (bool, error) {
+	resp, err := c.do(ctx, tenantID, http.MethodGet, "/api/v1/employees/by-email?email="+url.QueryEscape(email), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("hrm-service returned status %d", resp.StatusCode)
+	}
+}
+
+// FindDepartmentID returns the ID of the tenant's department with the given name
+func (c *hrmClient) FindDepartmentID(ctx context.Context, tenantID uuid.UUID, name string) (int, error) {
+	resp, err := c.do(ctx, tenantID, http.MethodGet, "/api/v1/departments?limit=100", nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("hrm-service returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data []struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("invalid departments response: %w", err)
+	}
+
+	for _, department := range body.Data {
+		if strings.EqualFold(department.Name, name) {
+			return department.ID, nil
+		}
+	}
+
+	return 0, fmt.Errorf("department %s not found", name)
+}
+
+func (c *hrmClient) CreateEmployee(ctx context.Context, tenantID uuid.UUID, employee *HRMEmployee) error {
+	payload, err := json.Marshal(employee)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, tenantID, http.MethodPost, "/api/v1/employees", payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("hrm-service returned status %d: %s", resp.StatusCode, body.Message)
+	}
+
+	return nil
+}
+
+func (c *hrmClient) do(ctx context.Context, tenantID uuid.UUID, method, path string, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := c.jwtService.GenerateServiceToken(tenantID, hrmServicePermissions, hrmServiceTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Tenant-ID", tenantID.String())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("hrm-service request failed: %w", err)
+	}
+
+	return resp, nil
+}
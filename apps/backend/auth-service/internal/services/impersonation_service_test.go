@@ -0,0 +1,167 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type impersonationTestFixture struct {
+	svc       *impersonationService
+	userRepo  *fakeUserRepository
+	auditRepo *fakeAuditRepository
+	jwt       JWTService
+	tenantID  uuid.UUID
+}
+
+func newImpersonationTestFixture(t *testing.T) *impersonationTestFixture {
+	f := &impersonationTestFixture{
+		userRepo:  newFakeUserRepository(),
+		auditRepo: &fakeAuditRepository{},
+		jwt:       NewJWTService(&config.Config{JWTSecret: "test-secret"}),
+		tenantID:  uuid.New(),
+	}
+	f.svc = NewImpersonationService(f.userRepo, newFakeRoleRepository(), f.auditRepo, f.jwt).(*impersonationService)
+	return f
+}
+
+func (f *impersonationTestFixture) createUser(t *testing.T, tenantID uuid.UUID, role string) *models.User {
+	user := &models.User{TenantID: tenantID, Email: role + "-" + uuid.NewString() + "@example.com", Role: role}
+	require.NoError(t, f.userRepo.Create(context.Background(), user))
+	return user
+}
+
+func TestImpersonationTokenCarriesActorAndIsAudited(t *testing.T) {
+	f := newImpersonationTestFixture(t)
+	ctx := context.Background()
+	admin := f.createUser(t, uuid.New(), models.RoleSuperAdmin)
+	target := f.createUser(t, f.tenantID, models.RoleUser)
+
+	session, err := f.svc.Start(ctx, admin.ID, admin.TenantID, "203.0.113.7", &models.ImpersonationRequest{
+		UserID:   target.ID,
+		TenantID: f.tenantID,
+		Reason:   "ticket #4211: cannot see leads",
+	})
+	require.NoError(t, err)
+	assert.True(t, session.Impersonation)
+	assert.Equal(t, admin.ID, session.Actor.ID)
+	assert.Equal(t, target.ID, session.User.ID)
+	assert.Equal(t, []string{"crm.lead.read"}, session.Permissions)
+	assert.Equal(t, int64(defaultImpersonationTTL.Seconds()), session.ExpiresIn)
+
+	token, err := f.jwt.ValidateToken(session.AccessToken)
+	require.NoError(t, err)
+	claims, err := f.jwt.ParseUserClaims(token)
+	require.NoError(t, err)
+	assert.Equal(t, target.ID.String(), claims.UserID)
+	assert.Equal(t, f.tenantID.String(), claims.TenantID)
+	require.NotNil(t, claims.Act)
+	assert.Equal(t, admin.ID.String(), claims.Act.Subject)
+	assert.Equal(t, session.SessionID.String(), claims.ID)
+
+	require.Len(t, f.auditRepo.entries, 1)
+	entry := f.auditRepo.entries[0]
+	assert.Equal(t, models.AuditActionImpersonation, entry.Action)
+	assert.Equal(t, admin.ID, *entry.ActorID)
+	assert.Equal(t, target.ID, *entry.TargetUserID)
+	assert.Equal(t, f.tenantID, *entry.TenantID)
+	assert.Equal(t, "203.0.113.7", entry.IPAddress)
+	assert.Equal(t, "ticket #4211: cannot see leads", entry.Details["reason"])
+	assert.Equal(t, session.SessionID.String(), entry.Details["session_id"])
+}
+
+func TestImpersonationRules(t *testing.T) {
+	f := newImpersonationTestFixture(t)
+	ctx := context.Background()
+	superAdmin := f.createUser(t, uuid.New(), models.RoleSuperAdmin)
+	otherSuperAdmin := f.createUser(t, uuid.New(), models.RoleSuperAdmin)
+	tenantAdmin := f.createUser(t, f.tenantID, models.RoleAdmin)
+	otherAdmin := f.createUser(t, f.tenantID, models.RoleAdmin)
+	manager := f.createUser(t, f.tenantID, models.RoleManager)
+	user := f.createUser(t, f.tenantID, models.RoleUser)
+	foreignUser := f.createUser(t, uuid.New(), models.RoleUser)
+
+	start := func(actor, target *models.User) error {
+		_, err := f.svc.Start(ctx, actor.ID, actor.TenantID, "", &models.ImpersonationRequest{
+			UserID:   target.ID,
+			TenantID: target.TenantID,
+			Reason:   "support",
+		})
+		return err
+	}
+
+	// A super admin can impersonate any tenant's admins and users, but not another super admin or themselves
+	assert.NoError(t, start(superAdmin, tenantAdmin))
+	assert.NoError(t, start(superAdmin, foreignUser))
+	assert.ErrorIs(t, start(superAdmin, otherSuperAdmin), ErrImpersonationForbidden)
+	assert.ErrorIs(t, start(superAdmin, superAdmin), ErrImpersonationForbidden)
+
+	// Tenant admins and everyone else are refused, even for users of their own tenant
+	assert.ErrorIs(t, start(tenantAdmin, user), ErrImpersonationForbidden)
+	assert.ErrorIs(t, start(tenantAdmin, otherAdmin), ErrImpersonationForbidden)
+	assert.ErrorIs(t, start(tenantAdmin, foreignUser), ErrImpersonationForbidden)
+	assert.ErrorIs(t, start(manager, user), ErrImpersonationForbidden)
+
+	// Inactive users cannot be impersonated
+	f.userRepo.users[user.ID].IsActive = false
+	assert.Error(t, start(superAdmin, user))
+
+	// A reason is required
+	_, err := f.svc.Start(ctx, superAdmin.ID, superAdmin.TenantID, "", &models.ImpersonationRequest{
+		UserID:   manager.ID,
+		TenantID: f.tenantID,
+	})
+	assert.Error(t, err)
+
+	assert.Len(t, f.auditRepo.entries, 2)
+}
+
+func TestImpersonationDurationIsCapped(t *testing.T) {
+	f := newImpersonationTestFixture(t)
+	admin := f.createUser(t, uuid.New(), models.RoleSuperAdmin)
+	target := f.createUser(t, f.tenantID, models.RoleManager)
+
+	session, err := f.svc.Start(context.Background(), admin.ID, admin.TenantID, "", &models.ImpersonationRequest{
+		UserID:          target.ID,
+		TenantID:        f.tenantID,
+		Reason:          "support",
+		DurationMinutes: 600,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(maxImpersonationTTL.Seconds()), session.ExpiresIn)
+
+	token, err := f.jwt.ValidateToken(session.AccessToken)
+	require.NoError(t, err)
+	claims, err := f.jwt.ParseUserClaims(token)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(maxImpersonationTTL), claims.ExpiresAt.Time, 5*time.Second)
+}
+
+func TestImpersonationFailsWithoutAuditEntry(t *testing.T) {
+	f := newImpersonationTestFixture(t)
+	f.svc.auditRepo = failingAuditRepository{}
+	admin := f.createUser(t, uuid.New(), models.RoleSuperAdmin)
+	target := f.createUser(t, f.tenantID, models.RoleUser)
+
+	session, err := f.svc.Start(context.Background(), admin.ID, admin.TenantID, "", &models.ImpersonationRequest{
+		UserID:   target.ID,
+		TenantID: f.tenantID,
+		Reason:   "support",
+	})
+	assert.Error(t, err)
+	assert.Nil(t, session)
+}
+
+type failingAuditRepository struct{}
+
+func (failingAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return errors.New("audit log unavailable")
+}
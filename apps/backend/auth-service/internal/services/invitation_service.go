@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -15,29 +16,40 @@ import (
 )
 
 type InvitationService struct {
-	db    *sqlx.DB
-	email EmailService
+	db             *sqlx.DB
+	email          EmailService
+	passwordPolicy PasswordPolicyService
+	tenants        TenantClient
 }
 
+// EmailService sends the transactional emails. The tenant's branding, the
+// recipient's language and the link host are resolved by the implementation.
 type EmailService interface {
-	SendInvitationEmail(email, token, inviterName, tenantName string) error
-	SendPasswordResetEmail(email, token, userName string) error
-	SendVerificationEmail(email, token, userName string) error
+	SendInvitationEmail(ctx context.Context, tenantID uuid.UUID, email, token, inviterName string) error
+	SendPasswordResetEmail(ctx context.Context, user *models.User, token string) error
+	SendVerificationEmail(ctx context.Context, user *models.User, token string) error
+	SendAccountLockedEmail(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error
+	SendTenantNoticeEmail(ctx context.Context, user *models.User, template string, params map[string]string) error
 }
 
-func NewInvitationService(db *sqlx.DB, emailService EmailService) *InvitationService {
+func NewInvitationService(db *sqlx.DB, emailService EmailService, passwordPolicy PasswordPolicyService, tenants TenantClient) *InvitationService {
 	return &InvitationService{
-		db:    db,
-		email: emailService,
+		db:             db,
+		email:          emailService,
+		passwordPolicy: passwordPolicy,
+		tenants:        tenants,
 	}
 }
 
 // InviteUser creates and sends a user invitation
 func (s *InvitationService) InviteUser(tenantID, inviterID uuid.UUID, email, role string) (*models.UserInvitation, error) {
-	// Check if user already exists
+	// Check if user already belongs to the tenant. Users of other tenants can
+	// be invited and join with their existing account.
 	var existingUser models.User
 	err := s.db.Get(&existingUser,
-		"SELECT id FROM users WHERE email = $1 AND tenant_id = $2",
+		`SELECT u.id FROM users u
+		JOIN tenant_memberships m ON m.user_id = u.id
+		WHERE u.email = $1 AND m.tenant_id = $2 AND m.is_active = true`,
 		email, tenantID)
 	if err == nil {
 		return nil, fmt.Errorf("user with email %s already exists in this tenant", email)
@@ -52,6 +64,11 @@ func (s *InvitationService) InviteUser(tenantID, inviterID uuid.UUID, email, rol
 		return nil, fmt.Errorf("invitation already sent to %s", email)
 	}
 
+	// A pending invitation holds a seat until it is accepted or expires
+	if err := checkSeats(context.Background(), s.tenants, tenantID, 1); err != nil {
+		return nil, err
+	}
+
 	// Generate invitation token
 	token, err := generateSecureToken(32)
 	if err != nil {
@@ -82,17 +99,14 @@ func (s *InvitationService) InviteUser(tenantID, inviterID uuid.UUID, email, rol
 		return nil, fmt.Errorf("failed to save invitation: %w", err)
 	}
 
-	// Get inviter and tenant info for email
+	// Get inviter info for email
 	var inviter models.User
-	var tenant models.Tenant
-
 	s.db.Get(&inviter, "SELECT first_name, last_name FROM users WHERE id = $1", inviterID)
-	s.db.Get(&tenant, "SELECT name FROM tenants WHERE id = $1", tenantID)
 
 	inviterName := fmt.Sprintf("%s %s", inviter.FirstName, inviter.LastName)
 
-	// Send invitation email
-	err = s.email.SendInvitationEmail(email, token, inviterName, tenant.Name)
+	// Queue invitation email
+	err = s.email.SendInvitationEmail(context.Background(), tenantID, email, token, inviterName)
 	if err != nil {
 		log.Printf("Failed to send invitation email to %s: %v", email, err)
 		// Don't fail the invitation if email fails
@@ -120,6 +134,26 @@ func (s *InvitationService) AcceptInvitation(token string, req *models.AcceptInv
 		return nil, fmt.Errorf("invitation has expired")
 	}
 
+	// The invitation already holds a seat, accepting it only fails if the
+	// plan has since lost seats
+	if err := checkSeats(context.Background(), s.tenants, invitation.TenantID, 0); err != nil {
+		return nil, err
+	}
+
+	// An existing account joins the tenant instead of getting a second identity
+	var existingUser models.User
+	err = s.db.Get(&existingUser,
+		"SELECT id, tenant_id, email, password_hash, first_name, last_name, is_active, is_verified FROM users WHERE email = $1 ORDER BY created_at LIMIT 1",
+		invitation.Email)
+	if err == nil {
+		return s.acceptAsExistingUser(&invitation, &existingUser, req.Password)
+	}
+
+	ctx := context.Background()
+	if err := s.passwordPolicy.Validate(ctx, invitation.TenantID, uuid.Nil, req.Password); err != nil {
+		return nil, err
+	}
+
 	// Hash password
 	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
@@ -158,6 +192,12 @@ func (s *InvitationService) AcceptInvitation(token string, req *models.AcceptInv
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	_, err = tx.Exec("INSERT INTO tenant_memberships (user_id, tenant_id, role) VALUES ($1, $2, $3)",
+		user.ID, user.TenantID, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add membership: %w", err)
+	}
+
 	// Update invitation status
 	_, err = tx.Exec("UPDATE user_invitations SET status = $1, accepted_at = $2, updated_at = $3 WHERE id = $4",
 		models.InvitationStatusAccepted, time.Now(), time.Now(), invitation.ID)
@@ -189,6 +229,50 @@ func (s *InvitationService) AcceptInvitation(token string, req *models.AcceptInv
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	if err := s.passwordPolicy.RecordPassword(ctx, user.ID, user.Password); err != nil {
+		log.Printf("Failed to record password history for user %s: %v", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// acceptAsExistingUser adds an existing account to the invitation's tenant.
+// The account's own password proves the invitee owns it; the names in the
+// request are ignored.
+func (s *InvitationService) acceptAsExistingUser(invitation *models.UserInvitation, user *models.User, password string) (*models.User, error) {
+	if !user.IsActive {
+		return nil, fmt.Errorf("account is deactivated")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, fmt.Errorf("an account with this email already exists, enter its password to join")
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO tenant_memberships (user_id, tenant_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, tenant_id) DO UPDATE SET role = EXCLUDED.role, is_active = true`,
+		user.ID, invitation.TenantID, invitation.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add membership: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE user_invitations SET status = $1, accepted_at = $2, updated_at = $3 WHERE id = $4",
+		models.InvitationStatusAccepted, time.Now(), time.Now(), invitation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update invitation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	user.TenantID = invitation.TenantID
+	user.Role = invitation.Role
 	return user, nil
 }
 
@@ -245,17 +329,14 @@ func (s *InvitationService) ResendInvitation(invitationID uuid.UUID) error {
 			invitation.ExpiresAt, time.Now(), invitation.ID)
 	}
 
-	// Get inviter and tenant info
+	// Get inviter info
 	var inviter models.User
-	var tenant models.Tenant
-
 	s.db.Get(&inviter, "SELECT first_name, last_name FROM users WHERE id = $1", invitation.InvitedBy)
-	s.db.Get(&tenant, "SELECT name FROM tenants WHERE id = $1", invitation.TenantID)
 
 	inviterName := fmt.Sprintf("%s %s", inviter.FirstName, inviter.LastName)
 
 	// Resend email
-	return s.email.SendInvitationEmail(invitation.Email, invitation.Token, inviterName, tenant.Name)
+	return s.email.SendInvitationEmail(context.Background(), invitation.TenantID, invitation.Email, invitation.Token, inviterName)
 }
 
 // generateSecureToken generates a cryptographically secure random token
@@ -6,25 +6,36 @@ import (
 
 	"zplus-saas/apps/backend/auth-service/internal/models"
 	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
 type JWTService interface {
-	GenerateTokens(user *models.User) (*models.TokenResponse, error)
+	GenerateTokens(user *models.User, permissions []string, ssoTenantID uuid.UUID) (*models.TokenResponse, error)
 	ValidateToken(tokenString string) (*jwt.Token, error)
 	ParseUserClaims(token *jwt.Token) (*UserClaims, error)
 	GenerateRefreshToken() (string, error)
+	GenerateServiceToken(tenantID uuid.UUID, permissions []string, ttl time.Duration) (string, error)
+	GenerateAPIKeyToken(key *models.APIKey, user *models.User, permissions []string, ttl time.Duration) (string, error)
+	GenerateImpersonationToken(user, actor *models.User, permissions []string, sessionID uuid.UUID, ttl time.Duration) (string, error)
 }
 
 type UserClaims struct {
-	UserID     string `json:"user_id"`
-	TenantID   string `json:"tenant_id"`
-	Email      string `json:"email"`
-	Role       string `json:"role"`
-	IsActive   bool   `json:"is_active"`
-	IsVerified bool   `json:"is_verified"`
+	UserID      string   `json:"user_id"`
+	TenantID    string   `json:"tenant_id"`
+	Email       string   `json:"email"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions,omitempty"`
+	IsActive    bool     `json:"is_active"`
+	IsVerified  bool     `json:"is_verified"`
+	APIKeyID    string   `json:"api_key_id,omitempty"` // set when the token was exchanged for an API key
+	// SSOTenantID names the tenant whose identity provider signed the session
+	// in; empty for password sessions
+	SSOTenantID string `json:"sso_tenant_id,omitempty"`
+	// Act names the system admin behind an impersonation token
+	Act *sharedmiddleware.ActorClaims `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -38,7 +49,11 @@ func NewJWTService(cfg *config.Config) JWTService {
 	}
 }
 
-func (s *jwtService) GenerateTokens(user *models.User) (*models.TokenResponse, error) {
+// GenerateTokens issues an access/refresh token pair. The user's effective
+// permissions are embedded in the access token for RequirePermission, and
+// both tokens carry the tenant whose identity provider authenticated the
+// session, if any, so refreshing keeps it.
+func (s *jwtService) GenerateTokens(user *models.User, permissions []string, ssoTenantID uuid.UUID) (*models.TokenResponse, error) {
 	// Parse expiration durations
 	accessDuration, err := time.ParseDuration(s.config.JWTExpiresIn)
 	if err != nil {
@@ -54,14 +69,21 @@ func (s *jwtService) GenerateTokens(user *models.User) (*models.TokenResponse, e
 	accessExpiry := now.Add(accessDuration)
 	refreshExpiry := now.Add(refreshDuration)
 
+	var ssoTenant string
+	if ssoTenantID != uuid.Nil {
+		ssoTenant = ssoTenantID.String()
+	}
+
 	// Create access token claims
 	accessClaims := &UserClaims{
-		UserID:     user.ID.String(),
-		TenantID:   user.TenantID.String(),
-		Email:      user.Email,
-		Role:       user.Role,
-		IsActive:   user.IsActive,
-		IsVerified: user.IsVerified,
+		UserID:      user.ID.String(),
+		TenantID:    user.TenantID.String(),
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: permissions,
+		IsActive:    user.IsActive,
+		IsVerified:  user.IsVerified,
+		SSOTenantID: ssoTenant,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(accessExpiry),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -81,9 +103,10 @@ func (s *jwtService) GenerateTokens(user *models.User) (*models.TokenResponse, e
 
 	// Create refresh token claims
 	refreshClaims := &UserClaims{
-		UserID:   user.ID.String(),
-		TenantID: user.TenantID.String(),
-		Email:    user.Email,
+		UserID:      user.ID.String(),
+		TenantID:    user.TenantID.String(),
+		Email:       user.Email,
+		SSOTenantID: ssoTenant,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(refreshExpiry),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -107,6 +130,7 @@ func (s *jwtService) GenerateTokens(user *models.User) (*models.TokenResponse, e
 		TokenType:    "Bearer",
 		ExpiresIn:    int64(accessDuration.Seconds()),
 		User:         user,
+		Permissions:  permissions,
 	}, nil
 }
 
@@ -117,7 +141,7 @@ func (s *jwtService) ValidateToken(tokenString string) (*jwt.Token, error) {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 		return []byte(s.config.JWTSecret), nil
-	})
+	}, jwt.WithIssuer(s.config.JWTIssuer))
 
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
@@ -127,6 +151,11 @@ func (s *jwtService) ValidateToken(tokenString string) (*jwt.Token, error) {
 		return nil, fmt.Errorf("token is not valid")
 	}
 
+	claims := token.Claims.(*UserClaims)
+	if err := sharedmiddleware.VerifyTokenAudience(s.config, claims.Role, claims.Audience); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
 	return token, nil
 }
 
@@ -167,3 +196,112 @@ func (s *jwtService) GenerateRefreshToken() (string, error) {
 
 	return tokenString, nil
 }
+
+// GenerateServiceToken issues a short-lived access token for auth-service's
+// own calls to other services on behalf of a tenant. It carries no user, so
+// permissions must include the data scope the call needs.
+func (s *jwtService) GenerateServiceToken(tenantID uuid.UUID, permissions []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := &UserClaims{
+		TenantID:    tenantID.String(),
+		Role:        sharedmiddleware.RoleService,
+		Permissions: permissions,
+		IsActive:    true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.config.JWTIssuer,
+			Audience:  []string{sharedmiddleware.TokenAudience(s.config, sharedmiddleware.RoleService)},
+			Subject:   "auth-service",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign service token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// GenerateAPIKeyToken issues a short-lived access token for an API key. A
+// personal key acts as its user (with role api_key); a service account key
+// acts as the service account, whose ID becomes the token's user ID.
+func (s *jwtService) GenerateAPIKeyToken(key *models.APIKey, user *models.User, permissions []string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := &UserClaims{
+		TenantID:    key.TenantID.String(),
+		Role:        models.RoleServiceAccount,
+		Permissions: permissions,
+		IsActive:    true,
+		IsVerified:  true,
+		APIKeyID:    key.ID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.config.JWTIssuer,
+			Audience:  []string{s.config.JWTAudience},
+		},
+	}
+	if user != nil {
+		claims.UserID = user.ID.String()
+		claims.Email = user.Email
+		claims.Role = models.RoleAPIKey
+		claims.IsVerified = user.IsVerified
+	} else if key.ServiceAccountID != nil {
+		claims.UserID = key.ServiceAccountID.String()
+	}
+	claims.Subject = claims.UserID
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign API key token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// GenerateImpersonationToken issues an access token that acts as user on
+// behalf of actor, a system admin. It has no refresh token, and the session
+// ID is the token ID recorded in the audit log.
+func (s *jwtService) GenerateImpersonationToken(user, actor *models.User, permissions []string, sessionID uuid.UUID, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	claims := &UserClaims{
+		UserID:      user.ID.String(),
+		TenantID:    user.TenantID.String(),
+		Email:       user.Email,
+		Role:        user.Role,
+		Permissions: permissions,
+		IsActive:    user.IsActive,
+		IsVerified:  user.IsVerified,
+		Act: &sharedmiddleware.ActorClaims{
+			Subject: actor.ID.String(),
+			Email:   actor.Email,
+			Role:    actor.Role,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID.String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    s.config.JWTIssuer,
+			Audience:  []string{s.config.JWTAudience},
+			Subject:   user.ID.String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.config.JWTSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign impersonation token: %w", err)
+	}
+
+	return tokenString, nil
+}
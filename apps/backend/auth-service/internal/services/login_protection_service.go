@@ -0,0 +1,396 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/google/uuid"
+)
+
+// maxDelayShift caps the exponent of the progressive delay so the shift
+// cannot overflow; MaxDelaySeconds is the real limit
+const maxDelayShift = 16
+
+// ErrIPNotAllowed is returned by Login when the client IP is outside the
+// tenant's IP allowlist
+var ErrIPNotAllowed = errors.New("IP address is not allowed for this organization")
+
+// LoginProtectionService defends password logins against brute force. It
+// counts failures per account and per client IP, slows down repeated
+// failures and temporarily locks accounts and blocks IPs.
+type LoginProtectionService interface {
+	// Check refuses an attempt with a *models.LoginBlockedError while the
+	// account is locked, the IP is blocked or a progressive delay is running.
+	// user is nil when no account matches the email.
+	Check(ctx context.Context, user *models.User, ip string) error
+	RecordFailure(ctx context.Context, user *models.User, ip string)
+	RecordSuccess(ctx context.Context, user *models.User)
+	// CheckAllowedIP refuses a login from outside the tenant's IP allowlist
+	// with ErrIPNotAllowed; admin selects the admin list. Super admins are
+	// let through as an emergency bypass, which is audited.
+	CheckAllowedIP(ctx context.Context, user *models.User, ip string, admin bool) error
+	// Unlock lifts a lockout on behalf of a tenant admin
+	Unlock(ctx context.Context, tenantID, userID, actorID uuid.UUID, ip string) error
+	// UnlockWithToken lifts a lockout with the token from the lockout email
+	UnlockWithToken(ctx context.Context, token, ip string) error
+}
+
+type loginProtectionService struct {
+	attemptRepo      repositories.LoginAttemptRepository
+	tenantConfigRepo repositories.TenantConfigRepository
+	userRepo         repositories.UserRepository
+	auditRepo        repositories.AuditRepository
+	email            EmailService
+}
+
+func NewLoginProtectionService(
+	attemptRepo repositories.LoginAttemptRepository,
+	tenantConfigRepo repositories.TenantConfigRepository,
+	userRepo repositories.UserRepository,
+	auditRepo repositories.AuditRepository,
+	email EmailService,
+) LoginProtectionService {
+	return &loginProtectionService{
+		attemptRepo:      attemptRepo,
+		tenantConfigRepo: tenantConfigRepo,
+		userRepo:         userRepo,
+		auditRepo:        auditRepo,
+		email:            email,
+	}
+}
+
+// Counters and blocks are keyed per account and per tenant and IP, so one
+// tenant's thresholds never lock out another tenant's users behind the same
+// address. Unknown emails count against the uuid.Nil tenant.
+func accountAttemptKey(userID uuid.UUID) string {
+	return "account:" + userID.String()
+}
+
+func accountDelayKey(userID uuid.UUID) string {
+	return "delay:account:" + userID.String()
+}
+
+func ipAttemptKey(tenantID uuid.UUID, ip string) string {
+	return "ip:" + tenantID.String() + ":" + ip
+}
+
+func tenantOf(user *models.User) uuid.UUID {
+	if user == nil {
+		return uuid.Nil
+	}
+	return user.TenantID
+}
+
+// Redis failures are logged and let the attempt through: an outage of the
+// counter store must not lock every user out.
+func (s *loginProtectionService) Check(ctx context.Context, user *models.User, ip string) error {
+	if ip != "" {
+		if wait := s.blockedFor(ctx, ipAttemptKey(tenantOf(user), ip)); wait > 0 {
+			return &models.LoginBlockedError{Reason: models.LoginBlockedIPBlocked, RetryAfter: wait}
+		}
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	if wait := s.blockedFor(ctx, accountAttemptKey(user.ID)); wait > 0 {
+		return &models.LoginBlockedError{Reason: models.LoginBlockedAccountLocked, RetryAfter: wait}
+	}
+	if wait := s.blockedFor(ctx, accountDelayKey(user.ID)); wait > 0 {
+		return &models.LoginBlockedError{Reason: models.LoginBlockedThrottled, RetryAfter: wait}
+	}
+
+	return nil
+}
+
+func (s *loginProtectionService) RecordFailure(ctx context.Context, user *models.User, ip string) {
+	tenantID := tenantOf(user)
+	policy := s.getPolicy(ctx, tenantID)
+
+	if ip != "" {
+		key := ipAttemptKey(tenantID, ip)
+		failures, err := s.attemptRepo.IncrementFailures(ctx, key, policy.FailureWindow())
+		if err != nil {
+			log.Printf("Failed to count login failure for IP %s: %v", ip, err)
+		} else if failures >= policy.MaxFailedAttemptsPerIP {
+			s.blockIP(ctx, tenantID, ip, failures, policy)
+		}
+	}
+
+	if user == nil {
+		return
+	}
+
+	failures, err := s.attemptRepo.IncrementFailures(ctx, accountAttemptKey(user.ID), policy.FailureWindow())
+	if err != nil {
+		log.Printf("Failed to count login failure for user %s: %v", user.ID, err)
+		return
+	}
+
+	if failures >= policy.MaxFailedAttempts {
+		s.lockAccount(ctx, user, ip, failures, policy)
+		return
+	}
+
+	if policy.DelayAfterAttempts > 0 && failures >= policy.DelayAfterAttempts {
+		// 1s, 2s, 4s, ... up to MaxDelaySeconds
+		shift := failures - policy.DelayAfterAttempts
+		if shift > maxDelayShift {
+			shift = maxDelayShift
+		}
+		delay := time.Second << shift
+		if maxDelay := time.Duration(policy.MaxDelaySeconds) * time.Second; delay > maxDelay {
+			delay = maxDelay
+		}
+		if err := s.attemptRepo.Block(ctx, accountDelayKey(user.ID), delay); err != nil {
+			log.Printf("Failed to delay logins for user %s: %v", user.ID, err)
+		}
+	}
+}
+
+func (s *loginProtectionService) RecordSuccess(ctx context.Context, user *models.User) {
+	// The IP counter is deliberately kept: one valid account must not let an
+	// address keep guessing the passwords of others.
+	if err := s.attemptRepo.ResetFailures(ctx, accountAttemptKey(user.ID)); err != nil {
+		log.Printf("Failed to reset login failures for user %s: %v", user.ID, err)
+	}
+}
+
+// Tenants without a configuration row have no allowlist; an allowlist that
+// cannot be parsed refuses the login.
+func (s *loginProtectionService) CheckAllowedIP(ctx context.Context, user *models.User, ip string, admin bool) error {
+	if user.TenantID == uuid.Nil {
+		return nil
+	}
+
+	config, err := s.tenantConfigRepo.GetByTenantID(ctx, user.TenantID)
+	if err != nil {
+		return nil
+	}
+
+	allowlist, err := sharedmiddleware.ParseIPAllowlist(config.AllowedIPs)
+	if err != nil {
+		log.Printf("Invalid IP allowlist for tenant %s: %v", user.TenantID, err)
+		return ErrIPNotAllowed
+	}
+	if allowlist.Allows(ip, admin) {
+		return nil
+	}
+
+	tenantID, userID := user.TenantID, user.ID
+	entry := &models.AuditLog{
+		TenantID:     &tenantID,
+		ActorID:      &userID,
+		TargetUserID: &userID,
+		IPAddress:    ip,
+		Details:      map[string]interface{}{"admin": admin},
+	}
+
+	if user.Role == models.RoleSuperAdmin {
+		entry.Action = models.AuditActionLoginIPBypassed
+		s.audit(ctx, entry)
+		log.Printf("IP allowlist bypassed: system admin %s signed in from %s for tenant %s", user.ID, ip, user.TenantID)
+		return nil
+	}
+
+	entry.Action = models.AuditActionLoginIPDenied
+	s.audit(ctx, entry)
+	log.Printf("IP allowlist denied: user %s signed in from %s for tenant %s (admin: %t)", user.ID, ip, user.TenantID, admin)
+	return ErrIPNotAllowed
+}
+
+func (s *loginProtectionService) Unlock(ctx context.Context, tenantID, userID, actorID uuid.UUID, ip string) error {
+	user, err := s.userRepo.GetByIDAndTenant(ctx, userID, tenantID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+
+	if err := s.unlockAccount(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		TenantID:     &user.TenantID,
+		ActorID:      &actorID,
+		TargetUserID: &user.ID,
+		Action:       models.AuditActionAccountUnlocked,
+		IPAddress:    ip,
+		Details:      map[string]interface{}{"method": "admin"},
+	})
+
+	return nil
+}
+
+func (s *loginProtectionService) UnlockWithToken(ctx context.Context, token, ip string) error {
+	userID, err := s.attemptRepo.ConsumeUnlockToken(ctx, token)
+	if err != nil {
+		return fmt.Errorf("invalid or expired unlock token")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("invalid or expired unlock token")
+	}
+
+	if err := s.unlockAccount(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		TenantID:     &user.TenantID,
+		ActorID:      &user.ID,
+		TargetUserID: &user.ID,
+		Action:       models.AuditActionAccountUnlocked,
+		IPAddress:    ip,
+		Details:      map[string]interface{}{"method": "email"},
+	})
+
+	return nil
+}
+
+func (s *loginProtectionService) lockAccount(ctx context.Context, user *models.User, ip string, failures int, policy models.LockoutPolicy) {
+	duration := policy.LockoutDuration()
+	if err := s.attemptRepo.Block(ctx, accountAttemptKey(user.ID), duration); err != nil {
+		log.Printf("Failed to lock user %s: %v", user.ID, err)
+		return
+	}
+	// The lock replaces the counter and any running delay
+	if err := s.attemptRepo.ResetFailures(ctx, accountAttemptKey(user.ID)); err != nil {
+		log.Printf("Failed to reset login failures for user %s: %v", user.ID, err)
+	}
+	if err := s.attemptRepo.Unblock(ctx, accountDelayKey(user.ID)); err != nil {
+		log.Printf("Failed to clear login delay for user %s: %v", user.ID, err)
+	}
+
+	s.audit(ctx, &models.AuditLog{
+		TenantID:     &user.TenantID,
+		TargetUserID: &user.ID,
+		Action:       models.AuditActionAccountLocked,
+		IPAddress:    ip,
+		Details: map[string]interface{}{
+			"failed_attempts": failures,
+			"lockout_minutes": policy.LockoutMinutes,
+		},
+	})
+
+	token, err := generateSecureToken(32)
+	if err != nil {
+		log.Printf("Failed to generate unlock token for user %s: %v", user.ID, err)
+		return
+	}
+	if err := s.attemptRepo.SaveUnlockToken(ctx, token, user.ID, duration); err != nil {
+		log.Printf("Failed to save unlock token for user %s: %v", user.ID, err)
+		return
+	}
+
+	if err := s.email.SendAccountLockedEmail(ctx, user, token, duration); err != nil {
+		log.Printf("Failed to send account locked email to user %s: %v", user.ID, err)
+	}
+}
+
+func (s *loginProtectionService) blockIP(ctx context.Context, tenantID uuid.UUID, ip string, failures int, policy models.LockoutPolicy) {
+	key := ipAttemptKey(tenantID, ip)
+	if err := s.attemptRepo.Block(ctx, key, policy.LockoutDuration()); err != nil {
+		log.Printf("Failed to block IP %s: %v", ip, err)
+		return
+	}
+	if err := s.attemptRepo.ResetFailures(ctx, key); err != nil {
+		log.Printf("Failed to reset login failures for IP %s: %v", ip, err)
+	}
+
+	entry := &models.AuditLog{
+		Action:    models.AuditActionLoginIPBlocked,
+		IPAddress: ip,
+		Details: map[string]interface{}{
+			"failed_attempts": failures,
+			"lockout_minutes": policy.LockoutMinutes,
+		},
+	}
+	if tenantID != uuid.Nil {
+		entry.TenantID = &tenantID
+	}
+	s.audit(ctx, entry)
+}
+
+func (s *loginProtectionService) unlockAccount(ctx context.Context, userID uuid.UUID) error {
+	if err := s.attemptRepo.Unblock(ctx, accountAttemptKey(userID)); err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	if err := s.attemptRepo.Unblock(ctx, accountDelayKey(userID)); err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	if err := s.attemptRepo.ResetFailures(ctx, accountAttemptKey(userID)); err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+	return nil
+}
+
+func (s *loginProtectionService) blockedFor(ctx context.Context, key string) time.Duration {
+	wait, err := s.attemptRepo.BlockedFor(ctx, key)
+	if err != nil {
+		log.Printf("Failed to check login block %s: %v", key, err)
+		return 0
+	}
+	return wait
+}
+
+func (s *loginProtectionService) audit(ctx context.Context, entry *models.AuditLog) {
+	if err := s.auditRepo.Create(ctx, entry); err != nil {
+		log.Printf("Failed to write audit log %s: %v", entry.Action, err)
+	}
+}
+
+// getPolicy returns the tenant's lockout thresholds, falling back to the
+// defaults for unset, invalid or non-positive values
+func (s *loginProtectionService) getPolicy(ctx context.Context, tenantID uuid.UUID) models.LockoutPolicy {
+	policy := models.DefaultLockoutPolicy
+	if tenantID == uuid.Nil {
+		return policy
+	}
+
+	config, err := s.tenantConfigRepo.GetByTenantID(ctx, tenantID)
+	if err != nil || config.SecurityConfig == "" {
+		return policy
+	}
+
+	// Decoding into a pre-filled policy keeps the defaults for missing keys
+	security := models.SecurityConfig{Lockout: &policy}
+	if err := json.Unmarshal([]byte(config.SecurityConfig), &security); err != nil || security.Lockout == nil {
+		if err != nil {
+			log.Printf("Invalid security config for tenant %s, using the default lockout policy: %v", tenantID, err)
+		}
+		return models.DefaultLockoutPolicy
+	}
+	policy = *security.Lockout
+
+	defaults := models.DefaultLockoutPolicy
+	if policy.MaxFailedAttempts <= 0 {
+		policy.MaxFailedAttempts = defaults.MaxFailedAttempts
+	}
+	if policy.MaxFailedAttemptsPerIP <= 0 {
+		policy.MaxFailedAttemptsPerIP = defaults.MaxFailedAttemptsPerIP
+	}
+	if policy.FailureWindowMinutes <= 0 {
+		policy.FailureWindowMinutes = defaults.FailureWindowMinutes
+	}
+	if policy.LockoutMinutes <= 0 {
+		policy.LockoutMinutes = defaults.LockoutMinutes
+	}
+	if policy.DelayAfterAttempts < 0 {
+		policy.DelayAfterAttempts = defaults.DelayAfterAttempts
+	}
+	if policy.MaxDelaySeconds <= 0 {
+		policy.MaxDelaySeconds = defaults.MaxDelaySeconds
+	}
+
+	return policy
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestLoginProtectionService(userRepo *fakeUserRepository) LoginProtectionService {
+	return NewLoginProtectionService(newFakeLoginAttemptRepository(), &fakeTenantConfigRepository{}, userRepo, &fakeAuditRepository{}, &fakeEmailService{})
+}
+
+type loginProtectionFixture struct {
+	authService  AuthService
+	protection   LoginProtectionService
+	attemptRepo  *fakeLoginAttemptRepository
+	auditRepo    *fakeAuditRepository
+	email        *fakeEmailService
+	tenantConfig *models.TenantConfiguration
+	user         *models.User
+}
+
+func newLoginProtectionFixture(t *testing.T, securityConfig string) *loginProtectionFixture {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+	}
+	tenantID := uuid.New()
+	tenantConfig := &models.TenantConfiguration{TenantID: tenantID, SecurityConfig: securityConfig}
+	tenantConfigRepo := &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{tenantID: tenantConfig}}
+	userRepo := newFakeUserRepository()
+	f := &loginProtectionFixture{
+		attemptRepo:  newFakeLoginAttemptRepository(),
+		auditRepo:    &fakeAuditRepository{},
+		email:        &fakeEmailService{},
+		tenantConfig: tenantConfig,
+	}
+	f.protection = NewLoginProtectionService(f.attemptRepo, tenantConfigRepo, userRepo, f.auditRepo, f.email)
+	f.authService = NewAuthService(userRepo, nil, userRepo, &fakeRefreshTokenRepository{}, newFakeSAMLRepository(), newFakeRoleRepository(),
+		newTestPasswordPolicyService(tenantConfigRepo), f.protection, NewJWTService(cfg), &fakeTenantClient{}, cfg)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Correct1Pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	f.user = &models.User{TenantID: tenantID, Email: "sam@acme.test", FirstName: "Sam", Password: string(hash), Role: models.RoleUser}
+	require.NoError(t, userRepo.Create(context.Background(), f.user))
+
+	return f
+}
+
+func (f *loginProtectionFixture) login(password, ip string) error {
+	_, err := f.authService.Login(context.Background(), &models.LoginRequest{Email: f.user.Email, Password: password, IPAddress: ip})
+	return err
+}
+
+func blockedReason(t *testing.T, err error) string {
+	t.Helper()
+
+	var blocked *models.LoginBlockedError
+	require.True(t, errors.As(err, &blocked), "expected a blocked login, got %v", err)
+	assert.Positive(t, blocked.RetryAfter)
+	return blocked.Reason
+}
+
+func TestLoginLocksAccountAfterRepeatedFailures(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{"lockout": {"max_failed_attempts": 3, "delay_after_attempts": 0, "lockout_minutes": 30}}`)
+
+	for i := 0; i < 2; i++ {
+		assert.EqualError(t, f.login("wrong", "203.0.113.7"), "invalid credentials")
+	}
+	assert.NoError(t, f.login("Correct1Pass", "203.0.113.7"), "a success resets the counter")
+
+	for i := 0; i < 3; i++ {
+		assert.EqualError(t, f.login("wrong", "203.0.113.7"), "invalid credentials")
+	}
+
+	// The correct password no longer gets through
+	assert.Equal(t, models.LoginBlockedAccountLocked, blockedReason(t, f.login("Correct1Pass", "198.51.100.1")))
+	wait, _ := f.attemptRepo.BlockedFor(context.Background(), accountAttemptKey(f.user.ID))
+	assert.InDelta(t, (30 * time.Minute).Seconds(), wait.Seconds(), 5)
+
+	require.Len(t, f.auditRepo.entries, 1)
+	assert.Equal(t, models.AuditActionAccountLocked, f.auditRepo.entries[0].Action)
+	assert.Equal(t, f.user.ID, *f.auditRepo.entries[0].TargetUserID)
+	assert.Equal(t, "203.0.113.7", f.auditRepo.entries[0].IPAddress)
+
+	// The lockout email carries a single-use unlock token
+	require.NotEmpty(t, f.email.unlockTokens[f.user.Email])
+	token := f.email.unlockTokens[f.user.Email]
+	require.NoError(t, f.protection.UnlockWithToken(context.Background(), token, "198.51.100.1"))
+	assert.NoError(t, f.login("Correct1Pass", "198.51.100.1"))
+	assert.Error(t, f.protection.UnlockWithToken(context.Background(), token, "198.51.100.1"))
+
+	require.Len(t, f.auditRepo.entries, 2)
+	assert.Equal(t, models.AuditActionAccountUnlocked, f.auditRepo.entries[1].Action)
+	assert.Equal(t, "email", f.auditRepo.entries[1].Details["method"])
+}
+
+func TestLoginDelaysGrowWithFailures(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{"lockout": {"max_failed_attempts": 10, "delay_after_attempts": 2, "max_delay_seconds": 3}}`)
+	delayKey := accountDelayKey(f.user.ID)
+
+	assert.EqualError(t, f.login("wrong", ""), "invalid credentials")
+	assert.EqualError(t, f.login("wrong", ""), "invalid credentials")
+
+	// Retrying during the delay is refused without counting as a failure
+	assert.Equal(t, models.LoginBlockedThrottled, blockedReason(t, f.login("wrong", "")))
+	wait, _ := f.attemptRepo.BlockedFor(context.Background(), delayKey)
+	assert.InDelta(t, 1, wait.Seconds(), 0.1)
+
+	var delays []float64
+	for i := 0; i < 3; i++ {
+		f.attemptRepo.expire(delayKey)
+		assert.EqualError(t, f.login("wrong", ""), "invalid credentials")
+		wait, _ := f.attemptRepo.BlockedFor(context.Background(), delayKey)
+		delays = append(delays, wait.Seconds())
+	}
+	assert.InDelta(t, 2, delays[0], 0.1)
+	assert.InDelta(t, 3, delays[1], 0.1, "capped at max_delay_seconds")
+	assert.InDelta(t, 3, delays[2], 0.1)
+	assert.Empty(t, f.auditRepo.entries)
+}
+
+func TestLoginBlocksIPAfterFailuresAcrossAccounts(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{}`)
+	ctx := context.Background()
+
+	// Unknown emails use the default policy and the uuid.Nil tenant
+	for i := 0; i < models.DefaultLockoutPolicy.MaxFailedAttemptsPerIP; i++ {
+		_, err := f.authService.Login(ctx, &models.LoginRequest{Email: fmt.Sprintf("guess%d@acme.test", i), Password: "x", IPAddress: "203.0.113.9"})
+		assert.EqualError(t, err, "invalid credentials")
+	}
+
+	_, err := f.authService.Login(ctx, &models.LoginRequest{Email: "guess@acme.test", Password: "x", IPAddress: "203.0.113.9"})
+	assert.Equal(t, models.LoginBlockedIPBlocked, blockedReason(t, err))
+
+	require.Len(t, f.auditRepo.entries, 1)
+	assert.Equal(t, models.AuditActionLoginIPBlocked, f.auditRepo.entries[0].Action)
+	assert.Nil(t, f.auditRepo.entries[0].TenantID)
+
+	// Other addresses are unaffected
+	assert.NoError(t, f.login("Correct1Pass", "198.51.100.1"))
+}
+
+func TestAdminUnlockIsTenantScoped(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{"lockout": {"max_failed_attempts": 1}}`)
+	ctx := context.Background()
+	adminID := uuid.New()
+
+	assert.EqualError(t, f.login("wrong", ""), "invalid credentials")
+	assert.Equal(t, models.LoginBlockedAccountLocked, blockedReason(t, f.login("Correct1Pass", "")))
+
+	assert.EqualError(t, f.protection.Unlock(ctx, uuid.New(), f.user.ID, adminID, ""), "user not found")
+	require.NoError(t, f.protection.Unlock(ctx, f.user.TenantID, f.user.ID, adminID, "192.0.2.1"))
+	assert.NoError(t, f.login("Correct1Pass", ""))
+
+	entry := f.auditRepo.entries[len(f.auditRepo.entries)-1]
+	assert.Equal(t, models.AuditActionAccountUnlocked, entry.Action)
+	assert.Equal(t, adminID, *entry.ActorID)
+	assert.Equal(t, "admin", entry.Details["method"])
+}
+
+func TestLoginEnforcesTenantIPAllowlist(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{}`)
+	f.tenantConfig.AllowedIPs = `{"default": ["203.0.113.0/24", "2001:db8::1"], "admin": ["198.51.100.7"]}`
+	ctx := context.Background()
+
+	assert.NoError(t, f.login("Correct1Pass", "203.0.113.50"))
+	assert.NoError(t, f.login("Correct1Pass", "2001:db8::1"))
+	assert.ErrorIs(t, f.login("Correct1Pass", "192.0.2.1"), ErrIPNotAllowed)
+	assert.EqualError(t, f.login("wrong", "192.0.2.1"), "invalid credentials", "the allowlist is only revealed to valid credentials")
+
+	// Admin logins use the admin list
+	_, err := f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass", IPAddress: "203.0.113.50", AdminLogin: true})
+	assert.ErrorIs(t, err, ErrIPNotAllowed)
+	_, err = f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass", IPAddress: "198.51.100.7", AdminLogin: true})
+	assert.NoError(t, err)
+
+	require.Len(t, f.auditRepo.entries, 2)
+	assert.Equal(t, models.AuditActionLoginIPDenied, f.auditRepo.entries[0].Action)
+	assert.Equal(t, "192.0.2.1", f.auditRepo.entries[0].IPAddress)
+	assert.Equal(t, true, f.auditRepo.entries[1].Details["admin"])
+
+	// A plain array applies to every route
+	f.tenantConfig.AllowedIPs = `["198.51.100.0/24"]`
+	_, err = f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass", IPAddress: "198.51.100.9", AdminLogin: true})
+	assert.NoError(t, err)
+	assert.ErrorIs(t, f.login("Correct1Pass", "203.0.113.50"), ErrIPNotAllowed)
+}
+
+func TestRefreshTokenEnforcesTenantIPAllowlist(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{}`)
+	ctx := context.Background()
+
+	tokens, err := f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass", IPAddress: "192.0.2.1"})
+	require.NoError(t, err)
+
+	tokens, err = f.authService.RefreshToken(ctx, tokens.RefreshToken, "192.0.2.1")
+	require.NoError(t, err)
+
+	// An allowlist added later ends sessions from other addresses
+	f.tenantConfig.AllowedIPs = `["203.0.113.0/24"]`
+	_, err = f.authService.RefreshToken(ctx, tokens.RefreshToken, "192.0.2.1")
+	assert.ErrorIs(t, err, ErrIPNotAllowed)
+	require.Len(t, f.auditRepo.entries, 1)
+	assert.Equal(t, models.AuditActionLoginIPDenied, f.auditRepo.entries[0].Action)
+}
+
+func TestSuperAdminBypassesIPAllowlist(t *testing.T) {
+	f := newLoginProtectionFixture(t, `{}`)
+	f.tenantConfig.AllowedIPs = `["203.0.113.0/24"]`
+	f.user.Role = models.RoleSuperAdmin
+
+	assert.NoError(t, f.protection.CheckAllowedIP(context.Background(), f.user, "192.0.2.1", true))
+	require.Len(t, f.auditRepo.entries, 1)
+	assert.Equal(t, models.AuditActionLoginIPBypassed, f.auditRepo.entries[0].Action)
+}
+
+type fakeLoginAttemptRepository struct {
+	failures     map[string]int
+	blocks       map[string]time.Time
+	unlockTokens map[string]uuid.UUID
+}
+
+func newFakeLoginAttemptRepository() *fakeLoginAttemptRepository {
+	return &fakeLoginAttemptRepository{
+		failures:     make(map[string]int),
+		blocks:       make(map[string]time.Time),
+		unlockTokens: make(map[string]uuid.UUID),
+	}
+}
+
+// expire ends a block as if its duration had passed
+func (r *fakeLoginAttemptRepository) expire(key string) {
+	delete(r.blocks, key)
+}
+
+func (r *fakeLoginAttemptRepository) IncrementFailures(ctx context.Context, key string, window time.Duration) (int, error) {
+	r.failures[key]++
+	return r.failures[key], nil
+}
+
+func (r *fakeLoginAttemptRepository) ResetFailures(ctx context.Context, key string) error {
+	delete(r.failures, key)
+	return nil
+}
+
+func (r *fakeLoginAttemptRepository) Block(ctx context.Context, key string, duration time.Duration) error {
+	r.blocks[key] = time.Now().Add(duration)
+	return nil
+}
+
+func (r *fakeLoginAttemptRepository) BlockedFor(ctx context.Context, key string) (time.Duration, error) {
+	until, ok := r.blocks[key]
+	if !ok || time.Now().After(until) {
+		return 0, nil
+	}
+	return time.Until(until), nil
+}
+
+func (r *fakeLoginAttemptRepository) Unblock(ctx context.Context, key string) error {
+	delete(r.blocks, key)
+	return nil
+}
+
+func (r *fakeLoginAttemptRepository) SaveUnlockToken(ctx context.Context, token string, userID uuid.UUID, ttl time.Duration) error {
+	r.unlockTokens[token] = userID
+	return nil
+}
+
+func (r *fakeLoginAttemptRepository) ConsumeUnlockToken(ctx context.Context, token string) (uuid.UUID, error) {
+	userID, ok := r.unlockTokens[token]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("unlock token not found")
+	}
+	delete(r.unlockTokens, token)
+	return userID, nil
+}
+
+type fakeAuditRepository struct {
+	entries []*models.AuditLog
+}
+
+func (r *fakeAuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+type fakeEmailService struct {
+	MockEmailService
+	unlockTokens map[string]string
+}
+
+func (s *fakeEmailService) SendAccountLockedEmail(ctx context.Context, user *models.User, token string, lockedFor time.Duration) error {
+	if s.unlockTokens == nil {
+		s.unlockTokens = make(map[string]string)
+	}
+	s.unlockTokens[user.Email] = token
+	return nil
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+
+	googleIssuer            = "https://accounts.google.com"
+	microsoftIssuerTemplate = "https://login.microsoftonline.com/{tenantid}/v2.0"
+)
+
+type OIDCService interface {
+	AuthorizationURL(ctx context.Context, tenantID uuid.UUID, provider, redirectURI string) (string, error)
+	HandleCallback(ctx context.Context, state, code string) (*SSOLoginResult, error)
+}
+
+// oidcClaims are the ID token claims we rely on
+type oidcClaims struct {
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	GivenName     string       `json:"given_name"`
+	FamilyName    string       `json:"family_name"`
+	Name          string       `json:"name"`
+	DirectoryID   string       `json:"tid"` // microsoft only
+}
+
+// flexibleBool accepts both true and "true", some providers send the latter
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	*b = flexibleBool(value == "true")
+	return nil
+}
+
+type oidcService struct {
+	userRepo         repositories.UserRepository
+	tenantConfigRepo repositories.TenantConfigRepository
+	oidcRepo         repositories.OIDCRepository
+	identityRepo     repositories.IdentityRepository
+	authService      AuthService
+	tenantClient     TenantClient
+	config           *config.Config
+
+	mu        sync.Mutex
+	providers map[string]*oidc.Provider // keyed by issuer
+}
+
+func NewOIDCService(
+	userRepo repositories.UserRepository,
+	tenantConfigRepo repositories.TenantConfigRepository,
+	oidcRepo repositories.OIDCRepository,
+	identityRepo repositories.IdentityRepository,
+	authService AuthService,
+	tenantClient TenantClient,
+	config *config.Config,
+) OIDCService {
+	return &oidcService{
+		userRepo:         userRepo,
+		tenantConfigRepo: tenantConfigRepo,
+		oidcRepo:         oidcRepo,
+		identityRepo:     identityRepo,
+		authService:      authService,
+		tenantClient:     tenantClient,
+		config:           config,
+		providers:        make(map[string]*oidc.Provider),
+	}
+}
+
+// AuthorizationURL starts a login and returns the identity provider URL to redirect to
+func (s *oidcService) AuthorizationURL(ctx context.Context, tenantID uuid.UUID, providerName, redirectURI string) (string, error) {
+	providerConfig, err := s.getProviderConfig(ctx, tenantID, providerName)
+	if err != nil {
+		return "", err
+	}
+
+	if redirectURI != "" && !containsString(providerConfig.AllowedRedirectURIs, redirectURI, stringsEqual) {
+		return "", fmt.Errorf("redirect URI is not allowed for this provider")
+	}
+
+	provider, _, err := s.getProvider(ctx, providerConfig)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := generateSecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+
+	nonce, err := generateSecureToken(16)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	authState := &models.OIDCAuthState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		TenantID:     tenantID,
+		Provider:     providerName,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if redirectURI != "" {
+		authState.RedirectURI = &redirectURI
+	}
+
+	err = s.oidcRepo.CreateState(ctx, authState)
+	if err != nil {
+		return "", fmt.Errorf("failed to store authorization state: %w", err)
+	}
+
+	oauthConfig := s.oauth2Config(providerConfig, provider)
+	return oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(authState.CodeVerifier)), nil
+}
+
+// HandleCallback completes a login: it exchanges the code, verifies the ID token
+// and resolves (or provisions) the local user
+func (s *oidcService) HandleCallback(ctx context.Context, state, code string) (*SSOLoginResult, error) {
+	authState, err := s.oidcRepo.ConsumeState(ctx, state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authorization state")
+	}
+
+	if authState.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("authorization state has expired")
+	}
+
+	providerConfig, err := s.getProviderConfig(ctx, authState.TenantID, authState.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, issuerTemplate, err := s.getProvider(ctx, providerConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	oauthConfig := s.oauth2Config(providerConfig, provider)
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(authState.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("identity provider did not return an ID token")
+	}
+
+	verifier := provider.Verifier(&oidc.Config{
+		ClientID:        providerConfig.ClientID,
+		SkipIssuerCheck: issuerTemplate != "",
+	})
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	if idToken.Nonce != authState.Nonce {
+		return nil, fmt.Errorf("invalid ID token nonce")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token claims: %w", err)
+	}
+
+	// Multi-tenant Microsoft endpoints use a templated issuer, check it against the token's directory
+	if issuerTemplate != "" {
+		expectedIssuer := strings.Replace(issuerTemplate, "{tenantid}", claims.DirectoryID, 1)
+		if claims.DirectoryID == "" || idToken.Issuer != expectedIssuer {
+			return nil, fmt.Errorf("unexpected ID token issuer %s", idToken.Issuer)
+		}
+	}
+
+	email := normalizeEmail(claims.Email)
+	if email == "" {
+		return nil, fmt.Errorf("identity provider did not return an email address")
+	}
+
+	if !bool(claims.EmailVerified) && !providerConfig.TrustUnverifiedEmail {
+		return nil, fmt.Errorf("email address is not verified by the identity provider")
+	}
+
+	if len(providerConfig.AllowedDomains) > 0 {
+		domain := email[strings.LastIndex(email, "@")+1:]
+		if !containsString(providerConfig.AllowedDomains, domain, strings.EqualFold) {
+			return nil, fmt.Errorf("email domain %s is not allowed for this tenant", domain)
+		}
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+
+	identity := &ssoIdentity{
+		TenantID:  authState.TenantID,
+		Provider:  authState.Provider,
+		Subject:   idToken.Subject,
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+	}
+
+	user, provisioned, err := resolveSSOUser(ctx, s.userRepo, s.identityRepo, s.tenantClient, identity, providerConfig.JITProvisioning, providerConfig.DefaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.authService.IssueSSOTokens(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSOLoginResult{
+		Tokens:      tokens,
+		RedirectURI: authState.RedirectURI,
+		Provisioned: provisioned,
+	}, nil
+}
+
+func (s *oidcService) getProviderConfig(ctx context.Context, tenantID uuid.UUID, name string) (*models.OIDCProviderConfig, error) {
+	tenantConfig, err := s.tenantConfigRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("identity provider %s is not configured for this tenant", name)
+	}
+
+	var integration models.IntegrationConfig
+	if err := json.Unmarshal([]byte(tenantConfig.IntegrationConfig), &integration); err != nil {
+		return nil, fmt.Errorf("invalid integration config: %w", err)
+	}
+
+	providerConfig, ok := integration.OIDC[name]
+	if !ok || providerConfig.Disabled {
+		return nil, fmt.Errorf("identity provider %s is not configured for this tenant", name)
+	}
+
+	if providerConfig.Type == "" {
+		switch name {
+		case models.OIDCProviderGoogle, models.OIDCProviderMicrosoft:
+			providerConfig.Type = name
+		default:
+			providerConfig.Type = models.OIDCProviderGeneric
+		}
+	}
+
+	if providerConfig.ClientID == "" {
+		return nil, fmt.Errorf("identity provider %s has no client_id", name)
+	}
+
+	return &providerConfig, nil
+}
+
+// getProvider returns the discovered provider. For multi-tenant Microsoft
+// endpoints it also returns the issuer template the token must match.
+func (s *oidcService) getProvider(ctx context.Context, providerConfig *models.OIDCProviderConfig) (*oidc.Provider, string, error) {
+	issuer, issuerTemplate, err := resolveIssuer(providerConfig)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	provider, ok := s.providers[issuer]
+	s.mu.Unlock()
+	if ok {
+		return provider, issuerTemplate, nil
+	}
+
+	discoveryCtx := ctx
+	if issuerTemplate != "" {
+		discoveryCtx = oidc.InsecureIssuerURLContext(ctx, issuerTemplate)
+	}
+
+	provider, err = oidc.NewProvider(discoveryCtx, issuer)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to discover identity provider: %w", err)
+	}
+
+	s.mu.Lock()
+	s.providers[issuer] = provider
+	s.mu.Unlock()
+
+	return provider, issuerTemplate, nil
+}
+
+func (s *oidcService) oauth2Config(providerConfig *models.OIDCProviderConfig, provider *oidc.Provider) *oauth2.Config {
+	scopes := providerConfig.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	return &oauth2.Config{
+		ClientID:     providerConfig.ClientID,
+		ClientSecret: providerConfig.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  s.config.OIDCRedirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// resolveIssuer maps a provider config to its issuer URL
+func resolveIssuer(providerConfig *models.OIDCProviderConfig) (string, string, error) {
+	switch providerConfig.Type {
+	case models.OIDCProviderGoogle:
+		return googleIssuer, "", nil
+	case models.OIDCProviderMicrosoft:
+		directory := providerConfig.DirectoryTenant
+		if directory == "" {
+			directory = "organizations"
+		}
+		issuer := strings.Replace(microsoftIssuerTemplate, "{tenantid}", directory, 1)
+		switch directory {
+		case "common", "organizations", "consumers":
+			return issuer, microsoftIssuerTemplate, nil
+		}
+		return issuer, "", nil
+	case models.OIDCProviderGeneric:
+		if providerConfig.Issuer == "" {
+			return "", "", fmt.Errorf("issuer is required for generic OIDC providers")
+		}
+		return providerConfig.Issuer, "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported OIDC provider type %s", providerConfig.Type)
+	}
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDCProvider is a minimal local OpenID provider (discovery, JWKS and token endpoint)
+type mockOIDCProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	nonce    string
+	subject  string
+	email    string
+}
+
+func newMockOIDCProvider(t *testing.T, clientID string) *mockOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &mockOIDCProvider{key: key, clientID: clientID, subject: "subject-1", email: "jane@acme.test"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken(t),
+		})
+	})
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockOIDCProvider) idToken(t *testing.T) string {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            p.server.URL,
+		"aud":            p.clientID,
+		"sub":            p.subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          p.nonce,
+		"email":          p.email,
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+	})
+	token.Header["kid"] = "test-key"
+
+	signed, err := token.SignedString(p.key)
+	require.NoError(t, err)
+	return signed
+}
+
+// startLogin runs AuthorizationURL and lets the mock provider pick up the nonce
+func (p *mockOIDCProvider) startLogin(t *testing.T, svc OIDCService, tenantID uuid.UUID) string {
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "okta", "")
+	require.NoError(t, err)
+
+	parsed, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+
+	p.nonce = parsed.Query().Get("nonce")
+	return parsed.Query().Get("state")
+}
+
+func newTestOIDCService(t *testing.T, provider *mockOIDCProvider, tenantID uuid.UUID, jit bool) (OIDCService, *fakeUserRepository) {
+	integration, err := json.Marshal(models.IntegrationConfig{
+		OIDC: map[string]models.OIDCProviderConfig{
+			"okta": {
+				Issuer:          provider.server.URL,
+				ClientID:        provider.clientID,
+				ClientSecret:    "secret",
+				DefaultRole:     models.RoleManager,
+				JITProvisioning: jit,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+		JWTIssuer:           "zplus-saas",
+		JWTAudience:         "zplus-users",
+		OIDCRedirectURL:     "http://localhost/api/auth/oidc/callback",
+	}
+
+	userRepo := newFakeUserRepository()
+	tenantConfigRepo := &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{
+		tenantID: {TenantID: tenantID, IntegrationConfig: string(integration)},
+	}}
+	authService := NewAuthService(userRepo, nil, userRepo, &fakeRefreshTokenRepository{}, newFakeSAMLRepository(), newFakeRoleRepository(), newTestPasswordPolicyService(tenantConfigRepo), newTestLoginProtectionService(userRepo), NewJWTService(cfg), &fakeTenantClient{}, cfg)
+
+	return NewOIDCService(userRepo, tenantConfigRepo, newFakeOIDCRepository(), newFakeIdentityRepository(), authService, &fakeTenantClient{}, cfg), userRepo
+}
+
+func TestOIDCLoginProvisionsAndLinksUser(t *testing.T) {
+	tenantID := uuid.New()
+	provider := newMockOIDCProvider(t, "client-1")
+	svc, userRepo := newTestOIDCService(t, provider, tenantID, true)
+
+	state := provider.startLogin(t, svc, tenantID)
+	result, err := svc.HandleCallback(context.Background(), state, "good-code")
+	require.NoError(t, err)
+
+	assert.True(t, result.Provisioned)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+	assert.Equal(t, "jane@acme.test", result.Tokens.User.Email)
+	assert.Equal(t, models.RoleManager, result.Tokens.User.Role)
+	assert.True(t, result.Tokens.User.IsVerified)
+	assert.Len(t, userRepo.users, 1)
+
+	// Second login resolves the linked identity instead of provisioning again
+	state = provider.startLogin(t, svc, tenantID)
+	result, err = svc.HandleCallback(context.Background(), state, "good-code")
+	require.NoError(t, err)
+	assert.False(t, result.Provisioned)
+	assert.Len(t, userRepo.users, 1)
+
+	// States are single use
+	_, err = svc.HandleCallback(context.Background(), state, "good-code")
+	assert.Error(t, err)
+}
+
+func TestOIDCLoginLinksExistingUserByEmail(t *testing.T) {
+	tenantID := uuid.New()
+	provider := newMockOIDCProvider(t, "client-1")
+	svc, userRepo := newTestOIDCService(t, provider, tenantID, false)
+
+	existing := &models.User{TenantID: tenantID, Email: "jane@acme.test", Role: models.RoleAdmin}
+	require.NoError(t, userRepo.Create(context.Background(), existing))
+
+	state := provider.startLogin(t, svc, tenantID)
+	result, err := svc.HandleCallback(context.Background(), state, "good-code")
+	require.NoError(t, err)
+	assert.False(t, result.Provisioned)
+	assert.Equal(t, existing.ID, result.Tokens.User.ID)
+	assert.Equal(t, models.RoleAdmin, result.Tokens.User.Role)
+}
+
+func TestOIDCLoginRejectsUnknownUserWithoutJIT(t *testing.T) {
+	tenantID := uuid.New()
+	provider := newMockOIDCProvider(t, "client-1")
+	svc, _ := newTestOIDCService(t, provider, tenantID, false)
+
+	state := provider.startLogin(t, svc, tenantID)
+	_, err := svc.HandleCallback(context.Background(), state, "good-code")
+	assert.ErrorContains(t, err, "no account exists")
+}
+
+func TestOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	tenantID := uuid.New()
+	provider := newMockOIDCProvider(t, "client-1")
+	svc, _ := newTestOIDCService(t, provider, tenantID, true)
+
+	state := provider.startLogin(t, svc, tenantID)
+	provider.nonce = "replayed"
+	_, err := svc.HandleCallback(context.Background(), state, "good-code")
+	assert.ErrorContains(t, err, "nonce")
+}
+
+// In-memory repositories
+
+// fakeUserRepository also serves as the MembershipRepository: users belong to
+// their home tenant and to any tenant added with AddMembership
+type fakeUserRepository struct {
+	users       map[uuid.UUID]*models.User
+	memberships map[uuid.UUID][]*models.TenantMembership
+	languages   map[uuid.UUID]string
+}
+
+func newFakeUserRepository() *fakeUserRepository {
+	return &fakeUserRepository{
+		users:       make(map[uuid.UUID]*models.User),
+		memberships: make(map[uuid.UUID][]*models.TenantMembership),
+		languages:   make(map[uuid.UUID]string),
+	}
+}
+
+func (r *fakeUserRepository) Create(ctx context.Context, user *models.User) error {
+	user.ID = uuid.New()
+	user.IsActive = true
+	user.IsVerified = false
+	user.PasswordChangedAt = time.Now()
+	copied := *user
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *fakeUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user not found")
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (r *fakeUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (r *fakeUserRepository) GetByEmailAndTenant(ctx context.Context, email string, tenantID uuid.UUID) (*models.User, error) {
+	for id, user := range r.users {
+		if user.Email == email {
+			if member, err := r.GetByIDAndTenant(ctx, id, tenantID); err == nil {
+				return member, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (r *fakeUserRepository) GetByIDAndTenant(ctx context.Context, id, tenantID uuid.UUID) (*models.User, error) {
+	user, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.TenantID == tenantID {
+		return user, nil
+	}
+	for _, membership := range r.memberships[id] {
+		if membership.TenantID == tenantID {
+			user.TenantID = membership.TenantID
+			user.Role = membership.Role
+			user.IsActive = user.IsActive && membership.IsActive
+			return user, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found")
+}
+
+func (r *fakeUserRepository) AddMembership(ctx context.Context, membership *models.TenantMembership) error {
+	membership.IsActive = true
+	membership.CreatedAt = time.Now()
+	copied := *membership
+	r.memberships[membership.UserID] = append(r.memberships[membership.UserID], &copied)
+	return nil
+}
+
+func (r *fakeUserRepository) ListMemberships(ctx context.Context, userID uuid.UUID) ([]*models.TenantMembership, error) {
+	user, ok := r.users[userID]
+	if !ok {
+		return nil, nil
+	}
+	memberships := []*models.TenantMembership{{UserID: userID, TenantID: user.TenantID, Role: user.Role, IsActive: true, IsHome: true}}
+	for _, membership := range r.memberships[userID] {
+		if membership.IsActive {
+			copied := *membership
+			memberships = append(memberships, &copied)
+		}
+	}
+	return memberships, nil
+}
+
+func (r *fakeUserRepository) Update(ctx context.Context, user *models.User) error {
+	existing, ok := r.users[user.ID]
+	// Like the real repository, other tenants only update their membership
+	if ok && existing.TenantID != user.TenantID {
+		for _, membership := range r.memberships[user.ID] {
+			if membership.TenantID == user.TenantID {
+				membership.Role, membership.IsActive = user.Role, user.IsActive
+			}
+		}
+		return nil
+	}
+
+	copied := *user
+	// Like the real repository, Update leaves the password alone
+	if ok {
+		copied.Password, copied.PasswordChangedAt = existing.Password, existing.PasswordChangedAt
+	}
+	r.users[user.ID] = &copied
+	return nil
+}
+
+func (r *fakeUserRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(r.users, id)
+	return nil
+}
+
+func (r *fakeUserRepository) DeleteFromTenant(ctx context.Context, id, tenantID uuid.UUID) error {
+	user, ok := r.users[id]
+	if !ok {
+		return nil
+	}
+
+	var remaining []*models.TenantMembership
+	for _, membership := range r.memberships[id] {
+		if membership.TenantID != tenantID && membership.IsActive {
+			remaining = append(remaining, membership)
+		}
+	}
+
+	if user.TenantID != tenantID {
+		r.memberships[id] = remaining
+		return nil
+	}
+	if len(remaining) == 0 {
+		delete(r.users, id)
+		delete(r.memberships, id)
+		return nil
+	}
+
+	// The home tenant moves to the oldest remaining membership
+	user.TenantID, user.Role = remaining[0].TenantID, remaining[0].Role
+	r.memberships[id] = remaining[1:]
+	return nil
+}
+
+func (r *fakeUserRepository) UpdateLastLogin(ctx context.Context, userID uuid.UUID) error {
+	return nil
+}
+
+func (r *fakeUserRepository) UpdatePassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	user, ok := r.users[userID]
+	if !ok {
+		return fmt.Errorf("user not found")
+	}
+	user.Password = passwordHash
+	user.PasswordChangedAt = time.Now()
+	return nil
+}
+
+func (r *fakeUserRepository) GetLanguage(ctx context.Context, userID uuid.UUID) (string, error) {
+	return r.languages[userID], nil
+}
+
+func (r *fakeUserRepository) ListTenantAdmins(ctx context.Context, tenantID uuid.UUID) ([]*models.User, error) {
+	var admins []*models.User
+	for _, user := range r.users {
+		if user.TenantID == tenantID && user.Role == models.RoleAdmin && user.IsActive {
+			copied := *user
+			admins = append(admins, &copied)
+		}
+	}
+	return admins, nil
+}
+
+type fakeRefreshTokenRepository struct {
+	tokens []*models.RefreshToken
+}
+
+func (r *fakeRefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	r.tokens = append(r.tokens, token)
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) GetByToken(ctx context.Context, token string) (*models.RefreshToken, error) {
+	for _, stored := range r.tokens {
+		if stored.Token == token {
+			return stored, nil
+		}
+	}
+	return nil, fmt.Errorf("refresh token not found")
+}
+
+func (r *fakeRefreshTokenRepository) GetByUserID(ctx context.Context, userID uuid.UUID) ([]*models.RefreshToken, error) {
+	return nil, nil
+}
+
+func (r *fakeRefreshTokenRepository) MarkAsUsed(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) DeleteExpired(ctx context.Context) error {
+	return nil
+}
+
+func (r *fakeRefreshTokenRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) error {
+	var kept []*models.RefreshToken
+	for _, token := range r.tokens {
+		if token.UserID != userID {
+			kept = append(kept, token)
+		}
+	}
+	r.tokens = kept
+	return nil
+}
+
+type fakeTenantConfigRepository struct {
+	configs map[uuid.UUID]*models.TenantConfiguration
+}
+
+func (r *fakeTenantConfigRepository) GetByTenantID(ctx context.Context, tenantID uuid.UUID) (*models.TenantConfiguration, error) {
+	config, ok := r.configs[tenantID]
+	if !ok {
+		return nil, fmt.Errorf("tenant configuration not found")
+	}
+	return config, nil
+}
+
+type fakeOIDCRepository struct {
+	states map[string]*models.OIDCAuthState
+}
+
+func newFakeOIDCRepository() *fakeOIDCRepository {
+	return &fakeOIDCRepository{states: make(map[string]*models.OIDCAuthState)}
+}
+
+func (r *fakeOIDCRepository) CreateState(ctx context.Context, state *models.OIDCAuthState) error {
+	state.ID = uuid.New()
+	r.states[state.State] = state
+	return nil
+}
+
+func (r *fakeOIDCRepository) ConsumeState(ctx context.Context, state string) (*models.OIDCAuthState, error) {
+	authState, ok := r.states[state]
+	if !ok {
+		return nil, fmt.Errorf("authorization state not found")
+	}
+	delete(r.states, state)
+	return authState, nil
+}
+
+func (r *fakeOIDCRepository) DeleteExpiredStates(ctx context.Context) error {
+	return nil
+}
+
+type fakeIdentityRepository struct {
+	identities map[string]*models.UserIdentity
+}
+
+func newFakeIdentityRepository() *fakeIdentityRepository {
+	return &fakeIdentityRepository{identities: make(map[string]*models.UserIdentity)}
+}
+
+func (r *fakeIdentityRepository) Get(ctx context.Context, tenantID uuid.UUID, provider, subject string) (*models.UserIdentity, error) {
+	identity, ok := r.identities[tenantID.String()+provider+subject]
+	if !ok {
+		return nil, fmt.Errorf("identity not found")
+	}
+	return identity, nil
+}
+
+func (r *fakeIdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	identity.ID = uuid.New()
+	r.identities[identity.TenantID.String()+identity.Provider+identity.Subject] = identity
+	return nil
+}
+
+func (r *fakeIdentityRepository) UpdateLastLogin(ctx context.Context, id uuid.UUID, email string) error {
+	return nil
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// minPasswordLength is the floor for tenant policies with a lower minLength
+	minPasswordLength = 6
+	// maxPasswordBytes is bcrypt's input limit
+	maxPasswordBytes = 72
+	// maxPasswordHistory is the most hashes kept per user (tenant-service
+	// caps historyCount at the same value)
+	maxPasswordHistory = 24
+)
+
+// ErrPasswordExpired is returned by Login when the password is older than the
+// tenant's maxAgeDays. The user must rotate it with ChangeExpiredPassword.
+var ErrPasswordExpired = errors.New("password has expired and must be changed")
+
+// ErrPasswordNotExpired is returned by ChangeExpiredPassword when the password
+// has not expired. It is changed through the signed-in password change.
+var ErrPasswordNotExpired = errors.New("password has not expired")
+
+// PasswordPolicyService enforces the tenant's password policy wherever a
+// password is set
+type PasswordPolicyService interface {
+	GetPolicy(ctx context.Context, tenantID uuid.UUID) models.PasswordPolicy
+	// Validate checks a new password against every rule and returns a
+	// *models.PasswordPolicyError listing the rules it fails. userID is
+	// uuid.Nil for users that do not exist yet.
+	Validate(ctx context.Context, tenantID, userID uuid.UUID, password string) error
+	// RecordPassword adds a newly set password hash to the user's history
+	RecordPassword(ctx context.Context, userID uuid.UUID, passwordHash string) error
+	IsExpired(ctx context.Context, user *models.User) bool
+}
+
+type passwordPolicyService struct {
+	tenantConfigRepo repositories.TenantConfigRepository
+	historyRepo      repositories.PasswordHistoryRepository
+	breachChecker    BreachChecker
+}
+
+func NewPasswordPolicyService(
+	tenantConfigRepo repositories.TenantConfigRepository,
+	historyRepo repositories.PasswordHistoryRepository,
+	breachChecker BreachChecker,
+) PasswordPolicyService {
+	return &passwordPolicyService{
+		tenantConfigRepo: tenantConfigRepo,
+		historyRepo:      historyRepo,
+		breachChecker:    breachChecker,
+	}
+}
+
+// GetPolicy returns the tenant's password policy, falling back to the
+// default policy when the tenant has none or it cannot be read
+func (s *passwordPolicyService) GetPolicy(ctx context.Context, tenantID uuid.UUID) models.PasswordPolicy {
+	policy := models.DefaultPasswordPolicy
+	if tenantID == uuid.Nil {
+		return policy
+	}
+
+	config, err := s.tenantConfigRepo.GetByTenantID(ctx, tenantID)
+	if err != nil || config.PasswordPolicy == "" {
+		return policy
+	}
+
+	if err := json.Unmarshal([]byte(config.PasswordPolicy), &policy); err != nil {
+		log.Printf("Invalid password policy for tenant %s, using the default: %v", tenantID, err)
+		return models.DefaultPasswordPolicy
+	}
+
+	if policy.MinLength < minPasswordLength {
+		policy.MinLength = minPasswordLength
+	}
+	if policy.HistoryCount > maxPasswordHistory {
+		policy.HistoryCount = maxPasswordHistory
+	}
+
+	return policy
+}
+
+func (s *passwordPolicyService) Validate(ctx context.Context, tenantID, userID uuid.UUID, password string) error {
+	policy := s.GetPolicy(ctx, tenantID)
+
+	var violations []models.PasswordViolation
+	violate := func(rule, format string, args ...interface{}) {
+		violations = append(violations, models.PasswordViolation{Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len([]rune(password)) < policy.MinLength {
+		violate(models.PasswordRuleMinLength, "must be at least %d characters long", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		violate(models.PasswordRuleMaxLength, "must be at most %d bytes long", maxPasswordBytes)
+	}
+
+	var hasUpper, hasLower, hasNumber, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasNumber = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSpecial = true
+		}
+	}
+
+	if policy.RequireUppercase && !hasUpper {
+		violate(models.PasswordRuleUppercase, "must contain an uppercase letter")
+	}
+	if policy.RequireLowercase && !hasLower {
+		violate(models.PasswordRuleLowercase, "must contain a lowercase letter")
+	}
+	if policy.RequireNumbers && !hasNumber {
+		violate(models.PasswordRuleNumber, "must contain a number")
+	}
+	if policy.RequireSpecialChars && !hasSpecial {
+		violate(models.PasswordRuleSpecialChar, "must contain a special character")
+	}
+
+	if policy.HistoryCount > 0 && userID != uuid.Nil {
+		hashes, err := s.historyRepo.ListRecent(ctx, userID, policy.HistoryCount)
+		if err != nil {
+			return fmt.Errorf("failed to load password history: %w", err)
+		}
+		for _, hash := range hashes {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				violate(models.PasswordRuleHistory, "must not match any of your last %d passwords", policy.HistoryCount)
+				break
+			}
+		}
+	}
+
+	if policy.CheckBreached && s.breachChecker != nil {
+		// A broken breach list must not stop users from setting passwords
+		breached, err := s.breachChecker.IsBreached(password)
+		if err != nil {
+			log.Printf("Breached password check failed: %v", err)
+		} else if breached {
+			violate(models.PasswordRuleBreached, "has appeared in a data breach, choose a different password")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &models.PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func (s *passwordPolicyService) RecordPassword(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	if err := s.historyRepo.Add(ctx, userID, passwordHash); err != nil {
+		return fmt.Errorf("failed to record password history: %w", err)
+	}
+
+	return s.historyRepo.Prune(ctx, userID, maxPasswordHistory)
+}
+
+func (s *passwordPolicyService) IsExpired(ctx context.Context, user *models.User) bool {
+	policy := s.GetPolicy(ctx, user.TenantID)
+	if policy.MaxAgeDays <= 0 || user.PasswordChangedAt.IsZero() {
+		return false
+	}
+
+	return time.Since(user.PasswordChangedAt) > time.Duration(policy.MaxAgeDays)*24*time.Hour
+}
+
+// BreachChecker reports whether a password appears in a breached-password list
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+type rangeFileBreachChecker struct {
+	dir string
+}
+
+// NewBreachChecker checks passwords against an offline copy of a k-anonymity
+// breached-password list: dir holds one file per 5-character SHA-1 prefix
+// (e.g. "5BAA6.txt") whose lines are "<35-character suffix>:<count>", the
+// format of the Have I Been Pwned range API. It returns nil when dir is
+// empty, which disables the check.
+func NewBreachChecker(dir string) BreachChecker {
+	if dir == "" {
+		return nil
+	}
+	return &rangeFileBreachChecker{dir: dir}
+}
+
+func (c *rangeFileBreachChecker) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, count, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !strings.EqualFold(entry, suffix) {
+			continue
+		}
+		// Padding entries have a count of 0
+		n, err := strconv.Atoi(count)
+		return err != nil || n > 0, nil
+	}
+
+	return false, scanner.Err()
+}
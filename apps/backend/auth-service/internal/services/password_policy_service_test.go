@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestPasswordPolicyService(tenantConfigRepo *fakeTenantConfigRepository) PasswordPolicyService {
+	if tenantConfigRepo == nil {
+		tenantConfigRepo = &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{}}
+	}
+	return NewPasswordPolicyService(tenantConfigRepo, newFakePasswordHistoryRepository(), nil)
+}
+
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+
+	var policyErr *models.PasswordPolicyError
+	require.True(t, errors.As(err, &policyErr), "expected a password policy error, got %v", err)
+
+	rules := make([]string, len(policyErr.Violations))
+	for i, violation := range policyErr.Violations {
+		rules[i] = violation.Rule
+	}
+	return rules
+}
+
+func TestPasswordPolicyDefaultRules(t *testing.T) {
+	svc := newTestPasswordPolicyService(nil)
+	ctx := context.Background()
+
+	err := svc.Validate(ctx, uuid.Nil, uuid.Nil, "short")
+	assert.ElementsMatch(t, []string{
+		models.PasswordRuleMinLength,
+		models.PasswordRuleUppercase,
+		models.PasswordRuleNumber,
+	}, violatedRules(t, err))
+
+	err = svc.Validate(ctx, uuid.Nil, uuid.Nil, strings.Repeat("Aa1", 25))
+	assert.Equal(t, []string{models.PasswordRuleMaxLength}, violatedRules(t, err))
+
+	assert.NoError(t, svc.Validate(ctx, uuid.Nil, uuid.Nil, "Corr3ctHorse"))
+}
+
+func TestPasswordPolicyUsesTenantConfiguration(t *testing.T) {
+	tenantID := uuid.New()
+	svc := newTestPasswordPolicyService(&fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{
+		tenantID: {TenantID: tenantID, PasswordPolicy: `{"minLength": 4, "requireUppercase": false, "requireSpecialChars": true}`},
+	}})
+	ctx := context.Background()
+
+	policy := svc.GetPolicy(ctx, tenantID)
+	assert.Equal(t, minPasswordLength, policy.MinLength)
+	assert.False(t, policy.RequireUppercase)
+	// Keys the tenant did not set keep their defaults
+	assert.True(t, policy.RequireNumbers)
+	assert.Equal(t, models.DefaultPasswordPolicy.HistoryCount, policy.HistoryCount)
+
+	err := svc.Validate(ctx, tenantID, uuid.Nil, "lower1")
+	assert.Equal(t, []string{models.PasswordRuleSpecialChar}, violatedRules(t, err))
+	assert.NoError(t, svc.Validate(ctx, tenantID, uuid.Nil, "lower1!"))
+}
+
+func TestPasswordPolicyRejectsRecentPasswords(t *testing.T) {
+	tenantID := uuid.New()
+	historyRepo := newFakePasswordHistoryRepository()
+	svc := NewPasswordPolicyService(&fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{
+		tenantID: {TenantID: tenantID, PasswordPolicy: `{"historyCount": 2}`},
+	}}, historyRepo, nil)
+	ctx := context.Background()
+	userID := uuid.New()
+
+	for _, password := range []string{"Oldest1Pass", "Older1Pass", "Newest1Pass"} {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+		require.NoError(t, svc.RecordPassword(ctx, userID, string(hash)))
+	}
+
+	err := svc.Validate(ctx, tenantID, userID, "Newest1Pass")
+	assert.Equal(t, []string{models.PasswordRuleHistory}, violatedRules(t, err))
+	err = svc.Validate(ctx, tenantID, userID, "Older1Pass")
+	assert.Equal(t, []string{models.PasswordRuleHistory}, violatedRules(t, err))
+
+	// Only the last two passwords are checked
+	assert.NoError(t, svc.Validate(ctx, tenantID, userID, "Oldest1Pass"))
+	// New users have no history
+	assert.NoError(t, svc.Validate(ctx, tenantID, uuid.Nil, "Newest1Pass"))
+}
+
+func TestPasswordPolicyRejectsBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+	writeBreachRange(t, dir, "Passw0rdPassw0rd", 42)
+	writeBreachRange(t, dir, "Padded1Password", 0)
+
+	svc := NewPasswordPolicyService(&fakeTenantConfigRepository{}, newFakePasswordHistoryRepository(), NewBreachChecker(dir))
+	ctx := context.Background()
+
+	err := svc.Validate(ctx, uuid.Nil, uuid.Nil, "Passw0rdPassw0rd")
+	assert.Equal(t, []string{models.PasswordRuleBreached}, violatedRules(t, err))
+
+	assert.NoError(t, svc.Validate(ctx, uuid.Nil, uuid.Nil, "Padded1Password"))
+	assert.NoError(t, svc.Validate(ctx, uuid.Nil, uuid.Nil, "Unlisted1Password"))
+
+	assert.Nil(t, NewBreachChecker(""))
+}
+
+func TestLoginRequiresRotationOfExpiredPassword(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+	}
+	tenantID := uuid.New()
+	tenantConfigRepo := &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{
+		tenantID: {TenantID: tenantID, PasswordPolicy: `{"maxAgeDays": 90}`},
+	}}
+	userRepo := newFakeUserRepository()
+	passwordPolicy := newTestPasswordPolicyService(tenantConfigRepo)
+	authService := NewAuthService(userRepo, nil, userRepo, &fakeRefreshTokenRepository{}, newFakeSAMLRepository(), newFakeRoleRepository(), passwordPolicy, newTestLoginProtectionService(userRepo), NewJWTService(cfg), &fakeTenantClient{}, cfg)
+	ctx := context.Background()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Original1Pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &models.User{TenantID: tenantID, Email: "amy@acme.test", Password: string(hash), Role: models.RoleUser, IsActive: true}
+	require.NoError(t, userRepo.Create(ctx, user))
+	require.NoError(t, passwordPolicy.RecordPassword(ctx, user.ID, user.Password))
+
+	_, err = authService.Login(ctx, &models.LoginRequest{Email: user.Email, Password: "Original1Pass"})
+	require.NoError(t, err)
+
+	userRepo.users[user.ID].PasswordChangedAt = time.Now().AddDate(0, 0, -91)
+	_, err = authService.Login(ctx, &models.LoginRequest{Email: user.Email, Password: "Original1Pass"})
+	assert.ErrorIs(t, err, ErrPasswordExpired)
+
+	_, err = authService.ChangeExpiredPassword(ctx, &models.ChangeExpiredPasswordRequest{
+		Email: user.Email, CurrentPassword: "Original1Pass", NewPassword: "Original1Pass",
+	})
+	assert.Equal(t, []string{models.PasswordRuleHistory}, violatedRules(t, err))
+
+	tokens, err := authService.ChangeExpiredPassword(ctx, &models.ChangeExpiredPasswordRequest{
+		Email: user.Email, CurrentPassword: "Original1Pass", NewPassword: "Rotated1Pass",
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+
+	_, err = authService.Login(ctx, &models.LoginRequest{Email: user.Email, Password: "Rotated1Pass"})
+	assert.NoError(t, err)
+}
+
+func TestChangeExpiredPasswordRequiresExpiredPassword(t *testing.T) {
+	authService, userRepo, user := newExpiringPasswordFixture(t, newFakeSAMLRepository())
+	ctx := context.Background()
+
+	_, err := authService.ChangeExpiredPassword(ctx, &models.ChangeExpiredPasswordRequest{
+		Email: user.Email, CurrentPassword: "Original1Pass", NewPassword: "Rotated1Pass",
+	})
+	assert.ErrorIs(t, err, ErrPasswordNotExpired)
+
+	// The password was left alone
+	_, err = authService.Login(ctx, &models.LoginRequest{Email: user.Email, Password: "Original1Pass"})
+	assert.NoError(t, err)
+	assert.Equal(t, user.Password, userRepo.users[user.ID].Password)
+}
+
+func TestChangeExpiredPasswordRefusesSSOOnlyTenants(t *testing.T) {
+	samlRepo := newFakeSAMLRepository()
+	authService, userRepo, user := newExpiringPasswordFixture(t, samlRepo)
+	ctx := context.Background()
+
+	require.NoError(t, samlRepo.SaveConnection(ctx, &models.SAMLConnection{TenantID: user.TenantID, Enabled: true, SSOOnly: true}))
+	userRepo.users[user.ID].PasswordChangedAt = time.Now().AddDate(0, 0, -91)
+
+	tokens, err := authService.ChangeExpiredPassword(ctx, &models.ChangeExpiredPasswordRequest{
+		Email: user.Email, CurrentPassword: "Original1Pass", NewPassword: "Rotated1Pass",
+	})
+	assert.ErrorContains(t, err, "password login is disabled")
+	assert.Nil(t, tokens)
+	assert.Equal(t, user.Password, userRepo.users[user.ID].Password)
+}
+
+// newExpiringPasswordFixture signs up a user with the password
+// "Original1Pass" in a tenant whose passwords expire after 90 days
+func newExpiringPasswordFixture(t *testing.T, samlRepo *fakeSAMLRepository) (AuthService, *fakeUserRepository, *models.User) {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+	}
+	tenantID := uuid.New()
+	tenantConfigRepo := &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{
+		tenantID: {TenantID: tenantID, PasswordPolicy: `{"maxAgeDays": 90}`},
+	}}
+	userRepo := newFakeUserRepository()
+	passwordPolicy := newTestPasswordPolicyService(tenantConfigRepo)
+	authService := NewAuthService(userRepo, nil, userRepo, &fakeRefreshTokenRepository{}, samlRepo, newFakeRoleRepository(), passwordPolicy, newTestLoginProtectionService(userRepo), NewJWTService(cfg), &fakeTenantClient{}, cfg)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Original1Pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := &models.User{TenantID: tenantID, Email: "amy@acme.test", Password: string(hash), Role: models.RoleUser, IsActive: true}
+	require.NoError(t, userRepo.Create(context.Background(), user))
+	require.NoError(t, passwordPolicy.RecordPassword(context.Background(), user.ID, user.Password))
+
+	return authService, userRepo, user
+}
+
+func writeBreachRange(t *testing.T, dir, password string, count int) {
+	t.Helper()
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	line := hash[5:] + ":" + strconv.Itoa(count) + "\r\n"
+
+	file, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString("0000000000000000000000000000000000A:3\r\n" + line)
+	require.NoError(t, err)
+}
+
+type fakePasswordHistoryRepository struct {
+	hashes map[uuid.UUID][]string
+}
+
+func newFakePasswordHistoryRepository() *fakePasswordHistoryRepository {
+	return &fakePasswordHistoryRepository{hashes: make(map[uuid.UUID][]string)}
+}
+
+func (r *fakePasswordHistoryRepository) Add(ctx context.Context, userID uuid.UUID, passwordHash string) error {
+	r.hashes[userID] = append([]string{passwordHash}, r.hashes[userID]...)
+	return nil
+}
+
+func (r *fakePasswordHistoryRepository) ListRecent(ctx context.Context, userID uuid.UUID, limit int) ([]string, error) {
+	hashes := r.hashes[userID]
+	if len(hashes) > limit {
+		hashes = hashes[:limit]
+	}
+	return hashes, nil
+}
+
+func (r *fakePasswordHistoryRepository) Prune(ctx context.Context, userID uuid.UUID, keep int) error {
+	if len(r.hashes[userID]) > keep {
+		r.hashes[userID] = r.hashes[userID][:keep]
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,14 +14,16 @@ import (
 )
 
 type PasswordResetService struct {
-	db    *sqlx.DB
-	email EmailService
+	db             *sqlx.DB
+	email          EmailService
+	passwordPolicy PasswordPolicyService
 }
 
-func NewPasswordResetService(db *sqlx.DB, emailService EmailService) *PasswordResetService {
+func NewPasswordResetService(db *sqlx.DB, emailService EmailService, passwordPolicy PasswordPolicyService) *PasswordResetService {
 	return &PasswordResetService{
-		db:    db,
-		email: emailService,
+		db:             db,
+		email:          emailService,
+		passwordPolicy: passwordPolicy,
 	}
 }
 
@@ -27,7 +31,7 @@ func NewPasswordResetService(db *sqlx.DB, emailService EmailService) *PasswordRe
 func (s *PasswordResetService) RequestPasswordReset(email string) error {
 	// Find user by email
 	var user models.User
-	err := s.db.Get(&user, "SELECT id, first_name, last_name, email FROM users WHERE email = $1 AND is_active = true", email)
+	err := s.db.Get(&user, "SELECT id, tenant_id, first_name, last_name, email FROM users WHERE email = $1 AND is_active = true ORDER BY created_at LIMIT 1", email)
 	if err != nil {
 		// Don't reveal if user exists for security
 		return nil
@@ -64,9 +68,8 @@ func (s *PasswordResetService) RequestPasswordReset(email string) error {
 		return fmt.Errorf("failed to save reset token: %w", err)
 	}
 
-	// Send reset email
-	userName := fmt.Sprintf("%s %s", user.FirstName, user.LastName)
-	err = s.email.SendPasswordResetEmail(user.Email, token, userName)
+	// Queue reset email
+	err = s.email.SendPasswordResetEmail(context.Background(), &user, token)
 	if err != nil {
 		return fmt.Errorf("failed to send reset email: %w", err)
 	}
@@ -85,6 +88,17 @@ func (s *PasswordResetService) ResetPassword(token, newPassword string) error {
 		return fmt.Errorf("invalid or expired reset token")
 	}
 
+	var tenantID uuid.UUID
+	err = s.db.Get(&tenantID, "SELECT tenant_id FROM users WHERE id = $1", reset.UserID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+
+	ctx := context.Background()
+	if err := s.passwordPolicy.Validate(ctx, tenantID, reset.UserID, newPassword); err != nil {
+		return err
+	}
+
 	// Hash new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -99,7 +113,7 @@ func (s *PasswordResetService) ResetPassword(token, newPassword string) error {
 	defer tx.Rollback()
 
 	// Update user password
-	_, err = tx.Exec("UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3",
+	_, err = tx.Exec("UPDATE users SET password_hash = $1, password_changed_at = $2, updated_at = $2 WHERE id = $3",
 		string(hashedPassword), time.Now(), reset.UserID)
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
@@ -124,6 +138,10 @@ func (s *PasswordResetService) ResetPassword(token, newPassword string) error {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	if err := s.passwordPolicy.RecordPassword(ctx, reset.UserID, string(hashedPassword)); err != nil {
+		log.Printf("Failed to record password history for user %s: %v", reset.UserID, err)
+	}
+
 	return nil
 }
 
@@ -131,7 +149,7 @@ func (s *PasswordResetService) ResetPassword(token, newPassword string) error {
 func (s *PasswordResetService) ChangePassword(userID uuid.UUID, currentPassword, newPassword string) error {
 	// Get current password hash
 	var user models.User
-	err := s.db.Get(&user, "SELECT password_hash FROM users WHERE id = $1", userID)
+	err := s.db.Get(&user, "SELECT tenant_id, password_hash FROM users WHERE id = $1", userID)
 	if err != nil {
 		return fmt.Errorf("user not found")
 	}
@@ -142,6 +160,11 @@ func (s *PasswordResetService) ChangePassword(userID uuid.UUID, currentPassword,
 		return fmt.Errorf("current password is incorrect")
 	}
 
+	ctx := context.Background()
+	if err := s.passwordPolicy.Validate(ctx, user.TenantID, userID, newPassword); err != nil {
+		return err
+	}
+
 	// Hash new password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -156,7 +179,7 @@ func (s *PasswordResetService) ChangePassword(userID uuid.UUID, currentPassword,
 	defer tx.Rollback()
 
 	// Update password
-	_, err = tx.Exec("UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3",
+	_, err = tx.Exec("UPDATE users SET password_hash = $1, password_changed_at = $2, updated_at = $2 WHERE id = $3",
 		string(hashedPassword), time.Now(), userID)
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
@@ -174,6 +197,10 @@ func (s *PasswordResetService) ChangePassword(userID uuid.UUID, currentPassword,
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	if err := s.passwordPolicy.RecordPassword(ctx, userID, string(hashedPassword)); err != nil {
+		log.Printf("Failed to record password history for user %s: %v", userID, err)
+	}
+
 	return nil
 }
 
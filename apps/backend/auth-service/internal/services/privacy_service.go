@@ -0,0 +1,344 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+const (
+	dataSubjectInterval = 10 * time.Second
+	// dataSubjectLease must outlast exporting or erasing every source
+	dataSubjectLease       = 30 * time.Minute
+	dataSubjectMaxAttempts = 3
+	// exportArchiveTTL is how long an export can be downloaded
+	exportArchiveTTL = 7 * 24 * time.Hour
+)
+
+// PrivacyService takes GDPR data subject requests: exports of a user's
+// personal data across services, and erasures. Requests are processed in
+// the background by a DataSubjectWorker.
+type PrivacyService interface {
+	CreateRequest(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, req *models.CreateDataSubjectRequest) (*models.DataSubjectRequest, error)
+	ListRequests(ctx context.Context, tenantID uuid.UUID) ([]*models.DataSubjectRequest, error)
+	GetRequest(ctx context.Context, tenantID, id uuid.UUID) (*models.DataSubjectRequest, error)
+	// GetArchive returns the zip archive of a completed export
+	GetArchive(ctx context.Context, tenantID, id uuid.UUID) ([]byte, error)
+}
+
+type privacyService struct {
+	requestRepo repositories.DataSubjectRepository
+	userRepo    repositories.UserRepository
+	auditRepo   repositories.AuditRepository
+	now         func() time.Time
+}
+
+func NewPrivacyService(requestRepo repositories.DataSubjectRepository, userRepo repositories.UserRepository, auditRepo repositories.AuditRepository) PrivacyService {
+	return &privacyService{
+		requestRepo: requestRepo,
+		userRepo:    userRepo,
+		auditRepo:   auditRepo,
+		now:         time.Now,
+	}
+}
+
+func (s *privacyService) CreateRequest(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, req *models.CreateDataSubjectRequest) (*models.DataSubjectRequest, error) {
+	if req.Type != models.DataSubjectRequestExport && req.Type != models.DataSubjectRequestErase {
+		return nil, fmt.Errorf("type must be %s or %s", models.DataSubjectRequestExport, models.DataSubjectRequestErase)
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len(reason) > 1000 {
+		return nil, fmt.Errorf("reason must be at most 1000 characters")
+	}
+
+	user, err := s.userRepo.GetByIDAndTenant(ctx, req.UserID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if req.Type == models.DataSubjectRequestErase {
+		if user.ID == actorID {
+			return nil, fmt.Errorf("you cannot erase your own account")
+		}
+		if user.Role == models.RoleSuperAdmin {
+			return nil, fmt.Errorf("super admin accounts cannot be erased")
+		}
+	}
+
+	open, err := s.requestRepo.HasOpen(ctx, tenantID, user.ID, req.Type)
+	if err != nil {
+		return nil, err
+	}
+	if open {
+		return nil, fmt.Errorf("an %s request for this user is already in progress", req.Type)
+	}
+
+	email := user.Email
+	request := &models.DataSubjectRequest{
+		TenantID:      tenantID,
+		SubjectUserID: user.ID,
+		SubjectEmail:  &email,
+		Type:          req.Type,
+		Reason:        reason,
+		RequestedBy:   &actorID,
+	}
+	if err := s.requestRepo.Create(ctx, request); err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	err = s.auditRepo.Create(ctx, &models.AuditLog{
+		TenantID:     &tenantID,
+		ActorID:      &actorID,
+		TargetUserID: &user.ID,
+		Action:       models.AuditActionPrivacyRequest,
+		IPAddress:    ipAddress,
+		Details: map[string]interface{}{
+			"request_id": request.ID.String(),
+			"type":       request.Type,
+			"reason":     reason,
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to audit data subject request %s: %v", request.ID, err)
+	}
+
+	return request, nil
+}
+
+func (s *privacyService) ListRequests(ctx context.Context, tenantID uuid.UUID) ([]*models.DataSubjectRequest, error) {
+	return s.requestRepo.List(ctx, tenantID)
+}
+
+func (s *privacyService) GetRequest(ctx context.Context, tenantID, id uuid.UUID) (*models.DataSubjectRequest, error) {
+	return s.requestRepo.Get(ctx, tenantID, id)
+}
+
+func (s *privacyService) GetArchive(ctx context.Context, tenantID, id uuid.UUID) ([]byte, error) {
+	return s.requestRepo.GetArchive(ctx, tenantID, id, s.now())
+}
+
+// DataSubjectWorker runs data subject requests against every personal data
+// source. A source whose service is not deployed is skipped and noted in the
+// result; any other failure retries the whole request, which is safe as
+// exports are read-only and erasure is idempotent.
+type DataSubjectWorker struct {
+	requestRepo repositories.DataSubjectRepository
+	auditRepo   repositories.AuditRepository
+	sources     []repositories.PersonalDataSource
+	now         func() time.Time
+}
+
+func NewDataSubjectWorker(requestRepo repositories.DataSubjectRepository, auditRepo repositories.AuditRepository, sources []repositories.PersonalDataSource) *DataSubjectWorker {
+	return &DataSubjectWorker{
+		requestRepo: requestRepo,
+		auditRepo:   auditRepo,
+		sources:     sources,
+		now:         time.Now,
+	}
+}
+
+// Run processes requests until ctx is cancelled
+func (w *DataSubjectWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(dataSubjectInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			processed, err := w.ProcessNext(ctx)
+			if err != nil {
+				log.Printf("Data subject requests: %v", err)
+			}
+			if err != nil || !processed {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessNext claims one due request and runs it. It reports whether there
+// was a request to process.
+func (w *DataSubjectWorker) ProcessNext(ctx context.Context) (bool, error) {
+	req, err := w.requestRepo.ClaimNext(ctx, w.now(), dataSubjectLease)
+	if err != nil || req == nil {
+		return false, err
+	}
+
+	// A worker that died during the last attempt leaves the request to be
+	// claimed once more; give up on it
+	if req.Attempts > dataSubjectMaxAttempts {
+		w.fail(ctx, req, "attempts exhausted")
+		return true, nil
+	}
+	if req.SubjectEmail == nil {
+		w.fail(ctx, req, "request has no subject email")
+		return true, nil
+	}
+
+	subject := &models.DataSubject{
+		TenantID: req.TenantID,
+		UserID:   req.SubjectUserID,
+		Email:    *req.SubjectEmail,
+	}
+
+	var result map[string]interface{}
+	var archive []byte
+	var archiveExpiresAt *time.Time
+	if req.Type == models.DataSubjectRequestExport {
+		result, archive, err = w.export(ctx, req, subject)
+		expiresAt := w.now().Add(exportArchiveTTL)
+		archiveExpiresAt = &expiresAt
+	} else {
+		result, err = w.erase(ctx, subject)
+	}
+
+	if err != nil {
+		if req.Attempts >= dataSubjectMaxAttempts {
+			w.fail(ctx, req, err.Error())
+			return true, nil
+		}
+		if err := w.requestRepo.MarkRetry(ctx, req.ID, err.Error()); err != nil {
+			log.Printf("Data subject requests: failed to reschedule request %s: %v", req.ID, err)
+		}
+		log.Printf("Data subject request %s failed (attempt %d/%d): %v", req.ID, req.Attempts, dataSubjectMaxAttempts, err)
+		return true, nil
+	}
+
+	erased := req.Type == models.DataSubjectRequestErase
+	if err := w.requestRepo.Complete(ctx, req.ID, result, archive, archiveExpiresAt, erased, w.now()); err != nil {
+		return true, fmt.Errorf("failed to complete request %s: %w", req.ID, err)
+	}
+
+	action := models.AuditActionPrivacyExport
+	if erased {
+		action = models.AuditActionPrivacyErase
+	}
+	w.audit(ctx, req, action, map[string]interface{}{
+		"request_id": req.ID.String(),
+		"sources":    result,
+	})
+	log.Printf("Data subject request %s (%s) completed", req.ID, req.Type)
+
+	return true, nil
+}
+
+func (w *DataSubjectWorker) export(ctx context.Context, req *models.DataSubjectRequest, subject *models.DataSubject) (map[string]interface{}, []byte, error) {
+	result := make(map[string]interface{})
+	files := make(map[string]interface{})
+
+	for _, source := range w.sources {
+		data, err := source.Export(ctx, subject)
+		if errors.Is(err, repositories.ErrPersonalDataSourceUnavailable) {
+			result[source.Name()] = "skipped: " + err.Error()
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", source.Name(), err)
+		}
+
+		counts := make(map[string]int)
+		for table, records := range data {
+			counts[table] = len(records)
+			files[source.Name()+"/"+table+".json"] = records
+		}
+		result[source.Name()] = counts
+	}
+
+	files["manifest.json"] = map[string]interface{}{
+		"request_id":   req.ID,
+		"tenant_id":    subject.TenantID,
+		"user_id":      subject.UserID,
+		"generated_at": w.now().UTC(),
+		"sources":      result,
+	}
+
+	archive, err := zipJSON(files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build archive: %w", err)
+	}
+
+	return result, archive, nil
+}
+
+func (w *DataSubjectWorker) erase(ctx context.Context, subject *models.DataSubject) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for _, source := range w.sources {
+		changed, err := source.Erase(ctx, subject)
+		if errors.Is(err, repositories.ErrPersonalDataSourceUnavailable) {
+			result[source.Name()] = "skipped: " + err.Error()
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source.Name(), err)
+		}
+		result[source.Name()] = changed
+	}
+
+	return result, nil
+}
+
+func (w *DataSubjectWorker) fail(ctx context.Context, req *models.DataSubjectRequest, reason string) {
+	if err := w.requestRepo.MarkFailed(ctx, req.ID, reason, w.now()); err != nil {
+		log.Printf("Data subject requests: failed to mark request %s failed: %v", req.ID, err)
+	}
+	w.audit(ctx, req, models.AuditActionPrivacyFailed, map[string]interface{}{
+		"request_id": req.ID.String(),
+		"type":       req.Type,
+		"error":      reason,
+	})
+	log.Printf("Data subject request %s failed permanently after %d attempts: %s", req.ID, req.Attempts, reason)
+}
+
+func (w *DataSubjectWorker) audit(ctx context.Context, req *models.DataSubjectRequest, action string, details map[string]interface{}) {
+	err := w.auditRepo.Create(ctx, &models.AuditLog{
+		TenantID:     &req.TenantID,
+		ActorID:      req.RequestedBy,
+		TargetUserID: &req.SubjectUserID,
+		Action:       action,
+		Details:      details,
+	})
+	if err != nil {
+		log.Printf("Failed to audit data subject request %s: %v", req.ID, err)
+	}
+}
+
+// zipJSON writes each value as an indented JSON file of a zip archive
+func zipJSON(files map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, value := range files {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type privacyTestFixture struct {
+	svc       *privacyService
+	worker    *DataSubjectWorker
+	repo      *fakeDataSubjectRepository
+	userRepo  *fakeUserRepository
+	auditRepo *fakeAuditRepository
+	crm       *fakePersonalDataSource
+	now       time.Time
+	tenantID  uuid.UUID
+	admin     *models.User
+	subject   *models.User
+}
+
+func newPrivacyTestFixture(t *testing.T, sources ...repositories.PersonalDataSource) *privacyTestFixture {
+	f := &privacyTestFixture{
+		repo:      newFakeDataSubjectRepository(),
+		userRepo:  newFakeUserRepository(),
+		auditRepo: &fakeAuditRepository{},
+		now:       time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC),
+		tenantID:  uuid.New(),
+	}
+	f.crm = &fakePersonalDataSource{
+		name: "crm",
+		data: map[string][]map[string]interface{}{
+			"customers": {{"email": "jane@example.com", "name": "Jane"}},
+			"leads":     {{"email": "jane@example.com"}, {"email": "jane@example.com"}},
+		},
+		erased: map[string]int64{"customers": 1, "leads": 2},
+	}
+	if len(sources) == 0 {
+		sources = []repositories.PersonalDataSource{f.crm}
+	}
+
+	f.svc = NewPrivacyService(f.repo, f.userRepo, f.auditRepo).(*privacyService)
+	f.svc.now = func() time.Time { return f.now }
+	f.worker = NewDataSubjectWorker(f.repo, f.auditRepo, sources)
+	f.worker.now = func() time.Time { return f.now }
+
+	f.admin = &models.User{TenantID: f.tenantID, Email: "admin@example.com", Role: models.RoleAdmin}
+	f.subject = &models.User{TenantID: f.tenantID, Email: "jane@example.com", Role: models.RoleUser}
+	require.NoError(t, f.userRepo.Create(context.Background(), f.admin))
+	require.NoError(t, f.userRepo.Create(context.Background(), f.subject))
+	return f
+}
+
+func (f *privacyTestFixture) create(t *testing.T, requestType string) *models.DataSubjectRequest {
+	req, err := f.svc.CreateRequest(context.Background(), f.tenantID, f.admin.ID, "203.0.113.7", &models.CreateDataSubjectRequest{
+		UserID: f.subject.ID,
+		Type:   requestType,
+		Reason: "ticket #88",
+	})
+	require.NoError(t, err)
+	return req
+}
+
+func TestExportBuildsArchiveFromEverySource(t *testing.T) {
+	f := newPrivacyTestFixture(t)
+	ctx := context.Background()
+	req := f.create(t, models.DataSubjectRequestExport)
+	assert.Equal(t, models.AuditActionPrivacyRequest, f.auditRepo.entries[0].Action)
+
+	processed, err := f.worker.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.True(t, processed)
+
+	stored := f.repo.requests[req.ID]
+	assert.Equal(t, models.DataSubjectStatusCompleted, stored.Status)
+	assert.Equal(t, map[string]int{"customers": 1, "leads": 2}, stored.Result["crm"])
+	require.NotNil(t, stored.ArchiveExpiresAt)
+	assert.Equal(t, f.now.Add(exportArchiveTTL), *stored.ArchiveExpiresAt)
+	assert.NotNil(t, stored.SubjectEmail, "exports keep the subject email")
+
+	archive, err := f.svc.GetArchive(ctx, f.tenantID, req.ID)
+	require.NoError(t, err)
+	files := readZip(t, archive)
+	assert.Contains(t, files, "manifest.json")
+	var leads []map[string]interface{}
+	require.NoError(t, json.Unmarshal(files["crm/leads.json"], &leads))
+	assert.Len(t, leads, 2)
+
+	last := f.auditRepo.entries[len(f.auditRepo.entries)-1]
+	assert.Equal(t, models.AuditActionPrivacyExport, last.Action)
+	assert.Equal(t, f.subject.ID, *last.TargetUserID)
+
+	// Other tenants cannot download the archive, and it expires
+	_, err = f.svc.GetArchive(ctx, uuid.New(), req.ID)
+	assert.Error(t, err)
+	f.now = f.now.Add(exportArchiveTTL + time.Minute)
+	_, err = f.svc.GetArchive(ctx, f.tenantID, req.ID)
+	assert.Error(t, err)
+}
+
+func TestEraseRecordsCountsAndForgetsEmail(t *testing.T) {
+	unavailable := &fakePersonalDataSource{name: "pos", err: fmt.Errorf("%w: relation \"orders\"", repositories.ErrPersonalDataSourceUnavailable)}
+	f := newPrivacyTestFixture(t)
+	f.worker.sources = append(f.worker.sources, unavailable)
+	req := f.create(t, models.DataSubjectRequestErase)
+
+	_, err := f.worker.ProcessNext(context.Background())
+	require.NoError(t, err)
+
+	stored := f.repo.requests[req.ID]
+	assert.Equal(t, models.DataSubjectStatusCompleted, stored.Status)
+	assert.Equal(t, map[string]int64{"customers": 1, "leads": 2}, stored.Result["crm"])
+	assert.Contains(t, stored.Result["pos"], "skipped")
+	assert.Nil(t, stored.SubjectEmail)
+	assert.False(t, stored.HasArchive)
+	assert.Equal(t, 1, f.crm.eraseCalls)
+	assert.Equal(t, "jane@example.com", f.crm.lastSubject.Email)
+
+	last := f.auditRepo.entries[len(f.auditRepo.entries)-1]
+	assert.Equal(t, models.AuditActionPrivacyErase, last.Action)
+	assert.Equal(t, f.admin.ID, *last.ActorID)
+}
+
+func TestDataSubjectRequestRetriesThenFails(t *testing.T) {
+	broken := &fakePersonalDataSource{name: "hrm", err: errors.New("connection reset")}
+	f := newPrivacyTestFixture(t, broken)
+	ctx := context.Background()
+	req := f.create(t, models.DataSubjectRequestErase)
+
+	for i := 1; i < dataSubjectMaxAttempts; i++ {
+		_, err := f.worker.ProcessNext(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, models.DataSubjectStatusPending, f.repo.requests[req.ID].Status)
+	}
+
+	_, err := f.worker.ProcessNext(ctx)
+	require.NoError(t, err)
+	stored := f.repo.requests[req.ID]
+	assert.Equal(t, models.DataSubjectStatusFailed, stored.Status)
+	require.NotNil(t, stored.LastError)
+	assert.Contains(t, *stored.LastError, "connection reset")
+	assert.Equal(t, models.AuditActionPrivacyFailed, f.auditRepo.entries[len(f.auditRepo.entries)-1].Action)
+
+	processed, err := f.worker.ProcessNext(ctx)
+	require.NoError(t, err)
+	assert.False(t, processed)
+}
+
+func TestCreateDataSubjectRequestValidation(t *testing.T) {
+	f := newPrivacyTestFixture(t)
+	ctx := context.Background()
+	superAdmin := &models.User{TenantID: f.tenantID, Email: "root@example.com", Role: models.RoleSuperAdmin}
+	require.NoError(t, f.userRepo.Create(ctx, superAdmin))
+
+	cases := []struct {
+		name string
+		req  models.CreateDataSubjectRequest
+	}{
+		{"unknown type", models.CreateDataSubjectRequest{UserID: f.subject.ID, Type: "delete"}},
+		{"user outside tenant", models.CreateDataSubjectRequest{UserID: uuid.New(), Type: models.DataSubjectRequestExport}},
+		{"erase self", models.CreateDataSubjectRequest{UserID: f.admin.ID, Type: models.DataSubjectRequestErase}},
+		{"erase super admin", models.CreateDataSubjectRequest{UserID: superAdmin.ID, Type: models.DataSubjectRequestErase}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := f.svc.CreateRequest(ctx, f.tenantID, f.admin.ID, "", &tc.req)
+			assert.Error(t, err)
+		})
+	}
+
+	f.create(t, models.DataSubjectRequestExport)
+	_, err := f.svc.CreateRequest(ctx, f.tenantID, f.admin.ID, "", &models.CreateDataSubjectRequest{UserID: f.subject.ID, Type: models.DataSubjectRequestExport})
+	assert.Error(t, err, "a second open export is rejected")
+	f.create(t, models.DataSubjectRequestErase)
+}
+
+func readZip(t *testing.T, archive []byte) map[string][]byte {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		files[f.Name] = data
+	}
+	return files
+}
+
+type fakePersonalDataSource struct {
+	name        string
+	data        map[string][]map[string]interface{}
+	erased      map[string]int64
+	err         error
+	eraseCalls  int
+	lastSubject *models.DataSubject
+}
+
+func (s *fakePersonalDataSource) Name() string { return s.name }
+
+func (s *fakePersonalDataSource) Export(ctx context.Context, subject *models.DataSubject) (map[string][]map[string]interface{}, error) {
+	s.lastSubject = subject
+	return s.data, s.err
+}
+
+func (s *fakePersonalDataSource) Erase(ctx context.Context, subject *models.DataSubject) (map[string]int64, error) {
+	s.eraseCalls++
+	s.lastSubject = subject
+	return s.erased, s.err
+}
+
+type fakeDataSubjectRepository struct {
+	requests map[uuid.UUID]*models.DataSubjectRequest
+	archives map[uuid.UUID][]byte
+	order    []uuid.UUID
+}
+
+func newFakeDataSubjectRepository() *fakeDataSubjectRepository {
+	return &fakeDataSubjectRepository{
+		requests: make(map[uuid.UUID]*models.DataSubjectRequest),
+		archives: make(map[uuid.UUID][]byte),
+	}
+}
+
+func (r *fakeDataSubjectRepository) Create(ctx context.Context, req *models.DataSubjectRequest) error {
+	req.ID = uuid.New()
+	req.Status = models.DataSubjectStatusPending
+	r.requests[req.ID] = req
+	r.order = append(r.order, req.ID)
+	return nil
+}
+
+func (r *fakeDataSubjectRepository) Get(ctx context.Context, tenantID, id uuid.UUID) (*models.DataSubjectRequest, error) {
+	req, ok := r.requests[id]
+	if !ok || req.TenantID != tenantID {
+		return nil, fmt.Errorf("request not found")
+	}
+	return req, nil
+}
+
+func (r *fakeDataSubjectRepository) List(ctx context.Context, tenantID uuid.UUID) ([]*models.DataSubjectRequest, error) {
+	var list []*models.DataSubjectRequest
+	for _, id := range r.order {
+		if r.requests[id].TenantID == tenantID {
+			list = append(list, r.requests[id])
+		}
+	}
+	return list, nil
+}
+
+func (r *fakeDataSubjectRepository) HasOpen(ctx context.Context, tenantID, userID uuid.UUID, requestType string) (bool, error) {
+	for _, req := range r.requests {
+		open := req.Status == models.DataSubjectStatusPending || req.Status == models.DataSubjectStatusRunning
+		if open && req.TenantID == tenantID && req.SubjectUserID == userID && req.Type == requestType {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeDataSubjectRepository) ClaimNext(ctx context.Context, now time.Time, lease time.Duration) (*models.DataSubjectRequest, error) {
+	for _, id := range r.order {
+		req := r.requests[id]
+		if req.Status == models.DataSubjectStatusPending {
+			req.Status = models.DataSubjectStatusRunning
+			req.Attempts++
+			claimed := *req
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeDataSubjectRepository) Complete(ctx context.Context, id uuid.UUID, result map[string]interface{}, archive []byte, archiveExpiresAt *time.Time, clearEmail bool, at time.Time) error {
+	req := r.requests[id]
+	req.Status = models.DataSubjectStatusCompleted
+	req.Result = result
+	req.ArchiveExpiresAt = archiveExpiresAt
+	req.HasArchive = archive != nil
+	req.CompletedAt = &at
+	if archive != nil {
+		r.archives[id] = archive
+	}
+	if clearEmail {
+		req.SubjectEmail = nil
+	}
+	return nil
+}
+
+func (r *fakeDataSubjectRepository) MarkRetry(ctx context.Context, id uuid.UUID, lastError string) error {
+	r.requests[id].Status = models.DataSubjectStatusPending
+	r.requests[id].LastError = &lastError
+	return nil
+}
+
+func (r *fakeDataSubjectRepository) MarkFailed(ctx context.Context, id uuid.UUID, lastError string, at time.Time) error {
+	r.requests[id].Status = models.DataSubjectStatusFailed
+	r.requests[id].LastError = &lastError
+	r.requests[id].CompletedAt = &at
+	return nil
+}
+
+func (r *fakeDataSubjectRepository) GetArchive(ctx context.Context, tenantID, id uuid.UUID, now time.Time) ([]byte, error) {
+	req, ok := r.requests[id]
+	if !ok || req.TenantID != tenantID || req.ArchiveExpiresAt == nil || !req.ArchiveExpiresAt.After(now) {
+		return nil, fmt.Errorf("archive not found")
+	}
+	return r.archives[id], nil
+}
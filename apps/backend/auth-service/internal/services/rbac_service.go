@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/google/uuid"
+)
+
+type RBACService interface {
+	ListRoles(ctx context.Context, tenantID uuid.UUID) ([]*models.Role, error)
+	GetRole(ctx context.Context, tenantID, id uuid.UUID) (*models.Role, error)
+	CreateRole(ctx context.Context, tenantID uuid.UUID, granted []string, req *models.CreateRoleRequest) (*models.Role, error)
+	UpdateRole(ctx context.Context, tenantID, id uuid.UUID, granted []string, req *models.UpdateRoleRequest) (*models.Role, error)
+	DeleteRole(ctx context.Context, tenantID, id uuid.UUID) error
+	ListPermissions(ctx context.Context) ([]models.Permission, error)
+	GetUserPermissions(ctx context.Context, tenantID, userID uuid.UUID) (*models.UserPermissions, error)
+	AssignRoles(ctx context.Context, tenantID, userID uuid.UUID, granted []string, roleIDs []string) (*models.UserPermissions, error)
+}
+
+type rbacService struct {
+	userRepo repositories.UserRepository
+	roleRepo repositories.RoleRepository
+}
+
+func NewRBACService(userRepo repositories.UserRepository, roleRepo repositories.RoleRepository) RBACService {
+	return &rbacService{
+		userRepo: userRepo,
+		roleRepo: roleRepo,
+	}
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+func (s *rbacService) ListRoles(ctx context.Context, tenantID uuid.UUID) ([]*models.Role, error) {
+	roles, err := s.roleRepo.ListRoles(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+func (s *rbacService) GetRole(ctx context.Context, tenantID, id uuid.UUID) (*models.Role, error) {
+	return s.roleRepo.GetRole(ctx, tenantID, id)
+}
+
+func (s *rbacService) CreateRole(ctx context.Context, tenantID uuid.UUID, granted []string, req *models.CreateRoleRequest) (*models.Role, error) {
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !roleNamePattern.MatchString(name) || len(name) > 50 {
+		return nil, fmt.Errorf("role name must start with a letter and contain only lowercase letters, digits, '-' and '_'")
+	}
+	if strings.TrimSpace(req.DisplayName) == "" {
+		return nil, fmt.Errorf("display_name is required")
+	}
+
+	roles, err := s.roleRepo.ListRoles(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	for _, role := range roles {
+		if role.Name == name {
+			return nil, fmt.Errorf("role %s already exists", name)
+		}
+	}
+
+	permissions, err := s.validatePermissions(ctx, granted, req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role := &models.Role{
+		TenantID:    &tenantID,
+		Name:        name,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+		Description: req.Description,
+		Permissions: permissions,
+	}
+
+	err = s.roleRepo.CreateRole(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+
+	return role, nil
+}
+
+func (s *rbacService) UpdateRole(ctx context.Context, tenantID, id uuid.UUID, granted []string, req *models.UpdateRoleRequest) (*models.Role, error) {
+	role, err := s.roleRepo.GetRole(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if role.IsSystem {
+		return nil, fmt.Errorf("system roles cannot be modified")
+	}
+
+	// Editing a role changes what everyone holding it can do, so the caller
+	// must already hold everything the role grants today.
+	if err := requireHeld(granted, role.Permissions); err != nil {
+		return nil, err
+	}
+
+	if req.DisplayName != nil {
+		if strings.TrimSpace(*req.DisplayName) == "" {
+			return nil, fmt.Errorf("display_name cannot be empty")
+		}
+		role.DisplayName = strings.TrimSpace(*req.DisplayName)
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		role.Permissions, err = s.validatePermissions(ctx, granted, req.Permissions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.roleRepo.UpdateRole(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+
+	return role, nil
+}
+
+func (s *rbacService) DeleteRole(ctx context.Context, tenantID, id uuid.UUID) error {
+	role, err := s.roleRepo.GetRole(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if role.IsSystem {
+		return fmt.Errorf("system roles cannot be deleted")
+	}
+
+	return s.roleRepo.DeleteRole(ctx, tenantID, id)
+}
+
+// ListPermissions returns the auth-service permissions followed by the
+// permissions registered by modules
+func (s *rbacService) ListPermissions(ctx context.Context) ([]models.Permission, error) {
+	modulePermissions, err := s.roleRepo.ListModulePermissions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list module permissions: %w", err)
+	}
+
+	return append(append([]models.Permission{}, models.CorePermissions...), modulePermissions...), nil
+}
+
+func (s *rbacService) GetUserPermissions(ctx context.Context, tenantID, userID uuid.UUID) (*models.UserPermissions, error) {
+	user, err := s.userRepo.GetByIDAndTenant(ctx, userID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return s.userPermissions(ctx, user)
+}
+
+// AssignRoles replaces the custom roles granted to a user of the tenant
+func (s *rbacService) AssignRoles(ctx context.Context, tenantID, userID uuid.UUID, granted []string, roleIDs []string) (*models.UserPermissions, error) {
+	user, err := s.userRepo.GetByIDAndTenant(ctx, userID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	// Removing roles the caller could not grant would be as much of an
+	// escalation path as adding them, so both sides are checked.
+	current, err := s.roleRepo.GetUserRoles(ctx, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	for _, role := range current {
+		if err := requireHeld(granted, role.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(roleIDs))
+	for _, rawID := range roleIDs {
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid role ID %q", rawID)
+		}
+
+		role, err := s.roleRepo.GetRole(ctx, tenantID, id)
+		if err != nil {
+			return nil, fmt.Errorf("role %s not found", rawID)
+		}
+		if role.IsSystem {
+			return nil, fmt.Errorf("system role %s is assigned through the user's role", role.Name)
+		}
+		if err := requireHeld(granted, role.Permissions); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = s.roleRepo.SetUserRoles(ctx, tenantID, userID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign roles: %w", err)
+	}
+
+	return s.userPermissions(ctx, user)
+}
+
+func (s *rbacService) userPermissions(ctx context.Context, user *models.User) (*models.UserPermissions, error) {
+	roles, err := s.roleRepo.GetUserRoles(ctx, user.TenantID, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	permissions, err := resolvePermissions(ctx, s.roleRepo, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserPermissions{
+		UserID:      user.ID,
+		Role:        user.Role,
+		Roles:       roles,
+		Permissions: permissions,
+	}, nil
+}
+
+// validatePermissions normalizes the requested permissions and checks that
+// each one exists (or, for "module.*" style wildcards, covers at least one
+// known permission) and is held by the caller
+func (s *rbacService) validatePermissions(ctx context.Context, granted, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return nil, fmt.Errorf("a role must grant at least one permission")
+	}
+
+	catalog, err := s.ListPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var permissions []string
+	for _, permission := range requested {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if permission == sharedmiddleware.PermissionAll {
+			return nil, fmt.Errorf("custom roles cannot grant every permission, use the admin role instead")
+		}
+
+		if !knownPermission(catalog, permission) {
+			return nil, fmt.Errorf("unknown permission %q", permission)
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err := requireHeld(granted, permissions); err != nil {
+		return nil, err
+	}
+
+	return uniqueSorted(permissions), nil
+}
+
+// knownPermission reports whether a permission exists or, for "module.*"
+// style wildcards, covers at least one permission of the catalog
+func knownPermission(catalog []models.Permission, permission string) bool {
+	for _, entry := range catalog {
+		if sharedmiddleware.HasPermission([]string{permission}, entry.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requireHeld checks that the caller holds every permission in the list, so
+// nobody can hand out more access than they have themselves
+func requireHeld(granted, permissions []string) error {
+	for _, permission := range permissions {
+		if !sharedmiddleware.HasPermission(granted, permission) {
+			return fmt.Errorf("you cannot grant permission %q that you do not hold", permission)
+		}
+	}
+
+	return nil
+}
+
+// resolvePermissions returns the effective permissions of a user: those of
+// the system role named by users.role plus those of the user's custom roles
+func resolvePermissions(ctx context.Context, roleRepo repositories.RoleRepository, user *models.User) ([]string, error) {
+	base, err := roleRepo.GetSystemRole(ctx, user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve role %s: %w", user.Role, err)
+	}
+
+	roles, err := roleRepo.GetUserRoles(ctx, user.TenantID, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	permissions := append([]string{}, base.Permissions...)
+	for _, role := range roles {
+		permissions = append(permissions, role.Permissions...)
+	}
+
+	for _, permission := range permissions {
+		if permission == sharedmiddleware.PermissionAll {
+			return []string{sharedmiddleware.PermissionAll}, nil
+		}
+	}
+
+	return uniqueSorted(permissions), nil
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRBACService(t *testing.T) (RBACService, *fakeUserRepository, *fakeRoleRepository, uuid.UUID) {
+	userRepo := newFakeUserRepository()
+	roleRepo := newFakeRoleRepository()
+	roleRepo.modulePermissions = []models.Permission{
+		{Name: "crm.lead.read", Module: "crm"},
+		{Name: "crm.lead.write", Module: "crm"},
+		{Name: "hrm.employee.read", Module: "hrm"},
+		{Name: "hrm.salary.read", Module: "hrm"},
+	}
+
+	return NewRBACService(userRepo, roleRepo), userRepo, roleRepo, uuid.New()
+}
+
+func TestCreateRoleValidatesPermissions(t *testing.T) {
+	svc, _, _, tenantID := newTestRBACService(t)
+	ctx := context.Background()
+	manager := []string{"roles.write", "crm.*", "hrm.employee.read"}
+
+	role, err := svc.CreateRole(ctx, tenantID, manager, &models.CreateRoleRequest{
+		Name:        "Sales",
+		DisplayName: "Sales",
+		Permissions: []string{"crm.lead.write", "crm.*", " CRM.LEAD.WRITE "},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "sales", role.Name)
+	assert.Equal(t, []string{"crm.*", "crm.lead.write"}, role.Permissions)
+	assert.Equal(t, tenantID, *role.TenantID)
+
+	for _, tt := range []struct {
+		name        string
+		permissions []string
+	}{
+		{"unknown", []string{"crm.invoice.write"}},
+		{"unknown-wildcard", []string{"billing.*"}},
+		{"everything", []string{"*"}},
+		{"not-held", []string{"hrm.salary.read"}},
+		{"broader-than-held", []string{"hrm.*"}},
+		{"empty", []string{}},
+	} {
+		_, err := svc.CreateRole(ctx, tenantID, manager, &models.CreateRoleRequest{
+			Name:        tt.name,
+			DisplayName: tt.name,
+			Permissions: tt.permissions,
+		})
+		assert.Error(t, err, tt.name)
+	}
+
+	_, err = svc.CreateRole(ctx, tenantID, manager, &models.CreateRoleRequest{
+		Name:        "sales",
+		DisplayName: "Duplicate",
+		Permissions: []string{"crm.lead.read"},
+	})
+	assert.Error(t, err)
+
+	_, err = svc.CreateRole(ctx, tenantID, manager, &models.CreateRoleRequest{
+		Name:        "manager",
+		DisplayName: "Shadows a system role",
+		Permissions: []string{"crm.lead.read"},
+	})
+	assert.Error(t, err)
+}
+
+func TestSystemRolesAreReadOnly(t *testing.T) {
+	svc, _, roleRepo, tenantID := newTestRBACService(t)
+	ctx := context.Background()
+	admin := roleRepo.systemRole(models.RoleAdmin)
+
+	name := "Owner"
+	_, err := svc.UpdateRole(ctx, tenantID, admin.ID, []string{"*"}, &models.UpdateRoleRequest{DisplayName: &name})
+	assert.Error(t, err)
+	assert.Error(t, svc.DeleteRole(ctx, tenantID, admin.ID))
+}
+
+func TestAssignRolesResolvesEffectivePermissions(t *testing.T) {
+	svc, userRepo, _, tenantID := newTestRBACService(t)
+	ctx := context.Background()
+	admin := []string{"*"}
+
+	user := &models.User{TenantID: tenantID, Email: "jane@example.com", Role: models.RoleUser}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	payroll, err := svc.CreateRole(ctx, tenantID, admin, &models.CreateRoleRequest{
+		Name:        "payroll",
+		DisplayName: "Payroll",
+		Permissions: []string{"hrm.salary.read", "hrm.employee.read"},
+	})
+	require.NoError(t, err)
+
+	result, err := svc.AssignRoles(ctx, tenantID, user.ID, admin, []string{payroll.ID.String()})
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, result.Role)
+	require.Len(t, result.Roles, 1)
+	assert.Equal(t, "payroll", result.Roles[0].Name)
+	assert.Equal(t, []string{"crm.lead.read", "hrm.employee.read", "hrm.salary.read"}, result.Permissions)
+
+	// Callers can neither grant nor revoke roles carrying permissions they lack
+	_, err = svc.AssignRoles(ctx, tenantID, user.ID, []string{"roles.write", "hrm.employee.read"}, nil)
+	assert.Error(t, err)
+
+	// Roles of other tenants are invisible
+	otherTenant := uuid.New()
+	foreign, err := svc.CreateRole(ctx, otherTenant, admin, &models.CreateRoleRequest{
+		Name:        "payroll",
+		DisplayName: "Payroll",
+		Permissions: []string{"hrm.salary.read"},
+	})
+	require.NoError(t, err)
+	_, err = svc.AssignRoles(ctx, tenantID, user.ID, admin, []string{foreign.ID.String()})
+	assert.Error(t, err)
+
+	// Users of other tenants cannot be targeted
+	_, err = svc.AssignRoles(ctx, otherTenant, user.ID, admin, nil)
+	assert.Error(t, err)
+
+	// System roles are granted through users.role, not user_roles
+	_, err = svc.AssignRoles(ctx, tenantID, user.ID, admin, []string{newFakeRoleRepository().systemRole(models.RoleAdmin).ID.String()})
+	assert.Error(t, err)
+
+	result, err = svc.AssignRoles(ctx, tenantID, user.ID, admin, []string{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Roles)
+	assert.Equal(t, []string{"crm.lead.read"}, result.Permissions)
+}
+
+func TestIssuedTokensEmbedPermissions(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+	}
+
+	userRepo := newFakeUserRepository()
+	roleRepo := newFakeRoleRepository()
+	jwtService := NewJWTService(cfg)
+	authService := NewAuthService(userRepo, nil, userRepo, &fakeRefreshTokenRepository{}, newFakeSAMLRepository(), roleRepo, newTestPasswordPolicyService(nil), newTestLoginProtectionService(userRepo), jwtService, &fakeTenantClient{}, cfg)
+
+	tenantID := uuid.New()
+	user := &models.User{TenantID: tenantID, Email: "jane@example.com", Role: models.RoleUser}
+	require.NoError(t, userRepo.Create(ctx, user))
+	user, _ = userRepo.GetByID(ctx, user.ID)
+
+	custom := &models.Role{TenantID: &tenantID, Name: "hr", DisplayName: "HR", Permissions: []string{"hrm.*"}}
+	require.NoError(t, roleRepo.CreateRole(ctx, custom))
+	require.NoError(t, roleRepo.SetUserRoles(ctx, user.TenantID, user.ID, []uuid.UUID{custom.ID}))
+
+	tokens, err := authService.IssueTokens(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crm.lead.read", "hrm.*"}, tokens.Permissions)
+
+	token, err := jwtService.ValidateToken(tokens.AccessToken)
+	require.NoError(t, err)
+	claims, err := jwtService.ParseUserClaims(token)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"crm.lead.read", "hrm.*"}, claims.Permissions)
+
+	// A wildcard anywhere collapses to the single "*" grant
+	user.Role = models.RoleAdmin
+	tokens, err = authService.IssueTokens(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*"}, tokens.Permissions)
+
+	// Unknown base roles fail closed
+	user.Role = "system_admin"
+	_, err = authService.IssueTokens(ctx, user)
+	assert.Error(t, err)
+}
+
+func TestTokensAreBoundToIssuerAndAudience(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+		JWTIssuer:           "zplus-saas",
+		JWTAudience:         "zplus-users",
+		JWTServiceAudience:  "zplus-services",
+	}
+	jwtService := NewJWTService(cfg)
+
+	serviceToken, err := jwtService.GenerateServiceToken(uuid.New(), nil, time.Minute)
+	require.NoError(t, err)
+	_, err = jwtService.ValidateToken(serviceToken)
+	require.NoError(t, err)
+
+	sign := func(role, issuer, audience string) string {
+		claims := &UserClaims{Role: role, IsActive: true, RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			Issuer:    issuer,
+			Audience:  []string{audience},
+		}}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWTSecret))
+		require.NoError(t, err)
+		return token
+	}
+
+	_, err = jwtService.ValidateToken(sign(models.RoleUser, "zplus-saas", "zplus-users"))
+	assert.NoError(t, err)
+	_, err = jwtService.ValidateToken(sign(models.RoleUser, "another-issuer", "zplus-users"))
+	assert.Error(t, err)
+	_, err = jwtService.ValidateToken(sign(models.RoleUser, "zplus-saas", "zplus-services"))
+	assert.Error(t, err, "a user token needs the user audience")
+	_, err = jwtService.ValidateToken(sign(sharedmiddleware.RoleService, "zplus-saas", "zplus-users"))
+	assert.Error(t, err, "a service token needs the service audience")
+}
+
+// In-memory role repository seeded with the system roles
+
+type fakeRoleRepository struct {
+	roles             map[uuid.UUID]*models.Role
+	userRoles         map[uuid.UUID][]uuid.UUID
+	modulePermissions []models.Permission
+}
+
+var fakeSystemRoleIDs = map[string]uuid.UUID{
+	models.RoleSuperAdmin: uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+	models.RoleAdmin:      uuid.MustParse("00000000-0000-0000-0000-000000000002"),
+	models.RoleManager:    uuid.MustParse("00000000-0000-0000-0000-000000000003"),
+	models.RoleUser:       uuid.MustParse("00000000-0000-0000-0000-000000000004"),
+}
+
+func newFakeRoleRepository() *fakeRoleRepository {
+	r := &fakeRoleRepository{
+		roles:     make(map[uuid.UUID]*models.Role),
+		userRoles: make(map[uuid.UUID][]uuid.UUID),
+	}
+
+	for name, permissions := range map[string][]string{
+		models.RoleSuperAdmin: {"*"},
+		models.RoleAdmin:      {"*"},
+		models.RoleManager:    {"users.read", "roles.read", "crm.*"},
+		models.RoleUser:       {"crm.lead.read"},
+	} {
+		id := fakeSystemRoleIDs[name]
+		r.roles[id] = &models.Role{ID: id, Name: name, DisplayName: name, Permissions: permissions, IsSystem: true}
+	}
+
+	return r
+}
+
+func (r *fakeRoleRepository) systemRole(name string) *models.Role {
+	return r.roles[fakeSystemRoleIDs[name]]
+}
+
+func (r *fakeRoleRepository) ListRoles(ctx context.Context, tenantID uuid.UUID) ([]*models.Role, error) {
+	var roles []*models.Role
+	for _, role := range r.roles {
+		if role.TenantID == nil || *role.TenantID == tenantID {
+			copied := *role
+			roles = append(roles, &copied)
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *fakeRoleRepository) GetRole(ctx context.Context, tenantID, id uuid.UUID) (*models.Role, error) {
+	role, ok := r.roles[id]
+	if !ok || (role.TenantID != nil && *role.TenantID != tenantID) {
+		return nil, fmt.Errorf("role not found")
+	}
+	copied := *role
+	return &copied, nil
+}
+
+func (r *fakeRoleRepository) GetSystemRole(ctx context.Context, name string) (*models.Role, error) {
+	id, ok := fakeSystemRoleIDs[name]
+	if !ok {
+		return nil, fmt.Errorf("role not found")
+	}
+	copied := *r.roles[id]
+	return &copied, nil
+}
+
+func (r *fakeRoleRepository) CreateRole(ctx context.Context, role *models.Role) error {
+	role.ID = uuid.New()
+	copied := *role
+	r.roles[role.ID] = &copied
+	return nil
+}
+
+func (r *fakeRoleRepository) UpdateRole(ctx context.Context, role *models.Role) error {
+	existing, ok := r.roles[role.ID]
+	if !ok || existing.IsSystem {
+		return fmt.Errorf("role not found")
+	}
+	copied := *role
+	r.roles[role.ID] = &copied
+	return nil
+}
+
+func (r *fakeRoleRepository) DeleteRole(ctx context.Context, tenantID, id uuid.UUID) error {
+	role, ok := r.roles[id]
+	if !ok || role.IsSystem || *role.TenantID != tenantID {
+		return fmt.Errorf("role not found")
+	}
+	delete(r.roles, id)
+	return nil
+}
+
+func (r *fakeRoleRepository) GetUserRoles(ctx context.Context, tenantID, userID uuid.UUID) ([]*models.Role, error) {
+	var roles []*models.Role
+	for _, id := range r.userRoles[userID] {
+		if role := r.roles[id]; role.TenantID != nil && *role.TenantID == tenantID {
+			copied := *role
+			roles = append(roles, &copied)
+		}
+	}
+	return roles, nil
+}
+
+func (r *fakeRoleRepository) SetUserRoles(ctx context.Context, tenantID, userID uuid.UUID, roleIDs []uuid.UUID) error {
+	var kept []uuid.UUID
+	for _, id := range r.userRoles[userID] {
+		if role := r.roles[id]; role.TenantID == nil || *role.TenantID != tenantID {
+			kept = append(kept, id)
+		}
+	}
+	r.userRoles[userID] = append(kept, roleIDs...)
+	return nil
+}
+
+func (r *fakeRoleRepository) ListModulePermissions(ctx context.Context) ([]models.Permission, error) {
+	return r.modulePermissions, nil
+}
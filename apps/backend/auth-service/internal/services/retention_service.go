@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// retentionPeriod is how often retention runs
+	retentionPeriod = 24 * time.Hour
+	// retentionCheckInterval is how often a worker checks whether a run is due
+	retentionCheckInterval = time.Hour
+	maxRetentionDays       = 3650
+	maxRetentionRuns       = 100
+)
+
+// RetentionService manages a tenant's retention policies and legal holds and
+// reports what retention removes. Data is removed by the RetentionWorker.
+type RetentionService interface {
+	GetPolicies(ctx context.Context, tenantID uuid.UUID) ([]*models.RetentionPolicy, error)
+	UpdatePolicy(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, req *models.UpdateRetentionPolicyRequest) ([]*models.RetentionPolicy, error)
+	ListHolds(ctx context.Context, tenantID uuid.UUID) ([]*models.LegalHold, error)
+	PlaceHold(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, req *models.CreateLegalHoldRequest) (*models.LegalHold, error)
+	ReleaseHold(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, id uuid.UUID) error
+	// DryRun reports what retention would remove from the tenant now
+	DryRun(ctx context.Context, tenantID, actorID uuid.UUID) (*models.RetentionRun, error)
+	ListRuns(ctx context.Context, tenantID uuid.UUID) ([]*models.RetentionRun, error)
+	// Metrics totals what retention removed over the last days
+	Metrics(ctx context.Context, tenantID uuid.UUID, days int) (*models.RetentionMetrics, error)
+}
+
+type retentionService struct {
+	retentionRepo repositories.RetentionRepository
+	auditRepo     repositories.AuditRepository
+	now           func() time.Time
+}
+
+func NewRetentionService(retentionRepo repositories.RetentionRepository, auditRepo repositories.AuditRepository) RetentionService {
+	return &retentionService{
+		retentionRepo: retentionRepo,
+		auditRepo:     auditRepo,
+		now:           time.Now,
+	}
+}
+
+func (s *retentionService) GetPolicies(ctx context.Context, tenantID uuid.UUID) ([]*models.RetentionPolicy, error) {
+	tenant, err := s.retentionRepo.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make([]*models.RetentionPolicy, 0, len(models.RetentionClasses))
+	for _, dataClass := range models.RetentionClasses {
+		_, overridden := tenant.Overrides[dataClass]
+		policies = append(policies, &models.RetentionPolicy{
+			DataClass:     dataClass,
+			RetentionDays: tenant.Days(dataClass),
+			Overridden:    overridden,
+		})
+	}
+
+	return policies, nil
+}
+
+func (s *retentionService) UpdatePolicy(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, req *models.UpdateRetentionPolicyRequest) ([]*models.RetentionPolicy, error) {
+	if !isRetentionClass(req.DataClass) {
+		return nil, fmt.Errorf("unknown data class %q", req.DataClass)
+	}
+	if req.RetentionDays != nil && (*req.RetentionDays < 1 || *req.RetentionDays > maxRetentionDays) {
+		return nil, fmt.Errorf("retention_days must be between 1 and %d", maxRetentionDays)
+	}
+
+	if err := s.retentionRepo.SetOverride(ctx, tenantID, req.DataClass, req.RetentionDays, actorID); err != nil {
+		return nil, fmt.Errorf("failed to update retention policy: %w", err)
+	}
+
+	s.audit(ctx, tenantID, actorID, ipAddress, models.AuditActionRetentionPolicy, map[string]interface{}{
+		"data_class":     req.DataClass,
+		"retention_days": req.RetentionDays,
+	})
+
+	return s.GetPolicies(ctx, tenantID)
+}
+
+func (s *retentionService) ListHolds(ctx context.Context, tenantID uuid.UUID) ([]*models.LegalHold, error) {
+	return s.retentionRepo.ListHolds(ctx, tenantID)
+}
+
+func (s *retentionService) PlaceHold(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, req *models.CreateLegalHoldRequest) (*models.LegalHold, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	if len(reason) > 1000 {
+		return nil, fmt.Errorf("reason must be at most 1000 characters")
+	}
+
+	hold := &models.LegalHold{
+		TenantID:  tenantID,
+		Reason:    reason,
+		CreatedBy: &actorID,
+	}
+
+	if req.DataClass != nil && *req.DataClass != "" {
+		if !isRetentionClass(*req.DataClass) {
+			return nil, fmt.Errorf("unknown data class %q", *req.DataClass)
+		}
+		hold.DataClass = req.DataClass
+	}
+
+	hasType := req.EntityType != nil && *req.EntityType != ""
+	hasID := req.EntityID != nil && strings.TrimSpace(*req.EntityID) != ""
+	if hasType != hasID {
+		return nil, fmt.Errorf("entity_type and entity_id must be given together")
+	}
+	if hasType {
+		classes, ok := models.LegalHoldEntityClasses[*req.EntityType]
+		if !ok {
+			return nil, fmt.Errorf("unknown entity type %q", *req.EntityType)
+		}
+		if hold.DataClass != nil && !containsString(classes, *hold.DataClass, stringsEqual) {
+			return nil, fmt.Errorf("a %s cannot be held in %s", *req.EntityType, *hold.DataClass)
+		}
+		entityID := strings.TrimSpace(*req.EntityID)
+		if len(entityID) > 255 {
+			return nil, fmt.Errorf("entity_id must be at most 255 characters")
+		}
+		hold.EntityType = req.EntityType
+		hold.EntityID = &entityID
+	}
+
+	if err := s.retentionRepo.CreateHold(ctx, hold); err != nil {
+		return nil, fmt.Errorf("failed to place legal hold: %w", err)
+	}
+
+	s.audit(ctx, tenantID, actorID, ipAddress, models.AuditActionLegalHoldPlaced, map[string]interface{}{
+		"hold_id":     hold.ID.String(),
+		"data_class":  hold.DataClass,
+		"entity_type": hold.EntityType,
+		"entity_id":   hold.EntityID,
+		"reason":      reason,
+	})
+
+	return hold, nil
+}
+
+func (s *retentionService) ReleaseHold(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress string, id uuid.UUID) error {
+	if err := s.retentionRepo.ReleaseHold(ctx, tenantID, id, actorID, s.now()); err != nil {
+		return err
+	}
+
+	s.audit(ctx, tenantID, actorID, ipAddress, models.AuditActionLegalHoldLifted, map[string]interface{}{
+		"hold_id": id.String(),
+	})
+	return nil
+}
+
+func (s *retentionService) DryRun(ctx context.Context, tenantID, actorID uuid.UUID) (*models.RetentionRun, error) {
+	tenant, err := s.retentionRepo.GetTenant(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	holds, err := s.retentionRepo.ListHolds(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	run := applyRetention(ctx, s.retentionRepo, tenant, holds, s.now, true)
+	run.TriggeredBy = &actorID
+	if err := s.retentionRepo.CreateRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("failed to record dry run: %w", err)
+	}
+
+	return run, nil
+}
+
+func (s *retentionService) ListRuns(ctx context.Context, tenantID uuid.UUID) ([]*models.RetentionRun, error) {
+	return s.retentionRepo.ListRuns(ctx, tenantID, maxRetentionRuns)
+}
+
+func (s *retentionService) Metrics(ctx context.Context, tenantID uuid.UUID, days int) (*models.RetentionMetrics, error) {
+	if days < 1 || days > 365 {
+		return nil, fmt.Errorf("days must be between 1 and 365")
+	}
+	return s.retentionRepo.Metrics(ctx, tenantID, s.now().AddDate(0, 0, -days))
+}
+
+func (s *retentionService) audit(ctx context.Context, tenantID, actorID uuid.UUID, ipAddress, action string, details map[string]interface{}) {
+	err := s.auditRepo.Create(ctx, &models.AuditLog{
+		TenantID:  &tenantID,
+		ActorID:   &actorID,
+		Action:    action,
+		IPAddress: ipAddress,
+		Details:   details,
+	})
+	if err != nil {
+		log.Printf("Failed to audit %s for tenant %s: %v", action, tenantID, err)
+	}
+}
+
+// RetentionWorker removes data past each tenant's retention once per
+// retentionPeriod. Instances take a database lock, so only one runs a pass.
+type RetentionWorker struct {
+	retentionRepo repositories.RetentionRepository
+	now           func() time.Time
+}
+
+func NewRetentionWorker(retentionRepo repositories.RetentionRepository) *RetentionWorker {
+	return &RetentionWorker{
+		retentionRepo: retentionRepo,
+		now:           time.Now,
+	}
+}
+
+// Run enforces retention until ctx is cancelled
+func (w *RetentionWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.RunDue(ctx); err != nil {
+			log.Printf("Retention: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue runs a retention pass over every tenant if none ran within the
+// retention period. It reports whether it ran one.
+func (w *RetentionWorker) RunDue(ctx context.Context) (bool, error) {
+	release, acquired, err := w.retentionRepo.Lock(ctx)
+	if err != nil || !acquired {
+		return false, err
+	}
+	defer release()
+
+	last, err := w.retentionRepo.LastRunAt(ctx)
+	if err != nil {
+		return false, err
+	}
+	if last != nil && w.now().Sub(*last) < retentionPeriod {
+		return false, nil
+	}
+
+	tenants, err := w.retentionRepo.ListTenants(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list tenants: %w", err)
+	}
+
+	var total int64
+	for _, tenant := range tenants {
+		holds, err := w.retentionRepo.ListHolds(ctx, tenant.TenantID)
+		if err != nil {
+			log.Printf("Retention: skipping tenant %s: failed to load legal holds: %v", tenant.TenantID, err)
+			continue
+		}
+
+		run := applyRetention(ctx, w.retentionRepo, tenant, holds, w.now, false)
+		if err := w.retentionRepo.CreateRun(ctx, run); err != nil {
+			log.Printf("Retention: failed to record run for tenant %s: %v", tenant.TenantID, err)
+		}
+		if run.TotalRemoved > 0 {
+			log.Printf("Retention: removed %d rows from tenant %s", run.TotalRemoved, tenant.TenantID)
+		}
+		total += run.TotalRemoved
+	}
+
+	log.Printf("Retention: pass over %d tenants removed %d rows", len(tenants), total)
+	return true, nil
+}
+
+// applyRetention runs every data class of a tenant, or counts what it would
+// remove when dryRun is set. A class that fails is reported and does not stop
+// the others.
+func applyRetention(ctx context.Context, repo repositories.RetentionRepository, tenant *models.TenantRetention, holds []*models.LegalHold, now func() time.Time, dryRun bool) *models.RetentionRun {
+	run := &models.RetentionRun{
+		TenantID:  tenant.TenantID,
+		DryRun:    dryRun,
+		Report:    make(map[string]*models.RetentionClassReport),
+		StartedAt: now(),
+	}
+
+	for _, dataClass := range models.RetentionClasses {
+		report := &models.RetentionClassReport{RetentionDays: tenant.Days(dataClass)}
+		run.Report[dataClass] = report
+
+		if report.RetentionDays <= 0 {
+			report.Skipped = "kept indefinitely"
+			continue
+		}
+		if heldTenantWide(holds, dataClass) {
+			report.Skipped = "legal hold"
+			continue
+		}
+
+		cutoff := run.StartedAt.AddDate(0, 0, -report.RetentionDays)
+		report.Cutoff = &cutoff
+
+		removed, err := repo.Purge(ctx, tenant.TenantID, dataClass, cutoff, dryRun)
+		if errors.Is(err, repositories.ErrRetentionDataUnavailable) {
+			report.Skipped = "not installed"
+			continue
+		}
+		if err != nil {
+			log.Printf("Retention: %s of tenant %s failed: %v", dataClass, tenant.TenantID, err)
+			report.Skipped = "failed: " + err.Error()
+			continue
+		}
+
+		report.Removed = removed
+		run.TotalRemoved += removed
+	}
+
+	run.CompletedAt = now()
+	return run
+}
+
+// heldTenantWide reports whether an active hold without an entity covers the
+// data class
+func heldTenantWide(holds []*models.LegalHold, dataClass string) bool {
+	for _, hold := range holds {
+		if hold.ReleasedAt != nil || hold.EntityType != nil {
+			continue
+		}
+		if hold.DataClass == nil || *hold.DataClass == dataClass {
+			return true
+		}
+	}
+	return false
+}
+
+func isRetentionClass(dataClass string) bool {
+	return containsString(models.RetentionClasses, dataClass, stringsEqual)
+}
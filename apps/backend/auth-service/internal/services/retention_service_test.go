@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRetentionUsesOverridesAndHolds(t *testing.T) {
+	now := time.Date(2026, 5, 1, 3, 0, 0, 0, time.UTC)
+	repo := newFakeRetentionRepository()
+	tenant := repo.addTenant(365)
+	tenant.Overrides[models.RetentionClassCheckinPhotos] = 30
+	repo.removable[models.RetentionClassCheckinPhotos] = 4
+	repo.removable[models.RetentionClassRefreshTokens] = 12
+	repo.unavailable[models.RetentionClassContactActivities] = true
+	repo.failing[models.RetentionClassPasswordResets] = errors.New("deadlock detected")
+
+	filesClass := models.RetentionClassDeletedFiles
+	holds := []*models.LegalHold{
+		{DataClass: &filesClass},
+		// Released holds and entity holds do not stop a whole class
+		{ReleasedAt: &now},
+		{EntityType: stringPtr(models.LegalHoldEntityEmployee), EntityID: stringPtr("42")},
+	}
+
+	run := applyRetention(context.Background(), repo, tenant, holds, func() time.Time { return now }, false)
+
+	photos := run.Report[models.RetentionClassCheckinPhotos]
+	assert.Equal(t, 30, photos.RetentionDays)
+	assert.Equal(t, now.AddDate(0, 0, -30), *photos.Cutoff)
+	assert.Equal(t, int64(4), photos.Removed)
+	assert.Equal(t, now.AddDate(0, 0, -365), repo.cutoffs[models.RetentionClassCheckinRecords])
+
+	assert.Equal(t, "legal hold", run.Report[models.RetentionClassDeletedFiles].Skipped)
+	assert.NotContains(t, repo.cutoffs, models.RetentionClassDeletedFiles)
+	assert.Equal(t, "not installed", run.Report[models.RetentionClassContactActivities].Skipped)
+	assert.Contains(t, run.Report[models.RetentionClassPasswordResets].Skipped, "deadlock")
+
+	assert.Equal(t, int64(16), run.TotalRemoved)
+	assert.Equal(t, int64(0), repo.removable[models.RetentionClassRefreshTokens], "rows were purged")
+}
+
+func TestApplyRetentionKeepsDataWithoutPolicy(t *testing.T) {
+	repo := newFakeRetentionRepository()
+	tenant := repo.addTenant(0)
+	tenant.Overrides[models.RetentionClassRefreshTokens] = 7
+
+	run := applyRetention(context.Background(), repo, tenant, nil, time.Now, false)
+
+	assert.Equal(t, "kept indefinitely", run.Report[models.RetentionClassCheckinRecords].Skipped)
+	assert.Empty(t, run.Report[models.RetentionClassRefreshTokens].Skipped)
+	assert.Len(t, repo.cutoffs, 1)
+}
+
+func TestRetentionDryRunRemovesNothing(t *testing.T) {
+	repo := newFakeRetentionRepository()
+	tenant := repo.addTenant(90)
+	repo.removable[models.RetentionClassCheckinRecords] = 250
+	svc := NewRetentionService(repo, &fakeAuditRepository{}).(*retentionService)
+	actorID := uuid.New()
+
+	run, err := svc.DryRun(context.Background(), tenant.TenantID, actorID)
+	require.NoError(t, err)
+
+	assert.True(t, run.DryRun)
+	assert.Equal(t, actorID, *run.TriggeredBy)
+	assert.Equal(t, int64(250), run.Report[models.RetentionClassCheckinRecords].Removed)
+	assert.Equal(t, int64(250), repo.removable[models.RetentionClassCheckinRecords])
+	require.Len(t, repo.runs, 1)
+}
+
+func TestRetentionWorkerRunsOncePerPeriod(t *testing.T) {
+	repo := newFakeRetentionRepository()
+	repo.addTenant(365)
+	repo.addTenant(30)
+	now := time.Date(2026, 5, 1, 3, 0, 0, 0, time.UTC)
+	worker := NewRetentionWorker(repo)
+	worker.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	ran, err := worker.RunDue(ctx)
+	require.NoError(t, err)
+	assert.True(t, ran)
+	assert.Len(t, repo.runs, 2)
+	assert.False(t, repo.locked, "lock is released")
+
+	now = now.Add(retentionPeriod - time.Minute)
+	ran, err = worker.RunDue(ctx)
+	require.NoError(t, err)
+	assert.False(t, ran)
+
+	now = now.Add(time.Minute)
+	repo.locked = true
+	ran, err = worker.RunDue(ctx)
+	require.NoError(t, err)
+	assert.False(t, ran, "another instance holds the lock")
+
+	repo.locked = false
+	ran, err = worker.RunDue(ctx)
+	require.NoError(t, err)
+	assert.True(t, ran)
+	assert.Len(t, repo.runs, 4)
+}
+
+func TestPlaceLegalHoldValidation(t *testing.T) {
+	repo := newFakeRetentionRepository()
+	auditRepo := &fakeAuditRepository{}
+	svc := NewRetentionService(repo, auditRepo)
+	tenantID := uuid.New()
+	ctx := context.Background()
+
+	invalid := []models.CreateLegalHoldRequest{
+		{Reason: " "},
+		{Reason: "litigation", DataClass: stringPtr("emails")},
+		{Reason: "litigation", EntityType: stringPtr(models.LegalHoldEntityEmployee)},
+		{Reason: "litigation", EntityType: stringPtr("invoice"), EntityID: stringPtr("7")},
+		{Reason: "litigation", EntityType: stringPtr(models.LegalHoldEntityLead), EntityID: stringPtr("7"), DataClass: stringPtr(models.RetentionClassRefreshTokens)},
+	}
+	for i, req := range invalid {
+		_, err := svc.PlaceHold(ctx, tenantID, uuid.New(), "", &req)
+		assert.Error(t, err, "request %d", i)
+	}
+
+	hold, err := svc.PlaceHold(ctx, tenantID, uuid.New(), "203.0.113.7", &models.CreateLegalHoldRequest{
+		Reason:     "litigation",
+		EntityType: stringPtr(models.LegalHoldEntityCustomer),
+		EntityID:   stringPtr(" 17 "),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "17", *hold.EntityID)
+	assert.Nil(t, hold.DataClass)
+	require.Len(t, auditRepo.entries, 1)
+	assert.Equal(t, models.AuditActionLegalHoldPlaced, auditRepo.entries[0].Action)
+}
+
+func TestUpdateRetentionPolicy(t *testing.T) {
+	repo := newFakeRetentionRepository()
+	tenant := repo.addTenant(365)
+	svc := NewRetentionService(repo, &fakeAuditRepository{})
+	ctx := context.Background()
+
+	_, err := svc.UpdatePolicy(ctx, tenant.TenantID, uuid.New(), "", &models.UpdateRetentionPolicyRequest{DataClass: models.RetentionClassCheckinPhotos, RetentionDays: intPtr(0)})
+	assert.Error(t, err)
+
+	policies, err := svc.UpdatePolicy(ctx, tenant.TenantID, uuid.New(), "", &models.UpdateRetentionPolicyRequest{DataClass: models.RetentionClassCheckinPhotos, RetentionDays: intPtr(30)})
+	require.NoError(t, err)
+	assert.Equal(t, &models.RetentionPolicy{DataClass: models.RetentionClassCheckinPhotos, RetentionDays: 30, Overridden: true}, policies[0])
+	assert.Equal(t, &models.RetentionPolicy{DataClass: models.RetentionClassCheckinRecords, RetentionDays: 365}, policies[1])
+
+	policies, err = svc.UpdatePolicy(ctx, tenant.TenantID, uuid.New(), "", &models.UpdateRetentionPolicyRequest{DataClass: models.RetentionClassCheckinPhotos})
+	require.NoError(t, err)
+	assert.Equal(t, 365, policies[0].RetentionDays)
+	assert.False(t, policies[0].Overridden)
+}
+
+func stringPtr(s string) *string { return &s }
+
+func intPtr(i int) *int { return &i }
+
+type fakeRetentionRepository struct {
+	tenants     []*models.TenantRetention
+	removable   map[string]int64
+	unavailable map[string]bool
+	failing     map[string]error
+	cutoffs     map[string]time.Time
+	runs        []*models.RetentionRun
+	holds       []*models.LegalHold
+	locked      bool
+}
+
+func newFakeRetentionRepository() *fakeRetentionRepository {
+	return &fakeRetentionRepository{
+		removable:   make(map[string]int64),
+		unavailable: make(map[string]bool),
+		failing:     make(map[string]error),
+		cutoffs:     make(map[string]time.Time),
+	}
+}
+
+func (r *fakeRetentionRepository) addTenant(defaultDays int) *models.TenantRetention {
+	tenant := &models.TenantRetention{TenantID: uuid.New(), DefaultDays: defaultDays, Overrides: make(map[string]int)}
+	r.tenants = append(r.tenants, tenant)
+	return tenant
+}
+
+func (r *fakeRetentionRepository) ListTenants(ctx context.Context) ([]*models.TenantRetention, error) {
+	return r.tenants, nil
+}
+
+func (r *fakeRetentionRepository) GetTenant(ctx context.Context, tenantID uuid.UUID) (*models.TenantRetention, error) {
+	for _, tenant := range r.tenants {
+		if tenant.TenantID == tenantID {
+			return tenant, nil
+		}
+	}
+	return nil, fmt.Errorf("tenant not found")
+}
+
+func (r *fakeRetentionRepository) SetOverride(ctx context.Context, tenantID uuid.UUID, dataClass string, days *int, updatedBy uuid.UUID) error {
+	tenant, err := r.GetTenant(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if days == nil {
+		delete(tenant.Overrides, dataClass)
+	} else {
+		tenant.Overrides[dataClass] = *days
+	}
+	return nil
+}
+
+func (r *fakeRetentionRepository) ListHolds(ctx context.Context, tenantID uuid.UUID) ([]*models.LegalHold, error) {
+	var holds []*models.LegalHold
+	for _, hold := range r.holds {
+		if hold.TenantID == tenantID {
+			holds = append(holds, hold)
+		}
+	}
+	return holds, nil
+}
+
+func (r *fakeRetentionRepository) CreateHold(ctx context.Context, hold *models.LegalHold) error {
+	hold.ID = uuid.New()
+	r.holds = append(r.holds, hold)
+	return nil
+}
+
+func (r *fakeRetentionRepository) ReleaseHold(ctx context.Context, tenantID, id, releasedBy uuid.UUID, at time.Time) error {
+	for _, hold := range r.holds {
+		if hold.ID == id && hold.TenantID == tenantID && hold.ReleasedAt == nil {
+			hold.ReleasedAt = &at
+			return nil
+		}
+	}
+	return fmt.Errorf("legal hold not found")
+}
+
+func (r *fakeRetentionRepository) Purge(ctx context.Context, tenantID uuid.UUID, dataClass string, cutoff time.Time, dryRun bool) (int64, error) {
+	r.cutoffs[dataClass] = cutoff
+	if r.unavailable[dataClass] {
+		return 0, fmt.Errorf("%w: %s", repositories.ErrRetentionDataUnavailable, dataClass)
+	}
+	if err := r.failing[dataClass]; err != nil {
+		return 0, err
+	}
+	removed := r.removable[dataClass]
+	if !dryRun {
+		r.removable[dataClass] = 0
+	}
+	return removed, nil
+}
+
+func (r *fakeRetentionRepository) CreateRun(ctx context.Context, run *models.RetentionRun) error {
+	run.ID = uuid.New()
+	r.runs = append(r.runs, run)
+	return nil
+}
+
+func (r *fakeRetentionRepository) ListRuns(ctx context.Context, tenantID uuid.UUID, limit int) ([]*models.RetentionRun, error) {
+	return r.runs, nil
+}
+
+func (r *fakeRetentionRepository) Metrics(ctx context.Context, tenantID uuid.UUID, since time.Time) (*models.RetentionMetrics, error) {
+	return &models.RetentionMetrics{Since: since, Removed: map[string]int64{}}, nil
+}
+
+func (r *fakeRetentionRepository) LastRunAt(ctx context.Context) (*time.Time, error) {
+	var last *time.Time
+	for _, run := range r.runs {
+		if !run.DryRun && (last == nil || run.StartedAt.After(*last)) {
+			startedAt := run.StartedAt
+			last = &startedAt
+		}
+	}
+	return last, nil
+}
+
+func (r *fakeRetentionRepository) Lock(ctx context.Context) (func(), bool, error) {
+	if r.locked {
+		return nil, false, nil
+	}
+	r.locked = true
+	return func() { r.locked = false }, true, nil
+}
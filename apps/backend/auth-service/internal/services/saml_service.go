@@ -0,0 +1,592 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlRequestTTL          = 10 * time.Minute
+	samlCertificateValidity = 10 * 365 * 24 * time.Hour
+)
+
+// Attribute names tried when a connection has no explicit attribute mapping.
+// Covers the common Azure AD / ADFS, Okta and LDAP (OID) naming schemes.
+var (
+	samlEmailAttributes = []string{
+		"email", "mail", "emailAddress",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress",
+		"urn:oid:0.9.2342.19200300.100.1.3",
+	}
+	samlFirstNameAttributes = []string{
+		"firstName", "givenName", "given_name",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/givenname",
+		"urn:oid:2.5.4.42",
+	}
+	samlLastNameAttributes = []string{
+		"lastName", "sn", "surname", "family_name",
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/surname",
+		"urn:oid:2.5.4.4",
+	}
+	samlRoleAttributes = []string{
+		"role", "roles", "groups", "memberOf",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/role",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups",
+	}
+)
+
+type SAMLService interface {
+	GetConnection(ctx context.Context, tenantID uuid.UUID) (*models.SAMLConnection, error)
+	ConfigureConnection(ctx context.Context, tenantID uuid.UUID, req *models.SAMLConnectionRequest) (*models.SAMLConnection, error)
+	DeleteConnection(ctx context.Context, tenantID uuid.UUID) error
+	Metadata(ctx context.Context, tenantID uuid.UUID) ([]byte, error)
+	AuthorizationURL(ctx context.Context, tenantID uuid.UUID, redirectURI string) (string, error)
+	HandleACS(ctx context.Context, tenantID uuid.UUID, samlResponse, relayState string) (*SSOLoginResult, error)
+}
+
+type samlService struct {
+	userRepo     repositories.UserRepository
+	tenantRepo   repositories.TenantRepository
+	samlRepo     repositories.SAMLRepository
+	identityRepo repositories.IdentityRepository
+	authService  AuthService
+	tenantClient TenantClient
+	config       *config.Config
+}
+
+func NewSAMLService(
+	userRepo repositories.UserRepository,
+	tenantRepo repositories.TenantRepository,
+	samlRepo repositories.SAMLRepository,
+	identityRepo repositories.IdentityRepository,
+	authService AuthService,
+	tenantClient TenantClient,
+	config *config.Config,
+) SAMLService {
+	return &samlService{
+		userRepo:     userRepo,
+		tenantRepo:   tenantRepo,
+		samlRepo:     samlRepo,
+		identityRepo: identityRepo,
+		authService:  authService,
+		tenantClient: tenantClient,
+		config:       config,
+	}
+}
+
+func (s *samlService) GetConnection(ctx context.Context, tenantID uuid.UUID) (*models.SAMLConnection, error) {
+	return s.samlRepo.GetConnection(ctx, tenantID)
+}
+
+// ConfigureConnection stores the IdP metadata and login settings for an enterprise tenant.
+// The service provider key pair is generated once and kept across updates.
+func (s *samlService) ConfigureConnection(ctx context.Context, tenantID uuid.UUID, req *models.SAMLConnectionRequest) (*models.SAMLConnection, error) {
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("tenant not found")
+	}
+
+	if tenant.PlanType != models.PlanEnterprise {
+		return nil, fmt.Errorf("SAML single sign-on requires the enterprise plan")
+	}
+
+	idpMetadata, err := parseIdPMetadata([]byte(req.IdPMetadata))
+	if err != nil {
+		return nil, err
+	}
+
+	defaultRole := req.DefaultRole
+	if defaultRole == "" {
+		defaultRole = models.RoleUser
+	}
+	if !isSSOAssignableRole(defaultRole) {
+		return nil, fmt.Errorf("invalid default role %s", defaultRole)
+	}
+
+	for value, role := range req.RoleMapping {
+		if !isSSOAssignableRole(role) {
+			return nil, fmt.Errorf("invalid role %s mapped from %s", role, value)
+		}
+	}
+
+	connection, err := s.samlRepo.GetConnection(ctx, tenantID)
+	if err != nil {
+		keyPEM, certPEM, err := generateSPKeyPair(tenantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate service provider certificate: %w", err)
+		}
+
+		connection = &models.SAMLConnection{
+			TenantID:      tenantID,
+			SPPrivateKey:  keyPEM,
+			SPCertificate: certPEM,
+		}
+	}
+
+	connection.IdPEntityID = idpMetadata.EntityID
+	connection.IdPMetadata = req.IdPMetadata
+	connection.AttributeMapping = req.AttributeMapping
+	connection.RoleMapping = req.RoleMapping
+	connection.DefaultRole = defaultRole
+	connection.JITProvisioning = req.JITProvisioning
+	connection.SSOOnly = req.SSOOnly
+	connection.AllowIDPInitiated = req.AllowIDPInitiated
+	connection.AllowedRedirectURIs = req.AllowedRedirectURIs
+	connection.Enabled = req.Enabled == nil || *req.Enabled
+
+	if connection.RoleMapping == nil {
+		connection.RoleMapping = map[string]string{}
+	}
+	if connection.AllowedRedirectURIs == nil {
+		connection.AllowedRedirectURIs = []string{}
+	}
+
+	err = s.samlRepo.SaveConnection(ctx, connection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save SAML connection: %w", err)
+	}
+
+	return connection, nil
+}
+
+func (s *samlService) DeleteConnection(ctx context.Context, tenantID uuid.UUID) error {
+	return s.samlRepo.DeleteConnection(ctx, tenantID)
+}
+
+// Metadata returns the tenant's service provider metadata for registration with the IdP
+func (s *samlService) Metadata(ctx context.Context, tenantID uuid.UUID) ([]byte, error) {
+	connection, err := s.samlRepo.GetConnection(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := s.serviceProvider(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+
+	return append([]byte(xml.Header), metadata...), nil
+}
+
+// AuthorizationURL starts an SP-initiated login and returns the IdP URL to redirect to
+func (s *samlService) AuthorizationURL(ctx context.Context, tenantID uuid.UUID, redirectURI string) (string, error) {
+	connection, err := s.getEnabledConnection(ctx, tenantID)
+	if err != nil {
+		return "", err
+	}
+
+	if redirectURI != "" && !containsString(connection.AllowedRedirectURIs, redirectURI, stringsEqual) {
+		return "", fmt.Errorf("redirect URI is not allowed for this tenant")
+	}
+
+	sp, err := s.serviceProvider(connection)
+	if err != nil {
+		return "", err
+	}
+
+	authnRequest, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", fmt.Errorf("failed to create authentication request: %w", err)
+	}
+
+	relayState, err := generateSecureToken(32)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate relay state: %w", err)
+	}
+
+	request := &models.SAMLAuthRequest{
+		RequestID:  authnRequest.ID,
+		RelayState: relayState,
+		TenantID:   tenantID,
+		ExpiresAt:  time.Now().Add(samlRequestTTL),
+	}
+	if redirectURI != "" {
+		request.RedirectURI = &redirectURI
+	}
+
+	err = s.samlRepo.CreateAuthRequest(ctx, request)
+	if err != nil {
+		return "", fmt.Errorf("failed to store authentication request: %w", err)
+	}
+
+	redirectURL, err := authnRequest.Redirect(relayState, sp)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode authentication request: %w", err)
+	}
+
+	return redirectURL.String(), nil
+}
+
+// HandleACS validates a signed SAML response posted to the assertion consumer service
+// and resolves (or provisions) the local user
+func (s *samlService) HandleACS(ctx context.Context, tenantID uuid.UUID, samlResponse, relayState string) (*SSOLoginResult, error) {
+	connection, err := s.getEnabledConnection(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	sp, err := s.serviceProvider(connection)
+	if err != nil {
+		return nil, err
+	}
+
+	// SP-initiated responses must answer a request we issued; anything else is IdP-initiated
+	var possibleRequestIDs []string
+	var redirectURI *string
+	if relayState != "" {
+		request, err := s.samlRepo.ConsumeAuthRequest(ctx, tenantID, relayState)
+		if err == nil {
+			if request.ExpiresAt.Before(time.Now()) {
+				return nil, fmt.Errorf("authentication request has expired")
+			}
+			possibleRequestIDs = []string{request.RequestID}
+			redirectURI = request.RedirectURI
+		}
+	}
+
+	if len(possibleRequestIDs) == 0 {
+		if !connection.AllowIDPInitiated {
+			return nil, fmt.Errorf("unsolicited SAML response")
+		}
+		sp.AllowIDPInitiated = true
+	}
+
+	rawResponse, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML response encoding")
+	}
+
+	assertion, err := sp.ParseXMLResponse(rawResponse, possibleRequestIDs)
+	if err != nil {
+		var invalidResponse *saml.InvalidResponseError
+		if errors.As(err, &invalidResponse) {
+			return nil, fmt.Errorf("invalid SAML response: %w", invalidResponse.PrivateErr)
+		}
+		return nil, fmt.Errorf("invalid SAML response: %w", err)
+	}
+
+	// A response is only accepted once, IdP-initiated ones included
+	if err := s.samlRepo.ConsumeAssertion(ctx, tenantID, assertion.ID, assertionExpiry(assertion)); err != nil {
+		return nil, err
+	}
+
+	identity, role, err := mapSAMLAssertion(assertion, connection)
+	if err != nil {
+		return nil, err
+	}
+	identity.TenantID = tenantID
+
+	defaultRole := connection.DefaultRole
+	if role != "" {
+		defaultRole = role
+	}
+
+	user, provisioned, err := resolveSSOUser(ctx, s.userRepo, s.identityRepo, s.tenantClient, identity, connection.JITProvisioning, defaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep profile and role in sync with the IdP on every login
+	if !provisioned {
+		changed := false
+		if identity.FirstName != "" && identity.FirstName != user.FirstName {
+			user.FirstName = identity.FirstName
+			changed = true
+		}
+		if identity.LastName != "" && identity.LastName != user.LastName {
+			user.LastName = identity.LastName
+			changed = true
+		}
+		if role != "" && role != user.Role && isSSOAssignableRole(user.Role) {
+			user.Role = role
+			changed = true
+		}
+
+		if changed {
+			err = s.userRepo.Update(ctx, user)
+			if err != nil {
+				return nil, fmt.Errorf("failed to update user from SAML attributes: %w", err)
+			}
+		}
+	}
+
+	tokens, err := s.authService.IssueSSOTokens(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSOLoginResult{
+		Tokens:      tokens,
+		RedirectURI: redirectURI,
+		Provisioned: provisioned,
+	}, nil
+}
+
+func (s *samlService) getEnabledConnection(ctx context.Context, tenantID uuid.UUID) (*models.SAMLConnection, error) {
+	connection, err := s.samlRepo.GetConnection(ctx, tenantID)
+	if err != nil || !connection.Enabled {
+		return nil, fmt.Errorf("SAML single sign-on is not configured for this tenant")
+	}
+	return connection, nil
+}
+
+// serviceProvider builds the tenant's SAML service provider from its stored connection
+func (s *samlService) serviceProvider(connection *models.SAMLConnection) (*saml.ServiceProvider, error) {
+	keyBlock, _ := pem.Decode([]byte(connection.SPPrivateKey))
+	if keyBlock == nil {
+		return nil, fmt.Errorf("invalid service provider key")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service provider key: %w", err)
+	}
+
+	certBlock, _ := pem.Decode([]byte(connection.SPCertificate))
+	if certBlock == nil {
+		return nil, fmt.Errorf("invalid service provider certificate")
+	}
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service provider certificate: %w", err)
+	}
+
+	idpMetadata, err := parseIdPMetadata([]byte(connection.IdPMetadata))
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := strings.TrimSuffix(s.config.SAMLBaseURL, "/") + "/" + connection.TenantID.String()
+	metadataURL, err := url.Parse(baseURL + "/metadata")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML base URL: %w", err)
+	}
+	acsURL, err := url.Parse(baseURL + "/acs")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML base URL: %w", err)
+	}
+
+	return &saml.ServiceProvider{
+		EntityID:          metadataURL.String(),
+		Key:               key,
+		Certificate:       certificate,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		IDPMetadata:       idpMetadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		SignatureMethod:   dsig.RSASHA256SignatureMethod,
+	}, nil
+}
+
+// assertionExpiry returns the last moment the service provider would still
+// accept the assertion, so its ID only needs remembering until then
+func assertionExpiry(assertion *saml.Assertion) time.Time {
+	expiresAt := assertion.IssueInstant.Add(saml.MaxIssueDelay)
+	if assertion.Conditions != nil && assertion.Conditions.NotOnOrAfter.After(expiresAt) {
+		expiresAt = assertion.Conditions.NotOnOrAfter
+	}
+	if assertion.Subject != nil {
+		for _, confirmation := range assertion.Subject.SubjectConfirmations {
+			if data := confirmation.SubjectConfirmationData; data != nil && data.NotOnOrAfter.After(expiresAt) {
+				expiresAt = data.NotOnOrAfter
+			}
+		}
+	}
+	return expiresAt.Add(saml.MaxClockSkew)
+}
+
+// mapSAMLAssertion extracts the user's identity and mapped role from a validated assertion
+func mapSAMLAssertion(assertion *saml.Assertion, connection *models.SAMLConnection) (*ssoIdentity, string, error) {
+	mapping := connection.AttributeMapping
+	email := normalizeEmail(samlAttributeValue(assertion, mapping.Email, samlEmailAttributes))
+
+	var nameID *saml.NameID
+	if assertion.Subject != nil {
+		nameID = assertion.Subject.NameID
+	}
+
+	if email == "" && nameID != nil && strings.Contains(nameID.Value, "@") {
+		email = normalizeEmail(nameID.Value)
+	}
+	if email == "" {
+		return nil, "", fmt.Errorf("SAML assertion does not contain an email address")
+	}
+	if !isValidSSOEmail(email) {
+		return nil, "", fmt.Errorf("SAML assertion contains an invalid email address %q", email)
+	}
+
+	// Transient name IDs change on every login, fall back to the email address
+	subject := email
+	if nameID != nil && nameID.Value != "" && nameID.Format != string(saml.TransientNameIDFormat) {
+		subject = nameID.Value
+	}
+
+	identity := &ssoIdentity{
+		Provider:  models.SAMLProvider,
+		Subject:   subject,
+		Email:     email,
+		FirstName: samlAttributeValue(assertion, mapping.FirstName, samlFirstNameAttributes),
+		LastName:  samlAttributeValue(assertion, mapping.LastName, samlLastNameAttributes),
+	}
+
+	// The most privileged mapped role wins when the user matches several values
+	role := ""
+	for _, value := range samlAttributeValues(assertion, mapping.Role, samlRoleAttributes) {
+		mapped, ok := connection.RoleMapping[value]
+		if ok && roleRank(mapped) > roleRank(role) {
+			role = mapped
+		}
+	}
+
+	return identity, role, nil
+}
+
+func samlAttributeValue(assertion *saml.Assertion, mapped string, defaults []string) string {
+	values := samlAttributeValues(assertion, mapped, defaults)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
+
+// samlAttributeValues returns the values of the mapped attribute, or of the first default
+// attribute present. Attributes match on either Name or FriendlyName.
+func samlAttributeValues(assertion *saml.Assertion, mapped string, defaults []string) []string {
+	names := defaults
+	if mapped != "" {
+		names = []string{mapped}
+	}
+
+	for _, name := range names {
+		for _, statement := range assertion.AttributeStatements {
+			for _, attribute := range statement.Attributes {
+				if attribute.Name != name && attribute.FriendlyName != name {
+					continue
+				}
+
+				values := make([]string, 0, len(attribute.Values))
+				for _, value := range attribute.Values {
+					values = append(values, value.Value)
+				}
+				return values
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseIdPMetadata parses IdP metadata, which may be an EntityDescriptor or an
+// EntitiesDescriptor wrapping one, and checks it can be used for SP-initiated login
+func parseIdPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	if err := xrv.Validate(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("invalid IdP metadata: %w", err)
+	}
+
+	entity := &saml.EntityDescriptor{}
+	err := xml.Unmarshal(data, entity)
+	if err != nil {
+		entities := &saml.EntitiesDescriptor{}
+		if xml.Unmarshal(data, entities) != nil {
+			return nil, fmt.Errorf("invalid IdP metadata: %w", err)
+		}
+
+		entity = nil
+		for i, e := range entities.EntityDescriptors {
+			if len(e.IDPSSODescriptors) > 0 {
+				entity = &entities.EntityDescriptors[i]
+				break
+			}
+		}
+	}
+
+	if entity == nil || len(entity.IDPSSODescriptors) == 0 {
+		return nil, fmt.Errorf("IdP metadata does not describe an identity provider")
+	}
+
+	hasRedirectBinding := false
+	hasSigningCertificate := false
+	for _, descriptor := range entity.IDPSSODescriptors {
+		for _, endpoint := range descriptor.SingleSignOnServices {
+			if endpoint.Binding == saml.HTTPRedirectBinding {
+				hasRedirectBinding = true
+			}
+		}
+		for _, keyDescriptor := range descriptor.KeyDescriptors {
+			if (keyDescriptor.Use == "" || keyDescriptor.Use == "signing") && len(keyDescriptor.KeyInfo.X509Data.X509Certificates) > 0 {
+				hasSigningCertificate = true
+			}
+		}
+	}
+
+	if !hasRedirectBinding {
+		return nil, fmt.Errorf("IdP metadata has no HTTP-Redirect single sign-on endpoint")
+	}
+	if !hasSigningCertificate {
+		return nil, fmt.Errorf("IdP metadata has no signing certificate")
+	}
+
+	return entity, nil
+}
+
+// generateSPKeyPair creates the tenant's service provider key and self-signed certificate
+func generateSPKeyPair(tenantID uuid.UUID) (string, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName:   "zplus-saas SAML SP " + tenantID.String(),
+			Organization: []string{"Zplus SaaS"},
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(samlCertificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+
+	return string(keyPEM), string(certPEM), nil
+}
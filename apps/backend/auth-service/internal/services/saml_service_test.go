@@ -0,0 +1,508 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testIdP is a local SAML identity provider fixture. It answers authentication
+// requests with a signed (and, when the SP asks for it, encrypted) assertion for
+// a fixed session.
+type testIdP struct {
+	idp        *saml.IdentityProvider
+	session    *saml.Session
+	spMetadata *saml.EntityDescriptor
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	keyPEM, certPEM, err := generateSPKeyPair(uuid.New())
+	require.NoError(t, err)
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	require.NoError(t, err)
+
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	require.NoError(t, err)
+
+	p := &testIdP{
+		session: &saml.Session{
+			ID:            "session-1",
+			NameID:        "jane.doe",
+			NameIDFormat:  string(saml.PersistentNameIDFormat),
+			UserGivenName: "Jane",
+			UserSurname:   "Doe",
+			Groups:        []string{"engineering", "zplus-admins"},
+			CustomAttributes: []saml.Attribute{{
+				Name:   "email",
+				Values: []saml.AttributeValue{{Type: "xs:string", Value: "Jane@Acme.test"}},
+			}},
+		},
+	}
+
+	p.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             certificate,
+		Logger:                  log.New(io.Discard, "", 0),
+		MetadataURL:             url.URL{Scheme: "https", Host: "idp.test", Path: "/metadata"},
+		SSOURL:                  url.URL{Scheme: "https", Host: "idp.test", Path: "/sso"},
+		ServiceProviderProvider: p,
+		SessionProvider:         p,
+	}
+
+	return p
+}
+
+func (p *testIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if p.spMetadata == nil || p.spMetadata.EntityID != serviceProviderID {
+		return nil, fmt.Errorf("unknown service provider %s", serviceProviderID)
+	}
+	return p.spMetadata, nil
+}
+
+func (p *testIdP) GetSession(w http.ResponseWriter, r *http.Request, req *saml.IdpAuthnRequest) *saml.Session {
+	return p.session
+}
+
+func (p *testIdP) metadata(t *testing.T) string {
+	metadata, err := xml.Marshal(p.idp.Metadata())
+	require.NoError(t, err)
+	return string(metadata)
+}
+
+// register loads the tenant's SP metadata, as an IdP admin would
+func (p *testIdP) register(t *testing.T, svc SAMLService, tenantID uuid.UUID) {
+	metadata, err := svc.Metadata(context.Background(), tenantID)
+	require.NoError(t, err)
+
+	p.spMetadata = &saml.EntityDescriptor{}
+	require.NoError(t, xml.Unmarshal(metadata, p.spMetadata))
+}
+
+// respond follows the SP redirect and returns the SAMLResponse and RelayState the IdP posts back
+func (p *testIdP) respond(t *testing.T, authURL string) (string, string) {
+	req, err := saml.NewIdpAuthnRequest(p.idp, httptest.NewRequest(http.MethodGet, authURL, nil))
+	require.NoError(t, err)
+	require.NoError(t, req.Validate())
+	require.NoError(t, saml.DefaultAssertionMaker{}.MakeAssertion(req, p.session))
+
+	form, err := req.PostBinding()
+	require.NoError(t, err)
+	return form.SAMLResponse, form.RelayState
+}
+
+func newTestSAMLService(t *testing.T, planType string) (SAMLService, AuthService, *fakeUserRepository, *fakeSAMLRepository, uuid.UUID) {
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+		JWTIssuer:           "zplus-saas",
+		JWTAudience:         "zplus-users",
+		SAMLBaseURL:         "http://localhost:8080/api/v1/auth/saml",
+	}
+
+	tenantID := uuid.New()
+	userRepo := newFakeUserRepository()
+	samlRepo := newFakeSAMLRepository()
+	tenantRepo := &fakeTenantRepository{tenants: map[uuid.UUID]*models.Tenant{
+		tenantID: {ID: tenantID, Name: "Acme", PlanType: planType, IsActive: true},
+	}}
+
+	authService := NewAuthService(userRepo, tenantRepo, userRepo, &fakeRefreshTokenRepository{}, samlRepo, newFakeRoleRepository(), newTestPasswordPolicyService(nil), newTestLoginProtectionService(userRepo), NewJWTService(cfg), &fakeTenantClient{}, cfg)
+	svc := NewSAMLService(userRepo, tenantRepo, samlRepo, newFakeIdentityRepository(), authService, &fakeTenantClient{}, cfg)
+
+	return svc, authService, userRepo, samlRepo, tenantID
+}
+
+func TestSAMLLoginProvisionsUserFromAttributes(t *testing.T) {
+	svc, _, userRepo, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+	idp := newTestIdP(t)
+
+	connection, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:         idp.metadata(t),
+		AttributeMapping:    models.SAMLAttributeMapping{Role: "eduPersonAffiliation"},
+		RoleMapping:         map[string]string{"engineering": models.RoleUser, "zplus-admins": models.RoleAdmin},
+		JITProvisioning:     true,
+		AllowedRedirectURIs: []string{"http://localhost:3000/sso"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.test/metadata", connection.IdPEntityID)
+	assert.True(t, connection.Enabled)
+	idp.register(t, svc, tenantID)
+
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "http://localhost:3000/sso")
+	require.NoError(t, err)
+
+	samlResponse, relayState := idp.respond(t, authURL)
+	result, err := svc.HandleACS(context.Background(), tenantID, samlResponse, relayState)
+	require.NoError(t, err)
+
+	assert.True(t, result.Provisioned)
+	assert.Equal(t, "http://localhost:3000/sso", *result.RedirectURI)
+	assert.Equal(t, "jane@acme.test", result.Tokens.User.Email)
+	assert.Equal(t, "Jane", result.Tokens.User.FirstName)
+	assert.Equal(t, "Doe", result.Tokens.User.LastName)
+	assert.Equal(t, models.RoleAdmin, result.Tokens.User.Role)
+
+	// Requests are single use
+	_, err = svc.HandleACS(context.Background(), tenantID, samlResponse, relayState)
+	assert.ErrorContains(t, err, "unsolicited")
+
+	// The next login resolves the linked identity and syncs the role from the IdP
+	idp.session.Groups = []string{"engineering"}
+	authURL, err = svc.AuthorizationURL(context.Background(), tenantID, "")
+	require.NoError(t, err)
+
+	samlResponse, relayState = idp.respond(t, authURL)
+	result, err = svc.HandleACS(context.Background(), tenantID, samlResponse, relayState)
+	require.NoError(t, err)
+	assert.False(t, result.Provisioned)
+	assert.Nil(t, result.RedirectURI)
+	assert.Equal(t, models.RoleUser, result.Tokens.User.Role)
+	assert.Len(t, userRepo.users, 1)
+}
+
+func TestSAMLRejectsAssertionFromUntrustedIdP(t *testing.T) {
+	svc, _, _, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+	idp := newTestIdP(t)
+
+	_, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:     idp.metadata(t),
+		JITProvisioning: true,
+	})
+	require.NoError(t, err)
+	idp.register(t, svc, tenantID)
+
+	// Same entity ID and endpoints, different signing key
+	impostor := newTestIdP(t)
+	impostor.spMetadata = idp.spMetadata
+
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "")
+	require.NoError(t, err)
+
+	samlResponse, relayState := impostor.respond(t, authURL)
+	_, err = svc.HandleACS(context.Background(), tenantID, samlResponse, relayState)
+	assert.Error(t, err)
+}
+
+func TestSAMLRejectsUnsolicitedResponseUnlessIdPInitiatedAllowed(t *testing.T) {
+	svc, _, _, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+	idp := newTestIdP(t)
+
+	_, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:     idp.metadata(t),
+		JITProvisioning: true,
+	})
+	require.NoError(t, err)
+	idp.register(t, svc, tenantID)
+
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "")
+	require.NoError(t, err)
+
+	samlResponse, _ := idp.respond(t, authURL)
+	_, err = svc.HandleACS(context.Background(), tenantID, samlResponse, "")
+	assert.ErrorContains(t, err, "unsolicited")
+
+	_, err = svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:       idp.metadata(t),
+		JITProvisioning:   true,
+		AllowIDPInitiated: true,
+	})
+	require.NoError(t, err)
+
+	result, err := svc.HandleACS(context.Background(), tenantID, samlResponse, "")
+	require.NoError(t, err)
+	assert.True(t, result.Provisioned)
+}
+
+func TestSAMLRejectsReplayedIdPInitiatedResponse(t *testing.T) {
+	svc, _, _, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+	idp := newTestIdP(t)
+
+	_, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:       idp.metadata(t),
+		JITProvisioning:   true,
+		AllowIDPInitiated: true,
+	})
+	require.NoError(t, err)
+	idp.register(t, svc, tenantID)
+
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "")
+	require.NoError(t, err)
+	samlResponse, _ := idp.respond(t, authURL)
+
+	_, err = svc.HandleACS(context.Background(), tenantID, samlResponse, "")
+	require.NoError(t, err)
+
+	_, err = svc.HandleACS(context.Background(), tenantID, samlResponse, "")
+	assert.ErrorContains(t, err, "already been used")
+}
+
+func TestSAMLSessionCannotSwitchTenant(t *testing.T) {
+	svc, authService, userRepo, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+	idp := newTestIdP(t)
+	jwtService := NewJWTService(&config.Config{JWTSecret: "test-secret", JWTIssuer: "zplus-saas", JWTAudience: "zplus-users"})
+
+	_, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:     idp.metadata(t),
+		JITProvisioning: true,
+	})
+	require.NoError(t, err)
+	idp.register(t, svc, tenantID)
+
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "")
+	require.NoError(t, err)
+	samlResponse, relayState := idp.respond(t, authURL)
+	result, err := svc.HandleACS(context.Background(), tenantID, samlResponse, relayState)
+	require.NoError(t, err)
+
+	// The user also belongs to another tenant the IdP does not speak for
+	other := uuid.New()
+	user := result.Tokens.User
+	require.NoError(t, userRepo.AddMembership(context.Background(), &models.TenantMembership{UserID: user.ID, TenantID: other, Role: models.RoleAdmin}))
+
+	sessionTenant := func(tokens *models.TokenResponse) string {
+		token, err := jwtService.ValidateToken(tokens.AccessToken)
+		require.NoError(t, err)
+		claims, err := jwtService.ParseUserClaims(token)
+		require.NoError(t, err)
+		return claims.SSOTenantID
+	}
+	assert.Equal(t, tenantID.String(), sessionTenant(result.Tokens))
+
+	_, err = authService.SwitchTenant(context.Background(), user.ID, &models.SwitchTenantRequest{TenantID: other.String(), SSOTenantID: sessionTenant(result.Tokens)})
+	assert.ErrorIs(t, err, ErrSSOSessionSwitch)
+
+	// Refreshing keeps the session marked
+	tokens, err := authService.RefreshToken(context.Background(), result.Tokens.RefreshToken, "")
+	require.NoError(t, err)
+	assert.Equal(t, tenantID.String(), sessionTenant(tokens))
+}
+
+func TestSAMLRequiresEnterprisePlan(t *testing.T) {
+	svc, _, _, _, tenantID := newTestSAMLService(t, models.PlanProfessional)
+	idp := newTestIdP(t)
+
+	_, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata: idp.metadata(t),
+	})
+	assert.ErrorContains(t, err, "enterprise plan")
+}
+
+func TestSAMLRejectsInvalidIdPMetadata(t *testing.T) {
+	svc, _, _, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+
+	_, err := svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata: `<EntityDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata" entityID="https://idp.test"></EntityDescriptor>`,
+	})
+	assert.ErrorContains(t, err, "does not describe an identity provider")
+}
+
+func TestSSOOnlyDisablesPasswordLogin(t *testing.T) {
+	svc, authService, userRepo, _, tenantID := newTestSAMLService(t, models.PlanEnterprise)
+	idp := newTestIdP(t)
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.Create(context.Background(), &models.User{
+		TenantID: tenantID,
+		Email:    "bob@acme.test",
+		Password: string(hashed),
+		Role:     models.RoleUser,
+	}))
+
+	login := &models.LoginRequest{Email: "bob@acme.test", Password: "password123"}
+
+	_, err = svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata: idp.metadata(t),
+	})
+	require.NoError(t, err)
+
+	passwordSession, err := authService.Login(context.Background(), login)
+	require.NoError(t, err)
+
+	_, err = svc.ConfigureConnection(context.Background(), tenantID, &models.SAMLConnectionRequest{
+		IdPMetadata:     idp.metadata(t),
+		SSOOnly:         true,
+		JITProvisioning: true,
+	})
+	require.NoError(t, err)
+	idp.register(t, svc, tenantID)
+
+	_, err = authService.Login(context.Background(), login)
+	assert.ErrorContains(t, err, "password login is disabled")
+
+	// Password sessions end at their next refresh; SSO sessions carry on
+	_, err = authService.RefreshToken(context.Background(), passwordSession.RefreshToken, "")
+	assert.ErrorContains(t, err, "password login is disabled")
+
+	authURL, err := svc.AuthorizationURL(context.Background(), tenantID, "")
+	require.NoError(t, err)
+	samlResponse, relayState := idp.respond(t, authURL)
+	result, err := svc.HandleACS(context.Background(), tenantID, samlResponse, relayState)
+	require.NoError(t, err)
+	_, err = authService.RefreshToken(context.Background(), result.Tokens.RefreshToken, "")
+	assert.NoError(t, err)
+}
+
+// In-memory repositories
+
+type fakeTenantRepository struct {
+	tenants map[uuid.UUID]*models.Tenant
+}
+
+func (r *fakeTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	tenant.ID = uuid.New()
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
+
+func (r *fakeTenantRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Tenant, error) {
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("tenant not found")
+	}
+	return tenant, nil
+}
+
+func (r *fakeTenantRepository) GetBySubdomain(ctx context.Context, subdomain string) (*models.Tenant, error) {
+	return nil, fmt.Errorf("tenant not found")
+}
+
+func (r *fakeTenantRepository) GetByDomain(ctx context.Context, domain string) (*models.Tenant, error) {
+	return nil, fmt.Errorf("tenant not found")
+}
+
+func (r *fakeTenantRepository) Update(ctx context.Context, tenant *models.Tenant) error {
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
+
+func (r *fakeTenantRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(r.tenants, id)
+	return nil
+}
+
+type fakeSAMLRepository struct {
+	connections map[uuid.UUID]*models.SAMLConnection
+	requests    map[string]*models.SAMLAuthRequest
+	assertions  map[string]time.Time
+}
+
+func newFakeSAMLRepository() *fakeSAMLRepository {
+	return &fakeSAMLRepository{
+		connections: make(map[uuid.UUID]*models.SAMLConnection),
+		requests:    make(map[string]*models.SAMLAuthRequest),
+		assertions:  make(map[string]time.Time),
+	}
+}
+
+func (r *fakeSAMLRepository) GetConnection(ctx context.Context, tenantID uuid.UUID) (*models.SAMLConnection, error) {
+	connection, ok := r.connections[tenantID]
+	if !ok {
+		return nil, fmt.Errorf("SAML connection not found")
+	}
+	copied := *connection
+	return &copied, nil
+}
+
+func (r *fakeSAMLRepository) SaveConnection(ctx context.Context, connection *models.SAMLConnection) error {
+	if connection.ID == uuid.Nil {
+		connection.ID = uuid.New()
+	}
+	copied := *connection
+	r.connections[connection.TenantID] = &copied
+	return nil
+}
+
+func (r *fakeSAMLRepository) DeleteConnection(ctx context.Context, tenantID uuid.UUID) error {
+	delete(r.connections, tenantID)
+	return nil
+}
+
+func (r *fakeSAMLRepository) CreateAuthRequest(ctx context.Context, request *models.SAMLAuthRequest) error {
+	request.ID = uuid.New()
+	r.requests[request.TenantID.String()+request.RelayState] = request
+	return nil
+}
+
+func (r *fakeSAMLRepository) ConsumeAuthRequest(ctx context.Context, tenantID uuid.UUID, relayState string) (*models.SAMLAuthRequest, error) {
+	request, ok := r.requests[tenantID.String()+relayState]
+	if !ok {
+		return nil, fmt.Errorf("authentication request not found")
+	}
+	delete(r.requests, tenantID.String()+relayState)
+	return request, nil
+}
+
+func (r *fakeSAMLRepository) ConsumeAssertion(ctx context.Context, tenantID uuid.UUID, assertionID string, expiresAt time.Time) error {
+	key := tenantID.String() + assertionID
+	if seen, ok := r.assertions[key]; ok && seen.After(time.Now()) {
+		return fmt.Errorf("SAML assertion has already been used")
+	}
+	r.assertions[key] = expiresAt
+	return nil
+}
+
+func (r *fakeSAMLRepository) DeleteExpiredAuthRequests(ctx context.Context) error {
+	return nil
+}
+
+func TestSSORejectsInvalidEmailFromIdP(t *testing.T) {
+	userRepo := newFakeUserRepository()
+	identity := &ssoIdentity{TenantID: uuid.New(), Provider: models.SAMLProvider, Subject: "jane", Email: "jane"}
+
+	_, _, err := resolveSSOUser(context.Background(), userRepo, newFakeIdentityRepository(), &fakeTenantClient{}, identity, true, models.RoleUser)
+	assert.ErrorContains(t, err, "invalid email address")
+	assert.Empty(t, userRepo.users)
+
+	connection := &models.SAMLConnection{}
+	assertion := &saml.Assertion{AttributeStatements: []saml.AttributeStatement{{Attributes: []saml.Attribute{
+		{Name: "email", Values: []saml.AttributeValue{{Value: "Jane Doe <jane@acme.test>"}}},
+	}}}}
+	_, _, err = mapSAMLAssertion(assertion, connection)
+	assert.ErrorContains(t, err, "invalid email address")
+
+	// Provisioned users without a first name are named after their address
+	identity.Email = "jane@acme.test"
+	user, provisioned, err := resolveSSOUser(context.Background(), userRepo, newFakeIdentityRepository(), &fakeTenantClient{}, identity, true, models.RoleUser)
+	require.NoError(t, err)
+	assert.True(t, provisioned)
+	assert.Equal(t, "jane", user.FirstName)
+
+	// The same address from another tenant's IdP is not provisioned twice
+	other := &ssoIdentity{TenantID: uuid.New(), Provider: models.SAMLProvider, Subject: "jane", Email: "jane@acme.test"}
+	_, _, err = resolveSSOUser(context.Background(), userRepo, newFakeIdentityRepository(), &fakeTenantClient{}, other, true, models.RoleUser)
+	assert.ErrorContains(t, err, "already has an account in another organization")
+	assert.Len(t, userRepo.users, 1)
+}
+
+func TestSSOProvisioningNeedsASeat(t *testing.T) {
+	userRepo := newFakeUserRepository()
+	tenants := &fakeTenantClient{quota: &models.QuotaCheck{Resource: models.QuotaResourceUsers, Used: 3}}
+	identity := &ssoIdentity{TenantID: uuid.New(), Provider: models.SAMLProvider, Subject: "jane", Email: "jane@acme.test"}
+
+	_, _, err := resolveSSOUser(context.Background(), userRepo, newFakeIdentityRepository(), tenants, identity, true, models.RoleUser)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Empty(t, userRepo.users)
+}
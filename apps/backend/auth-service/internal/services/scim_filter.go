@@ -0,0 +1,341 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// scimColumnKind is the SQL type behind a filterable SCIM attribute
+type scimColumnKind int
+
+const (
+	scimString scimColumnKind = iota
+	scimBool
+	scimTime
+)
+
+// scimColumn maps a SCIM attribute path onto a SQL expression
+type scimColumn struct {
+	expr string
+	kind scimColumnKind
+}
+
+var (
+	// scimUserColumns are the filterable User attributes, keyed by lowercased path
+	scimUserColumns = map[string]scimColumn{
+		"id":                {"u.id::text", scimString},
+		"username":          {"u.email", scimString},
+		"emails":            {"u.email", scimString},
+		"emails.value":      {"u.email", scimString},
+		"externalid":        {"i.subject", scimString},
+		"name.givenname":    {"u.first_name", scimString},
+		"name.familyname":   {"u.last_name", scimString},
+		"active":            {"(u.is_active AND m.is_active)", scimBool},
+		"meta.created":      {"u.created_at", scimTime},
+		"meta.lastmodified": {"u.updated_at", scimTime},
+	}
+
+	// scimGroupColumns are the filterable Group attributes, keyed by lowercased path
+	scimGroupColumns = map[string]scimColumn{
+		"id":                {"g.id::text", scimString},
+		"displayname":       {"g.display_name", scimString},
+		"externalid":        {"g.external_id", scimString},
+		"meta.created":      {"g.created_at", scimTime},
+		"meta.lastmodified": {"g.updated_at", scimTime},
+	}
+
+	// scimValuePathFilter matches a value filter such as emails[type eq "work"]
+	scimValuePathFilter = regexp.MustCompile(`\[[^\]]*\]`)
+)
+
+type scimFilterTokenKind int
+
+const (
+	scimTokenWord scimFilterTokenKind = iota
+	scimTokenString
+	scimTokenOpenParen
+	scimTokenCloseParen
+)
+
+type scimFilterToken struct {
+	kind  scimFilterTokenKind
+	value string
+}
+
+// parseSCIMFilter translates a SCIM filter (RFC 7644 section 3.4.2.2) into a SQL
+// condition. Placeholders are numbered after argOffset.
+func parseSCIMFilter(filter string, columns map[string]scimColumn, argOffset int) (string, []interface{}, error) {
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &scimFilterParser{tokens: tokens, columns: columns, argOffset: argOffset}
+	condition, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return "", nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos].value)
+	}
+
+	return condition, p.args, nil
+}
+
+func tokenizeSCIMFilter(filter string) ([]scimFilterToken, error) {
+	var tokens []scimFilterToken
+
+	for i := 0; i < len(filter); {
+		switch c := filter[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, scimFilterToken{kind: scimTokenOpenParen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, scimFilterToken{kind: scimTokenCloseParen, value: ")"})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(filter) && filter[end] != '"' {
+				if filter[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(filter) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+
+			var value string
+			if err := json.Unmarshal([]byte(filter[i:end+1]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string in filter: %w", err)
+			}
+			tokens = append(tokens, scimFilterToken{kind: scimTokenString, value: value})
+			i = end + 1
+		default:
+			// Attribute paths may contain a bracketed value filter with spaces
+			start := i
+			depth := 0
+			for i < len(filter) {
+				c := filter[i]
+				if c == '[' {
+					depth++
+				} else if c == ']' {
+					depth--
+				} else if depth == 0 && (c == ' ' || c == '(' || c == ')') {
+					break
+				}
+				i++
+			}
+			tokens = append(tokens, scimFilterToken{kind: scimTokenWord, value: filter[start:i]})
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty filter")
+	}
+
+	return tokens, nil
+}
+
+type scimFilterParser struct {
+	tokens    []scimFilterToken
+	pos       int
+	columns   map[string]scimColumn
+	args      []interface{}
+	argOffset int
+}
+
+func (p *scimFilterParser) peekKeyword(keyword string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == scimTokenWord && strings.EqualFold(p.tokens[p.pos].value, keyword)
+}
+
+func (p *scimFilterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+
+	for p.peekKeyword("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (string, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return "", err
+	}
+
+	for p.peekKeyword("and") {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+
+	return left, nil
+}
+
+func (p *scimFilterParser) parseNot() (string, error) {
+	if p.peekKeyword("not") {
+		p.pos++
+		condition, err := p.parseGroup()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + condition, nil
+	}
+
+	return p.parseAtom()
+}
+
+func (p *scimFilterParser) parseGroup() (string, error) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != scimTokenOpenParen {
+		return "", fmt.Errorf("expected ( in filter")
+	}
+	p.pos++
+
+	condition, err := p.parseOr()
+	if err != nil {
+		return "", err
+	}
+
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != scimTokenCloseParen {
+		return "", fmt.Errorf("expected ) in filter")
+	}
+	p.pos++
+
+	return "(" + condition + ")", nil
+}
+
+// parseAtom parses a parenthesised expression or a single "attrPath op [value]" comparison
+func (p *scimFilterParser) parseAtom() (string, error) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == scimTokenOpenParen {
+		return p.parseGroup()
+	}
+
+	if p.pos+1 >= len(p.tokens) || p.tokens[p.pos].kind != scimTokenWord || p.tokens[p.pos+1].kind != scimTokenWord {
+		return "", fmt.Errorf("expected attribute and operator in filter")
+	}
+
+	path := p.tokens[p.pos].value
+	column, ok := p.columns[normalizeSCIMPath(path)]
+	if !ok {
+		return "", fmt.Errorf("filtering on %s is not supported", path)
+	}
+
+	op := strings.ToLower(p.tokens[p.pos+1].value)
+	p.pos += 2
+
+	if op == "pr" {
+		if column.kind == scimString {
+			return "(" + column.expr + " IS NOT NULL AND " + column.expr + " <> '')", nil
+		}
+		return column.expr + " IS NOT NULL", nil
+	}
+
+	if p.pos >= len(p.tokens) || (p.tokens[p.pos].kind != scimTokenString && p.tokens[p.pos].kind != scimTokenWord) {
+		return "", fmt.Errorf("expected value after %s in filter", op)
+	}
+	value := p.tokens[p.pos]
+	p.pos++
+
+	switch column.kind {
+	case scimBool:
+		b, ok := parseSCIMBool(value.value)
+		if !ok {
+			return "", fmt.Errorf("%s expects a boolean value", path)
+		}
+		switch op {
+		case "eq":
+			return column.expr + " = " + p.arg(b), nil
+		case "ne":
+			return column.expr + " <> " + p.arg(b), nil
+		}
+	case scimTime:
+		t, err := time.Parse(time.RFC3339, value.value)
+		if err != nil {
+			return "", fmt.Errorf("%s expects an RFC 3339 timestamp", path)
+		}
+		if sqlOp, ok := scimComparisonOperators[op]; ok {
+			return column.expr + " " + sqlOp + " " + p.arg(t), nil
+		}
+	case scimString:
+		if value.kind != scimTokenString {
+			return "", fmt.Errorf("%s expects a string value", path)
+		}
+		switch op {
+		case "eq":
+			return "LOWER(" + column.expr + ") = LOWER(" + p.arg(value.value) + ")", nil
+		case "ne":
+			return "(" + column.expr + " IS NULL OR LOWER(" + column.expr + ") <> LOWER(" + p.arg(value.value) + "))", nil
+		case "co":
+			return column.expr + " ILIKE " + p.arg("%"+escapeLike(value.value)+"%"), nil
+		case "sw":
+			return column.expr + " ILIKE " + p.arg(escapeLike(value.value)+"%"), nil
+		case "ew":
+			return column.expr + " ILIKE " + p.arg("%"+escapeLike(value.value)), nil
+		}
+		if sqlOp, ok := scimComparisonOperators[op]; ok {
+			return column.expr + " " + sqlOp + " " + p.arg(value.value), nil
+		}
+	}
+
+	return "", fmt.Errorf("operator %s is not supported for %s", op, path)
+}
+
+var scimComparisonOperators = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+}
+
+func (p *scimFilterParser) arg(value interface{}) string {
+	p.args = append(p.args, value)
+	return fmt.Sprintf("$%d", p.argOffset+len(p.args))
+}
+
+// normalizeSCIMPath lowercases a path and drops value filters and schema prefixes,
+// so emails[type eq "work"].value becomes emails.value
+func normalizeSCIMPath(path string) string {
+	path = scimValuePathFilter.ReplaceAllString(path, "")
+	for _, schema := range []string{"urn:ietf:params:scim:schemas:core:2.0:user:", "urn:ietf:params:scim:schemas:core:2.0:group:"} {
+		if strings.HasPrefix(strings.ToLower(path), schema) {
+			path = path[len(schema):]
+		}
+	}
+	return strings.ToLower(path)
+}
+
+// parseSCIMBool accepts true/false in any case; some clients send booleans as strings
+func parseSCIMBool(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSCIMFilter(t *testing.T) {
+	created, _ := time.Parse(time.RFC3339, "2024-01-01T00:00:00Z")
+
+	tests := []struct {
+		name      string
+		filter    string
+		condition string
+		args      []interface{}
+	}{
+		{
+			name:      "userName eq is case-insensitive",
+			filter:    `userName eq "Jane@Example.com"`,
+			condition: "LOWER(u.email) = LOWER($2)",
+			args:      []interface{}{"Jane@Example.com"},
+		},
+		{
+			name:      "value filter on emails",
+			filter:    `emails[type eq "work"].value eq "jane@example.com"`,
+			condition: "LOWER(u.email) = LOWER($2)",
+			args:      []interface{}{"jane@example.com"},
+		},
+		{
+			name:      "schema prefixed path",
+			filter:    `urn:ietf:params:scim:schemas:core:2.0:User:userName sw "ja"`,
+			condition: "u.email ILIKE $2",
+			args:      []interface{}{"ja%"},
+		},
+		{
+			name:      "like wildcards are escaped",
+			filter:    `name.familyName co "50%_off"`,
+			condition: "u.last_name ILIKE $2",
+			args:      []interface{}{`%50\%\_off%`},
+		},
+		{
+			name:      "and binds tighter than or",
+			filter:    `active eq true or externalId pr and name.givenName ew "ne"`,
+			condition: "((u.is_active AND m.is_active) = $2 OR ((i.subject IS NOT NULL AND i.subject <> '') AND u.first_name ILIKE $3))",
+			args:      []interface{}{true, "%ne"},
+		},
+		{
+			name:      "not and parentheses",
+			filter:    `not (active eq "False") and (meta.created gt "2024-01-01T00:00:00Z")`,
+			condition: "(NOT ((u.is_active AND m.is_active) = $2) AND (u.created_at > $3))",
+			args:      []interface{}{false, created},
+		},
+		{
+			name:      "escaped quotes in values",
+			filter:    `externalId EQ "a\"b"`,
+			condition: "LOWER(i.subject) = LOWER($2)",
+			args:      []interface{}{`a"b`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, args, err := parseSCIMFilter(tt.filter, scimUserColumns, 1)
+			require.NoError(t, err)
+			assert.Equal(t, tt.condition, condition)
+			assert.Equal(t, tt.args, args)
+		})
+	}
+}
+
+func TestParseSCIMFilterRejectsInvalidFilters(t *testing.T) {
+	for _, filter := range []string{
+		`password eq "secret"`,
+		`userName eq`,
+		`userName eq "unterminated`,
+		`(userName eq "a"`,
+		`userName eq "a" userName eq "b"`,
+		`active eq "maybe"`,
+		`active co "true"`,
+		`meta.created gt "yesterday"`,
+		`userName gt 5`,
+		`not userName eq "a"`,
+	} {
+		_, _, err := parseSCIMFilter(filter, scimUserColumns, 1)
+		assert.Error(t, err, filter)
+	}
+}
+
+func TestApplySCIMUserPatch(t *testing.T) {
+	active := true
+	user := &models.SCIMUser{
+		UserName: "jane@example.com",
+		Name:     &models.SCIMName{GivenName: "Jane", FamilyName: "Doe"},
+		Active:   &active,
+	}
+
+	var patch models.SCIMPatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": "False"},
+			{"op": "replace", "path": "name.familyName", "value": "Smith"},
+			{"op": "add", "path": "emails[type eq \"work\"].value", "value": "jane.smith@example.com"},
+			{"op": "replace", "value": {"externalId": "00u1", "title": "Engineer", "phoneNumbers": [{"value": "555"}]}},
+			{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "Sales"}
+		]
+	}`), &patch))
+
+	require.NoError(t, applySCIMUserPatch(user, patch.Operations))
+
+	assert.False(t, *user.Active)
+	assert.Equal(t, "Jane", user.Name.GivenName)
+	assert.Equal(t, "Smith", user.Name.FamilyName)
+	assert.Equal(t, "jane.smith@example.com", user.Emails[0].Value)
+	assert.Equal(t, "00u1", user.ExternalID)
+	assert.Equal(t, "Engineer", user.Title)
+	assert.Equal(t, "Sales", user.Enterprise.Department)
+
+	err := applySCIMUserPatch(user, []models.SCIMPatchOperation{{Op: "move", Path: "title"}})
+	assert.Error(t, err)
+
+	err = applySCIMUserPatch(user, []models.SCIMPatchOperation{{Op: "replace", Path: "active", Value: json.RawMessage(`"maybe"`)}})
+	assert.Error(t, err)
+}
+
+func TestApplySCIMGroupPatch(t *testing.T) {
+	group := &models.SCIMGroupResource{
+		DisplayName: "Engineering",
+		Members:     []models.SCIMMultiValue{{Value: "a"}, {Value: "b"}},
+	}
+
+	var patch models.SCIMPatchRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"Operations": [
+			{"op": "add", "path": "members", "value": [{"value": "c"}, {"value": "a"}]},
+			{"op": "remove", "path": "members[value eq \"b\"]"},
+			{"op": "replace", "value": {"displayName": "Admins"}}
+		]
+	}`), &patch))
+
+	require.NoError(t, applySCIMGroupPatch(group, patch.Operations))
+	assert.Equal(t, "Admins", group.DisplayName)
+	assert.Equal(t, []models.SCIMMultiValue{{Value: "a"}, {Value: "c"}}, group.Members)
+
+	require.NoError(t, applySCIMGroupPatch(group, []models.SCIMPatchOperation{
+		{Op: "remove", Path: "members", Value: json.RawMessage(`[{"value": "a"}]`)},
+	}))
+	assert.Equal(t, []models.SCIMMultiValue{{Value: "c"}}, group.Members)
+
+	require.NoError(t, applySCIMGroupPatch(group, []models.SCIMPatchOperation{{Op: "remove", Path: "members"}}))
+	assert.Empty(t, group.Members)
+
+	err := applySCIMGroupPatch(group, []models.SCIMPatchOperation{{Op: "replace", Path: "owner", Value: json.RawMessage(`"x"`)}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+)
+
+// scimMemberValueFilter matches members[value eq "<id>"]
+var scimMemberValueFilter = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"([^"]+)"\s*\]$`)
+
+var scimEnterprisePrefix = strings.ToLower(models.SCIMSchemaEnterpriseUser)
+
+// applySCIMUserPatch applies PATCH operations to a user representation. Attributes
+// we do not store (phone numbers, addresses, ...) are accepted and ignored, which is
+// what identity providers expect from a service provider with a reduced schema.
+func applySCIMUserPatch(user *models.SCIMUser, operations []models.SCIMPatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return scimErrorf(http.StatusBadRequest, "invalidSyntax", "unsupported patch operation %q", operation.Op)
+		}
+
+		if operation.Path == "" {
+			if op == "remove" {
+				return scimErrorf(http.StatusBadRequest, "noTarget", "remove requires a path")
+			}
+
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &values); err != nil {
+				return scimErrorf(http.StatusBadRequest, "invalidValue", "patch without a path requires an object value")
+			}
+
+			for key, value := range values {
+				if err := setSCIMUserAttribute(user, op, key, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := setSCIMUserAttribute(user, op, operation.Path, operation.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setSCIMUserAttribute(user *models.SCIMUser, op, path string, value json.RawMessage) error {
+	remove := op == "remove"
+	attribute := normalizeSCIMPath(path)
+
+	// Enterprise extension attributes, either as a whole object or one by one
+	if strings.HasPrefix(attribute, scimEnterprisePrefix) {
+		if user.Enterprise == nil {
+			user.Enterprise = &models.SCIMEnterpriseUser{}
+		}
+
+		switch strings.TrimPrefix(strings.TrimPrefix(attribute, scimEnterprisePrefix), ":") {
+		case "":
+			if remove {
+				user.Enterprise = nil
+				return nil
+			}
+			var enterprise models.SCIMEnterpriseUser
+			if err := json.Unmarshal(value, &enterprise); err != nil {
+				return scimErrorf(http.StatusBadRequest, "invalidValue", "invalid value for %s", path)
+			}
+			user.Enterprise = &enterprise
+		case "employeenumber":
+			return setSCIMString(&user.Enterprise.EmployeeNumber, remove, path, value)
+		case "department":
+			return setSCIMString(&user.Enterprise.Department, remove, path, value)
+		}
+		return nil
+	}
+
+	switch attribute {
+	case "active":
+		if remove {
+			return nil
+		}
+		active, err := decodeSCIMBool(value)
+		if err != nil {
+			return scimErrorf(http.StatusBadRequest, "invalidValue", "active must be a boolean")
+		}
+		user.Active = &active
+	case "username":
+		if remove {
+			return scimErrorf(http.StatusBadRequest, "mutability", "userName cannot be removed")
+		}
+		return setSCIMString(&user.UserName, false, path, value)
+	case "displayname":
+		return setSCIMString(&user.DisplayName, remove, path, value)
+	case "title":
+		return setSCIMString(&user.Title, remove, path, value)
+	case "externalid":
+		return setSCIMString(&user.ExternalID, remove, path, value)
+	case "password":
+		return setSCIMString(&user.Password, remove, path, value)
+	case "name":
+		if remove {
+			user.Name = nil
+			return nil
+		}
+		var name models.SCIMName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return scimErrorf(http.StatusBadRequest, "invalidValue", "invalid value for name")
+		}
+		if user.Name == nil || op == "replace" {
+			user.Name = &name
+			return nil
+		}
+		if name.GivenName != "" {
+			user.Name.GivenName = name.GivenName
+		}
+		if name.FamilyName != "" {
+			user.Name.FamilyName = name.FamilyName
+		}
+		if name.Formatted != "" {
+			user.Name.Formatted = name.Formatted
+		}
+	case "name.givenname", "name.familyname", "name.formatted":
+		if user.Name == nil {
+			user.Name = &models.SCIMName{}
+		}
+		target := map[string]*string{
+			"name.givenname":  &user.Name.GivenName,
+			"name.familyname": &user.Name.FamilyName,
+			"name.formatted":  &user.Name.Formatted,
+		}[attribute]
+		return setSCIMString(target, remove, path, value)
+	case "emails":
+		if remove {
+			return scimErrorf(http.StatusBadRequest, "mutability", "the primary email cannot be removed")
+		}
+		emails, err := decodeSCIMMultiValues(value)
+		if err != nil {
+			return scimErrorf(http.StatusBadRequest, "invalidValue", "invalid value for emails")
+		}
+		user.Emails = emails
+	case "emails.value":
+		if remove {
+			return scimErrorf(http.StatusBadRequest, "mutability", "the primary email cannot be removed")
+		}
+		var email string
+		if err := setSCIMString(&email, false, path, value); err != nil {
+			return err
+		}
+		user.Emails = []models.SCIMMultiValue{{Value: email, Type: "work", Primary: true}}
+	case "roles":
+		if remove {
+			user.Roles = nil
+			return nil
+		}
+		roles, err := decodeSCIMMultiValues(value)
+		if err != nil {
+			return scimErrorf(http.StatusBadRequest, "invalidValue", "invalid value for roles")
+		}
+		user.Roles = roles
+	}
+
+	return nil
+}
+
+// applySCIMGroupPatch applies PATCH operations to a group representation
+func applySCIMGroupPatch(group *models.SCIMGroupResource, operations []models.SCIMPatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" && op != "remove" {
+			return scimErrorf(http.StatusBadRequest, "invalidSyntax", "unsupported patch operation %q", operation.Op)
+		}
+
+		if operation.Path == "" {
+			if op == "remove" {
+				return scimErrorf(http.StatusBadRequest, "noTarget", "remove requires a path")
+			}
+
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal(operation.Value, &values); err != nil {
+				return scimErrorf(http.StatusBadRequest, "invalidValue", "patch without a path requires an object value")
+			}
+
+			for key, value := range values {
+				if err := setSCIMGroupAttribute(group, op, key, value); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if match := scimMemberValueFilter.FindStringSubmatch(operation.Path); match != nil {
+			if op != "remove" {
+				return scimErrorf(http.StatusBadRequest, "invalidPath", "only remove is supported on %s", operation.Path)
+			}
+			group.Members = removeSCIMMembers(group.Members, []models.SCIMMultiValue{{Value: match[1]}})
+			continue
+		}
+
+		if err := setSCIMGroupAttribute(group, op, operation.Path, operation.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setSCIMGroupAttribute(group *models.SCIMGroupResource, op, path string, value json.RawMessage) error {
+	remove := op == "remove"
+
+	switch normalizeSCIMPath(path) {
+	case "displayname":
+		if remove {
+			return scimErrorf(http.StatusBadRequest, "mutability", "displayName cannot be removed")
+		}
+		return setSCIMString(&group.DisplayName, false, path, value)
+	case "externalid":
+		return setSCIMString(&group.ExternalID, remove, path, value)
+	case "members":
+		var members []models.SCIMMultiValue
+		if len(value) > 0 {
+			var err error
+			members, err = decodeSCIMMultiValues(value)
+			if err != nil {
+				return scimErrorf(http.StatusBadRequest, "invalidValue", "invalid value for members")
+			}
+		}
+
+		switch op {
+		case "add":
+			group.Members = addSCIMMembers(group.Members, members)
+		case "replace":
+			group.Members = addSCIMMembers(nil, members)
+		case "remove":
+			if len(members) == 0 {
+				group.Members = nil
+			} else {
+				group.Members = removeSCIMMembers(group.Members, members)
+			}
+		}
+	default:
+		return scimErrorf(http.StatusBadRequest, "invalidPath", "unsupported attribute %s", path)
+	}
+
+	return nil
+}
+
+func addSCIMMembers(members, added []models.SCIMMultiValue) []models.SCIMMultiValue {
+	for _, member := range added {
+		if !containsSCIMMember(members, member.Value) {
+			members = append(members, models.SCIMMultiValue{Value: member.Value})
+		}
+	}
+	return members
+}
+
+func removeSCIMMembers(members, removed []models.SCIMMultiValue) []models.SCIMMultiValue {
+	var remaining []models.SCIMMultiValue
+	for _, member := range members {
+		if !containsSCIMMember(removed, member.Value) {
+			remaining = append(remaining, member)
+		}
+	}
+	return remaining
+}
+
+func containsSCIMMember(members []models.SCIMMultiValue, value string) bool {
+	for _, member := range members {
+		if strings.EqualFold(member.Value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func setSCIMString(target *string, remove bool, path string, value json.RawMessage) error {
+	if remove {
+		*target = ""
+		return nil
+	}
+
+	if err := json.Unmarshal(value, target); err != nil {
+		return scimErrorf(http.StatusBadRequest, "invalidValue", "%s must be a string", path)
+	}
+	return nil
+}
+
+// decodeSCIMBool accepts JSON booleans and the "True"/"False" strings some clients send
+func decodeSCIMBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+
+	b, ok := parseSCIMBool(s)
+	if !ok {
+		return false, fmt.Errorf("invalid boolean %q", s)
+	}
+	return b, nil
+}
+
+// decodeSCIMMultiValues accepts a list of multi-valued entries or a single entry
+func decodeSCIMMultiValues(value json.RawMessage) ([]models.SCIMMultiValue, error) {
+	var values []models.SCIMMultiValue
+	if err := json.Unmarshal(value, &values); err == nil {
+		return values, nil
+	}
+
+	var single models.SCIMMultiValue
+	if err := json.Unmarshal(value, &single); err != nil {
+		return nil, err
+	}
+	return []models.SCIMMultiValue{single}, nil
+}
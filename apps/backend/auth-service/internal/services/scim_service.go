@@ -0,0 +1,965 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+)
+
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 200
+	scimTokenPrefix  = "scim_"
+)
+
+// SCIMError is a SCIM protocol error (RFC 7644 section 3.12)
+type SCIMError struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimErrorf(status int, scimType, format string, args ...interface{}) *SCIMError {
+	return &SCIMError{Status: status, Type: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+// SCIMService provisions users and groups from a tenant's identity provider
+type SCIMService interface {
+	CreateToken(ctx context.Context, tenantID, createdBy uuid.UUID, name string) (*models.CreateSCIMTokenResponse, error)
+	ListTokens(ctx context.Context, tenantID uuid.UUID) ([]*models.SCIMToken, error)
+	DeleteToken(ctx context.Context, tenantID, id uuid.UUID) error
+	Authenticate(ctx context.Context, token string) (*models.SCIMToken, error)
+
+	ListUsers(ctx context.Context, tenantID uuid.UUID, filter string, startIndex, count int) (*models.SCIMListResponse, error)
+	GetUser(ctx context.Context, tenantID uuid.UUID, id string) (*models.SCIMUser, error)
+	CreateUser(ctx context.Context, tenantID uuid.UUID, user *models.SCIMUser) (*models.SCIMUser, error)
+	ReplaceUser(ctx context.Context, tenantID uuid.UUID, id string, user *models.SCIMUser) (*models.SCIMUser, error)
+	PatchUser(ctx context.Context, tenantID uuid.UUID, id string, patch *models.SCIMPatchRequest) (*models.SCIMUser, error)
+	DeleteUser(ctx context.Context, tenantID uuid.UUID, id string) error
+
+	ListGroups(ctx context.Context, tenantID uuid.UUID, filter string, startIndex, count int) (*models.SCIMListResponse, error)
+	GetGroup(ctx context.Context, tenantID uuid.UUID, id string) (*models.SCIMGroupResource, error)
+	CreateGroup(ctx context.Context, tenantID uuid.UUID, group *models.SCIMGroupResource) (*models.SCIMGroupResource, error)
+	ReplaceGroup(ctx context.Context, tenantID uuid.UUID, id string, group *models.SCIMGroupResource) (*models.SCIMGroupResource, error)
+	PatchGroup(ctx context.Context, tenantID uuid.UUID, id string, patch *models.SCIMPatchRequest) (*models.SCIMGroupResource, error)
+	DeleteGroup(ctx context.Context, tenantID uuid.UUID, id string) error
+}
+
+type scimService struct {
+	userRepo         repositories.UserRepository
+	scimRepo         repositories.SCIMRepository
+	refreshTokenRepo repositories.RefreshTokenRepository
+	tenantConfigRepo repositories.TenantConfigRepository
+	passwordPolicy   PasswordPolicyService
+	hrmClient        HRMClient
+	tenantClient     TenantClient
+	cfg              *config.Config
+}
+
+func NewSCIMService(
+	userRepo repositories.UserRepository,
+	scimRepo repositories.SCIMRepository,
+	refreshTokenRepo repositories.RefreshTokenRepository,
+	tenantConfigRepo repositories.TenantConfigRepository,
+	passwordPolicy PasswordPolicyService,
+	hrmClient HRMClient,
+	tenantClient TenantClient,
+	cfg *config.Config,
+) SCIMService {
+	return &scimService{
+		userRepo:         userRepo,
+		scimRepo:         scimRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		tenantConfigRepo: tenantConfigRepo,
+		passwordPolicy:   passwordPolicy,
+		hrmClient:        hrmClient,
+		tenantClient:     tenantClient,
+		cfg:              cfg,
+	}
+}
+
+// CreateToken issues a bearer token for the tenant's SCIM client. Only its hash is stored.
+func (s *scimService) CreateToken(ctx context.Context, tenantID, createdBy uuid.UUID, name string) (*models.CreateSCIMTokenResponse, error) {
+	secret, err := generateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	plaintext := scimTokenPrefix + secret
+	token := &models.SCIMToken{
+		TenantID:  tenantID,
+		Name:      name,
+		TokenHash: hashSCIMToken(plaintext),
+		CreatedBy: &createdBy,
+	}
+
+	err = s.scimRepo.CreateToken(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return &models.CreateSCIMTokenResponse{SCIMToken: *token, Token: plaintext}, nil
+}
+
+func (s *scimService) ListTokens(ctx context.Context, tenantID uuid.UUID) ([]*models.SCIMToken, error) {
+	return s.scimRepo.ListTokens(ctx, tenantID)
+}
+
+func (s *scimService) DeleteToken(ctx context.Context, tenantID, id uuid.UUID) error {
+	return s.scimRepo.DeleteToken(ctx, tenantID, id)
+}
+
+// Authenticate resolves a bearer token to the SCIM token (and tenant) it belongs to
+func (s *scimService) Authenticate(ctx context.Context, token string) (*models.SCIMToken, error) {
+	if !strings.HasPrefix(token, scimTokenPrefix) {
+		return nil, fmt.Errorf("invalid SCIM token")
+	}
+
+	scimToken, err := s.scimRepo.GetTokenByHash(ctx, hashSCIMToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCIM token")
+	}
+
+	err = s.scimRepo.TouchToken(ctx, scimToken.ID)
+	if err != nil {
+		log.Printf("Failed to update SCIM token %s: %v", scimToken.ID, err)
+	}
+
+	return scimToken, nil
+}
+
+func (s *scimService) ListUsers(ctx context.Context, tenantID uuid.UUID, filter string, startIndex, count int) (*models.SCIMListResponse, error) {
+	condition, args, err := s.parseFilter(filter, scimUserColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex, count = scimPage(startIndex, count)
+	records, total, err := s.scimRepo.ListUsers(ctx, tenantID, condition, args, startIndex-1, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	resources := make([]*models.SCIMUser, 0, len(records))
+	for _, record := range records {
+		user, err := s.toSCIMUser(ctx, record)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, user)
+	}
+
+	return scimListResponse(resources, total, startIndex, len(resources)), nil
+}
+
+func (s *scimService) GetUser(ctx context.Context, tenantID uuid.UUID, id string) (*models.SCIMUser, error) {
+	record, err := s.getUserRecord(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toSCIMUser(ctx, record)
+}
+
+func (s *scimService) CreateUser(ctx context.Context, tenantID uuid.UUID, in *models.SCIMUser) (*models.SCIMUser, error) {
+	email, err := scimUserEmail(in)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.userRepo.GetByEmailAndTenant(ctx, email, tenantID)
+	if err == nil {
+		return nil, scimErrorf(http.StatusConflict, "uniqueness", "a user with userName %s already exists", email)
+	}
+
+	// The address belongs to a user of another tenant, who joins this one
+	// with their own account rather than being duplicated by the directory
+	_, err = s.userRepo.GetByEmail(ctx, email)
+	if err == nil {
+		return nil, scimErrorf(http.StatusConflict, "uniqueness", "userName %s belongs to an account in another organization, which must join this organization itself", email)
+	}
+
+	// Active users take a seat of the tenant's plan
+	if in.Active == nil || *in.Active {
+		if err := s.requireSeat(ctx, tenantID); err != nil {
+			return nil, err
+		}
+	}
+
+	scimConfig := s.scimConfig(ctx, tenantID)
+
+	role := scimRequestedRole(in.Roles)
+	if role == "" {
+		role = scimDefaultRole(scimConfig)
+	}
+
+	password := in.Password
+	if password == "" {
+		// Directory users sign in through SSO unless the IdP pushes a password
+		password, err = generateSecureToken(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+	} else if err := s.validatePassword(ctx, tenantID, uuid.Nil, password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	firstName, lastName := scimUserNames(in, email)
+	user := &models.User{
+		TenantID:  tenantID,
+		Email:     email,
+		Password:  hashedPassword,
+		FirstName: firstName,
+		LastName:  lastName,
+		Role:      role,
+	}
+
+	err = s.userRepo.Create(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if in.Password != "" {
+		if err := s.passwordPolicy.RecordPassword(ctx, user.ID, hashedPassword); err != nil {
+			log.Printf("Failed to record password history for user %s: %v", user.ID, err)
+		}
+	}
+
+	// The directory is the source of truth for the address and the account status
+	user.IsVerified = true
+	user.IsActive = in.Active == nil || *in.Active
+	err = s.userRepo.Update(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	err = s.scimRepo.SetExternalID(ctx, tenantID, user.ID, email, scimOptionalString(in.ExternalID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store external ID: %w", err)
+	}
+
+	if scimConfig.CreateEmployees && user.IsActive {
+		s.provisionEmployee(ctx, scimConfig, user, in)
+	}
+
+	return s.GetUser(ctx, tenantID, user.ID.String())
+}
+
+func (s *scimService) ReplaceUser(ctx context.Context, tenantID uuid.UUID, id string, in *models.SCIMUser) (*models.SCIMUser, error) {
+	record, err := s.getUserRecord(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateUser(ctx, record, in)
+}
+
+func (s *scimService) PatchUser(ctx context.Context, tenantID uuid.UUID, id string, patch *models.SCIMPatchRequest) (*models.SCIMUser, error) {
+	record, err := s.getUserRecord(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.toSCIMUser(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applySCIMUserPatch(user, patch.Operations)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateUser(ctx, record, user)
+}
+
+func (s *scimService) DeleteUser(ctx context.Context, tenantID uuid.UUID, id string) error {
+	record, err := s.getUserRecord(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	if record.Role == models.RoleSuperAdmin {
+		return scimErrorf(http.StatusForbidden, "", "system administrators cannot be deleted through SCIM")
+	}
+
+	// A user who belongs to other tenants only leaves this one; otherwise
+	// group memberships and identities are removed by the foreign key cascades
+	err = s.userRepo.DeleteFromTenant(ctx, record.ID, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+// updateUser applies a full user representation to an existing user
+func (s *scimService) updateUser(ctx context.Context, record *models.SCIMUserRecord, in *models.SCIMUser) (*models.SCIMUser, error) {
+	email, err := scimUserEmail(in)
+	if err != nil {
+		return nil, err
+	}
+
+	// The email address and password belong to the identity, which other
+	// tenants of the user share, so only the home tenant's directory manages them
+	if email != record.Email || in.Password != "" {
+		home, err := s.userRepo.GetByID(ctx, record.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if home.TenantID != record.TenantID {
+			return nil, scimErrorf(http.StatusBadRequest, "mutability", "userName and password of a user who belongs to other tenants can only be changed by their home tenant")
+		}
+	}
+
+	if email != record.Email {
+		_, err = s.userRepo.GetByEmailAndTenant(ctx, email, record.TenantID)
+		if err == nil {
+			return nil, scimErrorf(http.StatusConflict, "uniqueness", "a user with userName %s already exists", email)
+		}
+	}
+
+	if in.Password != "" {
+		if err := s.validatePassword(ctx, record.TenantID, record.ID, in.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	user := record.User
+	wasActive := user.IsActive
+	user.Email = email
+	user.FirstName, user.LastName = scimUserNames(in, email)
+	user.IsActive = in.Active == nil || *in.Active
+
+	// A reactivated user takes a seat again
+	if !wasActive && user.IsActive {
+		if err := s.requireSeat(ctx, user.TenantID); err != nil {
+			return nil, err
+		}
+	}
+
+	if user.Role != models.RoleSuperAdmin {
+		role := scimRequestedRole(in.Roles)
+		if role == "" {
+			role = user.Role
+		}
+
+		user.Role, err = s.resolveRole(ctx, user.TenantID, user.ID, role)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.userRepo.Update(ctx, &user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// Update does not write the password, it has its own history and age
+	passwordChanged := in.Password != ""
+	if passwordChanged {
+		hashedPassword, err := hashPassword(in.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		err = s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update password: %w", err)
+		}
+
+		if err := s.passwordPolicy.RecordPassword(ctx, user.ID, hashedPassword); err != nil {
+			log.Printf("Failed to record password history for user %s: %v", user.ID, err)
+		}
+	}
+
+	// Deactivated users and users whose password the directory reset lose
+	// their sessions immediately
+	if wasActive && !user.IsActive || passwordChanged {
+		err = s.refreshTokenRepo.DeleteByUserID(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to revoke sessions of user %s: %v", user.ID, err)
+		}
+	}
+
+	err = s.scimRepo.SetExternalID(ctx, user.TenantID, user.ID, email, scimOptionalString(in.ExternalID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store external ID: %w", err)
+	}
+
+	return s.GetUser(ctx, user.TenantID, user.ID.String())
+}
+
+func (s *scimService) ListGroups(ctx context.Context, tenantID uuid.UUID, filter string, startIndex, count int) (*models.SCIMListResponse, error) {
+	condition, args, err := s.parseFilter(filter, scimGroupColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex, count = scimPage(startIndex, count)
+	groups, total, err := s.scimRepo.ListGroups(ctx, tenantID, condition, args, startIndex-1, count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	resources := make([]*models.SCIMGroupResource, 0, len(groups))
+	for _, group := range groups {
+		resources = append(resources, s.toSCIMGroup(group))
+	}
+
+	return scimListResponse(resources, total, startIndex, len(resources)), nil
+}
+
+func (s *scimService) GetGroup(ctx context.Context, tenantID uuid.UUID, id string) (*models.SCIMGroupResource, error) {
+	group, err := s.getGroup(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toSCIMGroup(group), nil
+}
+
+func (s *scimService) CreateGroup(ctx context.Context, tenantID uuid.UUID, in *models.SCIMGroupResource) (*models.SCIMGroupResource, error) {
+	if strings.TrimSpace(in.DisplayName) == "" {
+		return nil, scimErrorf(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+
+	err := s.checkGroupName(ctx, tenantID, uuid.Nil, in.DisplayName)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs, err := scimMemberIDs(in.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	scimConfig := s.scimConfig(ctx, tenantID)
+	group := &models.SCIMGroup{
+		TenantID:    tenantID,
+		DisplayName: in.DisplayName,
+		ExternalID:  scimOptionalString(in.ExternalID),
+		Role:        scimGroupRole(scimConfig, in.DisplayName),
+		MemberIDs:   memberIDs,
+	}
+
+	err = s.scimRepo.CreateGroup(ctx, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %w", err)
+	}
+
+	s.syncRoles(ctx, scimConfig, nil, group)
+
+	return s.GetGroup(ctx, tenantID, group.ID.String())
+}
+
+func (s *scimService) ReplaceGroup(ctx context.Context, tenantID uuid.UUID, id string, in *models.SCIMGroupResource) (*models.SCIMGroupResource, error) {
+	group, err := s.getGroup(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateGroup(ctx, group, in)
+}
+
+func (s *scimService) PatchGroup(ctx context.Context, tenantID uuid.UUID, id string, patch *models.SCIMPatchRequest) (*models.SCIMGroupResource, error) {
+	group, err := s.getGroup(ctx, tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := s.toSCIMGroup(group)
+	err = applySCIMGroupPatch(resource, patch.Operations)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.updateGroup(ctx, group, resource)
+}
+
+func (s *scimService) DeleteGroup(ctx context.Context, tenantID uuid.UUID, id string) error {
+	group, err := s.getGroup(ctx, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	err = s.scimRepo.DeleteGroup(ctx, tenantID, group.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+
+	s.syncRoles(ctx, s.scimConfig(ctx, tenantID), group, nil)
+
+	return nil
+}
+
+func (s *scimService) updateGroup(ctx context.Context, group *models.SCIMGroup, in *models.SCIMGroupResource) (*models.SCIMGroupResource, error) {
+	if strings.TrimSpace(in.DisplayName) == "" {
+		return nil, scimErrorf(http.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+
+	if in.DisplayName != group.DisplayName {
+		err := s.checkGroupName(ctx, group.TenantID, group.ID, in.DisplayName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	memberIDs, err := scimMemberIDs(in.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	scimConfig := s.scimConfig(ctx, group.TenantID)
+	previous := *group
+	updated := *group
+	updated.DisplayName = in.DisplayName
+	updated.ExternalID = scimOptionalString(in.ExternalID)
+	updated.Role = scimGroupRole(scimConfig, in.DisplayName)
+	updated.MemberIDs = memberIDs
+
+	err = s.scimRepo.UpdateGroup(ctx, &updated)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+
+	s.syncRoles(ctx, scimConfig, &previous, &updated)
+
+	return s.GetGroup(ctx, group.TenantID, group.ID.String())
+}
+
+// checkGroupName rejects a display name already used by another group of the tenant
+func (s *scimService) checkGroupName(ctx context.Context, tenantID, groupID uuid.UUID, displayName string) error {
+	group, err := s.scimRepo.GetGroupByName(ctx, tenantID, displayName)
+	if err == nil && group.ID != groupID {
+		return scimErrorf(http.StatusConflict, "uniqueness", "a group named %s already exists", displayName)
+	}
+
+	return nil
+}
+
+// syncRoles recomputes the role of every user whose memberships changed between
+// the previous and updated state of a group (either may be nil)
+func (s *scimService) syncRoles(ctx context.Context, scimConfig *models.SCIMConfig, previous, updated *models.SCIMGroup) {
+	// fallback reports whether a user may have held a role granted by this group,
+	// in which case losing it drops them to the default role
+	fallback := make(map[uuid.UUID]bool)
+	if previous != nil {
+		for _, userID := range previous.MemberIDs {
+			fallback[userID] = previous.Role != nil
+		}
+	}
+	if updated != nil {
+		for _, userID := range updated.MemberIDs {
+			if _, ok := fallback[userID]; !ok || updated.Role != nil {
+				fallback[userID] = false
+			}
+		}
+	}
+
+	tenantID := scimGroupTenant(previous, updated)
+	for userID, useDefault := range fallback {
+		user, err := s.userRepo.GetByIDAndTenant(ctx, userID, tenantID)
+		if err != nil || user.Role == models.RoleSuperAdmin {
+			continue
+		}
+
+		base := user.Role
+		if useDefault {
+			base = scimDefaultRole(scimConfig)
+		}
+
+		role, err := s.resolveRole(ctx, tenantID, userID, base)
+		if err != nil {
+			log.Printf("Failed to resolve role of user %s: %v", userID, err)
+			continue
+		}
+
+		if role != user.Role {
+			user.Role = role
+			err = s.userRepo.Update(ctx, user)
+			if err != nil {
+				log.Printf("Failed to update role of user %s: %v", userID, err)
+			}
+		}
+	}
+}
+
+// scimGroupTenant returns the tenant of a group given in either of its states
+func scimGroupTenant(previous, updated *models.SCIMGroup) uuid.UUID {
+	if updated != nil {
+		return updated.TenantID
+	}
+	return previous.TenantID
+}
+
+// resolveRole returns the highest role granted by the user's groups in the tenant,
+// or base when none of them grants a role
+func (s *scimService) resolveRole(ctx context.Context, tenantID, userID uuid.UUID, base string) (string, error) {
+	groups, err := s.scimRepo.GetUserGroups(ctx, tenantID, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user groups: %w", err)
+	}
+
+	role := ""
+	for _, group := range groups {
+		if group.Role != nil && roleRank(*group.Role) > roleRank(role) {
+			role = *group.Role
+		}
+	}
+
+	if role == "" {
+		return base, nil
+	}
+	return role, nil
+}
+
+// provisionEmployee creates the matching hrm-service employee. Failures are logged
+// and do not fail the SCIM request, the directory would otherwise retry forever.
+func (s *scimService) provisionEmployee(ctx context.Context, scimConfig *models.SCIMConfig, user *models.User, in *models.SCIMUser) {
+	if user.LastName == "" {
+		log.Printf("Skipping employee for user %s: no family name", user.ID)
+		return
+	}
+
+	exists, err := s.hrmClient.EmployeeExists(ctx, user.TenantID, user.Email)
+	if err != nil {
+		log.Printf("Failed to look up employee for user %s: %v", user.ID, err)
+		return
+	}
+	if exists {
+		return
+	}
+
+	departmentID := scimConfig.DefaultDepartmentID
+	employeeCode := "SCIM-" + strings.ToUpper(user.ID.String()[:8])
+	if in.Enterprise != nil {
+		if in.Enterprise.Department != "" {
+			id, err := s.hrmClient.FindDepartmentID(ctx, user.TenantID, in.Enterprise.Department)
+			if err == nil {
+				departmentID = id
+			} else {
+				log.Printf("Using default department for user %s: %v", user.ID, err)
+			}
+		}
+		if in.Enterprise.EmployeeNumber != "" {
+			employeeCode = in.Enterprise.EmployeeNumber
+		}
+	}
+
+	if departmentID == 0 {
+		log.Printf("Skipping employee for user %s: no department", user.ID)
+		return
+	}
+
+	position := in.Title
+	if position == "" {
+		position = "Employee"
+	}
+
+	userID := user.ID.String()
+	err = s.hrmClient.CreateEmployee(ctx, user.TenantID, &HRMEmployee{
+		UserID:       &userID,
+		EmployeeCode: employeeCode,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		Email:        user.Email,
+		DepartmentID: departmentID,
+		Position:     position,
+		HireDate:     time.Now(),
+		Status:       "active",
+	})
+	if err != nil {
+		log.Printf("Failed to create employee for user %s: %v", user.ID, err)
+	}
+}
+
+// validatePassword checks a password pushed by the directory against the
+// tenant's password policy like any other new password
+// requireSeat refuses a user the tenant's plan has no seat left for, in the
+// SCIM error format
+func (s *scimService) requireSeat(ctx context.Context, tenantID uuid.UUID) error {
+	if err := checkSeats(ctx, s.tenantClient, tenantID, 1); err != nil {
+		return scimErrorf(http.StatusForbidden, "", "%v", err)
+	}
+	return nil
+}
+
+func (s *scimService) validatePassword(ctx context.Context, tenantID, userID uuid.UUID, password string) error {
+	err := s.passwordPolicy.Validate(ctx, tenantID, userID, password)
+	var policyErr *models.PasswordPolicyError
+	if errors.As(err, &policyErr) {
+		return scimErrorf(http.StatusBadRequest, "invalidValue", "%s", policyErr.Error())
+	}
+	return err
+}
+
+func (s *scimService) getUserRecord(ctx context.Context, tenantID uuid.UUID, id string) (*models.SCIMUserRecord, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, scimErrorf(http.StatusNotFound, "", "user %s not found", id)
+	}
+
+	record, err := s.scimRepo.GetUser(ctx, tenantID, userID)
+	if err != nil {
+		return nil, scimErrorf(http.StatusNotFound, "", "user %s not found", id)
+	}
+
+	return record, nil
+}
+
+func (s *scimService) getGroup(ctx context.Context, tenantID uuid.UUID, id string) (*models.SCIMGroup, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, scimErrorf(http.StatusNotFound, "", "group %s not found", id)
+	}
+
+	group, err := s.scimRepo.GetGroup(ctx, tenantID, groupID)
+	if err != nil {
+		return nil, scimErrorf(http.StatusNotFound, "", "group %s not found", id)
+	}
+
+	return group, nil
+}
+
+func (s *scimService) parseFilter(filter string, columns map[string]scimColumn) (string, []interface{}, error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", nil, nil
+	}
+
+	// The tenant ID is always $1
+	condition, args, err := parseSCIMFilter(filter, columns, 1)
+	if err != nil {
+		return "", nil, scimErrorf(http.StatusBadRequest, "invalidFilter", "%s", err.Error())
+	}
+
+	return condition, args, nil
+}
+
+// scimConfig returns the tenant's SCIM settings, or the defaults when none are configured
+func (s *scimService) scimConfig(ctx context.Context, tenantID uuid.UUID) *models.SCIMConfig {
+	tenantConfig, err := s.tenantConfigRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return &models.SCIMConfig{}
+	}
+
+	var integration models.IntegrationConfig
+	if err := json.Unmarshal([]byte(tenantConfig.IntegrationConfig), &integration); err != nil || integration.SCIM == nil {
+		return &models.SCIMConfig{}
+	}
+
+	return integration.SCIM
+}
+
+func (s *scimService) toSCIMUser(ctx context.Context, record *models.SCIMUserRecord) (*models.SCIMUser, error) {
+	groups, err := s.scimRepo.GetUserGroups(ctx, record.TenantID, record.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user groups: %w", err)
+	}
+
+	active := record.IsActive
+	user := &models.SCIMUser{
+		Schemas:  []string{models.SCIMSchemaUser},
+		ID:       record.ID.String(),
+		UserName: record.Email,
+		Name: &models.SCIMName{
+			Formatted:  strings.TrimSpace(record.FirstName + " " + record.LastName),
+			GivenName:  record.FirstName,
+			FamilyName: record.LastName,
+		},
+		DisplayName: strings.TrimSpace(record.FirstName + " " + record.LastName),
+		Emails:      []models.SCIMMultiValue{{Value: record.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Roles:       []models.SCIMMultiValue{{Value: record.Role, Primary: true}},
+		Meta: &models.SCIMMeta{
+			ResourceType: "User",
+			Created:      record.CreatedAt,
+			LastModified: record.UpdatedAt,
+			Location:     s.location("Users", record.ID),
+		},
+	}
+
+	if record.ExternalID != nil {
+		user.ExternalID = *record.ExternalID
+	}
+
+	for _, group := range groups {
+		user.Groups = append(user.Groups, models.SCIMMultiValue{
+			Value:   group.ID.String(),
+			Display: group.DisplayName,
+			Ref:     s.location("Groups", group.ID),
+		})
+	}
+
+	return user, nil
+}
+
+func (s *scimService) toSCIMGroup(group *models.SCIMGroup) *models.SCIMGroupResource {
+	resource := &models.SCIMGroupResource{
+		Schemas:     []string{models.SCIMSchemaGroup},
+		ID:          group.ID.String(),
+		DisplayName: group.DisplayName,
+		Meta: &models.SCIMMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     s.location("Groups", group.ID),
+		},
+	}
+
+	if group.ExternalID != nil {
+		resource.ExternalID = *group.ExternalID
+	}
+
+	for _, userID := range group.MemberIDs {
+		resource.Members = append(resource.Members, models.SCIMMultiValue{
+			Value: userID.String(),
+			Ref:   s.location("Users", userID),
+		})
+	}
+
+	return resource
+}
+
+func (s *scimService) location(resourceType string, id uuid.UUID) string {
+	return strings.TrimSuffix(s.cfg.SCIMBaseURL, "/") + "/" + resourceType + "/" + id.String()
+}
+
+func hashSCIMToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// scimPage clamps the 1-based startIndex and the page size
+func scimPage(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	if count < 0 {
+		count = scimDefaultCount
+	}
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+	return startIndex, count
+}
+
+func scimListResponse(resources interface{}, total, startIndex, itemsPerPage int) *models.SCIMListResponse {
+	return &models.SCIMListResponse{
+		Schemas:      []string{models.SCIMSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+// scimUserEmail returns the address a SCIM user signs in with: userName when it is
+// an email address, otherwise the primary email
+func scimUserEmail(user *models.SCIMUser) (string, error) {
+	if strings.Contains(user.UserName, "@") {
+		return normalizeEmail(user.UserName), nil
+	}
+
+	for _, email := range user.Emails {
+		if email.Primary && strings.Contains(email.Value, "@") {
+			return normalizeEmail(email.Value), nil
+		}
+	}
+	for _, email := range user.Emails {
+		if strings.Contains(email.Value, "@") {
+			return normalizeEmail(email.Value), nil
+		}
+	}
+
+	return "", scimErrorf(http.StatusBadRequest, "invalidValue", "userName or emails must contain an email address")
+}
+
+func scimUserNames(user *models.SCIMUser, email string) (string, string) {
+	if user.Name != nil && (user.Name.GivenName != "" || user.Name.FamilyName != "") {
+		return user.Name.GivenName, user.Name.FamilyName
+	}
+
+	if fields := strings.Fields(user.DisplayName); len(fields) > 0 {
+		return fields[0], strings.Join(fields[1:], " ")
+	}
+
+	return email[:strings.Index(email, "@")], ""
+}
+
+// scimRequestedRole returns the highest assignable role in a SCIM roles attribute
+func scimRequestedRole(roles []models.SCIMMultiValue) string {
+	role := ""
+	for _, value := range roles {
+		requested := strings.ToLower(value.Value)
+		if isSSOAssignableRole(requested) && roleRank(requested) > roleRank(role) {
+			role = requested
+		}
+	}
+	return role
+}
+
+func scimDefaultRole(scimConfig *models.SCIMConfig) string {
+	if isSSOAssignableRole(scimConfig.DefaultRole) {
+		return scimConfig.DefaultRole
+	}
+	return models.RoleUser
+}
+
+// scimGroupRole returns the role a group grants: the tenant's mapping for its name,
+// or the role of the same name
+func scimGroupRole(scimConfig *models.SCIMConfig, displayName string) *string {
+	for name, role := range scimConfig.GroupRoleMapping {
+		if strings.EqualFold(name, displayName) && isSSOAssignableRole(role) {
+			return &role
+		}
+	}
+
+	role := strings.ToLower(displayName)
+	if isSSOAssignableRole(role) {
+		return &role
+	}
+
+	return nil
+}
+
+func scimMemberIDs(members []models.SCIMMultiValue) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, member := range members {
+		id, err := uuid.Parse(member.Value)
+		if err != nil {
+			return nil, scimErrorf(http.StatusBadRequest, "invalidValue", "member %s is not a user ID", member.Value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func scimOptionalString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
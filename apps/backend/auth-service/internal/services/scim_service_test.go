@@ -0,0 +1,497 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestSCIMService(t *testing.T, scimConfig *models.SCIMConfig) (SCIMService, *fakeUserRepository, *fakeRefreshTokenRepository, *fakeHRMClient, uuid.UUID) {
+	t.Helper()
+
+	tenantID := uuid.New()
+	integration, err := json.Marshal(models.IntegrationConfig{SCIM: scimConfig})
+	require.NoError(t, err)
+
+	userRepo := newFakeUserRepository()
+	refreshTokenRepo := &fakeRefreshTokenRepository{}
+	tenantConfigRepo := &fakeTenantConfigRepository{configs: map[uuid.UUID]*models.TenantConfiguration{
+		tenantID: {TenantID: tenantID, IntegrationConfig: string(integration)},
+	}}
+	hrmClient := &fakeHRMClient{departments: map[string]int{"sales": 7}}
+	cfg := &config.Config{SCIMBaseURL: "https://api.example.com/scim/v2"}
+
+	svc := NewSCIMService(userRepo, newFakeSCIMRepository(userRepo), refreshTokenRepo, tenantConfigRepo, NewPasswordPolicyService(tenantConfigRepo, newFakePasswordHistoryRepository(), nil), hrmClient, &fakeTenantClient{}, cfg)
+	return svc, userRepo, refreshTokenRepo, hrmClient, tenantID
+}
+
+func TestSCIMTokenAuthenticatesTenant(t *testing.T) {
+	svc, _, _, _, tenantID := newTestSCIMService(t, nil)
+	ctx := context.Background()
+
+	created, err := svc.CreateToken(ctx, tenantID, uuid.New(), "Okta")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(created.Token, "scim_"))
+	assert.NotEqual(t, created.Token, created.TokenHash)
+
+	token, err := svc.Authenticate(ctx, created.Token)
+	require.NoError(t, err)
+	assert.Equal(t, tenantID, token.TenantID)
+
+	_, err = svc.Authenticate(ctx, created.Token+"x")
+	assert.Error(t, err)
+
+	require.NoError(t, svc.DeleteToken(ctx, tenantID, created.ID))
+	_, err = svc.Authenticate(ctx, created.Token)
+	assert.Error(t, err)
+}
+
+func TestSCIMCreateUserProvisionsUserAndEmployee(t *testing.T) {
+	svc, userRepo, _, hrmClient, tenantID := newTestSCIMService(t, &models.SCIMConfig{
+		DefaultRole:     models.RoleManager,
+		CreateEmployees: true,
+	})
+	ctx := context.Background()
+
+	created, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{
+		UserName:   "Jane@Example.com",
+		ExternalID: "00u1",
+		Name:       &models.SCIMName{GivenName: "Jane", FamilyName: "Doe"},
+		Title:      "Account Executive",
+		Enterprise: &models.SCIMEnterpriseUser{EmployeeNumber: "E-42", Department: "Sales"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "jane@example.com", created.UserName)
+	assert.Equal(t, "00u1", created.ExternalID)
+	assert.True(t, *created.Active)
+	assert.Equal(t, "https://api.example.com/scim/v2/Users/"+created.ID, created.Meta.Location)
+
+	user, err := userRepo.GetByID(ctx, uuid.MustParse(created.ID))
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleManager, user.Role)
+	assert.True(t, user.IsVerified)
+
+	require.Len(t, hrmClient.employees, 1)
+	employee := hrmClient.employees[0]
+	assert.Equal(t, "E-42", employee.EmployeeCode)
+	assert.Equal(t, 7, employee.DepartmentID)
+	assert.Equal(t, "Account Executive", employee.Position)
+	assert.Equal(t, "active", employee.Status)
+
+	_, err = svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com"})
+	var scimErr *SCIMError
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, http.StatusConflict, scimErr.Status)
+	assert.Equal(t, "uniqueness", scimErr.Type)
+
+	_, err = svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jdoe"})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, "invalidValue", scimErr.Type)
+}
+
+func TestSCIMPatchDeactivatesUserAndRevokesSessions(t *testing.T) {
+	svc, userRepo, refreshTokenRepo, _, tenantID := newTestSCIMService(t, nil)
+	ctx := context.Background()
+
+	created, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com"})
+	require.NoError(t, err)
+	userID := uuid.MustParse(created.ID)
+	refreshTokenRepo.tokens = []*models.RefreshToken{{ID: uuid.New(), UserID: userID}}
+
+	patched, err := svc.PatchUser(ctx, tenantID, created.ID, &models.SCIMPatchRequest{
+		Operations: []models.SCIMPatchOperation{{Op: "replace", Value: json.RawMessage(`{"active": false}`)}},
+	})
+	require.NoError(t, err)
+	assert.False(t, *patched.Active)
+
+	user, err := userRepo.GetByID(ctx, userID)
+	require.NoError(t, err)
+	assert.False(t, user.IsActive)
+	assert.Empty(t, refreshTokenRepo.tokens)
+
+	_, err = svc.GetUser(ctx, uuid.New(), created.ID)
+	var scimErr *SCIMError
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, http.StatusNotFound, scimErr.Status)
+}
+
+func TestSCIMPatchPersistsPassword(t *testing.T) {
+	svc, userRepo, refreshTokenRepo, _, tenantID := newTestSCIMService(t, nil)
+	ctx := context.Background()
+
+	created, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com"})
+	require.NoError(t, err)
+	userID := uuid.MustParse(created.ID)
+	refreshTokenRepo.tokens = []*models.RefreshToken{{ID: uuid.New(), UserID: userID}}
+
+	_, err = svc.PatchUser(ctx, tenantID, created.ID, &models.SCIMPatchRequest{
+		Operations: []models.SCIMPatchOperation{{Op: "replace", Path: "password", Value: json.RawMessage(`"Directory-Pushed-42"`)}},
+	})
+	require.NoError(t, err)
+
+	user, err := userRepo.GetByID(ctx, userID)
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Directory-Pushed-42")))
+	assert.Empty(t, refreshTokenRepo.tokens, "a reset password signs the user out")
+}
+
+func TestSCIMPasswordsFollowPasswordPolicy(t *testing.T) {
+	svc, userRepo, _, _, tenantID := newTestSCIMService(t, nil)
+	ctx := context.Background()
+
+	_, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com", Password: "short"})
+	var scimErr *SCIMError
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, http.StatusBadRequest, scimErr.Status)
+	assert.Equal(t, "invalidValue", scimErr.Type)
+	assert.Empty(t, userRepo.users)
+
+	created, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com", Password: "Directory-Pushed-42"})
+	require.NoError(t, err)
+
+	// The pushed password went into the history, so it cannot be set again
+	_, err = svc.ReplaceUser(ctx, tenantID, created.ID, &models.SCIMUser{UserName: "jane@example.com", Password: "Directory-Pushed-42"})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Contains(t, scimErr.Detail, "last 5 passwords")
+
+	_, err = svc.PatchUser(ctx, tenantID, created.ID, &models.SCIMPatchRequest{
+		Operations: []models.SCIMPatchOperation{{Op: "replace", Path: "password", Value: json.RawMessage(`"weak"`)}},
+	})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, http.StatusBadRequest, scimErr.Status)
+
+	user, err := userRepo.GetByID(ctx, uuid.MustParse(created.ID))
+	require.NoError(t, err)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("Directory-Pushed-42")))
+}
+
+func TestSCIMChangesToSharedUsersStayInTheirTenant(t *testing.T) {
+	svc, userRepo, _, _, homeTenantID := newTestSCIMService(t, nil)
+	ctx := context.Background()
+	otherTenantID := uuid.New()
+
+	created, err := svc.CreateUser(ctx, homeTenantID, &models.SCIMUser{UserName: "jane@example.com", Name: &models.SCIMName{GivenName: "Jane", FamilyName: "Doe"}})
+	require.NoError(t, err)
+	userID := uuid.MustParse(created.ID)
+	require.NoError(t, userRepo.AddMembership(ctx, &models.TenantMembership{UserID: userID, TenantID: otherTenantID, Role: models.RoleUser}))
+
+	// The other tenant's directory deactivates and renames only its member
+	_, err = svc.ReplaceUser(ctx, otherTenantID, created.ID, &models.SCIMUser{
+		UserName: "jane@example.com", Name: &models.SCIMName{GivenName: "J", FamilyName: "D"}, Active: new(bool),
+	})
+	require.NoError(t, err)
+	member, err := userRepo.GetByIDAndTenant(ctx, userID, otherTenantID)
+	require.NoError(t, err)
+	assert.False(t, member.IsActive)
+	home, err := userRepo.GetByID(ctx, userID)
+	require.NoError(t, err)
+	assert.True(t, home.IsActive)
+	assert.Equal(t, homeTenantID, home.TenantID)
+	assert.Equal(t, "Jane", home.FirstName)
+
+	// ... and cannot change the shared email address or password
+	var scimErr *SCIMError
+	_, err = svc.ReplaceUser(ctx, otherTenantID, created.ID, &models.SCIMUser{UserName: "jane@other.example.com"})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, "mutability", scimErr.Type)
+	_, err = svc.ReplaceUser(ctx, otherTenantID, created.ID, &models.SCIMUser{UserName: "jane@example.com", Password: "Directory-Pushed-42"})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, "mutability", scimErr.Type)
+	home, _ = userRepo.GetByID(ctx, userID)
+	assert.Equal(t, "jane@example.com", home.Email)
+
+	// Deleting the user there only removes the membership
+	require.NoError(t, svc.DeleteUser(ctx, otherTenantID, created.ID))
+	_, err = svc.GetUser(ctx, otherTenantID, created.ID)
+	assert.Error(t, err)
+	_, err = svc.GetUser(ctx, homeTenantID, created.ID)
+	assert.NoError(t, err)
+
+	// The home tenant deleting a user who belongs elsewhere moves their home
+	require.NoError(t, userRepo.AddMembership(ctx, &models.TenantMembership{UserID: userID, TenantID: otherTenantID, Role: models.RoleManager}))
+	require.NoError(t, svc.DeleteUser(ctx, homeTenantID, created.ID))
+	home, err = userRepo.GetByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, otherTenantID, home.TenantID)
+	assert.Equal(t, models.RoleManager, home.Role)
+	_, err = svc.GetUser(ctx, homeTenantID, created.ID)
+	assert.Error(t, err)
+
+	// Once it is the last tenant, the user is deleted
+	require.NoError(t, svc.DeleteUser(ctx, otherTenantID, created.ID))
+	assert.Empty(t, userRepo.users)
+}
+
+func TestSCIMCreateUserRejectsAddressOfAnotherTenant(t *testing.T) {
+	svc, userRepo, _, _, tenantID := newTestSCIMService(t, nil)
+	ctx := context.Background()
+
+	_, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com"})
+	require.NoError(t, err)
+
+	var scimErr *SCIMError
+	_, err = svc.CreateUser(ctx, uuid.New(), &models.SCIMUser{UserName: "jane@example.com"})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, "uniqueness", scimErr.Type)
+	assert.Contains(t, scimErr.Detail, "another organization")
+	assert.Len(t, userRepo.users, 1)
+}
+
+func TestSCIMCreateUserNeedsASeat(t *testing.T) {
+	svc, userRepo, _, _, tenantID := newTestSCIMService(t, nil)
+	limit := int64(5)
+	svc.(*scimService).tenantClient = &fakeTenantClient{quota: &models.QuotaCheck{
+		Resource: models.QuotaResourceUsers, Used: 5, Limit: &limit,
+	}}
+	ctx := context.Background()
+
+	var scimErr *SCIMError
+	_, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com"})
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, http.StatusForbidden, scimErr.Status)
+	assert.Contains(t, scimErr.Detail, "your plan allows 5 users")
+	assert.Empty(t, userRepo.users)
+
+	// A user provisioned inactive takes no seat
+	inactive := false
+	_, err = svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com", Active: &inactive})
+	require.NoError(t, err)
+	assert.Len(t, userRepo.users, 1)
+}
+
+func TestSCIMGroupMembershipGrantsMappedRole(t *testing.T) {
+	svc, userRepo, _, _, tenantID := newTestSCIMService(t, &models.SCIMConfig{
+		GroupRoleMapping: map[string]string{"Platform Admins": models.RoleAdmin},
+	})
+	ctx := context.Background()
+
+	jane, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "jane@example.com"})
+	require.NoError(t, err)
+	john, err := svc.CreateUser(ctx, tenantID, &models.SCIMUser{UserName: "john@example.com"})
+	require.NoError(t, err)
+
+	roleOf := func(id string) string {
+		user, err := userRepo.GetByID(ctx, uuid.MustParse(id))
+		require.NoError(t, err)
+		return user.Role
+	}
+
+	group, err := svc.CreateGroup(ctx, tenantID, &models.SCIMGroupResource{
+		DisplayName: "Platform Admins",
+		Members:     []models.SCIMMultiValue{{Value: jane.ID}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, roleOf(jane.ID))
+	assert.Equal(t, models.RoleUser, roleOf(john.ID))
+
+	_, err = svc.PatchGroup(ctx, tenantID, group.ID, &models.SCIMPatchRequest{
+		Operations: []models.SCIMPatchOperation{
+			{Op: "add", Path: "members", Value: json.RawMessage(`[{"value": "` + john.ID + `"}]`)},
+			{Op: "remove", Path: `members[value eq "` + jane.ID + `"]`},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, roleOf(jane.ID))
+	assert.Equal(t, models.RoleAdmin, roleOf(john.ID))
+
+	_, err = svc.CreateGroup(ctx, tenantID, &models.SCIMGroupResource{DisplayName: "platform admins"})
+	var scimErr *SCIMError
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, http.StatusConflict, scimErr.Status)
+
+	require.NoError(t, svc.DeleteGroup(ctx, tenantID, group.ID))
+	assert.Equal(t, models.RoleUser, roleOf(john.ID))
+}
+
+type fakeSCIMRepository struct {
+	userRepo   *fakeUserRepository
+	tokens     map[uuid.UUID]*models.SCIMToken
+	externalID map[uuid.UUID]string
+	groups     map[uuid.UUID]*models.SCIMGroup
+}
+
+func newFakeSCIMRepository(userRepo *fakeUserRepository) *fakeSCIMRepository {
+	return &fakeSCIMRepository{
+		userRepo:   userRepo,
+		tokens:     make(map[uuid.UUID]*models.SCIMToken),
+		externalID: make(map[uuid.UUID]string),
+		groups:     make(map[uuid.UUID]*models.SCIMGroup),
+	}
+}
+
+func (r *fakeSCIMRepository) CreateToken(ctx context.Context, token *models.SCIMToken) error {
+	token.ID = uuid.New()
+	r.tokens[token.ID] = token
+	return nil
+}
+
+func (r *fakeSCIMRepository) GetTokenByHash(ctx context.Context, tokenHash string) (*models.SCIMToken, error) {
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
+	}
+	return nil, fmt.Errorf("SCIM token not found")
+}
+
+func (r *fakeSCIMRepository) ListTokens(ctx context.Context, tenantID uuid.UUID) ([]*models.SCIMToken, error) {
+	var tokens []*models.SCIMToken
+	for _, token := range r.tokens {
+		if token.TenantID == tenantID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *fakeSCIMRepository) DeleteToken(ctx context.Context, tenantID, id uuid.UUID) error {
+	token, ok := r.tokens[id]
+	if !ok || token.TenantID != tenantID {
+		return fmt.Errorf("SCIM token not found")
+	}
+	delete(r.tokens, id)
+	return nil
+}
+
+func (r *fakeSCIMRepository) TouchToken(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+// ListUsers ignores the SQL filter, filter translation is covered by the parser tests
+func (r *fakeSCIMRepository) ListUsers(ctx context.Context, tenantID uuid.UUID, filter string, args []interface{}, offset, limit int) ([]*models.SCIMUserRecord, int, error) {
+	var records []*models.SCIMUserRecord
+	for id := range r.userRepo.users {
+		record, err := r.GetUser(ctx, tenantID, id)
+		if err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, len(records), nil
+}
+
+func (r *fakeSCIMRepository) GetUser(ctx context.Context, tenantID, userID uuid.UUID) (*models.SCIMUserRecord, error) {
+	user, err := r.userRepo.GetByIDAndTenant(ctx, userID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	record := &models.SCIMUserRecord{User: *user}
+	if externalID, ok := r.externalID[userID]; ok {
+		record.ExternalID = &externalID
+	}
+	return record, nil
+}
+
+func (r *fakeSCIMRepository) SetExternalID(ctx context.Context, tenantID, userID uuid.UUID, email string, externalID *string) error {
+	delete(r.externalID, userID)
+	if externalID != nil {
+		r.externalID[userID] = *externalID
+	}
+	return nil
+}
+
+func (r *fakeSCIMRepository) ListGroups(ctx context.Context, tenantID uuid.UUID, filter string, args []interface{}, offset, limit int) ([]*models.SCIMGroup, int, error) {
+	var groups []*models.SCIMGroup
+	for _, group := range r.groups {
+		if group.TenantID == tenantID {
+			copied := *group
+			groups = append(groups, &copied)
+		}
+	}
+	return groups, len(groups), nil
+}
+
+func (r *fakeSCIMRepository) GetGroup(ctx context.Context, tenantID, id uuid.UUID) (*models.SCIMGroup, error) {
+	group, ok := r.groups[id]
+	if !ok || group.TenantID != tenantID {
+		return nil, fmt.Errorf("group not found")
+	}
+	copied := *group
+	return &copied, nil
+}
+
+func (r *fakeSCIMRepository) GetGroupByName(ctx context.Context, tenantID uuid.UUID, displayName string) (*models.SCIMGroup, error) {
+	for _, group := range r.groups {
+		if group.TenantID == tenantID && strings.EqualFold(group.DisplayName, displayName) {
+			copied := *group
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("group not found")
+}
+
+func (r *fakeSCIMRepository) CreateGroup(ctx context.Context, group *models.SCIMGroup) error {
+	group.ID = uuid.New()
+	copied := *group
+	r.groups[group.ID] = &copied
+	return nil
+}
+
+func (r *fakeSCIMRepository) UpdateGroup(ctx context.Context, group *models.SCIMGroup) error {
+	if _, ok := r.groups[group.ID]; !ok {
+		return fmt.Errorf("group not found")
+	}
+	copied := *group
+	r.groups[group.ID] = &copied
+	return nil
+}
+
+func (r *fakeSCIMRepository) DeleteGroup(ctx context.Context, tenantID, id uuid.UUID) error {
+	if _, err := r.GetGroup(ctx, tenantID, id); err != nil {
+		return err
+	}
+	delete(r.groups, id)
+	return nil
+}
+
+func (r *fakeSCIMRepository) GetUserGroups(ctx context.Context, tenantID, userID uuid.UUID) ([]*models.SCIMGroup, error) {
+	var groups []*models.SCIMGroup
+	for _, group := range r.groups {
+		for _, memberID := range group.MemberIDs {
+			if group.TenantID == tenantID && memberID == userID {
+				copied := *group
+				groups = append(groups, &copied)
+			}
+		}
+	}
+	return groups, nil
+}
+
+type fakeHRMClient struct {
+	departments map[string]int
+	employees   []*HRMEmployee
+}
+
+func (c *fakeHRMClient) EmployeeExists(ctx context.Context, tenantID uuid.UUID, email string) (bool, error) {
+	for _, employee := range c.employees {
+		if employee.Email == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *fakeHRMClient) FindDepartmentID(ctx context.Context, tenantID uuid.UUID, name string) (int, error) {
+	id, ok := c.departments[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("department %s not found", name)
+	}
+	return id, nil
+}
+
+func (c *fakeHRMClient) CreateEmployee(ctx context.Context, tenantID uuid.UUID, employee *HRMEmployee) error {
+	c.employees = append(c.employees, employee)
+	return nil
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// SSOLoginResult is returned after a successful OIDC or SAML login
+type SSOLoginResult struct {
+	Tokens      *models.TokenResponse
+	RedirectURI *string
+	Provisioned bool
+}
+
+// ssoIdentity is a user authenticated by an external identity provider
+type ssoIdentity struct {
+	TenantID  uuid.UUID
+	Provider  string
+	Subject   string
+	Email     string
+	FirstName string
+	LastName  string
+}
+
+// resolveSSOUser finds the user linked to the external identity, links an existing
+// user by email, or provisions a new one with the given role when jit is enabled
+func resolveSSOUser(
+	ctx context.Context,
+	userRepo repositories.UserRepository,
+	identityRepo repositories.IdentityRepository,
+	tenants TenantClient,
+	identity *ssoIdentity,
+	jit bool,
+	role string,
+) (*models.User, bool, error) {
+	if !isValidSSOEmail(identity.Email) {
+		return nil, false, fmt.Errorf("identity provider sent an invalid email address %q", identity.Email)
+	}
+
+	linked, err := identityRepo.Get(ctx, identity.TenantID, identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := userRepo.GetByIDAndTenant(ctx, linked.UserID, identity.TenantID)
+		if err != nil {
+			return nil, false, fmt.Errorf("linked user not found: %w", err)
+		}
+
+		err = identityRepo.UpdateLastLogin(ctx, linked.ID, identity.Email)
+		if err != nil {
+			fmt.Printf("Failed to update identity %s: %v\n", linked.ID, err)
+		}
+
+		return user, false, nil
+	}
+
+	provisioned := false
+	user, err := userRepo.GetByEmailAndTenant(ctx, identity.Email, identity.TenantID)
+	if err != nil {
+		if !jit {
+			return nil, false, fmt.Errorf("no account exists for %s in this tenant", identity.Email)
+		}
+
+		// A provisioned user takes a seat of the tenant's plan
+		if err := checkSeats(ctx, tenants, identity.TenantID, 1); err != nil {
+			return nil, false, err
+		}
+
+		user, err = provisionSSOUser(ctx, userRepo, identity, role)
+		if err != nil {
+			return nil, false, err
+		}
+		provisioned = true
+	}
+
+	err = identityRepo.Create(ctx, &models.UserIdentity{
+		UserID:   user.ID,
+		TenantID: identity.TenantID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	return user, provisioned, nil
+}
+
+func provisionSSOUser(ctx context.Context, userRepo repositories.UserRepository, identity *ssoIdentity, role string) (*models.User, error) {
+	// An account with the address in another tenant is one person; a second
+	// row would split them. They join this tenant with that account instead.
+	if _, err := userRepo.GetByEmail(ctx, identity.Email); err == nil {
+		return nil, fmt.Errorf("%s already has an account in another organization, it must join this organization before signing in with single sign-on", identity.Email)
+	}
+
+	if role == "" {
+		role = models.RoleUser
+	}
+	if !isSSOAssignableRole(role) {
+		return nil, fmt.Errorf("invalid default role %s for provisioned users", role)
+	}
+
+	// SSO users get an unusable random password
+	randomPassword, err := generateSecureToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+
+	hashedPassword, err := hashPassword(randomPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	firstName := identity.FirstName
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	user := &models.User{
+		TenantID:  identity.TenantID,
+		Email:     identity.Email,
+		Password:  hashedPassword,
+		FirstName: firstName,
+		LastName:  identity.LastName,
+		Role:      role,
+	}
+
+	err = userRepo.Create(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+
+	// The identity provider already verified the email address
+	user.IsVerified = true
+	err = userRepo.Update(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify provisioned user: %w", err)
+	}
+
+	return user, nil
+}
+
+// isSSOAssignableRole reports whether identity providers may grant the role.
+// System roles such as super_admin are never assigned through SSO.
+func isSSOAssignableRole(role string) bool {
+	return role == models.RoleAdmin || role == models.RoleManager || role == models.RoleUser
+}
+
+// roleRank orders the roles identity providers may grant, higher is more privileged
+func roleRank(role string) int {
+	switch role {
+	case models.RoleAdmin:
+		return 3
+	case models.RoleManager:
+		return 2
+	case models.RoleUser:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// normalizeEmail lowercases and trims an email address from an identity provider
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// isValidSSOEmail reports whether an identity provider sent a plain email
+// address, without a display name, that users can be matched on
+func isValidSSOEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return false
+	}
+	local, domain, _ := strings.Cut(email, "@")
+	return local != "" && domain != ""
+}
+
+func containsString(values []string, value string, equal func(a, b string) bool) bool {
+	for _, v := range values {
+		if equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func stringsEqual(a, b string) bool {
+	return a == b
+}
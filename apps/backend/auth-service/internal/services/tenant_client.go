@@ -0,0 +1,181 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/google/uuid"
+)
+
+// ErrQuotaExceeded is returned when adding a user would go over the seats of
+// the tenant's plan
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// serviceTokenTTL is how long the service tokens of auth-service's calls to
+// tenant-service are valid
+const serviceTokenTTL = time.Minute
+
+// TenantClient reads platform-wide data from tenant-service and provisions
+// tenants through it
+type TenantClient interface {
+	GetStats(ctx context.Context, days int) (*models.TenantStats, error)
+	// Provision provisions a tenant. It returns an error unless provisioning
+	// completed; a failed provisioning has been rolled back.
+	Provision(ctx context.Context, req *models.ProvisionTenantRequest) (*models.TenantProvisioning, error)
+	// CheckQuota asks whether the tenant may add amount of a resource
+	CheckQuota(ctx context.Context, tenantID uuid.UUID, req *models.QuotaCheckRequest) (*models.QuotaCheck, error)
+}
+
+type tenantClient struct {
+	cfg        *config.Config
+	baseURL    string
+	httpClient *http.Client
+	// provisionClient waits longer: provisioning calls back into
+	// auth-service and rolls back on failure before it answers
+	provisionClient *http.Client
+}
+
+func NewTenantClient(cfg *config.Config) TenantClient {
+	return &tenantClient{
+		cfg:     cfg,
+		baseURL: strings.TrimSuffix(cfg.TenantServiceURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		provisionClient: &http.Client{
+			Timeout: 90 * time.Second,
+		},
+	}
+}
+
+func (c *tenantClient) GetStats(ctx context.Context, days int) (*models.TenantStats, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/stats?days="+strconv.Itoa(days), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenant-service returned status %d", resp.StatusCode)
+	}
+
+	var stats models.TenantStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("invalid stats response: %w", err)
+	}
+
+	return &stats, nil
+}
+
+func (c *tenantClient) Provision(ctx context.Context, provisionReq *models.ProvisionTenantRequest) (*models.TenantProvisioning, error) {
+	payload, err := json.Marshal(provisionReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/provisioning", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.provisionClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var body struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Message != "" {
+			return nil, fmt.Errorf("failed to create organization: %s", body.Message)
+		}
+		return nil, fmt.Errorf("failed to create organization: tenant-service returned status %d", resp.StatusCode)
+	}
+
+	var provisioning models.TenantProvisioning
+	if err := json.NewDecoder(resp.Body).Decode(&provisioning); err != nil {
+		return nil, fmt.Errorf("invalid provisioning response: %w", err)
+	}
+	if provisioning.TenantID == nil {
+		return nil, fmt.Errorf("invalid provisioning response: no tenant")
+	}
+
+	return &provisioning, nil
+}
+
+func (c *tenantClient) CheckQuota(ctx context.Context, tenantID uuid.UUID, checkReq *models.QuotaCheckRequest) (*models.QuotaCheck, error) {
+	payload, err := json.Marshal(checkReq)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sharedmiddleware.NewServiceToken(c.cfg, "auth-service", tenantID.String(), nil, serviceTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/tenants/"+tenantID.String()+"/quota/check", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenant-service returned status %d", resp.StatusCode)
+	}
+
+	var check models.QuotaCheck
+	if err := json.NewDecoder(resp.Body).Decode(&check); err != nil {
+		return nil, fmt.Errorf("invalid quota response: %w", err)
+	}
+
+	return &check, nil
+}
+
+// checkSeats returns ErrQuotaExceeded if the tenant's plan has no seat left
+// for seats more users. Quotas are a billing limit, not a security control,
+// so users are let in when tenant-service cannot answer.
+func checkSeats(ctx context.Context, tenants TenantClient, tenantID uuid.UUID, seats int64) error {
+	check, err := tenants.CheckQuota(ctx, tenantID, &models.QuotaCheckRequest{
+		Resource: models.QuotaResourceUsers,
+		Amount:   seats,
+	})
+	if err != nil {
+		log.Printf("Failed to check user quota of tenant %s: %v", tenantID, err)
+		return nil
+	}
+	if !check.Allowed {
+		if check.Limit == nil {
+			return ErrQuotaExceeded
+		}
+		return fmt.Errorf("%w: your plan allows %d users", ErrQuotaExceeded, *check.Limit)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type membershipFixture struct {
+	authService AuthService
+	jwtService  JWTService
+	userRepo    *fakeUserRepository
+	tenantRepo  *fakeTenantRepository
+	tenants     *fakeTenantClient
+	user        *models.User
+	home, other uuid.UUID
+}
+
+func newMembershipFixture(t *testing.T) *membershipFixture {
+	t.Helper()
+
+	cfg := &config.Config{
+		JWTSecret:           "test-secret",
+		JWTExpiresIn:        "1h",
+		JWTRefreshExpiresIn: "24h",
+	}
+	f := &membershipFixture{
+		jwtService: NewJWTService(cfg),
+		userRepo:   newFakeUserRepository(),
+		home:       uuid.New(),
+		other:      uuid.New(),
+	}
+	f.tenantRepo = &fakeTenantRepository{tenants: map[uuid.UUID]*models.Tenant{
+		f.home:  {ID: f.home, Name: "Acme", IsActive: true},
+		f.other: {ID: f.other, Name: "Globex", IsActive: true},
+	}}
+	f.tenants = &fakeTenantClient{provision: f.provision}
+	f.authService = NewAuthService(f.userRepo, f.tenantRepo, f.userRepo, &fakeRefreshTokenRepository{}, newFakeSAMLRepository(), newFakeRoleRepository(),
+		newTestPasswordPolicyService(nil), newTestLoginProtectionService(f.userRepo), f.jwtService, f.tenants, cfg)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("Correct1Pass"), bcrypt.MinCost)
+	require.NoError(t, err)
+	f.user = &models.User{TenantID: f.home, Email: "kim@consulting.test", FirstName: "Kim", LastName: "Lee", Password: string(hash), Role: models.RoleAdmin}
+	require.NoError(t, f.userRepo.Create(context.Background(), f.user))
+
+	return f
+}
+
+// provision stands in for tenant-service, which creates the admin through
+// CreateTenantAdmin
+func (f *membershipFixture) provision(req *models.ProvisionTenantRequest) (*models.TenantProvisioning, error) {
+	tenant := &models.Tenant{Name: req.Name, IsActive: true}
+	if err := f.tenantRepo.Create(context.Background(), tenant); err != nil {
+		return nil, err
+	}
+
+	provisioning := &models.TenantProvisioning{ID: uuid.New(), TenantID: &tenant.ID, Status: "completed"}
+	if req.Admin != nil {
+		admin, err := f.authService.CreateTenantAdmin(context.Background(), tenant.ID, req.Admin)
+		if err != nil {
+			delete(f.tenantRepo.tenants, tenant.ID)
+			return nil, fmt.Errorf("failed to create organization: %w", err)
+		}
+		provisioning.AdminUserID = &admin.ID
+	}
+
+	return provisioning, nil
+}
+
+func (f *membershipFixture) claims(t *testing.T, tokens *models.TokenResponse) *UserClaims {
+	t.Helper()
+
+	token, err := f.jwtService.ValidateToken(tokens.AccessToken)
+	require.NoError(t, err)
+	claims, err := f.jwtService.ParseUserClaims(token)
+	require.NoError(t, err)
+	return claims
+}
+
+func TestLoginScopesTokenToSelectedTenant(t *testing.T) {
+	f := newMembershipFixture(t)
+	ctx := context.Background()
+	require.NoError(t, f.userRepo.AddMembership(ctx, &models.TenantMembership{UserID: f.user.ID, TenantID: f.other, Role: models.RoleUser}))
+
+	// Without a tenant the home tenant is used
+	tokens, err := f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass"})
+	require.NoError(t, err)
+	claims := f.claims(t, tokens)
+	assert.Equal(t, f.home.String(), claims.TenantID)
+	assert.Equal(t, models.RoleAdmin, claims.Role)
+	require.Len(t, tokens.Tenants, 2)
+	assert.True(t, tokens.Tenants[0].IsHome)
+
+	tokens, err = f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass", TenantID: f.other.String()})
+	require.NoError(t, err)
+	claims = f.claims(t, tokens)
+	assert.Equal(t, f.other.String(), claims.TenantID)
+	assert.Equal(t, models.RoleUser, claims.Role, "the role comes from the membership")
+	assert.NotContains(t, claims.Permissions, "*")
+
+	_, err = f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "Correct1Pass", TenantID: uuid.New().String()})
+	assert.ErrorIs(t, err, ErrNotTenantMember)
+	_, err = f.authService.Login(ctx, &models.LoginRequest{Email: f.user.Email, Password: "wrong", TenantID: uuid.New().String()})
+	assert.EqualError(t, err, "invalid credentials", "memberships are only revealed to valid credentials")
+}
+
+func TestSwitchTenantIssuesTenantScopedToken(t *testing.T) {
+	f := newMembershipFixture(t)
+	ctx := context.Background()
+
+	_, err := f.authService.SwitchTenant(ctx, f.user.ID, &models.SwitchTenantRequest{TenantID: f.other.String()})
+	assert.ErrorIs(t, err, ErrNotTenantMember)
+
+	require.NoError(t, f.userRepo.AddMembership(ctx, &models.TenantMembership{UserID: f.user.ID, TenantID: f.other, Role: models.RoleManager}))
+	tokens, err := f.authService.SwitchTenant(ctx, f.user.ID, &models.SwitchTenantRequest{TenantID: f.other.String()})
+	require.NoError(t, err)
+	claims := f.claims(t, tokens)
+	assert.Equal(t, f.other.String(), claims.TenantID)
+	assert.Equal(t, models.RoleManager, claims.Role)
+	assert.Equal(t, f.user.ID.String(), claims.UserID, "the identity stays the same")
+
+	// Inactive memberships cannot be entered
+	f.userRepo.memberships[f.user.ID][0].IsActive = false
+	_, err = f.authService.SwitchTenant(ctx, f.user.ID, &models.SwitchTenantRequest{TenantID: f.other.String()})
+	assert.ErrorIs(t, err, ErrNotTenantMember)
+}
+
+func TestRegisterWithExistingAccountJoinsTenant(t *testing.T) {
+	f := newMembershipFixture(t)
+	ctx := context.Background()
+	req := &models.RegisterRequest{Email: f.user.Email, Password: "wrong", FirstName: "Kim", LastName: "Lee", TenantID: f.other.String()}
+
+	_, err := f.authService.Register(ctx, req)
+	assert.EqualError(t, err, "user with email kim@consulting.test already exists")
+	assert.Empty(t, f.userRepo.memberships[f.user.ID])
+
+	req.Password = "Correct1Pass"
+	tokens, err := f.authService.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, f.user.ID, tokens.User.ID)
+	assert.Equal(t, f.other, tokens.User.TenantID)
+	assert.Equal(t, models.RoleUser, tokens.User.Role)
+	assert.Len(t, f.userRepo.users, 1, "no second account is created")
+
+	_, err = f.authService.Register(ctx, req)
+	assert.EqualError(t, err, "you are already a member of this organization")
+
+	// Without a tenant the account gets a new organization it administers
+	req.TenantID = ""
+	tokens, err = f.authService.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, tokens.User.Role)
+	assert.Len(t, tokens.Tenants, 3)
+	assert.Len(t, f.tenantRepo.tenants, 3)
+}
+
+func TestRegisterWithoutTenantProvisionsOrganization(t *testing.T) {
+	f := newMembershipFixture(t)
+	ctx := context.Background()
+	req := &models.RegisterRequest{Email: "ana@startup.test", Password: "Another1Pass", FirstName: "Ana", LastName: "Silva"}
+
+	tokens, err := f.authService.Register(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, tokens.User.Role)
+	assert.Len(t, f.tenantRepo.tenants, 3)
+
+	tenant, err := f.tenantRepo.GetByID(ctx, tokens.User.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, "Ana Silva's Organization", tenant.Name)
+	assert.Equal(t, tokens.User.TenantID.String(), f.claims(t, tokens).TenantID)
+
+	// A rejected password leaves neither a tenant nor an account
+	req.Email = f.user.Email + ".other"
+	req.Password = "short"
+	_, err = f.authService.Register(ctx, req)
+	require.Error(t, err)
+	assert.Len(t, f.tenantRepo.tenants, 3)
+	_, err = f.userRepo.GetByEmail(ctx, req.Email)
+	assert.Error(t, err)
+}
+
+func TestRegisterIntoTenantNeedsASeat(t *testing.T) {
+	f := newMembershipFixture(t)
+	ctx := context.Background()
+	limit := int64(5)
+	f.tenants.quota = &models.QuotaCheck{Resource: models.QuotaResourceUsers, Used: 5, Limit: &limit}
+
+	req := &models.RegisterRequest{Email: "ana@startup.test", Password: "Another1Pass", FirstName: "Ana", LastName: "Silva", TenantID: f.home.String()}
+	_, err := f.authService.Register(ctx, req)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.EqualError(t, err, "quota exceeded: your plan allows 5 users")
+	_, err = f.userRepo.GetByEmail(ctx, req.Email)
+	assert.Error(t, err, "no account is created")
+
+	// Existing accounts joining the tenant take a seat too
+	existing := &models.RegisterRequest{Email: f.user.Email, Password: "Correct1Pass", FirstName: "Kim", LastName: "Lee", TenantID: f.other.String()}
+	_, err = f.authService.Register(ctx, existing)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Empty(t, f.userRepo.memberships[f.user.ID])
+
+	// A new organization has no plan limit to check
+	req.TenantID = ""
+	_, err = f.authService.Register(ctx, req)
+	require.NoError(t, err)
+
+	// Quotas do not lock users out while tenant-service is unavailable
+	f.tenants.quota = nil
+	f.tenants.err = fmt.Errorf("connection refused")
+	_, err = f.authService.Register(ctx, existing)
+	require.NoError(t, err)
+}
+
+func TestDeleteTenantUserIsScopedToTenant(t *testing.T) {
+	f := newMembershipFixture(t)
+	ctx := context.Background()
+
+	err := f.authService.DeleteTenantUser(ctx, f.other, f.user.ID)
+	assert.EqualError(t, err, "user does not belong to this tenant")
+	_, err = f.userRepo.GetByID(ctx, f.user.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, f.authService.DeleteTenantUser(ctx, f.home, f.user.ID))
+	_, err = f.userRepo.GetByID(ctx, f.user.ID)
+	assert.Error(t, err)
+	assert.NoError(t, f.authService.DeleteTenantUser(ctx, f.home, f.user.ID), "deleting twice succeeds")
+}
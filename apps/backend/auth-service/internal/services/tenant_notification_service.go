@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"zplus-saas/apps/backend/auth-service/internal/models"
+	"zplus-saas/apps/backend/auth-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// tenantNoticeTemplates are the emails other services may send to a tenant's
+// admins. Anything else, e.g. a password reset, carries a token only
+// auth-service may issue.
+var tenantNoticeTemplates = map[string]bool{
+	models.EmailTemplatePaymentFailed:     true,
+	models.EmailTemplateTenantSuspended:   true,
+	models.EmailTemplateTenantReactivated: true,
+}
+
+// TenantNotificationService emails a tenant's admins on behalf of other
+// services, e.g. the billing reminders of tenant-service
+type TenantNotificationService interface {
+	// NotifyTenantAdmins queues the notice for every active admin of the
+	// tenant and returns how many were notified
+	NotifyTenantAdmins(ctx context.Context, tenantID uuid.UUID, req *models.TenantNotificationRequest) (int, error)
+}
+
+type tenantNotificationService struct {
+	userRepo repositories.UserRepository
+	email    EmailService
+}
+
+func NewTenantNotificationService(userRepo repositories.UserRepository, email EmailService) TenantNotificationService {
+	return &tenantNotificationService{
+		userRepo: userRepo,
+		email:    email,
+	}
+}
+
+func (s *tenantNotificationService) NotifyTenantAdmins(ctx context.Context, tenantID uuid.UUID, req *models.TenantNotificationRequest) (int, error) {
+	if !tenantNoticeTemplates[req.Template] {
+		return 0, fmt.Errorf("unknown notification template %q", req.Template)
+	}
+
+	admins, err := s.userRepo.ListTenantAdmins(ctx, tenantID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tenant admins: %w", err)
+	}
+
+	notified := 0
+	for _, admin := range admins {
+		if err := s.email.SendTenantNoticeEmail(ctx, admin, req.Template, req.Params); err != nil {
+			log.Printf("Failed to queue %s notice for user %s: %v", req.Template, admin.ID, err)
+			continue
+		}
+		notified++
+	}
+
+	if notified == 0 && len(admins) > 0 {
+		return 0, fmt.Errorf("failed to queue %s notice", req.Template)
+	}
+	return notified, nil
+}
@@ -0,0 +1,33 @@
+-- Migration: 003_oidc_sso.sql
+-- Description: OIDC relying party support (social and enterprise login)
+
+-- Pending authorization requests (state, nonce and PKCE verifier per login attempt)
+CREATE TABLE IF NOT EXISTS oidc_auth_states (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    state VARCHAR(255) NOT NULL UNIQUE,
+    nonce VARCHAR(255) NOT NULL,
+    code_verifier VARCHAR(255) NOT NULL,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    provider VARCHAR(100) NOT NULL,
+    redirect_uri TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_oidc_auth_states_expires_at ON oidc_auth_states(expires_at);
+
+-- External identities linked to local users
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    provider VARCHAR(100) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    last_login_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE(tenant_id, provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
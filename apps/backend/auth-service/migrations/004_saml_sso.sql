@@ -0,0 +1,35 @@
+-- Migration: 004_saml_sso.sql
+-- Description: SAML 2.0 single sign-on for enterprise tenants
+
+-- One SAML identity provider per tenant; the tenant is its own service provider
+CREATE TABLE IF NOT EXISTS saml_connections (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL UNIQUE REFERENCES tenants(id) ON DELETE CASCADE,
+    idp_entity_id VARCHAR(500) NOT NULL,
+    idp_metadata TEXT NOT NULL,
+    sp_private_key TEXT NOT NULL,
+    sp_certificate TEXT NOT NULL,
+    attribute_mapping JSONB NOT NULL DEFAULT '{}',
+    role_mapping JSONB NOT NULL DEFAULT '{}',
+    default_role VARCHAR(50) NOT NULL DEFAULT 'user',
+    jit_provisioning BOOLEAN NOT NULL DEFAULT FALSE,
+    sso_only BOOLEAN NOT NULL DEFAULT FALSE,
+    allow_idp_initiated BOOLEAN NOT NULL DEFAULT FALSE,
+    allowed_redirect_uris JSONB NOT NULL DEFAULT '[]',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Pending SP-initiated authentication requests, keyed by RelayState
+CREATE TABLE IF NOT EXISTS saml_auth_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    request_id VARCHAR(255) NOT NULL UNIQUE,
+    relay_state VARCHAR(255) NOT NULL UNIQUE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    redirect_uri TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_saml_auth_requests_expires_at ON saml_auth_requests(expires_at);
@@ -0,0 +1,44 @@
+-- Migration: 006_rbac.sql
+-- Description: Permission-based roles (built-in system roles and per-tenant custom roles)
+
+-- Roles are named sets of permission strings such as "crm.lead.write".
+-- System roles (tenant_id IS NULL) mirror users.role and cannot be edited;
+-- tenants define additional roles and grant them through user_roles.
+CREATE TABLE IF NOT EXISTS roles (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    display_name VARCHAR(100) NOT NULL,
+    description TEXT,
+    permissions JSONB NOT NULL DEFAULT '[]',
+    is_system BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_roles_tenant_name ON roles (COALESCE(tenant_id, '00000000-0000-0000-0000-000000000000'::uuid), name);
+CREATE INDEX idx_roles_tenant_id ON roles(tenant_id);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, role_id)
+);
+
+CREATE INDEX idx_user_roles_role_id ON user_roles(role_id);
+
+CREATE TRIGGER update_roles_updated_at BEFORE UPDATE ON roles
+    FOR EACH ROW EXECUTE PROCEDURE update_updated_at_column();
+
+-- Built-in roles. Platform-level endpoints keep checking the super_admin role
+-- itself, so "*" on the tenant admin role only covers its own tenant.
+INSERT INTO roles (tenant_id, name, display_name, description, permissions, is_system) VALUES
+(NULL, 'super_admin', 'Super Admin', 'Full access to the platform', '["*"]', true),
+(NULL, 'admin', 'Admin', 'Full access to the tenant', '["*"]', true),
+(NULL, 'manager', 'Manager', 'Manages day-to-day operations of the enabled modules',
+ '["users.read", "roles.read", "crm.*", "hrm.employee.read", "hrm.department.read", "hrm.leave.*", "pos.*", "lms.*", "checkin.*", "payment.transaction.read", "accounting.report.read", "ecommerce.*"]', true),
+(NULL, 'user', 'User', 'Standard access to the enabled modules',
+ '["crm.lead.read", "crm.customer.read", "crm.opportunity.read", "hrm.employee.read", "hrm.department.read", "hrm.leave.read", "hrm.leave.write", "pos.sale.read", "pos.sale.write", "pos.product.read", "lms.course.read", "lms.enrollment.read", "checkin.attendance.read", "checkin.attendance.write", "ecommerce.product.read", "ecommerce.order.read"]', true)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,11 @@
+-- Migration: 007_data_scopes.sql
+-- Description: Record-level data scopes for the built-in manager role
+
+-- Leads, opportunities and employees are limited to the caller's own records
+-- unless a role grants "<resource>.scope.team" or "<resource>.scope.tenant".
+-- Managers see their team's records; "crm.*" would also have granted
+-- tenant-wide scope, so CRM is now listed explicitly.
+UPDATE roles
+SET permissions = '["users.read", "roles.read", "crm.lead.read", "crm.lead.write", "crm.lead.delete", "crm.lead.scope.team", "crm.customer.read", "crm.customer.write", "crm.customer.delete", "crm.opportunity.read", "crm.opportunity.write", "crm.opportunity.scope.team", "hrm.employee.read", "hrm.employee.scope.team", "hrm.employee.emergency.read", "hrm.department.read", "hrm.leave.*", "pos.*", "lms.*", "checkin.*", "payment.transaction.read", "accounting.report.read", "ecommerce.*"]',
+    updated_at = NOW()
+WHERE tenant_id IS NULL AND name = 'manager';
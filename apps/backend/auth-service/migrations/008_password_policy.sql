@@ -0,0 +1,20 @@
+-- Migration: 008_password_policy.sql
+-- Description: Password history and age tracking for tenant password policies
+
+-- When the current password was set; passwords older than the tenant's
+-- maxAgeDays must be rotated at the next login
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- Hashes of previously used passwords, checked against the tenant's historyCount
+CREATE TABLE IF NOT EXISTS password_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_password_history_user_id ON password_history(user_id, created_at DESC);
+
+-- Seed the history with each user's current password
+INSERT INTO password_history (user_id, password_hash, created_at)
+SELECT id, password_hash, NOW() FROM users;
@@ -0,0 +1,31 @@
+-- Migration: 010_tenant_memberships.sql
+-- Description: Tenant memberships, so one user identity can belong to several tenants
+
+-- users.tenant_id and users.role stay as the user's home tenant and the role
+-- there; every tenant the user belongs to, the home tenant included, has a
+-- membership row carrying the role in that tenant. Access tokens are scoped
+-- to one membership at a time.
+CREATE TABLE IF NOT EXISTS tenant_memberships (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    role VARCHAR(50) NOT NULL DEFAULT 'user' CHECK (role IN ('super_admin', 'admin', 'manager', 'user')),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (user_id, tenant_id)
+);
+
+CREATE INDEX idx_tenant_memberships_tenant_id ON tenant_memberships(tenant_id);
+
+CREATE TRIGGER update_tenant_memberships_updated_at BEFORE UPDATE ON tenant_memberships
+    FOR EACH ROW EXECUTE PROCEDURE update_updated_at_column();
+
+-- Existing users become members of their home tenant. Accounts that were
+-- created per tenant with the same email are left as separate identities;
+-- sign-in by email resolves to the oldest one.
+INSERT INTO tenant_memberships (user_id, tenant_id, role, is_active, created_at)
+SELECT id, tenant_id, role, true, created_at
+FROM users
+WHERE tenant_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,32 @@
+-- Migration: 011_email_outbox.sql
+-- Description: Outbox for transactional emails, delivered and retried by a background worker
+
+-- Emails are rendered when they are queued, so a retry sends exactly what the
+-- request produced even if branding or translations change in between.
+-- While a worker holds a message it is 'sending' and next_attempt_at is the
+-- end of its lease; a message whose lease ran out is picked up again.
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    template VARCHAR(50) NOT NULL,
+    language VARCHAR(10) NOT NULL DEFAULT 'en',
+    from_address VARCHAR(255) NOT NULL,
+    to_address VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    text_body TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 8,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    sent_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_email_outbox_due ON email_outbox(next_attempt_at) WHERE status IN ('pending', 'sending');
+CREATE INDEX idx_email_outbox_tenant_created ON email_outbox(tenant_id, created_at DESC);
+
+CREATE TRIGGER update_email_outbox_updated_at BEFORE UPDATE ON email_outbox
+    FOR EACH ROW EXECUTE PROCEDURE update_updated_at_column();
@@ -0,0 +1,34 @@
+-- Migration: 013_data_subject_requests.sql
+-- Description: GDPR data subject requests (export and erasure), processed by a background worker
+
+-- One row per request. The subject is a user of the tenant; records in other
+-- services are matched by the user's ID or email. subject_email is cleared
+-- once an erasure completes so the request itself keeps no personal data.
+-- While a worker holds a request it is 'running' and lease_until is the end
+-- of its lease; a request whose lease ran out is picked up again.
+CREATE TABLE IF NOT EXISTS data_subject_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    subject_user_id UUID NOT NULL,
+    subject_email VARCHAR(255),
+    type VARCHAR(20) NOT NULL CHECK (type IN ('export', 'erase')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    reason TEXT NOT NULL DEFAULT '',
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lease_until TIMESTAMPTZ,
+    result JSONB NOT NULL DEFAULT '{}',
+    last_error TEXT,
+    archive BYTEA,
+    archive_expires_at TIMESTAMPTZ,
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_data_subject_requests_tenant_created ON data_subject_requests(tenant_id, created_at DESC);
+CREATE INDEX idx_data_subject_requests_due ON data_subject_requests(created_at) WHERE status IN ('pending', 'running');
+
+CREATE TRIGGER update_data_subject_requests_updated_at BEFORE UPDATE ON data_subject_requests
+    FOR EACH ROW EXECUTE PROCEDURE update_updated_at_column();
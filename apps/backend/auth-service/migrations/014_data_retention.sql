@@ -0,0 +1,49 @@
+-- Migration: 014_data_retention.sql
+-- Description: Data retention per data class, legal holds and retention run history
+
+-- Per-class overrides of tenant_configurations.data_retention_days. A class
+-- without a row uses the tenant's default.
+CREATE TABLE IF NOT EXISTS retention_policies (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    data_class VARCHAR(50) NOT NULL,
+    retention_days INTEGER NOT NULL CHECK (retention_days > 0),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, data_class)
+);
+
+-- A legal hold exempts data from retention until it is released. Without an
+-- entity it covers the whole tenant; without a data class it covers every
+-- class. entity_id is text because services key entities by integer or UUID.
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    data_class VARCHAR(50),
+    entity_type VARCHAR(50),
+    entity_id VARCHAR(255),
+    reason TEXT NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    released_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMPTZ,
+
+    CONSTRAINT chk_legal_hold_entity CHECK ((entity_type IS NULL) = (entity_id IS NULL))
+);
+
+CREATE INDEX idx_legal_holds_active ON legal_holds(tenant_id, entity_type, entity_id) WHERE released_at IS NULL;
+
+-- One row per tenant per retention pass, or per dry run. report holds, per
+-- data class, the policy applied and the rows removed (or that would be).
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    dry_run BOOLEAN NOT NULL DEFAULT false,
+    report JSONB NOT NULL DEFAULT '{}',
+    total_removed BIGINT NOT NULL DEFAULT 0,
+    triggered_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_retention_runs_tenant_started ON retention_runs(tenant_id, started_at DESC);
+CREATE INDEX idx_retention_runs_started ON retention_runs(started_at DESC) WHERE dry_run = false;
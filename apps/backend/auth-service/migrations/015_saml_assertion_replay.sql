@@ -0,0 +1,15 @@
+-- Migration: 015_saml_assertion_replay.sql
+-- Description: Remember consumed SAML assertions so a captured response cannot be replayed
+
+-- IdP-initiated responses answer no request of ours, so the assertion ID is
+-- the only thing tying them to a single use. Rows are kept until the
+-- assertion itself expires, after which the response is rejected anyway.
+CREATE TABLE IF NOT EXISTS saml_consumed_assertions (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    assertion_id VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (tenant_id, assertion_id)
+);
+
+CREATE INDEX idx_saml_consumed_assertions_expires_at ON saml_consumed_assertions(expires_at);
@@ -20,6 +20,7 @@ import (
 	"zplus-saas/apps/backend/shared/config"
 	"zplus-saas/apps/backend/shared/database"
 	"zplus-saas/apps/backend/shared/middleware"
+	"zplus-saas/apps/backend/shared/modulehooks"
 )
 
 func main() {
@@ -37,11 +38,13 @@ func main() {
 	customerRepo := repositories.NewCustomerRepository(db)
 	leadRepo := repositories.NewLeadRepository(db)
 	opportunityRepo := repositories.NewOpportunityRepository(db)
+	moduleRepo := repositories.NewModuleRepository(db)
 
 	// Initialize services
 	customerService := services.NewCustomerService(customerRepo)
 	leadService := services.NewLeadService(leadRepo)
 	opportunityService := services.NewOpportunityService(opportunityRepo)
+	moduleHooks := services.NewModuleHooks(moduleRepo)
 
 	// Initialize handlers
 	customerHandler := handlers.NewCustomerHandler(customerService)
@@ -83,12 +86,17 @@ func main() {
 		})
 	})
 
-	// Setup routes
-	api := app.Group("/api/v1")
+	// Setup routes. JWTAuth supplies the user, tenant and permissions that
+	// record-level scoping is based on. Tenants that disabled the module
+	// are turned away.
+	api := app.Group("/api/v1", middleware.JWTAuth(cfg), modulehooks.RequireEnabled(moduleRepo, "CRM"))
 	routes.SetupCustomerRoutes(api, customerHandler)
 	routes.SetupLeadRoutes(api, leadHandler)
 	routes.SetupOpportunityRoutes(api, opportunityHandler)
 
+	// Module lifecycle hooks, run by tenant-service
+	app.Post(modulehooks.Path, middleware.JWTAuth(cfg), middleware.RequireService(), modulehooks.Endpoint(moduleHooks))
+
 	// Start server in goroutine
 	go func() {
 		port := cfg.CRMServicePort
@@ -19,7 +19,7 @@ func NewCustomerHandler(service *services.CustomerService) *CustomerHandler {
 
 // CreateCustomer creates a new customer
 func (h *CustomerHandler) CreateCustomer(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -52,7 +52,7 @@ func (h *CustomerHandler) CreateCustomer(c *fiber.Ctx) error {
 
 // GetCustomer gets a customer by ID
 func (h *CustomerHandler) GetCustomer(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -85,7 +85,7 @@ func (h *CustomerHandler) GetCustomer(c *fiber.Ctx) error {
 
 // GetCustomers gets all customers with pagination
 func (h *CustomerHandler) GetCustomers(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -117,7 +117,7 @@ func (h *CustomerHandler) GetCustomers(c *fiber.Ctx) error {
 
 // UpdateCustomer updates a customer
 func (h *CustomerHandler) UpdateCustomer(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -159,7 +159,7 @@ func (h *CustomerHandler) UpdateCustomer(c *fiber.Ctx) error {
 
 // DeleteCustomer deletes a customer
 func (h *CustomerHandler) DeleteCustomer(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -192,7 +192,7 @@ func (h *CustomerHandler) DeleteCustomer(c *fiber.Ctx) error {
 
 // SearchCustomers searches customers
 func (h *CustomerHandler) SearchCustomers(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -232,7 +232,7 @@ func (h *CustomerHandler) SearchCustomers(c *fiber.Ctx) error {
 
 // GetCustomerStats gets customer statistics
 func (h *CustomerHandler) GetCustomerStats(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -5,6 +5,7 @@ import (
 
 	"zplus-saas/apps/backend/crm-service/internal/models"
 	"zplus-saas/apps/backend/crm-service/internal/services"
+	"zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -19,7 +20,7 @@ func NewLeadHandler(service *services.LeadService) *LeadHandler {
 
 // CreateLead creates a new lead
 func (h *LeadHandler) CreateLead(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -35,7 +36,7 @@ func (h *LeadHandler) CreateLead(c *fiber.Ctx) error {
 		})
 	}
 
-	lead, err := h.service.CreateLead(tenantID, &req)
+	lead, err := h.service.CreateLead(tenantID, middleware.CurrentAccess(c, "crm.lead"), &req)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -52,7 +53,7 @@ func (h *LeadHandler) CreateLead(c *fiber.Ctx) error {
 
 // GetLead gets a lead by ID
 func (h *LeadHandler) GetLead(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -69,7 +70,7 @@ func (h *LeadHandler) GetLead(c *fiber.Ctx) error {
 		})
 	}
 
-	lead, err := h.service.GetLead(tenantID, id)
+	lead, err := h.service.GetLead(tenantID, middleware.CurrentAccess(c, "crm.lead"), id)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error":   true,
@@ -85,7 +86,7 @@ func (h *LeadHandler) GetLead(c *fiber.Ctx) error {
 
 // GetLeads gets all leads with pagination
 func (h *LeadHandler) GetLeads(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -96,7 +97,7 @@ func (h *LeadHandler) GetLeads(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 
-	leads, total, err := h.service.GetLeads(tenantID, page, limit)
+	leads, total, err := h.service.GetLeads(tenantID, middleware.CurrentAccess(c, "crm.lead"), page, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -117,7 +118,7 @@ func (h *LeadHandler) GetLeads(c *fiber.Ctx) error {
 
 // UpdateLead updates a lead
 func (h *LeadHandler) UpdateLead(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -142,7 +143,7 @@ func (h *LeadHandler) UpdateLead(c *fiber.Ctx) error {
 		})
 	}
 
-	lead, err := h.service.UpdateLead(tenantID, id, &req)
+	lead, err := h.service.UpdateLead(tenantID, middleware.CurrentAccess(c, "crm.lead"), id, &req)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -159,7 +160,7 @@ func (h *LeadHandler) UpdateLead(c *fiber.Ctx) error {
 
 // DeleteLead deletes a lead
 func (h *LeadHandler) DeleteLead(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -176,7 +177,7 @@ func (h *LeadHandler) DeleteLead(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.DeleteLead(tenantID, id)
+	err = h.service.DeleteLead(tenantID, middleware.CurrentAccess(c, "crm.lead"), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -192,7 +193,7 @@ func (h *LeadHandler) DeleteLead(c *fiber.Ctx) error {
 
 // ConvertLead converts a lead to customer
 func (h *LeadHandler) ConvertLead(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -209,7 +210,7 @@ func (h *LeadHandler) ConvertLead(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.ConvertLead(tenantID, id)
+	err = h.service.ConvertLead(tenantID, middleware.CurrentAccess(c, "crm.lead"), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -225,7 +226,7 @@ func (h *LeadHandler) ConvertLead(c *fiber.Ctx) error {
 
 // GetLeadsByStatus gets leads by status
 func (h *LeadHandler) GetLeadsByStatus(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -237,7 +238,7 @@ func (h *LeadHandler) GetLeadsByStatus(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 
-	leads, err := h.service.GetLeadsByStatus(tenantID, status, page, limit)
+	leads, err := h.service.GetLeadsByStatus(tenantID, status, middleware.CurrentAccess(c, "crm.lead"), page, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -258,7 +259,7 @@ func (h *LeadHandler) GetLeadsByStatus(c *fiber.Ctx) error {
 
 // ScoreLead updates lead score
 func (h *LeadHandler) ScoreLead(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -285,7 +286,7 @@ func (h *LeadHandler) ScoreLead(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.ScoreLead(tenantID, id, req.Score)
+	err = h.service.ScoreLead(tenantID, middleware.CurrentAccess(c, "crm.lead"), id, req.Score)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -301,7 +302,7 @@ func (h *LeadHandler) ScoreLead(c *fiber.Ctx) error {
 
 // GetLeadStats gets lead statistics
 func (h *LeadHandler) GetLeadStats(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -309,7 +310,7 @@ func (h *LeadHandler) GetLeadStats(c *fiber.Ctx) error {
 		})
 	}
 
-	stats, err := h.service.GetLeadStats(tenantID)
+	stats, err := h.service.GetLeadStats(tenantID, middleware.CurrentAccess(c, "crm.lead"))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
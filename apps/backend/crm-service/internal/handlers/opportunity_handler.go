@@ -5,6 +5,7 @@ import (
 
 	"zplus-saas/apps/backend/crm-service/internal/models"
 	"zplus-saas/apps/backend/crm-service/internal/services"
+	"zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -19,7 +20,7 @@ func NewOpportunityHandler(service *services.OpportunityService) *OpportunityHan
 
 // CreateOpportunity creates a new opportunity
 func (h *OpportunityHandler) CreateOpportunity(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -35,7 +36,7 @@ func (h *OpportunityHandler) CreateOpportunity(c *fiber.Ctx) error {
 		})
 	}
 
-	opportunity, err := h.service.CreateOpportunity(tenantID, &req)
+	opportunity, err := h.service.CreateOpportunity(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), &req)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -52,7 +53,7 @@ func (h *OpportunityHandler) CreateOpportunity(c *fiber.Ctx) error {
 
 // GetOpportunity gets an opportunity by ID
 func (h *OpportunityHandler) GetOpportunity(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -69,7 +70,7 @@ func (h *OpportunityHandler) GetOpportunity(c *fiber.Ctx) error {
 		})
 	}
 
-	opportunity, err := h.service.GetOpportunity(tenantID, id)
+	opportunity, err := h.service.GetOpportunity(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), id)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error":   true,
@@ -85,7 +86,7 @@ func (h *OpportunityHandler) GetOpportunity(c *fiber.Ctx) error {
 
 // GetOpportunities gets all opportunities with pagination
 func (h *OpportunityHandler) GetOpportunities(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -96,7 +97,7 @@ func (h *OpportunityHandler) GetOpportunities(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 
-	opportunities, total, err := h.service.GetOpportunities(tenantID, page, limit)
+	opportunities, total, err := h.service.GetOpportunities(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), page, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -117,7 +118,7 @@ func (h *OpportunityHandler) GetOpportunities(c *fiber.Ctx) error {
 
 // UpdateOpportunity updates an opportunity
 func (h *OpportunityHandler) UpdateOpportunity(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -142,7 +143,7 @@ func (h *OpportunityHandler) UpdateOpportunity(c *fiber.Ctx) error {
 		})
 	}
 
-	opportunity, err := h.service.UpdateOpportunity(tenantID, id, &req)
+	opportunity, err := h.service.UpdateOpportunity(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), id, &req)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -159,7 +160,7 @@ func (h *OpportunityHandler) UpdateOpportunity(c *fiber.Ctx) error {
 
 // DeleteOpportunity deletes an opportunity
 func (h *OpportunityHandler) DeleteOpportunity(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -176,7 +177,7 @@ func (h *OpportunityHandler) DeleteOpportunity(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.DeleteOpportunity(tenantID, id)
+	err = h.service.DeleteOpportunity(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -192,7 +193,7 @@ func (h *OpportunityHandler) DeleteOpportunity(c *fiber.Ctx) error {
 
 // CloseOpportunityWon marks an opportunity as won
 func (h *OpportunityHandler) CloseOpportunityWon(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -209,7 +210,7 @@ func (h *OpportunityHandler) CloseOpportunityWon(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.CloseOpportunityWon(tenantID, id)
+	err = h.service.CloseOpportunityWon(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -225,7 +226,7 @@ func (h *OpportunityHandler) CloseOpportunityWon(c *fiber.Ctx) error {
 
 // CloseOpportunityLost marks an opportunity as lost
 func (h *OpportunityHandler) CloseOpportunityLost(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -242,7 +243,7 @@ func (h *OpportunityHandler) CloseOpportunityLost(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.CloseOpportunityLost(tenantID, id)
+	err = h.service.CloseOpportunityLost(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -258,7 +259,7 @@ func (h *OpportunityHandler) CloseOpportunityLost(c *fiber.Ctx) error {
 
 // GetOpportunitiesByStage gets opportunities by stage
 func (h *OpportunityHandler) GetOpportunitiesByStage(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -270,7 +271,7 @@ func (h *OpportunityHandler) GetOpportunitiesByStage(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 
-	opportunities, err := h.service.GetOpportunitiesByStage(tenantID, stage, page, limit)
+	opportunities, err := h.service.GetOpportunitiesByStage(tenantID, stage, middleware.CurrentAccess(c, "crm.opportunity"), page, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -291,7 +292,7 @@ func (h *OpportunityHandler) GetOpportunitiesByStage(c *fiber.Ctx) error {
 
 // GetOpportunitiesByCustomer gets opportunities for a customer
 func (h *OpportunityHandler) GetOpportunitiesByCustomer(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -311,7 +312,7 @@ func (h *OpportunityHandler) GetOpportunitiesByCustomer(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 
-	opportunities, err := h.service.GetOpportunitiesByCustomer(tenantID, customerID, page, limit)
+	opportunities, err := h.service.GetOpportunitiesByCustomer(tenantID, middleware.CurrentAccess(c, "crm.opportunity"), customerID, page, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -332,7 +333,7 @@ func (h *OpportunityHandler) GetOpportunitiesByCustomer(c *fiber.Ctx) error {
 
 // GetOpportunityStats gets opportunity statistics
 func (h *OpportunityHandler) GetOpportunityStats(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -340,7 +341,7 @@ func (h *OpportunityHandler) GetOpportunityStats(c *fiber.Ctx) error {
 		})
 	}
 
-	stats, err := h.service.GetOpportunityStats(tenantID)
+	stats, err := h.service.GetOpportunityStats(tenantID, middleware.CurrentAccess(c, "crm.opportunity"))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -356,7 +357,7 @@ func (h *OpportunityHandler) GetOpportunityStats(c *fiber.Ctx) error {
 
 // GetSalesPipeline gets sales pipeline data
 func (h *OpportunityHandler) GetSalesPipeline(c *fiber.Ctx) error {
-	tenantID := c.Locals("tenantID").(string)
+	tenantID, _ := c.Locals("tenant_id").(string)
 	if tenantID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error":   true,
@@ -364,7 +365,7 @@ func (h *OpportunityHandler) GetSalesPipeline(c *fiber.Ctx) error {
 		})
 	}
 
-	pipeline, err := h.service.GetSalesPipeline(tenantID)
+	pipeline, err := h.service.GetSalesPipeline(tenantID, middleware.CurrentAccess(c, "crm.opportunity"))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error":   true,
@@ -37,7 +37,7 @@ type Lead struct {
 	Source      string     `json:"source" db:"source"`
 	Status      string     `json:"status" db:"status"`           // new, qualified, contacted, converted, lost
 	Score       int        `json:"score" db:"score"`             // Lead scoring (0-100)
-	AssignedTo  int        `json:"assigned_to" db:"assigned_to"` // User ID
+	AssignedTo  *string    `json:"assigned_to" db:"assigned_to"` // Owning user ID
 	Value       float64    `json:"value" db:"value"`             // Potential deal value
 	Notes       string     `json:"notes" db:"notes"`
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
@@ -57,7 +57,7 @@ type Opportunity struct {
 	Stage        string     `json:"stage" db:"stage"`             // prospecting, qualification, proposal, negotiation, closed-won, closed-lost
 	Probability  int        `json:"probability" db:"probability"` // 0-100%
 	Source       string     `json:"source" db:"source"`
-	AssignedTo   int        `json:"assigned_to" db:"assigned_to"`
+	AssignedTo   *string    `json:"assigned_to" db:"assigned_to"` // Owning user ID
 	ExpectedDate time.Time  `json:"expected_date" db:"expected_date"`
 	ClosedDate   *time.Time `json:"closed_date" db:"closed_date"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
@@ -121,7 +121,7 @@ type CreateLeadRequest struct {
 	Company    string  `json:"company"`
 	Title      string  `json:"title"`
 	Source     string  `json:"source"`
-	AssignedTo int     `json:"assigned_to"`
+	AssignedTo string  `json:"assigned_to"` // Defaults to the caller
 	Value      float64 `json:"value"`
 	Notes      string  `json:"notes"`
 }
@@ -135,7 +135,7 @@ type UpdateLeadRequest struct {
 	Source     *string  `json:"source"`
 	Status     *string  `json:"status"`
 	Score      *int     `json:"score"`
-	AssignedTo *int     `json:"assigned_to"`
+	AssignedTo *string  `json:"assigned_to"`
 	Value      *float64 `json:"value"`
 	Notes      *string  `json:"notes"`
 }
@@ -148,7 +148,7 @@ type CreateOpportunityRequest struct {
 	Value        float64 `json:"value" validate:"required"`
 	Currency     string  `json:"currency"`
 	Source       string  `json:"source"`
-	AssignedTo   int     `json:"assigned_to"`
+	AssignedTo   string  `json:"assigned_to"`                       // Defaults to the caller
 	ExpectedDate string  `json:"expected_date" validate:"required"` // ISO date format
 }
 
@@ -160,6 +160,6 @@ type UpdateOpportunityRequest struct {
 	Stage        *string  `json:"stage"`
 	Probability  *int     `json:"probability"`
 	Source       *string  `json:"source"`
-	AssignedTo   *int     `json:"assigned_to"`
+	AssignedTo   *string  `json:"assigned_to"`
 	ExpectedDate *string  `json:"expected_date"`
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"zplus-saas/apps/backend/crm-service/internal/models"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
 type LeadRepository struct {
@@ -44,17 +45,17 @@ func (r *LeadRepository) Create(lead *models.Lead) error {
 	return nil
 }
 
-// GetByID gets a lead by ID
-func (r *LeadRepository) GetByID(tenantID string, id int) (*models.Lead, error) {
+// GetByID gets a lead by ID within the caller's data scope
+func (r *LeadRepository) GetByID(tenantID string, id int, access middleware.Access) (*models.Lead, error) {
+	scope, scopeArgs := scopeCondition(access, 3)
 	query := `
 		SELECT id, tenant_id, name, email, phone, company, title, source, status, score, assigned_to, value, notes, created_at, updated_at, converted_at
 		FROM leads
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	lead := &models.Lead{}
 
-	err := r.db.QueryRow(query, tenantID, id).Scan(
+	err := r.db.QueryRow(query, append([]interface{}{tenantID, id}, scopeArgs...)...).Scan(
 		&lead.ID, &lead.TenantID, &lead.Name, &lead.Email,
 		&lead.Phone, &lead.Company, &lead.Title, &lead.Source,
 		&lead.Status, &lead.Score, &lead.AssignedTo, &lead.Value,
@@ -71,17 +72,18 @@ func (r *LeadRepository) GetByID(tenantID string, id int) (*models.Lead, error)
 	return lead, nil
 }
 
-// GetAll gets all leads for a tenant
-func (r *LeadRepository) GetAll(tenantID string, limit, offset int) ([]*models.Lead, error) {
+// GetAll gets all leads for a tenant within the caller's data scope
+func (r *LeadRepository) GetAll(tenantID string, access middleware.Access, limit, offset int) ([]*models.Lead, error) {
+	scope, scopeArgs := scopeCondition(access, 4)
 	query := `
 		SELECT id, tenant_id, name, email, phone, company, title, source, status, score, assigned_to, value, notes, created_at, updated_at, converted_at
 		FROM leads
-		WHERE tenant_id = $1
+		WHERE tenant_id = $1` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Query(query, tenantID, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get leads: %w", err)
 	}
@@ -109,23 +111,24 @@ func (r *LeadRepository) GetAll(tenantID string, limit, offset int) ([]*models.L
 	return leads, nil
 }
 
-// Update updates a lead
-func (r *LeadRepository) Update(lead *models.Lead) error {
+// Update updates a lead within the caller's data scope
+func (r *LeadRepository) Update(lead *models.Lead, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 15)
 	query := `
 		UPDATE leads
 		SET name = $3, email = $4, phone = $5, company = $6, title = $7, source = $8, status = $9, score = $10, assigned_to = $11, value = $12, notes = $13, updated_at = $14
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	lead.UpdatedAt = time.Now()
 
-	result, err := r.db.Exec(
-		query,
+	args := []interface{}{
 		lead.TenantID, lead.ID, lead.Name, lead.Email,
 		lead.Phone, lead.Company, lead.Title, lead.Source,
 		lead.Status, lead.Score, lead.AssignedTo, lead.Value,
 		lead.Notes, lead.UpdatedAt,
-	)
+	}
+
+	result, err := r.db.Exec(query, append(args, scopeArgs...)...)
 
 	if err != nil {
 		return fmt.Errorf("failed to update lead: %w", err)
@@ -143,11 +146,12 @@ func (r *LeadRepository) Update(lead *models.Lead) error {
 	return nil
 }
 
-// Delete deletes a lead
-func (r *LeadRepository) Delete(tenantID string, id int) error {
-	query := `DELETE FROM leads WHERE tenant_id = $1 AND id = $2`
+// Delete deletes a lead within the caller's data scope
+func (r *LeadRepository) Delete(tenantID string, id int, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 3)
+	query := `DELETE FROM leads WHERE tenant_id = $1 AND id = $2` + scope
 
-	result, err := r.db.Exec(query, tenantID, id)
+	result, err := r.db.Exec(query, append([]interface{}{tenantID, id}, scopeArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to delete lead: %w", err)
 	}
@@ -164,17 +168,17 @@ func (r *LeadRepository) Delete(tenantID string, id int) error {
 	return nil
 }
 
-// ConvertToCustomer marks a lead as converted
-func (r *LeadRepository) ConvertToCustomer(tenantID string, id int) error {
+// ConvertToCustomer marks a lead as converted within the caller's data scope
+func (r *LeadRepository) ConvertToCustomer(tenantID string, id int, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 4)
 	query := `
 		UPDATE leads
 		SET status = 'converted', converted_at = $3, updated_at = $3
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	now := time.Now()
 
-	result, err := r.db.Exec(query, tenantID, id, now)
+	result, err := r.db.Exec(query, append([]interface{}{tenantID, id, now}, scopeArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to convert lead: %w", err)
 	}
@@ -191,17 +195,18 @@ func (r *LeadRepository) ConvertToCustomer(tenantID string, id int) error {
 	return nil
 }
 
-// GetByStatus gets leads by status
-func (r *LeadRepository) GetByStatus(tenantID, status string, limit, offset int) ([]*models.Lead, error) {
+// GetByStatus gets leads by status within the caller's data scope
+func (r *LeadRepository) GetByStatus(tenantID, status string, access middleware.Access, limit, offset int) ([]*models.Lead, error) {
+	scope, scopeArgs := scopeCondition(access, 5)
 	query := `
 		SELECT id, tenant_id, name, email, phone, company, title, source, status, score, assigned_to, value, notes, created_at, updated_at, converted_at
 		FROM leads
-		WHERE tenant_id = $1 AND status = $2
+		WHERE tenant_id = $1 AND status = $2` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := r.db.Query(query, tenantID, status, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, status, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get leads by status: %w", err)
 	}
@@ -229,17 +234,18 @@ func (r *LeadRepository) GetByStatus(tenantID, status string, limit, offset int)
 	return leads, nil
 }
 
-// GetByAssignedUser gets leads assigned to a specific user
-func (r *LeadRepository) GetByAssignedUser(tenantID string, userID, limit, offset int) ([]*models.Lead, error) {
+// GetByAssignedUser gets leads assigned to a specific user within the caller's data scope
+func (r *LeadRepository) GetByAssignedUser(tenantID, userID string, access middleware.Access, limit, offset int) ([]*models.Lead, error) {
+	scope, scopeArgs := scopeCondition(access, 5)
 	query := `
 		SELECT id, tenant_id, name, email, phone, company, title, source, status, score, assigned_to, value, notes, created_at, updated_at, converted_at
 		FROM leads
-		WHERE tenant_id = $1 AND assigned_to = $2
+		WHERE tenant_id = $1 AND assigned_to = $2` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := r.db.Query(query, tenantID, userID, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, userID, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get leads by assigned user: %w", err)
 	}
@@ -267,12 +273,13 @@ func (r *LeadRepository) GetByAssignedUser(tenantID string, userID, limit, offse
 	return leads, nil
 }
 
-// Count gets total count of leads for a tenant
-func (r *LeadRepository) Count(tenantID string) (int, error) {
-	query := `SELECT COUNT(*) FROM leads WHERE tenant_id = $1`
+// Count gets total count of leads for a tenant within the caller's data scope
+func (r *LeadRepository) Count(tenantID string, access middleware.Access) (int, error) {
+	scope, scopeArgs := scopeCondition(access, 2)
+	query := `SELECT COUNT(*) FROM leads WHERE tenant_id = $1` + scope
 
 	var count int
-	err := r.db.QueryRow(query, tenantID).Scan(&count)
+	err := r.db.QueryRow(query, append([]interface{}{tenantID}, scopeArgs...)...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count leads: %w", err)
 	}
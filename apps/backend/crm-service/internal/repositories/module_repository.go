@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/shared/modulehooks"
+)
+
+// ModuleRepository records which tenants have the CRM module set up
+type ModuleRepository struct {
+	*modulehooks.TenantModules
+	db *sql.DB
+}
+
+func NewModuleRepository(db *sql.DB) *ModuleRepository {
+	return &ModuleRepository{
+		TenantModules: modulehooks.NewTenantModules(db, "crm_tenant_modules", seedPipelineStages),
+		db:            db,
+	}
+}
+
+// defaultPipelineStages are the opportunity pipeline stages a tenant starts
+// with, and their win probabilities
+var defaultPipelineStages = []struct {
+	stage       string
+	name        string
+	probability int
+}{
+	{"prospecting", "Prospecting", 10},
+	{"qualification", "Qualification", 25},
+	{"proposal", "Proposal", 50},
+	{"negotiation", "Negotiation", 75},
+	{"closed-won", "Closed Won", 100},
+	{"closed-lost", "Closed Lost", 0},
+}
+
+// seedPipelineStages gives a new tenant the default pipeline stages,
+// keeping the stages a tenant reinstalling the module already has
+func seedPipelineStages(ctx context.Context, tx *sql.Tx, tenantID string) error {
+	query := `
+		INSERT INTO crm_pipeline_stages (tenant_id, stage, name, position, probability, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (tenant_id, stage) DO NOTHING
+	`
+
+	now := time.Now()
+	for i, stage := range defaultPipelineStages {
+		if _, err := tx.ExecContext(ctx, query, tenantID, stage.stage, stage.name, i+1, stage.probability, now); err != nil {
+			return fmt.Errorf("failed to seed pipeline stages: %w", err)
+		}
+	}
+	return nil
+}
+
+// defaultLeadSources are the lead sources a tenant starts with
+var defaultLeadSources = []struct {
+	source string
+	name   string
+}{
+	{"website", "Website"},
+	{"referral", "Referral"},
+	{"event", "Event"},
+	{"cold_call", "Cold Call"},
+	{"social_media", "Social Media"},
+	{"partner", "Partner"},
+}
+
+// SeedLeadSources gives a tenant the default lead sources, keeping the
+// sources it already has
+func (r *ModuleRepository) SeedLeadSources(ctx context.Context, tenantID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO crm_lead_sources (tenant_id, source, name, position, is_default, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, true, $5, $5)
+		ON CONFLICT (tenant_id, source) DO NOTHING
+	`
+	now := time.Now()
+	for i, source := range defaultLeadSources {
+		if _, err := tx.ExecContext(ctx, query, tenantID, source.source, source.name, i+1, now); err != nil {
+			return fmt.Errorf("failed to seed lead sources: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveDefaultLeadSources removes the default lead sources of a tenant,
+// keeping the sources it added
+func (r *ModuleRepository) RemoveDefaultLeadSources(ctx context.Context, tenantID string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM crm_lead_sources WHERE tenant_id = $1 AND is_default = true", tenantID); err != nil {
+		return fmt.Errorf("failed to remove lead sources: %w", err)
+	}
+	return nil
+}
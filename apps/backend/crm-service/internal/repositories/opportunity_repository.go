@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"zplus-saas/apps/backend/crm-service/internal/models"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
 type OpportunityRepository struct {
@@ -44,17 +45,17 @@ func (r *OpportunityRepository) Create(opportunity *models.Opportunity) error {
 	return nil
 }
 
-// GetByID gets an opportunity by ID
-func (r *OpportunityRepository) GetByID(tenantID string, id int) (*models.Opportunity, error) {
+// GetByID gets an opportunity by ID within the caller's data scope
+func (r *OpportunityRepository) GetByID(tenantID string, id int, access middleware.Access) (*models.Opportunity, error) {
+	scope, scopeArgs := scopeCondition(access, 3)
 	query := `
 		SELECT id, tenant_id, customer_id, name, description, value, currency, stage, probability, source, assigned_to, expected_date, closed_date, created_at, updated_at
 		FROM opportunities
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	opportunity := &models.Opportunity{}
 
-	err := r.db.QueryRow(query, tenantID, id).Scan(
+	err := r.db.QueryRow(query, append([]interface{}{tenantID, id}, scopeArgs...)...).Scan(
 		&opportunity.ID, &opportunity.TenantID, &opportunity.CustomerID,
 		&opportunity.Name, &opportunity.Description, &opportunity.Value,
 		&opportunity.Currency, &opportunity.Stage, &opportunity.Probability,
@@ -72,17 +73,18 @@ func (r *OpportunityRepository) GetByID(tenantID string, id int) (*models.Opport
 	return opportunity, nil
 }
 
-// GetAll gets all opportunities for a tenant
-func (r *OpportunityRepository) GetAll(tenantID string, limit, offset int) ([]*models.Opportunity, error) {
+// GetAll gets all opportunities for a tenant within the caller's data scope
+func (r *OpportunityRepository) GetAll(tenantID string, access middleware.Access, limit, offset int) ([]*models.Opportunity, error) {
+	scope, scopeArgs := scopeCondition(access, 4)
 	query := `
 		SELECT id, tenant_id, customer_id, name, description, value, currency, stage, probability, source, assigned_to, expected_date, closed_date, created_at, updated_at
 		FROM opportunities
-		WHERE tenant_id = $1
+		WHERE tenant_id = $1` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.Query(query, tenantID, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunities: %w", err)
 	}
@@ -111,23 +113,24 @@ func (r *OpportunityRepository) GetAll(tenantID string, limit, offset int) ([]*m
 	return opportunities, nil
 }
 
-// Update updates an opportunity
-func (r *OpportunityRepository) Update(opportunity *models.Opportunity) error {
+// Update updates an opportunity within the caller's data scope
+func (r *OpportunityRepository) Update(opportunity *models.Opportunity, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 13)
 	query := `
 		UPDATE opportunities
 		SET name = $3, description = $4, value = $5, currency = $6, stage = $7, probability = $8, source = $9, assigned_to = $10, expected_date = $11, updated_at = $12
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	opportunity.UpdatedAt = time.Now()
 
-	result, err := r.db.Exec(
-		query,
+	args := []interface{}{
 		opportunity.TenantID, opportunity.ID, opportunity.Name,
 		opportunity.Description, opportunity.Value, opportunity.Currency,
 		opportunity.Stage, opportunity.Probability, opportunity.Source,
 		opportunity.AssignedTo, opportunity.ExpectedDate, opportunity.UpdatedAt,
-	)
+	}
+
+	result, err := r.db.Exec(query, append(args, scopeArgs...)...)
 
 	if err != nil {
 		return fmt.Errorf("failed to update opportunity: %w", err)
@@ -145,11 +148,12 @@ func (r *OpportunityRepository) Update(opportunity *models.Opportunity) error {
 	return nil
 }
 
-// Delete deletes an opportunity
-func (r *OpportunityRepository) Delete(tenantID string, id int) error {
-	query := `DELETE FROM opportunities WHERE tenant_id = $1 AND id = $2`
+// Delete deletes an opportunity within the caller's data scope
+func (r *OpportunityRepository) Delete(tenantID string, id int, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 3)
+	query := `DELETE FROM opportunities WHERE tenant_id = $1 AND id = $2` + scope
 
-	result, err := r.db.Exec(query, tenantID, id)
+	result, err := r.db.Exec(query, append([]interface{}{tenantID, id}, scopeArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to delete opportunity: %w", err)
 	}
@@ -166,17 +170,17 @@ func (r *OpportunityRepository) Delete(tenantID string, id int) error {
 	return nil
 }
 
-// CloseWon marks an opportunity as closed won
-func (r *OpportunityRepository) CloseWon(tenantID string, id int) error {
+// CloseWon marks an opportunity as closed won within the caller's data scope
+func (r *OpportunityRepository) CloseWon(tenantID string, id int, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 4)
 	query := `
 		UPDATE opportunities
 		SET stage = 'closed-won', probability = 100, closed_date = $3, updated_at = $3
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	now := time.Now()
 
-	result, err := r.db.Exec(query, tenantID, id, now)
+	result, err := r.db.Exec(query, append([]interface{}{tenantID, id, now}, scopeArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to close opportunity as won: %w", err)
 	}
@@ -193,17 +197,17 @@ func (r *OpportunityRepository) CloseWon(tenantID string, id int) error {
 	return nil
 }
 
-// CloseLost marks an opportunity as closed lost
-func (r *OpportunityRepository) CloseLost(tenantID string, id int) error {
+// CloseLost marks an opportunity as closed lost within the caller's data scope
+func (r *OpportunityRepository) CloseLost(tenantID string, id int, access middleware.Access) error {
+	scope, scopeArgs := scopeCondition(access, 4)
 	query := `
 		UPDATE opportunities
 		SET stage = 'closed-lost', probability = 0, closed_date = $3, updated_at = $3
-		WHERE tenant_id = $1 AND id = $2
-	`
+		WHERE tenant_id = $1 AND id = $2` + scope
 
 	now := time.Now()
 
-	result, err := r.db.Exec(query, tenantID, id, now)
+	result, err := r.db.Exec(query, append([]interface{}{tenantID, id, now}, scopeArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to close opportunity as lost: %w", err)
 	}
@@ -220,17 +224,18 @@ func (r *OpportunityRepository) CloseLost(tenantID string, id int) error {
 	return nil
 }
 
-// GetByStage gets opportunities by stage
-func (r *OpportunityRepository) GetByStage(tenantID, stage string, limit, offset int) ([]*models.Opportunity, error) {
+// GetByStage gets opportunities by stage within the caller's data scope
+func (r *OpportunityRepository) GetByStage(tenantID, stage string, access middleware.Access, limit, offset int) ([]*models.Opportunity, error) {
+	scope, scopeArgs := scopeCondition(access, 5)
 	query := `
 		SELECT id, tenant_id, customer_id, name, description, value, currency, stage, probability, source, assigned_to, expected_date, closed_date, created_at, updated_at
 		FROM opportunities
-		WHERE tenant_id = $1 AND stage = $2
+		WHERE tenant_id = $1 AND stage = $2` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := r.db.Query(query, tenantID, stage, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, stage, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunities by stage: %w", err)
 	}
@@ -259,17 +264,18 @@ func (r *OpportunityRepository) GetByStage(tenantID, stage string, limit, offset
 	return opportunities, nil
 }
 
-// GetByCustomer gets opportunities for a customer
-func (r *OpportunityRepository) GetByCustomer(tenantID string, customerID, limit, offset int) ([]*models.Opportunity, error) {
+// GetByCustomer gets opportunities for a customer within the caller's data scope
+func (r *OpportunityRepository) GetByCustomer(tenantID string, customerID int, access middleware.Access, limit, offset int) ([]*models.Opportunity, error) {
+	scope, scopeArgs := scopeCondition(access, 5)
 	query := `
 		SELECT id, tenant_id, customer_id, name, description, value, currency, stage, probability, source, assigned_to, expected_date, closed_date, created_at, updated_at
 		FROM opportunities
-		WHERE tenant_id = $1 AND customer_id = $2
+		WHERE tenant_id = $1 AND customer_id = $2` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := r.db.Query(query, tenantID, customerID, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, customerID, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunities by customer: %w", err)
 	}
@@ -298,12 +304,13 @@ func (r *OpportunityRepository) GetByCustomer(tenantID string, customerID, limit
 	return opportunities, nil
 }
 
-// Count gets total count of opportunities for a tenant
-func (r *OpportunityRepository) Count(tenantID string) (int, error) {
-	query := `SELECT COUNT(*) FROM opportunities WHERE tenant_id = $1`
+// Count gets total count of opportunities for a tenant within the caller's data scope
+func (r *OpportunityRepository) Count(tenantID string, access middleware.Access) (int, error) {
+	scope, scopeArgs := scopeCondition(access, 2)
+	query := `SELECT COUNT(*) FROM opportunities WHERE tenant_id = $1` + scope
 
 	var count int
-	err := r.db.QueryRow(query, tenantID).Scan(&count)
+	err := r.db.QueryRow(query, append([]interface{}{tenantID}, scopeArgs...)...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count opportunities: %w", err)
 	}
@@ -311,12 +318,13 @@ func (r *OpportunityRepository) Count(tenantID string) (int, error) {
 	return count, nil
 }
 
-// GetTotalValue gets the total value of opportunities for a tenant
-func (r *OpportunityRepository) GetTotalValue(tenantID string) (float64, error) {
-	query := `SELECT COALESCE(SUM(value), 0) FROM opportunities WHERE tenant_id = $1 AND stage NOT IN ('closed-lost')`
+// GetTotalValue gets the total value of opportunities for a tenant within the caller's data scope
+func (r *OpportunityRepository) GetTotalValue(tenantID string, access middleware.Access) (float64, error) {
+	scope, scopeArgs := scopeCondition(access, 2)
+	query := `SELECT COALESCE(SUM(value), 0) FROM opportunities WHERE tenant_id = $1 AND stage NOT IN ('closed-lost')` + scope
 
 	var total float64
-	err := r.db.QueryRow(query, tenantID).Scan(&total)
+	err := r.db.QueryRow(query, append([]interface{}{tenantID}, scopeArgs...)...).Scan(&total)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get total opportunities value: %w", err)
 	}
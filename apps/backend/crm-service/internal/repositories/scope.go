@@ -0,0 +1,29 @@
+package repositories
+
+import (
+	"fmt"
+
+	"zplus-saas/apps/backend/shared/middleware"
+)
+
+// scopeCondition restricts a query on a table with an assigned_to column to
+// the records the caller may access. The query must bind tenant_id to $1;
+// the returned arguments start at $param.
+//
+// Team scope looks up the caller's department and direct reports in
+// hrm-service's employees table, which shares this database. Without an
+// employee record the caller only sees their own records.
+func scopeCondition(access middleware.Access, param int) (string, []interface{}) {
+	switch access.Scope {
+	case middleware.DataScopeTenant:
+		return "", nil
+	case middleware.DataScopeTeam:
+		return fmt.Sprintf(` AND (assigned_to = $%[1]d OR assigned_to IN (
+			SELECT e.user_id FROM employees e
+			JOIN employees me ON me.tenant_id = e.tenant_id AND me.is_active = true
+			WHERE me.tenant_id = $1 AND me.user_id = $%[1]d AND e.is_active = true AND e.user_id IS NOT NULL
+			AND (e.manager_id = me.id OR e.department_id = me.department_id)))`, param), []interface{}{access.UserID}
+	default:
+		return fmt.Sprintf(" AND assigned_to = $%d", param), []interface{}{access.UserID}
+	}
+}
@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"zplus-saas/apps/backend/crm-service/internal/models"
+	"zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeCondition(t *testing.T) {
+	condition, args := scopeCondition(middleware.Access{UserID: "user-1", Scope: middleware.DataScopeTenant}, 3)
+	assert.Empty(t, condition, "tenant scope sees every record, legacy assignees included")
+	assert.Empty(t, args)
+
+	condition, args = scopeCondition(middleware.Access{UserID: "user-1", Scope: middleware.DataScopeOwn}, 3)
+	assert.Equal(t, " AND assigned_to = $3", condition)
+	assert.Equal(t, []interface{}{"user-1"}, args)
+
+	// Unknown scopes fall back to the narrowest one
+	condition, _ = scopeCondition(middleware.Access{UserID: "user-1"}, 3)
+	assert.Equal(t, " AND assigned_to = $3", condition)
+
+	condition, args = scopeCondition(middleware.Access{UserID: "user-1", Scope: middleware.DataScopeTeam}, 3)
+	assert.True(t, strings.HasPrefix(condition, " AND (assigned_to = $3 OR assigned_to IN ("), condition)
+	assert.Contains(t, condition, "me.tenant_id = $1 AND me.user_id = $3")
+	assert.Contains(t, condition, "e.manager_id = me.id OR e.department_id = me.department_id")
+	assert.Equal(t, []interface{}{"user-1"}, args)
+}
+
+// Own and team scope match assigned_to against the caller's user ID, so an
+// integer assignee left over from before user IDs (e.g. "42") is only seen
+// with tenant scope. Every query must bind the caller where the condition
+// expects it.
+func TestRepositoriesBindScopeToCaller(t *testing.T) {
+	db, queries := openRecordingDB(t)
+	leads := NewLeadRepository(db)
+	opportunities := NewOpportunityRepository(db)
+	lead := &models.Lead{ID: 1, TenantID: "tenant-1"}
+	opportunity := &models.Opportunity{ID: 1, TenantID: "tenant-1"}
+
+	calls := map[string]func(access middleware.Access){
+		"lead GetByID":              func(a middleware.Access) { _, _ = leads.GetByID("tenant-1", 1, a) },
+		"lead GetAll":               func(a middleware.Access) { _, _ = leads.GetAll("tenant-1", a, 20, 0) },
+		"lead Update":               func(a middleware.Access) { _ = leads.Update(lead, a) },
+		"lead Delete":               func(a middleware.Access) { _ = leads.Delete("tenant-1", 1, a) },
+		"lead ConvertToCustomer":    func(a middleware.Access) { _ = leads.ConvertToCustomer("tenant-1", 1, a) },
+		"lead GetByStatus":          func(a middleware.Access) { _, _ = leads.GetByStatus("tenant-1", "new", a, 20, 0) },
+		"lead GetByAssignedUser":    func(a middleware.Access) { _, _ = leads.GetByAssignedUser("tenant-1", "42", a, 20, 0) },
+		"lead Count":                func(a middleware.Access) { _, _ = leads.Count("tenant-1", a) },
+		"opportunity GetByID":       func(a middleware.Access) { _, _ = opportunities.GetByID("tenant-1", 1, a) },
+		"opportunity GetAll":        func(a middleware.Access) { _, _ = opportunities.GetAll("tenant-1", a, 20, 0) },
+		"opportunity Update":        func(a middleware.Access) { _ = opportunities.Update(opportunity, a) },
+		"opportunity Delete":        func(a middleware.Access) { _ = opportunities.Delete("tenant-1", 1, a) },
+		"opportunity CloseWon":      func(a middleware.Access) { _ = opportunities.CloseWon("tenant-1", 1, a) },
+		"opportunity CloseLost":     func(a middleware.Access) { _ = opportunities.CloseLost("tenant-1", 1, a) },
+		"opportunity GetByStage":    func(a middleware.Access) { _, _ = opportunities.GetByStage("tenant-1", "proposal", a, 20, 0) },
+		"opportunity GetByCustomer": func(a middleware.Access) { _, _ = opportunities.GetByCustomer("tenant-1", 1, a, 20, 0) },
+		"opportunity Count":         func(a middleware.Access) { _, _ = opportunities.Count("tenant-1", a) },
+		"opportunity GetTotalValue": func(a middleware.Access) { _, _ = opportunities.GetTotalValue("tenant-1", a) },
+	}
+
+	for _, scope := range []middleware.DataScope{middleware.DataScopeOwn, middleware.DataScopeTeam, middleware.DataScopeTenant} {
+		access := middleware.Access{UserID: "user-1", Scope: scope}
+		for name, call := range calls {
+			*queries = nil
+			call(access)
+			require.Len(t, *queries, 1, "%s with %s scope", name, scope)
+			q := (*queries)[0]
+
+			assert.Equal(t, "tenant-1", q.args[0], "%s with %s scope binds the tenant to $1", name, scope)
+			assert.Equal(t, len(q.args), highestPlaceholder(q.query), "%s with %s scope binds every placeholder", name, scope)
+
+			condition, _ := scopeCondition(access, len(q.args))
+			if scope == middleware.DataScopeTenant {
+				assert.NotContains(t, q.args, "user-1", "%s with tenant scope", name)
+				continue
+			}
+			assert.Contains(t, q.query, condition, "%s with %s scope", name, scope)
+			assert.Equal(t, "user-1", q.args[len(q.args)-1], "%s with %s scope binds the caller last", name, scope)
+		}
+	}
+}
+
+func highestPlaceholder(query string) int {
+	highest := 0
+	for _, match := range regexp.MustCompile(`\$(\d+)`).FindAllStringSubmatch(query, -1) {
+		if n, _ := strconv.Atoi(match[1]); n > highest {
+			highest = n
+		}
+	}
+	return highest
+}
+
+// recordingDriver records the statements run against it and returns no rows
+type recordingDriver struct {
+	queries *[]recordedQuery
+}
+
+type recordedQuery struct {
+	query string
+	args  []driver.Value
+}
+
+func openRecordingDB(t *testing.T) (*sql.DB, *[]recordedQuery) {
+	t.Helper()
+
+	queries := &[]recordedQuery{}
+	name := "recording-" + t.Name()
+	sql.Register(name, &recordingDriver{queries: queries})
+	db, err := sql.Open(name, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db, queries
+}
+
+func (d *recordingDriver) Open(string) (driver.Conn, error) {
+	return &recordingConn{queries: d.queries}, nil
+}
+
+type recordingConn struct {
+	queries *[]recordedQuery
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{conn: c, query: query}, nil
+}
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+type recordingStmt struct {
+	conn  *recordingConn
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	*s.conn.queries = append(*s.conn.queries, recordedQuery{query: s.query, args: args})
+	return driver.RowsAffected(0), nil
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	*s.conn.queries = append(*s.conn.queries, recordedQuery{query: s.query, args: args})
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return nil }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"zplus-saas/apps/backend/crm-service/internal/handlers"
+	"zplus-saas/apps/backend/shared/middleware"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -10,43 +11,55 @@ import (
 func SetupCustomerRoutes(api fiber.Router, handler *handlers.CustomerHandler) {
 	customers := api.Group("/customers")
 
-	customers.Post("/", handler.CreateCustomer)
-	customers.Get("/", handler.GetCustomers)
-	customers.Get("/search", handler.SearchCustomers)
-	customers.Get("/stats", handler.GetCustomerStats)
-	customers.Get("/:id", handler.GetCustomer)
-	customers.Put("/:id", handler.UpdateCustomer)
-	customers.Delete("/:id", handler.DeleteCustomer)
+	read := middleware.RequirePermission("crm.customer.read")
+	write := middleware.RequirePermission("crm.customer.write")
+
+	customers.Post("/", write, handler.CreateCustomer)
+	customers.Get("/", read, handler.GetCustomers)
+	customers.Get("/search", read, handler.SearchCustomers)
+	customers.Get("/stats", read, handler.GetCustomerStats)
+	customers.Get("/:id", read, handler.GetCustomer)
+	customers.Put("/:id", write, handler.UpdateCustomer)
+	customers.Delete("/:id", middleware.RequirePermission("crm.customer.delete"), handler.DeleteCustomer)
 }
 
-// SetupLeadRoutes sets up lead routes
+// SetupLeadRoutes sets up lead routes. Handlers only see leads within the
+// caller's data scope (crm.lead.scope.team / crm.lead.scope.tenant).
 func SetupLeadRoutes(api fiber.Router, handler *handlers.LeadHandler) {
 	leads := api.Group("/leads")
 
-	leads.Post("/", handler.CreateLead)
-	leads.Get("/", handler.GetLeads)
-	leads.Get("/stats", handler.GetLeadStats)
-	leads.Get("/status/:status", handler.GetLeadsByStatus)
-	leads.Get("/:id", handler.GetLead)
-	leads.Put("/:id", handler.UpdateLead)
-	leads.Delete("/:id", handler.DeleteLead)
-	leads.Post("/:id/convert", handler.ConvertLead)
-	leads.Post("/:id/score", handler.ScoreLead)
+	read := middleware.RequirePermission("crm.lead.read")
+	write := middleware.RequirePermission("crm.lead.write")
+
+	leads.Post("/", write, handler.CreateLead)
+	leads.Get("/", read, handler.GetLeads)
+	leads.Get("/stats", read, handler.GetLeadStats)
+	leads.Get("/status/:status", read, handler.GetLeadsByStatus)
+	leads.Get("/:id", read, handler.GetLead)
+	leads.Put("/:id", write, handler.UpdateLead)
+	leads.Delete("/:id", middleware.RequirePermission("crm.lead.delete"), handler.DeleteLead)
+	leads.Post("/:id/convert", write, handler.ConvertLead)
+	leads.Post("/:id/score", write, handler.ScoreLead)
 }
 
-// SetupOpportunityRoutes sets up opportunity routes
+// SetupOpportunityRoutes sets up opportunity routes. Handlers only see
+// opportunities within the caller's data scope (crm.opportunity.scope.team /
+// crm.opportunity.scope.tenant).
 func SetupOpportunityRoutes(api fiber.Router, handler *handlers.OpportunityHandler) {
 	opportunities := api.Group("/opportunities")
 
-	opportunities.Post("/", handler.CreateOpportunity)
-	opportunities.Get("/", handler.GetOpportunities)
-	opportunities.Get("/stats", handler.GetOpportunityStats)
-	opportunities.Get("/pipeline", handler.GetSalesPipeline)
-	opportunities.Get("/stage/:stage", handler.GetOpportunitiesByStage)
-	opportunities.Get("/customer/:customerId", handler.GetOpportunitiesByCustomer)
-	opportunities.Get("/:id", handler.GetOpportunity)
-	opportunities.Put("/:id", handler.UpdateOpportunity)
-	opportunities.Delete("/:id", handler.DeleteOpportunity)
-	opportunities.Post("/:id/close-won", handler.CloseOpportunityWon)
-	opportunities.Post("/:id/close-lost", handler.CloseOpportunityLost)
+	read := middleware.RequirePermission("crm.opportunity.read")
+	write := middleware.RequirePermission("crm.opportunity.write")
+
+	opportunities.Post("/", write, handler.CreateOpportunity)
+	opportunities.Get("/", read, handler.GetOpportunities)
+	opportunities.Get("/stats", read, handler.GetOpportunityStats)
+	opportunities.Get("/pipeline", read, handler.GetSalesPipeline)
+	opportunities.Get("/stage/:stage", read, handler.GetOpportunitiesByStage)
+	opportunities.Get("/customer/:customerId", read, handler.GetOpportunitiesByCustomer)
+	opportunities.Get("/:id", read, handler.GetOpportunity)
+	opportunities.Put("/:id", write, handler.UpdateOpportunity)
+	opportunities.Delete("/:id", write, handler.DeleteOpportunity)
+	opportunities.Post("/:id/close-won", write, handler.CloseOpportunityWon)
+	opportunities.Post("/:id/close-lost", write, handler.CloseOpportunityLost)
 }
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"fmt"
+
+	"zplus-saas/apps/backend/shared/middleware"
+)
+
+// assignee resolves the owner of a lead or opportunity. Records default to
+// the caller, and callers limited to their own records cannot hand them to
+// someone else, since they would lose access to them.
+func assignee(access middleware.Access, requested string) (*string, error) {
+	if requested == "" {
+		requested = access.UserID
+	}
+
+	if access.Scope == middleware.DataScopeOwn && requested != access.UserID {
+		return nil, fmt.Errorf("you can only assign records to yourself")
+	}
+
+	return &requested, nil
+}
@@ -5,18 +5,40 @@ import (
 
 	"zplus-saas/apps/backend/crm-service/internal/models"
 	"zplus-saas/apps/backend/crm-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
+// LeadStore stores leads within the caller's data scope. It is implemented
+// by repositories.LeadRepository.
+type LeadStore interface {
+	Create(lead *models.Lead) error
+	GetByID(tenantID string, id int, access middleware.Access) (*models.Lead, error)
+	GetAll(tenantID string, access middleware.Access, limit, offset int) ([]*models.Lead, error)
+	Update(lead *models.Lead, access middleware.Access) error
+	Delete(tenantID string, id int, access middleware.Access) error
+	ConvertToCustomer(tenantID string, id int, access middleware.Access) error
+	GetByStatus(tenantID, status string, access middleware.Access, limit, offset int) ([]*models.Lead, error)
+	GetByAssignedUser(tenantID, userID string, access middleware.Access, limit, offset int) ([]*models.Lead, error)
+	Count(tenantID string, access middleware.Access) (int, error)
+}
+
+var _ LeadStore = (*repositories.LeadRepository)(nil)
+
 type LeadService struct {
-	repo *repositories.LeadRepository
+	repo LeadStore
 }
 
-func NewLeadService(repo *repositories.LeadRepository) *LeadService {
+func NewLeadService(repo LeadStore) *LeadService {
 	return &LeadService{repo: repo}
 }
 
 // CreateLead creates a new lead
-func (s *LeadService) CreateLead(tenantID string, req *models.CreateLeadRequest) (*models.Lead, error) {
+func (s *LeadService) CreateLead(tenantID string, access middleware.Access, req *models.CreateLeadRequest) (*models.Lead, error) {
+	assignedTo, err := assignee(access, req.AssignedTo)
+	if err != nil {
+		return nil, err
+	}
+
 	lead := &models.Lead{
 		TenantID:   tenantID,
 		Name:       req.Name,
@@ -27,12 +49,12 @@ func (s *LeadService) CreateLead(tenantID string, req *models.CreateLeadRequest)
 		Source:     req.Source,
 		Status:     "new", // Default status
 		Score:      0,     // Default score
-		AssignedTo: req.AssignedTo,
+		AssignedTo: assignedTo,
 		Value:      req.Value,
 		Notes:      req.Notes,
 	}
 
-	err := s.repo.Create(lead)
+	err = s.repo.Create(lead)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create lead: %w", err)
 	}
@@ -41,8 +63,8 @@ func (s *LeadService) CreateLead(tenantID string, req *models.CreateLeadRequest)
 }
 
 // GetLead gets a lead by ID
-func (s *LeadService) GetLead(tenantID string, id int) (*models.Lead, error) {
-	lead, err := s.repo.GetByID(tenantID, id)
+func (s *LeadService) GetLead(tenantID string, access middleware.Access, id int) (*models.Lead, error) {
+	lead, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get lead: %w", err)
 	}
@@ -51,7 +73,7 @@ func (s *LeadService) GetLead(tenantID string, id int) (*models.Lead, error) {
 }
 
 // GetLeads gets all leads with pagination
-func (s *LeadService) GetLeads(tenantID string, page, limit int) ([]*models.Lead, int, error) {
+func (s *LeadService) GetLeads(tenantID string, access middleware.Access, page, limit int) ([]*models.Lead, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -61,12 +83,12 @@ func (s *LeadService) GetLeads(tenantID string, page, limit int) ([]*models.Lead
 
 	offset := (page - 1) * limit
 
-	leads, err := s.repo.GetAll(tenantID, limit, offset)
+	leads, err := s.repo.GetAll(tenantID, access, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get leads: %w", err)
 	}
 
-	total, err := s.repo.Count(tenantID)
+	total, err := s.repo.Count(tenantID, access)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get lead count: %w", err)
 	}
@@ -75,9 +97,9 @@ func (s *LeadService) GetLeads(tenantID string, page, limit int) ([]*models.Lead
 }
 
 // UpdateLead updates a lead
-func (s *LeadService) UpdateLead(tenantID string, id int, req *models.UpdateLeadRequest) (*models.Lead, error) {
+func (s *LeadService) UpdateLead(tenantID string, access middleware.Access, id int, req *models.UpdateLeadRequest) (*models.Lead, error) {
 	// Get existing lead
-	lead, err := s.repo.GetByID(tenantID, id)
+	lead, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get lead: %w", err)
 	}
@@ -108,7 +130,10 @@ func (s *LeadService) UpdateLead(tenantID string, id int, req *models.UpdateLead
 		lead.Score = *req.Score
 	}
 	if req.AssignedTo != nil {
-		lead.AssignedTo = *req.AssignedTo
+		lead.AssignedTo, err = assignee(access, *req.AssignedTo)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if req.Value != nil {
 		lead.Value = *req.Value
@@ -117,7 +142,7 @@ func (s *LeadService) UpdateLead(tenantID string, id int, req *models.UpdateLead
 		lead.Notes = *req.Notes
 	}
 
-	err = s.repo.Update(lead)
+	err = s.repo.Update(lead, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update lead: %w", err)
 	}
@@ -126,8 +151,8 @@ func (s *LeadService) UpdateLead(tenantID string, id int, req *models.UpdateLead
 }
 
 // DeleteLead deletes a lead
-func (s *LeadService) DeleteLead(tenantID string, id int) error {
-	err := s.repo.Delete(tenantID, id)
+func (s *LeadService) DeleteLead(tenantID string, access middleware.Access, id int) error {
+	err := s.repo.Delete(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to delete lead: %w", err)
 	}
@@ -136,8 +161,8 @@ func (s *LeadService) DeleteLead(tenantID string, id int) error {
 }
 
 // ConvertLead converts a lead to customer
-func (s *LeadService) ConvertLead(tenantID string, id int) error {
-	err := s.repo.ConvertToCustomer(tenantID, id)
+func (s *LeadService) ConvertLead(tenantID string, access middleware.Access, id int) error {
+	err := s.repo.ConvertToCustomer(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to convert lead: %w", err)
 	}
@@ -146,7 +171,7 @@ func (s *LeadService) ConvertLead(tenantID string, id int) error {
 }
 
 // GetLeadsByStatus gets leads by status
-func (s *LeadService) GetLeadsByStatus(tenantID, status string, page, limit int) ([]*models.Lead, error) {
+func (s *LeadService) GetLeadsByStatus(tenantID, status string, access middleware.Access, page, limit int) ([]*models.Lead, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -156,7 +181,7 @@ func (s *LeadService) GetLeadsByStatus(tenantID, status string, page, limit int)
 
 	offset := (page - 1) * limit
 
-	leads, err := s.repo.GetByStatus(tenantID, status, limit, offset)
+	leads, err := s.repo.GetByStatus(tenantID, status, access, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get leads by status: %w", err)
 	}
@@ -165,7 +190,7 @@ func (s *LeadService) GetLeadsByStatus(tenantID, status string, page, limit int)
 }
 
 // GetLeadsByAssignedUser gets leads assigned to a user
-func (s *LeadService) GetLeadsByAssignedUser(tenantID string, userID, page, limit int) ([]*models.Lead, error) {
+func (s *LeadService) GetLeadsByAssignedUser(tenantID, userID string, access middleware.Access, page, limit int) ([]*models.Lead, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -175,7 +200,7 @@ func (s *LeadService) GetLeadsByAssignedUser(tenantID string, userID, page, limi
 
 	offset := (page - 1) * limit
 
-	leads, err := s.repo.GetByAssignedUser(tenantID, userID, limit, offset)
+	leads, err := s.repo.GetByAssignedUser(tenantID, userID, access, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get leads by assigned user: %w", err)
 	}
@@ -184,16 +209,16 @@ func (s *LeadService) GetLeadsByAssignedUser(tenantID string, userID, page, limi
 }
 
 // GetLeadStats gets lead statistics
-func (s *LeadService) GetLeadStats(tenantID string) (map[string]interface{}, error) {
-	total, err := s.repo.Count(tenantID)
+func (s *LeadService) GetLeadStats(tenantID string, access middleware.Access) (map[string]interface{}, error) {
+	total, err := s.repo.Count(tenantID, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get lead count: %w", err)
 	}
 
 	// Get leads by status (simplified)
-	newLeads, _ := s.repo.GetByStatus(tenantID, "new", 1000, 0)
-	qualifiedLeads, _ := s.repo.GetByStatus(tenantID, "qualified", 1000, 0)
-	convertedLeads, _ := s.repo.GetByStatus(tenantID, "converted", 1000, 0)
+	newLeads, _ := s.repo.GetByStatus(tenantID, "new", access, 1000, 0)
+	qualifiedLeads, _ := s.repo.GetByStatus(tenantID, "qualified", access, 1000, 0)
+	convertedLeads, _ := s.repo.GetByStatus(tenantID, "converted", access, 1000, 0)
 
 	stats := map[string]interface{}{
 		"total_leads":     total,
@@ -207,18 +232,18 @@ func (s *LeadService) GetLeadStats(tenantID string) (map[string]interface{}, err
 }
 
 // ScoreLead updates lead score based on various factors
-func (s *LeadService) ScoreLead(tenantID string, id int, score int) error {
+func (s *LeadService) ScoreLead(tenantID string, access middleware.Access, id int, score int) error {
 	if score < 0 || score > 100 {
 		return fmt.Errorf("score must be between 0 and 100")
 	}
 
-	lead, err := s.repo.GetByID(tenantID, id)
+	lead, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to get lead: %w", err)
 	}
 
 	lead.Score = score
-	err = s.repo.Update(lead)
+	err = s.repo.Update(lead, access)
 	if err != nil {
 		return fmt.Errorf("failed to update lead score: %w", err)
 	}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"zplus-saas/apps/backend/crm-service/internal/models"
+	"zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateLeadAssignsWithinScope(t *testing.T) {
+	repo := newFakeLeadStore()
+	svc := NewLeadService(repo)
+
+	lead, err := svc.CreateLead("tenant-1", middleware.Access{UserID: "user-1", Scope: middleware.DataScopeOwn}, &models.CreateLeadRequest{Name: "Acme"})
+	require.NoError(t, err)
+	require.NotNil(t, lead.AssignedTo)
+	assert.Equal(t, "user-1", *lead.AssignedTo, "leads default to the caller")
+
+	_, err = svc.CreateLead("tenant-1", middleware.Access{UserID: "user-1", Scope: middleware.DataScopeOwn}, &models.CreateLeadRequest{Name: "Acme", AssignedTo: "user-2"})
+	assert.ErrorContains(t, err, "only assign records to yourself")
+	assert.Len(t, repo.leads, 1)
+
+	for _, scope := range []middleware.DataScope{middleware.DataScopeTeam, middleware.DataScopeTenant} {
+		lead, err := svc.CreateLead("tenant-1", middleware.Access{UserID: "user-1", Scope: scope}, &models.CreateLeadRequest{Name: "Acme", AssignedTo: "user-2"})
+		require.NoError(t, err, "scope %s", scope)
+		assert.Equal(t, "user-2", *lead.AssignedTo, "scope %s", scope)
+	}
+}
+
+// Leads created before assignees were user IDs may still hold an unmapped
+// legacy number. Only tenant scope can see them, and an update that leaves
+// the assignee alone must not overwrite it with the caller.
+func TestUpdateLeadWithLegacyAssignee(t *testing.T) {
+	repo := newFakeLeadStore()
+	svc := NewLeadService(repo)
+	legacy := "42"
+	stored := repo.add(&models.Lead{TenantID: "tenant-1", Name: "Acme", AssignedTo: &legacy})
+	admin := middleware.Access{UserID: "admin", Scope: middleware.DataScopeTenant}
+
+	name := "Acme Corp"
+	lead, err := svc.UpdateLead("tenant-1", admin, stored.ID, &models.UpdateLeadRequest{Name: &name})
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Corp", lead.Name)
+	assert.Equal(t, "42", *repo.leads[stored.ID].AssignedTo)
+
+	_, err = svc.UpdateLead("tenant-1", middleware.Access{UserID: "user-1", Scope: middleware.DataScopeOwn}, stored.ID, &models.UpdateLeadRequest{AssignedTo: &legacy})
+	assert.ErrorContains(t, err, "only assign records to yourself")
+
+	owner := "user-2"
+	lead, err = svc.UpdateLead("tenant-1", admin, stored.ID, &models.UpdateLeadRequest{AssignedTo: &owner})
+	require.NoError(t, err)
+	assert.Equal(t, "user-2", *lead.AssignedTo)
+	assert.Equal(t, "user-2", *repo.leads[stored.ID].AssignedTo)
+}
+
+// In-memory lead store. It ignores the data scope, which the repository's
+// queries apply.
+type fakeLeadStore struct {
+	leads  map[int]*models.Lead
+	nextID int
+}
+
+func newFakeLeadStore() *fakeLeadStore {
+	return &fakeLeadStore{leads: map[int]*models.Lead{}}
+}
+
+func (r *fakeLeadStore) add(lead *models.Lead) *models.Lead {
+	r.nextID++
+	lead.ID = r.nextID
+	copied := *lead
+	r.leads[lead.ID] = &copied
+	return lead
+}
+
+func (r *fakeLeadStore) Create(lead *models.Lead) error {
+	r.add(lead)
+	return nil
+}
+
+func (r *fakeLeadStore) GetByID(tenantID string, id int, access middleware.Access) (*models.Lead, error) {
+	lead, ok := r.leads[id]
+	if !ok || lead.TenantID != tenantID {
+		return nil, fmt.Errorf("lead %d not found", id)
+	}
+	copied := *lead
+	return &copied, nil
+}
+
+func (r *fakeLeadStore) GetAll(tenantID string, access middleware.Access, limit, offset int) ([]*models.Lead, error) {
+	return nil, nil
+}
+
+func (r *fakeLeadStore) Update(lead *models.Lead, access middleware.Access) error {
+	copied := *lead
+	r.leads[lead.ID] = &copied
+	return nil
+}
+
+func (r *fakeLeadStore) Delete(tenantID string, id int, access middleware.Access) error {
+	delete(r.leads, id)
+	return nil
+}
+
+func (r *fakeLeadStore) ConvertToCustomer(tenantID string, id int, access middleware.Access) error {
+	return nil
+}
+
+func (r *fakeLeadStore) GetByStatus(tenantID, status string, access middleware.Access, limit, offset int) ([]*models.Lead, error) {
+	return nil, nil
+}
+
+func (r *fakeLeadStore) GetByAssignedUser(tenantID, userID string, access middleware.Access, limit, offset int) ([]*models.Lead, error) {
+	return nil, nil
+}
+
+func (r *fakeLeadStore) Count(tenantID string, access middleware.Access) (int, error) {
+	return len(r.leads), nil
+}
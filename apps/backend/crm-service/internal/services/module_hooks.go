@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+
+	"zplus-saas/apps/backend/crm-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/modulehooks"
+)
+
+// moduleData is the tenant data the CRM module's migrations change
+type moduleData interface {
+	SeedLeadSources(ctx context.Context, tenantID string) error
+	RemoveDefaultLeadSources(ctx context.Context, tenantID string) error
+}
+
+// moduleMigrations are the version-specific steps upgrading and rolling
+// back a tenant's CRM data
+func moduleMigrations(data moduleData) modulehooks.Migrations {
+	return modulehooks.Migrations{
+		// 1.1.0 adds lead sources, starting with the default ones
+		{Version: "1.1.0", Up: data.SeedLeadSources, Down: data.RemoveDefaultLeadSources},
+	}
+}
+
+// NewModuleHooks returns the lifecycle hooks tenant-service runs when a
+// tenant installs, upgrades, rolls back, enables, disables or uninstalls the
+// CRM module
+func NewModuleHooks(repo *repositories.ModuleRepository) modulehooks.Hooks {
+	return modulehooks.NewHooks(repo, moduleMigrations(repo))
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"zplus-saas/apps/backend/shared/modulehooks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeModuleStore keeps one tenant's CRM module row and lead sources
+type fakeModuleStore struct {
+	installed   bool
+	version     string
+	leadSources int
+}
+
+func (s *fakeModuleStore) Install(ctx context.Context, tenantID string) error {
+	if !s.installed && s.version == "" {
+		s.version = modulehooks.BaseVersion
+	}
+	s.installed = true
+	return nil
+}
+
+func (s *fakeModuleStore) Version(ctx context.Context, tenantID string) (string, error) {
+	if !s.installed {
+		return "", fmt.Errorf("module is not installed for tenant")
+	}
+	return s.version, nil
+}
+
+func (s *fakeModuleStore) SetVersion(ctx context.Context, tenantID, version string) error {
+	s.version = version
+	return nil
+}
+
+func (s *fakeModuleStore) SetEnabled(ctx context.Context, tenantID string, enabled bool) error {
+	return nil
+}
+
+func (s *fakeModuleStore) Uninstall(ctx context.Context, tenantID string) error {
+	s.installed = false
+	return nil
+}
+
+func (s *fakeModuleStore) SeedLeadSources(ctx context.Context, tenantID string) error {
+	s.leadSources = 6
+	return nil
+}
+
+func (s *fakeModuleStore) RemoveDefaultLeadSources(ctx context.Context, tenantID string) error {
+	s.leadSources = 0
+	return nil
+}
+
+func runHook(t *testing.T, store *fakeModuleStore, event, version, fromVersion string) {
+	t.Helper()
+	hooks := modulehooks.NewHooks(store, moduleMigrations(store))
+	err := hooks[event](context.Background(), &modulehooks.Request{Event: event, TenantID: "tenant-1", Module: "crm", Version: version, FromVersion: fromVersion})
+	require.NoError(t, err, "%s to %s", event, version)
+}
+
+func TestModuleHooksUpgradeAndRollBackLeadSources(t *testing.T) {
+	store := &fakeModuleStore{}
+
+	runHook(t, store, modulehooks.EventInstall, "1.0.0", "")
+	assert.Equal(t, "1.0.0", store.version)
+	assert.Zero(t, store.leadSources, "1.0.0 has no lead sources")
+
+	// A release candidate comes before its release
+	runHook(t, store, modulehooks.EventUpgrade, "1.1.0-rc.1", "1.0.0")
+	assert.Equal(t, "1.1.0-rc.1", store.version)
+	assert.Zero(t, store.leadSources)
+
+	runHook(t, store, modulehooks.EventUpgrade, "1.1.0", "1.1.0-rc.1")
+	assert.Equal(t, "1.1.0", store.version)
+	assert.Equal(t, 6, store.leadSources)
+
+	runHook(t, store, modulehooks.EventRollback, "1.0.0", "1.1.0")
+	assert.Equal(t, "1.0.0", store.version)
+	assert.Zero(t, store.leadSources, "rolling back removes the default lead sources")
+}
+
+func TestModuleHooksInstallMigratesToInstalledVersion(t *testing.T) {
+	store := &fakeModuleStore{}
+
+	runHook(t, store, modulehooks.EventInstall, "1.1.0", "")
+	assert.Equal(t, "1.1.0", store.version)
+	assert.Equal(t, 6, store.leadSources, "installing 1.1.0 seeds what upgrading to it does")
+}
@@ -6,6 +6,7 @@ import (
 
 	"zplus-saas/apps/backend/crm-service/internal/models"
 	"zplus-saas/apps/backend/crm-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
 type OpportunityService struct {
@@ -17,13 +18,18 @@ func NewOpportunityService(repo *repositories.OpportunityRepository) *Opportunit
 }
 
 // CreateOpportunity creates a new opportunity
-func (s *OpportunityService) CreateOpportunity(tenantID string, req *models.CreateOpportunityRequest) (*models.Opportunity, error) {
+func (s *OpportunityService) CreateOpportunity(tenantID string, access middleware.Access, req *models.CreateOpportunityRequest) (*models.Opportunity, error) {
 	// Parse expected date
 	expectedDate, err := time.Parse("2006-01-02", req.ExpectedDate)
 	if err != nil {
 		return nil, fmt.Errorf("invalid expected date format: %w", err)
 	}
 
+	assignedTo, err := assignee(access, req.AssignedTo)
+	if err != nil {
+		return nil, err
+	}
+
 	opportunity := &models.Opportunity{
 		TenantID:     tenantID,
 		CustomerID:   req.CustomerID,
@@ -34,7 +40,7 @@ func (s *OpportunityService) CreateOpportunity(tenantID string, req *models.Crea
 		Stage:        "prospecting", // Default stage
 		Probability:  10,            // Default probability
 		Source:       req.Source,
-		AssignedTo:   req.AssignedTo,
+		AssignedTo:   assignedTo,
 		ExpectedDate: expectedDate,
 	}
 
@@ -51,8 +57,8 @@ func (s *OpportunityService) CreateOpportunity(tenantID string, req *models.Crea
 }
 
 // GetOpportunity gets an opportunity by ID
-func (s *OpportunityService) GetOpportunity(tenantID string, id int) (*models.Opportunity, error) {
-	opportunity, err := s.repo.GetByID(tenantID, id)
+func (s *OpportunityService) GetOpportunity(tenantID string, access middleware.Access, id int) (*models.Opportunity, error) {
+	opportunity, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunity: %w", err)
 	}
@@ -61,7 +67,7 @@ func (s *OpportunityService) GetOpportunity(tenantID string, id int) (*models.Op
 }
 
 // GetOpportunities gets all opportunities with pagination
-func (s *OpportunityService) GetOpportunities(tenantID string, page, limit int) ([]*models.Opportunity, int, error) {
+func (s *OpportunityService) GetOpportunities(tenantID string, access middleware.Access, page, limit int) ([]*models.Opportunity, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -71,12 +77,12 @@ func (s *OpportunityService) GetOpportunities(tenantID string, page, limit int)
 
 	offset := (page - 1) * limit
 
-	opportunities, err := s.repo.GetAll(tenantID, limit, offset)
+	opportunities, err := s.repo.GetAll(tenantID, access, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get opportunities: %w", err)
 	}
 
-	total, err := s.repo.Count(tenantID)
+	total, err := s.repo.Count(tenantID, access)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get opportunity count: %w", err)
 	}
@@ -85,9 +91,9 @@ func (s *OpportunityService) GetOpportunities(tenantID string, page, limit int)
 }
 
 // UpdateOpportunity updates an opportunity
-func (s *OpportunityService) UpdateOpportunity(tenantID string, id int, req *models.UpdateOpportunityRequest) (*models.Opportunity, error) {
+func (s *OpportunityService) UpdateOpportunity(tenantID string, access middleware.Access, id int, req *models.UpdateOpportunityRequest) (*models.Opportunity, error) {
 	// Get existing opportunity
-	opportunity, err := s.repo.GetByID(tenantID, id)
+	opportunity, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunity: %w", err)
 	}
@@ -118,7 +124,10 @@ func (s *OpportunityService) UpdateOpportunity(tenantID string, id int, req *mod
 		opportunity.Source = *req.Source
 	}
 	if req.AssignedTo != nil {
-		opportunity.AssignedTo = *req.AssignedTo
+		opportunity.AssignedTo, err = assignee(access, *req.AssignedTo)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if req.ExpectedDate != nil {
 		expectedDate, err := time.Parse("2006-01-02", *req.ExpectedDate)
@@ -128,7 +137,7 @@ func (s *OpportunityService) UpdateOpportunity(tenantID string, id int, req *mod
 		opportunity.ExpectedDate = expectedDate
 	}
 
-	err = s.repo.Update(opportunity)
+	err = s.repo.Update(opportunity, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update opportunity: %w", err)
 	}
@@ -137,8 +146,8 @@ func (s *OpportunityService) UpdateOpportunity(tenantID string, id int, req *mod
 }
 
 // DeleteOpportunity deletes an opportunity
-func (s *OpportunityService) DeleteOpportunity(tenantID string, id int) error {
-	err := s.repo.Delete(tenantID, id)
+func (s *OpportunityService) DeleteOpportunity(tenantID string, access middleware.Access, id int) error {
+	err := s.repo.Delete(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to delete opportunity: %w", err)
 	}
@@ -147,8 +156,8 @@ func (s *OpportunityService) DeleteOpportunity(tenantID string, id int) error {
 }
 
 // CloseOpportunityWon marks an opportunity as won
-func (s *OpportunityService) CloseOpportunityWon(tenantID string, id int) error {
-	err := s.repo.CloseWon(tenantID, id)
+func (s *OpportunityService) CloseOpportunityWon(tenantID string, access middleware.Access, id int) error {
+	err := s.repo.CloseWon(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to close opportunity as won: %w", err)
 	}
@@ -157,8 +166,8 @@ func (s *OpportunityService) CloseOpportunityWon(tenantID string, id int) error
 }
 
 // CloseOpportunityLost marks an opportunity as lost
-func (s *OpportunityService) CloseOpportunityLost(tenantID string, id int) error {
-	err := s.repo.CloseLost(tenantID, id)
+func (s *OpportunityService) CloseOpportunityLost(tenantID string, access middleware.Access, id int) error {
+	err := s.repo.CloseLost(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to close opportunity as lost: %w", err)
 	}
@@ -167,7 +176,7 @@ func (s *OpportunityService) CloseOpportunityLost(tenantID string, id int) error
 }
 
 // GetOpportunitiesByStage gets opportunities by stage
-func (s *OpportunityService) GetOpportunitiesByStage(tenantID, stage string, page, limit int) ([]*models.Opportunity, error) {
+func (s *OpportunityService) GetOpportunitiesByStage(tenantID, stage string, access middleware.Access, page, limit int) ([]*models.Opportunity, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -177,7 +186,7 @@ func (s *OpportunityService) GetOpportunitiesByStage(tenantID, stage string, pag
 
 	offset := (page - 1) * limit
 
-	opportunities, err := s.repo.GetByStage(tenantID, stage, limit, offset)
+	opportunities, err := s.repo.GetByStage(tenantID, stage, access, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunities by stage: %w", err)
 	}
@@ -186,7 +195,7 @@ func (s *OpportunityService) GetOpportunitiesByStage(tenantID, stage string, pag
 }
 
 // GetOpportunitiesByCustomer gets opportunities for a customer
-func (s *OpportunityService) GetOpportunitiesByCustomer(tenantID string, customerID, page, limit int) ([]*models.Opportunity, error) {
+func (s *OpportunityService) GetOpportunitiesByCustomer(tenantID string, access middleware.Access, customerID, page, limit int) ([]*models.Opportunity, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -196,7 +205,7 @@ func (s *OpportunityService) GetOpportunitiesByCustomer(tenantID string, custome
 
 	offset := (page - 1) * limit
 
-	opportunities, err := s.repo.GetByCustomer(tenantID, customerID, limit, offset)
+	opportunities, err := s.repo.GetByCustomer(tenantID, customerID, access, limit, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunities by customer: %w", err)
 	}
@@ -205,24 +214,24 @@ func (s *OpportunityService) GetOpportunitiesByCustomer(tenantID string, custome
 }
 
 // GetOpportunityStats gets opportunity statistics
-func (s *OpportunityService) GetOpportunityStats(tenantID string) (map[string]interface{}, error) {
-	total, err := s.repo.Count(tenantID)
+func (s *OpportunityService) GetOpportunityStats(tenantID string, access middleware.Access) (map[string]interface{}, error) {
+	total, err := s.repo.Count(tenantID, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get opportunity count: %w", err)
 	}
 
-	totalValue, err := s.repo.GetTotalValue(tenantID)
+	totalValue, err := s.repo.GetTotalValue(tenantID, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get total value: %w", err)
 	}
 
 	// Get opportunities by stage (simplified)
-	prospecting, _ := s.repo.GetByStage(tenantID, "prospecting", 1000, 0)
-	qualification, _ := s.repo.GetByStage(tenantID, "qualification", 1000, 0)
-	proposal, _ := s.repo.GetByStage(tenantID, "proposal", 1000, 0)
-	negotiation, _ := s.repo.GetByStage(tenantID, "negotiation", 1000, 0)
-	closedWon, _ := s.repo.GetByStage(tenantID, "closed-won", 1000, 0)
-	closedLost, _ := s.repo.GetByStage(tenantID, "closed-lost", 1000, 0)
+	prospecting, _ := s.repo.GetByStage(tenantID, "prospecting", access, 1000, 0)
+	qualification, _ := s.repo.GetByStage(tenantID, "qualification", access, 1000, 0)
+	proposal, _ := s.repo.GetByStage(tenantID, "proposal", access, 1000, 0)
+	negotiation, _ := s.repo.GetByStage(tenantID, "negotiation", access, 1000, 0)
+	closedWon, _ := s.repo.GetByStage(tenantID, "closed-won", access, 1000, 0)
+	closedLost, _ := s.repo.GetByStage(tenantID, "closed-lost", access, 1000, 0)
 
 	stats := map[string]interface{}{
 		"total_opportunities": total,
@@ -242,12 +251,12 @@ func (s *OpportunityService) GetOpportunityStats(tenantID string) (map[string]in
 }
 
 // GetSalesPipeline gets sales pipeline data
-func (s *OpportunityService) GetSalesPipeline(tenantID string) (map[string]interface{}, error) {
+func (s *OpportunityService) GetSalesPipeline(tenantID string, access middleware.Access) (map[string]interface{}, error) {
 	stages := []string{"prospecting", "qualification", "proposal", "negotiation", "closed-won", "closed-lost"}
 	pipeline := make(map[string]interface{})
 
 	for _, stage := range stages {
-		opportunities, err := s.repo.GetByStage(tenantID, stage, 1000, 0)
+		opportunities, err := s.repo.GetByStage(tenantID, stage, access, 1000, 0)
 		if err != nil {
 			continue
 		}
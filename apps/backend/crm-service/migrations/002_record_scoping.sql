@@ -0,0 +1,25 @@
+-- CRM Service Database Schema
+-- Migration: 002_record_scoping.sql
+-- Description: Stores record owners as auth-service user IDs for record-level access control
+
+-- assigned_to now holds the owning auth-service user ID (a UUID string, like
+-- tenant_id) instead of an integer nobody could resolve. Existing integer
+-- assignments are kept as text. Assignments without a user keep the old
+-- number, which matches no user: own and team scope never see those records,
+-- only callers with tenant scope do, until they are reassigned or mapped.
+
+ALTER TABLE leads ALTER COLUMN assigned_to TYPE VARCHAR(255) USING assigned_to::text;
+ALTER TABLE opportunities ALTER COLUMN assigned_to TYPE VARCHAR(255) USING assigned_to::text;
+
+COMMENT ON COLUMN leads.assigned_to IS 'Owning user ID from auth service';
+COMMENT ON COLUMN opportunities.assigned_to IS 'Owning user ID from auth service';
+
+-- The auth-service user behind each integer assignee a tenant used before.
+-- Operators fill it after this migration and then run
+-- scripts/backfill_legacy_assignees.sql, as often as mappings are added.
+CREATE TABLE IF NOT EXISTS crm_legacy_assignees (
+    tenant_id VARCHAR(255) NOT NULL,
+    legacy_id INTEGER NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    PRIMARY KEY (tenant_id, legacy_id)
+);
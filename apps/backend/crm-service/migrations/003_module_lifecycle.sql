@@ -0,0 +1,14 @@
+-- CRM Service Database Schema
+-- Migration: 003_module_lifecycle.sql
+-- Description: Tracks which tenants have the CRM module set up, maintained by the module lifecycle hooks tenant-service runs
+
+-- Uninstalling keeps a tenant's CRM records, so installing the module again
+-- picks them up; only uninstalled_at is set.
+CREATE TABLE IF NOT EXISTS crm_tenant_modules (
+    tenant_id VARCHAR(255) PRIMARY KEY,
+    version VARCHAR(20) NOT NULL,
+    is_enabled BOOLEAN NOT NULL DEFAULT true,
+    installed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    uninstalled_at TIMESTAMP
+);
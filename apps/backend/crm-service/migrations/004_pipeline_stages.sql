@@ -0,0 +1,17 @@
+-- CRM Service Database Schema
+-- Migration: 004_pipeline_stages.sql
+-- Description: Adds each tenant's sales pipeline stages, seeded when the CRM module is installed for the tenant
+
+-- A tenant's stages of the opportunity pipeline in order, with the win
+-- probability an opportunity entering the stage starts at. Installing the
+-- module seeds the default stages; tenants may rename and reweight them.
+CREATE TABLE IF NOT EXISTS crm_pipeline_stages (
+    tenant_id VARCHAR(255) NOT NULL,
+    stage VARCHAR(50) NOT NULL CHECK (stage IN ('prospecting', 'qualification', 'proposal', 'negotiation', 'closed-won', 'closed-lost')),
+    name VARCHAR(100) NOT NULL,
+    position INTEGER NOT NULL,
+    probability INTEGER NOT NULL CHECK (probability >= 0 AND probability <= 100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, stage)
+);
@@ -0,0 +1,17 @@
+-- CRM Service Database Schema
+-- Migration: 005_lead_sources.sql
+-- Description: Adds each tenant's lead sources, seeded by the module's 1.1.0 upgrade hook
+
+-- The sources a tenant's leads and customers come from. Upgrading the module
+-- to 1.1.0 seeds the default sources; rolling it back removes the defaults
+-- again and keeps the sources the tenant added.
+CREATE TABLE IF NOT EXISTS crm_lead_sources (
+    tenant_id VARCHAR(255) NOT NULL,
+    source VARCHAR(100) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    position INTEGER NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, source)
+);
@@ -0,0 +1,21 @@
+-- Moves legacy integer assignments over to the auth-service users mapped in
+-- crm_legacy_assignees (created by migrations/002_record_scoping.sql).
+-- Fill the mapping first, e.g.
+--
+--   INSERT INTO crm_legacy_assignees (tenant_id, legacy_id, user_id)
+--   VALUES ('<tenant id>', 42, '<user id>');
+--
+-- then run this script. It only touches assignments that are still a mapped
+-- number, so it can be run again whenever mappings are added.
+
+BEGIN;
+
+UPDATE leads l SET assigned_to = m.user_id
+FROM crm_legacy_assignees m
+WHERE m.tenant_id = l.tenant_id AND l.assigned_to = m.legacy_id::text;
+
+UPDATE opportunities o SET assigned_to = m.user_id
+FROM crm_legacy_assignees m
+WHERE m.tenant_id = o.tenant_id AND o.assigned_to = m.legacy_id::text;
+
+COMMIT;
@@ -1,19 +1,26 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // FileRecord represents a file record in database
@@ -42,11 +49,21 @@ type FileUploadResponse struct {
 
 // FileHandler handles file-related requests
 type FileHandler struct {
-	db        *sqlx.DB
-	uploadDir string
+	db               *sqlx.DB
+	cfg              *config.Config
+	uploadDir        string
+	tenantServiceURL string
+	httpClient       *http.Client
+}
+
+// storageQuotaCheck is tenant-service's answer to a storage quota check
+type storageQuotaCheck struct {
+	Used    int64  `json:"used"`
+	Limit   *int64 `json:"limit"`
+	Allowed bool   `json:"allowed"`
 }
 
-func NewFileHandler(db *sqlx.DB) *FileHandler {
+func NewFileHandler(db *sqlx.DB, cfg *config.Config) *FileHandler {
 	uploadDir := os.Getenv("UPLOAD_DIRECTORY")
 	if uploadDir == "" {
 		uploadDir = "./uploads"
@@ -57,12 +74,58 @@ func NewFileHandler(db *sqlx.DB) *FileHandler {
 		log.Printf("Failed to create upload directory: %v", err)
 	}
 
+	tenantServiceURL := os.Getenv("TENANT_SERVICE_URL")
+	if tenantServiceURL == "" {
+		tenantServiceURL = "http://localhost:8089"
+	}
+
 	return &FileHandler{
-		db:        db,
-		uploadDir: uploadDir,
+		db:               db,
+		cfg:              cfg,
+		uploadDir:        uploadDir,
+		tenantServiceURL: strings.TrimSuffix(tenantServiceURL, "/"),
+		httpClient:       &http.Client{Timeout: 5 * time.Second},
 	}
 }
 
+// checkStorageQuota asks tenant-service whether the tenant's plan has room
+// for size more bytes
+func (h *FileHandler) checkStorageQuota(ctx context.Context, tenantID string, size int64) (*storageQuotaCheck, error) {
+	payload, err := json.Marshal(map[string]interface{}{"resource": "storage", "amount": size})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sharedmiddleware.NewServiceToken(h.cfg, "file-service", tenantID, nil, time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/tenants/%s/quota/check", h.tenantServiceURL, tenantID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenant-service returned status %d", resp.StatusCode)
+	}
+
+	var check storageQuotaCheck
+	if err := json.NewDecoder(resp.Body).Decode(&check); err != nil {
+		return nil, fmt.Errorf("invalid quota response: %w", err)
+	}
+	return &check, nil
+}
+
 // generateUniqueFilename generates a unique filename
 func (h *FileHandler) generateUniqueFilename(originalName string) string {
 	ext := filepath.Ext(originalName)
@@ -116,6 +179,31 @@ func (h *FileHandler) UploadFiles(c *fiber.Ctx) error {
 		})
 	}
 
+	// The whole upload must fit in the plan's storage. Stored files cannot be
+	// taken back, so uploads wait until tenant-service can answer.
+	var uploadSize int64
+	for _, file := range files {
+		uploadSize += file.Size
+	}
+	check, err := h.checkStorageQuota(c.Context(), tenantID, uploadSize)
+	if err != nil {
+		log.Printf("Failed to check storage quota of tenant %s: %v", tenantID, err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(FileUploadResponse{
+			Success: false,
+			Message: "Unable to check the storage quota, try again later",
+		})
+	}
+	if !check.Allowed {
+		message := "Storage quota exceeded"
+		if check.Limit != nil {
+			message = fmt.Sprintf("Storage quota exceeded: %d of %d bytes used", check.Used, *check.Limit)
+		}
+		return c.Status(fiber.StatusForbidden).JSON(FileUploadResponse{
+			Success: false,
+			Message: message,
+		})
+	}
+
 	var uploadedFiles []FileRecord
 	for _, file := range files {
 		// Generate unique filename
@@ -196,6 +284,62 @@ func (h *FileHandler) GetFiles(c *fiber.Ctx) error {
 	})
 }
 
+// PurgeBlobs removes, every interval, the blobs of files whose records data
+// retention purged. Retention runs in auth-service and queues their paths in
+// file_blob_purges; a path is dequeued once its blob is gone.
+func (h *FileHandler) PurgeBlobs(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := h.purgeBlobBatch(); err != nil {
+			log.Printf("Failed to purge file blobs: %v", err)
+		}
+	}
+}
+
+func (h *FileHandler) purgeBlobBatch() error {
+	tx, err := h.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var purges []struct {
+		ID       int64  `db:"id"`
+		FilePath string `db:"file_path"`
+	}
+	err = tx.Select(&purges, `SELECT id, file_path FROM file_blob_purges ORDER BY id LIMIT 500 FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		return err
+	}
+
+	uploadDir, err := filepath.Abs(h.uploadDir)
+	if err != nil {
+		return err
+	}
+
+	var done []int64
+	for _, purge := range purges {
+		path, err := filepath.Abs(purge.FilePath)
+		if err != nil || !strings.HasPrefix(path, uploadDir+string(filepath.Separator)) {
+			log.Printf("Refusing to purge blob outside the upload directory: %s", purge.FilePath)
+			done = append(done, purge.ID)
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove blob %s: %v", path, err)
+			continue
+		}
+		done = append(done, purge.ID)
+	}
+
+	if len(done) > 0 {
+		if _, err := tx.Exec(`DELETE FROM file_blob_purges WHERE id = ANY($1)`, pq.Array(done)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func main() {
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
@@ -241,7 +385,8 @@ func main() {
 	log.Println("Connected to database successfully")
 
 	// Initialize handler
-	fileHandler := NewFileHandler(db)
+	fileHandler := NewFileHandler(db, config.Load())
+	go fileHandler.PurgeBlobs(10 * time.Minute)
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
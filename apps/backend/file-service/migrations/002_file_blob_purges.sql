@@ -0,0 +1,8 @@
+-- Blobs of files whose records were purged by data retention. The retention
+-- job runs outside file-service and cannot reach its storage, so it queues
+-- the paths here and file-service removes them.
+CREATE TABLE IF NOT EXISTS file_blob_purges (
+    id BIGSERIAL PRIMARY KEY,
+    file_path TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
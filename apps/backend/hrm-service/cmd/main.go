@@ -19,6 +19,7 @@ import (
 	"zplus-saas/apps/backend/shared/config"
 	"zplus-saas/apps/backend/shared/database"
 	"zplus-saas/apps/backend/shared/middleware"
+	"zplus-saas/apps/backend/shared/modulehooks"
 )
 
 func main() {
@@ -42,12 +43,14 @@ func main() {
 	departmentRepo := repositories.NewDepartmentRepository(db)
 	leaveRepo := repositories.NewLeaveRepository(db)
 	performanceRepo := repositories.NewPerformanceRepository(db)
+	moduleRepo := repositories.NewModuleRepository(db)
 
 	// Initialize services
 	employeeService := services.NewEmployeeService(employeeRepo)
 	departmentService := services.NewDepartmentService(departmentRepo)
 	leaveService := services.NewLeaveService(leaveRepo)
 	performanceService := services.NewPerformanceService(performanceRepo)
+	moduleHooks := services.NewModuleHooks(moduleRepo)
 
 	// Initialize handlers
 	employeeHandler := handlers.NewEmployeeHandler(employeeService)
@@ -91,12 +94,19 @@ func main() {
 		})
 	})
 
+	// JWTAuth supplies the user, tenant and permissions that record-level
+	// scoping is based on. Tenants that disabled the module are turned away.
+	app.Use("/api/v1", middleware.JWTAuth(cfg), modulehooks.RequireEnabled(moduleRepo, "HRM"))
+
 	// Setup routes
 	routes.SetupEmployeeRoutes(app, employeeHandler)
 	routes.SetupDepartmentRoutes(app, departmentHandler)
 	routes.SetupLeaveRoutes(app, leaveHandler)
 	routes.SetupPerformanceRoutes(app, performanceHandler)
 
+	// Module lifecycle hooks, run by tenant-service
+	app.Post(modulehooks.Path, middleware.JWTAuth(cfg), middleware.RequireService(), modulehooks.Endpoint(moduleHooks))
+
 	// Start server
 	port := os.Getenv("HRM_SERVICE_PORT")
 	if port == "" {
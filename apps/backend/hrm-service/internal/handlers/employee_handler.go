@@ -7,6 +7,7 @@ import (
 
 	"zplus-saas/apps/backend/hrm-service/internal/models"
 	"zplus-saas/apps/backend/hrm-service/internal/services"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
 type EmployeeHandler struct {
@@ -29,7 +30,7 @@ func (h *EmployeeHandler) CreateEmployee(c *fiber.Ctx) error {
 		})
 	}
 
-	employee, err := h.service.CreateEmployee(tenantID, &req)
+	employee, err := h.service.CreateEmployee(tenantID, middleware.CurrentAccess(c, "hrm.employee"), &req)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -56,7 +57,7 @@ func (h *EmployeeHandler) GetEmployee(c *fiber.Ctx) error {
 		})
 	}
 
-	employee, err := h.service.GetEmployee(tenantID, id)
+	employee, err := h.service.GetEmployee(tenantID, middleware.CurrentAccess(c, "hrm.employee"), id)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error":   true,
@@ -82,7 +83,7 @@ func (h *EmployeeHandler) GetEmployeeByEmail(c *fiber.Ctx) error {
 		})
 	}
 
-	employee, err := h.service.GetEmployeeByEmail(tenantID, email)
+	employee, err := h.service.GetEmployeeByEmail(tenantID, email, middleware.CurrentAccess(c, "hrm.employee"))
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error":   true,
@@ -112,7 +113,7 @@ func (h *EmployeeHandler) GetAllEmployees(c *fiber.Ctx) error {
 		}
 	}
 
-	employees, total, err := h.service.GetAllEmployees(tenantID, departmentID, status, page, limit)
+	employees, total, err := h.service.GetAllEmployees(tenantID, middleware.CurrentAccess(c, "hrm.employee"), departmentID, status, page, limit)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -154,7 +155,7 @@ func (h *EmployeeHandler) UpdateEmployee(c *fiber.Ctx) error {
 		})
 	}
 
-	employee, err := h.service.UpdateEmployee(tenantID, id, &req)
+	employee, err := h.service.UpdateEmployee(tenantID, middleware.CurrentAccess(c, "hrm.employee"), id, &req)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -181,7 +182,7 @@ func (h *EmployeeHandler) DeleteEmployee(c *fiber.Ctx) error {
 		})
 	}
 
-	err = h.service.DeleteEmployee(tenantID, id)
+	err = h.service.DeleteEmployee(tenantID, middleware.CurrentAccess(c, "hrm.employee"), id)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -210,7 +211,7 @@ func (h *EmployeeHandler) SearchEmployees(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("limit", "10"))
 
-	employees, total, err := h.service.SearchEmployees(tenantID, searchTerm, page, limit)
+	employees, total, err := h.service.SearchEmployees(tenantID, searchTerm, middleware.CurrentAccess(c, "hrm.employee"), page, limit)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error":   true,
@@ -26,6 +26,7 @@ type Department struct {
 type Employee struct {
 	ID             int        `json:"id" db:"id"`
 	TenantID       string     `json:"tenant_id" db:"tenant_id"`
+	UserID         *string    `json:"user_id" db:"user_id"` // Linked auth-service user
 	EmployeeCode   string     `json:"employee_code" db:"employee_code"`
 	FirstName      string     `json:"first_name" db:"first_name"`
 	LastName       string     `json:"last_name" db:"last_name"`
@@ -46,6 +47,10 @@ type Employee struct {
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
 
+	// MaskedFields lists the fields blanked out because the caller lacks the
+	// permission to read them
+	MaskedFields []string `json:"masked_fields,omitempty" db:"-"`
+
 	// Relations
 	Department *Department `json:"department,omitempty"`
 	Manager    *Employee   `json:"manager,omitempty"`
@@ -143,6 +148,7 @@ type HRMStats struct {
 
 // Employee creation/update request
 type EmployeeRequest struct {
+	UserID         *string    `json:"user_id"`
 	EmployeeCode   string     `json:"employee_code" validate:"required"`
 	FirstName      string     `json:"first_name" validate:"required"`
 	LastName       string     `json:"last_name" validate:"required"`
@@ -157,8 +163,8 @@ type EmployeeRequest struct {
 	Address        string     `json:"address"`
 	DateOfBirth    *time.Time `json:"date_of_birth"`
 	Gender         string     `json:"gender"`
-	EmergencyName  string     `json:"emergency_name"`
-	EmergencyPhone string     `json:"emergency_phone"`
+	EmergencyName  *string    `json:"emergency_name"`
+	EmergencyPhone *string    `json:"emergency_phone"`
 }
 
 // Leave request
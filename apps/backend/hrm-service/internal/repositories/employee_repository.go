@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"zplus-saas/apps/backend/hrm-service/internal/models"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
 type EmployeeRepository struct {
@@ -20,33 +21,34 @@ func (r *EmployeeRepository) Create(employee *models.Employee) error {
 	query := `
 		INSERT INTO employees (tenant_id, employee_code, first_name, last_name, email, phone, 
 			department_id, position, hire_date, salary, status, manager_id, address, 
-			date_of_birth, gender, emergency_name, emergency_phone, is_active, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, NOW(), NOW())
+			date_of_birth, gender, emergency_name, emergency_phone, is_active, user_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NULLIF($15, ''), $16, $17, $18, $19, NOW(), NOW())
 		RETURNING id, created_at, updated_at`
 
 	err := r.db.QueryRow(query, employee.TenantID, employee.EmployeeCode, employee.FirstName,
 		employee.LastName, employee.Email, employee.Phone, employee.DepartmentID,
 		employee.Position, employee.HireDate, employee.Salary, employee.Status,
 		employee.ManagerID, employee.Address, employee.DateOfBirth, employee.Gender,
-		employee.EmergencyName, employee.EmergencyPhone, employee.IsActive).Scan(
+		employee.EmergencyName, employee.EmergencyPhone, employee.IsActive, employee.UserID).Scan(
 		&employee.ID, &employee.CreatedAt, &employee.UpdatedAt)
 
 	return err
 }
 
-// Get employee by ID
-func (r *EmployeeRepository) GetByID(tenantID string, id int) (*models.Employee, error) {
+// Get employee by ID within the caller's data scope
+func (r *EmployeeRepository) GetByID(tenantID string, id int, access middleware.Access) (*models.Employee, error) {
+	scope, scopeArgs := employeeScopeCondition(access, 3)
 	employee := &models.Employee{}
 	query := `
-		SELECT id, tenant_id, employee_code, first_name, last_name, email, phone,
+		SELECT id, tenant_id, user_id, employee_code, first_name, last_name, email, phone,
 			department_id, position, hire_date, salary, status, manager_id, address,
-			date_of_birth, gender, emergency_name, emergency_phone, is_active, 
+			date_of_birth, COALESCE(gender, ''), emergency_name, emergency_phone, is_active, 
 			created_at, updated_at
 		FROM employees 
-		WHERE tenant_id = $1 AND id = $2 AND is_active = true`
+		WHERE tenant_id = $1 AND id = $2 AND is_active = true` + scope
 
-	err := r.db.QueryRow(query, tenantID, id).Scan(
-		&employee.ID, &employee.TenantID, &employee.EmployeeCode, &employee.FirstName,
+	err := r.db.QueryRow(query, append([]interface{}{tenantID, id}, scopeArgs...)...).Scan(
+		&employee.ID, &employee.TenantID, &employee.UserID, &employee.EmployeeCode, &employee.FirstName,
 		&employee.LastName, &employee.Email, &employee.Phone, &employee.DepartmentID,
 		&employee.Position, &employee.HireDate, &employee.Salary, &employee.Status,
 		&employee.ManagerID, &employee.Address, &employee.DateOfBirth, &employee.Gender,
@@ -60,19 +62,20 @@ func (r *EmployeeRepository) GetByID(tenantID string, id int) (*models.Employee,
 	return employee, nil
 }
 
-// Get employee by email
-func (r *EmployeeRepository) GetByEmail(tenantID, email string) (*models.Employee, error) {
+// Get employee by email within the caller's data scope
+func (r *EmployeeRepository) GetByEmail(tenantID, email string, access middleware.Access) (*models.Employee, error) {
+	scope, scopeArgs := employeeScopeCondition(access, 3)
 	employee := &models.Employee{}
 	query := `
-		SELECT id, tenant_id, employee_code, first_name, last_name, email, phone,
+		SELECT id, tenant_id, user_id, employee_code, first_name, last_name, email, phone,
 			department_id, position, hire_date, salary, status, manager_id, address,
-			date_of_birth, gender, emergency_name, emergency_phone, is_active, 
+			date_of_birth, COALESCE(gender, ''), emergency_name, emergency_phone, is_active, 
 			created_at, updated_at
 		FROM employees 
-		WHERE tenant_id = $1 AND email = $2 AND is_active = true`
+		WHERE tenant_id = $1 AND email = $2 AND is_active = true` + scope
 
-	err := r.db.QueryRow(query, tenantID, email).Scan(
-		&employee.ID, &employee.TenantID, &employee.EmployeeCode, &employee.FirstName,
+	err := r.db.QueryRow(query, append([]interface{}{tenantID, email}, scopeArgs...)...).Scan(
+		&employee.ID, &employee.TenantID, &employee.UserID, &employee.EmployeeCode, &employee.FirstName,
 		&employee.LastName, &employee.Email, &employee.Phone, &employee.DepartmentID,
 		&employee.Position, &employee.HireDate, &employee.Salary, &employee.Status,
 		&employee.ManagerID, &employee.Address, &employee.DateOfBirth, &employee.Gender,
@@ -86,8 +89,8 @@ func (r *EmployeeRepository) GetByEmail(tenantID, email string) (*models.Employe
 	return employee, nil
 }
 
-// Get all employees with filters
-func (r *EmployeeRepository) GetAll(tenantID string, departmentID *int, status string, limit, offset int) ([]models.Employee, int, error) {
+// Get all employees with filters within the caller's data scope
+func (r *EmployeeRepository) GetAll(tenantID string, access middleware.Access, departmentID *int, status string, limit, offset int) ([]models.Employee, int, error) {
 	var employees []models.Employee
 	var totalCount int
 
@@ -108,6 +111,11 @@ func (r *EmployeeRepository) GetAll(tenantID string, departmentID *int, status s
 		params = append(params, status)
 	}
 
+	scope, scopeArgs := employeeScopeCondition(access, paramCount+1)
+	whereClause += scope
+	params = append(params, scopeArgs...)
+	paramCount += len(scopeArgs)
+
 	// Count query
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM employees %s", whereClause)
 	err := r.db.QueryRow(countQuery, params...).Scan(&totalCount)
@@ -117,9 +125,9 @@ func (r *EmployeeRepository) GetAll(tenantID string, departmentID *int, status s
 
 	// Main query with pagination
 	query := fmt.Sprintf(`
-		SELECT id, tenant_id, employee_code, first_name, last_name, email, phone,
+		SELECT id, tenant_id, user_id, employee_code, first_name, last_name, email, phone,
 			department_id, position, hire_date, salary, status, manager_id, address,
-			date_of_birth, gender, emergency_name, emergency_phone, is_active, 
+			date_of_birth, COALESCE(gender, ''), emergency_name, emergency_phone, is_active, 
 			created_at, updated_at
 		FROM employees 
 		%s
@@ -137,7 +145,7 @@ func (r *EmployeeRepository) GetAll(tenantID string, departmentID *int, status s
 	for rows.Next() {
 		var employee models.Employee
 		err := rows.Scan(
-			&employee.ID, &employee.TenantID, &employee.EmployeeCode, &employee.FirstName,
+			&employee.ID, &employee.TenantID, &employee.UserID, &employee.EmployeeCode, &employee.FirstName,
 			&employee.LastName, &employee.Email, &employee.Phone, &employee.DepartmentID,
 			&employee.Position, &employee.HireDate, &employee.Salary, &employee.Status,
 			&employee.ManagerID, &employee.Address, &employee.DateOfBirth, &employee.Gender,
@@ -152,65 +160,71 @@ func (r *EmployeeRepository) GetAll(tenantID string, departmentID *int, status s
 	return employees, totalCount, nil
 }
 
-// Update employee
-func (r *EmployeeRepository) Update(employee *models.Employee) error {
+// Update employee within the caller's data scope
+func (r *EmployeeRepository) Update(employee *models.Employee, access middleware.Access) error {
+	scope, scopeArgs := employeeScopeCondition(access, 20)
 	query := `
 		UPDATE employees SET 
 			employee_code = $2, first_name = $3, last_name = $4, email = $5, phone = $6,
 			department_id = $7, position = $8, hire_date = $9, salary = $10, status = $11,
-			manager_id = $12, address = $13, date_of_birth = $14, gender = $15,
-			emergency_name = $16, emergency_phone = $17, updated_at = NOW()
-		WHERE tenant_id = $1 AND id = $18 AND is_active = true
+			manager_id = $12, address = $13, date_of_birth = $14, gender = NULLIF($15, ''),
+			emergency_name = $16, emergency_phone = $17, user_id = $19, updated_at = NOW()
+		WHERE tenant_id = $1 AND id = $18 AND is_active = true` + scope + `
 		RETURNING updated_at`
 
-	err := r.db.QueryRow(query, employee.TenantID, employee.EmployeeCode, employee.FirstName,
+	args := []interface{}{employee.TenantID, employee.EmployeeCode, employee.FirstName,
 		employee.LastName, employee.Email, employee.Phone, employee.DepartmentID,
 		employee.Position, employee.HireDate, employee.Salary, employee.Status,
 		employee.ManagerID, employee.Address, employee.DateOfBirth, employee.Gender,
-		employee.EmergencyName, employee.EmergencyPhone, employee.ID).Scan(&employee.UpdatedAt)
+		employee.EmergencyName, employee.EmergencyPhone, employee.ID, employee.UserID}
+
+	err := r.db.QueryRow(query, append(args, scopeArgs...)...).Scan(&employee.UpdatedAt)
 
 	return err
 }
 
-// Delete employee (soft delete)
-func (r *EmployeeRepository) Delete(tenantID string, id int) error {
+// Delete employee (soft delete) within the caller's data scope
+func (r *EmployeeRepository) Delete(tenantID string, id int, access middleware.Access) error {
+	scope, scopeArgs := employeeScopeCondition(access, 3)
 	query := `UPDATE employees SET is_active = false, updated_at = NOW() 
-			  WHERE tenant_id = $1 AND id = $2`
-	_, err := r.db.Exec(query, tenantID, id)
+			  WHERE tenant_id = $1 AND id = $2` + scope
+	_, err := r.db.Exec(query, append([]interface{}{tenantID, id}, scopeArgs...)...)
 	return err
 }
 
-// Search employees
-func (r *EmployeeRepository) Search(tenantID, searchTerm string, limit, offset int) ([]models.Employee, int, error) {
+// Search employees within the caller's data scope
+func (r *EmployeeRepository) Search(tenantID, searchTerm string, access middleware.Access, limit, offset int) ([]models.Employee, int, error) {
 	var employees []models.Employee
 	var totalCount int
 
 	searchPattern := "%" + searchTerm + "%"
 
 	// Count query
+	countScope, countScopeArgs := employeeScopeCondition(access, 3)
 	countQuery := `
 		SELECT COUNT(*) FROM employees 
 		WHERE tenant_id = $1 AND is_active = true 
-		AND (first_name ILIKE $2 OR last_name ILIKE $2 OR email ILIKE $2 OR employee_code ILIKE $2)`
+		AND (first_name ILIKE $2 OR last_name ILIKE $2 OR email ILIKE $2 OR employee_code ILIKE $2)` + countScope
 
-	err := r.db.QueryRow(countQuery, tenantID, searchPattern).Scan(&totalCount)
+	err := r.db.QueryRow(countQuery, append([]interface{}{tenantID, searchPattern}, countScopeArgs...)...).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// Main query
+	scope, scopeArgs := employeeScopeCondition(access, 5)
 	query := `
-		SELECT id, tenant_id, employee_code, first_name, last_name, email, phone,
+		SELECT id, tenant_id, user_id, employee_code, first_name, last_name, email, phone,
 			department_id, position, hire_date, salary, status, manager_id, address,
-			date_of_birth, gender, emergency_name, emergency_phone, is_active, 
+			date_of_birth, COALESCE(gender, ''), emergency_name, emergency_phone, is_active, 
 			created_at, updated_at
 		FROM employees 
 		WHERE tenant_id = $1 AND is_active = true 
-		AND (first_name ILIKE $2 OR last_name ILIKE $2 OR email ILIKE $2 OR employee_code ILIKE $2)
+		AND (first_name ILIKE $2 OR last_name ILIKE $2 OR email ILIKE $2 OR employee_code ILIKE $2)` + scope + `
 		ORDER BY created_at DESC
 		LIMIT $3 OFFSET $4`
 
-	rows, err := r.db.Query(query, tenantID, searchPattern, limit, offset)
+	rows, err := r.db.Query(query, append([]interface{}{tenantID, searchPattern, limit, offset}, scopeArgs...)...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -219,7 +233,7 @@ func (r *EmployeeRepository) Search(tenantID, searchTerm string, limit, offset i
 	for rows.Next() {
 		var employee models.Employee
 		err := rows.Scan(
-			&employee.ID, &employee.TenantID, &employee.EmployeeCode, &employee.FirstName,
+			&employee.ID, &employee.TenantID, &employee.UserID, &employee.EmployeeCode, &employee.FirstName,
 			&employee.LastName, &employee.Email, &employee.Phone, &employee.DepartmentID,
 			&employee.Position, &employee.HireDate, &employee.Salary, &employee.Status,
 			&employee.ManagerID, &employee.Address, &employee.DateOfBirth, &employee.Gender,
@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/shared/modulehooks"
+)
+
+// ModuleRepository records which tenants have the HRM module set up
+type ModuleRepository struct {
+	*modulehooks.TenantModules
+	db *sql.DB
+}
+
+func NewModuleRepository(db *sql.DB) *ModuleRepository {
+	return &ModuleRepository{
+		TenantModules: modulehooks.NewTenantModules(db, "hrm_tenant_modules", seedDepartments),
+		db:            db,
+	}
+}
+
+// seedDepartments gives a new tenant a default department to add employees
+// to
+func seedDepartments(ctx context.Context, tx *sql.Tx, tenantID string) error {
+	query := `
+		INSERT INTO departments (tenant_id, name, description, is_active, created_at, updated_at)
+		SELECT $1, 'General', 'Default department', true, $2, $2
+		WHERE NOT EXISTS (SELECT 1 FROM departments WHERE tenant_id = $1)
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, time.Now()); err != nil {
+		return fmt.Errorf("failed to seed departments: %w", err)
+	}
+	return nil
+}
+
+// defaultLeavePolicies are the days of each leave type a tenant's employees
+// get per year unless it changes them
+var defaultLeavePolicies = []struct {
+	leaveType string
+	days      int
+}{
+	{"annual", 12},
+	{"sick", 10},
+	{"maternity", 180},
+	{"paternity", 5},
+	{"personal", 3},
+	{"emergency", 3},
+}
+
+// SeedLeavePolicies gives a tenant the default leave policies, keeping the
+// policies it already has
+func (r *ModuleRepository) SeedLeavePolicies(ctx context.Context, tenantID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO hrm_leave_policies (tenant_id, leave_type, days_per_year, is_default, created_at, updated_at)
+		VALUES ($1, $2, $3, true, $4, $4)
+		ON CONFLICT (tenant_id, leave_type) DO NOTHING
+	`
+	now := time.Now()
+	for _, policy := range defaultLeavePolicies {
+		if _, err := tx.ExecContext(ctx, query, tenantID, policy.leaveType, policy.days, now); err != nil {
+			return fmt.Errorf("failed to seed leave policies: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveDefaultLeavePolicies removes the default leave policies of a
+// tenant, keeping the policies it changed
+func (r *ModuleRepository) RemoveDefaultLeavePolicies(ctx context.Context, tenantID string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM hrm_leave_policies WHERE tenant_id = $1 AND is_default = true", tenantID); err != nil {
+		return fmt.Errorf("failed to remove leave policies: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package repositories
+
+import (
+	"fmt"
+
+	"zplus-saas/apps/backend/shared/middleware"
+)
+
+// employeeScopeCondition restricts a query on the employees table to the
+// employees the caller may access. The returned arguments start at $param.
+//
+// Callers are matched to their own employee record through employees.user_id.
+// Team scope adds their direct reports and their department's employees.
+func employeeScopeCondition(access middleware.Access, param int) (string, []interface{}) {
+	switch access.Scope {
+	case middleware.DataScopeTenant:
+		return "", nil
+	case middleware.DataScopeTeam:
+		return fmt.Sprintf(` AND (employees.user_id = $%[1]d OR EXISTS (
+			SELECT 1 FROM employees me
+			WHERE me.tenant_id = employees.tenant_id AND me.user_id = $%[1]d AND me.is_active = true
+			AND (employees.manager_id = me.id OR employees.department_id = me.department_id)))`, param), []interface{}{access.UserID}
+	default:
+		return fmt.Sprintf(" AND employees.user_id = $%d", param), []interface{}{access.UserID}
+	}
+}
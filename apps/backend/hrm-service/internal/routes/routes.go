@@ -4,24 +4,31 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"zplus-saas/apps/backend/hrm-service/internal/handlers"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
+// SetupEmployeeRoutes sets up employee routes. Handlers only see employees
+// within the caller's data scope (hrm.employee.scope.team /
+// hrm.employee.scope.tenant).
 func SetupEmployeeRoutes(app *fiber.App, handler *handlers.EmployeeHandler) {
 	api := app.Group("/api/v1/employees")
 
-	// Employee CRUD operations
-	api.Post("/", handler.CreateEmployee)
-	api.Get("/:id", handler.GetEmployee)
-	api.Get("/", handler.GetAllEmployees)
-	api.Put("/:id", handler.UpdateEmployee)
-	api.Delete("/:id", handler.DeleteEmployee)
+	read := middleware.RequirePermission("hrm.employee.read")
+	write := middleware.RequirePermission("hrm.employee.write")
 
-	// Additional employee operations
-	api.Get("/search", handler.SearchEmployees)
-	api.Get("/by-email", handler.GetEmployeeByEmail)
+	// Static paths go before /:id so they are not matched as an ID
+	api.Get("/search", read, handler.SearchEmployees)
+	api.Get("/by-email", read, handler.GetEmployeeByEmail)
 
 	// Statistics
-	api.Get("/statistics/hrm", handler.GetHRMStatistics)
+	api.Get("/statistics/hrm", read, handler.GetHRMStatistics)
+
+	// Employee CRUD operations
+	api.Post("/", write, handler.CreateEmployee)
+	api.Get("/:id", read, handler.GetEmployee)
+	api.Get("/", read, handler.GetAllEmployees)
+	api.Put("/:id", write, handler.UpdateEmployee)
+	api.Delete("/:id", middleware.RequirePermission("hrm.employee.delete"), handler.DeleteEmployee)
 }
 
 func SetupDepartmentRoutes(app *fiber.App, handler *handlers.DepartmentHandler) {
@@ -7,23 +7,57 @@ import (
 
 	"zplus-saas/apps/backend/hrm-service/internal/models"
 	"zplus-saas/apps/backend/hrm-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/middleware"
 )
 
+// Permissions guarding sensitive employee fields. Without them the fields
+// are masked in responses and left untouched on update.
+const (
+	PermissionSalaryRead           = "hrm.salary.read"
+	PermissionSalaryWrite          = "hrm.salary.write"
+	PermissionEmergencyContactRead = "hrm.employee.emergency.read"
+)
+
+// EmployeeStore stores employees within the caller's data scope. It is
+// implemented by repositories.EmployeeRepository.
+type EmployeeStore interface {
+	Create(employee *models.Employee) error
+	GetByID(tenantID string, id int, access middleware.Access) (*models.Employee, error)
+	GetByEmail(tenantID, email string, access middleware.Access) (*models.Employee, error)
+	GetAll(tenantID string, access middleware.Access, departmentID *int, status string, limit, offset int) ([]models.Employee, int, error)
+	Update(employee *models.Employee, access middleware.Access) error
+	Delete(tenantID string, id int, access middleware.Access) error
+	Search(tenantID, searchTerm string, access middleware.Access, limit, offset int) ([]models.Employee, int, error)
+	GetHRMStats(tenantID string) (*models.HRMStats, error)
+}
+
+var _ EmployeeStore = (*repositories.EmployeeRepository)(nil)
+
 type EmployeeService struct {
-	repo *repositories.EmployeeRepository
+	repo EmployeeStore
 }
 
-func NewEmployeeService(repo *repositories.EmployeeRepository) *EmployeeService {
+func NewEmployeeService(repo EmployeeStore) *EmployeeService {
 	return &EmployeeService{repo: repo}
 }
 
 // Create employee
-func (s *EmployeeService) CreateEmployee(tenantID string, req *models.EmployeeRequest) (*models.Employee, error) {
+func (s *EmployeeService) CreateEmployee(tenantID string, access middleware.Access, req *models.EmployeeRequest) (*models.Employee, error) {
 	// Validate employee code uniqueness (this would need another repo method)
 	// For now, we'll assume it's handled by database constraints
 
+	if req.Salary != 0 && !access.Can(PermissionSalaryWrite) {
+		return nil, errors.New("setting a salary requires the " + PermissionSalaryWrite + " permission")
+	}
+
+	// The user link decides whose records these are, see UpdateEmployee
+	if req.UserID != nil && access.Scope != middleware.DataScopeTenant {
+		return nil, errors.New("linking an employee to a user requires tenant-wide access")
+	}
+
 	employee := &models.Employee{
 		TenantID:       tenantID,
+		UserID:         req.UserID,
 		EmployeeCode:   req.EmployeeCode,
 		FirstName:      req.FirstName,
 		LastName:       req.LastName,
@@ -38,8 +72,8 @@ func (s *EmployeeService) CreateEmployee(tenantID string, req *models.EmployeeRe
 		Address:        req.Address,
 		DateOfBirth:    req.DateOfBirth,
 		Gender:         req.Gender,
-		EmergencyName:  req.EmergencyName,
-		EmergencyPhone: req.EmergencyPhone,
+		EmergencyName:  stringValue(req.EmergencyName),
+		EmergencyPhone: stringValue(req.EmergencyPhone),
 		IsActive:       true,
 	}
 
@@ -48,31 +82,37 @@ func (s *EmployeeService) CreateEmployee(tenantID string, req *models.EmployeeRe
 		return nil, fmt.Errorf("failed to create employee: %w", err)
 	}
 
+	maskEmployee(employee, access)
+
 	return employee, nil
 }
 
 // Get employee by ID
-func (s *EmployeeService) GetEmployee(tenantID string, id int) (*models.Employee, error) {
-	employee, err := s.repo.GetByID(tenantID, id)
+func (s *EmployeeService) GetEmployee(tenantID string, access middleware.Access, id int) (*models.Employee, error) {
+	employee, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return nil, fmt.Errorf("employee not found: %w", err)
 	}
 
+	maskEmployee(employee, access)
+
 	return employee, nil
 }
 
 // Get employee by email
-func (s *EmployeeService) GetEmployeeByEmail(tenantID, email string) (*models.Employee, error) {
-	employee, err := s.repo.GetByEmail(tenantID, email)
+func (s *EmployeeService) GetEmployeeByEmail(tenantID, email string, access middleware.Access) (*models.Employee, error) {
+	employee, err := s.repo.GetByEmail(tenantID, email, access)
 	if err != nil {
 		return nil, fmt.Errorf("employee not found: %w", err)
 	}
 
+	maskEmployee(employee, access)
+
 	return employee, nil
 }
 
 // Get all employees with pagination and filters
-func (s *EmployeeService) GetAllEmployees(tenantID string, departmentID *int, status string, page, limit int) ([]models.Employee, int, error) {
+func (s *EmployeeService) GetAllEmployees(tenantID string, access middleware.Access, departmentID *int, status string, page, limit int) ([]models.Employee, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -82,22 +122,55 @@ func (s *EmployeeService) GetAllEmployees(tenantID string, departmentID *int, st
 
 	offset := (page - 1) * limit
 
-	employees, total, err := s.repo.GetAll(tenantID, departmentID, status, limit, offset)
+	employees, total, err := s.repo.GetAll(tenantID, access, departmentID, status, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to get employees: %w", err)
 	}
 
+	for i := range employees {
+		maskEmployee(&employees[i], access)
+	}
+
 	return employees, total, nil
 }
 
 // Update employee
-func (s *EmployeeService) UpdateEmployee(tenantID string, id int, req *models.EmployeeRequest) (*models.Employee, error) {
+func (s *EmployeeService) UpdateEmployee(tenantID string, access middleware.Access, id int, req *models.EmployeeRequest) (*models.Employee, error) {
 	// Get existing employee
-	employee, err := s.repo.GetByID(tenantID, id)
+	employee, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return nil, fmt.Errorf("employee not found: %w", err)
 	}
 
+	// A caller who cannot read the salary sees it as 0; sending that back
+	// leaves it unchanged
+	if req.Salary != employee.Salary && !(req.Salary == 0 && !access.Can(PermissionSalaryRead)) {
+		if !access.Can(PermissionSalaryWrite) {
+			return nil, errors.New("changing a salary requires the " + PermissionSalaryWrite + " permission")
+		}
+		employee.Salary = req.Salary
+	}
+
+	// Masked emergency contacts come back empty and are kept
+	canReadContact := access.Can(PermissionEmergencyContactRead)
+	setEmergencyContact(&employee.EmergencyName, req.EmergencyName, canReadContact)
+	setEmergencyContact(&employee.EmergencyPhone, req.EmergencyPhone, canReadContact)
+
+	// The user link, department and manager decide who sees whose records
+	// (see repositories.employeeScopeCondition), so only callers who see
+	// the whole tenant may change them
+	if req.UserID != nil && !sameUser(req.UserID, employee.UserID) {
+		if access.Scope != middleware.DataScopeTenant {
+			return nil, errors.New("linking an employee to a user requires tenant-wide access")
+		}
+		employee.UserID = req.UserID
+	}
+	if req.DepartmentID != employee.DepartmentID || !sameManager(req.ManagerID, employee.ManagerID) {
+		if access.Scope != middleware.DataScopeTenant {
+			return nil, errors.New("moving an employee to another department or manager requires tenant-wide access")
+		}
+	}
+
 	// Update fields
 	employee.EmployeeCode = req.EmployeeCode
 	employee.FirstName = req.FirstName
@@ -107,32 +180,31 @@ func (s *EmployeeService) UpdateEmployee(tenantID string, id int, req *models.Em
 	employee.DepartmentID = req.DepartmentID
 	employee.Position = req.Position
 	employee.HireDate = req.HireDate
-	employee.Salary = req.Salary
 	employee.Status = req.Status
 	employee.ManagerID = req.ManagerID
 	employee.Address = req.Address
 	employee.DateOfBirth = req.DateOfBirth
 	employee.Gender = req.Gender
-	employee.EmergencyName = req.EmergencyName
-	employee.EmergencyPhone = req.EmergencyPhone
 
-	err = s.repo.Update(employee)
+	err = s.repo.Update(employee, access)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update employee: %w", err)
 	}
 
+	maskEmployee(employee, access)
+
 	return employee, nil
 }
 
 // Delete employee
-func (s *EmployeeService) DeleteEmployee(tenantID string, id int) error {
+func (s *EmployeeService) DeleteEmployee(tenantID string, access middleware.Access, id int) error {
 	// Check if employee exists
-	_, err := s.repo.GetByID(tenantID, id)
+	_, err := s.repo.GetByID(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("employee not found: %w", err)
 	}
 
-	err = s.repo.Delete(tenantID, id)
+	err = s.repo.Delete(tenantID, id, access)
 	if err != nil {
 		return fmt.Errorf("failed to delete employee: %w", err)
 	}
@@ -141,7 +213,7 @@ func (s *EmployeeService) DeleteEmployee(tenantID string, id int) error {
 }
 
 // Search employees
-func (s *EmployeeService) SearchEmployees(tenantID, searchTerm string, page, limit int) ([]models.Employee, int, error) {
+func (s *EmployeeService) SearchEmployees(tenantID, searchTerm string, access middleware.Access, page, limit int) ([]models.Employee, int, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -151,11 +223,15 @@ func (s *EmployeeService) SearchEmployees(tenantID, searchTerm string, page, lim
 
 	offset := (page - 1) * limit
 
-	employees, total, err := s.repo.Search(tenantID, searchTerm, limit, offset)
+	employees, total, err := s.repo.Search(tenantID, searchTerm, access, limit, offset)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to search employees: %w", err)
 	}
 
+	for i := range employees {
+		maskEmployee(&employees[i], access)
+	}
+
 	return employees, total, nil
 }
 
@@ -205,3 +281,46 @@ func (s *EmployeeService) validateEmployeeRequest(req *models.EmployeeRequest) e
 
 	return nil
 }
+
+// maskEmployee blanks out the sensitive fields the caller may not read
+func maskEmployee(employee *models.Employee, access middleware.Access) {
+	if !access.Can(PermissionSalaryRead) {
+		employee.Salary = 0
+		employee.MaskedFields = append(employee.MaskedFields, "salary")
+	}
+	if !access.Can(PermissionEmergencyContactRead) {
+		employee.EmergencyName = ""
+		employee.EmergencyPhone = ""
+		employee.MaskedFields = append(employee.MaskedFields, "emergency_name", "emergency_phone")
+	}
+}
+
+// setEmergencyContact overwrites an emergency contact field the client sent.
+// Callers who cannot read it get it masked, so their empty value keeps it.
+func setEmergencyContact(field, sent *string, canRead bool) {
+	if sent == nil || *sent == "" && !canRead {
+		return
+	}
+	*field = *sent
+}
+
+func sameUser(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func sameManager(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
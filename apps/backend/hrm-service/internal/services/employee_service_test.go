@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/hrm-service/internal/models"
+	"zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateEmployeeUserLinkRequiresTenantScope(t *testing.T) {
+	repo := newFakeEmployeeStore()
+	svc := NewEmployeeService(repo)
+	userID := "user-2"
+
+	for _, scope := range []middleware.DataScope{middleware.DataScopeOwn, middleware.DataScopeTeam} {
+		req := newEmployeeRequest()
+		req.UserID = &userID
+		_, err := svc.CreateEmployee("tenant-1", middleware.Access{UserID: "user-1", Scope: scope}, req)
+		assert.ErrorContains(t, err, "tenant-wide access", "scope %s", scope)
+	}
+	assert.Empty(t, repo.employees)
+
+	_, err := svc.CreateEmployee("tenant-1", middleware.Access{UserID: "user-1", Scope: middleware.DataScopeTeam}, newEmployeeRequest())
+	require.NoError(t, err, "employees without a user link need no tenant scope")
+
+	req := newEmployeeRequest()
+	req.UserID = &userID
+	employee, err := svc.CreateEmployee("tenant-1", middleware.Access{UserID: "admin", Scope: middleware.DataScopeTenant}, req)
+	require.NoError(t, err)
+	assert.Equal(t, &userID, employee.UserID)
+}
+
+func TestUpdateEmployeeDepartmentAndManagerRequireTenantScope(t *testing.T) {
+	repo := newFakeEmployeeStore()
+	svc := NewEmployeeService(repo)
+	userID, managerID := "user-1", 7
+	own := repo.add(&models.Employee{TenantID: "tenant-1", UserID: &userID, DepartmentID: 1, ManagerID: &managerID})
+	team := middleware.Access{UserID: userID, Scope: middleware.DataScopeTeam}
+
+	otherManager := 8
+	for name, change := range map[string]func(*models.EmployeeRequest){
+		"department":     func(req *models.EmployeeRequest) { req.DepartmentID = 2 },
+		"manager":        func(req *models.EmployeeRequest) { req.ManagerID = &otherManager },
+		"no manager":     func(req *models.EmployeeRequest) { req.ManagerID = nil },
+		"other user":     func(req *models.EmployeeRequest) { other := "user-2"; req.UserID = &other },
+		"unchanged link": func(req *models.EmployeeRequest) {},
+	} {
+		req := newEmployeeRequest()
+		req.UserID, req.DepartmentID, req.ManagerID = &userID, 1, &managerID
+		change(req)
+
+		_, err := svc.UpdateEmployee("tenant-1", team, own.ID, req)
+		if name == "unchanged link" {
+			assert.NoError(t, err)
+			continue
+		}
+		assert.ErrorContains(t, err, "tenant-wide access", name)
+		assert.Equal(t, 1, repo.employees[own.ID].DepartmentID, name)
+		assert.Equal(t, &managerID, repo.employees[own.ID].ManagerID, name)
+	}
+
+	req := newEmployeeRequest()
+	req.UserID, req.DepartmentID, req.ManagerID = &userID, 2, &otherManager
+	employee, err := svc.UpdateEmployee("tenant-1", middleware.Access{UserID: "admin", Scope: middleware.DataScopeTenant}, own.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, 2, employee.DepartmentID)
+	assert.Equal(t, &otherManager, employee.ManagerID)
+}
+
+func TestUpdateEmployeeKeepsEmergencyContactFieldsNotSent(t *testing.T) {
+	repo := newFakeEmployeeStore()
+	svc := NewEmployeeService(repo)
+	stored := repo.add(&models.Employee{TenantID: "tenant-1", DepartmentID: 1, EmergencyName: "John", EmergencyPhone: "555-0100"})
+	admin := middleware.Access{UserID: "admin", Scope: middleware.DataScopeTenant, Permissions: []string{PermissionEmergencyContactRead}}
+
+	name := "Mary"
+	req := newEmployeeRequest()
+	req.EmergencyName = &name
+	_, err := svc.UpdateEmployee("tenant-1", admin, stored.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Mary", repo.employees[stored.ID].EmergencyName)
+	assert.Equal(t, "555-0100", repo.employees[stored.ID].EmergencyPhone)
+
+	// Callers who see the contact masked send it back empty
+	empty := ""
+	req = newEmployeeRequest()
+	req.EmergencyName, req.EmergencyPhone = &empty, &empty
+	_, err = svc.UpdateEmployee("tenant-1", middleware.Access{UserID: "admin", Scope: middleware.DataScopeTenant}, stored.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Mary", repo.employees[stored.ID].EmergencyName)
+	assert.Equal(t, "555-0100", repo.employees[stored.ID].EmergencyPhone)
+
+	// Callers who can read it may clear it
+	req = newEmployeeRequest()
+	req.EmergencyPhone = &empty
+	_, err = svc.UpdateEmployee("tenant-1", admin, stored.ID, req)
+	require.NoError(t, err)
+	assert.Equal(t, "Mary", repo.employees[stored.ID].EmergencyName)
+	assert.Empty(t, repo.employees[stored.ID].EmergencyPhone)
+}
+
+func newEmployeeRequest() *models.EmployeeRequest {
+	return &models.EmployeeRequest{
+		EmployeeCode: "E-001",
+		FirstName:    "Jane",
+		LastName:     "Doe",
+		Email:        "jane@example.com",
+		DepartmentID: 1,
+		Position:     "Engineer",
+		HireDate:     time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Status:       models.EmployeeStatusActive,
+	}
+}
+
+// In-memory employee store. It ignores the data scope, which the
+// repository's queries apply.
+type fakeEmployeeStore struct {
+	employees map[int]*models.Employee
+	nextID    int
+}
+
+func newFakeEmployeeStore() *fakeEmployeeStore {
+	return &fakeEmployeeStore{employees: map[int]*models.Employee{}}
+}
+
+func (r *fakeEmployeeStore) add(employee *models.Employee) *models.Employee {
+	r.nextID++
+	employee.ID = r.nextID
+	copied := *employee
+	r.employees[employee.ID] = &copied
+	return employee
+}
+
+func (r *fakeEmployeeStore) Create(employee *models.Employee) error {
+	r.add(employee)
+	return nil
+}
+
+func (r *fakeEmployeeStore) GetByID(tenantID string, id int, access middleware.Access) (*models.Employee, error) {
+	employee, ok := r.employees[id]
+	if !ok || employee.TenantID != tenantID {
+		return nil, fmt.Errorf("employee %d not found", id)
+	}
+	copied := *employee
+	return &copied, nil
+}
+
+func (r *fakeEmployeeStore) GetByEmail(tenantID, email string, access middleware.Access) (*models.Employee, error) {
+	for _, employee := range r.employees {
+		if employee.TenantID == tenantID && employee.Email == email {
+			copied := *employee
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("employee %s not found", email)
+}
+
+func (r *fakeEmployeeStore) GetAll(tenantID string, access middleware.Access, departmentID *int, status string, limit, offset int) ([]models.Employee, int, error) {
+	return nil, 0, nil
+}
+
+func (r *fakeEmployeeStore) Update(employee *models.Employee, access middleware.Access) error {
+	copied := *employee
+	r.employees[employee.ID] = &copied
+	return nil
+}
+
+func (r *fakeEmployeeStore) Delete(tenantID string, id int, access middleware.Access) error {
+	delete(r.employees, id)
+	return nil
+}
+
+func (r *fakeEmployeeStore) Search(tenantID, searchTerm string, access middleware.Access, limit, offset int) ([]models.Employee, int, error) {
+	return nil, 0, nil
+}
+
+func (r *fakeEmployeeStore) GetHRMStats(tenantID string) (*models.HRMStats, error) {
+	return &models.HRMStats{}, nil
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+
+	"zplus-saas/apps/backend/hrm-service/internal/repositories"
+	"zplus-saas/apps/backend/shared/modulehooks"
+)
+
+// moduleData is the tenant data the HRM module's migrations change
+type moduleData interface {
+	SeedLeavePolicies(ctx context.Context, tenantID string) error
+	RemoveDefaultLeavePolicies(ctx context.Context, tenantID string) error
+}
+
+// moduleMigrations are the version-specific steps upgrading and rolling
+// back a tenant's HRM data
+func moduleMigrations(data moduleData) modulehooks.Migrations {
+	return modulehooks.Migrations{
+		// 1.1.0 adds leave policies, starting with the default allowances
+		{Version: "1.1.0", Up: data.SeedLeavePolicies, Down: data.RemoveDefaultLeavePolicies},
+	}
+}
+
+// NewModuleHooks returns the lifecycle hooks tenant-service runs when a
+// tenant installs, upgrades, rolls back, enables, disables or uninstalls the
+// HRM module
+func NewModuleHooks(repo *repositories.ModuleRepository) modulehooks.Hooks {
+	return modulehooks.NewHooks(repo, moduleMigrations(repo))
+}
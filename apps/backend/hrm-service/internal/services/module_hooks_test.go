@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"zplus-saas/apps/backend/shared/modulehooks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeModuleStore keeps one tenant's HRM module row and leave policies
+type fakeModuleStore struct {
+	installed     bool
+	version       string
+	leavePolicies int
+}
+
+func (s *fakeModuleStore) Install(ctx context.Context, tenantID string) error {
+	if !s.installed && s.version == "" {
+		s.version = modulehooks.BaseVersion
+	}
+	s.installed = true
+	return nil
+}
+
+func (s *fakeModuleStore) Version(ctx context.Context, tenantID string) (string, error) {
+	if !s.installed {
+		return "", fmt.Errorf("module is not installed for tenant")
+	}
+	return s.version, nil
+}
+
+func (s *fakeModuleStore) SetVersion(ctx context.Context, tenantID, version string) error {
+	s.version = version
+	return nil
+}
+
+func (s *fakeModuleStore) SetEnabled(ctx context.Context, tenantID string, enabled bool) error {
+	return nil
+}
+
+func (s *fakeModuleStore) Uninstall(ctx context.Context, tenantID string) error {
+	s.installed = false
+	return nil
+}
+
+func (s *fakeModuleStore) SeedLeavePolicies(ctx context.Context, tenantID string) error {
+	s.leavePolicies = 6
+	return nil
+}
+
+func (s *fakeModuleStore) RemoveDefaultLeavePolicies(ctx context.Context, tenantID string) error {
+	s.leavePolicies = 0
+	return nil
+}
+
+func TestModuleHooksUpgradeAndRollBackLeavePolicies(t *testing.T) {
+	store := &fakeModuleStore{}
+	hooks := modulehooks.NewHooks(store, moduleMigrations(store))
+	run := func(event, version, fromVersion string) {
+		t.Helper()
+		err := hooks[event](context.Background(), &modulehooks.Request{Event: event, TenantID: "tenant-1", Module: "hrm", Version: version, FromVersion: fromVersion})
+		require.NoError(t, err, "%s to %s", event, version)
+	}
+
+	run(modulehooks.EventInstall, "1.0.0", "")
+	assert.Equal(t, "1.0.0", store.version)
+	assert.Zero(t, store.leavePolicies, "1.0.0 has no leave policies")
+
+	run(modulehooks.EventUpgrade, "1.1.0", "1.0.0")
+	assert.Equal(t, "1.1.0", store.version)
+	assert.Equal(t, 6, store.leavePolicies)
+
+	// A retried upgrade finds the tenant migrated already
+	run(modulehooks.EventUpgrade, "1.1.0", "1.0.0")
+	assert.Equal(t, 6, store.leavePolicies)
+
+	run(modulehooks.EventRollback, "1.0.0", "1.1.0")
+	assert.Equal(t, "1.0.0", store.version)
+	assert.Zero(t, store.leavePolicies, "rolling back removes the default leave policies")
+
+	// Reinstalling after an uninstall keeps the version the data is at
+	run(modulehooks.EventUninstall, "1.0.0", "")
+	run(modulehooks.EventInstall, "1.1.0", "")
+	assert.Equal(t, "1.1.0", store.version)
+	assert.Equal(t, 6, store.leavePolicies)
+}
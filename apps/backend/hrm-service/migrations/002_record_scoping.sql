@@ -0,0 +1,17 @@
+-- HRM Service Database Migration - Record-Level Access Control
+-- Version: 002
+-- Created: 2026-10-19
+
+-- Link employees to their auth-service user so data scopes (own record,
+-- team, tenant) can be resolved from the caller's token
+ALTER TABLE employees ADD COLUMN IF NOT EXISTS user_id VARCHAR(255);
+
+-- Backfill links for employees whose email matches a user of the same tenant
+UPDATE employees e
+SET user_id = u.id::text
+FROM users u
+WHERE e.user_id IS NULL
+  AND u.tenant_id::text = e.tenant_id
+  AND LOWER(u.email) = LOWER(e.email);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_employees_user_id ON employees(tenant_id, user_id) WHERE user_id IS NOT NULL AND is_active = true;
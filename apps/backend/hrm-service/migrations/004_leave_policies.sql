@@ -0,0 +1,16 @@
+-- HRM Service Database Schema
+-- Migration: 004_leave_policies.sql
+-- Description: Adds each tenant's leave policies, seeded by the module's 1.1.0 upgrade hook
+
+-- How many days of each leave type a tenant's employees get per year.
+-- Upgrading the module to 1.1.0 seeds the default policies; rolling it back
+-- removes the defaults again and keeps the policies the tenant changed.
+CREATE TABLE IF NOT EXISTS hrm_leave_policies (
+    tenant_id VARCHAR(255) NOT NULL,
+    leave_type VARCHAR(20) NOT NULL CHECK (leave_type IN ('annual', 'sick', 'maternity', 'paternity', 'personal', 'emergency')),
+    days_per_year INTEGER NOT NULL CHECK (days_per_year >= 0),
+    is_default BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, leave_type)
+);
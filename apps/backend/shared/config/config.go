@@ -24,6 +24,49 @@ type Config struct {
 	JWTRefreshExpiresIn string
 	JWTIssuer           string
 	JWTAudience         string
+	// JWTServiceAudience is the audience of service-to-service tokens, so
+	// they are never mistaken for user tokens
+	JWTServiceAudience string
+
+	// SSO
+	OIDCRedirectURL string
+	SAMLBaseURL     string
+	SCIMBaseURL     string
+
+	// Passwords
+	BreachedPasswordsDir string // offline k-anonymity range files, empty disables the breach check
+
+	// Comma-separated IPs or CIDR ranges allowed to set X-Forwarded-For (the
+	// load balancer and the API gateway); only loopback unless configured
+	TrustedProxies string
+
+	// Outgoing email: smtp, file (EMAIL_FILE_DIR, stdout when empty) or http
+	EmailDriver       string
+	EmailFileDir      string
+	EmailHTTPEndpoint string
+	EmailHTTPAPIKey   string
+
+	// SMTP, empty host logs emails instead of sending them
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPFromName string
+
+	// Links in emails point at the tenant's custom domain, else at
+	// {subdomain}.TenantBaseDomain, else at AppURL
+	AppURL           string
+	TenantBaseDomain string
+
+	// Subscription billing. BillingChargeURL charges an invoice with the
+	// tenant's payment method; empty means invoices are only paid by recording
+	// a payment. A failed payment is retried DunningRetryDays (comma-separated
+	// days after the failure) and the tenant becomes read-only
+	// DunningGraceDays after it.
+	BillingChargeURL string
+	DunningRetryDays string
+	DunningGraceDays int
 
 	// Services URLs
 	AuthServiceURL    string
@@ -73,6 +116,39 @@ func Load() *Config {
 		JWTRefreshExpiresIn: getEnv("JWT_REFRESH_EXPIRES_IN", "168h"), // 7 days = 168 hours
 		JWTIssuer:           getEnv("JWT_ISSUER", "zplus-saas"),
 		JWTAudience:         getEnv("JWT_AUDIENCE", "zplus-users"),
+		JWTServiceAudience:  getEnv("JWT_SERVICE_AUDIENCE", "zplus-services"),
+
+		// SSO
+		OIDCRedirectURL: getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+		SAMLBaseURL:     getEnv("SAML_BASE_URL", "http://localhost:8080/api/v1/auth/saml"),
+		SCIMBaseURL:     getEnv("SCIM_BASE_URL", "http://localhost:8080/api/v1/scim/v2"),
+
+		// Passwords
+		BreachedPasswordsDir: getEnv("BREACHED_PASSWORDS_DIR", ""),
+
+		TrustedProxies: getEnv("TRUSTED_PROXIES", "127.0.0.1,::1"),
+
+		// Email
+		EmailDriver:       getEnv("EMAIL_DRIVER", "smtp"),
+		EmailFileDir:      getEnv("EMAIL_FILE_DIR", ""),
+		EmailHTTPEndpoint: getEnv("EMAIL_HTTP_ENDPOINT", ""),
+		EmailHTTPAPIKey:   getEnv("EMAIL_HTTP_API_KEY", ""),
+
+		// SMTP
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:     getEnv("SMTP_FROM", "noreply@zplus.com"),
+		SMTPFromName: getEnv("SMTP_FROM_NAME", "Zplus SaaS"),
+
+		AppURL:           getEnv("APP_URL", "http://localhost:3000"),
+		TenantBaseDomain: getEnv("TENANT_BASE_DOMAIN", ""),
+
+		// Billing
+		BillingChargeURL: getEnv("BILLING_CHARGE_URL", ""),
+		DunningRetryDays: getEnv("DUNNING_RETRY_DAYS", "1,3,7"),
+		DunningGraceDays: getEnvInt("DUNNING_GRACE_DAYS", 10),
 
 		// Services URLs
 		AuthServiceURL:    getEnv("AUTH_SERVICE_URL", "http://localhost:8081"),
@@ -110,6 +186,15 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
 func getEnvBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if parsed, err := strconv.ParseBool(value); err == nil {
@@ -0,0 +1,187 @@
+package entitlements
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	// cacheTTL bounds how long a changed plan or override takes to reach
+	// the services
+	cacheTTL = time.Minute
+)
+
+// Entitlements is what a tenant may use: the entitlements of the version of
+// its plan it is on, with its overrides applied. Features and modules listed
+// true are granted and listed false are withheld; unlisted ones are granted
+// only to an unrestricted tenant. Unlisted limits are unlimited.
+type Entitlements struct {
+	TenantID uuid.UUID  `json:"tenant_id"`
+	PlanID   *uuid.UUID `json:"plan_id,omitempty"`
+	PlanName string     `json:"plan_name,omitempty"`
+	// PlanVersion is the version of the plan's entitlements the tenant is
+	// on; tenants stay on the version they subscribed to until migrated
+	PlanVersion   int `json:"plan_version,omitempty"`
+	LatestVersion int `json:"latest_version,omitempty"`
+	// Unrestricted is set when the tenant has no subscription or its plan
+	// has no published entitlements
+	Unrestricted bool             `json:"unrestricted"`
+	Features     map[string]bool  `json:"features"`
+	Limits       map[string]int64 `json:"limits"`
+	Modules      map[string]bool  `json:"modules"`
+	Overridden   bool             `json:"overridden"`
+	ResolvedAt   time.Time        `json:"resolved_at"`
+}
+
+// Enabled reports whether the tenant has the feature
+func (e *Entitlements) Enabled(feature string) bool {
+	if enabled, ok := e.Features[feature]; ok {
+		return enabled
+	}
+	return e.Unrestricted
+}
+
+// HasModule reports whether the tenant may use the module
+func (e *Entitlements) HasModule(module string) bool {
+	if enabled, ok := e.Modules[module]; ok {
+		return enabled
+	}
+	return e.Unrestricted
+}
+
+// Limit returns the tenant's limit and false if it is unlimited
+func (e *Entitlements) Limit(name string) (int64, bool) {
+	limit, ok := e.Limits[name]
+	return limit, ok
+}
+
+// Source resolves a tenant's entitlements
+type Source interface {
+	Entitlements(ctx context.Context, tenantID string) (*Entitlements, error)
+}
+
+type cachedEntitlements struct {
+	entitlements *Entitlements
+	expiresAt    time.Time
+}
+
+// Client reads entitlements from tenant-service and caches them for a
+// minute. When tenant-service cannot be reached it keeps answering with the
+// last entitlements it read.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	mu         sync.RWMutex
+	cache      map[string]cachedEntitlements
+}
+
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(cfg.TenantServiceURL, "/"),
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
+		cache: make(map[string]cachedEntitlements),
+	}
+}
+
+func (c *Client) Entitlements(ctx context.Context, tenantID string) (*Entitlements, error) {
+	c.mu.RLock()
+	cached, ok := c.cache[tenantID]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.entitlements, nil
+	}
+
+	entitlements, err := c.fetch(ctx, tenantID)
+	if err != nil {
+		if ok {
+			log.Printf("Using stale entitlements of tenant %s: %v", tenantID, err)
+			return cached.entitlements, nil
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.cache[tenantID] = cachedEntitlements{entitlements: entitlements, expiresAt: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+
+	return entitlements, nil
+}
+
+func (c *Client) fetch(ctx context.Context, tenantID string) (*Entitlements, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/tenants/"+url.PathEscape(tenantID)+"/entitlements", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenant-service returned status %d", resp.StatusCode)
+	}
+
+	var entitlements Entitlements
+	if err := json.NewDecoder(resp.Body).Decode(&entitlements); err != nil {
+		return nil, fmt.Errorf("invalid entitlements response: %w", err)
+	}
+	return &entitlements, nil
+}
+
+// RequireFeature rejects requests of tenants without the feature. Requests
+// without a tenant pass through, so it must run after the authentication
+// middleware of routes that need one.
+func RequireFeature(source Source, feature string) fiber.Handler {
+	return require(source, func(e *Entitlements) bool { return e.Enabled(feature) }, fiber.Map{
+		"error":   "Feature not available",
+		"message": "Your plan does not include " + feature,
+	})
+}
+
+// RequireModule rejects requests of tenants whose plan does not include the
+// module, like RequireFeature
+func RequireModule(source Source, module string) fiber.Handler {
+	return require(source, func(e *Entitlements) bool { return e.HasModule(module) }, fiber.Map{
+		"error":   "Module not available",
+		"message": "Your plan does not include the " + module + " module",
+	})
+}
+
+func require(source Source, allowed func(*Entitlements) bool, denied fiber.Map) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenantID, _ := c.Locals("tenant_id").(string)
+		if tenantID == "" {
+			return c.Next()
+		}
+
+		entitlements, err := source.Entitlements(c.Context(), tenantID)
+		if err != nil {
+			// Entitlements are a billing limit, not a security control, so
+			// an unreachable tenant-service does not take features away
+			log.Printf("Failed to load entitlements of tenant %s: %v", tenantID, err)
+			return c.Next()
+		}
+		if !allowed(entitlements) {
+			return c.Status(fiber.StatusForbidden).JSON(denied)
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,188 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RulesetChannel is the Redis channel tenant-service publishes the new
+// ruleset version on after every flag change
+const RulesetChannel = "feature_flags:ruleset"
+
+const (
+	requestTimeout = 10 * time.Second
+	// refreshInterval reloads the ruleset in case a change notification
+	// was missed, e.g. while Redis was unreachable
+	refreshInterval = 5 * time.Minute
+)
+
+// Ruleset is every flag at a version. The version increases on every change
+// of any flag.
+type Ruleset struct {
+	Version int64  `json:"version"`
+	Flags   []Flag `json:"flags"`
+}
+
+// Publish notifies the clients subscribed to RulesetChannel that the
+// ruleset changed to version
+func Publish(ctx context.Context, client *redis.Client, version int64) error {
+	return client.Publish(ctx, RulesetChannel, strconv.FormatInt(version, 10)).Err()
+}
+
+// Client evaluates flags locally from a cached copy of tenant-service's
+// ruleset, so evaluating a flag never waits on the network. Until Run
+// loaded the ruleset every flag is not found and callers get their
+// fallback.
+type Client struct {
+	url        string
+	httpClient *http.Client
+	redis      *redis.Client
+	mu         sync.RWMutex
+	version    int64
+	flags      map[string]*Flag
+}
+
+// NewClient reads the ruleset from tenant-service. With a Redis client it
+// reloads as soon as a flag changes; without one it reloads periodically.
+func NewClient(cfg *config.Config, redisClient *redis.Client) *Client {
+	return &Client{
+		url:        strings.TrimSuffix(cfg.TenantServiceURL, "/") + "/api/flags/ruleset",
+		httpClient: &http.Client{Timeout: requestTimeout},
+		redis:      redisClient,
+		flags:      map[string]*Flag{},
+	}
+}
+
+// Run loads the ruleset and keeps it fresh until ctx is cancelled
+func (c *Client) Run(ctx context.Context) {
+	var changes <-chan *redis.Message
+	if c.redis != nil {
+		subscription := c.redis.Subscribe(ctx, RulesetChannel)
+		defer subscription.Close()
+		changes = subscription.Channel()
+	}
+
+	c.refresh(ctx)
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			version, err := strconv.ParseInt(message.Payload, 10, 64)
+			if err != nil || version > c.Version() {
+				c.refresh(ctx)
+			}
+		case <-ticker.C:
+			c.refresh(ctx)
+		}
+	}
+}
+
+// Version returns the version of the cached ruleset, 0 before it is loaded
+func (c *Client) Version() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version
+}
+
+// Evaluate returns the variation the flag serves the context
+func (c *Client) Evaluate(key string, ctx Context) Evaluation {
+	c.mu.RLock()
+	flag, ok := c.flags[key]
+	c.mu.RUnlock()
+	if !ok {
+		return Evaluation{Key: key, Reason: ReasonFlagNotFound}
+	}
+	return flag.Evaluate(ctx)
+}
+
+// Bool evaluates a boolean flag, returning fallback if it is not found
+func (c *Client) Bool(key string, ctx Context, fallback bool) bool {
+	return c.Evaluate(key, ctx).Bool(fallback)
+}
+
+// Variation evaluates a flag to the key of its variation, returning fallback
+// if it is not found
+func (c *Client) Variation(key string, ctx Context, fallback string) string {
+	evaluation := c.Evaluate(key, ctx)
+	if evaluation.Reason == ReasonFlagNotFound || evaluation.Variation == "" {
+		return fallback
+	}
+	return evaluation.Variation
+}
+
+// EvaluateAll evaluates every flag for the context, e.g. to bootstrap a
+// frontend
+func (c *Client) EvaluateAll(ctx Context) map[string]Evaluation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	evaluations := make(map[string]Evaluation, len(c.flags))
+	for key, flag := range c.flags {
+		evaluations[key] = flag.Evaluate(ctx)
+	}
+	return evaluations
+}
+
+func (c *Client) refresh(ctx context.Context) {
+	ruleset, err := c.fetch(ctx)
+	if err != nil {
+		log.Printf("Failed to load feature flags: %v", err)
+		return
+	}
+
+	flags := make(map[string]*Flag, len(ruleset.Flags))
+	for i := range ruleset.Flags {
+		flags[ruleset.Flags[i].Key] = &ruleset.Flags[i]
+	}
+
+	c.mu.Lock()
+	// A slow response must not replace a newer ruleset
+	if ruleset.Version >= c.version {
+		c.version = ruleset.Version
+		c.flags = flags
+	}
+	c.mu.Unlock()
+}
+
+func (c *Client) fetch(ctx context.Context) (*Ruleset, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tenant-service returned status %d", resp.StatusCode)
+	}
+
+	var ruleset Ruleset
+	if err := json.NewDecoder(resp.Body).Decode(&ruleset); err != nil {
+		return nil, fmt.Errorf("invalid ruleset response: %w", err)
+	}
+	return &ruleset, nil
+}
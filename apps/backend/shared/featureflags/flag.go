@@ -0,0 +1,370 @@
+package featureflags
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Flag kinds
+const (
+	KindBoolean      = "boolean"
+	KindMultivariate = "multivariate"
+)
+
+// Variations of boolean flags
+const (
+	VariationOn  = "on"
+	VariationOff = "off"
+)
+
+// Targeting attributes every context has; rules may also target any custom
+// attribute of the context
+const (
+	AttributeTenant = "tenant"
+	AttributePlan   = "plan"
+	AttributeUser   = "user"
+	AttributeRole   = "role"
+)
+
+// Condition operators
+const (
+	OperatorIn         = "in"
+	OperatorNotIn      = "not_in"
+	OperatorContains   = "contains"
+	OperatorStartsWith = "starts_with"
+)
+
+// Reasons of an evaluation
+const (
+	ReasonOff          = "off"
+	ReasonRuleMatch    = "rule_match"
+	ReasonFallthrough  = "fallthrough"
+	ReasonFlagNotFound = "flag_not_found"
+)
+
+// RolloutScale is what the weights of a rollout add up to, so a weight of 1
+// is 0.01% of the contexts
+const RolloutScale = 10000
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,99}$`)
+
+// Flag is a feature flag. A disabled flag is killed: every context gets its
+// off variation. An enabled flag serves the first rule whose conditions all
+// match the context, and its fallthrough if none does.
+type Flag struct {
+	Key          string      `json:"key"`
+	Description  string      `json:"description"`
+	Kind         string      `json:"kind"`
+	Variations   []Variation `json:"variations"`
+	Enabled      bool        `json:"enabled"`
+	OffVariation string      `json:"off_variation"`
+	Rules        []Rule      `json:"rules"`
+	Fallthrough  Serve       `json:"fallthrough"`
+	// Version increases on every change of the flag
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Variation is a value a flag serves. Boolean flags have the variations
+// "on" (true) and "off" (false).
+type Variation struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Rule serves a variation or rollout to the contexts matching all its
+// conditions
+type Rule struct {
+	Description string      `json:"description,omitempty"`
+	Conditions  []Condition `json:"conditions"`
+	Serve       Serve       `json:"serve"`
+}
+
+// Condition matches a context whose attribute compares to any of the values
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Operator  string   `json:"operator"`
+	Values    []string `json:"values"`
+}
+
+// Serve is either a variation or a percentage rollout over variations
+type Serve struct {
+	Variation string   `json:"variation,omitempty"`
+	Rollout   *Rollout `json:"rollout,omitempty"`
+}
+
+// Rollout splits contexts over variations by weight. A context always falls
+// in the same bucket of a flag, so it keeps its variation while the rollout
+// grows.
+type Rollout struct {
+	// BucketBy is the attribute contexts are bucketed by, the tenant by
+	// default so all users of a tenant see the same variation
+	BucketBy   string              `json:"bucket_by,omitempty"`
+	Variations []WeightedVariation `json:"variations"`
+}
+
+type WeightedVariation struct {
+	Variation string `json:"variation"`
+	Weight    int    `json:"weight"`
+}
+
+// Context is who a flag is evaluated for
+type Context struct {
+	TenantID   string            `json:"tenant_id,omitempty"`
+	PlanID     string            `json:"plan_id,omitempty"`
+	UserID     string            `json:"user_id,omitempty"`
+	Role       string            `json:"role,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func (c Context) attribute(name string) string {
+	switch name {
+	case AttributeTenant:
+		return c.TenantID
+	case AttributePlan:
+		return c.PlanID
+	case AttributeUser:
+		return c.UserID
+	case AttributeRole:
+		return c.Role
+	}
+	return c.Attributes[name]
+}
+
+// Evaluation is the variation a flag serves a context and why
+type Evaluation struct {
+	Key       string          `json:"key"`
+	Variation string          `json:"variation,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Reason    string          `json:"reason"`
+	// RuleIndex is the matching rule for reason rule_match
+	RuleIndex *int `json:"rule_index,omitempty"`
+}
+
+// Bool returns the value of a boolean variation, or fallback if the flag was
+// not found or its value is not a boolean
+func (e Evaluation) Bool(fallback bool) bool {
+	var value bool
+	if e.Reason == ReasonFlagNotFound || json.Unmarshal(e.Value, &value) != nil {
+		return fallback
+	}
+	return value
+}
+
+// Evaluate returns the variation the flag serves the context
+func (f *Flag) Evaluate(ctx Context) Evaluation {
+	if !f.Enabled {
+		return f.serveVariation(f.OffVariation, ReasonOff)
+	}
+
+	for i, rule := range f.Rules {
+		if rule.matches(ctx) {
+			evaluation := f.serve(rule.Serve, ctx, ReasonRuleMatch)
+			index := i
+			evaluation.RuleIndex = &index
+			return evaluation
+		}
+	}
+
+	return f.serve(f.Fallthrough, ctx, ReasonFallthrough)
+}
+
+func (f *Flag) serve(serve Serve, ctx Context, reason string) Evaluation {
+	if serve.Rollout == nil {
+		return f.serveVariation(serve.Variation, reason)
+	}
+
+	bucketBy := serve.Rollout.BucketBy
+	if bucketBy == "" {
+		bucketBy = AttributeTenant
+	}
+	bucket := f.bucket(ctx.attribute(bucketBy))
+
+	sum := 0
+	for _, weighted := range serve.Rollout.Variations {
+		sum += weighted.Weight
+		if bucket < sum {
+			return f.serveVariation(weighted.Variation, reason)
+		}
+	}
+	// Validated weights add up to RolloutScale, so this is not reached
+	return f.serveVariation(f.OffVariation, reason)
+}
+
+// bucket places a value in [0, RolloutScale). The flag key salts the hash so
+// a tenant early in one rollout is not early in all of them.
+func (f *Flag) bucket(value string) int {
+	sum := sha1.Sum([]byte(f.Key + "." + value))
+	return int(binary.BigEndian.Uint64(sum[:8]) % RolloutScale)
+}
+
+func (f *Flag) serveVariation(key, reason string) Evaluation {
+	evaluation := Evaluation{Key: f.Key, Variation: key, Reason: reason}
+	for _, variation := range f.Variations {
+		if variation.Key == key {
+			evaluation.Value = variation.Value
+		}
+	}
+	return evaluation
+}
+
+func (r Rule) matches(ctx Context) bool {
+	for _, condition := range r.Conditions {
+		if !condition.matches(ctx.attribute(condition.Attribute)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Condition) matches(value string) bool {
+	if c.Operator == OperatorNotIn {
+		for _, candidate := range c.Values {
+			if value == candidate {
+				return false
+			}
+		}
+		return true
+	}
+
+	if value == "" {
+		return false
+	}
+	for _, candidate := range c.Values {
+		switch c.Operator {
+		case OperatorIn:
+			if value == candidate {
+				return true
+			}
+		case OperatorContains:
+			if strings.Contains(value, candidate) {
+				return true
+			}
+		case OperatorStartsWith:
+			if strings.HasPrefix(value, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Normalize gives a boolean flag without variations its on and off
+// variations and an off variation of "off"
+func (f *Flag) Normalize() {
+	if f.Kind != KindBoolean {
+		return
+	}
+	if len(f.Variations) == 0 {
+		f.Variations = []Variation{
+			{Key: VariationOn, Value: json.RawMessage("true")},
+			{Key: VariationOff, Value: json.RawMessage("false")},
+		}
+	}
+	if f.OffVariation == "" {
+		f.OffVariation = VariationOff
+	}
+}
+
+// Validate checks that the flag can be evaluated: its variations are unique
+// and every variation it serves exists
+func (f *Flag) Validate() error {
+	if !keyPattern.MatchString(f.Key) {
+		return fmt.Errorf("invalid flag key %q", f.Key)
+	}
+
+	switch f.Kind {
+	case KindBoolean:
+		if len(f.Variations) != 2 {
+			return fmt.Errorf("a boolean flag has exactly the variations on and off")
+		}
+		for _, variation := range f.Variations {
+			var value bool
+			if variation.Key != VariationOn && variation.Key != VariationOff || json.Unmarshal(variation.Value, &value) != nil || value != (variation.Key == VariationOn) {
+				return fmt.Errorf("a boolean flag has exactly the variations on and off")
+			}
+		}
+	case KindMultivariate:
+		if len(f.Variations) < 2 {
+			return fmt.Errorf("a multivariate flag needs at least two variations")
+		}
+	default:
+		return fmt.Errorf("unknown flag kind %q", f.Kind)
+	}
+
+	variations := map[string]bool{}
+	for _, variation := range f.Variations {
+		if variation.Key == "" {
+			return fmt.Errorf("variation key is required")
+		}
+		if variations[variation.Key] {
+			return fmt.Errorf("duplicate variation %q", variation.Key)
+		}
+		if !json.Valid(variation.Value) {
+			return fmt.Errorf("variation %q has no valid JSON value", variation.Key)
+		}
+		variations[variation.Key] = true
+	}
+
+	if !variations[f.OffVariation] {
+		return fmt.Errorf("unknown off variation %q", f.OffVariation)
+	}
+	for i, rule := range f.Rules {
+		if len(rule.Conditions) == 0 {
+			return fmt.Errorf("rule %d: at least one condition is required", i)
+		}
+		for _, condition := range rule.Conditions {
+			if condition.Attribute == "" {
+				return fmt.Errorf("rule %d: condition attribute is required", i)
+			}
+			switch condition.Operator {
+			case OperatorIn, OperatorNotIn, OperatorContains, OperatorStartsWith:
+			default:
+				return fmt.Errorf("rule %d: unknown operator %q", i, condition.Operator)
+			}
+			if len(condition.Values) == 0 {
+				return fmt.Errorf("rule %d: condition values are required", i)
+			}
+		}
+		if err := rule.Serve.validate(variations); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	if err := f.Fallthrough.validate(variations); err != nil {
+		return fmt.Errorf("fallthrough: %w", err)
+	}
+	return nil
+}
+
+func (s Serve) validate(variations map[string]bool) error {
+	if s.Rollout == nil {
+		if !variations[s.Variation] {
+			return fmt.Errorf("unknown variation %q", s.Variation)
+		}
+		return nil
+	}
+
+	if s.Variation != "" {
+		return fmt.Errorf("serve either a variation or a rollout")
+	}
+	total := 0
+	for _, weighted := range s.Rollout.Variations {
+		if !variations[weighted.Variation] {
+			return fmt.Errorf("unknown variation %q", weighted.Variation)
+		}
+		if weighted.Weight < 0 {
+			return fmt.Errorf("rollout weights must not be negative")
+		}
+		total += weighted.Weight
+	}
+	if total != RolloutScale {
+		return fmt.Errorf("rollout weights must add up to %d", RolloutScale)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package metering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+	"zplus-saas/apps/backend/shared/middleware"
+)
+
+// Metrics billed by the platform's pricing. Each is reported by a service:
+// email sends by auth-service's outbox, storage by tenant-service's meter.
+const (
+	MetricEmailSends      = "email_sends"
+	MetricStorageGBMonths = "storage_gb_months"
+)
+
+// Priceable reports whether plans may price a metric. Prices are limited to
+// the metrics some service reports, so none bills usage that never comes.
+func Priceable(metric string) bool {
+	switch metric {
+	case MetricEmailSends, MetricStorageGBMonths:
+		return true
+	}
+	return false
+}
+
+const (
+	requestTimeout = 10 * time.Second
+	tokenTTL       = time.Minute
+)
+
+// Event is a quantity of a metric a tenant used. Events are deduplicated by
+// tenant, metric and idempotency key, so a retried report is counted once.
+type Event struct {
+	TenantID       string    `json:"tenant_id"`
+	Metric         string    `json:"metric"`
+	Quantity       float64   `json:"quantity"`
+	OccurredAt     time.Time `json:"occurred_at"`
+	IdempotencyKey string    `json:"idempotency_key"`
+}
+
+// Recorder reports usage events to tenant-service, which aggregates them
+// per tenant and billing period and bills them at the metered prices of the
+// tenant's plan
+type Recorder interface {
+	Record(ctx context.Context, events ...Event) error
+}
+
+// NewClient reports events to tenant-service on behalf of service
+func NewClient(cfg *config.Config, service string) Recorder {
+	return &client{
+		cfg:     cfg,
+		service: service,
+		url:     strings.TrimSuffix(cfg.TenantServiceURL, "/") + "/api/usage/events",
+		httpClient: &http.Client{
+			Timeout: requestTimeout,
+		},
+	}
+}
+
+// Discard drops every event, for services and tests that do not meter
+type Discard struct{}
+
+func (Discard) Record(ctx context.Context, events ...Event) error {
+	return nil
+}
+
+type client struct {
+	cfg        *config.Config
+	service    string
+	url        string
+	httpClient *http.Client
+}
+
+type recordRequest struct {
+	Source string  `json:"source"`
+	Events []Event `json:"events"`
+}
+
+func (c *client) Record(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(&recordRequest{Source: c.service, Events: events})
+	if err != nil {
+		return err
+	}
+
+	token, err := middleware.NewServiceToken(c.cfg, c.service, "", nil, tokenTTL)
+	if err != nil {
+		return fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("tenant-service request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("tenant-service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IPSet is a list of networks, written as CIDR ranges or single addresses
+type IPSet []*net.IPNet
+
+// ParseIPSet parses CIDR ranges and single addresses ("10.0.0.0/8", "::1")
+func ParseIPSet(entries []string) (IPSet, error) {
+	set := make(IPSet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			set = append(set, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", entry)
+		}
+		set = append(set, network)
+	}
+
+	return set, nil
+}
+
+// Contains reports whether ip falls in any network of the set
+func (s IPSet) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range s {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveClientIP stores the client's address in the "client_ip" local. The
+// X-Forwarded-For header is only used when the direct peer is a trusted
+// proxy, and is read right to left, skipping trusted proxies, so addresses a
+// client prepends itself are never picked.
+func ResolveClientIP(trusted IPSet) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals("client_ip", clientIP(trusted, c.Context().RemoteIP(), c.Get(fiber.HeaderXForwardedFor)))
+		return c.Next()
+	}
+}
+
+func clientIP(trusted IPSet, remote net.IP, forwardedFor string) string {
+	if !trusted.Contains(remote) || forwardedFor == "" {
+		return remote.String()
+	}
+
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			// Anything left of a malformed hop is not trustworthy
+			break
+		}
+		if !trusted.Contains(ip) || i == 0 {
+			return ip.String()
+		}
+	}
+
+	return remote.String()
+}
+
+// ClientIP returns the address resolved by ResolveClientIP, falling back to
+// the direct peer
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals("client_ip").(string); ok && ip != "" {
+		return ip
+	}
+	return c.IP()
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// HeaderImpersonatedBy is set on every response to a request made with an
+// impersonation token, so clients can show that a support session is active
+const HeaderImpersonatedBy = "X-Impersonated-By"
+
+// ActorClaims is the "act" claim (RFC 8693) of an impersonation token: the
+// admin acting on behalf of the token's user
+type ActorClaims struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Role    string `json:"role,omitempty"`
+}
+
+// Impersonator returns the ID of the admin behind an impersonation token, or
+// "" for a normal session
+func Impersonator(c *fiber.Ctx) string {
+	actor, _ := c.Locals("impersonator_id").(string)
+	return actor
+}
+
+// SetImpersonationLocals stores the actor of an impersonation token and flags
+// the response. Auth middlewares call it after setting the user context.
+func SetImpersonationLocals(c *fiber.Ctx, actor *ActorClaims) {
+	if actor == nil || actor.Subject == "" {
+		c.Locals("impersonator_id", "")
+		c.Locals("impersonator_role", "")
+		return
+	}
+
+	c.Locals("impersonator_id", actor.Subject)
+	c.Locals("impersonator_role", actor.Role)
+	c.Set(HeaderImpersonatedBy, actor.Subject)
+}
+
+// RejectImpersonation blocks sensitive actions, such as changing a password
+// or paying, for requests made with an impersonation token. It must run after
+// an auth middleware.
+func RejectImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if Impersonator(c) != "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Not allowed while impersonating",
+				"message": "This action must be performed by the user themselves",
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IPAllowlist is the decoded form of tenant_configurations.allowed_ips. The
+// column holds either a plain array, which applies to every route, or an
+// object with separate lists for regular and admin routes. Admin routes fall
+// back to the default list when no admin list is set; an empty list allows
+// every address.
+type IPAllowlist struct {
+	Default IPSet
+	Admin   IPSet
+}
+
+type ipAllowlistJSON struct {
+	Default []string `json:"default"`
+	Admin   []string `json:"admin"`
+}
+
+// ParseIPAllowlist decodes and validates an allowed_ips value. An empty or
+// null value yields an allowlist that allows everything.
+func ParseIPAllowlist(raw string) (*IPAllowlist, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return &IPAllowlist{}, nil
+	}
+
+	var lists ipAllowlistJSON
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal([]byte(raw), &lists.Default); err != nil {
+			return nil, fmt.Errorf("invalid JSON format: %w", err)
+		}
+	} else if err := json.Unmarshal([]byte(raw), &lists); err != nil {
+		return nil, fmt.Errorf("invalid JSON format: %w", err)
+	}
+
+	defaultSet, err := ParseIPSet(lists.Default)
+	if err != nil {
+		return nil, err
+	}
+	adminSet, err := ParseIPSet(lists.Admin)
+	if err != nil {
+		return nil, fmt.Errorf("admin: %w", err)
+	}
+
+	return &IPAllowlist{Default: defaultSet, Admin: adminSet}, nil
+}
+
+// Allows reports whether ip may use regular routes, or admin routes when
+// admin is set
+func (l *IPAllowlist) Allows(ip string, admin bool) bool {
+	set := l.Default
+	if admin && len(l.Admin) > 0 {
+		set = l.Admin
+	}
+	if len(set) == 0 {
+		return true
+	}
+	return set.Contains(net.ParseIP(ip))
+}
+
+// IPAllowlistLoader returns a tenant's IP allowlist
+type IPAllowlistLoader func(ctx context.Context, tenantID string) (*IPAllowlist, error)
+
+// RequireAllowedIP refuses requests from addresses outside the tenant's IP
+// allowlist. It checks authenticated requests only, so it must run after an
+// auth middleware (JWTAuth or OptionalJWTAuth), and should run after
+// ResolveClientIP. isAdminRoute selects the admin list; nil means regular.
+// Super admins bypass tenant allowlists so a bad list can always be fixed.
+func RequireAllowedIP(load IPAllowlistLoader, isAdminRoute func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		tenantID, _ := c.Locals("tenant_id").(string)
+		if userID == "" || tenantID == "" {
+			return c.Next()
+		}
+
+		allowlist, err := load(c.Context(), tenantID)
+		if err != nil {
+			log.Printf("Failed to load IP allowlist for tenant %s: %v", tenantID, err)
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":   "IP allowlist unavailable",
+				"message": "Unable to verify the tenant's IP allowlist",
+			})
+		}
+
+		ip := ClientIP(c)
+		admin := isAdminRoute != nil && isAdminRoute(c)
+		if allowlist.Allows(ip, admin) {
+			return c.Next()
+		}
+
+		if role, _ := c.Locals("user_role").(string); role == "super_admin" {
+			log.Printf("IP allowlist bypassed: system admin %s from %s for tenant %s on %s %s", userID, ip, tenantID, c.Method(), c.Path())
+			return c.Next()
+		}
+		// Support staff impersonating a user connect from the platform's
+		// network, not the tenant's; the session itself is audited
+		if actor := Impersonator(c); actor != "" && c.Locals("impersonator_role") == "super_admin" {
+			log.Printf("IP allowlist bypassed: system admin %s impersonating %s from %s for tenant %s on %s %s", actor, userID, ip, tenantID, c.Method(), c.Path())
+			return c.Next()
+		}
+
+		log.Printf("IP allowlist denied: user %s from %s for tenant %s on %s %s (admin route: %t)", userID, ip, tenantID, c.Method(), c.Path(), admin)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "IP address not allowed",
+			"message": "Your IP address is not on your organization's allowlist",
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"zplus-saas/apps/backend/shared/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessClaims mirrors the access token claims issued by auth-service
+type accessClaims struct {
+	UserID      string       `json:"user_id"`
+	TenantID    string       `json:"tenant_id"`
+	Email       string       `json:"email"`
+	Role        string       `json:"role"`
+	Permissions []string     `json:"permissions"`
+	IsActive    bool         `json:"is_active"`
+	IsVerified  bool         `json:"is_verified"`
+	APIKeyID    string       `json:"api_key_id,omitempty"`
+	Act         *ActorClaims `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWTAuth validates access tokens issued by auth-service and sets the same
+// user context as auth-service's RequireAuth, so services behind the gateway
+// can use RequirePermission without calling auth-service.
+func JWTAuth(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") || strings.TrimPrefix(authHeader, "Bearer ") == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Authorization header required",
+				"message": "Authorization header must contain a Bearer token",
+			})
+		}
+
+		claims, err := parseAccessToken(strings.TrimPrefix(authHeader, "Bearer "), cfg)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Invalid token",
+				"message": err.Error(),
+			})
+		}
+
+		if !claims.IsActive {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Account deactivated",
+				"message": "Your account has been deactivated",
+			})
+		}
+
+		setClaimsLocals(c, claims)
+
+		return c.Next()
+	}
+}
+
+// OptionalJWTAuth sets the user context when the request carries a valid
+// access token and passes every other request through unchanged, for routes
+// that authenticate further downstream.
+func OptionalJWTAuth(cfg *config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+		if !strings.HasPrefix(authHeader, "Bearer ") {
+			return c.Next()
+		}
+
+		claims, err := parseAccessToken(strings.TrimPrefix(authHeader, "Bearer "), cfg)
+		if err == nil && claims.IsActive {
+			setClaimsLocals(c, claims)
+		}
+
+		return c.Next()
+	}
+}
+
+func parseAccessToken(tokenString string, cfg *config.Config) (*accessClaims, error) {
+	claims := &accessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(cfg.JWTSecret), nil
+	}, jwt.WithIssuer(cfg.JWTIssuer))
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyTokenAudience(cfg, claims.Role, claims.Audience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func setClaimsLocals(c *fiber.Ctx, claims *accessClaims) {
+	c.Locals("user_id", claims.UserID)
+	c.Locals("tenant_id", claims.TenantID)
+	c.Locals("user_email", claims.Email)
+	c.Locals("user_role", claims.Role)
+	c.Locals("permissions", claims.Permissions)
+	c.Locals("is_verified", claims.IsVerified)
+	c.Locals("api_key_id", claims.APIKeyID)
+	SetImpersonationLocals(c, claims.Act)
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PermissionAll grants every permission. The built-in admin roles hold it.
+const PermissionAll = "*"
+
+// RoleSuperAdmin is the role of the platform's system admins
+const RoleSuperAdmin = "super_admin"
+
+// HasPermission reports whether any of the granted permissions satisfies the
+// required one. Grants may use a trailing wildcard, so "crm.*" satisfies
+// "crm.lead.write" and "*" satisfies everything.
+func HasPermission(granted []string, required string) bool {
+	for _, permission := range granted {
+		if permission == PermissionAll || permission == required {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(permission, ".*"); ok && strings.HasPrefix(required, prefix+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequirePermission allows the request if the user holds any of the given
+// permissions. It must run after an auth middleware (e.g. JWTAuth) that stores
+// the user's permissions in the "permissions" local.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, ok := c.Locals("permissions").([]string)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "User permissions not found",
+				"message": "User authentication required",
+			})
+		}
+
+		for _, permission := range permissions {
+			if HasPermission(granted, permission) {
+				return c.Next()
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Insufficient permissions",
+			"message": "You don't have permission to access this resource",
+		})
+	}
+}
+
+// RequireSystemAdmin only allows the platform's system admins, for routes
+// that act across tenants. It must run after an auth middleware.
+func RequireSystemAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if role, _ := c.Locals("user_role").(string); role != RoleSuperAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Super admin role required",
+				"message": "This endpoint is only available to system admins",
+			})
+		}
+
+		return c.Next()
+	}
+}
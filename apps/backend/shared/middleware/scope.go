@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// DataScope limits which records of a resource a caller can access
+type DataScope string
+
+const (
+	// DataScopeOwn covers records owned by (assigned to) the caller
+	DataScopeOwn DataScope = "own"
+	// DataScopeTeam adds records of the caller's department and direct reports
+	DataScopeTeam DataScope = "team"
+	// DataScopeTenant covers every record of the tenant
+	DataScopeTenant DataScope = "tenant"
+)
+
+// Access is the caller's access to one resource (e.g. "crm.lead"), passed
+// down to repositories so record-level scoping is applied in the queries
+type Access struct {
+	UserID      string
+	Scope       DataScope
+	Permissions []string
+}
+
+// Can reports whether the caller holds a permission
+func (a Access) Can(permission string) bool {
+	return HasPermission(a.Permissions, permission)
+}
+
+// ResolveDataScope returns the widest data scope granted on a resource. Roles
+// widen the default of own records with "<resource>.scope.team" or
+// "<resource>.scope.tenant".
+func ResolveDataScope(granted []string, resource string) DataScope {
+	switch {
+	case HasPermission(granted, resource+".scope.tenant"):
+		return DataScopeTenant
+	case HasPermission(granted, resource+".scope.team"):
+		return DataScopeTeam
+	default:
+		return DataScopeOwn
+	}
+}
+
+// CurrentAccess builds the caller's Access to a resource from the user
+// context set by JWTAuth
+func CurrentAccess(c *fiber.Ctx, resource string) Access {
+	userID, _ := c.Locals("user_id").(string)
+	permissions, _ := c.Locals("permissions").([]string)
+
+	return Access{
+		UserID:      userID,
+		Scope:       ResolveDataScope(permissions, resource),
+		Permissions: permissions,
+	}
+}
@@ -0,0 +1,118 @@
+package modulehooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"zplus-saas/apps/backend/shared/semver"
+)
+
+// Migration moves a tenant's data of a module up to Version, and Down back
+// to the version before it. Both may run again when a hook is retried.
+type Migration struct {
+	Version string
+	Up      func(ctx context.Context, tenantID string) error
+	// Down may be nil for migrations with nothing to undo
+	Down func(ctx context.Context, tenantID string) error
+}
+
+// VersionStore keeps the version a tenant's data of a module is at
+type VersionStore interface {
+	Version(ctx context.Context, tenantID string) (string, error)
+	SetVersion(ctx context.Context, tenantID, version string) error
+}
+
+// Migrations are the version-specific steps of a module
+type Migrations []Migration
+
+// Upgrade returns the upgrade hook. It runs the migrations after the
+// tenant's version up to the requested one, oldest first, and records the
+// version after each so a retried hook carries on where it stopped.
+func (m Migrations) Upgrade(store VersionStore) Hook {
+	return func(ctx context.Context, req *Request) error {
+		migrations, err := m.sorted()
+		if err != nil {
+			return err
+		}
+		current, err := store.Version(ctx, req.TenantID)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if !versionAbove(migration.Version, current) || versionAbove(migration.Version, req.Version) {
+				continue
+			}
+			if err := migration.Up(ctx, req.TenantID); err != nil {
+				return fmt.Errorf("migration to %s failed: %w", migration.Version, err)
+			}
+			if err := store.SetVersion(ctx, req.TenantID, migration.Version); err != nil {
+				return err
+			}
+		}
+		return store.SetVersion(ctx, req.TenantID, req.Version)
+	}
+}
+
+// Rollback returns the rollback hook. It undoes the migrations after the
+// requested version up to the tenant's version, newest first.
+func (m Migrations) Rollback(store VersionStore) Hook {
+	return func(ctx context.Context, req *Request) error {
+		migrations, err := m.sorted()
+		if err != nil {
+			return err
+		}
+		current, err := store.Version(ctx, req.TenantID)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0; i-- {
+			migration := migrations[i]
+			if versionAbove(migration.Version, current) || !versionAbove(migration.Version, req.Version) {
+				continue
+			}
+			if migration.Down != nil {
+				if err := migration.Down(ctx, req.TenantID); err != nil {
+					return fmt.Errorf("rollback of %s failed: %w", migration.Version, err)
+				}
+			}
+
+			previous := req.Version
+			if i > 0 && versionAbove(migrations[i-1].Version, req.Version) {
+				previous = migrations[i-1].Version
+			}
+			if err := store.SetVersion(ctx, req.TenantID, previous); err != nil {
+				return err
+			}
+		}
+		return store.SetVersion(ctx, req.TenantID, req.Version)
+	}
+}
+
+func (m Migrations) sorted() (Migrations, error) {
+	sorted := make(Migrations, len(m))
+	copy(sorted, m)
+	for _, migration := range sorted {
+		if _, err := semver.Parse(migration.Version); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return versionAbove(sorted[j].Version, sorted[i].Version) })
+	return sorted, nil
+}
+
+// versionAbove reports whether version a is later than b, prereleases
+// before their release; an unparsable version is never above
+func versionAbove(a, b string) bool {
+	va, err := semver.Parse(a)
+	if err != nil {
+		return false
+	}
+	vb, err := semver.Parse(b)
+	if err != nil {
+		return true
+	}
+	return va.Compare(vb) > 0
+}
@@ -0,0 +1,185 @@
+package modulehooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+	"zplus-saas/apps/backend/shared/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Lifecycle events of a tenant's module
+const (
+	EventInstall   = "install"
+	EventUpgrade   = "upgrade"
+	EventEnable    = "enable"
+	EventDisable   = "disable"
+	EventUninstall = "uninstall"
+	// EventRollback moves a tenant back from FromVersion to Version after an
+	// upgrade failed or was undone
+	EventRollback = "rollback"
+)
+
+// Path is the internal endpoint every service implementing modules serves
+// the hooks on
+const Path = "/internal/modules/hooks"
+
+const (
+	// requestTimeout is generous since a hook may migrate a tenant's data
+	requestTimeout = 2 * time.Minute
+	tokenTTL       = 5 * time.Minute
+)
+
+// Request asks a service to set up or tear down a module for a tenant.
+// Hooks are retried until they succeed, so they must be idempotent.
+type Request struct {
+	Event    string `json:"event"`
+	TenantID string `json:"tenant_id"`
+	Module   string `json:"module"`
+	Version  string `json:"version"`
+	// FromVersion is the version being upgraded or rolled back from
+	FromVersion string          `json:"from_version,omitempty"`
+	Config      json.RawMessage `json:"config,omitempty"`
+	Attempt     int             `json:"attempt"`
+}
+
+// Hook handles one event. It returns an error to have the event retried.
+type Hook func(ctx context.Context, req *Request) error
+
+// Hooks are a service's hooks by event. Events without a hook need nothing
+// from the service and succeed.
+type Hooks map[string]Hook
+
+// NewHooks returns the hooks of a service's module: install, enable,
+// disable and uninstall keep store, upgrade and rollback run migrations on
+// the tenant's data. Install sets the module up and then runs the
+// migrations up to the version installed, so a tenant installing a later
+// version gets the same data as one that upgraded to it.
+func NewHooks(store Store, migrations Migrations) Hooks {
+	upgrade := migrations.Upgrade(store)
+	return Hooks{
+		EventInstall: func(ctx context.Context, req *Request) error {
+			if err := store.Install(ctx, req.TenantID); err != nil {
+				return err
+			}
+			return upgrade(ctx, req)
+		},
+		EventUpgrade:  upgrade,
+		EventRollback: migrations.Rollback(store),
+		EventEnable: func(ctx context.Context, req *Request) error {
+			return store.SetEnabled(ctx, req.TenantID, true)
+		},
+		EventDisable: func(ctx context.Context, req *Request) error {
+			return store.SetEnabled(ctx, req.TenantID, false)
+		},
+		EventUninstall: func(ctx context.Context, req *Request) error {
+			return store.Uninstall(ctx, req.TenantID)
+		},
+	}
+}
+
+// Endpoint serves hooks at Path. It must run after JWTAuth and
+// RequireService, as only tenant-service runs hooks.
+func Endpoint(hooks Hooks) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req Request
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"message": err.Error(),
+			})
+		}
+
+		switch req.Event {
+		case EventInstall, EventUpgrade, EventEnable, EventDisable, EventUninstall, EventRollback:
+		default:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid event",
+				"message": fmt.Sprintf("unknown lifecycle event %q", req.Event),
+			})
+		}
+		if req.TenantID == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid request body",
+				"message": "tenant_id is required",
+			})
+		}
+
+		hook, ok := hooks[req.Event]
+		if !ok {
+			return c.JSON(fiber.Map{"status": "ok"})
+		}
+		if err := hook(c.UserContext(), &req); err != nil {
+			log.Printf("Module %s %s hook failed for tenant %s: %v", req.Module, req.Event, req.TenantID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Hook failed",
+				"message": err.Error(),
+			})
+		}
+
+		return c.JSON(fiber.Map{"status": "ok"})
+	}
+}
+
+// Client runs hooks on the services implementing modules
+type Client struct {
+	cfg        *config.Config
+	service    string
+	httpClient *http.Client
+}
+
+// NewClient runs hooks on behalf of service
+func NewClient(cfg *config.Config, service string) *Client {
+	return &Client{
+		cfg:        cfg,
+		service:    service,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Invoke runs the hook for req on the service at baseURL. The error carries
+// the service's message, to be shown with the failed installation.
+func (c *Client) Invoke(ctx context.Context, baseURL string, req *Request) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	token, err := middleware.NewServiceToken(c.cfg, c.service, req.TenantID, nil, tokenTTL)
+	if err != nil {
+		return fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+Path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Tenant-ID", req.TenantID)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("hook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil && body.Message != "" {
+		return fmt.Errorf("hook returned status %d: %s", resp.StatusCode, body.Message)
+	}
+	return fmt.Errorf("hook returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,210 @@
+package modulehooks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// enabledCacheTTL is how long a tenant's module state is cached. Other
+// instances of a service see a module enabled or disabled within it.
+const enabledCacheTTL = 30 * time.Second
+
+// BaseVersion is the version a new tenant's data is at once the module is
+// set up, before any of its migrations ran
+const BaseVersion = "0.0.0"
+
+// Store records which tenants have a service's module set up
+type Store interface {
+	VersionStore
+	// Install sets the module up for a tenant at BaseVersion, or again at
+	// the version its data is at after it was uninstalled
+	Install(ctx context.Context, tenantID string) error
+	SetEnabled(ctx context.Context, tenantID string, enabled bool) error
+	Uninstall(ctx context.Context, tenantID string) error
+}
+
+// SeedFunc sets up a new tenant's data in the transaction installing the
+// module. It runs again on every retried or repeated install, so it must
+// only add what the tenant is missing.
+type SeedFunc func(ctx context.Context, tx *sql.Tx, tenantID string) error
+
+type cachedEnabled struct {
+	enabled   bool
+	expiresAt time.Time
+}
+
+// TenantModules keeps a service's tenant modules table, such as
+// crm_tenant_modules, with one row per tenant the module was installed for
+type TenantModules struct {
+	db    *sql.DB
+	table string
+	seed  SeedFunc
+
+	mu    sync.RWMutex
+	cache map[string]cachedEnabled
+}
+
+// NewTenantModules keeps the tenant modules table. seed may be nil for
+// modules with nothing to set up.
+func NewTenantModules(db *sql.DB, table string, seed SeedFunc) *TenantModules {
+	return &TenantModules{
+		db:    db,
+		table: table,
+		seed:  seed,
+		cache: make(map[string]cachedEnabled),
+	}
+}
+
+// Install sets the module up for a tenant, or again after it was
+// uninstalled, keeping the version its data was migrated to
+func (m *TenantModules) Install(ctx context.Context, tenantID string) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO ` + m.table + ` (tenant_id, version, is_enabled, installed_at, updated_at, uninstalled_at)
+		VALUES ($1, $2, true, $3, $3, NULL)
+		ON CONFLICT (tenant_id)
+		DO UPDATE SET is_enabled = true, updated_at = $3, uninstalled_at = NULL
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, BaseVersion, time.Now()); err != nil {
+		return fmt.Errorf("failed to install module: %w", err)
+	}
+
+	if m.seed != nil {
+		if err := m.seed(ctx, tx, tenantID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	m.forget(tenantID)
+	return nil
+}
+
+// Version returns the version a tenant's data of the module is at
+func (m *TenantModules) Version(ctx context.Context, tenantID string) (string, error) {
+	var version string
+	query := "SELECT version FROM " + m.table + " WHERE tenant_id = $1 AND uninstalled_at IS NULL"
+	err := m.db.QueryRowContext(ctx, query, tenantID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("module is not installed for tenant")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get module version: %w", err)
+	}
+	return version, nil
+}
+
+// SetVersion records the version a tenant's data was migrated to
+func (m *TenantModules) SetVersion(ctx context.Context, tenantID, version string) error {
+	return m.update(ctx, "version = $2", tenantID, version)
+}
+
+// SetEnabled enables or disables the module for a tenant
+func (m *TenantModules) SetEnabled(ctx context.Context, tenantID string, enabled bool) error {
+	if err := m.update(ctx, "is_enabled = $2", tenantID, enabled); err != nil {
+		return err
+	}
+	m.forget(tenantID)
+	return nil
+}
+
+// Uninstall marks the module uninstalled for a tenant, keeping its records.
+// A tenant whose install never completed has nothing to uninstall.
+func (m *TenantModules) Uninstall(ctx context.Context, tenantID string) error {
+	query := "UPDATE " + m.table + " SET is_enabled = false, uninstalled_at = $2, updated_at = $2 WHERE tenant_id = $1 AND uninstalled_at IS NULL"
+
+	if _, err := m.db.ExecContext(ctx, query, tenantID, time.Now()); err != nil {
+		return fmt.Errorf("failed to uninstall module: %w", err)
+	}
+	m.forget(tenantID)
+	return nil
+}
+
+// Enabled reports whether a tenant may use the module. Tenants without a
+// row had the module before it was installed through the lifecycle hooks
+// and keep using it; disabled and uninstalled modules may not be used.
+func (m *TenantModules) Enabled(ctx context.Context, tenantID string) (bool, error) {
+	m.mu.RLock()
+	cached, ok := m.cache[tenantID]
+	m.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.enabled, nil
+	}
+
+	enabled := true
+	query := "SELECT is_enabled FROM " + m.table + " WHERE tenant_id = $1"
+	err := m.db.QueryRowContext(ctx, query, tenantID).Scan(&enabled)
+	if err != nil && err != sql.ErrNoRows {
+		return false, fmt.Errorf("failed to get module state: %w", err)
+	}
+
+	m.mu.Lock()
+	m.cache[tenantID] = cachedEnabled{enabled: enabled, expiresAt: time.Now().Add(enabledCacheTTL)}
+	m.mu.Unlock()
+	return enabled, nil
+}
+
+func (m *TenantModules) forget(tenantID string) {
+	m.mu.Lock()
+	delete(m.cache, tenantID)
+	m.mu.Unlock()
+}
+
+func (m *TenantModules) update(ctx context.Context, set, tenantID string, value interface{}) error {
+	query := "UPDATE " + m.table + " SET " + set + ", updated_at = $3 WHERE tenant_id = $1"
+
+	result, err := m.db.ExecContext(ctx, query, tenantID, value, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update module: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("module is not installed for tenant")
+	}
+	return nil
+}
+
+// EnabledChecker reports whether a tenant may use a module
+type EnabledChecker interface {
+	Enabled(ctx context.Context, tenantID string) (bool, error)
+}
+
+// RequireEnabled rejects the requests of tenants that disabled or
+// uninstalled the module. It must run after JWTAuth. Failing to read the
+// module state does not block the request.
+func RequireEnabled(modules EnabledChecker, module string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenantID, _ := c.Locals("tenant_id").(string)
+		if tenantID == "" {
+			return c.Next()
+		}
+
+		enabled, err := modules.Enabled(c.UserContext(), tenantID)
+		if err != nil {
+			log.Printf("Failed to check module %s for tenant %s: %v", module, tenantID, err)
+			return c.Next()
+		}
+		if !enabled {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Module disabled",
+				"message": fmt.Sprintf("The %s module is not enabled for your organization", module),
+			})
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,172 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version. Missing minor and patch numbers are 0, so
+// "2" and "2.0.0" are the same version; parts records how many were given,
+// which decides how far "~" and "^" ranges reach.
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+	parts               int
+}
+
+// Parse parses a version like "1.4.2", "v2.0.0-rc.1" or "1.2". Build
+// metadata after "+" is ignored.
+func Parse(s string) (Version, error) {
+	var v Version
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		rest = rest[:i]
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		rest, v.Prerelease = rest[:i], rest[i+1:]
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		*numbers[i] = n
+	}
+	v.parts = len(parts)
+	return v, nil
+}
+
+// Compare returns a negative number if v is before other, 0 if they are
+// the same version and a positive number if v is after other
+func (v Version) Compare(other Version) int {
+	for _, d := range []int{v.Major - other.Major, v.Minor - other.Minor, v.Patch - other.Patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	// A prerelease comes before its release
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// Compare compares the versions a and b like Version.Compare
+func Compare(a, b string) (int, error) {
+	va, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.Compare(vb), nil
+}
+
+// comparePrerelease orders prereleases by their dot-separated identifiers:
+// numeric ones numerically and before alphanumeric ones, and a prefix before
+// the longer prerelease, so beta.2 < beta.10 < beta.10.1 < rc.1
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return an - bn
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return len(as) - len(bs)
+}
+
+// Satisfies reports whether version meets constraint: terms like
+// ">=1.2.0", "<2", "=1.4.1", "^1.2" or "~1.2.3" separated by spaces or
+// commas, all of which must hold. A bare version is a minimum; "" and "*"
+// allow any version.
+func Satisfies(version, constraint string) (bool, error) {
+	v, err := Parse(version)
+	if err != nil {
+		return false, err
+	}
+
+	terms := strings.FieldsFunc(constraint, func(r rune) bool { return r == ' ' || r == ',' })
+	for _, term := range terms {
+		if term == "*" {
+			continue
+		}
+		op := term[:len(term)-len(strings.TrimLeft(term, "<>=^~"))]
+		bound, err := Parse(term[len(op):])
+		if err != nil {
+			return false, fmt.Errorf("invalid version constraint %q", constraint)
+		}
+
+		cmp := v.Compare(bound)
+		ok := false
+		switch op {
+		case "", ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==":
+			ok = cmp == 0
+		case "^":
+			ok = cmp >= 0 && v.Compare(caretUpper(bound)) < 0
+		case "~":
+			// The patch version may change, or the minor one if only the
+			// major version was given: ~1.2 is below 1.3.0, ~1 below 2.0.0
+			upper := Version{Major: bound.Major, Minor: bound.Minor + 1}
+			if bound.parts == 1 {
+				upper = Version{Major: bound.Major + 1}
+			}
+			ok = cmp >= 0 && v.Compare(upper) < 0
+		default:
+			return false, fmt.Errorf("invalid version constraint %q", constraint)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// caretUpper returns the exclusive upper bound of a "^" range: the left-most
+// non-zero component given may not change, so ^1.2 is below 2.0.0, ^0.2
+// below 0.3.0 and ^0.0.3 below 0.0.4. Zeros left unspecified may change:
+// ^0.0 is below 0.1.0 and ^0 below 1.0.0.
+func caretUpper(bound Version) Version {
+	switch {
+	case bound.Major > 0 || bound.parts == 1:
+		return Version{Major: bound.Major + 1}
+	case bound.Minor > 0 || bound.parts == 2:
+		return Version{Minor: bound.Minor + 1}
+	default:
+		return Version{Patch: bound.Patch + 1}
+	}
+}
@@ -0,0 +1,90 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version    string
+		constraint string
+		want       bool
+	}{
+		{"1.2.0", "", true},
+		{"1.2.0", "*", true},
+		{"1.2.0", "1.2.0", true},
+		{"1.1.9", "1.2", false},
+		{"v2.0.0", ">=1.5.0 <2.0.0", false},
+		{"1.9.3", ">=1.5.0, <2.0.0", true},
+		{"1.4.1", "=1.4.1", true},
+		{"1.9.0", "^1.2", true},
+		{"2.0.0", "^1.2", false},
+		{"0.3.5", "^0.3.1", true},
+		{"0.4.0", "^0.3.1", false},
+		{"1.2.9", "~1.2.3", true},
+		{"1.3.0", "~1.2.3", false},
+		{"1.9.9", "~1", true},
+		{"2.0.0", "~1", false},
+		{"1.2.9", "~1.2", true},
+		{"1.3.0", "~1.2", false},
+		{"0.0.3", "^0.0.3", true},
+		{"0.0.4", "^0.0.3", false},
+		{"0.0.9", "^0.0", true},
+		{"0.1.0", "^0.0", false},
+		{"0.9.0", "^0", true},
+		{"1.0.0", "^0", false},
+		{"0.2.9", "^0.2", true},
+		{"0.3.0", "^0.2", false},
+		{"2.0.0-beta.1", ">=2.0.0", false},
+		{"2.0.0", ">2.0.0-rc.1", true},
+		{"2.0.0-beta.10", ">2.0.0-beta.2", true},
+		{"2.0.0-beta.2", ">=2.0.0-beta.10", false},
+		{"2.0.0-beta.10.1", ">2.0.0-beta.10", true},
+		{"2.0.0-beta", "<2.0.0-beta.1", true},
+		{"2.0.0-1", "<2.0.0-alpha", true},
+		{"2.0.0-rc.1", ">2.0.0-beta.11", true},
+	}
+	for _, tt := range tests {
+		got, err := Satisfies(tt.version, tt.constraint)
+		require.NoError(t, err, "%s %s", tt.version, tt.constraint)
+		assert.Equal(t, tt.want, got, "%s %s", tt.version, tt.constraint)
+	}
+
+	_, err := Satisfies("1.0.0", "=>1.0")
+	assert.EqualError(t, err, `invalid version constraint "=>1.0"`)
+	_, err = Satisfies("latest", "1.0")
+	assert.Error(t, err)
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.2", 0},
+		{"v1.10.0", "1.9.0", 1},
+		{"2.0.0-rc.1", "2.0.0", -1},
+		{"2.0.0-rc.1", "1.9.9", 1},
+		{"2.0.0-rc.1", "2.0.0-beta.11", 1},
+		{"2.0.0-beta.2", "2.0.0-beta.10", -1},
+		{"1.0.0+build.5", "1.0.0", 0},
+	}
+	for _, tt := range tests {
+		got, err := Compare(tt.a, tt.b)
+		require.NoError(t, err, "%s %s", tt.a, tt.b)
+		switch {
+		case tt.want < 0:
+			assert.Negative(t, got, "%s %s", tt.a, tt.b)
+		case tt.want > 0:
+			assert.Positive(t, got, "%s %s", tt.a, tt.b)
+		default:
+			assert.Zero(t, got, "%s %s", tt.a, tt.b)
+		}
+	}
+
+	_, err := Compare("1.0.0", "latest")
+	assert.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -8,14 +9,17 @@ import (
 
 	"zplus-saas/apps/backend/shared/config"
 	"zplus-saas/apps/backend/shared/database"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 	"zplus-saas/apps/backend/tenant-service/internal/handlers"
 	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+	"zplus-saas/apps/backend/tenant-service/internal/routes"
 	"zplus-saas/apps/backend/tenant-service/internal/services"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/jmoiron/sqlx"
 )
 
 func main() {
@@ -28,17 +32,71 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
+	sqlxDB := sqlx.NewDb(db, "postgres")
+
+	// Connect to Redis to announce feature flag changes. Without it the
+	// services still reload the flags periodically.
+	var flagNotifier services.FlagNotifier
+	redisClient, err := database.NewRedisClient(cfg.RedisURL)
+	if err != nil {
+		log.Printf("Redis unavailable, feature flag changes will not be announced: %v", err)
+	} else {
+		defer redisClient.Close()
+		flagNotifier = services.NewRedisFlagNotifier(redisClient)
+	}
 
 	// Initialize repositories
 	tenantRepo := repositories.NewTenantRepository(db)
 	subscriptionRepo := repositories.NewSubscriptionRepository(db)
 	planRepo := repositories.NewPlanRepository(db)
+	provisioningRepo := repositories.NewProvisioningRepository(db)
+	setupRepo := repositories.NewTenantSetupRepository(db)
+	billingRepo := repositories.NewBillingRepository(db)
+	dunningRepo := repositories.NewDunningRepository(db)
+	quotaRepo := repositories.NewQuotaRepository(db)
+	meteringRepo := repositories.NewMeteringRepository(db)
+	entitlementRepo := repositories.NewEntitlementRepository(db)
+	flagRepo := repositories.NewFeatureFlagRepository(db)
+	moduleLifecycleRepo := repositories.NewModuleLifecycleRepository(db)
+
+	dunningPolicy, err := services.ParseDunningPolicy(cfg.DunningRetryDays, cfg.DunningGraceDays)
+	if err != nil {
+		log.Fatalf("Invalid dunning configuration: %v", err)
+	}
 
 	// Initialize services
-	tenantService := services.NewTenantService(tenantRepo, subscriptionRepo, planRepo)
+	authClient := services.NewAuthClient(cfg)
+	provisioningService := services.NewProvisioningService(provisioningRepo, tenantRepo, subscriptionRepo, planRepo, setupRepo, authClient)
+	tenantService := services.NewTenantService(tenantRepo, subscriptionRepo, planRepo, provisioningService)
+	dunningService := services.NewDunningService(dunningRepo, billingRepo, tenantService, services.NewPaymentCollector(cfg), authClient, dunningPolicy)
+	meteringService := services.NewMeteringService(meteringRepo, subscriptionRepo, planRepo)
+	billingService := services.NewBillingService(billingRepo, subscriptionRepo, planRepo, tenantRepo, dunningService, meteringService)
+	quotaService := services.NewQuotaService(quotaRepo, subscriptionRepo, planRepo)
+	entitlementService := services.NewEntitlementService(entitlementRepo, subscriptionRepo, planRepo, tenantRepo)
+	flagService := services.NewFeatureFlagService(flagRepo, subscriptionRepo, flagNotifier)
+	moduleLifecycleService := services.NewModuleLifecycleService(moduleLifecycleRepo, services.NewModuleHookInvoker(cfg))
+	moduleService := services.NewModuleService(sqlxDB)
+	tenantConfigService := services.NewTenantConfigService(sqlxDB)
 
 	// Initialize handlers
 	tenantHandler := handlers.NewTenantHandler(tenantService)
+	provisioningHandler := handlers.NewProvisioningHandler(provisioningService)
+	billingHandler := handlers.NewBillingHandler(billingService, dunningService)
+	quotaHandler := handlers.NewQuotaHandler(quotaService)
+	meteringHandler := handlers.NewMeteringHandler(meteringService)
+	entitlementHandler := handlers.NewEntitlementHandler(entitlementService)
+	flagHandler := handlers.NewFeatureFlagHandler(flagService)
+	moduleHandler := handlers.NewModuleHandler(moduleService, tenantConfigService)
+
+	// Roll back provisioning interrupted by a restart, bill subscriptions,
+	// collect unpaid invoices, meter storage and run module lifecycle hooks
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go services.NewProvisioningWorker(provisioningService).Run(workerCtx)
+	go services.NewBillingWorker(billingService).Run(workerCtx)
+	go services.NewDunningWorker(dunningService).Run(workerCtx)
+	go services.NewStorageMeterWorker(meteringService).Run(workerCtx)
+	go services.NewModuleLifecycleWorker(moduleLifecycleService).Run(workerCtx)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
@@ -81,6 +139,23 @@ func main() {
 	// API routes
 	api := app.Group("/api")
 
+	// Platform statistics for the admin dashboard
+	api.Get("/stats", tenantHandler.Stats)
+
+	// Usage events reported by the other services
+	api.Post("/usage/events", sharedmiddleware.JWTAuth(cfg), sharedmiddleware.RequireService(), meteringHandler.RecordUsage)
+
+	// Feature flag routes
+	flags := api.Group("/flags")
+	flags.Get("/", flagHandler.ListFlags)
+	flags.Post("/", flagHandler.CreateFlag)
+	flags.Get("/ruleset", flagHandler.GetRuleset)
+	flags.Post("/evaluate", flagHandler.Evaluate)
+	flags.Get("/:key", flagHandler.GetFlag)
+	flags.Put("/:key", flagHandler.UpdateFlag)
+	flags.Put("/:key/enabled", flagHandler.SetEnabled)
+	flags.Delete("/:key", flagHandler.DeleteFlag)
+
 	// Tenant routes
 	tenants := api.Group("/tenants")
 	tenants.Post("/", tenantHandler.Create)
@@ -90,12 +165,33 @@ func main() {
 	tenants.Delete("/:id", tenantHandler.Delete)
 	tenants.Post("/:id/activate", tenantHandler.Activate)
 	tenants.Post("/:id/suspend", tenantHandler.Suspend)
+	tenants.Get("/:id/usage", quotaHandler.GetUsage)
+	tenants.Post("/:id/quota/check", sharedmiddleware.JWTAuth(cfg), sharedmiddleware.RequireService(), quotaHandler.CheckQuota)
+	tenants.Get("/:id/entitlements", entitlementHandler.GetEntitlements)
+	tenants.Get("/:id/entitlements/override", entitlementHandler.GetOverride)
+	tenants.Put("/:id/entitlements/override", entitlementHandler.SetOverride)
+	tenants.Delete("/:id/entitlements/override", entitlementHandler.DeleteOverride)
+
+	// Provisioning routes
+	provisioning := api.Group("/provisioning")
+	provisioning.Post("/", provisioningHandler.Provision)
+	provisioning.Get("/:id", provisioningHandler.Get)
 
 	// Subscription routes
 	subscriptions := api.Group("/subscriptions")
 	subscriptions.Get("/tenant/:tenant_id", tenantHandler.GetSubscription)
 	subscriptions.Post("/tenant/:tenant_id", tenantHandler.CreateSubscription)
 	subscriptions.Put("/tenant/:tenant_id", tenantHandler.UpdateSubscription)
+	subscriptions.Post("/tenant/:tenant_id/change-plan", billingHandler.ChangePlan)
+	subscriptions.Get("/tenant/:tenant_id/invoices", billingHandler.ListInvoices)
+	subscriptions.Get("/tenant/:tenant_id/dunning", billingHandler.ListDunningCases)
+	subscriptions.Get("/tenant/:tenant_id/metered-usage", meteringHandler.GetPeriodUsage)
+
+	// Invoice routes
+	invoices := api.Group("/invoices")
+	invoices.Get("/:id", billingHandler.GetInvoice)
+	invoices.Post("/:id/pay", billingHandler.PayInvoice)
+	invoices.Post("/:id/payment-failed", billingHandler.RecordPaymentFailure)
 
 	// Plans routes
 	plans := api.Group("/plans")
@@ -103,6 +199,15 @@ func main() {
 	plans.Get("/:id", tenantHandler.GetPlan)
 	plans.Post("/", tenantHandler.CreatePlan)
 	plans.Put("/:id", tenantHandler.UpdatePlan)
+	plans.Get("/:id/metered-prices", meteringHandler.ListMeteredPrices)
+	plans.Put("/:id/metered-prices", meteringHandler.SetMeteredPrices)
+	plans.Get("/:id/entitlements", entitlementHandler.ListPlanVersions)
+	plans.Post("/:id/entitlements", entitlementHandler.PublishPlanVersion)
+	plans.Post("/:id/entitlements/migrate", entitlementHandler.MigrateSubscribers)
+
+	// Module and tenant configuration routes of the caller's tenant. The
+	// tenant and user come from the access token.
+	routes.SetupModuleRoutes(api, moduleHandler, cfg)
 
 	// Start server
 	go func() {
@@ -123,6 +228,7 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down tenant service...")
+	stopWorkers()
 	if err := app.Shutdown(); err != nil {
 		log.Fatalf("Failed to shutdown server: %v", err)
 	}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type BillingHandler struct {
+	billingService services.BillingService
+	dunningService services.DunningService
+}
+
+func NewBillingHandler(billingService services.BillingService, dunningService services.DunningService) *BillingHandler {
+	return &BillingHandler{
+		billingService: billingService,
+		dunningService: dunningService,
+	}
+}
+
+// ChangePlan godoc
+// @Summary Change a tenant's plan
+// @Description Move the tenant's subscription to another plan. Mid-cycle changes are prorated: unused time on the old plan is credited and the rest of the period on the new plan is charged. A plan with another billing cycle starts a new period.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param request body models.ChangePlanRequest true "Change plan request"
+// @Success 200 {object} models.PlanChange
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/subscriptions/tenant/{tenant_id}/change-plan [post]
+func (h *BillingHandler) ChangePlan(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.ChangePlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	change, err := h.billingService.ChangePlan(c.Context(), tenantID, &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case err.Error() == "subscription not found" || err.Error() == "plan not found":
+			status = fiber.StatusNotFound
+		case strings.HasPrefix(err.Error(), "subscription changed"):
+			status = fiber.StatusConflict
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to change plan",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(change)
+}
+
+// ListInvoices godoc
+// @Summary List a tenant's invoices
+// @Description Get the tenant's invoices, newest first
+// @Tags invoices
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param page query int false "Page number" default(1)
+// @Param per_page query int false "Items per page" default(20)
+// @Success 200 {object} ListResponse
+// @Failure 400 {object} ErrorResponse
+// @Router /api/subscriptions/tenant/{tenant_id}/invoices [get]
+func (h *BillingHandler) ListInvoices(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	perPage, _ := strconv.Atoi(c.Query("per_page", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 || perPage > 100 {
+		perPage = 20
+	}
+
+	offset := (page - 1) * perPage
+
+	invoices, total, err := h.billingService.ListInvoices(c.Context(), tenantID, perPage, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list invoices",
+			Message: err.Error(),
+		})
+	}
+
+	totalPages := (total + perPage - 1) / perPage
+
+	return c.JSON(ListResponse{
+		Data:       invoices,
+		Total:      total,
+		Page:       page,
+		PerPage:    perPage,
+		TotalPages: totalPages,
+	})
+}
+
+// GetInvoice godoc
+// @Summary Get an invoice
+// @Description Get an invoice and its lines
+// @Tags invoices
+// @Produce json
+// @Param id path string true "Invoice ID"
+// @Success 200 {object} models.Invoice
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/invoices/{id} [get]
+func (h *BillingHandler) GetInvoice(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid invoice ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	invoice, err := h.billingService.GetInvoice(c.Context(), id)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "invoice not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to get invoice",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(invoice)
+}
+
+// PayInvoice godoc
+// @Summary Record an invoice payment
+// @Description Mark an open invoice paid. A past due subscription with nothing else overdue becomes active again.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param id path string true "Invoice ID"
+// @Param request body models.PayInvoiceRequest true "Payment"
+// @Success 200 {object} models.Invoice
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/invoices/{id}/pay [post]
+func (h *BillingHandler) PayInvoice(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid invoice ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.PayInvoiceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	invoice, err := h.billingService.PayInvoice(c.Context(), id, &req)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		switch err.Error() {
+		case "invoice not found":
+			status = fiber.StatusNotFound
+		case "invoice is not open":
+			status = fiber.StatusConflict
+		case "payment_method is required":
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to pay invoice",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(invoice)
+}
+
+// RecordPaymentFailure godoc
+// @Summary Record a failed invoice payment
+// @Description Report that collecting an open invoice failed, e.g. from the payment provider's webhook. Starts dunning the invoice: the payment is retried on schedule, the tenant's admins are reminded and the tenant becomes read-only once the grace period is over.
+// @Tags invoices
+// @Accept json
+// @Produce json
+// @Param id path string true "Invoice ID"
+// @Param request body models.PaymentFailedRequest true "Failure"
+// @Success 200 {object} models.DunningCase
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/invoices/{id}/payment-failed [post]
+func (h *BillingHandler) RecordPaymentFailure(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid invoice ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.PaymentFailedRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	dunningCase, err := h.dunningService.RecordPaymentFailure(c.Context(), id, &req)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		switch {
+		case err.Error() == "invoice not found":
+			status = fiber.StatusNotFound
+		case err.Error() == "invoice is not open" || strings.HasPrefix(err.Error(), "dunning case changed"):
+			status = fiber.StatusConflict
+		case err.Error() == "reason is required":
+			status = fiber.StatusBadRequest
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to record payment failure",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(dunningCase)
+}
+
+// ListDunningCases godoc
+// @Summary List a tenant's dunning cases
+// @Description Get the dunning cases of the tenant's unpaid invoices, newest first
+// @Tags subscriptions
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Success 200 {array} models.DunningCase
+// @Failure 400 {object} ErrorResponse
+// @Router /api/subscriptions/tenant/{tenant_id}/dunning [get]
+func (h *BillingHandler) ListDunningCases(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	cases, err := h.dunningService.ListCases(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list dunning cases",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(cases)
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"strings"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type EntitlementHandler struct {
+	entitlementService services.EntitlementService
+}
+
+func NewEntitlementHandler(entitlementService services.EntitlementService) *EntitlementHandler {
+	return &EntitlementHandler{
+		entitlementService: entitlementService,
+	}
+}
+
+// GetEntitlements godoc
+// @Summary Get a tenant's entitlements
+// @Description Get the features, limits and modules the tenant may use: the version of its plan's entitlements it is on with its override applied. Services gate features on it through shared/entitlements.
+// @Tags entitlements
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} entitlements.Entitlements
+// @Failure 400 {object} ErrorResponse
+// @Router /api/tenants/{id}/entitlements [get]
+func (h *EntitlementHandler) GetEntitlements(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	entitlements, err := h.entitlementService.Entitlements(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to get entitlements",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(entitlements)
+}
+
+// GetOverride godoc
+// @Summary Get a tenant's entitlement override
+// @Tags entitlements
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} models.EntitlementOverride
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/tenants/{id}/entitlements/override [get]
+func (h *EntitlementHandler) GetOverride(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	override, err := h.entitlementService.GetOverride(c.Context(), tenantID)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "entitlement override not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to get entitlement override",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(override)
+}
+
+// SetOverride godoc
+// @Summary Set a tenant's entitlement override
+// @Description Replace the tenant's override of its plan's entitlements. Features and modules listed are granted (true) or withheld (false); limits replace the plan's, and a null limit lifts it. The override stops applying at expires_at.
+// @Tags entitlements
+// @Accept json
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Param request body models.EntitlementOverrideRequest true "Override"
+// @Success 200 {object} models.EntitlementOverride
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/tenants/{id}/entitlements/override [put]
+func (h *EntitlementHandler) SetOverride(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.EntitlementOverrideRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	override, err := h.entitlementService.SetOverride(c.Context(), tenantID, &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case err.Error() == "tenant not found":
+			status = fiber.StatusNotFound
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to set entitlement override",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(override)
+}
+
+// DeleteOverride godoc
+// @Summary Delete a tenant's entitlement override
+// @Tags entitlements
+// @Param id path string true "Tenant ID"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/tenants/{id}/entitlements/override [delete]
+func (h *EntitlementHandler) DeleteOverride(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	if err := h.entitlementService.DeleteOverride(c.Context(), tenantID); err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "entitlement override not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to delete entitlement override",
+			Message: err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListPlanVersions godoc
+// @Summary List a plan's entitlement versions
+// @Tags plans
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Success 200 {array} models.PlanEntitlements
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/plans/{id}/entitlements [get]
+func (h *EntitlementHandler) ListPlanVersions(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid plan ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	versions, err := h.entitlementService.ListPlanVersions(c.Context(), planID)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "plan not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to list plan entitlements",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(versions)
+}
+
+// PublishPlanVersion godoc
+// @Summary Publish a plan's entitlements
+// @Description Publish a new version of the features, limits and modules the plan grants. New subscribers get it; existing subscribers keep the version they had until they are migrated.
+// @Tags plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Param request body models.EntitlementSet true "Entitlements"
+// @Success 201 {object} models.PlanEntitlements
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/plans/{id}/entitlements [post]
+func (h *EntitlementHandler) PublishPlanVersion(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid plan ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.EntitlementSet
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	version, err := h.entitlementService.PublishPlanVersion(c.Context(), planID, &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case err.Error() == "plan not found":
+			status = fiber.StatusNotFound
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to publish plan entitlements",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(version)
+}
+
+// MigrateSubscribers godoc
+// @Summary Migrate a plan's subscribers to its latest entitlements
+// @Description Move the plan's grandfathered subscribers to the latest version of its entitlements
+// @Tags plans
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Success 200 {object} models.EntitlementMigration
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/plans/{id}/entitlements/migrate [post]
+func (h *EntitlementHandler) MigrateSubscribers(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid plan ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	migration, err := h.entitlementService.MigrateSubscribers(c.Context(), planID)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case err.Error() == "plan not found":
+			status = fiber.StatusNotFound
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to migrate subscribers",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(migration)
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"strings"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type FeatureFlagHandler struct {
+	flagService services.FeatureFlagService
+}
+
+func NewFeatureFlagHandler(flagService services.FeatureFlagService) *FeatureFlagHandler {
+	return &FeatureFlagHandler{
+		flagService: flagService,
+	}
+}
+
+// featureFlagErrorStatus maps a flag error to its status: missing flags are
+// 404, edits racing another edit 409 and invalid flags 400
+func featureFlagErrorStatus(err error) int {
+	message := err.Error()
+	switch {
+	case message == "feature flag not found":
+		return fiber.StatusNotFound
+	case message == "feature flag already exists",
+		strings.HasPrefix(message, "feature flag is at version"),
+		strings.HasPrefix(message, "feature flag was changed"):
+		return fiber.StatusConflict
+	case strings.HasPrefix(message, "failed to"):
+		return fiber.StatusInternalServerError
+	}
+	return fiber.StatusBadRequest
+}
+
+// ListFlags godoc
+// @Summary List feature flags
+// @Tags feature-flags
+// @Produce json
+// @Success 200 {array} featureflags.Flag
+// @Router /api/flags [get]
+func (h *FeatureFlagHandler) ListFlags(c *fiber.Ctx) error {
+	flags, err := h.flagService.ListFlags(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to list feature flags",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(flags)
+}
+
+// GetFlag godoc
+// @Summary Get a feature flag
+// @Tags feature-flags
+// @Produce json
+// @Param key path string true "Flag key"
+// @Success 200 {object} featureflags.Flag
+// @Failure 404 {object} ErrorResponse
+// @Router /api/flags/{key} [get]
+func (h *FeatureFlagHandler) GetFlag(c *fiber.Ctx) error {
+	flag, err := h.flagService.GetFlag(c.Context(), c.Params("key"))
+	if err != nil {
+		return c.Status(featureFlagErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to get feature flag",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(flag)
+}
+
+// CreateFlag godoc
+// @Summary Create a feature flag
+// @Description Create a boolean or multivariate flag. Enabled flags serve the first rule whose conditions all match the context (tenant, plan, user, role or a custom attribute) and the fallthrough otherwise; a rule or the fallthrough serves a variation or a percentage rollout with weights adding up to 10000.
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param request body models.FeatureFlagRequest true "Flag"
+// @Success 201 {object} featureflags.Flag
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/flags [post]
+func (h *FeatureFlagHandler) CreateFlag(c *fiber.Ctx) error {
+	var req models.FeatureFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	flag, err := h.flagService.CreateFlag(c.Context(), &req)
+	if err != nil {
+		return c.Status(featureFlagErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to create feature flag",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(flag)
+}
+
+// UpdateFlag godoc
+// @Summary Update a feature flag
+// @Description Replace the flag's variations, rules and fallthrough. The version must be the flag's current version, so a concurrent edit is not overwritten. Whether the flag is enabled is changed with the kill switch.
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param request body models.FeatureFlagRequest true "Flag"
+// @Success 200 {object} featureflags.Flag
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/flags/{key} [put]
+func (h *FeatureFlagHandler) UpdateFlag(c *fiber.Ctx) error {
+	var req models.FeatureFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	flag, err := h.flagService.UpdateFlag(c.Context(), c.Params("key"), &req)
+	if err != nil {
+		return c.Status(featureFlagErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to update feature flag",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(flag)
+}
+
+// SetEnabled godoc
+// @Summary Turn a feature flag on or off
+// @Description The kill switch: a disabled flag serves its off variation to every context. Services pick the change up within seconds.
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param key path string true "Flag key"
+// @Param request body models.SetFlagEnabledRequest true "Enabled"
+// @Success 200 {object} featureflags.Flag
+// @Failure 404 {object} ErrorResponse
+// @Router /api/flags/{key}/enabled [put]
+func (h *FeatureFlagHandler) SetEnabled(c *fiber.Ctx) error {
+	var req models.SetFlagEnabledRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	flag, err := h.flagService.SetEnabled(c.Context(), c.Params("key"), req.Enabled)
+	if err != nil {
+		return c.Status(featureFlagErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to update feature flag",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(flag)
+}
+
+// DeleteFlag godoc
+// @Summary Delete a feature flag
+// @Tags feature-flags
+// @Param key path string true "Flag key"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Router /api/flags/{key} [delete]
+func (h *FeatureFlagHandler) DeleteFlag(c *fiber.Ctx) error {
+	if err := h.flagService.DeleteFlag(c.Context(), c.Params("key")); err != nil {
+		return c.Status(featureFlagErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to delete feature flag",
+			Message: err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetRuleset godoc
+// @Summary Get the feature flag ruleset
+// @Description Get every flag with the version of the ruleset, which the shared/featureflags client caches and evaluates locally
+// @Tags feature-flags
+// @Produce json
+// @Success 200 {object} featureflags.Ruleset
+// @Router /api/flags/ruleset [get]
+func (h *FeatureFlagHandler) GetRuleset(c *fiber.Ctx) error {
+	ruleset, err := h.flagService.Ruleset(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to get feature flags",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(ruleset)
+}
+
+// Evaluate godoc
+// @Summary Evaluate feature flags
+// @Description Evaluate flags for a context, e.g. to check targeting before enabling a flag. The plan of the context's tenant is looked up when not given.
+// @Tags feature-flags
+// @Accept json
+// @Produce json
+// @Param request body models.EvaluateFlagsRequest true "Context"
+// @Success 200 {object} map[string]featureflags.Evaluation
+// @Failure 400 {object} ErrorResponse
+// @Router /api/flags/evaluate [post]
+func (h *FeatureFlagHandler) Evaluate(c *fiber.Ctx) error {
+	var req models.EvaluateFlagsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	evaluations, err := h.flagService.Evaluate(c.Context(), &req)
+	if err != nil {
+		return c.Status(featureFlagErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to evaluate feature flags",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(evaluations)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"strings"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type MeteringHandler struct {
+	meteringService services.MeteringService
+}
+
+func NewMeteringHandler(meteringService services.MeteringService) *MeteringHandler {
+	return &MeteringHandler{
+		meteringService: meteringService,
+	}
+}
+
+// RecordUsage godoc
+// @Summary Report usage events
+// @Description Record usage events of metered metrics, e.g. POS transactions or SMS sends. Events are deduplicated by tenant, metric and idempotency key, so a failed report can be retried. Only services may call it.
+// @Tags usage
+// @Accept json
+// @Produce json
+// @Param request body models.RecordUsageRequest true "Usage events"
+// @Success 202 {object} models.UsageRecorded
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /api/usage/events [post]
+func (h *MeteringHandler) RecordUsage(c *fiber.Ctx) error {
+	var req models.RecordUsageRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	recorded, err := h.meteringService.RecordUsage(c.Context(), &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "failed to") {
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to record usage",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(recorded)
+}
+
+// GetPeriodUsage godoc
+// @Summary Get a tenant's metered usage
+// @Description Get the tenant's metered usage in its current billing period so far and what it will be billed at the end of the period
+// @Tags usage
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Success 200 {object} models.PeriodUsage
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/subscriptions/tenant/{tenant_id}/metered-usage [get]
+func (h *MeteringHandler) GetPeriodUsage(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("tenant_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	usage, err := h.meteringService.GetPeriodUsage(c.Context(), tenantID)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "subscription not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to get usage",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(usage)
+}
+
+// ListMeteredPrices godoc
+// @Summary List a plan's metered prices
+// @Description Get the usage-based price components billed alongside the plan's flat price
+// @Tags plans
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Success 200 {array} models.MeteredPrice
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/plans/{id}/metered-prices [get]
+func (h *MeteringHandler) ListMeteredPrices(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid plan ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	prices, err := h.meteringService.ListMeteredPrices(c.Context(), planID)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "plan not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to list metered prices",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(prices)
+}
+
+// SetMeteredPrices godoc
+// @Summary Set a plan's metered prices
+// @Description Replace the usage-based price components of a plan. Usage beyond the included quantity of a billing period is billed at the unit price when the period ends.
+// @Tags plans
+// @Accept json
+// @Produce json
+// @Param id path string true "Plan ID"
+// @Param request body models.MeteredPricesRequest true "Metered prices"
+// @Success 200 {array} models.MeteredPrice
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/plans/{id}/metered-prices [put]
+func (h *MeteringHandler) SetMeteredPrices(c *fiber.Ctx) error {
+	planID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid plan ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.MeteredPricesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	prices, err := h.meteringService.SetMeteredPrices(c.Context(), planID, &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		switch {
+		case err.Error() == "plan not found":
+			status = fiber.StatusNotFound
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to set metered prices",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(prices)
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -38,9 +40,9 @@ func (h *ModuleHandler) GetAvailableModules(c *fiber.Ctx) error {
 
 // GetTenantModules returns modules for a specific tenant
 func (h *ModuleHandler) GetTenantModules(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	modules, err := h.moduleService.GetTenantModules(tenantID)
@@ -62,9 +64,9 @@ func (h *ModuleHandler) InstallModule(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	moduleID, err := uuid.Parse(req.ModuleID)
@@ -72,27 +74,85 @@ func (h *ModuleHandler) InstallModule(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
 	}
 
-	userID, err := uuid.Parse(c.Locals("user_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid user ID"})
+	userID, authErr := localID(c, "user_id", "user")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
-	installation, err := h.moduleService.InstallModule(tenantID, moduleID, userID, req.Version, req.Config)
+	result, err := h.moduleService.InstallModule(tenantID, moduleID, userID, req.Version, req.Config)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.Status(201).JSON(fiber.Map{
-		"message":      "Module installed successfully",
-		"installation": installation,
+	// The install hooks run in the background; GET
+	// /api/modules/:moduleId/installation follows them
+	return c.Status(202).JSON(fiber.Map{
+		"message":       "Module installation started",
+		"plan":          result.Plan,
+		"installations": result.Installations,
 	})
 }
 
+// PlanInstall shows what installing a module would install, without
+// installing anything
+func (h *ModuleHandler) PlanInstall(c *fiber.Ctx) error {
+	var req models.InstallModuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(req.ModuleID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	plan, err := h.moduleService.PlanInstall(tenantID, moduleID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"plan": plan})
+}
+
 // UninstallModule uninstalls a module for a tenant
 func (h *ModuleHandler) UninstallModule(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(c.Params("moduleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	// ?cascade=true also uninstalls the modules depending on it
+	plan, err := h.moduleService.UninstallModule(tenantID, moduleID, c.QueryBool("cascade"))
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"message": "Module uninstallation started",
+		"plan":    plan,
+	})
+}
+
+// PlanUninstall shows which modules uninstalling a module would take with
+// it, without uninstalling anything
+func (h *ModuleHandler) PlanUninstall(c *fiber.Ctx) error {
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	moduleID, err := uuid.Parse(c.Params("moduleId"))
@@ -100,19 +160,19 @@ func (h *ModuleHandler) UninstallModule(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
 	}
 
-	err = h.moduleService.UninstallModule(tenantID, moduleID)
+	plan, err := h.moduleService.PlanUninstall(tenantID, moduleID)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(fiber.Map{"message": "Module uninstalled successfully"})
+	return c.JSON(fiber.Map{"plan": plan})
 }
 
 // EnableModule enables a module for a tenant
 func (h *ModuleHandler) EnableModule(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	moduleID, err := uuid.Parse(c.Params("moduleId"))
@@ -130,9 +190,9 @@ func (h *ModuleHandler) EnableModule(c *fiber.Ctx) error {
 
 // DisableModule disables a module for a tenant
 func (h *ModuleHandler) DisableModule(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	moduleID, err := uuid.Parse(c.Params("moduleId"))
@@ -148,6 +208,261 @@ func (h *ModuleHandler) DisableModule(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Module disabled successfully"})
 }
 
+// GetInstallationStatus returns a module's installation with its lifecycle
+// jobs
+func (h *ModuleHandler) GetInstallationStatus(c *fiber.Ctx) error {
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(c.Params("moduleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	status, err := h.moduleService.GetInstallationStatus(tenantID, moduleID)
+	if err != nil {
+		if err.Error() == "module installation not found" {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(status)
+}
+
+// RetryInstallation runs a module's failed lifecycle hooks again
+func (h *ModuleHandler) RetryInstallation(c *fiber.Ctx) error {
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(c.Params("moduleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	err = h.moduleService.RetryInstallation(tenantID, moduleID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{"message": "Module lifecycle hooks queued again"})
+}
+
+// UpgradeModule upgrades a module to its current version for a tenant
+func (h *ModuleHandler) UpgradeModule(c *fiber.Ctx) error {
+	var req models.UpgradeModuleRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(c.Params("moduleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	userID, authErr := localID(c, "user_id", "user")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	upgrade, err := h.moduleService.UpgradeModule(tenantID, moduleID, userID, req.Version)
+	if err != nil {
+		return c.Status(moduleErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"message": "Module upgrade started",
+		"upgrade": upgrade,
+	})
+}
+
+// RollbackModule rolls a module back to the version before its latest
+// upgrade
+func (h *ModuleHandler) RollbackModule(c *fiber.Ctx) error {
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(c.Params("moduleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	upgrade, err := h.moduleService.RollbackModule(tenantID, moduleID)
+	if err != nil {
+		return c.Status(moduleErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(fiber.Map{
+		"message": "Module rollback started",
+		"upgrade": upgrade,
+	})
+}
+
+// GetUpgradeHistory returns a module's upgrades for a tenant
+func (h *ModuleHandler) GetUpgradeHistory(c *fiber.Ctx) error {
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	moduleID, err := uuid.Parse(c.Params("moduleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	upgrades, err := h.moduleService.GetUpgradeHistory(tenantID, moduleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"upgrades": upgrades})
+}
+
+// CreateRollout starts a staged rollout of a module's current version
+func (h *ModuleHandler) CreateRollout(c *fiber.Ctx) error {
+	var req models.CreateModuleRolloutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	moduleID, err := uuid.Parse(req.ModuleID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid module ID"})
+	}
+
+	userID, authErr := localID(c, "user_id", "user")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
+	}
+
+	rollout, err := h.moduleService.CreateRollout(moduleID, userID, req.MaxFailures)
+	if err != nil {
+		return c.Status(moduleErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"rollout": rollout})
+}
+
+// GetRollout returns a rollout and its progress
+func (h *ModuleHandler) GetRollout(c *fiber.Ctx) error {
+	rolloutID, err := uuid.Parse(c.Params("rolloutId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	progress, err := h.moduleService.GetRollout(rolloutID)
+	if err != nil {
+		return c.Status(moduleErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(progress)
+}
+
+// AdvanceRollout upgrades the next cohort of tenants of a rollout
+func (h *ModuleHandler) AdvanceRollout(c *fiber.Ctx) error {
+	var req models.AdvanceModuleRolloutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rolloutID, err := uuid.Parse(c.Params("rolloutId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	tenantIDs := make([]uuid.UUID, 0, len(req.TenantIDs))
+	for _, id := range req.TenantIDs {
+		tenantID, err := uuid.Parse(id)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+		}
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+
+	cohort, err := h.moduleService.AdvanceRollout(rolloutID, req.Size, tenantIDs)
+	if err != nil {
+		return c.Status(moduleErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.Status(202).JSON(cohort)
+}
+
+// UpdateRolloutStatus pauses, resumes or cancels a rollout
+func (h *ModuleHandler) UpdateRolloutStatus(c *fiber.Ctx) error {
+	var req models.UpdateModuleRolloutRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if err := h.validator.Struct(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rolloutID, err := uuid.Parse(c.Params("rolloutId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid rollout ID"})
+	}
+
+	rollout, err := h.moduleService.SetRolloutStatus(rolloutID, req.Status)
+	if err != nil {
+		return c.Status(moduleErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"rollout": rollout})
+}
+
+// localID returns the tenant or user ID the auth middleware took from the
+// access token. It fails with 401 when the request was not authenticated.
+func localID(c *fiber.Ctx, key, name string) (uuid.UUID, *fiber.Error) {
+	value, ok := c.Locals(key).(string)
+	if !ok {
+		return uuid.Nil, fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
+	}
+
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fiber.NewError(fiber.StatusBadRequest, "Invalid "+name+" ID")
+	}
+	return id, nil
+}
+
+// moduleErrorStatus maps a module service error to its status code
+func moduleErrorStatus(err error) int {
+	message := err.Error()
+	switch {
+	case strings.HasPrefix(message, "failed to"):
+		return 500
+	case strings.Contains(message, "not found"), message == "module is not installed":
+		return 404
+	case strings.Contains(message, "already"), strings.HasPrefix(message, "rollout is"), strings.HasPrefix(message, "cannot"):
+		return 409
+	}
+	return 400
+}
+
 // UpdateModuleConfig updates module configuration
 func (h *ModuleHandler) UpdateModuleConfig(c *fiber.Ctx) error {
 	var req models.UpdateModuleConfigRequest
@@ -159,9 +474,9 @@ func (h *ModuleHandler) UpdateModuleConfig(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	moduleID, err := uuid.Parse(c.Params("moduleId"))
@@ -179,9 +494,9 @@ func (h *ModuleHandler) UpdateModuleConfig(c *fiber.Ctx) error {
 
 // GetTenantConfiguration gets tenant configuration
 func (h *ModuleHandler) GetTenantConfiguration(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	config, err := h.tenantConfigService.GetTenantConfiguration(tenantID)
@@ -199,12 +514,12 @@ func (h *ModuleHandler) UpdateTenantConfiguration(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
-	err = h.tenantConfigService.UpdateTenantConfiguration(tenantID, &req)
+	err := h.tenantConfigService.UpdateTenantConfiguration(tenantID, &req)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -227,12 +542,12 @@ func (h *ModuleHandler) SetupCustomDomain(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
-	err = h.tenantConfigService.SetupCustomDomain(tenantID, req.Domain, req.SSLEnabled)
+	err := h.tenantConfigService.SetupCustomDomain(tenantID, req.Domain, req.SSLEnabled)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -242,12 +557,12 @@ func (h *ModuleHandler) SetupCustomDomain(c *fiber.Ctx) error {
 
 // RemoveCustomDomain removes custom domain from tenant
 func (h *ModuleHandler) RemoveCustomDomain(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
-	err = h.tenantConfigService.RemoveCustomDomain(tenantID)
+	err := h.tenantConfigService.RemoveCustomDomain(tenantID)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -257,9 +572,9 @@ func (h *ModuleHandler) RemoveCustomDomain(c *fiber.Ctx) error {
 
 // GetFeatureFlags gets feature flags for tenant
 func (h *ModuleHandler) GetFeatureFlags(c *fiber.Ctx) error {
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	flags, err := h.tenantConfigService.GetFeatureFlags(tenantID)
@@ -280,9 +595,9 @@ func (h *ModuleHandler) UpdateFeatureFlag(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
 	}
 
-	tenantID, err := uuid.Parse(c.Locals("tenant_id").(string))
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid tenant ID"})
+	tenantID, authErr := localID(c, "tenant_id", "tenant")
+	if authErr != nil {
+		return c.Status(authErr.Code).JSON(fiber.Map{"error": authErr.Message})
 	}
 
 	flagName := c.Params("flagName")
@@ -290,7 +605,7 @@ func (h *ModuleHandler) UpdateFeatureFlag(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Flag name is required"})
 	}
 
-	err = h.tenantConfigService.UpdateFeatureFlag(tenantID, flagName, req.Value)
+	err := h.tenantConfigService.UpdateFeatureFlag(tenantID, flagName, req.Value)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
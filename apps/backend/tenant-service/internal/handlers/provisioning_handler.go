@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type ProvisioningHandler struct {
+	provisioningService services.ProvisioningService
+}
+
+// ProvisioningErrorResponse is returned when provisioning was rolled back.
+// Provisioning says which step failed and how far the rollback got.
+type ProvisioningErrorResponse struct {
+	Error        string                     `json:"error"`
+	Message      string                     `json:"message"`
+	Provisioning *models.TenantProvisioning `json:"provisioning,omitempty"`
+}
+
+func NewProvisioningHandler(provisioningService services.ProvisioningService) *ProvisioningHandler {
+	return &ProvisioningHandler{
+		provisioningService: provisioningService,
+	}
+}
+
+// Provision godoc
+// @Summary Provision a tenant
+// @Description Create a tenant with its configuration, a trial subscription, modules, first admin user and seed data. A failed step rolls back the completed ones.
+// @Tags provisioning
+// @Accept json
+// @Produce json
+// @Param request body models.ProvisionTenantRequest true "Provision tenant request"
+// @Success 201 {object} models.TenantProvisioning
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ProvisioningErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/provisioning [post]
+func (h *ProvisioningHandler) Provision(c *fiber.Ctx) error {
+	var req models.ProvisionTenantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	provisioning, err := h.provisioningService.Provision(c.Context(), &req)
+	if err != nil {
+		if provisioning != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(ProvisioningErrorResponse{
+				Error:        "Provisioning failed",
+				Message:      err.Error(),
+				Provisioning: provisioning,
+			})
+		}
+		return c.Status(provisioningErrorStatus(err)).JSON(ErrorResponse{
+			Error:   "Failed to provision tenant",
+			Message: err.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(provisioning)
+}
+
+// Get godoc
+// @Summary Get a tenant provisioning
+// @Description Get the status of a provisioning and each of its steps
+// @Tags provisioning
+// @Produce json
+// @Param id path string true "Provisioning ID"
+// @Success 200 {object} models.TenantProvisioning
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/provisioning/{id} [get]
+func (h *ProvisioningHandler) Get(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid provisioning ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	provisioning, err := h.provisioningService.GetProvisioning(c.Context(), id)
+	if err != nil {
+		status := fiber.StatusInternalServerError
+		if err.Error() == "provisioning not found" {
+			status = fiber.StatusNotFound
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to get provisioning",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(provisioning)
+}
+
+// provisioningErrorStatus maps an error of provisioning a tenant to a status
+func provisioningErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrProvisioningFailed):
+		return fiber.StatusUnprocessableEntity
+	case strings.HasSuffix(err.Error(), "already exists"):
+		return fiber.StatusConflict
+	case strings.HasPrefix(err.Error(), "failed to"):
+		return fiber.StatusInternalServerError
+	default:
+		return fiber.StatusBadRequest
+	}
+}
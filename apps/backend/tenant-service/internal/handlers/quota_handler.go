@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"strings"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type QuotaHandler struct {
+	quotaService services.QuotaService
+}
+
+func NewQuotaHandler(quotaService services.QuotaService) *QuotaHandler {
+	return &QuotaHandler{
+		quotaService: quotaService,
+	}
+}
+
+// GetUsage godoc
+// @Summary Get a tenant's usage
+// @Description Get the tenant's live usage of users and storage against the limits of its plan. A null limit is unlimited.
+// @Tags quotas
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} models.TenantUsage
+// @Failure 400 {object} ErrorResponse
+// @Router /api/tenants/{id}/usage [get]
+func (h *QuotaHandler) GetUsage(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	usage, err := h.quotaService.GetUsage(c.Context(), tenantID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to get usage",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(usage)
+}
+
+// CheckQuota godoc
+// @Summary Check a tenant's quota
+// @Description Ask whether the tenant may add an amount of users or storage bytes. Services call it before inviting or registering users and storing files. The answer is 200 whether or not it is allowed.
+// @Tags quotas
+// @Accept json
+// @Produce json
+// @Param id path string true "Tenant ID"
+// @Param request body models.QuotaCheckRequest true "Quota check"
+// @Success 200 {object} models.QuotaCheck
+// @Failure 400 {object} ErrorResponse
+// @Router /api/tenants/{id}/quota/check [post]
+func (h *QuotaHandler) CheckQuota(c *fiber.Ctx) error {
+	tenantID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid tenant ID",
+			Message: "ID must be a valid UUID",
+		})
+	}
+
+	var req models.QuotaCheckRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid request body",
+			Message: err.Error(),
+		})
+	}
+
+	check, err := h.quotaService.CheckQuota(c.Context(), tenantID, &req)
+	if err != nil {
+		status := fiber.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "failed to") {
+			status = fiber.StatusInternalServerError
+		}
+		return c.Status(status).JSON(ErrorResponse{
+			Error:   "Failed to check quota",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(check)
+}
@@ -50,6 +50,8 @@ func NewTenantHandler(tenantService services.TenantService) *TenantHandler {
 // @Success 201 {object} models.Tenant
 // @Failure 400 {object} ErrorResponse
 // @Failure 409 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /api/tenants [post]
 func (h *TenantHandler) Create(c *fiber.Ctx) error {
 	var req models.CreateTenantRequest
@@ -62,11 +64,7 @@ func (h *TenantHandler) Create(c *fiber.Ctx) error {
 
 	tenant, err := h.tenantService.CreateTenant(c.Context(), &req)
 	if err != nil {
-		status := fiber.StatusBadRequest
-		if err.Error() == "subdomain already exists" || err.Error() == "domain already exists" {
-			status = fiber.StatusConflict
-		}
-		return c.Status(status).JSON(ErrorResponse{
+		return c.Status(provisioningErrorStatus(err)).JSON(ErrorResponse{
 			Error:   "Failed to create tenant",
 			Message: err.Error(),
 		})
@@ -294,6 +292,35 @@ func (h *TenantHandler) Suspend(c *fiber.Ctx) error {
 	})
 }
 
+// Stats godoc
+// @Summary Get tenant and revenue statistics
+// @Description Count tenants by status and compute subscription MRR/ARR, with the same figures for the preceding period
+// @Tags tenants
+// @Produce json
+// @Param days query int false "Period length in days (1-365)" default(30)
+// @Success 200 {object} models.TenantStats
+// @Failure 400 {object} ErrorResponse
+// @Router /api/stats [get]
+func (h *TenantHandler) Stats(c *fiber.Ctx) error {
+	days, err := strconv.Atoi(c.Query("days", "30"))
+	if err != nil || days < 1 || days > 365 {
+		return c.Status(fiber.StatusBadRequest).JSON(ErrorResponse{
+			Error:   "Invalid days",
+			Message: "days must be a number between 1 and 365",
+		})
+	}
+
+	stats, err := h.tenantService.GetStats(c.Context(), days)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(ErrorResponse{
+			Error:   "Failed to get statistics",
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(stats)
+}
+
 // Subscription endpoints
 
 // GetSubscription godoc
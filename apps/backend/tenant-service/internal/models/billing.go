@@ -0,0 +1,128 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubscriptionStatusPastDue marks a subscription with an overdue invoice
+const SubscriptionStatusPastDue = "past_due"
+
+// Invoice statuses
+const (
+	InvoiceStatusOpen = "open"
+	InvoiceStatusPaid = "paid"
+	InvoiceStatusVoid = "void"
+)
+
+// Invoice reasons
+const (
+	InvoiceReasonSubscriptionCreate = "subscription_create"
+	InvoiceReasonSubscriptionCycle  = "subscription_cycle"
+	InvoiceReasonTrialConversion    = "trial_conversion"
+	InvoiceReasonPlanChange         = "plan_change"
+	InvoiceReasonUsage              = "usage"
+)
+
+// Invoice line kinds
+const (
+	InvoiceLineSubscription    = "subscription"
+	InvoiceLineProrationCredit = "proration_credit"
+	InvoiceLineProrationCharge = "proration_charge"
+	InvoiceLineMetered         = "metered"
+)
+
+// Invoice bills a subscription for a period or a plan change
+type Invoice struct {
+	ID             uuid.UUID     `json:"id" db:"id"`
+	TenantID       uuid.UUID     `json:"tenant_id" db:"tenant_id"`
+	SubscriptionID uuid.UUID     `json:"subscription_id" db:"subscription_id"`
+	Number         string        `json:"number" db:"number"`
+	Reason         string        `json:"reason" db:"reason"` // subscription_create, subscription_cycle, trial_conversion, plan_change, usage
+	Status         string        `json:"status" db:"status"` // open, paid, void
+	Currency       string        `json:"currency" db:"currency"`
+	Lines          []InvoiceLine `json:"lines" db:"lines"`
+	Subtotal       float64       `json:"subtotal" db:"subtotal"`
+	CreditApplied  float64       `json:"credit_applied" db:"credit_applied"`
+	Total          float64       `json:"total" db:"total"`
+	PeriodStart    time.Time     `json:"period_start" db:"period_start"`
+	PeriodEnd      time.Time     `json:"period_end" db:"period_end"`
+	IssuedAt       time.Time     `json:"issued_at" db:"issued_at"`
+	DueAt          time.Time     `json:"due_at" db:"due_at"`
+	PaidAt         *time.Time    `json:"paid_at,omitempty" db:"paid_at"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// InvoiceLine is one charge or credit of an invoice. Credits are negative.
+// Metered lines also carry the metric and the quantity billed.
+type InvoiceLine struct {
+	Kind        string     `json:"kind"`
+	Description string     `json:"description"`
+	PlanID      *uuid.UUID `json:"plan_id,omitempty"`
+	Metric      string     `json:"metric,omitempty"`
+	Quantity    float64    `json:"quantity,omitempty"`
+	UnitPrice   float64    `json:"unit_price,omitempty"`
+	Amount      float64    `json:"amount"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+}
+
+// Credit is what a negative invoice adds to the subscription's credit
+// balance
+func (i *Invoice) Credit() float64 {
+	return math.Max(-i.Subtotal, 0)
+}
+
+// ApplyCredit pays as much of the invoice as the credit balance covers. An
+// invoice left with nothing to pay is paid when issued.
+func (i *Invoice) ApplyCredit(balance float64) {
+	i.CreditApplied = 0
+	if i.Subtotal > 0 && balance > 0 {
+		i.CreditApplied = RoundAmount(math.Min(balance, i.Subtotal))
+	}
+
+	i.Total = RoundAmount(math.Max(i.Subtotal-i.CreditApplied, 0))
+	i.Status = InvoiceStatusOpen
+	i.PaidAt = nil
+	if i.Total == 0 {
+		paidAt := i.IssuedAt
+		i.Status = InvoiceStatusPaid
+		i.PaidAt = &paidAt
+	}
+}
+
+// RoundAmount rounds an amount to cents
+func RoundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// BillingRun summarises one run of the billing engine
+type BillingRun struct {
+	Subscriptions int       `json:"subscriptions"`
+	Invoiced      int       `json:"invoiced"`
+	PastDue       int       `json:"past_due"`
+	Reactivated   int       `json:"reactivated"`
+	Cancelled     int       `json:"cancelled"`
+	Expired       int       `json:"expired"`
+	Failed        int       `json:"failed"`
+	RanAt         time.Time `json:"ran_at"`
+}
+
+// PlanChange is the outcome of moving a subscription to another plan.
+// Invoice is nil when nothing was prorated, e.g. during a trial.
+type PlanChange struct {
+	Subscription *Subscription `json:"subscription"`
+	Invoice      *Invoice      `json:"invoice,omitempty"`
+}
+
+type ChangePlanRequest struct {
+	PlanID string `json:"plan_id" validate:"required,uuid"`
+}
+
+type PayInvoiceRequest struct {
+	PaymentMethod     string  `json:"payment_method" validate:"required"`
+	ExternalPaymentID *string `json:"external_payment_id,omitempty"`
+}
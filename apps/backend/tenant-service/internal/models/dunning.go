@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Dunning case statuses
+const (
+	DunningStatusOpen      = "open"      // retrying, the tenant keeps full access
+	DunningStatusSuspended = "suspended" // grace period over, the tenant is read-only
+	DunningStatusRecovered = "recovered" // the invoice was paid
+	DunningStatusClosed    = "closed"    // the invoice was voided
+)
+
+// DunningCase tracks the collection of one unpaid invoice: payment retries,
+// reminders to the tenant's admins and the suspension of the tenant once
+// the grace period is over
+type DunningCase struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	TenantID       uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	SubscriptionID uuid.UUID  `json:"subscription_id" db:"subscription_id"`
+	InvoiceID      uuid.UUID  `json:"invoice_id" db:"invoice_id"`
+	Status         string     `json:"status" db:"status"` // open, suspended, recovered, closed
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" db:"next_attempt_at"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at,omitempty" db:"last_attempt_at"`
+	LastError      *string    `json:"last_error,omitempty" db:"last_error"`
+	RemindersSent  int        `json:"reminders_sent" db:"reminders_sent"`
+	StartedAt      time.Time  `json:"started_at" db:"started_at"`
+	GraceEndsAt    time.Time  `json:"grace_ends_at" db:"grace_ends_at"`
+	SuspendedAt    *time.Time `json:"suspended_at,omitempty" db:"suspended_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty" db:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// IsActive reports whether the case still collects its invoice
+func (c *DunningCase) IsActive() bool {
+	return c.Status == DunningStatusOpen || c.Status == DunningStatusSuspended
+}
+
+// DunningPolicy is when a failed payment is retried, in days after the
+// failure, and how many days after it the tenant is suspended
+type DunningPolicy struct {
+	RetryDays []int
+	GraceDays int
+}
+
+// ChargeResult is the outcome of charging an invoice
+type ChargeResult struct {
+	Succeeded     bool   `json:"succeeded"`
+	PaymentMethod string `json:"payment_method"`
+	TransactionID string `json:"transaction_id"`
+	Message       string `json:"message"`
+}
+
+// PaymentFailedRequest reports a failed payment of an invoice, e.g. by the
+// payment provider's webhook
+type PaymentFailedRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+// DunningRun summarizes one pass of the dunning worker
+type DunningRun struct {
+	Cases     int       `json:"cases"`
+	Retried   int       `json:"retried"`
+	Recovered int       `json:"recovered"`
+	Suspended int       `json:"suspended"`
+	Failed    int       `json:"failed"`
+	RanAt     time.Time `json:"ran_at"`
+}
+
+// TenantNotification is a notice auth-service emails to a tenant's admins
+type TenantNotification struct {
+	Template string            `json:"template"`
+	Params   map[string]string `json:"params"`
+}
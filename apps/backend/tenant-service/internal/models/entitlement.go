@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EntitlementSet is what a version of a plan grants: boolean features,
+// numeric limits and the modules its tenants may enable. Limits not listed
+// are unlimited.
+type EntitlementSet struct {
+	Features map[string]bool  `json:"features"`
+	Limits   map[string]int64 `json:"limits"`
+	Modules  []string         `json:"modules"`
+}
+
+// PlanEntitlements is a published version of a plan's entitlements. Versions
+// are never changed; changing what a plan grants publishes a new version,
+// and the plan's existing subscribers keep the version they had.
+type PlanEntitlements struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	PlanID    uuid.UUID `json:"plan_id" db:"plan_id"`
+	Version   int       `json:"version" db:"version"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	EntitlementSet
+}
+
+// EntitlementOverride adjusts one tenant's entitlements on top of its plan,
+// e.g. for a custom deal or a trial of a feature. An override past its
+// expiry no longer applies.
+type EntitlementOverride struct {
+	TenantID uuid.UUID       `json:"tenant_id" db:"tenant_id"`
+	Features map[string]bool `json:"features" db:"features"`
+	// Limits replace the plan's limits; a null limit lifts it
+	Limits map[string]*int64 `json:"limits" db:"limits"`
+	// Modules grants the modules listed true and withholds those listed
+	// false
+	Modules   map[string]bool `json:"modules" db:"modules"`
+	Reason    string          `json:"reason" db:"reason"`
+	ExpiresAt *time.Time      `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// IsActive reports whether the override applies at the given time
+func (o *EntitlementOverride) IsActive(at time.Time) bool {
+	return o.ExpiresAt == nil || o.ExpiresAt.After(at)
+}
+
+// EntitlementOverrideRequest replaces a tenant's override
+type EntitlementOverrideRequest struct {
+	Features  map[string]bool   `json:"features"`
+	Limits    map[string]*int64 `json:"limits"`
+	Modules   map[string]bool   `json:"modules"`
+	Reason    string            `json:"reason" validate:"required"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+}
+
+// EntitlementMigration is the result of moving a plan's grandfathered
+// subscribers to its latest version
+type EntitlementMigration struct {
+	PlanID     uuid.UUID `json:"plan_id"`
+	Version    int       `json:"version"`
+	Migrated   int       `json:"migrated"`
+	MigratedAt time.Time `json:"migrated_at"`
+}
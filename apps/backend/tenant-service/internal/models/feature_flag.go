@@ -0,0 +1,35 @@
+package models
+
+import "zplus-saas/apps/backend/shared/featureflags"
+
+// FeatureFlagRequest defines a flag. A boolean flag without variations gets
+// the variations on and off. A new flag is created disabled unless Enabled
+// is set; updating a flag keeps it enabled or disabled.
+type FeatureFlagRequest struct {
+	Key          string                   `json:"key"` // only when creating
+	Description  string                   `json:"description"`
+	Kind         string                   `json:"kind" validate:"required,oneof=boolean multivariate"`
+	Variations   []featureflags.Variation `json:"variations"`
+	OffVariation string                   `json:"off_variation"`
+	Rules        []featureflags.Rule      `json:"rules"`
+	Fallthrough  featureflags.Serve       `json:"fallthrough"`
+	Enabled      bool                     `json:"enabled"`
+	// Version is the version of the flag being updated, so an update does
+	// not overwrite a change made since it was read
+	Version int `json:"version"`
+}
+
+// SetFlagEnabledRequest turns a flag on or off. Turning it off is the kill
+// switch: every context gets the off variation.
+type SetFlagEnabledRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// EvaluateFlagsRequest evaluates flags for a context. The plan of the
+// context's tenant is looked up when it is not given.
+type EvaluateFlagsRequest struct {
+	Context featureflags.Context `json:"context"`
+	// Keys limits the evaluation to these flags; all flags are evaluated
+	// when it is empty
+	Keys []string `json:"keys,omitempty"`
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxUsageEventsPerRequest bounds a batch of reported usage events
+const MaxUsageEventsPerRequest = 1000
+
+// UsageEvent is a quantity of a metric a tenant used, e.g. one POS
+// transaction or the GB stored on a day
+type UsageEvent struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	TenantID       uuid.UUID `json:"tenant_id" db:"tenant_id"`
+	Metric         string    `json:"metric" db:"metric"`
+	Quantity       float64   `json:"quantity" db:"quantity"`
+	OccurredAt     time.Time `json:"occurred_at" db:"occurred_at"`
+	IdempotencyKey string    `json:"idempotency_key" db:"idempotency_key"`
+	Source         string    `json:"source" db:"source"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+type UsageEventInput struct {
+	TenantID       string     `json:"tenant_id" validate:"required,uuid"`
+	Metric         string     `json:"metric" validate:"required"`
+	Quantity       float64    `json:"quantity" validate:"gt=0"`
+	OccurredAt     *time.Time `json:"occurred_at,omitempty"`
+	IdempotencyKey string     `json:"idempotency_key" validate:"required,max=200"`
+}
+
+type RecordUsageRequest struct {
+	Source string            `json:"source"`
+	Events []UsageEventInput `json:"events" validate:"required,max=1000,dive"`
+}
+
+// UsageRecorded reports how many events of a batch were new
+type UsageRecorded struct {
+	Recorded   int `json:"recorded"`
+	Duplicates int `json:"duplicates"`
+}
+
+// MeteredPrice is a usage-based price component of a plan. Usage beyond the
+// included quantity in a billing period is billed at the unit price.
+type MeteredPrice struct {
+	PlanID           uuid.UUID `json:"plan_id" db:"plan_id"`
+	Metric           string    `json:"metric" db:"metric"`
+	Description      string    `json:"description" db:"description"`
+	UnitPrice        float64   `json:"unit_price" db:"unit_price"`
+	IncludedQuantity float64   `json:"included_quantity" db:"included_quantity"`
+}
+
+// MeteredPricesRequest replaces the metered prices of a plan
+type MeteredPricesRequest struct {
+	Prices []MeteredPrice `json:"prices"`
+}
+
+// MeteredUsage is a tenant's usage of one metric in a period and what it
+// costs at the plan's metered price. Metrics the plan does not price cost
+// nothing.
+type MeteredUsage struct {
+	Metric           string  `json:"metric"`
+	Description      string  `json:"description,omitempty"`
+	Quantity         float64 `json:"quantity"`
+	IncludedQuantity float64 `json:"included_quantity"`
+	BillableQuantity float64 `json:"billable_quantity"`
+	UnitPrice        float64 `json:"unit_price"`
+	Amount           float64 `json:"amount"`
+}
+
+// PeriodUsage is a tenant's metered usage in the current billing period so
+// far, billed when the period ends. Usage during a trial is not billed.
+type PeriodUsage struct {
+	TenantID    uuid.UUID      `json:"tenant_id"`
+	PlanID      uuid.UUID      `json:"plan_id"`
+	Currency    string         `json:"currency"`
+	PeriodStart time.Time      `json:"period_start"`
+	PeriodEnd   time.Time      `json:"period_end"`
+	Billed      bool           `json:"billed"`
+	Metrics     []MeteredUsage `json:"metrics"`
+	Amount      float64        `json:"amount"`
+	MeasuredAt  time.Time      `json:"measured_at"`
+}
+
+// StorageMeterRun summarises one daily storage sample
+type StorageMeterRun struct {
+	Tenants  int       `json:"tenants"`
+	Recorded int       `json:"recorded"`
+	RanAt    time.Time `json:"ran_at"`
+}
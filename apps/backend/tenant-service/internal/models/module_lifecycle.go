@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Module lifecycle events, the hooks of modulehooks
+const (
+	ModuleEventInstall   = "install"
+	ModuleEventUpgrade   = "upgrade"
+	ModuleEventEnable    = "enable"
+	ModuleEventDisable   = "disable"
+	ModuleEventUninstall = "uninstall"
+	ModuleEventRollback  = "rollback"
+)
+
+// Module lifecycle job statuses
+const (
+	ModuleJobPending   = "pending"
+	ModuleJobRunning   = "running"
+	ModuleJobSucceeded = "succeeded"
+	ModuleJobFailed    = "failed"
+)
+
+// ModuleLifecycleJob delivers one lifecycle hook of a tenant's module to
+// the service implementing it
+type ModuleLifecycleJob struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	InstallationID uuid.UUID  `json:"installation_id" db:"installation_id"`
+	TenantID       uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	ModuleID       uuid.UUID  `json:"module_id" db:"module_id"`
+	BatchID        uuid.UUID  `json:"batch_id" db:"batch_id"`
+	Position       int        `json:"position" db:"position"`
+	Event          string     `json:"event" db:"event"` // install, upgrade, enable, disable, uninstall, rollback
+	Version        string     `json:"version" db:"version"`
+	FromVersion    *string    `json:"from_version,omitempty" db:"from_version"`
+	Status         string     `json:"status" db:"status"` // pending, running, succeeded, failed
+	Attempts       int        `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	ErrorMessage   *string    `json:"error_message,omitempty" db:"error_message"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+	// UpgradeID is the upgrade an upgrade or rollback job runs
+	UpgradeID *uuid.UUID `json:"upgrade_id,omitempty" db:"upgrade_id"`
+
+	// Loaded with the job to run it
+	ModuleName string `json:"-" db:"-"`
+	Config     string `json:"-" db:"-"`
+}
+
+// ModuleInstallationStatus is a tenant's installation of a module with the
+// lifecycle jobs run for it, latest first
+type ModuleInstallationStatus struct {
+	Installation *ModuleInstallation  `json:"installation"`
+	Jobs         []ModuleLifecycleJob `json:"jobs"`
+}
+
+// ModuleLifecycleRun summarises one run of the lifecycle worker
+type ModuleLifecycleRun struct {
+	Jobs      int `json:"jobs"`
+	Succeeded int `json:"succeeded"`
+	Retried   int `json:"retried"`
+	Failed    int `json:"failed"`
+	// RolledBack upgrades gave up and are rolled back
+	RolledBack int `json:"rolled_back"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "github.com/google/uuid"
+
+// Module plan actions
+const (
+	ModulePlanInstall   = "install"
+	ModulePlanEnable    = "enable"
+	ModulePlanUninstall = "uninstall"
+)
+
+// ModuleInstallPlan is everything installing a module takes. Steps are in
+// install order, every module after the modules it depends on. A plan with
+// conflicts cannot be installed.
+type ModuleInstallPlan struct {
+	ModuleID    uuid.UUID        `json:"module_id"`
+	Steps       []ModulePlanStep `json:"steps"`
+	Conflicts   []string         `json:"conflicts,omitempty"`
+	Installable bool             `json:"installable"`
+}
+
+// ModuleUninstallPlan is everything uninstalling a module takes. Steps are in
+// uninstall order, the modules depending on it first; it is refused unless
+// cascading when there is more than the module itself.
+type ModuleUninstallPlan struct {
+	ModuleID uuid.UUID        `json:"module_id"`
+	Steps    []ModulePlanStep `json:"steps"`
+}
+
+type ModulePlanStep struct {
+	ModuleID uuid.UUID `json:"module_id"`
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Action   string    `json:"action"`
+	// RequiredBy names the modules of the plan this step is for; empty for
+	// the module asked for
+	RequiredBy []string `json:"required_by,omitempty"`
+}
+
+// ModuleInstallResult is what installing a module and its dependencies did
+type ModuleInstallResult struct {
+	Plan          *ModuleInstallPlan    `json:"plan"`
+	Installations []*ModuleInstallation `json:"installations"`
+}
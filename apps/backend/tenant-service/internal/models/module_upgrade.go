@@ -0,0 +1,92 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Module upgrade statuses
+const (
+	ModuleUpgradeUpgrading   = "upgrading"
+	ModuleUpgradeCompleted   = "completed"
+	ModuleUpgradeRollingBack = "rolling_back"
+	ModuleUpgradeRolledBack  = "rolled_back"
+	ModuleUpgradeFailed      = "failed"
+)
+
+// Module rollout statuses
+const (
+	ModuleRolloutActive    = "active"
+	ModuleRolloutPaused    = "paused"
+	ModuleRolloutCompleted = "completed"
+	ModuleRolloutCancelled = "cancelled"
+)
+
+// ModuleUpgrade is an upgrade of a tenant's module, kept as its upgrade
+// history
+type ModuleUpgrade struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	InstallationID uuid.UUID  `json:"installation_id" db:"installation_id"`
+	TenantID       uuid.UUID  `json:"tenant_id" db:"tenant_id"`
+	ModuleID       uuid.UUID  `json:"module_id" db:"module_id"`
+	RolloutID      *uuid.UUID `json:"rollout_id,omitempty" db:"rollout_id"`
+	FromVersion    string     `json:"from_version" db:"from_version"`
+	ToVersion      string     `json:"to_version" db:"to_version"`
+	Status         string     `json:"status" db:"status"` // upgrading, completed, rolling_back, rolled_back, failed
+	ErrorMessage   *string    `json:"error_message,omitempty" db:"error_message"`
+	RequestedBy    *uuid.UUID `json:"requested_by,omitempty" db:"requested_by"`
+	StartedAt      time.Time  `json:"started_at" db:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty" db:"finished_at"`
+}
+
+// ModuleRollout upgrades the tenants having a module to its catalog version,
+// a cohort at a time
+type ModuleRollout struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	ModuleID    uuid.UUID  `json:"module_id" db:"module_id"`
+	ToVersion   string     `json:"to_version" db:"to_version"`
+	Status      string     `json:"status" db:"status"` // active, paused, completed, cancelled
+	MaxFailures int        `json:"max_failures" db:"max_failures"`
+	CreatedBy   *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// ModuleRolloutProgress is a rollout with how far its upgrades got
+type ModuleRolloutProgress struct {
+	Rollout *ModuleRollout `json:"rollout"`
+	// Remaining tenants still have an older version and no upgrade of the
+	// rollout
+	Remaining  int `json:"remaining"`
+	Upgrading  int `json:"upgrading"`
+	Completed  int `json:"completed"`
+	RolledBack int `json:"rolled_back"`
+	Failed     int `json:"failed"`
+}
+
+// ModuleRolloutCohort is the upgrades one advance of a rollout started, and
+// the tenants it skipped with why
+type ModuleRolloutCohort struct {
+	Upgrades []*ModuleUpgrade  `json:"upgrades"`
+	Skipped  map[string]string `json:"skipped,omitempty"`
+}
+
+type UpgradeModuleRequest struct {
+	Version string `json:"version,omitempty"` // the module's current version if empty
+}
+
+type CreateModuleRolloutRequest struct {
+	ModuleID    string `json:"module_id" validate:"required,uuid"`
+	MaxFailures int    `json:"max_failures,omitempty" validate:"gte=0"` // 1 if empty
+}
+
+type AdvanceModuleRolloutRequest struct {
+	// Size is how many tenants to upgrade, 10 if empty; TenantIDs picks them
+	Size      int      `json:"size,omitempty" validate:"gte=0,lte=500"`
+	TenantIDs []string `json:"tenant_ids,omitempty" validate:"omitempty,dive,uuid"`
+}
+
+type UpdateModuleRolloutRequest struct {
+	Status string `json:"status" validate:"required,oneof=active paused cancelled"`
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TenantStatusProvisioning marks a tenant whose provisioning has not finished
+const TenantStatusProvisioning = "provisioning"
+
+// DefaultPasswordPolicy is the password policy of a new tenant configuration
+const DefaultPasswordPolicy = `{"minLength": 8, "requireUppercase": true, "requireLowercase": true, "requireNumbers": true, "requireSpecialChars": false, "historyCount": 5, "maxAgeDays": 0, "checkBreached": true}`
+
+// DefaultTrialDays is the trial of a provisioned subscription unless the
+// request sets one
+const DefaultTrialDays = 14
+
+// Provisioning statuses
+const (
+	ProvisioningStatusRunning        = "running"
+	ProvisioningStatusCompleted      = "completed"
+	ProvisioningStatusRolledBack     = "rolled_back"
+	ProvisioningStatusRollbackFailed = "rollback_failed"
+)
+
+// Provisioning step names, in the order they run
+const (
+	ProvisioningStepTenant        = "tenant"
+	ProvisioningStepConfiguration = "configuration"
+	ProvisioningStepSubscription  = "subscription"
+	ProvisioningStepModules       = "modules"
+	ProvisioningStepAdminUser     = "admin_user"
+	ProvisioningStepSeedData      = "seed_data"
+)
+
+// ProvisioningSteps lists every provisioning step in the order it runs.
+// Completed steps are compensated in reverse order.
+var ProvisioningSteps = []string{
+	ProvisioningStepTenant,
+	ProvisioningStepConfiguration,
+	ProvisioningStepSubscription,
+	ProvisioningStepModules,
+	ProvisioningStepAdminUser,
+	ProvisioningStepSeedData,
+}
+
+// Provisioning step statuses
+const (
+	StepStatusPending            = "pending"
+	StepStatusCompleted          = "completed"
+	StepStatusSkipped            = "skipped"
+	StepStatusFailed             = "failed"
+	StepStatusCompensated        = "compensated"
+	StepStatusCompensationFailed = "compensation_failed"
+)
+
+// ProvisioningStep is the state of one step of a provisioning saga
+type ProvisioningStep struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Detail      string     `json:"detail,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// TenantProvisioning tracks the provisioning of one tenant, step by step
+type TenantProvisioning struct {
+	ID             uuid.UUID               `json:"id" db:"id"`
+	TenantID       *uuid.UUID              `json:"tenant_id,omitempty" db:"tenant_id"`
+	Subdomain      string                  `json:"subdomain" db:"subdomain"`
+	Status         string                  `json:"status" db:"status"`
+	Steps          []*ProvisioningStep     `json:"steps" db:"steps"`
+	Request        *ProvisionTenantRequest `json:"request" db:"request"`
+	SubscriptionID *uuid.UUID              `json:"subscription_id,omitempty" db:"subscription_id"`
+	AdminUserID    *uuid.UUID              `json:"admin_user_id,omitempty" db:"admin_user_id"`
+	Error          *string                 `json:"error,omitempty" db:"error"`
+	CreatedAt      time.Time               `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time               `json:"updated_at" db:"updated_at"`
+	CompletedAt    *time.Time              `json:"completed_at,omitempty" db:"completed_at"`
+}
+
+// Step returns the state of the named step
+func (p *TenantProvisioning) Step(name string) *ProvisioningStep {
+	for _, step := range p.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+// ProvisionTenantRequest provisions a tenant. Without a subdomain one is
+// generated, without a plan the cheapest active plan is used and without
+// modules every active module is enabled. Admin is optional so an existing
+// user can be made the tenant's admin by the caller instead.
+type ProvisionTenantRequest struct {
+	Name      string          `json:"name" validate:"required,min=2,max=255"`
+	Subdomain string          `json:"subdomain,omitempty"`
+	Domain    *string         `json:"domain,omitempty"`
+	PlanID    *string         `json:"plan_id,omitempty"`
+	TrialDays *int            `json:"trial_days,omitempty"`
+	Modules   []string        `json:"modules,omitempty"`
+	Admin     *ProvisionAdmin `json:"admin,omitempty"`
+}
+
+// ProvisionAdmin is the first admin user of a provisioned tenant. The
+// password is sent to auth-service and never stored with the saga.
+type ProvisionAdmin struct {
+	Email     string `json:"email" validate:"required,email"`
+	FirstName string `json:"first_name" validate:"required"`
+	LastName  string `json:"last_name" validate:"required"`
+	Password  string `json:"password,omitempty" validate:"required"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Quota resources
+const (
+	QuotaResourceUsers   = "users"   // seats: active members and pending invitations
+	QuotaResourceStorage = "storage" // bytes stored in the file service
+)
+
+// QuotaUsage is the usage of a resource against the plan's limit. A nil
+// limit is unlimited.
+type QuotaUsage struct {
+	Used  int64  `json:"used"`
+	Limit *int64 `json:"limit"`
+}
+
+// Exceeds reports whether adding amount would go over the limit
+func (u QuotaUsage) Exceeds(amount int64) bool {
+	return u.Limit != nil && u.Used+amount > *u.Limit
+}
+
+// TenantUsage is a tenant's live usage of the quotas of its plan. A tenant
+// without an active subscription has no limits.
+type TenantUsage struct {
+	TenantID           uuid.UUID  `json:"tenant_id"`
+	PlanID             *uuid.UUID `json:"plan_id,omitempty"`
+	PlanName           string     `json:"plan_name,omitempty"`
+	Users              QuotaUsage `json:"users"`
+	ActiveUsers        int64      `json:"active_users"`
+	PendingInvitations int64      `json:"pending_invitations"`
+	Storage            QuotaUsage `json:"storage"`
+	MeasuredAt         time.Time  `json:"measured_at"`
+}
+
+// QuotaCheckRequest asks whether a tenant may add amount of a resource.
+// Accepting an invitation adds 0 users because the invitation already holds
+// a seat.
+type QuotaCheckRequest struct {
+	Resource string `json:"resource" validate:"required,oneof=users storage"`
+	Amount   int64  `json:"amount" validate:"min=0"`
+}
+
+// QuotaCheck is the answer to a QuotaCheckRequest
+type QuotaCheck struct {
+	Resource  string `json:"resource"`
+	Used      int64  `json:"used"`
+	Requested int64  `json:"requested"`
+	Limit     *int64 `json:"limit"`
+	Allowed   bool   `json:"allowed"`
+}
@@ -40,10 +40,11 @@ type Subscription struct {
 	ID                 uuid.UUID  `json:"id" db:"id"`
 	TenantID           uuid.UUID  `json:"tenant_id" db:"tenant_id"`
 	PlanID             uuid.UUID  `json:"plan_id" db:"plan_id"`
-	Status             string     `json:"status" db:"status"` // active, cancelled, expired
+	Status             string     `json:"status" db:"status"` // active, past_due, cancelled, expired
 	TrialEndAt         *time.Time `json:"trial_end_at" db:"trial_end_at"`
 	CurrentPeriodStart time.Time  `json:"current_period_start" db:"current_period_start"`
 	CurrentPeriodEnd   time.Time  `json:"current_period_end" db:"current_period_end"`
+	BillingAnchor      time.Time  `json:"billing_anchor" db:"billing_anchor"` // start of the first paid period; later periods are counted from it
 	CancelAtPeriodEnd  bool       `json:"cancel_at_period_end" db:"cancel_at_period_end"`
 	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
@@ -94,7 +95,7 @@ type TenantConfiguration struct {
 	IntegrationConfig  string    `json:"integration_config" db:"integration_config"`   // JSON
 	FeatureFlags       string    `json:"feature_flags" db:"feature_flags"`             // JSON
 	DataRetentionDays  int       `json:"data_retention_days" db:"data_retention_days"`
-	AllowedIPs         *string   `json:"allowed_ips" db:"allowed_ips"` // JSON array
+	AllowedIPs         *string   `json:"allowed_ips" db:"allowed_ips"` // JSON array, or {"default": [...], "admin": [...]}
 	TwoFactorRequired  bool      `json:"two_factor_required" db:"two_factor_required"`
 	PasswordPolicy     string    `json:"password_policy" db:"password_policy"` // JSON
 	SessionTimeoutMins int       `json:"session_timeout_mins" db:"session_timeout_mins"`
@@ -209,17 +210,42 @@ type CreateSubscriptionRequest struct {
 
 type UpdateSubscriptionRequest struct {
 	PlanID             *string    `json:"plan_id,omitempty" validate:"omitempty,uuid"`
-	Status             *string    `json:"status,omitempty" validate:"omitempty,oneof=active cancelled expired"`
+	Status             *string    `json:"status,omitempty" validate:"omitempty,oneof=active past_due cancelled expired"`
 	TrialEndAt         *time.Time `json:"trial_end_at,omitempty"`
 	CurrentPeriodStart *time.Time `json:"current_period_start,omitempty"`
 	CurrentPeriodEnd   *time.Time `json:"current_period_end,omitempty"`
 	CancelAtPeriodEnd  *bool      `json:"cancel_at_period_end,omitempty"`
 }
 
+// TenantStats summarises tenants and subscription revenue over the last
+// Days days, for the platform admin dashboard. The Previous fields cover the
+// Days days before that, so callers can compute growth.
+type TenantStats struct {
+	Days                int                    `json:"days"`
+	TotalTenants        int                    `json:"total_tenants"`
+	TenantsByStatus     map[string]int         `json:"tenants_by_status"`
+	NewTenants          int                    `json:"new_tenants"`
+	PreviousNewTenants  int                    `json:"previous_new_tenants"`
+	ActiveSubscriptions int                    `json:"active_subscriptions"`
+	TrialSubscriptions  int                    `json:"trial_subscriptions"`
+	Revenue             []*SubscriptionRevenue `json:"revenue"`
+	GeneratedAt         time.Time              `json:"generated_at"`
+}
+
+// SubscriptionRevenue is the recurring revenue of paying subscriptions in one
+// currency. Yearly plans count for a twelfth of their price per month.
+type SubscriptionRevenue struct {
+	Currency      string  `json:"currency"`
+	Subscriptions int     `json:"subscriptions"`
+	MRR           float64 `json:"mrr"`
+	ARR           float64 `json:"arr"`
+	PreviousMRR   float64 `json:"previous_mrr"`
+}
+
 // Request/Response DTOs for Module System
 type InstallModuleRequest struct {
 	ModuleID string `json:"module_id" validate:"required,uuid"`
-	Version  string `json:"version" validate:"required"`
+	Version  string `json:"version,omitempty"` // the module's current version if empty
 	Config   string `json:"config,omitempty"`
 }
 
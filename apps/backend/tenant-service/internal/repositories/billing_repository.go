@@ -0,0 +1,449 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrSubscriptionChanged is returned when a subscription was renewed,
+// re-planned or moved to another status since it was read, e.g. by another
+// instance of the billing engine. The caller should skip it.
+var ErrSubscriptionChanged = errors.New("subscription changed concurrently")
+
+// BillingRepository stores invoices and the subscription changes the billing
+// engine makes. Every write that issues an invoice locks the subscription
+// first, so the credit balance an invoice consumes is never spent twice.
+type BillingRepository interface {
+	// ListBillable returns, ordered by ID after the given one, the active and
+	// past due subscriptions the engine has work for at the given time: a
+	// period or trial has ended, an invoice is overdue, the subscription is
+	// past due or its current period has not been invoiced
+	ListBillable(ctx context.Context, at time.Time, after uuid.UUID, limit int) ([]*models.Subscription, error)
+	HasPeriodInvoice(ctx context.Context, subscriptionID uuid.UUID, periodStart time.Time) (bool, error)
+	// IssueInvoice issues an invoice for the subscription's current period
+	IssueInvoice(ctx context.Context, invoice *models.Invoice) error
+	// Renew moves an active subscription from the period starting at
+	// previousStart to its new period and issues the invoice, if any
+	Renew(ctx context.Context, subscription *models.Subscription, previousStart time.Time, invoice *models.Invoice) error
+	// ChangePlan moves an active subscription off previousPlanID, possibly
+	// into a new period, and issues the proration invoice, if any
+	ChangePlan(ctx context.Context, subscription *models.Subscription, previousPlanID uuid.UUID, previousStart time.Time, invoice *models.Invoice) error
+	// Cancel cancels an active subscription still in its current period and
+	// issues the invoice of its last usage, if any
+	Cancel(ctx context.Context, subscription *models.Subscription, invoice *models.Invoice) error
+	UpdateStatus(ctx context.Context, subscriptionID uuid.UUID, from, to string) error
+	// OldestOverdueInvoice returns the subscription's oldest open invoice due
+	// by the given time, or nil
+	OldestOverdueInvoice(ctx context.Context, subscriptionID uuid.UUID, at time.Time) (*models.Invoice, error)
+	ListInvoices(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Invoice, int, error)
+	GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error)
+	// PayInvoice marks an open invoice paid and records the payment
+	PayInvoice(ctx context.Context, invoice *models.Invoice, paidAt time.Time, req *models.PayInvoiceRequest) error
+}
+
+type billingRepository struct {
+	db *sql.DB
+}
+
+func NewBillingRepository(db *sql.DB) BillingRepository {
+	return &billingRepository{db: db}
+}
+
+const invoiceColumns = `id, tenant_id, subscription_id, number, reason, status, currency, lines, subtotal, credit_applied, total, period_start, period_end, issued_at, due_at, paid_at, created_at, updated_at`
+
+func (r *billingRepository) ListBillable(ctx context.Context, at time.Time, after uuid.UUID, limit int) ([]*models.Subscription, error) {
+	query := `
+		SELECT s.id, s.tenant_id, s.plan_id, s.status, s.trial_end_at,
+			   s.current_period_start, s.current_period_end, s.billing_anchor, s.cancel_at_period_end,
+			   s.created_at, s.updated_at,
+			   p.id, p.name, p.description, p.price, p.currency, p.billing_cycle,
+			   p.max_users, p.max_storage, p.features, p.is_active, p.created_at, p.updated_at
+		FROM subscriptions s
+		JOIN plans p ON s.plan_id = p.id
+		WHERE s.status IN ('active', 'past_due') AND s.id > $2
+		  AND (s.current_period_end <= $1
+			   OR s.status = 'past_due'
+			   OR (s.trial_end_at > s.current_period_start AND s.trial_end_at <= $1)
+			   OR EXISTS (
+				   SELECT 1 FROM invoices i
+				   WHERE i.subscription_id = s.id AND i.status = 'open' AND i.due_at <= $1
+			   )
+			   OR ((s.trial_end_at IS NULL OR s.trial_end_at <= s.current_period_start)
+				   AND NOT EXISTS (
+					   SELECT 1 FROM invoices i
+					   WHERE i.subscription_id = s.id AND i.period_start = s.current_period_start
+				   )))
+		ORDER BY s.id
+		LIMIT $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, at, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.Subscription
+	for rows.Next() {
+		subscription := &models.Subscription{Plan: &models.Plan{}}
+		err := rows.Scan(
+			&subscription.ID,
+			&subscription.TenantID,
+			&subscription.PlanID,
+			&subscription.Status,
+			&subscription.TrialEndAt,
+			&subscription.CurrentPeriodStart,
+			&subscription.CurrentPeriodEnd,
+			&subscription.BillingAnchor,
+			&subscription.CancelAtPeriodEnd,
+			&subscription.CreatedAt,
+			&subscription.UpdatedAt,
+			&subscription.Plan.ID,
+			&subscription.Plan.Name,
+			&subscription.Plan.Description,
+			&subscription.Plan.Price,
+			&subscription.Plan.Currency,
+			&subscription.Plan.BillingCycle,
+			&subscription.Plan.MaxUsers,
+			&subscription.Plan.MaxStorage,
+			&subscription.Plan.Features,
+			&subscription.Plan.IsActive,
+			&subscription.Plan.CreatedAt,
+			&subscription.Plan.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func (r *billingRepository) HasPeriodInvoice(ctx context.Context, subscriptionID uuid.UUID, periodStart time.Time) (bool, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM invoices WHERE subscription_id = $1 AND period_start = $2)`,
+		subscriptionID, periodStart,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (r *billingRepository) IssueInvoice(ctx context.Context, invoice *models.Invoice) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		var locked int
+		err := tx.QueryRowContext(ctx, `
+			SELECT 1 FROM subscriptions
+			WHERE id = $1 AND status = 'active' AND current_period_start = $2
+			FOR UPDATE
+		`, invoice.SubscriptionID, invoice.PeriodStart).Scan(&locked)
+		if err == sql.ErrNoRows {
+			return ErrSubscriptionChanged
+		}
+		if err != nil {
+			return err
+		}
+
+		// A plan change may have invoiced the period since it was checked
+		var invoiced bool
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM invoices WHERE subscription_id = $1 AND period_start = $2)`,
+			invoice.SubscriptionID, invoice.PeriodStart,
+		).Scan(&invoiced)
+		if err != nil {
+			return err
+		}
+		if invoiced {
+			return ErrSubscriptionChanged
+		}
+
+		return insertInvoice(ctx, tx, invoice)
+	})
+}
+
+func (r *billingRepository) Renew(ctx context.Context, subscription *models.Subscription, previousStart time.Time, invoice *models.Invoice) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE subscriptions
+			SET current_period_start = $2, current_period_end = $3, updated_at = NOW()
+			WHERE id = $1 AND status = 'active' AND current_period_start = $4
+		`, subscription.ID, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, previousStart)
+		if err := expectOneRow(result, err); err != nil {
+			return err
+		}
+
+		if invoice == nil {
+			return nil
+		}
+		return insertInvoice(ctx, tx, invoice)
+	})
+}
+
+func (r *billingRepository) ChangePlan(ctx context.Context, subscription *models.Subscription, previousPlanID uuid.UUID, previousStart time.Time, invoice *models.Invoice) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE subscriptions
+			SET plan_id = $2, current_period_start = $3, current_period_end = $4, billing_anchor = $7, updated_at = NOW(),
+				entitlement_version = CASE WHEN plan_id = $2 THEN entitlement_version END
+			WHERE id = $1 AND status = 'active' AND plan_id = $5 AND current_period_start = $6
+		`, subscription.ID, subscription.PlanID, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, previousPlanID, previousStart, subscription.BillingAnchor)
+		if err := expectOneRow(result, err); err != nil {
+			return err
+		}
+
+		if invoice == nil {
+			return nil
+		}
+		return insertInvoice(ctx, tx, invoice)
+	})
+}
+
+func (r *billingRepository) Cancel(ctx context.Context, subscription *models.Subscription, invoice *models.Invoice) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE subscriptions
+			SET status = 'cancelled', updated_at = NOW()
+			WHERE id = $1 AND status = 'active' AND current_period_start = $2
+		`, subscription.ID, subscription.CurrentPeriodStart)
+		if err := expectOneRow(result, err); err != nil {
+			return err
+		}
+
+		if invoice == nil {
+			return nil
+		}
+		return insertInvoice(ctx, tx, invoice)
+	})
+}
+
+func (r *billingRepository) UpdateStatus(ctx context.Context, subscriptionID uuid.UUID, from, to string) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE subscriptions SET status = $3, updated_at = NOW() WHERE id = $1 AND status = $2`,
+		subscriptionID, from, to,
+	)
+	return expectOneRow(result, err)
+}
+
+func (r *billingRepository) OldestOverdueInvoice(ctx context.Context, subscriptionID uuid.UUID, at time.Time) (*models.Invoice, error) {
+	query := `
+		SELECT ` + invoiceColumns + ` FROM invoices
+		WHERE subscription_id = $1 AND status = 'open' AND due_at <= $2
+		ORDER BY due_at
+		LIMIT 1
+	`
+
+	invoice, err := scanInvoice(r.db.QueryRowContext(ctx, query, subscriptionID, at))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return invoice, err
+}
+
+func (r *billingRepository) ListInvoices(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Invoice, int, error) {
+	var total int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM invoices WHERE tenant_id = $1`, tenantID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT ` + invoiceColumns + ` FROM invoices
+		WHERE tenant_id = $1
+		ORDER BY issued_at DESC, number DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	invoices := []*models.Invoice{}
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, total, rows.Err()
+}
+
+func (r *billingRepository) GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	invoice, err := scanInvoice(r.db.QueryRowContext(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("invoice not found")
+		}
+		return nil, err
+	}
+	return invoice, nil
+}
+
+func (r *billingRepository) PayInvoice(ctx context.Context, invoice *models.Invoice, paidAt time.Time, req *models.PayInvoiceRequest) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`UPDATE invoices SET status = 'paid', paid_at = $2, updated_at = NOW() WHERE id = $1 AND status = 'open'`,
+			invoice.ID, paidAt,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("invoice is not open")
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO payments (id, subscription_id, invoice_id, amount, currency, status, payment_method, external_payment_id, paid_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, 'completed', $6, $7, $8, NOW())
+		`, uuid.New(), invoice.SubscriptionID, invoice.ID, invoice.Total, invoice.Currency, req.PaymentMethod, req.ExternalPaymentID, paidAt)
+		if err != nil {
+			return err
+		}
+
+		invoice.Status = models.InvoiceStatusPaid
+		invoice.PaidAt = &paidAt
+		return nil
+	})
+}
+
+func (r *billingRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertInvoice spends the subscription's credit balance on the invoice and
+// inserts it. The caller holds the subscription's row lock.
+func insertInvoice(ctx context.Context, tx *sql.Tx, invoice *models.Invoice) error {
+	var balance float64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(GREATEST(-subtotal, 0)) - SUM(credit_applied), 0)
+		FROM invoices
+		WHERE subscription_id = $1 AND status <> 'void'
+	`, invoice.SubscriptionID).Scan(&balance)
+	if err != nil {
+		return err
+	}
+	invoice.ApplyCredit(balance)
+
+	lines, err := json.Marshal(invoice.Lines)
+	if err != nil {
+		return fmt.Errorf("failed to encode invoice lines: %w", err)
+	}
+
+	now := time.Now()
+	invoice.ID = uuid.New()
+	invoice.CreatedAt = now
+	invoice.UpdatedAt = now
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO invoices (id, tenant_id, subscription_id, number, reason, status, currency, lines, subtotal,
+			credit_applied, total, period_start, period_end, issued_at, due_at, paid_at, created_at, updated_at)
+		VALUES ($1, $2, $3, 'INV-' || LPAD(nextval('invoice_number_seq')::text, 6, '0'), $4, $5, $6, $7, $8,
+			$9, $10, $11, $12, $13, $14, $15, $16, $17)
+		RETURNING number
+	`,
+		invoice.ID,
+		invoice.TenantID,
+		invoice.SubscriptionID,
+		invoice.Reason,
+		invoice.Status,
+		invoice.Currency,
+		lines,
+		invoice.Subtotal,
+		invoice.CreditApplied,
+		invoice.Total,
+		invoice.PeriodStart,
+		invoice.PeriodEnd,
+		invoice.IssuedAt,
+		invoice.DueAt,
+		invoice.PaidAt,
+		invoice.CreatedAt,
+		invoice.UpdatedAt,
+	).Scan(&invoice.Number)
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		// Another run already invoiced this period
+		return ErrSubscriptionChanged
+	}
+	return err
+}
+
+// expectOneRow turns a conditional update that matched nothing into
+// ErrSubscriptionChanged
+func expectOneRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrSubscriptionChanged
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInvoice(row rowScanner) (*models.Invoice, error) {
+	invoice := &models.Invoice{}
+	var lines []byte
+
+	err := row.Scan(
+		&invoice.ID,
+		&invoice.TenantID,
+		&invoice.SubscriptionID,
+		&invoice.Number,
+		&invoice.Reason,
+		&invoice.Status,
+		&invoice.Currency,
+		&lines,
+		&invoice.Subtotal,
+		&invoice.CreditApplied,
+		&invoice.Total,
+		&invoice.PeriodStart,
+		&invoice.PeriodEnd,
+		&invoice.IssuedAt,
+		&invoice.DueAt,
+		&invoice.PaidAt,
+		&invoice.CreatedAt,
+		&invoice.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(lines, &invoice.Lines); err != nil {
+		return nil, fmt.Errorf("invalid invoice lines: %w", err)
+	}
+
+	return invoice, nil
+}
@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrDunningCaseChanged is returned when a dunning case moved to another
+// status since it was read, e.g. its invoice was paid while the worker
+// retried it
+var ErrDunningCaseChanged = errors.New("dunning case changed concurrently")
+
+// DunningRepository stores the dunning cases collecting unpaid invoices. At
+// most one open or suspended case collects an invoice.
+type DunningRepository interface {
+	// Create inserts the case unless another one already collects its
+	// invoice, and reports whether it did
+	Create(ctx context.Context, dunningCase *models.DunningCase) (bool, error)
+	// GetActiveByInvoice returns the open or suspended case collecting the
+	// invoice, or nil
+	GetActiveByInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.DunningCase, error)
+	ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*models.DunningCase, error)
+	// ClaimDue returns a case with a retry due or a grace period over at the
+	// given time and holds it until leaseUntil so other instances skip it
+	ClaimDue(ctx context.Context, at, leaseUntil time.Time) (*models.DunningCase, error)
+	// Update saves a case still in status from and releases it
+	Update(ctx context.Context, dunningCase *models.DunningCase, from string) error
+	// CountSuspended counts the tenant's cases that keep it suspended
+	CountSuspended(ctx context.Context, tenantID uuid.UUID) (int, error)
+}
+
+type dunningRepository struct {
+	db *sql.DB
+}
+
+func NewDunningRepository(db *sql.DB) DunningRepository {
+	return &dunningRepository{db: db}
+}
+
+const dunningColumns = `id, tenant_id, subscription_id, invoice_id, status, attempts, next_attempt_at, last_attempt_at, last_error, reminders_sent, started_at, grace_ends_at, suspended_at, resolved_at, created_at, updated_at`
+
+func (r *dunningRepository) Create(ctx context.Context, dunningCase *models.DunningCase) (bool, error) {
+	query := `
+		INSERT INTO dunning_cases (` + dunningColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (invoice_id) WHERE status IN ('open', 'suspended') DO NOTHING
+	`
+
+	now := time.Now()
+	dunningCase.ID = uuid.New()
+	dunningCase.CreatedAt = now
+	dunningCase.UpdatedAt = now
+
+	result, err := r.db.ExecContext(ctx, query,
+		dunningCase.ID,
+		dunningCase.TenantID,
+		dunningCase.SubscriptionID,
+		dunningCase.InvoiceID,
+		dunningCase.Status,
+		dunningCase.Attempts,
+		dunningCase.NextAttemptAt,
+		dunningCase.LastAttemptAt,
+		dunningCase.LastError,
+		dunningCase.RemindersSent,
+		dunningCase.StartedAt,
+		dunningCase.GraceEndsAt,
+		dunningCase.SuspendedAt,
+		dunningCase.ResolvedAt,
+		dunningCase.CreatedAt,
+		dunningCase.UpdatedAt,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *dunningRepository) GetActiveByInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.DunningCase, error) {
+	query := `SELECT ` + dunningColumns + ` FROM dunning_cases WHERE invoice_id = $1 AND status IN ('open', 'suspended')`
+
+	dunningCase, err := scanDunningCase(r.db.QueryRowContext(ctx, query, invoiceID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return dunningCase, err
+}
+
+func (r *dunningRepository) ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*models.DunningCase, error) {
+	query := `SELECT ` + dunningColumns + ` FROM dunning_cases WHERE tenant_id = $1 ORDER BY started_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := []*models.DunningCase{}
+	for rows.Next() {
+		dunningCase, err := scanDunningCase(rows)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, dunningCase)
+	}
+
+	return cases, rows.Err()
+}
+
+func (r *dunningRepository) ClaimDue(ctx context.Context, at, leaseUntil time.Time) (*models.DunningCase, error) {
+	query := `
+		UPDATE dunning_cases
+		SET locked_until = $2
+		WHERE id = (
+			SELECT id FROM dunning_cases
+			WHERE (next_attempt_at <= $1 AND status IN ('open', 'suspended')
+				OR grace_ends_at <= $1 AND status = 'open')
+			  AND (locked_until IS NULL OR locked_until <= $1)
+			ORDER BY started_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + dunningColumns
+
+	dunningCase, err := scanDunningCase(r.db.QueryRowContext(ctx, query, at, leaseUntil))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return dunningCase, err
+}
+
+func (r *dunningRepository) Update(ctx context.Context, dunningCase *models.DunningCase, from string) error {
+	query := `
+		UPDATE dunning_cases
+		SET status = $3, attempts = $4, next_attempt_at = $5, last_attempt_at = $6, last_error = $7,
+			reminders_sent = $8, suspended_at = $9, resolved_at = $10, locked_until = NULL, updated_at = $11
+		WHERE id = $1 AND status = $2
+	`
+
+	dunningCase.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		dunningCase.ID,
+		from,
+		dunningCase.Status,
+		dunningCase.Attempts,
+		dunningCase.NextAttemptAt,
+		dunningCase.LastAttemptAt,
+		dunningCase.LastError,
+		dunningCase.RemindersSent,
+		dunningCase.SuspendedAt,
+		dunningCase.ResolvedAt,
+		dunningCase.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDunningCaseChanged
+	}
+	return nil
+}
+
+func (r *dunningRepository) CountSuspended(ctx context.Context, tenantID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM dunning_cases WHERE tenant_id = $1 AND status = 'suspended'`,
+		tenantID,
+	).Scan(&count)
+	return count, err
+}
+
+func scanDunningCase(row rowScanner) (*models.DunningCase, error) {
+	dunningCase := &models.DunningCase{}
+	err := row.Scan(
+		&dunningCase.ID,
+		&dunningCase.TenantID,
+		&dunningCase.SubscriptionID,
+		&dunningCase.InvoiceID,
+		&dunningCase.Status,
+		&dunningCase.Attempts,
+		&dunningCase.NextAttemptAt,
+		&dunningCase.LastAttemptAt,
+		&dunningCase.LastError,
+		&dunningCase.RemindersSent,
+		&dunningCase.StartedAt,
+		&dunningCase.GraceEndsAt,
+		&dunningCase.SuspendedAt,
+		&dunningCase.ResolvedAt,
+		&dunningCase.CreatedAt,
+		&dunningCase.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return dunningCase, nil
+}
@@ -0,0 +1,296 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// EntitlementRepository stores the versions of plan entitlements, the
+// version each subscription is pinned to and the tenants' overrides
+type EntitlementRepository interface {
+	// PublishVersion stores the entitlements as the plan's next version.
+	// Subscribers following the previous latest version are pinned to it, so
+	// they are grandfathered.
+	PublishVersion(ctx context.Context, entitlements *models.PlanEntitlements) error
+	// ListVersions returns the plan's versions, newest first
+	ListVersions(ctx context.Context, planID uuid.UUID) ([]*models.PlanEntitlements, error)
+	GetVersion(ctx context.Context, planID uuid.UUID, version int) (*models.PlanEntitlements, error)
+	// GetLatestVersion returns nil if the plan has no published version
+	GetLatestVersion(ctx context.Context, planID uuid.UUID) (*models.PlanEntitlements, error)
+	// GetPinnedVersion returns the version the subscription is pinned to,
+	// or nil if it follows the latest version of its plan
+	GetPinnedVersion(ctx context.Context, subscriptionID uuid.UUID) (*int, error)
+	// UnpinSubscribers moves the plan's pinned subscribers to its latest
+	// version and returns how many it moved
+	UnpinSubscribers(ctx context.Context, planID uuid.UUID) (int, error)
+	// GetOverride returns nil if the tenant has no override
+	GetOverride(ctx context.Context, tenantID uuid.UUID) (*models.EntitlementOverride, error)
+	SaveOverride(ctx context.Context, override *models.EntitlementOverride) error
+	DeleteOverride(ctx context.Context, tenantID uuid.UUID) error
+}
+
+type entitlementRepository struct {
+	db *sql.DB
+}
+
+func NewEntitlementRepository(db *sql.DB) EntitlementRepository {
+	return &entitlementRepository{db: db}
+}
+
+const entitlementColumns = `id, plan_id, version, features, limits, modules, created_at`
+
+func (r *entitlementRepository) PublishVersion(ctx context.Context, entitlements *models.PlanEntitlements) error {
+	features, err := json.Marshal(entitlements.Features)
+	if err != nil {
+		return err
+	}
+	limits, err := json.Marshal(entitlements.Limits)
+	if err != nil {
+		return err
+	}
+	modules, err := json.Marshal(entitlements.Modules)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Publishing serializes on the plan so two versions never get the same
+	// number and no subscriber misses its pin
+	var planID uuid.UUID
+	err = tx.QueryRowContext(ctx, `SELECT id FROM plans WHERE id = $1 FOR UPDATE`, entitlements.PlanID).Scan(&planID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("plan not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) FROM plan_entitlement_versions WHERE plan_id = $1`,
+		entitlements.PlanID,
+	).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	if latest > 0 {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE subscriptions SET entitlement_version = $2 WHERE plan_id = $1 AND entitlement_version IS NULL`,
+			entitlements.PlanID, latest,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	entitlements.ID = uuid.New()
+	entitlements.Version = latest + 1
+	entitlements.CreatedAt = time.Now()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO plan_entitlement_versions (`+entitlementColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		entitlements.ID, entitlements.PlanID, entitlements.Version, features, limits, modules, entitlements.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *entitlementRepository) ListVersions(ctx context.Context, planID uuid.UUID) ([]*models.PlanEntitlements, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+entitlementColumns+` FROM plan_entitlement_versions WHERE plan_id = $1 ORDER BY version DESC`,
+		planID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*models.PlanEntitlements{}
+	for rows.Next() {
+		entitlements, err := scanPlanEntitlements(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, entitlements)
+	}
+
+	return versions, rows.Err()
+}
+
+func (r *entitlementRepository) GetVersion(ctx context.Context, planID uuid.UUID, version int) (*models.PlanEntitlements, error) {
+	entitlements, err := scanPlanEntitlements(r.db.QueryRowContext(ctx,
+		`SELECT `+entitlementColumns+` FROM plan_entitlement_versions WHERE plan_id = $1 AND version = $2`,
+		planID, version,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("entitlement version not found")
+	}
+	return entitlements, err
+}
+
+func (r *entitlementRepository) GetLatestVersion(ctx context.Context, planID uuid.UUID) (*models.PlanEntitlements, error) {
+	entitlements, err := scanPlanEntitlements(r.db.QueryRowContext(ctx,
+		`SELECT `+entitlementColumns+` FROM plan_entitlement_versions WHERE plan_id = $1 ORDER BY version DESC LIMIT 1`,
+		planID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return entitlements, err
+}
+
+func (r *entitlementRepository) GetPinnedVersion(ctx context.Context, subscriptionID uuid.UUID) (*int, error) {
+	var version sql.NullInt64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT entitlement_version FROM subscriptions WHERE id = $1`,
+		subscriptionID,
+	).Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	if err != nil || !version.Valid {
+		return nil, err
+	}
+
+	pinned := int(version.Int64)
+	return &pinned, nil
+}
+
+func (r *entitlementRepository) UnpinSubscribers(ctx context.Context, planID uuid.UUID) (int, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE subscriptions SET entitlement_version = NULL WHERE plan_id = $1 AND entitlement_version IS NOT NULL`,
+		planID,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	return int(rowsAffected), err
+}
+
+func (r *entitlementRepository) GetOverride(ctx context.Context, tenantID uuid.UUID) (*models.EntitlementOverride, error) {
+	override := &models.EntitlementOverride{}
+	var features, limits, modules []byte
+	err := r.db.QueryRowContext(ctx, `
+		SELECT tenant_id, features, limits, modules, reason, expires_at, created_at, updated_at
+		FROM tenant_entitlement_overrides
+		WHERE tenant_id = $1`,
+		tenantID,
+	).Scan(
+		&override.TenantID,
+		&features,
+		&limits,
+		&modules,
+		&override.Reason,
+		&override.ExpiresAt,
+		&override.CreatedAt,
+		&override.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(features, &override.Features); err != nil {
+		return nil, fmt.Errorf("invalid override features: %w", err)
+	}
+	if err := json.Unmarshal(limits, &override.Limits); err != nil {
+		return nil, fmt.Errorf("invalid override limits: %w", err)
+	}
+	if err := json.Unmarshal(modules, &override.Modules); err != nil {
+		return nil, fmt.Errorf("invalid override modules: %w", err)
+	}
+	return override, nil
+}
+
+func (r *entitlementRepository) SaveOverride(ctx context.Context, override *models.EntitlementOverride) error {
+	features, err := json.Marshal(override.Features)
+	if err != nil {
+		return err
+	}
+	limits, err := json.Marshal(override.Limits)
+	if err != nil {
+		return err
+	}
+	modules, err := json.Marshal(override.Modules)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	override.UpdatedAt = now
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO tenant_entitlement_overrides (tenant_id, features, limits, modules, reason, expires_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET features = EXCLUDED.features, limits = EXCLUDED.limits, modules = EXCLUDED.modules,
+			reason = EXCLUDED.reason, expires_at = EXCLUDED.expires_at, updated_at = EXCLUDED.updated_at
+		RETURNING created_at`,
+		override.TenantID, features, limits, modules, override.Reason, override.ExpiresAt, now,
+	).Scan(&override.CreatedAt)
+}
+
+func (r *entitlementRepository) DeleteOverride(ctx context.Context, tenantID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM tenant_entitlement_overrides WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("entitlement override not found")
+	}
+	return nil
+}
+
+func scanPlanEntitlements(row rowScanner) (*models.PlanEntitlements, error) {
+	entitlements := &models.PlanEntitlements{}
+	var features, limits, modules []byte
+	err := row.Scan(
+		&entitlements.ID,
+		&entitlements.PlanID,
+		&entitlements.Version,
+		&features,
+		&limits,
+		&modules,
+		&entitlements.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(features, &entitlements.Features); err != nil {
+		return nil, fmt.Errorf("invalid entitlement features: %w", err)
+	}
+	if err := json.Unmarshal(limits, &entitlements.Limits); err != nil {
+		return nil, fmt.Errorf("invalid entitlement limits: %w", err)
+	}
+	if err := json.Unmarshal(modules, &entitlements.Modules); err != nil {
+		return nil, fmt.Errorf("invalid entitlement modules: %w", err)
+	}
+	return entitlements, nil
+}
@@ -0,0 +1,247 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/shared/featureflags"
+)
+
+// ErrFeatureFlagChanged is returned when a flag was changed since the
+// version being updated was read
+var ErrFeatureFlagChanged = errors.New("feature flag changed concurrently")
+
+// FeatureFlagRepository stores the feature flags. Every change increases the
+// version of the ruleset and returns it, so clients can be told to reload.
+type FeatureFlagRepository interface {
+	List(ctx context.Context) ([]*featureflags.Flag, error)
+	Get(ctx context.Context, key string) (*featureflags.Flag, error)
+	Create(ctx context.Context, flag *featureflags.Flag) (int64, error)
+	// Update saves the flag if it is still at version and increases its
+	// version
+	Update(ctx context.Context, flag *featureflags.Flag, version int) (int64, error)
+	Delete(ctx context.Context, key string) (int64, error)
+	// Ruleset returns every flag with the version of the ruleset they form
+	Ruleset(ctx context.Context) (*featureflags.Ruleset, error)
+}
+
+type featureFlagRepository struct {
+	db *sql.DB
+}
+
+func NewFeatureFlagRepository(db *sql.DB) FeatureFlagRepository {
+	return &featureFlagRepository{db: db}
+}
+
+const featureFlagColumns = `key, description, kind, variations, enabled, off_variation, rules, fallthrough, version, created_at, updated_at`
+
+func (r *featureFlagRepository) List(ctx context.Context) ([]*featureflags.Flag, error) {
+	return queryFeatureFlags(ctx, r.db)
+}
+
+func (r *featureFlagRepository) Get(ctx context.Context, key string) (*featureflags.Flag, error) {
+	flag, err := scanFeatureFlag(r.db.QueryRowContext(ctx, `SELECT `+featureFlagColumns+` FROM feature_flags WHERE key = $1`, key))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("feature flag not found")
+	}
+	return flag, err
+}
+
+func (r *featureFlagRepository) Create(ctx context.Context, flag *featureflags.Flag) (int64, error) {
+	variations, rules, fallthroughServe, err := encodeFeatureFlag(flag)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	flag.Version = 1
+	flag.CreatedAt = now
+	flag.UpdatedAt = now
+
+	return r.change(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO feature_flags (`+featureFlagColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (key) DO NOTHING`,
+			flag.Key, flag.Description, flag.Kind, variations, flag.Enabled, flag.OffVariation, rules, fallthroughServe,
+			flag.Version, flag.CreatedAt, flag.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("feature flag already exists")
+		}
+		return nil
+	})
+}
+
+func (r *featureFlagRepository) Update(ctx context.Context, flag *featureflags.Flag, version int) (int64, error) {
+	variations, rules, fallthroughServe, err := encodeFeatureFlag(flag)
+	if err != nil {
+		return 0, err
+	}
+
+	flag.Version = version + 1
+	flag.UpdatedAt = time.Now()
+
+	return r.change(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE feature_flags
+			SET description = $3, kind = $4, variations = $5, enabled = $6, off_variation = $7,
+				rules = $8, fallthrough = $9, version = $10, updated_at = $11
+			WHERE key = $1 AND version = $2`,
+			flag.Key, version, flag.Description, flag.Kind, variations, flag.Enabled, flag.OffVariation, rules, fallthroughServe,
+			flag.Version, flag.UpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrFeatureFlagChanged
+		}
+		return nil
+	})
+}
+
+func (r *featureFlagRepository) Delete(ctx context.Context, key string) (int64, error) {
+	return r.change(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `DELETE FROM feature_flags WHERE key = $1`, key)
+		if err != nil {
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("feature flag not found")
+		}
+		return nil
+	})
+}
+
+func (r *featureFlagRepository) Ruleset(ctx context.Context) (*featureflags.Ruleset, error) {
+	// One snapshot, so the version matches the flags read with it
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ruleset := &featureflags.Ruleset{}
+	if err := tx.QueryRowContext(ctx, `SELECT version FROM feature_flag_ruleset`).Scan(&ruleset.Version); err != nil {
+		return nil, err
+	}
+
+	flags, err := queryFeatureFlags(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	ruleset.Flags = make([]featureflags.Flag, 0, len(flags))
+	for _, flag := range flags {
+		ruleset.Flags = append(ruleset.Flags, *flag)
+	}
+
+	return ruleset, tx.Commit()
+}
+
+// change applies fn and increases the ruleset version in one transaction
+func (r *featureFlagRepository) change(ctx context.Context, fn func(tx *sql.Tx) error) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return 0, err
+	}
+
+	var version int64
+	if err := tx.QueryRowContext(ctx, `UPDATE feature_flag_ruleset SET version = version + 1 RETURNING version`).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	return version, tx.Commit()
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryFeatureFlags(ctx context.Context, db queryer) ([]*featureflags.Flag, error) {
+	rows, err := db.QueryContext(ctx, `SELECT `+featureFlagColumns+` FROM feature_flags ORDER BY key`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []*featureflags.Flag{}
+	for rows.Next() {
+		flag, err := scanFeatureFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, rows.Err()
+}
+
+func encodeFeatureFlag(flag *featureflags.Flag) (variations, rules, fallthroughServe []byte, err error) {
+	if variations, err = json.Marshal(flag.Variations); err != nil {
+		return nil, nil, nil, err
+	}
+	if rules, err = json.Marshal(flag.Rules); err != nil {
+		return nil, nil, nil, err
+	}
+	if fallthroughServe, err = json.Marshal(flag.Fallthrough); err != nil {
+		return nil, nil, nil, err
+	}
+	return variations, rules, fallthroughServe, nil
+}
+
+func scanFeatureFlag(row rowScanner) (*featureflags.Flag, error) {
+	flag := &featureflags.Flag{}
+	var variations, rules, fallthroughServe []byte
+	err := row.Scan(
+		&flag.Key,
+		&flag.Description,
+		&flag.Kind,
+		&variations,
+		&flag.Enabled,
+		&flag.OffVariation,
+		&rules,
+		&fallthroughServe,
+		&flag.Version,
+		&flag.CreatedAt,
+		&flag.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(variations, &flag.Variations); err != nil {
+		return nil, fmt.Errorf("invalid flag variations: %w", err)
+	}
+	if err := json.Unmarshal(rules, &flag.Rules); err != nil {
+		return nil, fmt.Errorf("invalid flag rules: %w", err)
+	}
+	if err := json.Unmarshal(fallthroughServe, &flag.Fallthrough); err != nil {
+		return nil, fmt.Errorf("invalid flag fallthrough: %w", err)
+	}
+	return flag, nil
+}
@@ -0,0 +1,168 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// MeteringRepository stores usage events and the metered prices of plans
+type MeteringRepository interface {
+	// RecordEvents inserts the events not recorded before, by tenant, metric
+	// and idempotency key, and returns how many it inserted
+	RecordEvents(ctx context.Context, events []*models.UsageEvent) (int, error)
+	// SumUsage adds up the tenant's usage per metric of the events that
+	// occurred in [from, to)
+	SumUsage(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (map[string]float64, error)
+	ListMeteredPrices(ctx context.Context, planID uuid.UUID) ([]*models.MeteredPrice, error)
+	// SetMeteredPrices replaces all metered prices of the plan
+	SetMeteredPrices(ctx context.Context, planID uuid.UUID, prices []models.MeteredPrice) error
+	// ListStoredBytes returns the bytes stored in the file service by each
+	// tenant with an active or past due subscription
+	ListStoredBytes(ctx context.Context) (map[uuid.UUID]int64, error)
+}
+
+type meteringRepository struct {
+	db *sql.DB
+}
+
+func NewMeteringRepository(db *sql.DB) MeteringRepository {
+	return &meteringRepository{db: db}
+}
+
+func (r *meteringRepository) RecordEvents(ctx context.Context, events []*models.UsageEvent) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	recorded := 0
+	now := time.Now()
+	for _, event := range events {
+		event.ID = uuid.New()
+		event.CreatedAt = now
+
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO usage_events (id, tenant_id, metric, quantity, occurred_at, idempotency_key, source, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (tenant_id, metric, idempotency_key) DO NOTHING`,
+			event.ID, event.TenantID, event.Metric, event.Quantity, event.OccurredAt, event.IdempotencyKey, event.Source, event.CreatedAt,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		recorded += int(rowsAffected)
+	}
+
+	return recorded, tx.Commit()
+}
+
+func (r *meteringRepository) SumUsage(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (map[string]float64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT metric, SUM(quantity) FROM usage_events
+		WHERE tenant_id = $1 AND occurred_at >= $2 AND occurred_at < $3
+		GROUP BY metric`,
+		tenantID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := map[string]float64{}
+	for rows.Next() {
+		var metric string
+		var quantity float64
+		if err := rows.Scan(&metric, &quantity); err != nil {
+			return nil, err
+		}
+		usage[metric] = quantity
+	}
+
+	return usage, rows.Err()
+}
+
+func (r *meteringRepository) ListMeteredPrices(ctx context.Context, planID uuid.UUID) ([]*models.MeteredPrice, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT plan_id, metric, description, unit_price, included_quantity
+		FROM plan_metered_prices
+		WHERE plan_id = $1
+		ORDER BY metric`,
+		planID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := []*models.MeteredPrice{}
+	for rows.Next() {
+		price := &models.MeteredPrice{}
+		if err := rows.Scan(&price.PlanID, &price.Metric, &price.Description, &price.UnitPrice, &price.IncludedQuantity); err != nil {
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+
+	return prices, rows.Err()
+}
+
+func (r *meteringRepository) SetMeteredPrices(ctx context.Context, planID uuid.UUID, prices []models.MeteredPrice) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM plan_metered_prices WHERE plan_id = $1`, planID); err != nil {
+		return err
+	}
+	for _, price := range prices {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO plan_metered_prices (plan_id, metric, description, unit_price, included_quantity)
+			VALUES ($1, $2, $3, $4, $5)`,
+			planID, price.Metric, price.Description, price.UnitPrice, price.IncludedQuantity,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *meteringRepository) ListStoredBytes(ctx context.Context) (map[uuid.UUID]int64, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT s.tenant_id, COALESCE(SUM(f.file_size), 0)
+		FROM subscriptions s
+		LEFT JOIN files f ON f.tenant_id = s.tenant_id AND f.deleted_at IS NULL
+		WHERE s.status IN ('active', 'past_due')
+		GROUP BY s.tenant_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := map[uuid.UUID]int64{}
+	for rows.Next() {
+		var tenantID uuid.UUID
+		var bytes int64
+		if err := rows.Scan(&tenantID, &bytes); err != nil {
+			return nil, err
+		}
+		stored[tenantID] = bytes
+	}
+
+	return stored, rows.Err()
+}
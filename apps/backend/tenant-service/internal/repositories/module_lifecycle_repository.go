@@ -0,0 +1,295 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ModuleLifecycleRepository stores the lifecycle jobs of tenants' modules and
+// moves the installations along as their hooks succeed or fail
+type ModuleLifecycleRepository interface {
+	// ClaimDue marks up to limit due jobs running and returns them with the
+	// module and its config. A job is due when its attempt is and every job
+	// before it in its batch succeeded; a running job is due again once its
+	// lease expired, e.g. because the worker stopped.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ModuleLifecycleJob, error)
+	Succeed(ctx context.Context, job *models.ModuleLifecycleJob, now time.Time) error
+	Retry(ctx context.Context, job *models.ModuleLifecycleJob, nextAttemptAt time.Time, message string) error
+	// Fail gives up on the job and the jobs after it in its batch
+	Fail(ctx context.Context, job *models.ModuleLifecycleJob, message string, now time.Time) error
+	// RollBack gives up on an upgrade job and queues the rollback to the
+	// version the upgrade started from
+	RollBack(ctx context.Context, job *models.ModuleLifecycleJob, message string, now time.Time) error
+}
+
+type moduleLifecycleRepository struct {
+	db *sql.DB
+}
+
+func NewModuleLifecycleRepository(db *sql.DB) ModuleLifecycleRepository {
+	return &moduleLifecycleRepository{db: db}
+}
+
+func (r *moduleLifecycleRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ModuleLifecycleJob, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT j.id FROM module_lifecycle_jobs j
+			WHERE (j.status = 'pending' AND j.next_attempt_at <= $1 OR j.status = 'running' AND j.updated_at <= $2)
+			  AND NOT EXISTS (
+				SELECT 1 FROM module_lifecycle_jobs b
+				WHERE b.batch_id = j.batch_id AND b.position < j.position AND b.status <> 'succeeded'
+			  )
+			ORDER BY j.next_attempt_at, j.position
+			LIMIT $3
+			FOR UPDATE OF j SKIP LOCKED
+		)
+		UPDATE module_lifecycle_jobs j
+		SET status = 'running', attempts = j.attempts + 1, updated_at = $1
+		FROM due, modules m, module_installations mi
+		WHERE j.id = due.id AND m.id = j.module_id AND mi.id = j.installation_id
+		RETURNING j.id, j.installation_id, j.tenant_id, j.module_id, j.batch_id, j.position, j.event, j.version,
+			j.from_version, j.status, j.attempts, j.next_attempt_at, j.error_message, j.created_at, j.updated_at,
+			j.finished_at, j.upgrade_id, m.name, mi.config`,
+		now, now.Add(-lease), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []*models.ModuleLifecycleJob{}
+	for rows.Next() {
+		job := &models.ModuleLifecycleJob{}
+		err := rows.Scan(
+			&job.ID,
+			&job.InstallationID,
+			&job.TenantID,
+			&job.ModuleID,
+			&job.BatchID,
+			&job.Position,
+			&job.Event,
+			&job.Version,
+			&job.FromVersion,
+			&job.Status,
+			&job.Attempts,
+			&job.NextAttemptAt,
+			&job.ErrorMessage,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+			&job.FinishedAt,
+			&job.UpgradeID,
+			&job.ModuleName,
+			&job.Config,
+		)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (r *moduleLifecycleRepository) Succeed(ctx context.Context, job *models.ModuleLifecycleJob, now time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_lifecycle_jobs
+		SET status = 'succeeded', error_message = NULL, finished_at = $2, updated_at = $2
+		WHERE id = $1`,
+		job.ID, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Installing, upgrading and rolling back end installed at the job's
+	// version; uninstalling ends uninstalled. A rollback keeps the error of
+	// the upgrade it undid.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_installations
+		SET status = CASE WHEN $2 IN ('install', 'upgrade', 'rollback') THEN 'installed' ELSE status END,
+			version = CASE WHEN $2 IN ('upgrade', 'rollback') THEN $4 ELSE version END,
+			uninstalled_at = CASE WHEN $2 = 'uninstall' THEN $3 ELSE uninstalled_at END,
+			error_message = CASE WHEN $2 = 'rollback' THEN error_message ELSE NULL END,
+			updated_at = $3
+		WHERE id = $1`,
+		job.InstallationID, job.Event, now, job.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	if job.UpgradeID != nil {
+		status := models.ModuleUpgradeCompleted
+		if job.Event == models.ModuleEventRollback {
+			status = models.ModuleUpgradeRolledBack
+		}
+		if err := finishUpgrade(ctx, tx, *job.UpgradeID, status, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *moduleLifecycleRepository) Retry(ctx context.Context, job *models.ModuleLifecycleJob, nextAttemptAt time.Time, message string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_lifecycle_jobs
+		SET status = 'pending', next_attempt_at = $2, error_message = $3, updated_at = NOW()
+		WHERE id = $1`,
+		job.ID, nextAttemptAt, message,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE module_installations SET error_message = $2, updated_at = NOW() WHERE id = $1`, job.InstallationID, message)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *moduleLifecycleRepository) Fail(ctx context.Context, job *models.ModuleLifecycleJob, message string, now time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_lifecycle_jobs
+		SET status = 'failed', error_message = $2, finished_at = $3, updated_at = $3
+		WHERE id = $1`,
+		job.ID, message, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The jobs after it in the batch need it, so they fail with it
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_lifecycle_jobs
+		SET status = 'failed', error_message = $3, finished_at = $4, updated_at = $4
+		WHERE batch_id = $1 AND position > $2 AND status = 'pending'`,
+		job.BatchID, job.Position, "not run: "+job.ModuleName+" "+job.Event+" failed", now,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Installations whose install, upgrade, rollback or uninstall failed are
+	// failed; a failed enable or disable only records its error
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_installations mi
+		SET status = CASE WHEN j.event IN ('install', 'upgrade', 'rollback', 'uninstall') THEN 'failed' ELSE mi.status END,
+			error_message = j.error_message, updated_at = $3
+		FROM module_lifecycle_jobs j
+		WHERE j.batch_id = $1 AND j.position >= $2 AND j.status = 'failed' AND mi.id = j.installation_id`,
+		job.BatchID, job.Position, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	if job.UpgradeID != nil {
+		_, err = tx.ExecContext(ctx, `UPDATE module_upgrades SET error_message = $2 WHERE id = $1`, *job.UpgradeID, message)
+		if err != nil {
+			return err
+		}
+		if err := finishUpgrade(ctx, tx, *job.UpgradeID, models.ModuleUpgradeFailed, now); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *moduleLifecycleRepository) RollBack(ctx context.Context, job *models.ModuleLifecycleJob, message string, now time.Time) error {
+	if job.UpgradeID == nil || job.FromVersion == nil {
+		return fmt.Errorf("job %s is not an upgrade", job.ID)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_lifecycle_jobs
+		SET status = 'failed', error_message = $2, finished_at = $3, updated_at = $3
+		WHERE id = $1`,
+		job.ID, message, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO module_lifecycle_jobs (installation_id, tenant_id, module_id, batch_id, position, event, version, from_version, upgrade_id, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, 0, 'rollback', $5, $6, $7, $8, $8, $8)`,
+		job.InstallationID, job.TenantID, job.ModuleID, uuid.New(), *job.FromVersion, job.Version, *job.UpgradeID, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_upgrades SET status = 'rolling_back', error_message = $2 WHERE id = $1`,
+		*job.UpgradeID, message,
+	)
+	if err != nil {
+		return err
+	}
+
+	// The installation stays updating until the rollback is done
+	_, err = tx.ExecContext(ctx, `UPDATE module_installations SET error_message = $2, updated_at = $3 WHERE id = $1`,
+		job.InstallationID, fmt.Sprintf("upgrade to %s failed, rolled back to %s: %s", job.Version, *job.FromVersion, message), now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// finishUpgrade ends an upgrade. A rollout pauses once as many of its
+// upgrades rolled back or failed as it allows.
+func finishUpgrade(ctx context.Context, tx *sql.Tx, upgradeID uuid.UUID, status string, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `UPDATE module_upgrades SET status = $2, finished_at = $3 WHERE id = $1`, upgradeID, status, now)
+	if err != nil {
+		return err
+	}
+	if status == models.ModuleUpgradeCompleted {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE module_rollouts r
+		SET status = 'paused', updated_at = $2
+		FROM module_upgrades u
+		WHERE u.id = $1 AND r.id = u.rollout_id AND r.status = 'active'
+		  AND (SELECT COUNT(*) FROM module_upgrades f
+		       WHERE f.rollout_id = r.id AND f.status IN ('rolled_back', 'failed')) >= r.max_failures`,
+		upgradeID, now,
+	)
+	return err
+}
@@ -0,0 +1,196 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ProvisioningRepository stores the state of tenant provisioning sagas
+type ProvisioningRepository interface {
+	Create(ctx context.Context, provisioning *models.TenantProvisioning) error
+	// Update saves the saga state after a step. It fails once the saga has
+	// finished, so a saga finished by recovery is not overwritten by its
+	// original run.
+	Update(ctx context.Context, provisioning *models.TenantProvisioning) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.TenantProvisioning, error)
+	// ClaimStale returns a saga that has been running without progress since
+	// before the given time and touches it so other instances skip it
+	ClaimStale(ctx context.Context, before time.Time) (*models.TenantProvisioning, error)
+}
+
+type provisioningRepository struct {
+	db *sql.DB
+}
+
+func NewProvisioningRepository(db *sql.DB) ProvisioningRepository {
+	return &provisioningRepository{db: db}
+}
+
+const provisioningColumns = `id, tenant_id, subdomain, status, steps, request, subscription_id, admin_user_id, error, created_at, updated_at, completed_at`
+
+func (r *provisioningRepository) Create(ctx context.Context, provisioning *models.TenantProvisioning) error {
+	steps, request, err := marshalProvisioning(provisioning)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO tenant_provisionings (` + provisioningColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+
+	now := time.Now()
+	provisioning.ID = uuid.New()
+	provisioning.CreatedAt = now
+	provisioning.UpdatedAt = now
+
+	_, err = r.db.ExecContext(ctx, query,
+		provisioning.ID,
+		provisioning.TenantID,
+		provisioning.Subdomain,
+		provisioning.Status,
+		steps,
+		request,
+		provisioning.SubscriptionID,
+		provisioning.AdminUserID,
+		provisioning.Error,
+		provisioning.CreatedAt,
+		provisioning.UpdatedAt,
+		provisioning.CompletedAt,
+	)
+
+	return err
+}
+
+func (r *provisioningRepository) Update(ctx context.Context, provisioning *models.TenantProvisioning) error {
+	steps, request, err := marshalProvisioning(provisioning)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE tenant_provisionings
+		SET tenant_id = $2, status = $3, steps = $4, request = $5, subscription_id = $6,
+			admin_user_id = $7, error = $8, updated_at = $9, completed_at = $10
+		WHERE id = $1 AND status = 'running'
+	`
+
+	provisioning.UpdatedAt = time.Now()
+
+	result, err := r.db.ExecContext(ctx, query,
+		provisioning.ID,
+		provisioning.TenantID,
+		provisioning.Status,
+		steps,
+		request,
+		provisioning.SubscriptionID,
+		provisioning.AdminUserID,
+		provisioning.Error,
+		provisioning.UpdatedAt,
+		provisioning.CompletedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("provisioning is not running")
+	}
+
+	return nil
+}
+
+func (r *provisioningRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.TenantProvisioning, error) {
+	query := `SELECT ` + provisioningColumns + ` FROM tenant_provisionings WHERE id = $1`
+
+	provisioning, err := scanProvisioning(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("provisioning not found")
+		}
+		return nil, err
+	}
+
+	return provisioning, nil
+}
+
+func (r *provisioningRepository) ClaimStale(ctx context.Context, before time.Time) (*models.TenantProvisioning, error) {
+	query := `
+		UPDATE tenant_provisionings
+		SET updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM tenant_provisionings
+			WHERE status = 'running' AND updated_at < $1
+			ORDER BY updated_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + provisioningColumns
+
+	provisioning, err := scanProvisioning(r.db.QueryRowContext(ctx, query, before))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return provisioning, nil
+}
+
+func marshalProvisioning(provisioning *models.TenantProvisioning) ([]byte, []byte, error) {
+	steps, err := json.Marshal(provisioning.Steps)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode provisioning steps: %w", err)
+	}
+
+	request, err := json.Marshal(provisioning.Request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode provisioning request: %w", err)
+	}
+
+	return steps, request, nil
+}
+
+func scanProvisioning(row *sql.Row) (*models.TenantProvisioning, error) {
+	provisioning := &models.TenantProvisioning{}
+	var steps, request []byte
+
+	err := row.Scan(
+		&provisioning.ID,
+		&provisioning.TenantID,
+		&provisioning.Subdomain,
+		&provisioning.Status,
+		&steps,
+		&request,
+		&provisioning.SubscriptionID,
+		&provisioning.AdminUserID,
+		&provisioning.Error,
+		&provisioning.CreatedAt,
+		&provisioning.UpdatedAt,
+		&provisioning.CompletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(steps, &provisioning.Steps); err != nil {
+		return nil, fmt.Errorf("invalid provisioning steps: %w", err)
+	}
+	if err := json.Unmarshal(request, &provisioning.Request); err != nil {
+		return nil, fmt.Errorf("invalid provisioning request: %w", err)
+	}
+
+	return provisioning, nil
+}
@@ -0,0 +1,60 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QuotaRepository measures a tenant's usage. Users and stored files are
+// counted from the auth and file service tables of the shared database.
+type QuotaRepository interface {
+	// CountActiveUsers counts the tenant's active members with an active
+	// account
+	CountActiveUsers(ctx context.Context, tenantID uuid.UUID) (int64, error)
+	// CountPendingInvitations counts the tenant's invitations that can still
+	// be accepted
+	CountPendingInvitations(ctx context.Context, tenantID uuid.UUID, at time.Time) (int64, error)
+	// SumStoredBytes adds up the size of the tenant's files that are not
+	// deleted
+	SumStoredBytes(ctx context.Context, tenantID uuid.UUID) (int64, error)
+}
+
+type quotaRepository struct {
+	db *sql.DB
+}
+
+func NewQuotaRepository(db *sql.DB) QuotaRepository {
+	return &quotaRepository{db: db}
+}
+
+func (r *quotaRepository) CountActiveUsers(ctx context.Context, tenantID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM tenant_memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.tenant_id = $1 AND m.is_active = true AND u.is_active = true`,
+		tenantID,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *quotaRepository) CountPendingInvitations(ctx context.Context, tenantID uuid.UUID, at time.Time) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM user_invitations WHERE tenant_id = $1 AND status = 'pending' AND expires_at > $2`,
+		tenantID, at,
+	).Scan(&count)
+	return count, err
+}
+
+func (r *quotaRepository) SumStoredBytes(ctx context.Context, tenantID uuid.UUID) (int64, error) {
+	var bytes int64
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(file_size), 0) FROM files WHERE tenant_id = $1 AND deleted_at IS NULL`,
+		tenantID,
+	).Scan(&bytes)
+	return bytes, err
+}
@@ -19,6 +19,12 @@ type SubscriptionRepository interface {
 	Update(ctx context.Context, subscription *models.Subscription) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	GetExpiring(ctx context.Context, days int) ([]*models.Subscription, error)
+	// RevenueAt returns, per currency, the paying subscriptions at the given
+	// time and their MRR. A subscription counts if it was created by then,
+	// was past its trial and was still active (cancelled or expired ones
+	// count until they were last updated). Prices are the plans' current ones.
+	RevenueAt(ctx context.Context, at time.Time) ([]*models.SubscriptionRevenue, error)
+	CountTrialing(ctx context.Context, at time.Time) (int, error)
 }
 
 type subscriptionRepository struct {
@@ -31,8 +37,8 @@ func NewSubscriptionRepository(db *sql.DB) SubscriptionRepository {
 
 func (r *subscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
 	query := `
-		INSERT INTO subscriptions (id, tenant_id, plan_id, status, trial_end_at, current_period_start, current_period_end, cancel_at_period_end, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO subscriptions (id, tenant_id, plan_id, status, trial_end_at, current_period_start, current_period_end, billing_anchor, cancel_at_period_end, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
 	now := time.Now()
@@ -52,6 +58,7 @@ func (r *subscriptionRepository) Create(ctx context.Context, subscription *model
 		subscription.TrialEndAt,
 		subscription.CurrentPeriodStart,
 		subscription.CurrentPeriodEnd,
+		subscription.BillingAnchor,
 		subscription.CancelAtPeriodEnd,
 		subscription.CreatedAt,
 		subscription.UpdatedAt,
@@ -63,7 +70,7 @@ func (r *subscriptionRepository) Create(ctx context.Context, subscription *model
 func (r *subscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
 	query := `
 		SELECT s.id, s.tenant_id, s.plan_id, s.status, s.trial_end_at, 
-			   s.current_period_start, s.current_period_end, s.cancel_at_period_end, 
+			   s.current_period_start, s.current_period_end, s.billing_anchor, s.cancel_at_period_end,
 			   s.created_at, s.updated_at,
 			   t.id, t.name, t.subdomain, t.domain, t.logo, t.status, t.settings, t.created_at, t.updated_at,
 			   p.id, p.name, p.description, p.price, p.currency, p.billing_cycle, 
@@ -87,6 +94,7 @@ func (r *subscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*mo
 		&subscription.TrialEndAt,
 		&subscription.CurrentPeriodStart,
 		&subscription.CurrentPeriodEnd,
+		&subscription.BillingAnchor,
 		&subscription.CancelAtPeriodEnd,
 		&subscription.CreatedAt,
 		&subscription.UpdatedAt,
@@ -126,13 +134,13 @@ func (r *subscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*mo
 func (r *subscriptionRepository) GetByTenantID(ctx context.Context, tenantID uuid.UUID) (*models.Subscription, error) {
 	query := `
 		SELECT s.id, s.tenant_id, s.plan_id, s.status, s.trial_end_at, 
-			   s.current_period_start, s.current_period_end, s.cancel_at_period_end, 
+			   s.current_period_start, s.current_period_end, s.billing_anchor, s.cancel_at_period_end,
 			   s.created_at, s.updated_at,
 			   p.id, p.name, p.description, p.price, p.currency, p.billing_cycle, 
 			   p.max_users, p.max_storage, p.features, p.is_active, p.created_at, p.updated_at
 		FROM subscriptions s
 		LEFT JOIN plans p ON s.plan_id = p.id
-		WHERE s.tenant_id = $1 AND s.status = 'active'
+		WHERE s.tenant_id = $1 AND s.status IN ('active', 'past_due')
 		ORDER BY s.created_at DESC
 		LIMIT 1
 	`
@@ -149,6 +157,7 @@ func (r *subscriptionRepository) GetByTenantID(ctx context.Context, tenantID uui
 		&subscription.TrialEndAt,
 		&subscription.CurrentPeriodStart,
 		&subscription.CurrentPeriodEnd,
+		&subscription.BillingAnchor,
 		&subscription.CancelAtPeriodEnd,
 		&subscription.CreatedAt,
 		&subscription.UpdatedAt,
@@ -188,7 +197,7 @@ func (r *subscriptionRepository) List(ctx context.Context, limit, offset int) ([
 	// Get paginated results
 	query := `
 		SELECT s.id, s.tenant_id, s.plan_id, s.status, s.trial_end_at, 
-			   s.current_period_start, s.current_period_end, s.cancel_at_period_end, 
+			   s.current_period_start, s.current_period_end, s.billing_anchor, s.cancel_at_period_end,
 			   s.created_at, s.updated_at,
 			   t.id, t.name, t.subdomain, t.domain, t.logo, t.status, t.settings, t.created_at, t.updated_at,
 			   p.id, p.name, p.description, p.price, p.currency, p.billing_cycle, 
@@ -221,6 +230,7 @@ func (r *subscriptionRepository) List(ctx context.Context, limit, offset int) ([
 			&subscription.TrialEndAt,
 			&subscription.CurrentPeriodStart,
 			&subscription.CurrentPeriodEnd,
+			&subscription.BillingAnchor,
 			&subscription.CancelAtPeriodEnd,
 			&subscription.CreatedAt,
 			&subscription.UpdatedAt,
@@ -259,8 +269,9 @@ func (r *subscriptionRepository) Update(ctx context.Context, subscription *model
 	query := `
 		UPDATE subscriptions 
 		SET plan_id = $2, status = $3, trial_end_at = $4, 
-			current_period_start = $5, current_period_end = $6, 
-			cancel_at_period_end = $7, updated_at = $8
+			current_period_start = $5, current_period_end = $6, billing_anchor = $7,
+			cancel_at_period_end = $8, updated_at = $9,
+			entitlement_version = CASE WHEN plan_id = $2 THEN entitlement_version END
 		WHERE id = $1
 	`
 
@@ -273,6 +284,7 @@ func (r *subscriptionRepository) Update(ctx context.Context, subscription *model
 		subscription.TrialEndAt,
 		subscription.CurrentPeriodStart,
 		subscription.CurrentPeriodEnd,
+		subscription.BillingAnchor,
 		subscription.CancelAtPeriodEnd,
 		subscription.UpdatedAt,
 	)
@@ -289,7 +301,7 @@ func (r *subscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error
 func (r *subscriptionRepository) GetExpiring(ctx context.Context, days int) ([]*models.Subscription, error) {
 	query := `
 		SELECT s.id, s.tenant_id, s.plan_id, s.status, s.trial_end_at, 
-			   s.current_period_start, s.current_period_end, s.cancel_at_period_end, 
+			   s.current_period_start, s.current_period_end, s.billing_anchor, s.cancel_at_period_end,
 			   s.created_at, s.updated_at,
 			   t.id, t.name, t.subdomain, t.domain, t.logo, t.status, t.settings, t.created_at, t.updated_at,
 			   p.id, p.name, p.description, p.price, p.currency, p.billing_cycle, 
@@ -323,6 +335,7 @@ func (r *subscriptionRepository) GetExpiring(ctx context.Context, days int) ([]*
 			&subscription.TrialEndAt,
 			&subscription.CurrentPeriodStart,
 			&subscription.CurrentPeriodEnd,
+			&subscription.BillingAnchor,
 			&subscription.CancelAtPeriodEnd,
 			&subscription.CreatedAt,
 			&subscription.UpdatedAt,
@@ -356,3 +369,40 @@ func (r *subscriptionRepository) GetExpiring(ctx context.Context, days int) ([]*
 
 	return subscriptions, nil
 }
+
+func (r *subscriptionRepository) RevenueAt(ctx context.Context, at time.Time) ([]*models.SubscriptionRevenue, error) {
+	query := `
+		SELECT p.currency, COUNT(*),
+			   COALESCE(SUM(CASE WHEN p.billing_cycle = 'yearly' THEN p.price / 12 ELSE p.price END), 0)
+		FROM subscriptions s
+		JOIN plans p ON s.plan_id = p.id
+		WHERE s.created_at <= $1
+		  AND (s.status = 'active' OR s.updated_at > $1)
+		  AND (s.trial_end_at IS NULL OR s.trial_end_at <= $1)
+		GROUP BY p.currency
+		ORDER BY p.currency
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revenue []*models.SubscriptionRevenue
+	for rows.Next() {
+		item := &models.SubscriptionRevenue{}
+		if err := rows.Scan(&item.Currency, &item.Subscriptions, &item.MRR); err != nil {
+			return nil, err
+		}
+		revenue = append(revenue, item)
+	}
+
+	return revenue, rows.Err()
+}
+
+func (r *subscriptionRepository) CountTrialing(ctx context.Context, at time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM subscriptions WHERE status = 'active' AND trial_end_at > $1`, at).Scan(&count)
+	return count, err
+}
@@ -20,6 +20,8 @@ type TenantRepository interface {
 	Update(ctx context.Context, tenant *models.Tenant) error
 	Delete(ctx context.Context, id uuid.UUID) error
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+	CountByStatus(ctx context.Context) (map[string]int, error)
+	CountCreatedBetween(ctx context.Context, from, to time.Time) (int, error)
 }
 
 type tenantRepository struct {
@@ -235,3 +237,29 @@ func (r *tenantRepository) UpdateStatus(ctx context.Context, id uuid.UUID, statu
 	_, err := r.db.ExecContext(ctx, query, id, status, time.Now())
 	return err
 }
+
+func (r *tenantRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM tenants GROUP BY status`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (r *tenantRepository) CountCreatedBetween(ctx context.Context, from, to time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tenants WHERE created_at >= $1 AND created_at < $2`, from, to).Scan(&count)
+	return count, err
+}
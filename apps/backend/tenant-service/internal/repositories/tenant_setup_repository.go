@@ -0,0 +1,167 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrSeedUnavailable is returned when a module's seed tables are not
+// installed in this database
+var ErrSeedUnavailable = errors.New("module tables are not installed")
+
+// TenantSetupRepository writes the per-tenant records provisioning creates
+// besides the tenant and its subscription. Every delete is scoped to one
+// tenant and deleting nothing is not an error, so compensations can be
+// retried.
+type TenantSetupRepository interface {
+	CreateDefaultConfiguration(ctx context.Context, tenantID uuid.UUID) error
+	DeleteConfiguration(ctx context.Context, tenantID uuid.UUID) error
+
+	ListActiveModules(ctx context.Context) ([]*models.Module, error)
+	EnableModules(ctx context.Context, tenantID uuid.UUID, moduleIDs []uuid.UUID) error
+	DeleteModules(ctx context.Context, tenantID uuid.UUID) error
+
+	// SeedModule creates a module's starter data for the tenant. It returns
+	// false when the module has nothing to seed.
+	SeedModule(ctx context.Context, tenantID uuid.UUID, module string) (bool, error)
+	DeleteSeedData(ctx context.Context, tenantID uuid.UUID, module string) error
+}
+
+type tenantSetupRepository struct {
+	db *sql.DB
+}
+
+func NewTenantSetupRepository(db *sql.DB) TenantSetupRepository {
+	return &tenantSetupRepository{db: db}
+}
+
+// moduleSeed is the starter data of a module. Module tables key tenants by
+// their ID as text.
+type moduleSeed struct {
+	insert string
+	delete string
+}
+
+var moduleSeeds = map[string]moduleSeed{
+	"hrm": {
+		insert: `INSERT INTO departments (tenant_id, name, description) VALUES ($1, 'General', 'Default department')`,
+		delete: `DELETE FROM departments WHERE tenant_id = $1`,
+	},
+	"checkin": {
+		insert: `INSERT INTO attendance_policies (tenant_id, name) VALUES ($1, 'Standard working hours')`,
+		delete: `DELETE FROM attendance_policies WHERE tenant_id = $1`,
+	},
+}
+
+func (r *tenantSetupRepository) CreateDefaultConfiguration(ctx context.Context, tenantID uuid.UUID) error {
+	query := `
+		INSERT INTO tenant_configurations (id, tenant_id, password_policy, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, uuid.New(), tenantID, models.DefaultPasswordPolicy, time.Now())
+	return err
+}
+
+func (r *tenantSetupRepository) DeleteConfiguration(ctx context.Context, tenantID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM tenant_configurations WHERE tenant_id = $1`, tenantID)
+	return err
+}
+
+func (r *tenantSetupRepository) ListActiveModules(ctx context.Context) ([]*models.Module, error) {
+	query := `
+		SELECT id, name, display_name, version
+		FROM modules
+		WHERE is_active = true
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modules []*models.Module
+	for rows.Next() {
+		module := &models.Module{IsActive: true}
+		if err := rows.Scan(&module.ID, &module.Name, &module.DisplayName, &module.Version); err != nil {
+			return nil, err
+		}
+		modules = append(modules, module)
+	}
+
+	return modules, rows.Err()
+}
+
+func (r *tenantSetupRepository) EnableModules(ctx context.Context, tenantID uuid.UUID, moduleIDs []uuid.UUID) error {
+	if len(moduleIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO tenant_modules (id, tenant_id, module_id, is_enabled, config, installed_at, updated_at)
+		SELECT gen_random_uuid(), $1, module_id::uuid, true, '{}', $3, $3
+		FROM unnest($2::text[]) AS module_id
+		ON CONFLICT (tenant_id, module_id) DO UPDATE SET is_enabled = true, updated_at = $3
+	`
+
+	ids := make([]string, len(moduleIDs))
+	for i, id := range moduleIDs {
+		ids[i] = id.String()
+	}
+
+	_, err := r.db.ExecContext(ctx, query, tenantID, pq.Array(ids), time.Now())
+	return err
+}
+
+func (r *tenantSetupRepository) DeleteModules(ctx context.Context, tenantID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM tenant_modules WHERE tenant_id = $1`, tenantID)
+	return err
+}
+
+func (r *tenantSetupRepository) SeedModule(ctx context.Context, tenantID uuid.UUID, module string) (bool, error) {
+	seed, ok := moduleSeeds[module]
+	if !ok {
+		return false, nil
+	}
+
+	if _, err := r.db.ExecContext(ctx, seed.insert, tenantID.String()); err != nil {
+		return false, seedError(module, err)
+	}
+
+	return true, nil
+}
+
+func (r *tenantSetupRepository) DeleteSeedData(ctx context.Context, tenantID uuid.UUID, module string) error {
+	seed, ok := moduleSeeds[module]
+	if !ok {
+		return nil
+	}
+
+	if _, err := r.db.ExecContext(ctx, seed.delete, tenantID.String()); err != nil {
+		if errors.Is(seedError(module, err), ErrSeedUnavailable) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// seedError reports a module whose tables are missing as ErrSeedUnavailable
+func seedError(module string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" {
+		return fmt.Errorf("%s: %w", module, ErrSeedUnavailable)
+	}
+	return fmt.Errorf("%s: %w", module, err)
+}
@@ -1,31 +1,47 @@
 package routes
 
 import (
+	"zplus-saas/apps/backend/shared/config"
+	"zplus-saas/apps/backend/shared/middleware"
 	"zplus-saas/apps/backend/tenant-service/internal/handlers"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// SetupModuleRoutes sets up module management routes
-func SetupModuleRoutes(app *fiber.App, handler *handlers.ModuleHandler) {
-	api := app.Group("/api")
+// SetupModuleRoutes sets up module management routes. Every route requires
+// an access token, which the tenant and user are taken from.
+func SetupModuleRoutes(api fiber.Router, handler *handlers.ModuleHandler, cfg *config.Config) {
+	modules := api.Group("/modules", middleware.JWTAuth(cfg))
+
+	// Staged rollouts of module versions, which upgrade many tenants
+	rollouts := modules.Group("/rollouts", middleware.RequireSystemAdmin())
+	rollouts.Post("/", handler.CreateRollout)                       // POST /api/modules/rollouts (system admin)
+	rollouts.Get("/:rolloutId", handler.GetRollout)                 // GET /api/modules/rollouts/:rolloutId (system admin)
+	rollouts.Post("/:rolloutId/advance", handler.AdvanceRollout)    // POST /api/modules/rollouts/:rolloutId/advance (system admin)
+	rollouts.Put("/:rolloutId/status", handler.UpdateRolloutStatus) // PUT /api/modules/rollouts/:rolloutId/status (system admin)
 
 	// Module routes
-	modules := api.Group("/modules")
-	modules.Get("/", handler.GetAvailableModules)                // GET /api/modules
-	modules.Get("/tenant", handler.GetTenantModules)             // GET /api/modules/tenant (authenticated)
-	modules.Post("/install", handler.InstallModule)              // POST /api/modules/install (authenticated)
-	modules.Delete("/:moduleId", handler.UninstallModule)        // DELETE /api/modules/:moduleId (authenticated)
-	modules.Post("/:moduleId/enable", handler.EnableModule)      // POST /api/modules/:moduleId/enable (authenticated)
-	modules.Post("/:moduleId/disable", handler.DisableModule)    // POST /api/modules/:moduleId/disable (authenticated)
-	modules.Put("/:moduleId/config", handler.UpdateModuleConfig) // PUT /api/modules/:moduleId/config (authenticated)
+	modules.Get("/", handler.GetAvailableModules)                         // GET /api/modules
+	modules.Get("/tenant", handler.GetTenantModules)                      // GET /api/modules/tenant (authenticated)
+	modules.Post("/install", handler.InstallModule)                       // POST /api/modules/install (authenticated)
+	modules.Post("/install/plan", handler.PlanInstall)                    // POST /api/modules/install/plan (authenticated, dry run)
+	modules.Delete("/:moduleId", handler.UninstallModule)                 // DELETE /api/modules/:moduleId?cascade=true (authenticated)
+	modules.Get("/:moduleId/uninstall-plan", handler.PlanUninstall)       // GET /api/modules/:moduleId/uninstall-plan (authenticated, dry run)
+	modules.Post("/:moduleId/enable", handler.EnableModule)               // POST /api/modules/:moduleId/enable (authenticated)
+	modules.Post("/:moduleId/disable", handler.DisableModule)             // POST /api/modules/:moduleId/disable (authenticated)
+	modules.Put("/:moduleId/config", handler.UpdateModuleConfig)          // PUT /api/modules/:moduleId/config (authenticated)
+	modules.Get("/:moduleId/installation", handler.GetInstallationStatus) // GET /api/modules/:moduleId/installation (authenticated)
+	modules.Post("/:moduleId/retry", handler.RetryInstallation)           // POST /api/modules/:moduleId/retry (authenticated)
+	modules.Post("/:moduleId/upgrade", handler.UpgradeModule)             // POST /api/modules/:moduleId/upgrade (authenticated)
+	modules.Post("/:moduleId/rollback", handler.RollbackModule)           // POST /api/modules/:moduleId/rollback (authenticated)
+	modules.Get("/:moduleId/upgrades", handler.GetUpgradeHistory)         // GET /api/modules/:moduleId/upgrades (authenticated)
 
 	// Tenant configuration routes
-	config := api.Group("/tenant/config")
-	config.Get("/", handler.GetTenantConfiguration)              // GET /api/tenant/config (authenticated)
-	config.Put("/", handler.UpdateTenantConfiguration)           // PUT /api/tenant/config (authenticated)
-	config.Post("/domain", handler.SetupCustomDomain)            // POST /api/tenant/config/domain (authenticated)
-	config.Delete("/domain", handler.RemoveCustomDomain)         // DELETE /api/tenant/config/domain (authenticated)
-	config.Get("/features", handler.GetFeatureFlags)             // GET /api/tenant/config/features (authenticated)
-	config.Put("/features/:flagName", handler.UpdateFeatureFlag) // PUT /api/tenant/config/features/:flagName (authenticated)
+	tenantConfig := api.Group("/tenant/config", middleware.JWTAuth(cfg))
+	tenantConfig.Get("/", handler.GetTenantConfiguration)              // GET /api/tenant/config (authenticated)
+	tenantConfig.Put("/", handler.UpdateTenantConfiguration)           // PUT /api/tenant/config (authenticated)
+	tenantConfig.Post("/domain", handler.SetupCustomDomain)            // POST /api/tenant/config/domain (authenticated)
+	tenantConfig.Delete("/domain", handler.RemoveCustomDomain)         // DELETE /api/tenant/config/domain (authenticated)
+	tenantConfig.Get("/features", handler.GetFeatureFlags)             // GET /api/tenant/config/features (authenticated)
+	tenantConfig.Put("/features/:flagName", handler.UpdateFeatureFlag) // PUT /api/tenant/config/features/:flagName (authenticated)
 }
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// AuthClient manages the users of a tenant being provisioned in auth-service
+type AuthClient interface {
+	// CreateTenantAdmin creates the tenant's first admin user and returns its ID
+	CreateTenantAdmin(ctx context.Context, tenantID uuid.UUID, admin *models.ProvisionAdmin) (uuid.UUID, error)
+	// DeleteTenantUser deletes a user created for the tenant. Deleting a user
+	// that no longer exists succeeds.
+	DeleteTenantUser(ctx context.Context, tenantID, userID uuid.UUID) error
+	// NotifyTenantAdmins emails one of auth-service's tenant notices, e.g.
+	// payment_failed, to the tenant's admins
+	NotifyTenantAdmins(ctx context.Context, tenantID uuid.UUID, notification *models.TenantNotification) error
+}
+
+const authServiceTokenTTL = time.Minute
+
+type authClient struct {
+	cfg        *config.Config
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewAuthClient(cfg *config.Config) AuthClient {
+	return &authClient{
+		cfg:     cfg,
+		baseURL: strings.TrimSuffix(cfg.AuthServiceURL, "/"),
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c *authClient) CreateTenantAdmin(ctx context.Context, tenantID uuid.UUID, admin *models.ProvisionAdmin) (uuid.UUID, error) {
+	payload, err := json.Marshal(admin)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	resp, err := c.do(ctx, tenantID, http.MethodPost, "/api/internal/tenants/"+tenantID.String()+"/admin", payload)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return uuid.Nil, responseError(resp)
+	}
+
+	var user struct {
+		ID uuid.UUID `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user response: %w", err)
+	}
+
+	return user.ID, nil
+}
+
+func (c *authClient) DeleteTenantUser(ctx context.Context, tenantID, userID uuid.UUID) error {
+	resp, err := c.do(ctx, tenantID, http.MethodDelete, "/api/internal/tenants/"+tenantID.String()+"/users/"+userID.String(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+func (c *authClient) NotifyTenantAdmins(ctx context.Context, tenantID uuid.UUID, notification *models.TenantNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, tenantID, http.MethodPost, "/api/internal/tenants/"+tenantID.String()+"/notifications", payload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+
+	return nil
+}
+
+func (c *authClient) do(ctx context.Context, tenantID uuid.UUID, method, path string, payload []byte) (*http.Response, error) {
+	token, err := sharedmiddleware.NewServiceToken(c.cfg, "tenant-service", tenantID.String(), nil, authServiceTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth-service request failed: %w", err)
+	}
+
+	return resp, nil
+}
+
+// responseError turns an error response of auth-service into an error
+// carrying its message, e.g. a password policy violation
+func responseError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil && body.Message != "" {
+		return fmt.Errorf("auth-service: %s", body.Message)
+	}
+	return fmt.Errorf("auth-service returned status %d", resp.StatusCode)
+}
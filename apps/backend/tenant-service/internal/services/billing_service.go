@@ -0,0 +1,587 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+const (
+	billingInterval  = 15 * time.Minute
+	billingBatchSize = 100
+	// invoiceDueAfter is how long after it is issued an invoice may stay
+	// unpaid before its subscription is past due
+	invoiceDueAfter = 7 * 24 * time.Hour
+	// pastDueExpiry is how long after the due date of its oldest unpaid
+	// invoice a past due subscription expires
+	pastDueExpiry = 14 * 24 * time.Hour
+	// maxCatchUpPeriods bounds the periods one run renews a subscription
+	// through, e.g. after the engine was stopped for a long time
+	maxCatchUpPeriods = 24
+)
+
+// BillingService is the billing engine. Subscriptions are billed in advance:
+// each period is invoiced at the plan's price when it starts, except periods
+// that fall in a trial. Plan changes made mid-cycle are prorated. Metered
+// usage is billed in arrears, on the invoice of the next period or, when the
+// subscription is cancelled, on an invoice of its own.
+type BillingService interface {
+	// RunBilling renews, invoices and moves through their statuses the
+	// subscriptions that have reached a period boundary or due date
+	RunBilling(ctx context.Context) (*models.BillingRun, error)
+	ChangePlan(ctx context.Context, tenantID uuid.UUID, req *models.ChangePlanRequest) (*models.PlanChange, error)
+	ListInvoices(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Invoice, int, error)
+	GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error)
+	PayInvoice(ctx context.Context, id uuid.UUID, req *models.PayInvoiceRequest) (*models.Invoice, error)
+}
+
+type billingService struct {
+	billingRepo      repositories.BillingRepository
+	subscriptionRepo repositories.SubscriptionRepository
+	planRepo         repositories.PlanRepository
+	tenantRepo       repositories.TenantRepository
+	dunning          DunningService
+	metering         MeteringService
+	now              func() time.Time
+}
+
+func NewBillingService(
+	billingRepo repositories.BillingRepository,
+	subscriptionRepo repositories.SubscriptionRepository,
+	planRepo repositories.PlanRepository,
+	tenantRepo repositories.TenantRepository,
+	dunning DunningService,
+	metering MeteringService,
+) BillingService {
+	return &billingService{
+		billingRepo:      billingRepo,
+		subscriptionRepo: subscriptionRepo,
+		planRepo:         planRepo,
+		tenantRepo:       tenantRepo,
+		dunning:          dunning,
+		metering:         metering,
+		now:              time.Now,
+	}
+}
+
+func (s *billingService) RunBilling(ctx context.Context) (*models.BillingRun, error) {
+	now := s.now()
+	run := &models.BillingRun{RanAt: now}
+
+	after := uuid.Nil
+	for {
+		subscriptions, err := s.billingRepo.ListBillable(ctx, now, after, billingBatchSize)
+		if err != nil {
+			return run, fmt.Errorf("failed to list billable subscriptions: %w", err)
+		}
+
+		for _, subscription := range subscriptions {
+			run.Subscriptions++
+			err := s.bill(ctx, subscription, now, run)
+			if err != nil && !errors.Is(err, repositories.ErrSubscriptionChanged) {
+				run.Failed++
+				log.Printf("Billing subscription %s: %v", subscription.ID, err)
+			}
+		}
+
+		if len(subscriptions) < billingBatchSize || ctx.Err() != nil {
+			return run, ctx.Err()
+		}
+		after = subscriptions[len(subscriptions)-1].ID
+	}
+}
+
+// bill brings one subscription up to date: it crosses every period boundary
+// reached by now, invoices the current period if nobody has and settles the
+// subscription's status against its overdue invoices
+func (s *billingService) bill(ctx context.Context, subscription *models.Subscription, now time.Time, run *models.BillingRun) error {
+	for i := 0; i < maxCatchUpPeriods && subscription.Status == models.SubscriptionStatusActive; i++ {
+		boundary := periodBoundary(subscription)
+		if boundary.After(now) {
+			break
+		}
+
+		if subscription.CancelAtPeriodEnd {
+			invoice, err := s.cancel(ctx, subscription, boundary)
+			if err != nil {
+				return err
+			}
+			if invoice != nil {
+				run.Invoiced++
+			}
+			run.Cancelled++
+			return nil
+		}
+
+		invoice, err := s.renew(ctx, subscription, boundary)
+		if err != nil {
+			return err
+		}
+		if invoice != nil {
+			run.Invoiced++
+			if invoice.Status == models.InvoiceStatusOpen && !invoice.DueAt.After(now) {
+				// Stop renewing a subscription that would be past due
+				break
+			}
+		}
+	}
+
+	if subscription.Status == models.SubscriptionStatusActive && billedPeriod(subscription) {
+		invoiced, err := s.billingRepo.HasPeriodInvoice(ctx, subscription.ID, subscription.CurrentPeriodStart)
+		if err != nil {
+			return err
+		}
+		if !invoiced {
+			invoice := newPeriodInvoice(subscription, models.InvoiceReasonSubscriptionCreate, now)
+			if err := s.billingRepo.IssueInvoice(ctx, invoice); err != nil {
+				return err
+			}
+			run.Invoiced++
+		}
+	}
+
+	return s.settle(ctx, subscription, now, run)
+}
+
+// renew moves the subscription into the period starting at boundary and
+// invoices it, with the usage of the period that ended, unless it is still a
+// trial period
+func (s *billingService) renew(ctx context.Context, subscription *models.Subscription, boundary time.Time) (*models.Invoice, error) {
+	previousStart := subscription.CurrentPeriodStart
+	wasTrial := !billedPeriod(subscription)
+
+	var usageLines []models.InvoiceLine
+	if !wasTrial {
+		lines, err := s.metering.MeteredLines(ctx, subscription.TenantID, subscription.PlanID, previousStart, boundary)
+		if err != nil {
+			return nil, err
+		}
+		usageLines = lines
+	}
+
+	subscription.CurrentPeriodStart = boundary
+	subscription.CurrentPeriodEnd = billingPeriodEnd(subscription.BillingAnchor, boundary, subscription.Plan.BillingCycle)
+
+	var invoice *models.Invoice
+	if billedPeriod(subscription) {
+		reason := models.InvoiceReasonSubscriptionCycle
+		if wasTrial {
+			reason = models.InvoiceReasonTrialConversion
+		}
+		lines := append([]models.InvoiceLine{periodLine(subscription)}, usageLines...)
+		invoice = newInvoice(subscription, reason, boundary, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd, lines)
+	}
+
+	if err := s.billingRepo.Renew(ctx, subscription, previousStart, invoice); err != nil {
+		return nil, err
+	}
+
+	if invoice != nil && wasTrial {
+		s.convertTenant(ctx, subscription.TenantID)
+	}
+	return invoice, nil
+}
+
+// cancel ends the subscription at the end of its current period and invoices
+// the usage of that period, if any
+func (s *billingService) cancel(ctx context.Context, subscription *models.Subscription, boundary time.Time) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	if billedPeriod(subscription) {
+		lines, err := s.metering.MeteredLines(ctx, subscription.TenantID, subscription.PlanID, subscription.CurrentPeriodStart, boundary)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) > 0 {
+			invoice = newInvoice(subscription, models.InvoiceReasonUsage, boundary, subscription.CurrentPeriodStart, boundary, lines)
+		}
+	}
+
+	if err := s.billingRepo.Cancel(ctx, subscription, invoice); err != nil {
+		return nil, err
+	}
+	subscription.Status = models.SubscriptionStatusCancelled
+	return invoice, nil
+}
+
+// convertTenant makes a tenant whose trial converted to a paid subscription
+// active. The subscription is already billed, so a failure is only logged.
+func (s *billingService) convertTenant(ctx context.Context, tenantID uuid.UUID) {
+	tenant, err := s.tenantRepo.GetByID(ctx, tenantID)
+	if err != nil {
+		log.Printf("Billing: failed to load converted tenant %s: %v", tenantID, err)
+		return
+	}
+	if tenant.Status != models.TenantStatusTrial {
+		return
+	}
+	if err := s.tenantRepo.UpdateStatus(ctx, tenantID, models.TenantStatusActive); err != nil {
+		log.Printf("Billing: failed to activate converted tenant %s: %v", tenantID, err)
+	}
+}
+
+// settle moves a subscription to past_due once an invoice is overdue, back
+// to active once nothing is, and to expired once an invoice has been overdue
+// for pastDueExpiry. The oldest overdue invoice of a past due subscription
+// is dunned.
+func (s *billingService) settle(ctx context.Context, subscription *models.Subscription, now time.Time, run *models.BillingRun) error {
+	overdue, err := s.billingRepo.OldestOverdueInvoice(ctx, subscription.ID, now)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case overdue == nil:
+		if subscription.Status != models.SubscriptionStatusPastDue {
+			return nil
+		}
+		if err := s.setStatus(ctx, subscription, models.SubscriptionStatusActive); err != nil {
+			return err
+		}
+		run.Reactivated++
+	case !overdue.DueAt.Add(pastDueExpiry).After(now):
+		if err := s.setStatus(ctx, subscription, models.SubscriptionStatusExpired); err != nil {
+			return err
+		}
+		run.Expired++
+	case subscription.Status == models.SubscriptionStatusActive:
+		if err := s.setStatus(ctx, subscription, models.SubscriptionStatusPastDue); err != nil {
+			return err
+		}
+		run.PastDue++
+	}
+
+	if overdue != nil && subscription.Status == models.SubscriptionStatusPastDue {
+		if _, err := s.dunning.Start(ctx, overdue, "payment is overdue"); err != nil {
+			log.Printf("Billing: failed to start dunning invoice %s: %v", overdue.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *billingService) setStatus(ctx context.Context, subscription *models.Subscription, status string) error {
+	if err := s.billingRepo.UpdateStatus(ctx, subscription.ID, subscription.Status, status); err != nil {
+		return err
+	}
+	subscription.Status = status
+	return nil
+}
+
+func (s *billingService) ChangePlan(ctx context.Context, tenantID uuid.UUID, req *models.ChangePlanRequest) (*models.PlanChange, error) {
+	planID, err := uuid.Parse(req.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plan ID")
+	}
+
+	subscription, err := s.subscriptionRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.Status == models.SubscriptionStatusPastDue {
+		return nil, fmt.Errorf("subscription is past due, pay its overdue invoices first")
+	}
+	if subscription.PlanID == planID {
+		return nil, fmt.Errorf("subscription is already on this plan")
+	}
+
+	current, err := s.planRepo.GetByID(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load current plan: %w", err)
+	}
+	plan, err := s.planRepo.GetByID(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("plan not found")
+	}
+	if !plan.IsActive {
+		return nil, fmt.Errorf("plan is not available")
+	}
+	if plan.Currency != current.Currency {
+		return nil, fmt.Errorf("plan is billed in %s, not %s", plan.Currency, current.Currency)
+	}
+
+	now := s.now()
+	previousPlanID, previousStart := subscription.PlanID, subscription.CurrentPeriodStart
+	subscription.PlanID = plan.ID
+	subscription.Plan = plan
+
+	// A trial period is not billed: the plan the subscription is on when the
+	// trial ends is billed by the engine as the trial converts
+	var invoice *models.Invoice
+	if billedPeriod(subscription) {
+		invoiced, err := s.billingRepo.HasPeriodInvoice(ctx, subscription.ID, previousStart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load invoices: %w", err)
+		}
+
+		var lines []models.InvoiceLine
+		periodEnd := subscription.CurrentPeriodEnd
+		if invoiced {
+			lines = appendLine(lines, models.InvoiceLine{
+				Kind:        models.InvoiceLineProrationCredit,
+				Description: fmt.Sprintf("Unused time on %s", current.Name),
+				PlanID:      &current.ID,
+				Amount:      -prorate(current.Price, now, previousStart, periodEnd),
+				PeriodStart: now,
+				PeriodEnd:   periodEnd,
+			})
+		} else {
+			// Nobody invoiced the period yet, so this invoice bills it: the
+			// time used on the current plan here, the rest below
+			lines = appendLine(lines, models.InvoiceLine{
+				Kind:        models.InvoiceLineProrationCharge,
+				Description: fmt.Sprintf("Time used on %s", current.Name),
+				PlanID:      &current.ID,
+				Amount:      models.RoundAmount(current.Price - prorate(current.Price, now, previousStart, periodEnd)),
+				PeriodStart: previousStart,
+				PeriodEnd:   now,
+			})
+		}
+
+		if plan.BillingCycle == current.BillingCycle {
+			lines = appendLine(lines, models.InvoiceLine{
+				Kind:        models.InvoiceLineProrationCharge,
+				Description: fmt.Sprintf("Remaining time on %s", plan.Name),
+				PlanID:      &plan.ID,
+				Amount:      prorate(plan.Price, now, previousStart, periodEnd),
+				PeriodStart: now,
+				PeriodEnd:   periodEnd,
+			})
+		} else {
+			// A different billing cycle cannot share the current period, so
+			// the new plan starts a period of its own and the usage of the
+			// period cut short is billed at the current plan's prices
+			usageLines, err := s.metering.MeteredLines(ctx, tenantID, current.ID, previousStart, now)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, usageLines...)
+
+			subscription.CurrentPeriodStart = now
+			subscription.CurrentPeriodEnd = addBillingCycle(now, plan.BillingCycle)
+			subscription.BillingAnchor = now
+			lines = appendLine(lines, periodLine(subscription))
+		}
+
+		// An invoice billing the whole period starts with it, so the engine
+		// finds the period invoiced and does not bill it again
+		periodStart := now
+		if !invoiced {
+			periodStart = subscription.CurrentPeriodStart
+		}
+		if len(lines) > 0 {
+			invoice = newInvoice(subscription, models.InvoiceReasonPlanChange, now, periodStart, subscription.CurrentPeriodEnd, lines)
+		}
+	}
+
+	if err := s.billingRepo.ChangePlan(ctx, subscription, previousPlanID, previousStart, invoice); err != nil {
+		if errors.Is(err, repositories.ErrSubscriptionChanged) {
+			return nil, fmt.Errorf("subscription changed while changing its plan, try again")
+		}
+		return nil, fmt.Errorf("failed to change plan: %w", err)
+	}
+
+	return &models.PlanChange{Subscription: subscription, Invoice: invoice}, nil
+}
+
+func (s *billingService) ListInvoices(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Invoice, int, error) {
+	return s.billingRepo.ListInvoices(ctx, tenantID, limit, offset)
+}
+
+func (s *billingService) GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	return s.billingRepo.GetInvoice(ctx, id)
+}
+
+func (s *billingService) PayInvoice(ctx context.Context, id uuid.UUID, req *models.PayInvoiceRequest) (*models.Invoice, error) {
+	if strings.TrimSpace(req.PaymentMethod) == "" {
+		return nil, fmt.Errorf("payment_method is required")
+	}
+
+	invoice, err := s.billingRepo.GetInvoice(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status != models.InvoiceStatusOpen {
+		return nil, fmt.Errorf("invoice is not open")
+	}
+
+	now := s.now()
+	if err := s.billingRepo.PayInvoice(ctx, invoice, now, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.dunning.Resolve(ctx, invoice); err != nil {
+		log.Printf("Billing: failed to resolve dunning of invoice %s: %v", invoice.ID, err)
+	}
+
+	// The engine reactivates a past due subscription on its next run anyway;
+	// doing it here just saves the wait
+	subscription, err := s.subscriptionRepo.GetByID(ctx, invoice.SubscriptionID)
+	if err == nil && subscription.Status == models.SubscriptionStatusPastDue {
+		if err := s.settle(ctx, subscription, now, &models.BillingRun{}); err != nil {
+			log.Printf("Billing: failed to settle subscription %s after payment: %v", subscription.ID, err)
+		}
+	}
+
+	return invoice, nil
+}
+
+// periodBoundary is where the subscription's current period ends: the end
+// of its trial if that falls inside the period, its period end otherwise
+func periodBoundary(subscription *models.Subscription) time.Time {
+	trialEnd := subscription.TrialEndAt
+	if trialEnd != nil && trialEnd.After(subscription.CurrentPeriodStart) && trialEnd.Before(subscription.CurrentPeriodEnd) {
+		return *trialEnd
+	}
+	return subscription.CurrentPeriodEnd
+}
+
+// billedPeriod reports whether the subscription's current period is billed,
+// i.e. it does not start inside the trial
+func billedPeriod(subscription *models.Subscription) bool {
+	return subscription.TrialEndAt == nil || !subscription.TrialEndAt.After(subscription.CurrentPeriodStart)
+}
+
+// addBillingCycle returns the end of a billing period starting at t. A
+// period starting on a day the next month lacks ends on that month's last
+// day, e.g. January 31 is followed by February 28.
+func addBillingCycle(t time.Time, billingCycle string) time.Time {
+	return addMonths(t, cycleMonths(billingCycle))
+}
+
+// billingPeriodEnd returns the end of the period starting at start, counted
+// in whole cycles from anchor rather than from start, so a subscription
+// anchored on January 31 renews on February 28 and then on March 31 again
+func billingPeriodEnd(anchor, start time.Time, billingCycle string) time.Time {
+	if anchor.IsZero() || anchor.After(start) {
+		return addBillingCycle(start, billingCycle)
+	}
+
+	months := cycleMonths(billingCycle)
+	elapsed := (start.Year()-anchor.Year())*12 + int(start.Month()) - int(anchor.Month())
+	cycles := elapsed / months
+	end := addMonths(anchor, cycles*months)
+	for !end.After(start) {
+		cycles++
+		end = addMonths(anchor, cycles*months)
+	}
+	return end
+}
+
+func cycleMonths(billingCycle string) int {
+	if billingCycle == models.BillingCycleYearly {
+		return 12
+	}
+	return 1
+}
+
+// addMonths adds months to t, clamping to the last day of a month that lacks
+// t's day
+func addMonths(t time.Time, months int) time.Time {
+	end := t.AddDate(0, months, 0)
+	if end.Day() != t.Day() {
+		end = end.AddDate(0, 0, -end.Day())
+	}
+	return end
+}
+
+// prorate returns the part of amount that covers from to the end of the
+// period between start and end
+func prorate(amount float64, from, start, end time.Time) float64 {
+	period := end.Sub(start)
+	remaining := end.Sub(from)
+	if period <= 0 || remaining <= 0 {
+		return 0
+	}
+	if remaining > period {
+		remaining = period
+	}
+	return models.RoundAmount(amount * float64(remaining) / float64(period))
+}
+
+func periodLine(subscription *models.Subscription) models.InvoiceLine {
+	plan := subscription.Plan
+	return models.InvoiceLine{
+		Kind:        models.InvoiceLineSubscription,
+		Description: fmt.Sprintf("%s (%s)", plan.Name, plan.BillingCycle),
+		PlanID:      &plan.ID,
+		Amount:      plan.Price,
+		PeriodStart: subscription.CurrentPeriodStart,
+		PeriodEnd:   subscription.CurrentPeriodEnd,
+	}
+}
+
+// appendLine appends a line unless it is for nothing
+func appendLine(lines []models.InvoiceLine, line models.InvoiceLine) []models.InvoiceLine {
+	if line.Amount == 0 {
+		return lines
+	}
+	return append(lines, line)
+}
+
+func newPeriodInvoice(subscription *models.Subscription, reason string, issuedAt time.Time) *models.Invoice {
+	return newInvoice(subscription, reason, issuedAt, subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd,
+		[]models.InvoiceLine{periodLine(subscription)})
+}
+
+func newInvoice(subscription *models.Subscription, reason string, issuedAt, periodStart, periodEnd time.Time, lines []models.InvoiceLine) *models.Invoice {
+	var subtotal float64
+	for _, line := range lines {
+		subtotal += line.Amount
+	}
+
+	invoice := &models.Invoice{
+		TenantID:       subscription.TenantID,
+		SubscriptionID: subscription.ID,
+		Reason:         reason,
+		Currency:       subscription.Plan.Currency,
+		Lines:          lines,
+		Subtotal:       models.RoundAmount(subtotal),
+		PeriodStart:    periodStart,
+		PeriodEnd:      periodEnd,
+		IssuedAt:       issuedAt,
+		DueAt:          issuedAt.Add(invoiceDueAfter),
+	}
+	// The repository applies the credit balance when it issues the invoice
+	invoice.ApplyCredit(0)
+	return invoice
+}
+
+// BillingWorker runs the billing engine on a schedule
+type BillingWorker struct {
+	billingService BillingService
+}
+
+func NewBillingWorker(billingService BillingService) *BillingWorker {
+	return &BillingWorker{billingService: billingService}
+}
+
+// Run bills subscriptions every billingInterval until ctx is cancelled
+func (w *BillingWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(billingInterval)
+	defer ticker.Stop()
+
+	for {
+		run, err := w.billingService.RunBilling(ctx)
+		if err != nil {
+			log.Printf("Billing run: %v", err)
+		}
+		if run != nil && run.Subscriptions > 0 {
+			log.Printf("Billing run: %d subscription(s), %d invoiced, %d past due, %d reactivated, %d cancelled, %d expired, %d failed",
+				run.Subscriptions, run.Invoiced, run.PastDue, run.Reactivated, run.Cancelled, run.Expired, run.Failed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type billingFixture struct {
+	service       *billingService
+	dunning       *dunningService
+	metering      *meteringService
+	billing       *fakeBillingRepository
+	subscriptions *fakeSubscriptionRepository
+	tenants       *fakeTenantRepository
+	cases         *fakeDunningRepository
+	usage         *fakeMeteringRepository
+	collector     *fakePaymentCollector
+	auth          *fakeAuthClient
+	basic         *models.Plan
+	pro           *models.Plan
+	yearly        *models.Plan
+	now           time.Time
+}
+
+func newBillingFixture() *billingFixture {
+	f := &billingFixture{
+		subscriptions: &fakeSubscriptionRepository{subscriptions: map[uuid.UUID]*models.Subscription{}},
+		tenants:       &fakeTenantRepository{tenants: map[uuid.UUID]*models.Tenant{}},
+		cases:         &fakeDunningRepository{cases: map[uuid.UUID]*models.DunningCase{}, locks: map[uuid.UUID]time.Time{}},
+		usage:         newFakeMeteringRepository(),
+		collector:     &fakePaymentCollector{result: &models.ChargeResult{Message: "card declined"}},
+		auth:          &fakeAuthClient{users: map[uuid.UUID]uuid.UUID{}},
+		basic:         &models.Plan{ID: uuid.New(), Name: "Basic", Price: 49, Currency: "USD", BillingCycle: models.BillingCycleMonthly, IsActive: true},
+		pro:           &models.Plan{ID: uuid.New(), Name: "Pro", Price: 99, Currency: "USD", BillingCycle: models.BillingCycleMonthly, IsActive: true},
+		yearly:        &models.Plan{ID: uuid.New(), Name: "Pro yearly", Price: 990, Currency: "USD", BillingCycle: models.BillingCycleYearly, IsActive: true},
+		now:           time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+	f.billing = &fakeBillingRepository{subscriptions: f.subscriptions}
+	plans := &fakePlanRepository{plans: map[uuid.UUID]*models.Plan{
+		f.basic.ID:  f.basic,
+		f.pro.ID:    f.pro,
+		f.yearly.ID: f.yearly,
+	}}
+	f.billing.plans = plans
+
+	tenantService := NewTenantService(f.tenants, f.subscriptions, plans, nil)
+	policy := models.DunningPolicy{RetryDays: []int{1, 3, 7}, GraceDays: 10}
+	dunning := NewDunningService(f.cases, f.billing, tenantService, f.collector, f.auth, policy).(*dunningService)
+	dunning.now = func() time.Time { return f.now }
+	f.dunning = dunning
+
+	metering := NewMeteringService(f.usage, f.subscriptions, plans).(*meteringService)
+	metering.now = func() time.Time { return f.now }
+	f.metering = metering
+
+	service := NewBillingService(f.billing, f.subscriptions, plans, f.tenants, dunning, metering).(*billingService)
+	service.now = func() time.Time { return f.now }
+	f.service = service
+	return f
+}
+
+// subscribe creates a tenant subscribed to plan from now, with a trial of
+// trialDays if it is not zero
+func (f *billingFixture) subscribe(plan *models.Plan, trialDays int) *models.Subscription {
+	tenant := &models.Tenant{Name: "Acme", Subdomain: "acme", Status: models.TenantStatusTrial}
+	_ = f.tenants.Create(context.Background(), tenant)
+
+	subscription := &models.Subscription{
+		TenantID:           tenant.ID,
+		PlanID:             plan.ID,
+		Status:             models.SubscriptionStatusActive,
+		CurrentPeriodStart: f.now,
+		CurrentPeriodEnd:   addBillingCycle(f.now, plan.BillingCycle),
+		BillingAnchor:      f.now,
+	}
+	if trialDays > 0 {
+		trialEnd := f.now.AddDate(0, 0, trialDays)
+		subscription.TrialEndAt = &trialEnd
+		subscription.CurrentPeriodEnd = trialEnd
+		subscription.BillingAnchor = trialEnd
+	}
+	_ = f.subscriptions.Create(context.Background(), subscription)
+	return subscription
+}
+
+func (f *billingFixture) run(t *testing.T) *models.BillingRun {
+	t.Helper()
+	run, err := f.service.RunBilling(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, run.Failed)
+	return run
+}
+
+func TestRunBillingConvertsTrialToPaid(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 14)
+
+	f.now = f.now.AddDate(0, 0, 10)
+	f.run(t)
+	assert.Empty(t, f.billing.invoices, "a trial is not billed")
+
+	f.now = f.now.AddDate(0, 0, 5)
+	run := f.run(t)
+	assert.Equal(t, 1, run.Invoiced)
+
+	require.Len(t, f.billing.invoices, 1)
+	invoice := f.billing.invoices[0]
+	trialEnd := time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, models.InvoiceReasonTrialConversion, invoice.Reason)
+	assert.Equal(t, 49.0, invoice.Total)
+	assert.Equal(t, models.InvoiceStatusOpen, invoice.Status)
+	assert.Equal(t, trialEnd, invoice.PeriodStart)
+	assert.Equal(t, trialEnd.AddDate(0, 1, 0), invoice.PeriodEnd)
+	assert.Equal(t, trialEnd, subscription.CurrentPeriodStart)
+	assert.Equal(t, models.TenantStatusActive, f.tenants.tenants[subscription.TenantID].Status)
+}
+
+func TestRunBillingRenewsAndHonorsCancelAtPeriodEnd(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 0)
+
+	f.run(t)
+	require.Len(t, f.billing.invoices, 1)
+	assert.Equal(t, models.InvoiceReasonSubscriptionCreate, f.billing.invoices[0].Reason)
+	f.pay(t, f.billing.invoices[0])
+
+	f.now = time.Date(2026, 5, 1, 1, 0, 0, 0, time.UTC)
+	f.run(t)
+	require.Len(t, f.billing.invoices, 2)
+	assert.Equal(t, models.InvoiceReasonSubscriptionCycle, f.billing.invoices[1].Reason)
+	assert.Equal(t, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), subscription.CurrentPeriodEnd)
+	f.pay(t, f.billing.invoices[1])
+
+	subscription.CancelAtPeriodEnd = true
+	f.now = time.Date(2026, 5, 20, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	assert.Equal(t, models.SubscriptionStatusActive, subscription.Status, "cancellation waits for the period end")
+
+	f.now = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	run := f.run(t)
+	assert.Equal(t, 1, run.Cancelled)
+	assert.Equal(t, models.SubscriptionStatusCancelled, subscription.Status)
+	assert.Len(t, f.billing.invoices, 2, "a cancelled subscription is not renewed")
+}
+
+func TestRunBillingMovesUnpaidSubscriptionsToPastDueAndExpired(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 0)
+
+	f.run(t)
+	require.Len(t, f.billing.invoices, 1)
+
+	f.now = f.now.AddDate(0, 0, 8)
+	run := f.run(t)
+	assert.Equal(t, 1, run.PastDue)
+	assert.Equal(t, models.SubscriptionStatusPastDue, subscription.Status)
+
+	// Paying reactivates the subscription straight away
+	f.pay(t, f.billing.invoices[0])
+	assert.Equal(t, models.SubscriptionStatusActive, subscription.Status)
+
+	// The next period is never paid
+	f.now = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	require.Len(t, f.billing.invoices, 2)
+
+	f.now = time.Date(2026, 5, 9, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	assert.Equal(t, models.SubscriptionStatusPastDue, subscription.Status)
+
+	f.now = time.Date(2026, 5, 22, 0, 0, 0, 0, time.UTC)
+	run = f.run(t)
+	assert.Equal(t, 1, run.Expired)
+	assert.Equal(t, models.SubscriptionStatusExpired, subscription.Status)
+}
+
+func TestChangePlanProratesUpgradeMidCycle(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 0)
+	f.run(t)
+
+	// Halfway through April's 30 days
+	f.now = time.Date(2026, 4, 16, 0, 0, 0, 0, time.UTC)
+	change, err := f.service.ChangePlan(context.Background(), subscription.TenantID, &models.ChangePlanRequest{PlanID: f.pro.ID.String()})
+	require.NoError(t, err)
+
+	require.NotNil(t, change.Invoice)
+	require.Len(t, change.Invoice.Lines, 2)
+	assert.Equal(t, -24.5, change.Invoice.Lines[0].Amount)
+	assert.Equal(t, 49.5, change.Invoice.Lines[1].Amount)
+	assert.Equal(t, 25.0, change.Invoice.Total)
+	assert.Equal(t, models.InvoiceReasonPlanChange, change.Invoice.Reason)
+	assert.Equal(t, f.pro.ID, subscription.PlanID)
+	assert.Equal(t, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), subscription.CurrentPeriodEnd, "the period is unchanged")
+}
+
+func TestChangePlanBillsAPeriodNobodyInvoicedOnce(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 0)
+
+	// Before the engine invoiced April, halfway through its 30 days
+	f.now = time.Date(2026, 4, 16, 0, 0, 0, 0, time.UTC)
+	change, err := f.service.ChangePlan(context.Background(), subscription.TenantID, &models.ChangePlanRequest{PlanID: f.pro.ID.String()})
+	require.NoError(t, err)
+
+	require.NotNil(t, change.Invoice)
+	require.Len(t, change.Invoice.Lines, 2)
+	assert.Equal(t, 24.5, change.Invoice.Lines[0].Amount, "the time used on Basic")
+	assert.Equal(t, 49.5, change.Invoice.Lines[1].Amount, "the rest of the period on Pro")
+	assert.Equal(t, 74.0, change.Invoice.Total)
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), change.Invoice.PeriodStart)
+
+	// The engine finds the period invoiced
+	run := f.run(t)
+	assert.Zero(t, run.Invoiced)
+	assert.Len(t, f.billing.invoices, 1)
+
+	f.now = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	require.Len(t, f.billing.invoices, 2)
+	assert.Equal(t, 99.0, f.billing.invoices[1].Total)
+}
+
+func TestChangePlanDowngradeCreditsTheNextInvoice(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.pro, 0)
+	f.run(t)
+	f.pay(t, f.billing.invoices[0])
+
+	f.now = time.Date(2026, 4, 16, 0, 0, 0, 0, time.UTC)
+	change, err := f.service.ChangePlan(context.Background(), subscription.TenantID, &models.ChangePlanRequest{PlanID: f.basic.ID.String()})
+	require.NoError(t, err)
+	assert.Equal(t, -25.0, change.Invoice.Subtotal)
+	assert.Equal(t, 0.0, change.Invoice.Total)
+	assert.Equal(t, models.InvoiceStatusPaid, change.Invoice.Status)
+
+	f.now = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	renewal := f.billing.invoices[len(f.billing.invoices)-1]
+	assert.Equal(t, 49.0, renewal.Subtotal)
+	assert.Equal(t, 25.0, renewal.CreditApplied)
+	assert.Equal(t, 24.0, renewal.Total)
+}
+
+func TestChangePlanToAnotherBillingCycleStartsANewPeriod(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 0)
+	f.run(t)
+
+	f.now = time.Date(2026, 4, 16, 0, 0, 0, 0, time.UTC)
+	change, err := f.service.ChangePlan(context.Background(), subscription.TenantID, &models.ChangePlanRequest{PlanID: f.yearly.ID.String()})
+	require.NoError(t, err)
+
+	assert.Equal(t, 965.5, change.Invoice.Total)
+	assert.Equal(t, f.now, subscription.CurrentPeriodStart)
+	assert.Equal(t, f.now.AddDate(1, 0, 0), subscription.CurrentPeriodEnd)
+
+	// The new period is already invoiced
+	run := f.run(t)
+	assert.Zero(t, run.Invoiced)
+}
+
+func TestChangePlanDuringTrialIsNotProrated(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 14)
+
+	f.now = f.now.AddDate(0, 0, 3)
+	change, err := f.service.ChangePlan(context.Background(), subscription.TenantID, &models.ChangePlanRequest{PlanID: f.pro.ID.String()})
+	require.NoError(t, err)
+	assert.Nil(t, change.Invoice)
+
+	f.now = f.now.AddDate(0, 0, 11)
+	f.run(t)
+	require.Len(t, f.billing.invoices, 1)
+	assert.Equal(t, 99.0, f.billing.invoices[0].Total, "the plan at the end of the trial is billed")
+}
+
+func TestAddBillingCycleClampsToMonthEnd(t *testing.T) {
+	start := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC), addBillingCycle(start, models.BillingCycleMonthly))
+	assert.Equal(t, time.Date(2027, 1, 31, 12, 0, 0, 0, time.UTC), addBillingCycle(start, models.BillingCycleYearly))
+
+	leapDay := time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2029, 2, 28, 0, 0, 0, 0, time.UTC), addBillingCycle(leapDay, models.BillingCycleYearly))
+}
+
+func TestRenewalsKeepTheBillingAnchorDay(t *testing.T) {
+	f := newBillingFixture()
+	f.now = time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	subscription := f.subscribe(f.basic, 0)
+	f.run(t)
+	f.pay(t, f.billing.invoices[0])
+	assert.Equal(t, time.Date(2026, 2, 28, 12, 0, 0, 0, time.UTC), subscription.CurrentPeriodEnd)
+
+	// A period shortened by February does not shorten the ones after it
+	for _, end := range []time.Time{
+		time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 4, 30, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 5, 31, 12, 0, 0, 0, time.UTC),
+	} {
+		f.now = subscription.CurrentPeriodEnd.Add(time.Hour)
+		f.run(t)
+		f.pay(t, f.billing.invoices[len(f.billing.invoices)-1])
+		assert.Equal(t, end, subscription.CurrentPeriodEnd)
+	}
+	assert.Len(t, f.billing.invoices, 4)
+}
+
+func (f *billingFixture) pay(t *testing.T, invoice *models.Invoice) {
+	t.Helper()
+	_, err := f.service.PayInvoice(context.Background(), invoice.ID, &models.PayInvoiceRequest{PaymentMethod: "card"})
+	require.NoError(t, err)
+}
+
+// fakeBillingRepository keeps invoices in memory and changes the
+// subscriptions of a fakeSubscriptionRepository in place
+type fakeBillingRepository struct {
+	subscriptions *fakeSubscriptionRepository
+	plans         *fakePlanRepository
+	invoices      []*models.Invoice
+}
+
+func (r *fakeBillingRepository) ListBillable(ctx context.Context, at time.Time, after uuid.UUID, limit int) ([]*models.Subscription, error) {
+	if after != uuid.Nil {
+		return nil, nil
+	}
+
+	var subscriptions []*models.Subscription
+	for _, subscription := range r.subscriptions.subscriptions {
+		if subscription.Status != models.SubscriptionStatusActive && subscription.Status != models.SubscriptionStatusPastDue {
+			continue
+		}
+		subscription.Plan = r.plans.plans[subscription.PlanID]
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+func (r *fakeBillingRepository) HasPeriodInvoice(ctx context.Context, subscriptionID uuid.UUID, periodStart time.Time) (bool, error) {
+	for _, invoice := range r.invoices {
+		if invoice.SubscriptionID == subscriptionID && invoice.PeriodStart.Equal(periodStart) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeBillingRepository) IssueInvoice(ctx context.Context, invoice *models.Invoice) error {
+	r.insert(invoice)
+	return nil
+}
+
+func (r *fakeBillingRepository) Renew(ctx context.Context, subscription *models.Subscription, previousStart time.Time, invoice *models.Invoice) error {
+	if invoice != nil {
+		r.insert(invoice)
+	}
+	return nil
+}
+
+func (r *fakeBillingRepository) ChangePlan(ctx context.Context, subscription *models.Subscription, previousPlanID uuid.UUID, previousStart time.Time, invoice *models.Invoice) error {
+	if invoice != nil {
+		r.insert(invoice)
+	}
+	return nil
+}
+
+func (r *fakeBillingRepository) Cancel(ctx context.Context, subscription *models.Subscription, invoice *models.Invoice) error {
+	if err := r.UpdateStatus(ctx, subscription.ID, models.SubscriptionStatusActive, models.SubscriptionStatusCancelled); err != nil {
+		return err
+	}
+	if invoice != nil {
+		r.insert(invoice)
+	}
+	return nil
+}
+
+func (r *fakeBillingRepository) UpdateStatus(ctx context.Context, subscriptionID uuid.UUID, from, to string) error {
+	subscription := r.subscriptions.subscriptions[subscriptionID]
+	if subscription.Status != from {
+		return repositories.ErrSubscriptionChanged
+	}
+	subscription.Status = to
+	return nil
+}
+
+func (r *fakeBillingRepository) OldestOverdueInvoice(ctx context.Context, subscriptionID uuid.UUID, at time.Time) (*models.Invoice, error) {
+	for _, invoice := range r.invoices {
+		if invoice.SubscriptionID == subscriptionID && invoice.Status == models.InvoiceStatusOpen && !invoice.DueAt.After(at) {
+			return invoice, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeBillingRepository) ListInvoices(ctx context.Context, tenantID uuid.UUID, limit, offset int) ([]*models.Invoice, int, error) {
+	return r.invoices, len(r.invoices), nil
+}
+
+func (r *fakeBillingRepository) GetInvoice(ctx context.Context, id uuid.UUID) (*models.Invoice, error) {
+	for _, invoice := range r.invoices {
+		if invoice.ID == id {
+			return invoice, nil
+		}
+	}
+	return nil, fmt.Errorf("invoice not found")
+}
+
+func (r *fakeBillingRepository) PayInvoice(ctx context.Context, invoice *models.Invoice, paidAt time.Time, req *models.PayInvoiceRequest) error {
+	if invoice.Status != models.InvoiceStatusOpen {
+		return fmt.Errorf("invoice is not open")
+	}
+	invoice.Status = models.InvoiceStatusPaid
+	invoice.PaidAt = &paidAt
+	return nil
+}
+
+func (r *fakeBillingRepository) insert(invoice *models.Invoice) {
+	var balance float64
+	for _, issued := range r.invoices {
+		if issued.SubscriptionID == invoice.SubscriptionID {
+			balance += issued.Credit() - issued.CreditApplied
+		}
+	}
+	invoice.ApplyCredit(balance)
+
+	invoice.ID = uuid.New()
+	invoice.Number = fmt.Sprintf("INV-%06d", len(r.invoices)+1)
+	r.invoices = append(r.invoices, invoice)
+}
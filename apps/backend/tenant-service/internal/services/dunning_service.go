@@ -0,0 +1,444 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+const (
+	dunningInterval  = 15 * time.Minute
+	dunningBatchSize = 100
+	// dunningLease is how long a worker holds the case it processes; a case
+	// whose worker died is picked up again after it
+	dunningLease = 5 * time.Minute
+)
+
+// Notices auth-service emails to a tenant's admins during dunning
+const (
+	notificationPaymentFailed     = "payment_failed"
+	notificationTenantSuspended   = "tenant_suspended"
+	notificationTenantReactivated = "tenant_reactivated"
+)
+
+// DunningService collects unpaid invoices. A case starts when a payment
+// fails or an invoice becomes overdue; the payment is then retried on the
+// policy's schedule and the tenant's admins are reminded after every failed
+// attempt. Once the grace period is over the tenant is suspended, which
+// makes it read-only, and paying the invoice reactivates it.
+type DunningService interface {
+	// Start opens a case for an unpaid invoice, or returns the one already
+	// collecting it
+	Start(ctx context.Context, invoice *models.Invoice, reason string) (*models.DunningCase, error)
+	// RecordPaymentFailure records a failed payment of an open invoice
+	// reported from outside the retries, e.g. by the payment provider
+	RecordPaymentFailure(ctx context.Context, invoiceID uuid.UUID, req *models.PaymentFailedRequest) (*models.DunningCase, error)
+	// Resolve ends the case collecting a paid or voided invoice and
+	// reactivates the tenant if the case suspended it
+	Resolve(ctx context.Context, invoice *models.Invoice) error
+	// ProcessDue retries the payments due and suspends the tenants whose
+	// grace period is over
+	ProcessDue(ctx context.Context) (*models.DunningRun, error)
+	ListCases(ctx context.Context, tenantID uuid.UUID) ([]*models.DunningCase, error)
+}
+
+type dunningService struct {
+	dunningRepo   repositories.DunningRepository
+	billingRepo   repositories.BillingRepository
+	tenantService TenantService
+	collector     PaymentCollector
+	authClient    AuthClient
+	policy        models.DunningPolicy
+	now           func() time.Time
+}
+
+func NewDunningService(
+	dunningRepo repositories.DunningRepository,
+	billingRepo repositories.BillingRepository,
+	tenantService TenantService,
+	collector PaymentCollector,
+	authClient AuthClient,
+	policy models.DunningPolicy,
+) DunningService {
+	return &dunningService{
+		dunningRepo:   dunningRepo,
+		billingRepo:   billingRepo,
+		tenantService: tenantService,
+		collector:     collector,
+		authClient:    authClient,
+		policy:        policy,
+		now:           time.Now,
+	}
+}
+
+// ParseDunningPolicy reads DUNNING_RETRY_DAYS, increasing days after the
+// failure separated by commas, and DUNNING_GRACE_DAYS
+func ParseDunningPolicy(retryDays string, graceDays int) (models.DunningPolicy, error) {
+	policy := models.DunningPolicy{GraceDays: graceDays}
+	for _, field := range strings.Split(retryDays, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		days, err := strconv.Atoi(field)
+		if err != nil || days < 1 {
+			return policy, fmt.Errorf("invalid dunning retry day %q", field)
+		}
+		if n := len(policy.RetryDays); n > 0 && days <= policy.RetryDays[n-1] {
+			return policy, fmt.Errorf("dunning retry days must increase")
+		}
+		policy.RetryDays = append(policy.RetryDays, days)
+	}
+	if graceDays < 1 {
+		return policy, fmt.Errorf("dunning grace period must be at least one day")
+	}
+	return policy, nil
+}
+
+func (s *dunningService) Start(ctx context.Context, invoice *models.Invoice, reason string) (*models.DunningCase, error) {
+	existing, err := s.dunningRepo.GetActiveByInvoice(ctx, invoice.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dunning case: %w", err)
+	}
+	if existing != nil {
+		return existing, nil
+	}
+
+	now := s.now()
+	dunningCase := &models.DunningCase{
+		TenantID:       invoice.TenantID,
+		SubscriptionID: invoice.SubscriptionID,
+		InvoiceID:      invoice.ID,
+		Status:         models.DunningStatusOpen,
+		LastError:      &reason,
+		StartedAt:      now,
+		GraceEndsAt:    now.AddDate(0, 0, s.policy.GraceDays),
+	}
+	dunningCase.NextAttemptAt = s.nextAttempt(dunningCase, now)
+
+	created, err := s.dunningRepo.Create(ctx, dunningCase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dunning case: %w", err)
+	}
+	if !created {
+		// Another request started collecting the invoice first
+		return s.dunningRepo.GetActiveByInvoice(ctx, invoice.ID)
+	}
+
+	s.remind(ctx, dunningCase, invoice, notificationPaymentFailed)
+	return dunningCase, nil
+}
+
+func (s *dunningService) RecordPaymentFailure(ctx context.Context, invoiceID uuid.UUID, req *models.PaymentFailedRequest) (*models.DunningCase, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+
+	invoice, err := s.billingRepo.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status != models.InvoiceStatusOpen {
+		return nil, fmt.Errorf("invoice is not open")
+	}
+
+	dunningCase, err := s.dunningRepo.GetActiveByInvoice(ctx, invoice.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dunning case: %w", err)
+	}
+	if dunningCase == nil {
+		return s.Start(ctx, invoice, reason)
+	}
+
+	// The case keeps its schedule; the failure is only recorded
+	now := s.now()
+	dunningCase.LastAttemptAt = &now
+	dunningCase.LastError = &reason
+	if err := s.dunningRepo.Update(ctx, dunningCase, dunningCase.Status); err != nil {
+		if errors.Is(err, repositories.ErrDunningCaseChanged) {
+			return nil, fmt.Errorf("dunning case changed while recording the failure, try again")
+		}
+		return nil, fmt.Errorf("failed to update dunning case: %w", err)
+	}
+	return dunningCase, nil
+}
+
+func (s *dunningService) Resolve(ctx context.Context, invoice *models.Invoice) error {
+	if invoice.Status == models.InvoiceStatusOpen {
+		return nil
+	}
+
+	dunningCase, err := s.dunningRepo.GetActiveByInvoice(ctx, invoice.ID)
+	if err != nil || dunningCase == nil {
+		return err
+	}
+	return s.resolve(ctx, dunningCase, invoice)
+}
+
+func (s *dunningService) ProcessDue(ctx context.Context) (*models.DunningRun, error) {
+	now := s.now()
+	run := &models.DunningRun{RanAt: now}
+
+	for run.Cases < dunningBatchSize && ctx.Err() == nil {
+		dunningCase, err := s.dunningRepo.ClaimDue(ctx, now, now.Add(dunningLease))
+		if err != nil {
+			return run, fmt.Errorf("failed to claim dunning case: %w", err)
+		}
+		if dunningCase == nil {
+			break
+		}
+
+		run.Cases++
+		err = s.process(ctx, dunningCase, now, run)
+		if err != nil && !errors.Is(err, repositories.ErrDunningCaseChanged) {
+			run.Failed++
+			log.Printf("Dunning case %s: %v", dunningCase.ID, err)
+		}
+	}
+
+	return run, ctx.Err()
+}
+
+func (s *dunningService) ListCases(ctx context.Context, tenantID uuid.UUID) ([]*models.DunningCase, error) {
+	return s.dunningRepo.ListByTenant(ctx, tenantID)
+}
+
+// process retries the case's payment if a retry is due, then suspends the
+// tenant if the grace period is over
+func (s *dunningService) process(ctx context.Context, dunningCase *models.DunningCase, now time.Time, run *models.DunningRun) error {
+	invoice, err := s.billingRepo.GetInvoice(ctx, dunningCase.InvoiceID)
+	if err != nil {
+		return err
+	}
+	if invoice.Status != models.InvoiceStatusOpen {
+		// Paid or voided without going through Resolve
+		return s.resolve(ctx, dunningCase, invoice)
+	}
+
+	from := dunningCase.Status
+	retried := false
+	if dunningCase.NextAttemptAt != nil && !dunningCase.NextAttemptAt.After(now) {
+		retried = true
+		run.Retried++
+		paid, err := s.retry(ctx, dunningCase, invoice, now)
+		if err != nil {
+			return err
+		}
+		if paid {
+			run.Recovered++
+			return s.resolve(ctx, dunningCase, invoice)
+		}
+	}
+
+	suspend := dunningCase.Status == models.DunningStatusOpen && !dunningCase.GraceEndsAt.After(now)
+	if suspend {
+		if err := s.tenantService.SuspendTenant(ctx, dunningCase.TenantID); err != nil {
+			return fmt.Errorf("failed to suspend tenant: %w", err)
+		}
+		dunningCase.Status = models.DunningStatusSuspended
+		dunningCase.SuspendedAt = &now
+	}
+
+	if err := s.dunningRepo.Update(ctx, dunningCase, from); err != nil {
+		if suspend && errors.Is(err, repositories.ErrDunningCaseChanged) {
+			// The invoice was paid while the tenant was being suspended
+			s.reactivateTenant(ctx, dunningCase, invoice)
+		}
+		return err
+	}
+
+	switch {
+	case suspend:
+		run.Suspended++
+		s.remind(ctx, dunningCase, invoice, notificationTenantSuspended)
+	case retried && dunningCase.Status == models.DunningStatusOpen:
+		s.remind(ctx, dunningCase, invoice, notificationPaymentFailed)
+	}
+	return nil
+}
+
+// retry charges the invoice and records the payment if it succeeds. A
+// declined charge is recorded on the case and moves it to its next attempt.
+func (s *dunningService) retry(ctx context.Context, dunningCase *models.DunningCase, invoice *models.Invoice, now time.Time) (bool, error) {
+	dunningCase.Attempts++
+	dunningCase.LastAttemptAt = &now
+	dunningCase.NextAttemptAt = s.nextAttempt(dunningCase, now)
+
+	result, err := s.collector.Charge(ctx, invoice)
+	var reason string
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case !result.Succeeded:
+		reason = result.Message
+		if reason == "" {
+			reason = "payment declined"
+		}
+	default:
+		payment := &models.PayInvoiceRequest{PaymentMethod: result.PaymentMethod}
+		if payment.PaymentMethod == "" {
+			payment.PaymentMethod = "automatic"
+		}
+		if result.TransactionID != "" {
+			payment.ExternalPaymentID = &result.TransactionID
+		}
+		if err := s.billingRepo.PayInvoice(ctx, invoice, now, payment); err != nil {
+			// An invoice paid meanwhile is resolved when the case is next claimed
+			return false, fmt.Errorf("failed to record payment: %w", err)
+		}
+		return true, nil
+	}
+
+	dunningCase.LastError = &reason
+	return false, nil
+}
+
+// resolve ends the case for its paid or voided invoice
+func (s *dunningService) resolve(ctx context.Context, dunningCase *models.DunningCase, invoice *models.Invoice) error {
+	from := dunningCase.Status
+	now := s.now()
+
+	dunningCase.Status = models.DunningStatusRecovered
+	if invoice.Status == models.InvoiceStatusVoid {
+		dunningCase.Status = models.DunningStatusClosed
+	}
+	dunningCase.NextAttemptAt = nil
+	dunningCase.ResolvedAt = &now
+
+	if err := s.dunningRepo.Update(ctx, dunningCase, from); err != nil {
+		if !errors.Is(err, repositories.ErrDunningCaseChanged) {
+			return fmt.Errorf("failed to resolve dunning case: %w", err)
+		}
+		// The worker suspended the tenant meanwhile, or the case is
+		// already resolved
+		current, err := s.dunningRepo.GetActiveByInvoice(ctx, invoice.ID)
+		if err != nil || current == nil {
+			return err
+		}
+		return s.resolve(ctx, current, invoice)
+	}
+
+	if from == models.DunningStatusSuspended {
+		s.reactivateTenant(ctx, dunningCase, invoice)
+	}
+	return nil
+}
+
+// reactivateTenant gives a suspended tenant its full access back once no
+// other case keeps it suspended. The invoice is already paid, so a failure
+// is only logged.
+func (s *dunningService) reactivateTenant(ctx context.Context, dunningCase *models.DunningCase, invoice *models.Invoice) {
+	suspended, err := s.dunningRepo.CountSuspended(ctx, dunningCase.TenantID)
+	if err != nil {
+		log.Printf("Dunning: failed to count suspended cases of tenant %s: %v", dunningCase.TenantID, err)
+		return
+	}
+	if suspended > 0 {
+		return
+	}
+
+	tenant, err := s.tenantService.GetTenant(ctx, dunningCase.TenantID)
+	if err != nil {
+		log.Printf("Dunning: failed to load tenant %s: %v", dunningCase.TenantID, err)
+		return
+	}
+	if tenant.Status != models.TenantStatusSuspended {
+		return
+	}
+
+	if err := s.tenantService.ActivateTenant(ctx, dunningCase.TenantID); err != nil {
+		log.Printf("Dunning: failed to reactivate tenant %s: %v", dunningCase.TenantID, err)
+		return
+	}
+	s.notify(ctx, dunningCase, invoice, notificationTenantReactivated)
+}
+
+// nextAttempt returns the first retry on the policy's schedule after the
+// given time, or nil once the schedule is exhausted
+func (s *dunningService) nextAttempt(dunningCase *models.DunningCase, after time.Time) *time.Time {
+	for _, days := range s.policy.RetryDays {
+		attempt := dunningCase.StartedAt.AddDate(0, 0, days)
+		if attempt.After(after) {
+			return &attempt
+		}
+	}
+	return nil
+}
+
+// remind notifies the tenant's admins and counts the reminder on the case
+func (s *dunningService) remind(ctx context.Context, dunningCase *models.DunningCase, invoice *models.Invoice, template string) {
+	if !s.notify(ctx, dunningCase, invoice, template) {
+		return
+	}
+
+	dunningCase.RemindersSent++
+	if err := s.dunningRepo.Update(ctx, dunningCase, dunningCase.Status); err != nil {
+		log.Printf("Dunning: failed to count reminder of case %s: %v", dunningCase.ID, err)
+	}
+}
+
+// notify emails the tenant's admins about the case. Dunning goes on without
+// the email, so a failure is only logged.
+func (s *dunningService) notify(ctx context.Context, dunningCase *models.DunningCase, invoice *models.Invoice, template string) bool {
+	params := map[string]string{
+		"invoice":      invoice.Number,
+		"amount":       fmt.Sprintf("%.2f %s", invoice.Total, invoice.Currency),
+		"suspend_date": dunningCase.GraceEndsAt.Format("January 2, 2006"),
+	}
+	if dunningCase.LastError != nil {
+		params["reason"] = *dunningCase.LastError
+	}
+
+	err := s.authClient.NotifyTenantAdmins(ctx, dunningCase.TenantID, &models.TenantNotification{
+		Template: template,
+		Params:   params,
+	})
+	if err != nil {
+		log.Printf("Dunning: failed to send %s notice for case %s: %v", template, dunningCase.ID, err)
+		return false
+	}
+	return true
+}
+
+// DunningWorker processes dunning cases on a schedule
+type DunningWorker struct {
+	dunningService DunningService
+}
+
+func NewDunningWorker(dunningService DunningService) *DunningWorker {
+	return &DunningWorker{dunningService: dunningService}
+}
+
+// Run processes due dunning cases every dunningInterval until ctx is
+// cancelled
+func (w *DunningWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(dunningInterval)
+	defer ticker.Stop()
+
+	for {
+		run, err := w.dunningService.ProcessDue(ctx)
+		if err != nil {
+			log.Printf("Dunning run: %v", err)
+		}
+		if run != nil && run.Cases > 0 {
+			log.Printf("Dunning run: %d case(s), %d retried, %d recovered, %d suspended, %d failed",
+				run.Cases, run.Retried, run.Recovered, run.Suspended, run.Failed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
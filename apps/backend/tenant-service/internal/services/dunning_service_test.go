@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDunningRetriesThenSuspendsUntilPaid(t *testing.T) {
+	f := newBillingFixture()
+	subscription := f.subscribe(f.basic, 0)
+	f.run(t)
+	invoice := f.billing.invoices[0]
+
+	// The invoice becomes overdue on April 8
+	f.now = time.Date(2026, 4, 9, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	cases, err := f.dunning.ListCases(context.Background(), subscription.TenantID)
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+	dunningCase := cases[0]
+	assert.Equal(t, invoice.ID, dunningCase.InvoiceID)
+	assert.Equal(t, time.Date(2026, 4, 19, 0, 0, 0, 0, time.UTC), dunningCase.GraceEndsAt)
+	assert.Equal(t, []string{notificationPaymentFailed}, f.auth.notices)
+
+	assert.Zero(t, f.processDunning(t).Cases, "the first retry is a day later")
+
+	for _, day := range []int{10, 12, 16} {
+		f.now = time.Date(2026, 4, day, 0, 0, 0, 0, time.UTC)
+		run := f.processDunning(t)
+		assert.Equal(t, 1, run.Retried, "day %d", day)
+	}
+	assert.Equal(t, 3, f.collector.charges)
+	assert.Len(t, f.auth.notices, 4, "a reminder after every failed retry")
+	assert.Equal(t, models.TenantStatusTrial, f.tenants.tenants[subscription.TenantID].Status)
+
+	f.now = time.Date(2026, 4, 19, 0, 0, 0, 0, time.UTC)
+	run := f.processDunning(t)
+	assert.Equal(t, 1, run.Suspended)
+	assert.Zero(t, run.Retried, "the retry schedule is exhausted")
+	assert.Equal(t, models.TenantStatusSuspended, f.tenants.tenants[subscription.TenantID].Status)
+	assert.Equal(t, notificationTenantSuspended, f.auth.notices[len(f.auth.notices)-1])
+
+	// Billing the past due subscription again does not start another case
+	f.run(t)
+	cases, err = f.dunning.ListCases(context.Background(), subscription.TenantID)
+	require.NoError(t, err)
+	require.Len(t, cases, 1)
+	assert.Equal(t, models.DunningStatusSuspended, cases[0].Status)
+	assert.Equal(t, 5, cases[0].RemindersSent)
+
+	f.pay(t, invoice)
+	cases, err = f.dunning.ListCases(context.Background(), subscription.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, models.DunningStatusRecovered, cases[0].Status)
+	assert.Equal(t, models.TenantStatusActive, f.tenants.tenants[subscription.TenantID].Status)
+	assert.Equal(t, models.SubscriptionStatusActive, subscription.Status)
+	assert.Equal(t, notificationTenantReactivated, f.auth.notices[len(f.auth.notices)-1])
+}
+
+func TestDunningRetrySuccessReactivatesSuspendedTenant(t *testing.T) {
+	f := newBillingFixture()
+	f.dunning.policy = models.DunningPolicy{RetryDays: []int{1, 12}, GraceDays: 10}
+	subscription := f.subscribe(f.basic, 0)
+	f.run(t)
+	invoice := f.billing.invoices[0]
+
+	// The payment provider reports a failure before the invoice is due
+	f.now = time.Date(2026, 4, 3, 0, 0, 0, 0, time.UTC)
+	dunningCase, err := f.dunning.RecordPaymentFailure(context.Background(), invoice.ID, &models.PaymentFailedRequest{Reason: "insufficient funds"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 4, 4, 0, 0, 0, 0, time.UTC), *dunningCase.NextAttemptAt)
+
+	f.now = time.Date(2026, 4, 4, 0, 0, 0, 0, time.UTC)
+	f.processDunning(t)
+	f.now = time.Date(2026, 4, 13, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 1, f.processDunning(t).Suspended)
+	assert.Equal(t, models.TenantStatusSuspended, f.tenants.tenants[subscription.TenantID].Status)
+
+	// A suspended tenant's payment is still retried
+	f.collector.result = &models.ChargeResult{Succeeded: true, PaymentMethod: "card", TransactionID: "ch_123"}
+	f.now = time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC)
+	run := f.processDunning(t)
+	assert.Equal(t, 1, run.Recovered)
+	assert.Equal(t, models.InvoiceStatusPaid, invoice.Status)
+	assert.Equal(t, models.TenantStatusActive, f.tenants.tenants[subscription.TenantID].Status)
+	assert.Equal(t, []string{notificationPaymentFailed, notificationPaymentFailed, notificationTenantSuspended, notificationTenantReactivated}, f.auth.notices)
+
+	_, err = f.dunning.RecordPaymentFailure(context.Background(), invoice.ID, &models.PaymentFailedRequest{Reason: "insufficient funds"})
+	assert.EqualError(t, err, "invoice is not open")
+}
+
+func TestParseDunningPolicy(t *testing.T) {
+	policy, err := ParseDunningPolicy(" 1, 3,7 ", 10)
+	require.NoError(t, err)
+	assert.Equal(t, models.DunningPolicy{RetryDays: []int{1, 3, 7}, GraceDays: 10}, policy)
+
+	policy, err = ParseDunningPolicy("", 5)
+	require.NoError(t, err)
+	assert.Empty(t, policy.RetryDays, "retries may be disabled")
+
+	_, err = ParseDunningPolicy("3,1", 10)
+	assert.Error(t, err)
+	_, err = ParseDunningPolicy("1,two", 10)
+	assert.Error(t, err)
+	_, err = ParseDunningPolicy("1", 0)
+	assert.Error(t, err)
+}
+
+func (f *billingFixture) processDunning(t *testing.T) *models.DunningRun {
+	t.Helper()
+	run, err := f.dunning.ProcessDue(context.Background())
+	require.NoError(t, err)
+	require.Zero(t, run.Failed)
+	return run
+}
+
+// fakeDunningRepository hands out copies of its cases, so a stale copy is
+// refused by Update like a row changed in the database
+type fakeDunningRepository struct {
+	cases map[uuid.UUID]*models.DunningCase
+	locks map[uuid.UUID]time.Time
+}
+
+func (r *fakeDunningRepository) Create(ctx context.Context, dunningCase *models.DunningCase) (bool, error) {
+	if existing, _ := r.GetActiveByInvoice(ctx, dunningCase.InvoiceID); existing != nil {
+		return false, nil
+	}
+	dunningCase.ID = uuid.New()
+	copied := *dunningCase
+	r.cases[dunningCase.ID] = &copied
+	return true, nil
+}
+
+func (r *fakeDunningRepository) GetActiveByInvoice(ctx context.Context, invoiceID uuid.UUID) (*models.DunningCase, error) {
+	for _, dunningCase := range r.cases {
+		if dunningCase.InvoiceID == invoiceID && dunningCase.IsActive() {
+			copied := *dunningCase
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *fakeDunningRepository) ListByTenant(ctx context.Context, tenantID uuid.UUID) ([]*models.DunningCase, error) {
+	cases := []*models.DunningCase{}
+	for _, dunningCase := range r.cases {
+		if dunningCase.TenantID == tenantID {
+			copied := *dunningCase
+			cases = append(cases, &copied)
+		}
+	}
+	return cases, nil
+}
+
+func (r *fakeDunningRepository) ClaimDue(ctx context.Context, at, leaseUntil time.Time) (*models.DunningCase, error) {
+	for id, dunningCase := range r.cases {
+		retryDue := dunningCase.IsActive() && dunningCase.NextAttemptAt != nil && !dunningCase.NextAttemptAt.After(at)
+		graceOver := dunningCase.Status == models.DunningStatusOpen && !dunningCase.GraceEndsAt.After(at)
+		if (!retryDue && !graceOver) || r.locks[id].After(at) {
+			continue
+		}
+		r.locks[id] = leaseUntil
+		copied := *dunningCase
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (r *fakeDunningRepository) Update(ctx context.Context, dunningCase *models.DunningCase, from string) error {
+	stored, ok := r.cases[dunningCase.ID]
+	if !ok || stored.Status != from {
+		return repositories.ErrDunningCaseChanged
+	}
+	copied := *dunningCase
+	r.cases[dunningCase.ID] = &copied
+	delete(r.locks, dunningCase.ID)
+	return nil
+}
+
+func (r *fakeDunningRepository) CountSuspended(ctx context.Context, tenantID uuid.UUID) (int, error) {
+	count := 0
+	for _, dunningCase := range r.cases {
+		if dunningCase.TenantID == tenantID && dunningCase.Status == models.DunningStatusSuspended {
+			count++
+		}
+	}
+	return count, nil
+}
+
+type fakePaymentCollector struct {
+	result  *models.ChargeResult
+	charges int
+}
+
+func (c *fakePaymentCollector) Charge(ctx context.Context, invoice *models.Invoice) (*models.ChargeResult, error) {
+	c.charges++
+	return c.result, nil
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+
+	"zplus-saas/apps/backend/shared/entitlements"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// entitlementNamePattern names features, limits and modules, e.g.
+// "crm.pipelines" or "api_access"
+var entitlementNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_.]{0,99}$`)
+
+// EntitlementService resolves what a tenant may use from the version of its
+// plan's entitlements it is on and its override. The gateway and the other
+// services read the result through shared/entitlements to gate features.
+type EntitlementService interface {
+	Entitlements(ctx context.Context, tenantID uuid.UUID) (*entitlements.Entitlements, error)
+	ListPlanVersions(ctx context.Context, planID uuid.UUID) ([]*models.PlanEntitlements, error)
+	// PublishPlanVersion makes set the plan's latest version. New
+	// subscribers get it; existing ones keep their version until migrated.
+	PublishPlanVersion(ctx context.Context, planID uuid.UUID, set *models.EntitlementSet) (*models.PlanEntitlements, error)
+	// MigrateSubscribers moves the plan's grandfathered subscribers to its
+	// latest version
+	MigrateSubscribers(ctx context.Context, planID uuid.UUID) (*models.EntitlementMigration, error)
+	GetOverride(ctx context.Context, tenantID uuid.UUID) (*models.EntitlementOverride, error)
+	SetOverride(ctx context.Context, tenantID uuid.UUID, req *models.EntitlementOverrideRequest) (*models.EntitlementOverride, error)
+	DeleteOverride(ctx context.Context, tenantID uuid.UUID) error
+}
+
+type entitlementService struct {
+	entitlementRepo  repositories.EntitlementRepository
+	subscriptionRepo repositories.SubscriptionRepository
+	planRepo         repositories.PlanRepository
+	tenantRepo       repositories.TenantRepository
+	now              func() time.Time
+}
+
+func NewEntitlementService(
+	entitlementRepo repositories.EntitlementRepository,
+	subscriptionRepo repositories.SubscriptionRepository,
+	planRepo repositories.PlanRepository,
+	tenantRepo repositories.TenantRepository,
+) EntitlementService {
+	return &entitlementService{
+		entitlementRepo:  entitlementRepo,
+		subscriptionRepo: subscriptionRepo,
+		planRepo:         planRepo,
+		tenantRepo:       tenantRepo,
+		now:              time.Now,
+	}
+}
+
+func (s *entitlementService) Entitlements(ctx context.Context, tenantID uuid.UUID) (*entitlements.Entitlements, error) {
+	resolved := &entitlements.Entitlements{
+		TenantID:   tenantID,
+		Features:   map[string]bool{},
+		Limits:     map[string]int64{},
+		Modules:    map[string]bool{},
+		ResolvedAt: s.now(),
+	}
+
+	version, err := s.planVersion(ctx, tenantID, resolved)
+	if err != nil {
+		return nil, err
+	}
+	if version == nil {
+		resolved.Unrestricted = true
+	} else {
+		resolved.PlanVersion = version.Version
+		for feature, enabled := range version.Features {
+			resolved.Features[feature] = enabled
+		}
+		for name, limit := range version.Limits {
+			resolved.Limits[name] = limit
+		}
+		for _, module := range version.Modules {
+			resolved.Modules[module] = true
+		}
+	}
+
+	override, err := s.entitlementRepo.GetOverride(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entitlement override: %w", err)
+	}
+	if override == nil || !override.IsActive(resolved.ResolvedAt) {
+		return resolved, nil
+	}
+
+	resolved.Overridden = true
+	for feature, enabled := range override.Features {
+		resolved.Features[feature] = enabled
+	}
+	for name, limit := range override.Limits {
+		if limit == nil {
+			delete(resolved.Limits, name)
+		} else {
+			resolved.Limits[name] = *limit
+		}
+	}
+	for module, enabled := range override.Modules {
+		resolved.Modules[module] = enabled
+	}
+
+	return resolved, nil
+}
+
+// planVersion sets the tenant's plan on resolved and returns the version of
+// its entitlements the tenant is on, or nil if the tenant has no
+// subscription or the plan has no published version
+func (s *entitlementService) planVersion(ctx context.Context, tenantID uuid.UUID, resolved *entitlements.Entitlements) (*models.PlanEntitlements, error) {
+	subscription, err := s.subscriptionRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		if err.Error() == "subscription not found" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load subscription: %w", err)
+	}
+
+	plan := subscription.Plan
+	if plan == nil || plan.ID != subscription.PlanID {
+		if plan, err = s.planRepo.GetByID(ctx, subscription.PlanID); err != nil {
+			return nil, err
+		}
+	}
+	resolved.PlanID = &plan.ID
+	resolved.PlanName = plan.Name
+
+	latest, err := s.entitlementRepo.GetLatestVersion(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plan entitlements: %w", err)
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	resolved.LatestVersion = latest.Version
+
+	pinned, err := s.entitlementRepo.GetPinnedVersion(ctx, subscription.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entitlement version: %w", err)
+	}
+	if pinned == nil || *pinned == latest.Version {
+		return latest, nil
+	}
+
+	version, err := s.entitlementRepo.GetVersion(ctx, subscription.PlanID, *pinned)
+	if err != nil {
+		if err.Error() == "entitlement version not found" {
+			log.Printf("Tenant %s is pinned to missing version %d of plan %s, using the latest", tenantID, *pinned, subscription.PlanID)
+			return latest, nil
+		}
+		return nil, fmt.Errorf("failed to load plan entitlements: %w", err)
+	}
+	return version, nil
+}
+
+func (s *entitlementService) ListPlanVersions(ctx context.Context, planID uuid.UUID) ([]*models.PlanEntitlements, error) {
+	if _, err := s.planRepo.GetByID(ctx, planID); err != nil {
+		return nil, err
+	}
+
+	versions, err := s.entitlementRepo.ListVersions(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plan entitlements: %w", err)
+	}
+	return versions, nil
+}
+
+func (s *entitlementService) PublishPlanVersion(ctx context.Context, planID uuid.UUID, set *models.EntitlementSet) (*models.PlanEntitlements, error) {
+	if _, err := s.planRepo.GetByID(ctx, planID); err != nil {
+		return nil, err
+	}
+
+	version := &models.PlanEntitlements{
+		PlanID: planID,
+		EntitlementSet: models.EntitlementSet{
+			Features: map[string]bool{},
+			Limits:   map[string]int64{},
+			Modules:  []string{},
+		},
+	}
+	for feature, enabled := range set.Features {
+		if !entitlementNamePattern.MatchString(feature) {
+			return nil, fmt.Errorf("invalid feature name %q", feature)
+		}
+		version.Features[feature] = enabled
+	}
+	for name, limit := range set.Limits {
+		if !entitlementNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid limit name %q", name)
+		}
+		if limit < 0 {
+			return nil, fmt.Errorf("limit %s must not be negative", name)
+		}
+		version.Limits[name] = limit
+	}
+	seen := map[string]bool{}
+	for _, module := range set.Modules {
+		if !entitlementNamePattern.MatchString(module) {
+			return nil, fmt.Errorf("invalid module name %q", module)
+		}
+		if !seen[module] {
+			seen[module] = true
+			version.Modules = append(version.Modules, module)
+		}
+	}
+	sort.Strings(version.Modules)
+
+	if err := s.entitlementRepo.PublishVersion(ctx, version); err != nil {
+		if err.Error() == "plan not found" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to publish plan entitlements: %w", err)
+	}
+	return version, nil
+}
+
+func (s *entitlementService) MigrateSubscribers(ctx context.Context, planID uuid.UUID) (*models.EntitlementMigration, error) {
+	if _, err := s.planRepo.GetByID(ctx, planID); err != nil {
+		return nil, err
+	}
+
+	latest, err := s.entitlementRepo.GetLatestVersion(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plan entitlements: %w", err)
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("plan has no published entitlements")
+	}
+
+	migrated, err := s.entitlementRepo.UnpinSubscribers(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate subscribers: %w", err)
+	}
+
+	return &models.EntitlementMigration{
+		PlanID:     planID,
+		Version:    latest.Version,
+		Migrated:   migrated,
+		MigratedAt: s.now(),
+	}, nil
+}
+
+func (s *entitlementService) GetOverride(ctx context.Context, tenantID uuid.UUID) (*models.EntitlementOverride, error) {
+	override, err := s.entitlementRepo.GetOverride(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entitlement override: %w", err)
+	}
+	if override == nil {
+		return nil, fmt.Errorf("entitlement override not found")
+	}
+	return override, nil
+}
+
+func (s *entitlementService) SetOverride(ctx context.Context, tenantID uuid.UUID, req *models.EntitlementOverrideRequest) (*models.EntitlementOverride, error) {
+	if req.Reason == "" {
+		return nil, fmt.Errorf("reason is required")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(s.now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+	if _, err := s.tenantRepo.GetByID(ctx, tenantID); err != nil {
+		return nil, err
+	}
+
+	override := &models.EntitlementOverride{
+		TenantID:  tenantID,
+		Features:  map[string]bool{},
+		Limits:    map[string]*int64{},
+		Modules:   map[string]bool{},
+		Reason:    req.Reason,
+		ExpiresAt: req.ExpiresAt,
+	}
+	for feature, enabled := range req.Features {
+		if !entitlementNamePattern.MatchString(feature) {
+			return nil, fmt.Errorf("invalid feature name %q", feature)
+		}
+		override.Features[feature] = enabled
+	}
+	for name, limit := range req.Limits {
+		if !entitlementNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid limit name %q", name)
+		}
+		if limit != nil && *limit < 0 {
+			return nil, fmt.Errorf("limit %s must not be negative", name)
+		}
+		override.Limits[name] = limit
+	}
+	for module, enabled := range req.Modules {
+		if !entitlementNamePattern.MatchString(module) {
+			return nil, fmt.Errorf("invalid module name %q", module)
+		}
+		override.Modules[module] = enabled
+	}
+
+	if err := s.entitlementRepo.SaveOverride(ctx, override); err != nil {
+		return nil, fmt.Errorf("failed to save entitlement override: %w", err)
+	}
+	return override, nil
+}
+
+func (s *entitlementService) DeleteOverride(ctx context.Context, tenantID uuid.UUID) error {
+	if err := s.entitlementRepo.DeleteOverride(ctx, tenantID); err != nil {
+		if err.Error() == "entitlement override not found" {
+			return err
+		}
+		return fmt.Errorf("failed to delete entitlement override: %w", err)
+	}
+	return nil
+}
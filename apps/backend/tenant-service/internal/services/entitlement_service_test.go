@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntitlementsGrandfatherSubscribersOnTheirPlanVersion(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	service := f.entitlementService()
+
+	resolved, err := service.Entitlements(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.True(t, resolved.Unrestricted, "a tenant without a subscription has no restrictions")
+	assert.True(t, resolved.HasModule("crm"))
+
+	early := f.subscribe(f.basic, 0)
+	resolved, err = service.Entitlements(ctx, early.TenantID)
+	require.NoError(t, err)
+	assert.True(t, resolved.Unrestricted, "the plan has no published entitlements")
+	assert.Equal(t, "Basic", resolved.PlanName)
+
+	first, err := service.PublishPlanVersion(ctx, f.basic.ID, &models.EntitlementSet{
+		Features: map[string]bool{"reports.export": true},
+		Limits:   map[string]int64{"crm.pipelines": 3},
+		Modules:  []string{"crm", "crm"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.Version)
+	assert.Equal(t, []string{"crm"}, first.Modules)
+
+	resolved, err = service.Entitlements(ctx, early.TenantID)
+	require.NoError(t, err)
+	assert.False(t, resolved.Unrestricted)
+	assert.Equal(t, 1, resolved.PlanVersion)
+	assert.True(t, resolved.Enabled("reports.export"))
+	assert.False(t, resolved.Enabled("api.access"), "features the plan does not grant are off")
+	assert.True(t, resolved.HasModule("crm"))
+	assert.False(t, resolved.HasModule("hrm"))
+	limit, limited := resolved.Limit("crm.pipelines")
+	assert.True(t, limited)
+	assert.Equal(t, int64(3), limit)
+
+	// The plan now grants more modules but drops the export
+	_, err = service.PublishPlanVersion(ctx, f.basic.ID, &models.EntitlementSet{
+		Features: map[string]bool{"reports.export": false},
+		Limits:   map[string]int64{"crm.pipelines": 10},
+		Modules:  []string{"hrm", "crm"},
+	})
+	require.NoError(t, err)
+	late := f.subscribe(f.basic, 0)
+
+	resolved, err = service.Entitlements(ctx, early.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved.PlanVersion, "existing subscribers keep the version they had")
+	assert.Equal(t, 2, resolved.LatestVersion)
+	assert.True(t, resolved.Enabled("reports.export"))
+
+	resolved, err = service.Entitlements(ctx, late.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolved.PlanVersion)
+	assert.True(t, resolved.HasModule("hrm"))
+
+	migration, err := service.MigrateSubscribers(ctx, f.basic.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, migration.Migrated)
+	assert.Equal(t, 2, migration.Version)
+	resolved, err = service.Entitlements(ctx, early.TenantID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolved.PlanVersion)
+
+	// Changing plans leaves the version of the old plan behind
+	_, err = service.PublishPlanVersion(ctx, f.basic.ID, &models.EntitlementSet{Modules: []string{"crm"}})
+	require.NoError(t, err)
+	_, err = f.service.ChangePlan(ctx, early.TenantID, &models.ChangePlanRequest{PlanID: f.pro.ID.String()})
+	require.NoError(t, err)
+	resolved, err = service.Entitlements(ctx, early.TenantID)
+	require.NoError(t, err)
+	assert.True(t, resolved.Unrestricted)
+	assert.Zero(t, resolved.PlanVersion)
+
+	_, err = service.PublishPlanVersion(ctx, f.basic.ID, &models.EntitlementSet{Modules: []string{"CRM"}})
+	assert.EqualError(t, err, `invalid module name "CRM"`)
+	_, err = service.PublishPlanVersion(ctx, f.basic.ID, &models.EntitlementSet{Limits: map[string]int64{"users": -1}})
+	assert.Error(t, err)
+	_, err = service.MigrateSubscribers(ctx, f.pro.ID)
+	assert.EqualError(t, err, "plan has no published entitlements")
+}
+
+func TestEntitlementOverridesApplyUntilTheyExpire(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	service := f.entitlementService()
+	subscription := f.subscribe(f.basic, 0)
+	_, err := service.PublishPlanVersion(ctx, f.basic.ID, &models.EntitlementSet{
+		Features: map[string]bool{"sso": false},
+		Limits:   map[string]int64{"crm.pipelines": 3, "api.requests": 1000},
+		Modules:  []string{"crm", "hrm"},
+	})
+	require.NoError(t, err)
+
+	expiresAt := f.now.AddDate(0, 1, 0)
+	pipelines := int64(20)
+	_, err = service.SetOverride(ctx, subscription.TenantID, &models.EntitlementOverrideRequest{
+		Features:  map[string]bool{"sso": true},
+		Limits:    map[string]*int64{"crm.pipelines": &pipelines, "api.requests": nil},
+		Modules:   map[string]bool{"pos": true, "hrm": false},
+		Reason:    "Enterprise pilot",
+		ExpiresAt: &expiresAt,
+	})
+	require.NoError(t, err)
+
+	resolved, err := service.Entitlements(ctx, subscription.TenantID)
+	require.NoError(t, err)
+	assert.True(t, resolved.Overridden)
+	assert.True(t, resolved.Enabled("sso"))
+	limit, _ := resolved.Limit("crm.pipelines")
+	assert.Equal(t, int64(20), limit)
+	_, limited := resolved.Limit("api.requests")
+	assert.False(t, limited, "a null limit lifts the plan's limit")
+	assert.True(t, resolved.HasModule("pos"))
+	assert.False(t, resolved.HasModule("hrm"))
+	assert.True(t, resolved.HasModule("crm"))
+
+	f.now = expiresAt
+	resolved, err = service.Entitlements(ctx, subscription.TenantID)
+	require.NoError(t, err)
+	assert.False(t, resolved.Overridden)
+	assert.False(t, resolved.Enabled("sso"))
+	assert.True(t, resolved.HasModule("hrm"))
+
+	// An override also restricts an unrestricted tenant
+	_, err = service.SetOverride(ctx, subscription.TenantID, &models.EntitlementOverrideRequest{Modules: map[string]bool{"pos": false}, Reason: "Abuse"})
+	require.NoError(t, err)
+	_, err = f.service.ChangePlan(ctx, subscription.TenantID, &models.ChangePlanRequest{PlanID: f.pro.ID.String()})
+	require.NoError(t, err)
+	resolved, err = service.Entitlements(ctx, subscription.TenantID)
+	require.NoError(t, err)
+	assert.True(t, resolved.Unrestricted)
+	assert.False(t, resolved.HasModule("pos"))
+	assert.True(t, resolved.HasModule("lms"))
+
+	require.NoError(t, service.DeleteOverride(ctx, subscription.TenantID))
+	assert.EqualError(t, service.DeleteOverride(ctx, subscription.TenantID), "entitlement override not found")
+
+	past := f.now.Add(-time.Hour)
+	_, err = service.SetOverride(ctx, subscription.TenantID, &models.EntitlementOverrideRequest{Reason: "Late", ExpiresAt: &past})
+	assert.EqualError(t, err, "expires_at must be in the future")
+	_, err = service.SetOverride(ctx, subscription.TenantID, &models.EntitlementOverrideRequest{Features: map[string]bool{"sso": true}})
+	assert.EqualError(t, err, "reason is required")
+	_, err = service.SetOverride(ctx, uuid.New(), &models.EntitlementOverrideRequest{Reason: "Missing"})
+	assert.EqualError(t, err, "tenant not found")
+}
+
+func (f *billingFixture) entitlementService() *entitlementService {
+	repo := &fakeEntitlementRepository{
+		subscriptions: f.subscriptions,
+		versions:      map[uuid.UUID][]*models.PlanEntitlements{},
+		pins:          map[uuid.UUID]entitlementPin{},
+		overrides:     map[uuid.UUID]*models.EntitlementOverride{},
+	}
+	service := NewEntitlementService(repo, f.subscriptions, f.billing.plans, f.tenants).(*entitlementService)
+	service.now = func() time.Time { return f.now }
+	return service
+}
+
+type entitlementPin struct {
+	planID  uuid.UUID
+	version int
+}
+
+// fakeEntitlementRepository keeps the pins of subscriptions apart from them
+// and ignores a pin to a plan the subscription has left, like the
+// subscription updates that unpin in the database
+type fakeEntitlementRepository struct {
+	subscriptions *fakeSubscriptionRepository
+	versions      map[uuid.UUID][]*models.PlanEntitlements
+	pins          map[uuid.UUID]entitlementPin
+	overrides     map[uuid.UUID]*models.EntitlementOverride
+}
+
+func (r *fakeEntitlementRepository) PublishVersion(ctx context.Context, entitlements *models.PlanEntitlements) error {
+	latest := len(r.versions[entitlements.PlanID])
+	if latest > 0 {
+		for _, subscription := range r.subscriptions.subscriptions {
+			if subscription.PlanID != entitlements.PlanID {
+				continue
+			}
+			if pinned, _ := r.GetPinnedVersion(ctx, subscription.ID); pinned == nil {
+				r.pins[subscription.ID] = entitlementPin{planID: subscription.PlanID, version: latest}
+			}
+		}
+	}
+	entitlements.ID = uuid.New()
+	entitlements.Version = latest + 1
+	r.versions[entitlements.PlanID] = append(r.versions[entitlements.PlanID], entitlements)
+	return nil
+}
+
+func (r *fakeEntitlementRepository) ListVersions(ctx context.Context, planID uuid.UUID) ([]*models.PlanEntitlements, error) {
+	versions := append([]*models.PlanEntitlements{}, r.versions[planID]...)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (r *fakeEntitlementRepository) GetVersion(ctx context.Context, planID uuid.UUID, version int) (*models.PlanEntitlements, error) {
+	for _, entitlements := range r.versions[planID] {
+		if entitlements.Version == version {
+			return entitlements, nil
+		}
+	}
+	return nil, fmt.Errorf("entitlement version not found")
+}
+
+func (r *fakeEntitlementRepository) GetLatestVersion(ctx context.Context, planID uuid.UUID) (*models.PlanEntitlements, error) {
+	versions := r.versions[planID]
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+func (r *fakeEntitlementRepository) GetPinnedVersion(ctx context.Context, subscriptionID uuid.UUID) (*int, error) {
+	subscription, err := r.subscriptions.GetByID(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	pin, ok := r.pins[subscriptionID]
+	if !ok || pin.planID != subscription.PlanID {
+		return nil, nil
+	}
+	return &pin.version, nil
+}
+
+func (r *fakeEntitlementRepository) UnpinSubscribers(ctx context.Context, planID uuid.UUID) (int, error) {
+	unpinned := 0
+	for subscriptionID, pin := range r.pins {
+		if pin.planID == planID {
+			delete(r.pins, subscriptionID)
+			unpinned++
+		}
+	}
+	return unpinned, nil
+}
+
+func (r *fakeEntitlementRepository) GetOverride(ctx context.Context, tenantID uuid.UUID) (*models.EntitlementOverride, error) {
+	return r.overrides[tenantID], nil
+}
+
+func (r *fakeEntitlementRepository) SaveOverride(ctx context.Context, override *models.EntitlementOverride) error {
+	r.overrides[override.TenantID] = override
+	return nil
+}
+
+func (r *fakeEntitlementRepository) DeleteOverride(ctx context.Context, tenantID uuid.UUID) error {
+	if _, ok := r.overrides[tenantID]; !ok {
+		return fmt.Errorf("entitlement override not found")
+	}
+	delete(r.overrides, tenantID)
+	return nil
+}
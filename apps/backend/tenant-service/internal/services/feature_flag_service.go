@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"zplus-saas/apps/backend/shared/featureflags"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+// setEnabledAttempts bounds how often the kill switch retries when the flag
+// is being edited at the same time
+const setEnabledAttempts = 3
+
+// FeatureFlagService manages the feature flags the services evaluate through
+// shared/featureflags. Every change is announced so their cached rulesets
+// reload.
+type FeatureFlagService interface {
+	ListFlags(ctx context.Context) ([]*featureflags.Flag, error)
+	GetFlag(ctx context.Context, key string) (*featureflags.Flag, error)
+	CreateFlag(ctx context.Context, req *models.FeatureFlagRequest) (*featureflags.Flag, error)
+	UpdateFlag(ctx context.Context, key string, req *models.FeatureFlagRequest) (*featureflags.Flag, error)
+	// SetEnabled turns a flag on or off; turning it off is the kill switch
+	SetEnabled(ctx context.Context, key string, enabled bool) (*featureflags.Flag, error)
+	DeleteFlag(ctx context.Context, key string) error
+	Ruleset(ctx context.Context) (*featureflags.Ruleset, error)
+	Evaluate(ctx context.Context, req *models.EvaluateFlagsRequest) (map[string]featureflags.Evaluation, error)
+}
+
+// FlagNotifier announces that the ruleset changed to version
+type FlagNotifier interface {
+	Notify(ctx context.Context, version int64) error
+}
+
+type featureFlagService struct {
+	flagRepo         repositories.FeatureFlagRepository
+	subscriptionRepo repositories.SubscriptionRepository
+	notifier         FlagNotifier
+}
+
+// NewFeatureFlagService creates the service. Without a notifier clients pick
+// changes up when they reload the ruleset periodically.
+func NewFeatureFlagService(
+	flagRepo repositories.FeatureFlagRepository,
+	subscriptionRepo repositories.SubscriptionRepository,
+	notifier FlagNotifier,
+) FeatureFlagService {
+	return &featureFlagService{
+		flagRepo:         flagRepo,
+		subscriptionRepo: subscriptionRepo,
+		notifier:         notifier,
+	}
+}
+
+func (s *featureFlagService) ListFlags(ctx context.Context) ([]*featureflags.Flag, error) {
+	flags, err := s.flagRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	return flags, nil
+}
+
+func (s *featureFlagService) GetFlag(ctx context.Context, key string) (*featureflags.Flag, error) {
+	flag, err := s.flagRepo.Get(ctx, key)
+	if err != nil {
+		if err.Error() == "feature flag not found" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get feature flag: %w", err)
+	}
+	return flag, nil
+}
+
+func (s *featureFlagService) CreateFlag(ctx context.Context, req *models.FeatureFlagRequest) (*featureflags.Flag, error) {
+	flag := flagFromRequest(req.Key, req)
+	flag.Enabled = req.Enabled
+	flag.Normalize()
+	if err := flag.Validate(); err != nil {
+		return nil, err
+	}
+
+	version, err := s.flagRepo.Create(ctx, flag)
+	if err != nil {
+		if err.Error() == "feature flag already exists" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create feature flag: %w", err)
+	}
+
+	s.notify(ctx, version)
+	return flag, nil
+}
+
+func (s *featureFlagService) UpdateFlag(ctx context.Context, key string, req *models.FeatureFlagRequest) (*featureflags.Flag, error) {
+	current, err := s.GetFlag(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if req.Version != current.Version {
+		return nil, fmt.Errorf("feature flag is at version %d, not %d", current.Version, req.Version)
+	}
+
+	flag := flagFromRequest(key, req)
+	flag.Enabled = current.Enabled
+	flag.CreatedAt = current.CreatedAt
+	flag.Normalize()
+	if err := flag.Validate(); err != nil {
+		return nil, err
+	}
+
+	version, err := s.flagRepo.Update(ctx, flag, current.Version)
+	if err != nil {
+		if errors.Is(err, repositories.ErrFeatureFlagChanged) {
+			return nil, fmt.Errorf("feature flag was changed, reload it and try again")
+		}
+		return nil, fmt.Errorf("failed to update feature flag: %w", err)
+	}
+
+	s.notify(ctx, version)
+	return flag, nil
+}
+
+func (s *featureFlagService) SetEnabled(ctx context.Context, key string, enabled bool) (*featureflags.Flag, error) {
+	// Only the enabled state changes, so a concurrent edit is reread rather
+	// than failing the kill switch
+	for attempt := 1; ; attempt++ {
+		flag, err := s.GetFlag(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if flag.Enabled == enabled {
+			return flag, nil
+		}
+
+		flag.Enabled = enabled
+		version, err := s.flagRepo.Update(ctx, flag, flag.Version)
+		if errors.Is(err, repositories.ErrFeatureFlagChanged) && attempt < setEnabledAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update feature flag: %w", err)
+		}
+
+		s.notify(ctx, version)
+		return flag, nil
+	}
+}
+
+func (s *featureFlagService) DeleteFlag(ctx context.Context, key string) error {
+	version, err := s.flagRepo.Delete(ctx, key)
+	if err != nil {
+		if err.Error() == "feature flag not found" {
+			return err
+		}
+		return fmt.Errorf("failed to delete feature flag: %w", err)
+	}
+
+	s.notify(ctx, version)
+	return nil
+}
+
+func (s *featureFlagService) Ruleset(ctx context.Context) (*featureflags.Ruleset, error) {
+	ruleset, err := s.flagRepo.Ruleset(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	return ruleset, nil
+}
+
+func (s *featureFlagService) Evaluate(ctx context.Context, req *models.EvaluateFlagsRequest) (map[string]featureflags.Evaluation, error) {
+	evalCtx := req.Context
+	if evalCtx.PlanID == "" && evalCtx.TenantID != "" {
+		planID, err := s.tenantPlan(ctx, evalCtx.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		evalCtx.PlanID = planID
+	}
+
+	flags, err := s.ListFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*featureflags.Flag, len(flags))
+	for _, flag := range flags {
+		byKey[flag.Key] = flag
+	}
+
+	keys := req.Keys
+	if len(keys) == 0 {
+		for key := range byKey {
+			keys = append(keys, key)
+		}
+	}
+
+	evaluations := make(map[string]featureflags.Evaluation, len(keys))
+	for _, key := range keys {
+		flag, ok := byKey[key]
+		if !ok {
+			evaluations[key] = featureflags.Evaluation{Key: key, Reason: featureflags.ReasonFlagNotFound}
+			continue
+		}
+		evaluations[key] = flag.Evaluate(evalCtx)
+	}
+	return evaluations, nil
+}
+
+// tenantPlan returns the ID of the tenant's plan, or "" if it has none
+func (s *featureFlagService) tenantPlan(ctx context.Context, tenantID string) (string, error) {
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return "", fmt.Errorf("tenant_id must be a valid UUID")
+	}
+
+	subscription, err := s.subscriptionRepo.GetByTenantID(ctx, id)
+	if err != nil {
+		if err.Error() == "subscription not found" {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to load subscription: %w", err)
+	}
+	return subscription.PlanID.String(), nil
+}
+
+// notify announces the new ruleset version. The change is saved already, so
+// a failure only delays clients until their periodic reload.
+func (s *featureFlagService) notify(ctx context.Context, version int64) {
+	if s.notifier == nil {
+		return
+	}
+	if err := s.notifier.Notify(ctx, version); err != nil {
+		log.Printf("Failed to announce feature flag ruleset version %d: %v", version, err)
+	}
+}
+
+func flagFromRequest(key string, req *models.FeatureFlagRequest) *featureflags.Flag {
+	rules := req.Rules
+	if rules == nil {
+		rules = []featureflags.Rule{}
+	}
+	return &featureflags.Flag{
+		Key:          key,
+		Description:  req.Description,
+		Kind:         req.Kind,
+		Variations:   req.Variations,
+		OffVariation: req.OffVariation,
+		Rules:        rules,
+		Fallthrough:  req.Fallthrough,
+	}
+}
+
+type redisFlagNotifier struct {
+	client *redis.Client
+}
+
+// NewRedisFlagNotifier announces changes on featureflags.RulesetChannel
+func NewRedisFlagNotifier(client *redis.Client) FlagNotifier {
+	return &redisFlagNotifier{client: client}
+}
+
+func (n *redisFlagNotifier) Notify(ctx context.Context, version int64) error {
+	return featureflags.Publish(ctx, n.client, version)
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"zplus-saas/apps/backend/shared/featureflags"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureFlagTargetingAndKillSwitch(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	service, repo, notifier := f.featureFlagService()
+	pro := f.subscribe(f.pro, 0)
+	basic := f.subscribe(f.basic, 0)
+	beta := uuid.New().String()
+
+	flag, err := service.CreateFlag(ctx, &models.FeatureFlagRequest{
+		Key:  "crm.new_pipeline",
+		Kind: featureflags.KindBoolean,
+		Rules: []featureflags.Rule{
+			{
+				Conditions: []featureflags.Condition{{Attribute: featureflags.AttributeTenant, Operator: featureflags.OperatorIn, Values: []string{beta}}},
+				Serve:      featureflags.Serve{Variation: featureflags.VariationOn},
+			},
+			{
+				Conditions: []featureflags.Condition{
+					{Attribute: featureflags.AttributePlan, Operator: featureflags.OperatorIn, Values: []string{f.pro.ID.String()}},
+					{Attribute: featureflags.AttributeRole, Operator: featureflags.OperatorNotIn, Values: []string{"viewer"}},
+				},
+				Serve: featureflags.Serve{Variation: featureflags.VariationOn},
+			},
+			{
+				Conditions: []featureflags.Condition{{Attribute: "email", Operator: featureflags.OperatorContains, Values: []string{"@zplus.vn"}}},
+				Serve:      featureflags.Serve{Variation: featureflags.VariationOn},
+			},
+		},
+		Fallthrough: featureflags.Serve{Variation: featureflags.VariationOff},
+		Enabled:     true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, featureflags.VariationOff, flag.OffVariation, "boolean flags get on and off variations")
+	assert.Len(t, flag.Variations, 2)
+	assert.Equal(t, []int64{1}, notifier.versions)
+
+	evaluate := func(evalCtx featureflags.Context) featureflags.Evaluation {
+		evaluations, err := service.Evaluate(ctx, &models.EvaluateFlagsRequest{Context: evalCtx, Keys: []string{"crm.new_pipeline"}})
+		require.NoError(t, err)
+		return evaluations["crm.new_pipeline"]
+	}
+
+	evaluation := evaluate(featureflags.Context{TenantID: beta})
+	assert.True(t, evaluation.Bool(false))
+	assert.Equal(t, featureflags.ReasonRuleMatch, evaluation.Reason)
+	assert.Equal(t, 0, *evaluation.RuleIndex)
+
+	// The plan is looked up from the tenant's subscription
+	evaluation = evaluate(featureflags.Context{TenantID: pro.TenantID.String(), Role: "admin"})
+	assert.True(t, evaluation.Bool(false))
+	assert.Equal(t, 1, *evaluation.RuleIndex)
+	assert.False(t, evaluate(featureflags.Context{TenantID: pro.TenantID.String(), Role: "viewer"}).Bool(true))
+
+	evaluation = evaluate(featureflags.Context{TenantID: basic.TenantID.String()})
+	assert.False(t, evaluation.Bool(true))
+	assert.Equal(t, featureflags.ReasonFallthrough, evaluation.Reason)
+	assert.True(t, evaluate(featureflags.Context{TenantID: basic.TenantID.String(), Attributes: map[string]string{"email": "an@zplus.vn"}}).Bool(false))
+
+	// The kill switch serves off to everyone, even targeted tenants
+	killed, err := service.SetEnabled(ctx, "crm.new_pipeline", false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, killed.Version)
+	evaluation = evaluate(featureflags.Context{TenantID: beta})
+	assert.False(t, evaluation.Bool(true))
+	assert.Equal(t, featureflags.ReasonOff, evaluation.Reason)
+
+	// It wins over an edit made at the same time
+	repo.raceUpdates = 2
+	revived, err := service.SetEnabled(ctx, "crm.new_pipeline", true)
+	require.NoError(t, err)
+	assert.True(t, revived.Enabled)
+	assert.Equal(t, []int64{1, 2, 3}, notifier.versions)
+
+	missing, err := service.Evaluate(ctx, &models.EvaluateFlagsRequest{Keys: []string{"nope"}})
+	require.NoError(t, err)
+	assert.Equal(t, featureflags.ReasonFlagNotFound, missing["nope"].Reason)
+	assert.True(t, missing["nope"].Bool(true))
+
+	ruleset, err := service.Ruleset(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), ruleset.Version)
+	assert.Len(t, ruleset.Flags, 1)
+
+	require.NoError(t, service.DeleteFlag(ctx, "crm.new_pipeline"))
+	assert.EqualError(t, service.DeleteFlag(ctx, "crm.new_pipeline"), "feature flag not found")
+	assert.Equal(t, []int64{1, 2, 3, 4}, notifier.versions)
+}
+
+func TestFeatureFlagRolloutsAreDeterministic(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	service, _, _ := f.featureFlagService()
+
+	rollout := func(on int) featureflags.Serve {
+		return featureflags.Serve{Rollout: &featureflags.Rollout{Variations: []featureflags.WeightedVariation{
+			{Variation: featureflags.VariationOn, Weight: on},
+			{Variation: featureflags.VariationOff, Weight: featureflags.RolloutScale - on},
+		}}}
+	}
+	flag, err := service.CreateFlag(ctx, &models.FeatureFlagRequest{
+		Key:         "pos.fast_checkout",
+		Kind:        featureflags.KindBoolean,
+		Fallthrough: rollout(2000),
+		Enabled:     true,
+	})
+	require.NoError(t, err)
+
+	tenants := make([]string, 2000)
+	for i := range tenants {
+		tenants[i] = fmt.Sprintf("tenant-%d", i)
+	}
+	enabled := func(flag *featureflags.Flag) map[string]bool {
+		on := map[string]bool{}
+		for _, tenant := range tenants {
+			if flag.Evaluate(featureflags.Context{TenantID: tenant}).Bool(false) {
+				on[tenant] = true
+			}
+		}
+		return on
+	}
+
+	first := enabled(flag)
+	assert.InDelta(t, 400, len(first), 60, "about a fifth of the tenants are in the rollout")
+	assert.Equal(t, first, enabled(flag), "a tenant always gets the same variation")
+
+	// Users of a tenant are bucketed together
+	for _, user := range []string{"a", "b", "c"} {
+		assert.Equal(t, first[tenants[0]], flag.Evaluate(featureflags.Context{TenantID: tenants[0], UserID: user}).Bool(false))
+	}
+
+	// Growing the rollout keeps every tenant that already had the feature
+	grown, err := service.UpdateFlag(ctx, flag.Key, &models.FeatureFlagRequest{
+		Kind:        featureflags.KindBoolean,
+		Fallthrough: rollout(5000),
+		Version:     flag.Version,
+	})
+	require.NoError(t, err)
+	assert.True(t, grown.Enabled, "updating keeps the flag enabled")
+	second := enabled(grown)
+	assert.Greater(t, len(second), len(first))
+	for tenant := range first {
+		assert.True(t, second[tenant], "tenant %s left the rollout", tenant)
+	}
+
+	_, err = service.UpdateFlag(ctx, flag.Key, &models.FeatureFlagRequest{Kind: featureflags.KindBoolean, Fallthrough: rollout(10000), Version: flag.Version})
+	assert.EqualError(t, err, "feature flag is at version 2, not 1")
+
+	// Multivariate flags split by the bucketed attribute
+	checkout, err := service.CreateFlag(ctx, &models.FeatureFlagRequest{
+		Key:  "pos.checkout_layout",
+		Kind: featureflags.KindMultivariate,
+		Variations: []featureflags.Variation{
+			{Key: "classic", Value: json.RawMessage(`"classic"`)},
+			{Key: "grid", Value: json.RawMessage(`"grid"`)},
+			{Key: "compact", Value: json.RawMessage(`"compact"`)},
+		},
+		OffVariation: "classic",
+		Fallthrough: featureflags.Serve{Rollout: &featureflags.Rollout{
+			BucketBy: featureflags.AttributeUser,
+			Variations: []featureflags.WeightedVariation{
+				{Variation: "classic", Weight: 3400},
+				{Variation: "grid", Weight: 3300},
+				{Variation: "compact", Weight: 3300},
+			},
+		}},
+		Enabled: true,
+	})
+	require.NoError(t, err)
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		evaluation := checkout.Evaluate(featureflags.Context{TenantID: "tenant", UserID: fmt.Sprintf("user-%d", i)})
+		counts[evaluation.Variation]++
+	}
+	for _, variation := range []string{"classic", "grid", "compact"} {
+		assert.InDelta(t, 1000, counts[variation], 120, variation)
+	}
+}
+
+func TestFeatureFlagValidation(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	service, _, notifier := f.featureFlagService()
+
+	on := featureflags.Serve{Variation: featureflags.VariationOn}
+	tests := []struct {
+		name string
+		req  models.FeatureFlagRequest
+		err  string
+	}{
+		{"key", models.FeatureFlagRequest{Key: "Bad Key", Kind: featureflags.KindBoolean, Fallthrough: on}, `invalid flag key "Bad Key"`},
+		{"kind", models.FeatureFlagRequest{Key: "a", Kind: "number", Fallthrough: on}, `unknown flag kind "number"`},
+		{"boolean variations", models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindBoolean, Variations: []featureflags.Variation{{Key: "on", Value: json.RawMessage("1")}, {Key: "off", Value: json.RawMessage("0")}}, Fallthrough: on}, "a boolean flag has exactly the variations on and off"},
+		{"multivariate variations", models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindMultivariate, Variations: []featureflags.Variation{{Key: "x", Value: json.RawMessage("1")}}, OffVariation: "x", Fallthrough: featureflags.Serve{Variation: "x"}}, "a multivariate flag needs at least two variations"},
+		{"fallthrough", models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindBoolean, Fallthrough: featureflags.Serve{Variation: "maybe"}}, `fallthrough: unknown variation "maybe"`},
+		{"operator", models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindBoolean, Rules: []featureflags.Rule{{Conditions: []featureflags.Condition{{Attribute: "role", Operator: "like", Values: []string{"x"}}}, Serve: on}}, Fallthrough: on}, `rule 0: unknown operator "like"`},
+		{"weights", models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindBoolean, Fallthrough: featureflags.Serve{Rollout: &featureflags.Rollout{Variations: []featureflags.WeightedVariation{{Variation: "on", Weight: 50}, {Variation: "off", Weight: 50}}}}}, "fallthrough: rollout weights must add up to 10000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateFlag(ctx, &tt.req)
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	_, err := service.CreateFlag(ctx, &models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindBoolean, Fallthrough: on})
+	require.NoError(t, err)
+	_, err = service.CreateFlag(ctx, &models.FeatureFlagRequest{Key: "a", Kind: featureflags.KindBoolean, Fallthrough: on})
+	assert.EqualError(t, err, "feature flag already exists")
+	assert.Equal(t, []int64{1}, notifier.versions, "only saved changes are announced")
+}
+
+func (f *billingFixture) featureFlagService() (*featureFlagService, *fakeFeatureFlagRepository, *fakeFlagNotifier) {
+	repo := &fakeFeatureFlagRepository{flags: map[string]*featureflags.Flag{}}
+	notifier := &fakeFlagNotifier{}
+	service := NewFeatureFlagService(repo, f.subscriptions, notifier).(*featureFlagService)
+	return service, repo, notifier
+}
+
+type fakeFlagNotifier struct {
+	versions []int64
+}
+
+func (n *fakeFlagNotifier) Notify(ctx context.Context, version int64) error {
+	n.versions = append(n.versions, version)
+	return nil
+}
+
+// fakeFeatureFlagRepository copies flags in and out like the database. Its
+// next raceUpdates updates fail as if another edit got in first.
+type fakeFeatureFlagRepository struct {
+	flags       map[string]*featureflags.Flag
+	version     int64
+	raceUpdates int
+}
+
+func (r *fakeFeatureFlagRepository) List(ctx context.Context) ([]*featureflags.Flag, error) {
+	flags := []*featureflags.Flag{}
+	for _, flag := range r.flags {
+		copied := *flag
+		flags = append(flags, &copied)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags, nil
+}
+
+func (r *fakeFeatureFlagRepository) Get(ctx context.Context, key string) (*featureflags.Flag, error) {
+	flag, ok := r.flags[key]
+	if !ok {
+		return nil, fmt.Errorf("feature flag not found")
+	}
+	copied := *flag
+	return &copied, nil
+}
+
+func (r *fakeFeatureFlagRepository) Create(ctx context.Context, flag *featureflags.Flag) (int64, error) {
+	if _, ok := r.flags[flag.Key]; ok {
+		return 0, fmt.Errorf("feature flag already exists")
+	}
+	flag.Version = 1
+	copied := *flag
+	r.flags[flag.Key] = &copied
+	r.version++
+	return r.version, nil
+}
+
+func (r *fakeFeatureFlagRepository) Update(ctx context.Context, flag *featureflags.Flag, version int) (int64, error) {
+	current, ok := r.flags[flag.Key]
+	if r.raceUpdates > 0 {
+		r.raceUpdates--
+		current.Version++
+	}
+	if !ok || current.Version != version {
+		return 0, repositories.ErrFeatureFlagChanged
+	}
+	flag.Version = version + 1
+	copied := *flag
+	r.flags[flag.Key] = &copied
+	r.version++
+	return r.version, nil
+}
+
+func (r *fakeFeatureFlagRepository) Delete(ctx context.Context, key string) (int64, error) {
+	if _, ok := r.flags[key]; !ok {
+		return 0, fmt.Errorf("feature flag not found")
+	}
+	delete(r.flags, key)
+	r.version++
+	return r.version, nil
+}
+
+func (r *fakeFeatureFlagRepository) Ruleset(ctx context.Context) (*featureflags.Ruleset, error) {
+	flags, _ := r.List(ctx)
+	ruleset := &featureflags.Ruleset{Version: r.version}
+	for _, flag := range flags {
+		ruleset.Flags = append(ruleset.Flags, *flag)
+	}
+	return ruleset, nil
+}
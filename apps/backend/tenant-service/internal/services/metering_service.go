@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"zplus-saas/apps/backend/shared/metering"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+const (
+	storageMeterInterval = time.Hour
+	bytesPerGB           = 1 << 30
+	// maxUsageClockSkew is how far in the future a reported event may be
+	maxUsageClockSkew = 5 * time.Minute
+	// usageQuantityScale is the precision usage quantities are stored at
+	usageQuantityScale = 1e6
+)
+
+var metricPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// MeteringService aggregates the usage events services report per tenant
+// and billing period, and prices them with the metered prices of the plan.
+// A period's usage is billed in arrears when the period ends, at the prices
+// of the plan the subscription is on at that time. Events reported after
+// their period was billed are not billed.
+type MeteringService interface {
+	RecordUsage(ctx context.Context, req *models.RecordUsageRequest) (*models.UsageRecorded, error)
+	// GetPeriodUsage returns the tenant's usage in its current billing
+	// period so far
+	GetPeriodUsage(ctx context.Context, tenantID uuid.UUID) (*models.PeriodUsage, error)
+	ListMeteredPrices(ctx context.Context, planID uuid.UUID) ([]*models.MeteredPrice, error)
+	SetMeteredPrices(ctx context.Context, planID uuid.UUID, req *models.MeteredPricesRequest) ([]*models.MeteredPrice, error)
+	// MeteredLines returns the invoice lines billing the tenant's usage in
+	// [from, to) at the plan's metered prices
+	MeteredLines(ctx context.Context, tenantID, planID uuid.UUID, from, to time.Time) ([]models.InvoiceLine, error)
+	// SampleStorage records a day of storage GB-months for every subscribed
+	// tenant. Sampling the same day again records nothing.
+	SampleStorage(ctx context.Context) (*models.StorageMeterRun, error)
+}
+
+type meteringService struct {
+	meteringRepo     repositories.MeteringRepository
+	subscriptionRepo repositories.SubscriptionRepository
+	planRepo         repositories.PlanRepository
+	now              func() time.Time
+}
+
+func NewMeteringService(
+	meteringRepo repositories.MeteringRepository,
+	subscriptionRepo repositories.SubscriptionRepository,
+	planRepo repositories.PlanRepository,
+) MeteringService {
+	return &meteringService{
+		meteringRepo:     meteringRepo,
+		subscriptionRepo: subscriptionRepo,
+		planRepo:         planRepo,
+		now:              time.Now,
+	}
+}
+
+func (s *meteringService) RecordUsage(ctx context.Context, req *models.RecordUsageRequest) (*models.UsageRecorded, error) {
+	if len(req.Events) == 0 {
+		return nil, fmt.Errorf("events are required")
+	}
+	if len(req.Events) > models.MaxUsageEventsPerRequest {
+		return nil, fmt.Errorf("at most %d events can be reported at once", models.MaxUsageEventsPerRequest)
+	}
+
+	now := s.now()
+	events := make([]*models.UsageEvent, 0, len(req.Events))
+	for i, input := range req.Events {
+		event, err := newUsageEvent(&input, req.Source, now)
+		if err != nil {
+			return nil, fmt.Errorf("event %d: %w", i, err)
+		}
+		events = append(events, event)
+	}
+
+	recorded, err := s.meteringRepo.RecordEvents(ctx, events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record usage: %w", err)
+	}
+
+	return &models.UsageRecorded{Recorded: recorded, Duplicates: len(events) - recorded}, nil
+}
+
+func newUsageEvent(input *models.UsageEventInput, source string, now time.Time) (*models.UsageEvent, error) {
+	tenantID, err := uuid.Parse(input.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant ID")
+	}
+	if !metricPattern.MatchString(input.Metric) {
+		return nil, fmt.Errorf("invalid metric %q", input.Metric)
+	}
+	quantity := roundQuantity(input.Quantity)
+	if math.IsNaN(input.Quantity) || math.IsInf(input.Quantity, 0) || quantity <= 0 {
+		return nil, fmt.Errorf("quantity must be positive")
+	}
+	if input.IdempotencyKey == "" || len(input.IdempotencyKey) > 200 {
+		return nil, fmt.Errorf("idempotency_key is required and at most 200 characters")
+	}
+
+	occurredAt := now
+	if input.OccurredAt != nil {
+		occurredAt = *input.OccurredAt
+	}
+	if occurredAt.After(now.Add(maxUsageClockSkew)) {
+		return nil, fmt.Errorf("occurred_at is in the future")
+	}
+
+	return &models.UsageEvent{
+		TenantID:       tenantID,
+		Metric:         input.Metric,
+		Quantity:       quantity,
+		OccurredAt:     occurredAt,
+		IdempotencyKey: input.IdempotencyKey,
+		Source:         source,
+	}, nil
+}
+
+func (s *meteringService) GetPeriodUsage(ctx context.Context, tenantID uuid.UUID) (*models.PeriodUsage, error) {
+	subscription, err := s.subscriptionRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.planRepo.GetByID(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plan: %w", err)
+	}
+
+	now := s.now()
+	prices, usage, err := s.load(ctx, tenantID, plan.ID, subscription.CurrentPeriodStart, now)
+	if err != nil {
+		return nil, err
+	}
+
+	periodUsage := &models.PeriodUsage{
+		TenantID:    tenantID,
+		PlanID:      plan.ID,
+		Currency:    plan.Currency,
+		PeriodStart: subscription.CurrentPeriodStart,
+		PeriodEnd:   periodBoundary(subscription),
+		Billed:      billedPeriod(subscription),
+		Metrics:     priceUsage(prices, usage),
+		MeasuredAt:  now,
+	}
+	for _, metric := range periodUsage.Metrics {
+		periodUsage.Amount += metric.Amount
+	}
+	periodUsage.Amount = models.RoundAmount(periodUsage.Amount)
+
+	return periodUsage, nil
+}
+
+func (s *meteringService) ListMeteredPrices(ctx context.Context, planID uuid.UUID) ([]*models.MeteredPrice, error) {
+	if _, err := s.planRepo.GetByID(ctx, planID); err != nil {
+		return nil, err
+	}
+	return s.meteringRepo.ListMeteredPrices(ctx, planID)
+}
+
+func (s *meteringService) SetMeteredPrices(ctx context.Context, planID uuid.UUID, req *models.MeteredPricesRequest) ([]*models.MeteredPrice, error) {
+	if _, err := s.planRepo.GetByID(ctx, planID); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for i := range req.Prices {
+		price := &req.Prices[i]
+		if !metering.Priceable(price.Metric) {
+			return nil, fmt.Errorf("metric %q is not metered", price.Metric)
+		}
+		if seen[price.Metric] {
+			return nil, fmt.Errorf("metric %s is priced twice", price.Metric)
+		}
+		seen[price.Metric] = true
+		if price.UnitPrice < 0 || price.IncludedQuantity < 0 {
+			return nil, fmt.Errorf("prices and included quantities of %s must not be negative", price.Metric)
+		}
+		if price.Description == "" {
+			price.Description = price.Metric
+		}
+		price.PlanID = planID
+	}
+
+	if err := s.meteringRepo.SetMeteredPrices(ctx, planID, req.Prices); err != nil {
+		return nil, fmt.Errorf("failed to save metered prices: %w", err)
+	}
+	return s.meteringRepo.ListMeteredPrices(ctx, planID)
+}
+
+func (s *meteringService) MeteredLines(ctx context.Context, tenantID, planID uuid.UUID, from, to time.Time) ([]models.InvoiceLine, error) {
+	prices, usage, err := s.load(ctx, tenantID, planID, from, to)
+	if err != nil || len(prices) == 0 {
+		return nil, err
+	}
+
+	var lines []models.InvoiceLine
+	for _, metric := range priceUsage(prices, usage) {
+		lines = appendLine(lines, models.InvoiceLine{
+			Kind:        models.InvoiceLineMetered,
+			Description: metric.Description,
+			PlanID:      &planID,
+			Metric:      metric.Metric,
+			Quantity:    metric.BillableQuantity,
+			UnitPrice:   metric.UnitPrice,
+			Amount:      metric.Amount,
+			PeriodStart: from,
+			PeriodEnd:   to,
+		})
+	}
+	return lines, nil
+}
+
+// load returns the plan's metered prices and the tenant's usage in [from,
+// to)
+func (s *meteringService) load(ctx context.Context, tenantID, planID uuid.UUID, from, to time.Time) ([]*models.MeteredPrice, map[string]float64, error) {
+	prices, err := s.meteringRepo.ListMeteredPrices(ctx, planID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load metered prices: %w", err)
+	}
+
+	usage, err := s.meteringRepo.SumUsage(ctx, tenantID, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sum usage: %w", err)
+	}
+	return prices, usage, nil
+}
+
+func (s *meteringService) SampleStorage(ctx context.Context) (*models.StorageMeterRun, error) {
+	now := s.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	run := &models.StorageMeterRun{RanAt: now}
+
+	stored, err := s.meteringRepo.ListStoredBytes(ctx)
+	if err != nil {
+		return run, fmt.Errorf("failed to measure storage: %w", err)
+	}
+
+	// A day of storing a GB is a GB for the fraction of its month that day
+	// is, so a month of daily samples adds up to the average GB stored
+	daysInMonth := float64(day.AddDate(0, 1, -day.Day()).Day())
+	var events []*models.UsageEvent
+	for tenantID, bytes := range stored {
+		run.Tenants++
+		quantity := roundQuantity(float64(bytes) / bytesPerGB / daysInMonth)
+		if quantity <= 0 {
+			continue
+		}
+		events = append(events, &models.UsageEvent{
+			TenantID:       tenantID,
+			Metric:         metering.MetricStorageGBMonths,
+			Quantity:       quantity,
+			OccurredAt:     day,
+			IdempotencyKey: "storage:" + day.Format("2006-01-02"),
+			Source:         "tenant-service",
+		})
+	}
+
+	if len(events) == 0 {
+		return run, nil
+	}
+	run.Recorded, err = s.meteringRepo.RecordEvents(ctx, events)
+	if err != nil {
+		return run, fmt.Errorf("failed to record storage usage: %w", err)
+	}
+	return run, nil
+}
+
+// priceUsage prices the usage of every metric the plan prices or the
+// tenant used, ordered by metric
+func priceUsage(prices []*models.MeteredPrice, usage map[string]float64) []models.MeteredUsage {
+	metrics := map[string]models.MeteredUsage{}
+	for metric, quantity := range usage {
+		metrics[metric] = models.MeteredUsage{Metric: metric, Quantity: roundQuantity(quantity)}
+	}
+	for _, price := range prices {
+		metered := metrics[price.Metric]
+		metered.Metric = price.Metric
+		metered.Description = price.Description
+		metered.IncludedQuantity = price.IncludedQuantity
+		metered.UnitPrice = price.UnitPrice
+		metered.BillableQuantity = roundQuantity(math.Max(metered.Quantity-price.IncludedQuantity, 0))
+		metered.Amount = models.RoundAmount(metered.BillableQuantity * price.UnitPrice)
+		metrics[price.Metric] = metered
+	}
+
+	priced := make([]models.MeteredUsage, 0, len(metrics))
+	for _, metered := range metrics {
+		priced = append(priced, metered)
+	}
+	sort.Slice(priced, func(i, j int) bool { return priced[i].Metric < priced[j].Metric })
+	return priced
+}
+
+// roundQuantity rounds a quantity to the precision it is stored at
+func roundQuantity(quantity float64) float64 {
+	return math.Round(quantity*usageQuantityScale) / usageQuantityScale
+}
+
+// StorageMeterWorker samples the storage of subscribed tenants once a day
+type StorageMeterWorker struct {
+	meteringService MeteringService
+}
+
+func NewStorageMeterWorker(meteringService MeteringService) *StorageMeterWorker {
+	return &StorageMeterWorker{meteringService: meteringService}
+}
+
+// Run samples storage every storageMeterInterval until ctx is cancelled.
+// Only the first sample of a day is recorded.
+func (w *StorageMeterWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(storageMeterInterval)
+	defer ticker.Stop()
+
+	for {
+		run, err := w.meteringService.SampleStorage(ctx)
+		if err != nil {
+			log.Printf("Storage metering: %v", err)
+		}
+		if run != nil && run.Recorded > 0 {
+			log.Printf("Storage metering: recorded the storage of %d of %d tenant(s)", run.Recorded, run.Tenants)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/shared/metering"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeteredUsageIsBilledInArrears(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	_, err := f.metering.SetMeteredPrices(ctx, f.basic.ID, &models.MeteredPricesRequest{Prices: []models.MeteredPrice{
+		{Metric: metering.MetricEmailSends, Description: "Email sends", UnitPrice: 0.05, IncludedQuantity: 100},
+		{Metric: metering.MetricStorageGBMonths, UnitPrice: 0.1},
+	}})
+	require.NoError(t, err)
+	subscription := f.subscribe(f.basic, 14)
+
+	// Usage during the trial is not billed
+	f.report(t, subscription.TenantID, metering.MetricEmailSends, 500, time.Date(2026, 4, 5, 0, 0, 0, 0, time.UTC))
+	f.now = time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	require.Len(t, f.billing.invoices, 1)
+	assert.Len(t, f.billing.invoices[0].Lines, 1)
+	f.pay(t, f.billing.invoices[0])
+
+	f.report(t, subscription.TenantID, metering.MetricEmailSends, 340, time.Date(2026, 4, 20, 0, 0, 0, 0, time.UTC))
+	f.report(t, subscription.TenantID, metering.MetricStorageGBMonths, 25, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC))
+	f.report(t, subscription.TenantID, "api_calls", 1000, time.Date(2026, 5, 2, 0, 0, 0, 0, time.UTC))
+
+	f.now = time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)
+	usage, err := f.metering.GetPeriodUsage(ctx, subscription.TenantID)
+	require.NoError(t, err)
+	assert.True(t, usage.Billed)
+	require.Len(t, usage.Metrics, 3)
+	assert.Equal(t, models.MeteredUsage{Metric: "api_calls", Quantity: 1000}, usage.Metrics[0], "unpriced metrics cost nothing")
+	assert.Equal(t, 14.5, usage.Amount)
+
+	// The renewal bills the period that ended with the one that starts
+	f.now = time.Date(2026, 5, 15, 0, 0, 0, 0, time.UTC)
+	f.run(t)
+	require.Len(t, f.billing.invoices, 2)
+	invoice := f.billing.invoices[1]
+	assert.Equal(t, models.InvoiceReasonSubscriptionCycle, invoice.Reason)
+	require.Len(t, invoice.Lines, 3)
+	assert.Equal(t, models.InvoiceLineSubscription, invoice.Lines[0].Kind)
+	emails, storage := invoice.Lines[1], invoice.Lines[2]
+	assert.Equal(t, models.InvoiceLineMetered, emails.Kind)
+	assert.Equal(t, "Email sends", emails.Description)
+	assert.Equal(t, 240.0, emails.Quantity, "100 sends are included")
+	assert.Equal(t, 12.0, emails.Amount)
+	assert.Equal(t, time.Date(2026, 4, 15, 0, 0, 0, 0, time.UTC), emails.PeriodStart)
+	assert.Equal(t, time.Date(2026, 5, 15, 0, 0, 0, 0, time.UTC), emails.PeriodEnd)
+	assert.Equal(t, metering.MetricStorageGBMonths, storage.Description, "the metric describes a price without a description")
+	assert.Equal(t, 2.5, storage.Amount)
+	assert.Equal(t, 63.5, invoice.Total)
+	f.pay(t, invoice)
+
+	// Cancelling bills the usage of the last period on an invoice of its own
+	f.report(t, subscription.TenantID, metering.MetricStorageGBMonths, 10, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC))
+	subscription.CancelAtPeriodEnd = true
+	f.now = time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC)
+	run := f.run(t)
+	assert.Equal(t, 1, run.Cancelled)
+	assert.Equal(t, 1, run.Invoiced)
+	require.Len(t, f.billing.invoices, 3)
+	final := f.billing.invoices[2]
+	assert.Equal(t, models.InvoiceReasonUsage, final.Reason)
+	assert.Equal(t, 1.0, final.Total)
+	assert.Equal(t, time.Date(2026, 5, 15, 0, 0, 0, 0, time.UTC), final.PeriodStart)
+	assert.Equal(t, time.Date(2026, 6, 15, 0, 0, 0, 0, time.UTC), final.PeriodEnd)
+}
+
+func TestOnlyReportedMetricsArePriced(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+
+	for _, metric := range []string{"sms_sends", "pos_transactions", "api_calls"} {
+		_, err := f.metering.SetMeteredPrices(ctx, f.basic.ID, &models.MeteredPricesRequest{Prices: []models.MeteredPrice{
+			{Metric: metering.MetricEmailSends, UnitPrice: 0.05},
+			{Metric: metric, UnitPrice: 0.1},
+		}})
+		assert.ErrorContains(t, err, "is not metered", metric)
+	}
+	prices, err := f.metering.ListMeteredPrices(ctx, f.basic.ID)
+	require.NoError(t, err)
+	assert.Empty(t, prices, "a rejected catalog saves nothing")
+}
+
+func TestRecordUsageDeduplicatesAndValidates(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	tenantID := uuid.New().String()
+
+	event := models.UsageEventInput{TenantID: tenantID, Metric: metering.MetricEmailSends, Quantity: 1, IdempotencyKey: "email-1"}
+	recorded, err := f.metering.RecordUsage(ctx, &models.RecordUsageRequest{Source: "auth-service", Events: []models.UsageEventInput{event, event}})
+	require.NoError(t, err)
+	assert.Equal(t, &models.UsageRecorded{Recorded: 1, Duplicates: 1}, recorded)
+
+	// A retried report is counted once
+	recorded, err = f.metering.RecordUsage(ctx, &models.RecordUsageRequest{Source: "auth-service", Events: []models.UsageEventInput{event}})
+	require.NoError(t, err)
+	assert.Equal(t, 0, recorded.Recorded)
+	require.Len(t, f.usage.events, 1)
+	assert.Equal(t, f.now, f.usage.events[0].OccurredAt)
+	assert.Equal(t, "auth-service", f.usage.events[0].Source)
+
+	future := f.now.Add(time.Hour)
+	for _, invalid := range []models.UsageEventInput{
+		{TenantID: "acme", Metric: "email_sends", Quantity: 1, IdempotencyKey: "k"},
+		{TenantID: tenantID, Metric: "Email Sends", Quantity: 1, IdempotencyKey: "k"},
+		{TenantID: tenantID, Metric: "email_sends", Quantity: 0, IdempotencyKey: "k"},
+		{TenantID: tenantID, Metric: "email_sends", Quantity: 1},
+		{TenantID: tenantID, Metric: "email_sends", Quantity: 1, IdempotencyKey: "k", OccurredAt: &future},
+	} {
+		_, err := f.metering.RecordUsage(ctx, &models.RecordUsageRequest{Events: []models.UsageEventInput{event, invalid}})
+		assert.Error(t, err, "%+v", invalid)
+	}
+	assert.Len(t, f.usage.events, 1, "a batch with an invalid event records nothing")
+}
+
+func TestSampleStorageRecordsOneDayOfGBMonths(t *testing.T) {
+	f := newBillingFixture()
+	ctx := context.Background()
+	tenantID := uuid.New()
+	f.usage.stored = map[uuid.UUID]int64{tenantID: 30 * bytesPerGB, uuid.New(): 0}
+
+	run, err := f.metering.SampleStorage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, run.Tenants)
+	assert.Equal(t, 1, run.Recorded, "tenants storing nothing have nothing to record")
+
+	f.now = f.now.Add(6 * time.Hour)
+	run, err = f.metering.SampleStorage(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, run.Recorded, "a day is sampled once")
+
+	usage, err := f.usage.SumUsage(ctx, tenantID, f.now.AddDate(0, 0, -1), f.now)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, usage[metering.MetricStorageGBMonths], "30 GB for a day of April is 1 GB-month")
+}
+
+// report records usage as it happens, moving the clock to at
+func (f *billingFixture) report(t *testing.T, tenantID uuid.UUID, metric string, quantity float64, at time.Time) {
+	t.Helper()
+	f.now = at
+	_, err := f.metering.RecordUsage(context.Background(), &models.RecordUsageRequest{Events: []models.UsageEventInput{{
+		TenantID:       tenantID.String(),
+		Metric:         metric,
+		Quantity:       quantity,
+		OccurredAt:     &at,
+		IdempotencyKey: fmt.Sprintf("%s-%s", metric, at.Format(time.RFC3339)),
+	}}})
+	require.NoError(t, err)
+}
+
+type fakeMeteringRepository struct {
+	events []*models.UsageEvent
+	prices map[uuid.UUID][]models.MeteredPrice
+	stored map[uuid.UUID]int64
+}
+
+func newFakeMeteringRepository() *fakeMeteringRepository {
+	return &fakeMeteringRepository{prices: map[uuid.UUID][]models.MeteredPrice{}}
+}
+
+func (r *fakeMeteringRepository) RecordEvents(ctx context.Context, events []*models.UsageEvent) (int, error) {
+	recorded := 0
+	for _, event := range events {
+		duplicate := false
+		for _, existing := range r.events {
+			if existing.TenantID == event.TenantID && existing.Metric == event.Metric && existing.IdempotencyKey == event.IdempotencyKey {
+				duplicate = true
+			}
+		}
+		if !duplicate {
+			event.ID = uuid.New()
+			r.events = append(r.events, event)
+			recorded++
+		}
+	}
+	return recorded, nil
+}
+
+func (r *fakeMeteringRepository) SumUsage(ctx context.Context, tenantID uuid.UUID, from, to time.Time) (map[string]float64, error) {
+	usage := map[string]float64{}
+	for _, event := range r.events {
+		if event.TenantID == tenantID && !event.OccurredAt.Before(from) && event.OccurredAt.Before(to) {
+			usage[event.Metric] += event.Quantity
+		}
+	}
+	return usage, nil
+}
+
+func (r *fakeMeteringRepository) ListMeteredPrices(ctx context.Context, planID uuid.UUID) ([]*models.MeteredPrice, error) {
+	prices := []*models.MeteredPrice{}
+	for _, price := range r.prices[planID] {
+		price := price
+		prices = append(prices, &price)
+	}
+	return prices, nil
+}
+
+func (r *fakeMeteringRepository) SetMeteredPrices(ctx context.Context, planID uuid.UUID, prices []models.MeteredPrice) error {
+	r.prices[planID] = append([]models.MeteredPrice(nil), prices...)
+	return nil
+}
+
+func (r *fakeMeteringRepository) ListStoredBytes(ctx context.Context) (map[uuid.UUID]int64, error) {
+	return r.stored, nil
+}
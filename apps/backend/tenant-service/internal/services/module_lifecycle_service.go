@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+	"zplus-saas/apps/backend/shared/modulehooks"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+)
+
+const (
+	moduleLifecycleInterval = 15 * time.Second
+	// moduleHookLease is how long a running hook may take before another
+	// run delivers it again
+	moduleHookLease       = 10 * time.Minute
+	moduleHookMaxAttempts = 6
+	moduleHookBackoff     = 30 * time.Second
+	moduleHookMaxBackoff  = time.Hour
+	moduleJobBatchSize    = 20
+	// moduleLifecycleRounds bounds how many jobs of one batch a run
+	// delivers one after the other
+	moduleLifecycleRounds = 10
+)
+
+// ModuleHookInvoker runs a lifecycle hook on the service implementing the
+// module
+type ModuleHookInvoker interface {
+	Invoke(ctx context.Context, req *modulehooks.Request) error
+}
+
+type moduleHookInvoker struct {
+	client   *modulehooks.Client
+	services map[string]string
+}
+
+// NewModuleHookInvoker runs hooks on the services implementing the modules
+// of the same name. Other modules need no service and their hooks succeed.
+func NewModuleHookInvoker(cfg *config.Config) ModuleHookInvoker {
+	return &moduleHookInvoker{
+		client: modulehooks.NewClient(cfg, "tenant-service"),
+		services: map[string]string{
+			"crm":     cfg.CRMServiceURL,
+			"hrm":     cfg.HRMServiceURL,
+			"pos":     cfg.POSServiceURL,
+			"lms":     cfg.LMSServiceURL,
+			"checkin": cfg.CheckinServiceURL,
+			"payment": cfg.PaymentServiceURL,
+		},
+	}
+}
+
+func (i *moduleHookInvoker) Invoke(ctx context.Context, req *modulehooks.Request) error {
+	url := i.services[req.Module]
+	if url == "" {
+		return nil
+	}
+	return i.client.Invoke(ctx, url, req)
+}
+
+// ModuleLifecycleService delivers the lifecycle hooks queued when tenants'
+// modules are installed, upgraded, rolled back, enabled, disabled or
+// uninstalled
+type ModuleLifecycleService interface {
+	ProcessDue(ctx context.Context) (*models.ModuleLifecycleRun, error)
+}
+
+type moduleLifecycleService struct {
+	lifecycleRepo repositories.ModuleLifecycleRepository
+	hooks         ModuleHookInvoker
+	now           func() time.Time
+}
+
+func NewModuleLifecycleService(lifecycleRepo repositories.ModuleLifecycleRepository, hooks ModuleHookInvoker) ModuleLifecycleService {
+	return &moduleLifecycleService{
+		lifecycleRepo: lifecycleRepo,
+		hooks:         hooks,
+		now:           time.Now,
+	}
+}
+
+func (s *moduleLifecycleService) ProcessDue(ctx context.Context) (*models.ModuleLifecycleRun, error) {
+	run := &models.ModuleLifecycleRun{}
+
+	// Each round claims the next job of every batch, so a module's
+	// dependencies are set up before it within one run
+	for round := 0; round < moduleLifecycleRounds; round++ {
+		jobs, err := s.lifecycleRepo.ClaimDue(ctx, s.now(), moduleHookLease, moduleJobBatchSize)
+		if err != nil {
+			return run, fmt.Errorf("failed to claim lifecycle jobs: %w", err)
+		}
+		if len(jobs) == 0 {
+			break
+		}
+
+		for _, job := range jobs {
+			run.Jobs++
+			if err := s.process(ctx, job, run); err != nil {
+				log.Printf("Module lifecycle: failed to record %s of %s for tenant %s: %v", job.Event, job.ModuleName, job.TenantID, err)
+			}
+		}
+	}
+
+	return run, nil
+}
+
+func (s *moduleLifecycleService) process(ctx context.Context, job *models.ModuleLifecycleJob, run *models.ModuleLifecycleRun) error {
+	req := &modulehooks.Request{
+		Event:    job.Event,
+		TenantID: job.TenantID.String(),
+		Module:   job.ModuleName,
+		Version:  job.Version,
+		Attempt:  job.Attempts,
+	}
+	if job.FromVersion != nil {
+		req.FromVersion = *job.FromVersion
+	}
+	if json.Valid([]byte(job.Config)) {
+		req.Config = json.RawMessage(job.Config)
+	}
+
+	hookErr := s.hooks.Invoke(ctx, req)
+	if hookErr == nil {
+		run.Succeeded++
+		return s.lifecycleRepo.Succeed(ctx, job, s.now())
+	}
+
+	message := hookErr.Error()
+	if job.Attempts >= moduleHookMaxAttempts && job.Event == models.ModuleEventUpgrade && job.UpgradeID != nil && job.FromVersion != nil {
+		run.RolledBack++
+		log.Printf("Module lifecycle: upgrade of %s for tenant %s to %s failed after %d attempts, rolling back to %s: %v", job.ModuleName, job.TenantID, job.Version, job.Attempts, *job.FromVersion, hookErr)
+		return s.lifecycleRepo.RollBack(ctx, job, message, s.now())
+	}
+	if job.Attempts >= moduleHookMaxAttempts {
+		run.Failed++
+		log.Printf("Module lifecycle: %s of %s for tenant %s failed after %d attempts: %v", job.Event, job.ModuleName, job.TenantID, job.Attempts, hookErr)
+		return s.lifecycleRepo.Fail(ctx, job, message, s.now())
+	}
+
+	run.Retried++
+	return s.lifecycleRepo.Retry(ctx, job, s.now().Add(moduleHookRetryDelay(job.Attempts)), message)
+}
+
+// moduleHookRetryDelay doubles the delay with every failed attempt
+func moduleHookRetryDelay(attempts int) time.Duration {
+	delay := moduleHookBackoff
+	for i := 1; i < attempts && delay < moduleHookMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > moduleHookMaxBackoff {
+		delay = moduleHookMaxBackoff
+	}
+	return delay
+}
+
+// ModuleLifecycleWorker delivers lifecycle hooks on a schedule
+type ModuleLifecycleWorker struct {
+	lifecycleService ModuleLifecycleService
+}
+
+func NewModuleLifecycleWorker(lifecycleService ModuleLifecycleService) *ModuleLifecycleWorker {
+	return &ModuleLifecycleWorker{lifecycleService: lifecycleService}
+}
+
+// Run delivers due hooks every moduleLifecycleInterval until ctx is
+// cancelled
+func (w *ModuleLifecycleWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(moduleLifecycleInterval)
+	defer ticker.Stop()
+
+	for {
+		run, err := w.lifecycleService.ProcessDue(ctx)
+		if err != nil {
+			log.Printf("Module lifecycle run: %v", err)
+		}
+		if run != nil && run.Jobs > 0 {
+			log.Printf("Module lifecycle run: %d job(s), %d succeeded, %d retried, %d failed, %d rolled back",
+				run.Jobs, run.Succeeded, run.Retried, run.Failed, run.RolledBack)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/shared/modulehooks"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModuleLifecycleRunsBatchInOrder(t *testing.T) {
+	f := newModuleLifecycleFixture()
+	batch := uuid.New()
+	core := f.queue(batch, "core", models.ModuleEventInstall)
+	crm := f.queue(batch, "crm", models.ModuleEventInstall)
+	f.queue(uuid.New(), "hrm", models.ModuleEventEnable)
+
+	run, err := f.service.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &models.ModuleLifecycleRun{Jobs: 3, Succeeded: 3}, run)
+	assert.Equal(t, []string{"hrm enable", "crm install"}, f.hooks.calls, "core has no service; crm only runs after it")
+	assert.Equal(t, models.ModuleJobSucceeded, core.Status)
+	assert.Equal(t, models.ModuleJobSucceeded, crm.Status)
+	assert.Equal(t, models.ModuleStatusInstalled, f.installations[crm.InstallationID])
+}
+
+func TestModuleLifecycleRetriesWithBackoff(t *testing.T) {
+	f := newModuleLifecycleFixture()
+	crm := f.queue(uuid.New(), "crm", models.ModuleEventInstall)
+	f.hooks.fail["crm"] = 2
+
+	run, err := f.service.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, run.Retried)
+	assert.Equal(t, models.ModuleJobPending, crm.Status)
+	assert.Equal(t, f.now.Add(30*time.Second), crm.NextAttemptAt)
+	assert.Equal(t, "crm unavailable", *crm.ErrorMessage)
+	assert.Equal(t, models.ModuleStatusInstalling, f.installations[crm.InstallationID])
+
+	// Not due yet
+	run, err = f.service.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, run.Jobs)
+
+	f.now = f.now.Add(30 * time.Second)
+	_, err = f.service.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, f.now.Add(time.Minute), crm.NextAttemptAt, "the delay doubles")
+
+	f.now = f.now.Add(time.Minute)
+	run, err = f.service.ProcessDue(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, run.Succeeded)
+	assert.Equal(t, 3, crm.Attempts)
+	assert.Equal(t, []int{1, 2, 3}, f.hooks.attempts["crm"])
+	assert.Equal(t, models.ModuleStatusInstalled, f.installations[crm.InstallationID])
+
+	assert.Equal(t, time.Hour, moduleHookRetryDelay(20))
+}
+
+func TestModuleLifecycleFailsBatchAfterMaxAttempts(t *testing.T) {
+	f := newModuleLifecycleFixture()
+	batch := uuid.New()
+	crm := f.queue(batch, "crm", models.ModuleEventInstall)
+	reports := f.queue(batch, "crm-reports", models.ModuleEventInstall)
+	f.hooks.fail["crm"] = moduleHookMaxAttempts
+
+	for i := 0; i < moduleHookMaxAttempts; i++ {
+		_, err := f.service.ProcessDue(context.Background())
+		require.NoError(t, err)
+		f.now = f.now.Add(moduleHookMaxBackoff)
+	}
+
+	assert.Equal(t, models.ModuleJobFailed, crm.Status)
+	assert.Equal(t, moduleHookMaxAttempts, crm.Attempts)
+	assert.Equal(t, models.ModuleStatusFailed, f.installations[crm.InstallationID])
+	assert.Equal(t, models.ModuleJobFailed, reports.Status, "jobs after a failed one fail with it")
+	assert.Zero(t, reports.Attempts)
+	assert.NotContains(t, f.hooks.calls, "crm-reports install")
+}
+
+func TestModuleLifecycleRollsBackFailedUpgrade(t *testing.T) {
+	f := newModuleLifecycleFixture()
+	upgrade := f.queue(uuid.New(), "crm", models.ModuleEventUpgrade)
+	upgradeID, fromVersion := uuid.New(), "1.0.0"
+	upgrade.Version, upgrade.FromVersion, upgrade.UpgradeID = "1.1.0", &fromVersion, &upgradeID
+	f.installations[upgrade.InstallationID] = models.ModuleStatusUpdating
+	f.repo.versions[upgrade.InstallationID] = "1.0.0"
+	f.hooks.fail["crm"] = moduleHookMaxAttempts
+
+	var run *models.ModuleLifecycleRun
+	for i := 0; i < moduleHookMaxAttempts; i++ {
+		var err error
+		run, err = f.service.ProcessDue(context.Background())
+		require.NoError(t, err)
+		f.now = f.now.Add(moduleHookMaxBackoff)
+	}
+
+	assert.Equal(t, &models.ModuleLifecycleRun{Jobs: 2, Succeeded: 1, RolledBack: 1}, run, "the rollback runs in the same run")
+	assert.Equal(t, []string{"crm upgrade", "crm upgrade", "crm upgrade", "crm upgrade", "crm upgrade", "crm upgrade", "crm rollback"}, f.hooks.calls)
+	rollback := f.repo.jobs[1]
+	assert.Equal(t, "1.0.0", rollback.Version)
+	assert.Equal(t, "1.1.0", *rollback.FromVersion)
+	assert.Equal(t, models.ModuleJobFailed, upgrade.Status)
+	assert.Equal(t, models.ModuleUpgradeRolledBack, f.repo.upgrades[upgradeID])
+	assert.Equal(t, models.ModuleStatusInstalled, f.installations[upgrade.InstallationID])
+	assert.Equal(t, "1.0.0", f.repo.versions[upgrade.InstallationID])
+}
+
+type fakeModuleHookInvoker struct {
+	calls    []string
+	attempts map[string][]int
+	// fail is how many times a module's hook fails before it succeeds
+	fail map[string]int
+}
+
+func (i *fakeModuleHookInvoker) Invoke(ctx context.Context, req *modulehooks.Request) error {
+	// Like the real invoker, modules without a service succeed
+	if req.Module == "core" {
+		return nil
+	}
+	i.calls = append(i.calls, req.Module+" "+req.Event)
+	i.attempts[req.Module] = append(i.attempts[req.Module], req.Attempt)
+	if i.fail[req.Module] > 0 {
+		i.fail[req.Module]--
+		return errors.New(req.Module + " unavailable")
+	}
+	return nil
+}
+
+type fakeModuleLifecycleRepository struct {
+	jobs          []*models.ModuleLifecycleJob
+	installations map[uuid.UUID]string
+	versions      map[uuid.UUID]string
+	upgrades      map[uuid.UUID]string
+}
+
+func (r *fakeModuleLifecycleRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ModuleLifecycleJob, error) {
+	due := []*models.ModuleLifecycleJob{}
+	for _, job := range r.jobs {
+		if job.Status != models.ModuleJobPending || job.NextAttemptAt.After(now) || !r.previousSucceeded(job) {
+			continue
+		}
+		due = append(due, job)
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	for _, job := range due {
+		job.Status = models.ModuleJobRunning
+		job.Attempts++
+	}
+	return due, nil
+}
+
+func (r *fakeModuleLifecycleRepository) previousSucceeded(job *models.ModuleLifecycleJob) bool {
+	for _, other := range r.jobs {
+		if other.BatchID == job.BatchID && other.Position < job.Position && other.Status != models.ModuleJobSucceeded {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *fakeModuleLifecycleRepository) Succeed(ctx context.Context, job *models.ModuleLifecycleJob, now time.Time) error {
+	job.Status = models.ModuleJobSucceeded
+	job.ErrorMessage = nil
+	job.FinishedAt = &now
+	switch job.Event {
+	case models.ModuleEventInstall:
+		r.installations[job.InstallationID] = models.ModuleStatusInstalled
+	case models.ModuleEventUpgrade, models.ModuleEventRollback:
+		r.installations[job.InstallationID] = models.ModuleStatusInstalled
+		r.versions[job.InstallationID] = job.Version
+	}
+	if job.UpgradeID != nil {
+		r.upgrades[*job.UpgradeID] = models.ModuleUpgradeCompleted
+		if job.Event == models.ModuleEventRollback {
+			r.upgrades[*job.UpgradeID] = models.ModuleUpgradeRolledBack
+		}
+	}
+	return nil
+}
+
+func (r *fakeModuleLifecycleRepository) Retry(ctx context.Context, job *models.ModuleLifecycleJob, nextAttemptAt time.Time, message string) error {
+	job.Status = models.ModuleJobPending
+	job.NextAttemptAt = nextAttemptAt
+	job.ErrorMessage = &message
+	return nil
+}
+
+func (r *fakeModuleLifecycleRepository) Fail(ctx context.Context, job *models.ModuleLifecycleJob, message string, now time.Time) error {
+	for _, other := range r.jobs {
+		if other == job || other.BatchID == job.BatchID && other.Position > job.Position && other.Status == models.ModuleJobPending {
+			other.Status = models.ModuleJobFailed
+			other.FinishedAt = &now
+			if other.Event != models.ModuleEventEnable && other.Event != models.ModuleEventDisable {
+				r.installations[other.InstallationID] = models.ModuleStatusFailed
+			}
+		}
+	}
+	job.ErrorMessage = &message
+	return nil
+}
+
+func (r *fakeModuleLifecycleRepository) RollBack(ctx context.Context, job *models.ModuleLifecycleJob, message string, now time.Time) error {
+	job.Status = models.ModuleJobFailed
+	job.ErrorMessage = &message
+	version := job.Version
+	rollback := *job
+	rollback.ID, rollback.BatchID, rollback.Position = uuid.New(), uuid.New(), 0
+	rollback.Event, rollback.Version, rollback.FromVersion = models.ModuleEventRollback, *job.FromVersion, &version
+	rollback.Status, rollback.Attempts, rollback.NextAttemptAt = models.ModuleJobPending, 0, now
+	r.jobs = append(r.jobs, &rollback)
+	r.upgrades[*job.UpgradeID] = models.ModuleUpgradeRollingBack
+	return nil
+}
+
+type moduleLifecycleFixture struct {
+	now           time.Time
+	hooks         *fakeModuleHookInvoker
+	repo          *fakeModuleLifecycleRepository
+	installations map[uuid.UUID]string
+	service       *moduleLifecycleService
+}
+
+func newModuleLifecycleFixture() *moduleLifecycleFixture {
+	f := &moduleLifecycleFixture{
+		now:           time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC),
+		hooks:         &fakeModuleHookInvoker{attempts: map[string][]int{}, fail: map[string]int{}},
+		installations: map[uuid.UUID]string{},
+	}
+	f.repo = &fakeModuleLifecycleRepository{installations: f.installations, versions: map[uuid.UUID]string{}, upgrades: map[uuid.UUID]string{}}
+	f.service = NewModuleLifecycleService(f.repo, f.hooks).(*moduleLifecycleService)
+	f.service.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *moduleLifecycleFixture) queue(batchID uuid.UUID, module, event string) *models.ModuleLifecycleJob {
+	position := 0
+	for _, job := range f.repo.jobs {
+		if job.BatchID == batchID {
+			position++
+		}
+	}
+	job := &models.ModuleLifecycleJob{
+		ID:             uuid.New(),
+		InstallationID: uuid.New(),
+		TenantID:       uuid.New(),
+		ModuleID:       uuid.New(),
+		BatchID:        batchID,
+		Position:       position,
+		Event:          event,
+		Version:        "1.0.0",
+		Status:         models.ModuleJobPending,
+		NextAttemptAt:  f.now,
+		ModuleName:     module,
+		Config:         "{}",
+	}
+	f.repo.jobs = append(f.repo.jobs, job)
+	f.installations[job.InstallationID] = models.ModuleStatusInstalling
+	return job
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"zplus-saas/apps/backend/shared/semver"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+)
+
+// installedModule is a module a tenant has installed
+type installedModule struct {
+	Version string
+	Enabled bool
+}
+
+// moduleCatalog is every module with its dependencies and what a tenant
+// has installed, which install and uninstall plans are resolved against
+type moduleCatalog struct {
+	modules      map[uuid.UUID]models.Module
+	dependencies map[uuid.UUID][]models.ModuleDependency
+	installed    map[uuid.UUID]installedModule
+}
+
+func newModuleCatalog(modules []models.Module, dependencies []models.ModuleDependency, installed map[uuid.UUID]installedModule) *moduleCatalog {
+	catalog := &moduleCatalog{
+		modules:      map[uuid.UUID]models.Module{},
+		dependencies: map[uuid.UUID][]models.ModuleDependency{},
+		installed:    installed,
+	}
+	for _, module := range modules {
+		catalog.modules[module.ID] = module
+	}
+	for _, dep := range dependencies {
+		catalog.dependencies[dep.ModuleID] = append(catalog.dependencies[dep.ModuleID], dep)
+	}
+	return catalog
+}
+
+func (c *moduleCatalog) name(moduleID uuid.UUID) string {
+	if module, ok := c.modules[moduleID]; ok {
+		return module.Name
+	}
+	return moduleID.String()
+}
+
+// installResolver walks a module's required dependencies depth first, so
+// each step is added after the steps of its dependencies
+type installResolver struct {
+	catalog  *moduleCatalog
+	plan     *models.ModuleInstallPlan
+	steps    map[uuid.UUID]int
+	visiting map[uuid.UUID]bool
+	path     []string
+}
+
+// planInstall resolves what installing the module takes: its missing
+// dependencies, transitively, and the disabled ones to enable again. Version
+// constraints are checked against the installed version of a dependency, or
+// the version that would be installed.
+func planInstall(catalog *moduleCatalog, moduleID uuid.UUID) *models.ModuleInstallPlan {
+	r := &installResolver{
+		catalog:  catalog,
+		plan:     &models.ModuleInstallPlan{ModuleID: moduleID, Steps: []models.ModulePlanStep{}},
+		steps:    map[uuid.UUID]int{},
+		visiting: map[uuid.UUID]bool{},
+	}
+	r.visit(moduleID, "")
+	r.checkConflicts()
+	r.plan.Installable = len(r.plan.Conflicts) == 0
+	return r.plan
+}
+
+func (r *installResolver) conflict(format string, args ...interface{}) {
+	r.plan.Conflicts = append(r.plan.Conflicts, fmt.Sprintf(format, args...))
+}
+
+func (r *installResolver) visit(moduleID uuid.UUID, requiredBy string) {
+	if i, ok := r.steps[moduleID]; ok {
+		if requiredBy != "" {
+			r.plan.Steps[i].RequiredBy = append(r.plan.Steps[i].RequiredBy, requiredBy)
+		}
+		return
+	}
+
+	module, ok := r.catalog.modules[moduleID]
+	if !ok {
+		r.conflict("module %s not found", moduleID)
+		return
+	}
+	if r.visiting[moduleID] {
+		r.conflict("dependency cycle: %s -> %s", strings.Join(r.path, " -> "), module.Name)
+		return
+	}
+
+	step := models.ModulePlanStep{ModuleID: moduleID, Name: module.Name, Version: module.Version, Action: models.ModulePlanInstall}
+	if installed, ok := r.catalog.installed[moduleID]; ok {
+		if installed.Enabled {
+			return
+		}
+		step.Action = models.ModulePlanEnable
+		step.Version = installed.Version
+	} else if !module.IsActive {
+		r.conflict("module %s is not available", module.Name)
+		return
+	}
+	if requiredBy != "" {
+		step.RequiredBy = []string{requiredBy}
+	}
+
+	r.visiting[moduleID] = true
+	r.path = append(r.path, module.Name)
+	for _, dep := range r.catalog.dependencies[moduleID] {
+		if dep.ConflictsWith {
+			continue
+		}
+		target, ok := r.catalog.modules[dep.DependsOnID]
+		if !ok {
+			r.conflict("%s depends on unknown module %s", module.Name, dep.DependsOnID)
+			continue
+		}
+
+		version, present := target.Version, true
+		if installed, ok := r.catalog.installed[target.ID]; ok {
+			version = installed.Version
+		} else if !dep.IsRequired {
+			present = false
+		}
+		if present {
+			satisfied, err := semver.Satisfies(version, dep.MinVersion)
+			if err != nil {
+				r.conflict("%s depends on %s: %v", module.Name, target.Name, err)
+				continue
+			}
+			if !satisfied {
+				r.conflict("%s requires %s %s, but %s is %s", module.Name, target.Name, dep.MinVersion, version, r.availability(target.ID))
+				continue
+			}
+		}
+		if dep.IsRequired {
+			r.visit(target.ID, module.Name)
+		}
+	}
+	r.path = r.path[:len(r.path)-1]
+	delete(r.visiting, moduleID)
+
+	r.steps[moduleID] = len(r.plan.Steps)
+	r.plan.Steps = append(r.plan.Steps, step)
+}
+
+func (r *installResolver) availability(moduleID uuid.UUID) string {
+	if _, ok := r.catalog.installed[moduleID]; ok {
+		return "installed"
+	}
+	return "available"
+}
+
+// checkConflicts refuses a plan that would leave two conflicting modules
+// installed, whichever of them declared the conflict
+func (r *installResolver) checkConflicts() {
+	present := map[uuid.UUID]string{}
+	for moduleID, installed := range r.catalog.installed {
+		present[moduleID] = installed.Version
+	}
+	for _, step := range r.plan.Steps {
+		present[step.ModuleID] = step.Version
+	}
+
+	ids := make([]uuid.UUID, 0, len(present))
+	for moduleID := range present {
+		ids = append(ids, moduleID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return r.catalog.name(ids[i]) < r.catalog.name(ids[j]) })
+
+	for _, moduleID := range ids {
+		for _, dep := range r.catalog.dependencies[moduleID] {
+			if !dep.ConflictsWith {
+				continue
+			}
+			_, planned := r.steps[moduleID]
+			_, plannedOther := r.steps[dep.DependsOnID]
+			version, ok := present[dep.DependsOnID]
+			if !ok || !planned && !plannedOther {
+				continue
+			}
+			conflicting, err := semver.Satisfies(version, dep.MinVersion)
+			if err != nil {
+				r.conflict("%s conflicts with %s: %v", r.catalog.name(moduleID), r.catalog.name(dep.DependsOnID), err)
+				continue
+			}
+			if conflicting {
+				r.conflict("%s conflicts with %s %s", r.catalog.name(moduleID), r.catalog.name(dep.DependsOnID), version)
+			}
+		}
+	}
+}
+
+// planUninstall resolves what uninstalling the module takes: the enabled
+// modules requiring it, transitively, uninstalled before it
+func planUninstall(catalog *moduleCatalog, moduleID uuid.UUID) *models.ModuleUninstallPlan {
+	dependents := map[uuid.UUID][]uuid.UUID{}
+	for id, deps := range catalog.dependencies {
+		installed, ok := catalog.installed[id]
+		if !ok || !installed.Enabled {
+			continue
+		}
+		for _, dep := range deps {
+			if dep.IsRequired && !dep.ConflictsWith {
+				dependents[dep.DependsOnID] = append(dependents[dep.DependsOnID], id)
+			}
+		}
+	}
+
+	plan := &models.ModuleUninstallPlan{ModuleID: moduleID, Steps: []models.ModulePlanStep{}}
+	visited := map[uuid.UUID]bool{}
+	var visit func(id uuid.UUID, forModule string)
+	visit = func(id uuid.UUID, forModule string) {
+		if visited[id] {
+			return
+		}
+		visited[id] = true
+
+		children := dependents[id]
+		sort.Slice(children, func(i, j int) bool { return catalog.name(children[i]) < catalog.name(children[j]) })
+		for _, child := range children {
+			visit(child, catalog.name(id))
+		}
+
+		step := models.ModulePlanStep{ModuleID: id, Name: catalog.name(id), Version: catalog.installed[id].Version, Action: models.ModulePlanUninstall}
+		if forModule != "" {
+			step.RequiredBy = []string{forModule}
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	visit(moduleID, "")
+
+	return plan
+}
+
+// versionConflicts reports what keeps an installed module from moving to
+// version: the installed modules requiring it with a constraint version
+// does not meet and the ones conflicting with it. Upgrades also check the
+// module's own dependencies, which the catalog only knows for its current
+// version.
+func versionConflicts(catalog *moduleCatalog, moduleID uuid.UUID, version string, checkDependencies bool) []string {
+	conflicts := []string{}
+	name := catalog.name(moduleID)
+	// satisfies reports an invalid constraint as a conflict of its own
+	satisfies := func(version, constraint, relation string) (ok, valid bool) {
+		ok, err := semver.Satisfies(version, constraint)
+		if err != nil {
+			conflicts = append(conflicts, fmt.Sprintf("%s: %v", relation, err))
+			return false, false
+		}
+		return ok, true
+	}
+
+	ids := make([]uuid.UUID, 0, len(catalog.installed))
+	for id := range catalog.installed {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return catalog.name(ids[i]) < catalog.name(ids[j]) })
+
+	for _, id := range ids {
+		if id == moduleID {
+			continue
+		}
+		for _, dep := range catalog.dependencies[id] {
+			if dep.DependsOnID != moduleID {
+				continue
+			}
+			switch {
+			case dep.ConflictsWith:
+				if ok, _ := satisfies(version, dep.MinVersion, catalog.name(id)+" conflicts with "+name); ok {
+					conflicts = append(conflicts, fmt.Sprintf("%s conflicts with %s %s", catalog.name(id), name, version))
+				}
+			case dep.IsRequired && catalog.installed[id].Enabled:
+				if ok, valid := satisfies(version, dep.MinVersion, catalog.name(id)+" depends on "+name); valid && !ok {
+					conflicts = append(conflicts, fmt.Sprintf("%s requires %s %s, which %s does not meet", catalog.name(id), name, dep.MinVersion, version))
+				}
+			}
+		}
+	}
+
+	if !checkDependencies {
+		return conflicts
+	}
+	for _, dep := range catalog.dependencies[moduleID] {
+		target := catalog.name(dep.DependsOnID)
+		installed, ok := catalog.installed[dep.DependsOnID]
+		switch {
+		case dep.ConflictsWith:
+			if !ok {
+				continue
+			}
+			if conflicting, _ := satisfies(installed.Version, dep.MinVersion, name+" conflicts with "+target); conflicting {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s conflicts with %s %s", name, version, target, installed.Version))
+			}
+		case !dep.IsRequired:
+		case !ok:
+			conflicts = append(conflicts, fmt.Sprintf("%s %s requires %s, which is not installed", name, version, target))
+		default:
+			if satisfied, valid := satisfies(installed.Version, dep.MinVersion, name+" depends on "+target); valid && !satisfied {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s requires %s %s, but %s is installed", name, version, target, dep.MinVersion, installed.Version))
+			}
+		}
+	}
+	return conflicts
+}
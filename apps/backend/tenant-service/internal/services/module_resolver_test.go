@@ -0,0 +1,171 @@
+package services
+
+import (
+	"testing"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanInstallResolvesTransitiveDependenciesInOrder(t *testing.T) {
+	c := newTestModuleCatalog()
+	core := c.add("core", "1.4.0")
+	contacts := c.add("contacts", "2.1.0")
+	crm := c.add("crm", "3.0.0")
+	reports := c.add("reports", "1.0.0")
+	c.require(contacts, core, "^1.2")
+	c.require(crm, contacts, ">=2.0.0")
+	c.require(crm, core, "1.0")
+	c.require(reports, crm, "^3")
+	c.optional(reports, c.add("charts", "1.0.0"), "^1")
+
+	plan := planInstall(c.catalog(), reports)
+	assert.True(t, plan.Installable, plan.Conflicts)
+	assert.Equal(t, []string{"core", "contacts", "crm", "reports"}, stepNames(plan.Steps), "dependencies come first; optional ones are left out")
+	assert.ElementsMatch(t, []string{"contacts", "crm"}, plan.Steps[0].RequiredBy)
+	assert.Empty(t, plan.Steps[3].RequiredBy)
+
+	// Installed dependencies are kept, disabled ones enabled again
+	c.installed[core] = installedModule{Version: "1.3.0", Enabled: true}
+	c.installed[contacts] = installedModule{Version: "2.0.5", Enabled: false}
+	plan = planInstall(c.catalog(), reports)
+	assert.True(t, plan.Installable, plan.Conflicts)
+	assert.Equal(t, []string{"contacts", "crm", "reports"}, stepNames(plan.Steps))
+	assert.Equal(t, models.ModulePlanEnable, plan.Steps[0].Action)
+	assert.Equal(t, "2.0.5", plan.Steps[0].Version)
+}
+
+func TestPlanInstallReportsConflicts(t *testing.T) {
+	c := newTestModuleCatalog()
+	core := c.add("core", "1.4.0")
+	crm := c.add("crm", "3.0.0")
+	legacy := c.add("legacy-crm", "1.0.0")
+	c.require(crm, core, ">=2.0.0")
+	c.conflict(legacy, crm, "")
+
+	plan := planInstall(c.catalog(), crm)
+	assert.False(t, plan.Installable)
+	assert.Equal(t, []string{"crm requires core >=2.0.0, but 1.4.0 is available"}, plan.Conflicts)
+
+	c.installed[core] = installedModule{Version: "2.1.0", Enabled: true}
+	assert.True(t, planInstall(c.catalog(), crm).Installable)
+
+	// A conflict counts whichever module declared it
+	c.installed[legacy] = installedModule{Version: "1.0.0", Enabled: true}
+	plan = planInstall(c.catalog(), crm)
+	assert.Equal(t, []string{"legacy-crm conflicts with crm 3.0.0"}, plan.Conflicts)
+	delete(c.installed, legacy)
+
+	// Versioned conflicts only hold for matching versions
+	c.conflict(crm, c.add("old-sync", "0.9.0"), "<1.0.0")
+	oldSync := c.byName["old-sync"]
+	c.installed[oldSync] = installedModule{Version: "0.9.0", Enabled: true}
+	assert.Equal(t, []string{"crm conflicts with old-sync 0.9.0"}, planInstall(c.catalog(), crm).Conflicts)
+	c.installed[oldSync] = installedModule{Version: "1.2.0", Enabled: true}
+	assert.Empty(t, planInstall(c.catalog(), crm).Conflicts)
+
+	a := c.add("a", "1.0.0")
+	b := c.add("b", "1.0.0")
+	c.require(a, b, "")
+	c.require(b, a, "")
+	plan = planInstall(c.catalog(), a)
+	assert.Equal(t, []string{"dependency cycle: a -> b -> a"}, plan.Conflicts)
+
+	inactive := c.add("retired", "1.0.0")
+	c.modules[len(c.modules)-1].IsActive = false
+	c.require(a, inactive, "")
+	assert.Contains(t, planInstall(c.catalog(), a).Conflicts, "module retired is not available")
+}
+
+func TestPlanUninstallCascadesToDependents(t *testing.T) {
+	c := newTestModuleCatalog()
+	core := c.add("core", "1.0.0")
+	contacts := c.add("contacts", "1.0.0")
+	crm := c.add("crm", "1.0.0")
+	hrm := c.add("hrm", "1.0.0")
+	pos := c.add("pos", "1.0.0")
+	c.require(contacts, core, "")
+	c.require(crm, contacts, "")
+	c.require(hrm, core, "")
+	c.optional(pos, core, "")
+	for _, id := range []uuid.UUID{core, contacts, crm, hrm, pos} {
+		c.installed[id] = installedModule{Version: "1.0.0", Enabled: true}
+	}
+	c.installed[hrm] = installedModule{Version: "1.0.0", Enabled: false}
+
+	plan := planUninstall(c.catalog(), core)
+	assert.Equal(t, []string{"crm", "contacts", "core"}, stepNames(plan.Steps), "dependents go first; disabled and optional ones are not affected")
+	assert.Equal(t, []string{"contacts"}, plan.Steps[0].RequiredBy)
+
+	plan = planUninstall(c.catalog(), crm)
+	assert.Equal(t, []string{"crm"}, stepNames(plan.Steps))
+}
+
+func TestVersionConflicts(t *testing.T) {
+	c := newTestModuleCatalog()
+	core := c.add("core", "2.0.0")
+	crm := c.add("crm", "3.0.0")
+	reports := c.add("crm-reports", "1.0.0")
+	sync := c.add("crm-sync", "1.0.0")
+	c.require(crm, core, "^2")
+	c.require(reports, crm, "^2")
+	c.conflict(sync, crm, ">=3.0.0")
+	c.installed[core] = installedModule{Version: "1.5.0", Enabled: true}
+	c.installed[crm] = installedModule{Version: "2.4.0", Enabled: true}
+	c.installed[reports] = installedModule{Version: "1.0.0", Enabled: true}
+	c.installed[sync] = installedModule{Version: "1.0.0", Enabled: false}
+
+	assert.Equal(t, []string{
+		"crm-reports requires crm ^2, which 3.0.0 does not meet",
+		"crm-sync conflicts with crm 3.0.0",
+		"crm 3.0.0 requires core ^2, but 1.5.0 is installed",
+	}, versionConflicts(c.catalog(), crm, "3.0.0", true))
+
+	// Rolling back only checks the modules depending on it
+	assert.Empty(t, versionConflicts(c.catalog(), crm, "2.1.0", false))
+	assert.Equal(t, []string{"crm-reports requires crm ^2, which 1.9.0 does not meet"}, versionConflicts(c.catalog(), crm, "1.9.0", false))
+}
+
+type testModuleCatalog struct {
+	modules      []models.Module
+	dependencies []models.ModuleDependency
+	installed    map[uuid.UUID]installedModule
+	byName       map[string]uuid.UUID
+}
+
+func newTestModuleCatalog() *testModuleCatalog {
+	return &testModuleCatalog{installed: map[uuid.UUID]installedModule{}, byName: map[string]uuid.UUID{}}
+}
+
+func (c *testModuleCatalog) add(name, version string) uuid.UUID {
+	module := models.Module{ID: uuid.New(), Name: name, Version: version, IsActive: true}
+	c.modules = append(c.modules, module)
+	c.byName[name] = module.ID
+	return module.ID
+}
+
+func (c *testModuleCatalog) require(moduleID, dependsOnID uuid.UUID, constraint string) {
+	c.dependencies = append(c.dependencies, models.ModuleDependency{ModuleID: moduleID, DependsOnID: dependsOnID, MinVersion: constraint, IsRequired: true})
+}
+
+func (c *testModuleCatalog) optional(moduleID, dependsOnID uuid.UUID, constraint string) {
+	c.dependencies = append(c.dependencies, models.ModuleDependency{ModuleID: moduleID, DependsOnID: dependsOnID, MinVersion: constraint})
+}
+
+func (c *testModuleCatalog) conflict(moduleID, conflictsWithID uuid.UUID, constraint string) {
+	c.dependencies = append(c.dependencies, models.ModuleDependency{ModuleID: moduleID, DependsOnID: conflictsWithID, MinVersion: constraint, ConflictsWith: true})
+}
+
+func (c *testModuleCatalog) catalog() *moduleCatalog {
+	return newModuleCatalog(c.modules, c.dependencies, c.installed)
+}
+
+func stepNames(steps []models.ModulePlanStep) []string {
+	names := []string{}
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return names
+}
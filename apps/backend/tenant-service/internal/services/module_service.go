@@ -1,8 +1,10 @@
 package services
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -46,28 +48,23 @@ func (s *ModuleService) GetTenantModules(tenantID uuid.UUID) ([]models.TenantMod
 	return tenantModules, nil
 }
 
-// InstallModule installs a module for a tenant
-func (s *ModuleService) InstallModule(tenantID, moduleID, userID uuid.UUID, version, config string) (*models.ModuleInstallation, error) {
-	// Check if module exists and is active
-	var module models.Module
-	err := s.db.Get(&module, "SELECT * FROM modules WHERE id = $1 AND is_active = true", moduleID)
+// PlanInstall resolves what installing a module for a tenant takes without
+// installing anything
+func (s *ModuleService) PlanInstall(tenantID, moduleID uuid.UUID) (*models.ModuleInstallPlan, error) {
+	catalog, err := s.loadCatalog(s.db, tenantID)
 	if err != nil {
-		return nil, fmt.Errorf("module not found or not active")
+		return nil, err
 	}
+	return resolveInstall(catalog, moduleID)
+}
 
-	// Check if module is already installed
-	var existingInstallation models.ModuleInstallation
-	err = s.db.Get(&existingInstallation,
-		"SELECT id FROM module_installations WHERE tenant_id = $1 AND module_id = $2 AND uninstalled_at IS NULL",
-		tenantID, moduleID)
-	if err == nil {
-		return nil, fmt.Errorf("module is already installed")
-	}
-
-	// Check dependencies
-	err = s.checkModuleDependencies(tenantID, moduleID)
-	if err != nil {
-		return nil, fmt.Errorf("dependency check failed: %w", err)
+// InstallModule installs a module for a tenant together with the
+// dependencies it is missing, all or nothing. The installations stay
+// installing until the lifecycle worker ran their install hooks, in plan
+// order.
+func (s *ModuleService) InstallModule(tenantID, moduleID, userID uuid.UUID, version, config string) (*models.ModuleInstallResult, error) {
+	if config == "" {
+		config = "{}"
 	}
 
 	// Start transaction
@@ -77,12 +74,76 @@ func (s *ModuleService) InstallModule(tenantID, moduleID, userID uuid.UUID, vers
 	}
 	defer tx.Rollback()
 
+	// Resolve against what the tenant has while no other change of its
+	// modules runs
+	if err := lockTenantModules(tx, tenantID); err != nil {
+		return nil, err
+	}
+	catalog, err := s.loadCatalog(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := resolveInstall(catalog, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.Installable {
+		return nil, fmt.Errorf("dependency check failed: %s", strings.Join(plan.Conflicts, "; "))
+	}
+	if version != "" && version != catalog.modules[moduleID].Version {
+		return nil, fmt.Errorf("version %s of module %s is not available", version, catalog.modules[moduleID].Name)
+	}
+
+	result := &models.ModuleInstallResult{Plan: plan, Installations: []*models.ModuleInstallation{}}
+	batch := newLifecycleBatch(tenantID)
+	for _, step := range plan.Steps {
+		if step.Action == models.ModulePlanEnable {
+			_, err = tx.Exec("UPDATE tenant_modules SET is_enabled = true, updated_at = $1 WHERE tenant_id = $2 AND module_id = $3",
+				time.Now(), tenantID, step.ModuleID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to enable module %s: %w", step.Name, err)
+			}
+			installation, err := currentInstallation(tx, tenantID, step.ModuleID)
+			if err != nil {
+				return nil, err
+			}
+			if err := batch.queue(tx, installation.ID, step.ModuleID, models.ModuleEventEnable, step.Version, nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		stepConfig := "{}"
+		if step.ModuleID == moduleID {
+			stepConfig = config
+		}
+		installation, err := installPlanStep(tx, tenantID, userID, step, stepConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := batch.queue(tx, installation.ID, step.ModuleID, models.ModuleEventInstall, step.Version, nil); err != nil {
+			return nil, err
+		}
+		result.Installations = append(result.Installations, installation)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return result, nil
+}
+
+// installPlanStep records the installation of one module of a plan, which
+// is installing until its install hook succeeded
+func installPlanStep(tx *sqlx.Tx, tenantID, userID uuid.UUID, step models.ModulePlanStep, config string) (*models.ModuleInstallation, error) {
 	// Create module installation record
 	installation := &models.ModuleInstallation{
 		ID:          uuid.New(),
 		TenantID:    tenantID,
-		ModuleID:    moduleID,
-		Version:     version,
+		ModuleID:    step.ModuleID,
+		Version:     step.Version,
 		Status:      models.ModuleStatusInstalling,
 		Config:      config,
 		InstallData: "{}",
@@ -95,16 +156,16 @@ func (s *ModuleService) InstallModule(tenantID, moduleID, userID uuid.UUID, vers
 		INSERT INTO module_installations (id, tenant_id, module_id, version, status, config, install_data, installed_by, installed_at, updated_at)
 		VALUES (:id, :tenant_id, :module_id, :version, :status, :config, :install_data, :installed_by, :installed_at, :updated_at)`
 
-	_, err = tx.NamedExec(installQuery, installation)
+	_, err := tx.NamedExec(installQuery, installation)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create installation record: %w", err)
+		return nil, fmt.Errorf("failed to create installation record for %s: %w", step.Name, err)
 	}
 
 	// Create or update tenant module record
 	tenantModule := &models.TenantModule{
 		ID:          uuid.New(),
 		TenantID:    tenantID,
-		ModuleID:    moduleID,
+		ModuleID:    step.ModuleID,
 		IsEnabled:   true,
 		Config:      config,
 		InstalledAt: time.Now(),
@@ -119,14 +180,93 @@ func (s *ModuleService) InstallModule(tenantID, moduleID, userID uuid.UUID, vers
 
 	_, err = tx.NamedExec(tenantModuleQuery, tenantModule)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create tenant module record: %w", err)
+		return nil, fmt.Errorf("failed to create tenant module record for %s: %w", step.Name, err)
+	}
+
+	return installation, nil
+}
+
+// PlanUninstall resolves what uninstalling a module for a tenant takes
+// without uninstalling anything
+func (s *ModuleService) PlanUninstall(tenantID, moduleID uuid.UUID) (*models.ModuleUninstallPlan, error) {
+	catalog, err := s.loadCatalog(s.db, tenantID)
+	if err != nil {
+		return nil, err
 	}
+	if _, ok := catalog.installed[moduleID]; !ok {
+		return nil, fmt.Errorf("module is not installed")
+	}
+	return planUninstall(catalog, moduleID), nil
+}
 
-	// Update installation status to installed
-	_, err = tx.Exec("UPDATE module_installations SET status = $1, updated_at = $2 WHERE id = $3",
-		models.ModuleStatusInstalled, time.Now(), installation.ID)
+// UninstallModule uninstalls a module for a tenant. Modules depending on it
+// are uninstalled first when cascading, and otherwise refuse the uninstall.
+// The modules are disabled right away and uninstalling until the lifecycle
+// worker ran their uninstall hooks.
+func (s *ModuleService) UninstallModule(tenantID, moduleID uuid.UUID, cascade bool) (*models.ModuleUninstallPlan, error) {
+	// Start transaction
+	tx, err := s.db.Beginx()
 	if err != nil {
-		return nil, fmt.Errorf("failed to update installation status: %w", err)
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockTenantModules(tx, tenantID); err != nil {
+		return nil, err
+	}
+	catalog, err := s.loadCatalog(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := catalog.installed[moduleID]; !ok {
+		return nil, fmt.Errorf("module is not installed")
+	}
+	var status string
+	err = tx.Get(&status, "SELECT status FROM module_installations WHERE tenant_id = $1 AND module_id = $2 AND uninstalled_at IS NULL ORDER BY installed_at DESC LIMIT 1",
+		tenantID, moduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installation: %w", err)
+	}
+	if status == models.ModuleStatusUninstalling {
+		return nil, fmt.Errorf("module is already being uninstalled")
+	}
+	if status == models.ModuleStatusUpdating {
+		return nil, fmt.Errorf("cannot uninstall module while it is updating")
+	}
+
+	// Check if other modules depend on this one
+	plan := planUninstall(catalog, moduleID)
+	if len(plan.Steps) > 1 && !cascade {
+		dependents := make([]string, 0, len(plan.Steps)-1)
+		for _, step := range plan.Steps[:len(plan.Steps)-1] {
+			dependents = append(dependents, step.Name)
+		}
+		return nil, fmt.Errorf("cannot uninstall module: %s depend on it", strings.Join(dependents, ", "))
+	}
+
+	batch := newLifecycleBatch(tenantID)
+	for _, step := range plan.Steps {
+		installation, err := currentInstallation(tx, tenantID, step.ModuleID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Update installation status
+		_, err = tx.Exec("UPDATE module_installations SET status = $1, error_message = NULL, updated_at = $2 WHERE id = $3",
+			models.ModuleStatusUninstalling, time.Now(), installation.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update installation status of %s: %w", step.Name, err)
+		}
+		if err := batch.queue(tx, installation.ID, step.ModuleID, models.ModuleEventUninstall, step.Version, nil); err != nil {
+			return nil, err
+		}
+
+		// Disable tenant module
+		_, err = tx.Exec("UPDATE tenant_modules SET is_enabled = false, updated_at = $1 WHERE tenant_id = $2 AND module_id = $3",
+			time.Now(), tenantID, step.ModuleID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to disable tenant module %s: %w", step.Name, err)
+		}
 	}
 
 	err = tx.Commit()
@@ -134,21 +274,16 @@ func (s *ModuleService) InstallModule(tenantID, moduleID, userID uuid.UUID, vers
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	installation.Status = models.ModuleStatusInstalled
-	return installation, nil
+	return plan, nil
 }
 
-// UninstallModule uninstalls a module for a tenant
-func (s *ModuleService) UninstallModule(tenantID, moduleID uuid.UUID) error {
-	// Check if module is installed
-	var installation models.ModuleInstallation
-	err := s.db.Get(&installation,
-		"SELECT * FROM module_installations WHERE tenant_id = $1 AND module_id = $2 AND uninstalled_at IS NULL",
-		tenantID, moduleID)
-	if err != nil {
-		return fmt.Errorf("module is not installed")
-	}
+// EnableModule enables a module for a tenant and queues its enable hook
+func (s *ModuleService) EnableModule(tenantID, moduleID uuid.UUID) error {
+	return s.setModuleEnabled(tenantID, moduleID, true)
+}
 
+// DisableModule disables a module for a tenant
+func (s *ModuleService) DisableModule(tenantID, moduleID uuid.UUID) error {
 	// Check if other modules depend on this one
 	dependentModules, err := s.getDependentModules(tenantID, moduleID)
 	if err != nil {
@@ -156,77 +291,165 @@ func (s *ModuleService) UninstallModule(tenantID, moduleID uuid.UUID) error {
 	}
 
 	if len(dependentModules) > 0 {
-		return fmt.Errorf("cannot uninstall module: other modules depend on it")
+		return fmt.Errorf("cannot disable module: other modules depend on it")
+	}
+
+	return s.setModuleEnabled(tenantID, moduleID, false)
+}
+
+// setModuleEnabled enables or disables an installed module and queues the
+// matching lifecycle hook
+func (s *ModuleService) setModuleEnabled(tenantID, moduleID uuid.UUID, enabled bool) error {
+	action, event := "disable", models.ModuleEventDisable
+	if enabled {
+		action, event = "enable", models.ModuleEventEnable
 	}
 
-	// Start transaction
 	tx, err := s.db.Beginx()
 	if err != nil {
 		return fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Update installation status
-	_, err = tx.Exec("UPDATE module_installations SET status = $1, uninstalled_at = $2, updated_at = $3 WHERE id = $4",
-		models.ModuleStatusUninstalling, time.Now(), time.Now(), installation.ID)
+	result, err := tx.Exec("UPDATE tenant_modules SET is_enabled = $1, updated_at = $2 WHERE tenant_id = $3 AND module_id = $4",
+		enabled, time.Now(), tenantID, moduleID)
 	if err != nil {
-		return fmt.Errorf("failed to update installation status: %w", err)
+		return fmt.Errorf("failed to %s module: %w", action, err)
 	}
 
-	// Disable tenant module
-	_, err = tx.Exec("UPDATE tenant_modules SET is_enabled = false, updated_at = $1 WHERE tenant_id = $2 AND module_id = $3",
-		time.Now(), tenantID, moduleID)
-	if err != nil {
-		return fmt.Errorf("failed to disable tenant module: %w", err)
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("module not found for tenant")
 	}
 
-	err = tx.Commit()
+	var installation models.ModuleInstallation
+	err = tx.Get(&installation, "SELECT * FROM module_installations WHERE tenant_id = $1 AND module_id = $2 AND uninstalled_at IS NULL ORDER BY installed_at DESC LIMIT 1",
+		tenantID, moduleID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("module not found for tenant")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to get installation: %w", err)
+	}
+	if installation.Status == models.ModuleStatusUninstalling {
+		return fmt.Errorf("module is being uninstalled")
 	}
 
+	if err := newLifecycleBatch(tenantID).queue(tx, installation.ID, moduleID, event, installation.Version, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-// EnableModule enables a module for a tenant
-func (s *ModuleService) EnableModule(tenantID, moduleID uuid.UUID) error {
-	result, err := s.db.Exec("UPDATE tenant_modules SET is_enabled = true, updated_at = $1 WHERE tenant_id = $2 AND module_id = $3",
-		time.Now(), tenantID, moduleID)
+// GetInstallationStatus returns a tenant's installation of a module with its
+// latest lifecycle jobs, to follow an install, upgrade or uninstall
+func (s *ModuleService) GetInstallationStatus(tenantID, moduleID uuid.UUID) (*models.ModuleInstallationStatus, error) {
+	var installation models.ModuleInstallation
+	err := s.db.Get(&installation, `
+		SELECT * FROM module_installations
+		WHERE tenant_id = $1 AND module_id = $2
+		ORDER BY uninstalled_at IS NULL DESC, installed_at DESC
+		LIMIT 1`,
+		tenantID, moduleID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("module installation not found")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to enable module: %w", err)
+		return nil, fmt.Errorf("failed to get installation: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("module not found for tenant")
+	jobs := []models.ModuleLifecycleJob{}
+	err = s.db.Select(&jobs, `
+		SELECT * FROM module_lifecycle_jobs
+		WHERE installation_id = $1
+		ORDER BY created_at DESC, position DESC
+		LIMIT 20`,
+		installation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lifecycle jobs: %w", err)
 	}
 
-	return nil
+	return &models.ModuleInstallationStatus{Installation: &installation, Jobs: jobs}, nil
 }
 
-// DisableModule disables a module for a tenant
-func (s *ModuleService) DisableModule(tenantID, moduleID uuid.UUID) error {
-	// Check if other modules depend on this one
-	dependentModules, err := s.getDependentModules(tenantID, moduleID)
+// RetryInstallation queues the failed lifecycle jobs of a tenant's module
+// again, along with the failed jobs of the same batch, e.g. the modules
+// depending on it
+func (s *ModuleService) RetryInstallation(tenantID, moduleID uuid.UUID) error {
+	tx, err := s.db.Beginx()
 	if err != nil {
-		return fmt.Errorf("failed to check dependencies: %w", err)
+		return fmt.Errorf("failed to start transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	if len(dependentModules) > 0 {
-		return fmt.Errorf("cannot disable module: other modules depend on it")
+	if err := lockTenantModules(tx, tenantID); err != nil {
+		return err
+	}
+	installation, err := currentInstallation(tx, tenantID, moduleID)
+	if err != nil {
+		return err
 	}
 
-	result, err := s.db.Exec("UPDATE tenant_modules SET is_enabled = false, updated_at = $1 WHERE tenant_id = $2 AND module_id = $3",
-		time.Now(), tenantID, moduleID)
+	var batchID uuid.UUID
+	err = tx.Get(&batchID, `
+		SELECT batch_id FROM module_lifecycle_jobs
+		WHERE installation_id = $1 AND status = $2
+		ORDER BY created_at DESC
+		LIMIT 1`,
+		installation.ID, models.ModuleJobFailed)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no failed lifecycle jobs to retry")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to disable module: %w", err)
+		return fmt.Errorf("failed to get failed lifecycle jobs: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		return fmt.Errorf("module not found for tenant")
+	var jobs []models.ModuleLifecycleJob
+	err = tx.Select(&jobs, `
+		UPDATE module_lifecycle_jobs
+		SET status = $2, attempts = 0, next_attempt_at = $3, error_message = NULL, finished_at = NULL, updated_at = $3
+		WHERE batch_id = $1 AND status = $4
+		RETURNING *`,
+		batchID, models.ModuleJobPending, time.Now(), models.ModuleJobFailed)
+	if err != nil {
+		return fmt.Errorf("failed to queue lifecycle jobs: %w", err)
 	}
 
+	for _, job := range jobs {
+		_, err = tx.Exec(`
+			UPDATE module_installations
+			SET status = CASE $2
+				WHEN 'install' THEN 'installing'
+				WHEN 'upgrade' THEN 'updating'
+				WHEN 'rollback' THEN 'updating'
+				WHEN 'uninstall' THEN 'uninstalling'
+				ELSE status END,
+				error_message = NULL, updated_at = $3
+			WHERE id = $1`,
+			job.InstallationID, job.Event, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to update installation status: %w", err)
+		}
+
+		if job.UpgradeID != nil {
+			status := models.ModuleUpgradeUpgrading
+			if job.Event == models.ModuleEventRollback {
+				status = models.ModuleUpgradeRollingBack
+			}
+			_, err = tx.Exec("UPDATE module_upgrades SET status = $1, finished_at = NULL WHERE id = $2", status, *job.UpgradeID)
+			if err != nil {
+				return fmt.Errorf("failed to update upgrade status: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
@@ -253,31 +476,119 @@ func (s *ModuleService) UpdateModuleConfig(tenantID, moduleID uuid.UUID, config
 	return nil
 }
 
-// checkModuleDependencies checks if all required dependencies are installed
-func (s *ModuleService) checkModuleDependencies(tenantID, moduleID uuid.UUID) error {
-	var dependencies []models.ModuleDependency
-	err := s.db.Select(&dependencies,
-		"SELECT * FROM module_dependencies WHERE module_id = $1 AND is_required = true",
-		moduleID)
+// resolveInstall plans installing a module that is not installed yet
+func resolveInstall(catalog *moduleCatalog, moduleID uuid.UUID) (*models.ModuleInstallPlan, error) {
+	module, ok := catalog.modules[moduleID]
+	if !ok || !module.IsActive {
+		return nil, fmt.Errorf("module not found or not active")
+	}
+	if _, ok := catalog.installed[moduleID]; ok {
+		return nil, fmt.Errorf("module is already installed")
+	}
+	return planInstall(catalog, moduleID), nil
+}
+
+// currentInstallation returns the installation of a module the tenant has
+// not uninstalled
+func currentInstallation(tx *sqlx.Tx, tenantID, moduleID uuid.UUID) (*models.ModuleInstallation, error) {
+	var installation models.ModuleInstallation
+	err := tx.Get(&installation, "SELECT * FROM module_installations WHERE tenant_id = $1 AND module_id = $2 AND uninstalled_at IS NULL ORDER BY installed_at DESC LIMIT 1",
+		tenantID, moduleID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("module is not installed")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installation: %w", err)
+	}
+	return &installation, nil
+}
+
+// lifecycleBatch queues the lifecycle jobs of one change of a tenant's
+// modules, which the worker runs in the order they were queued
+type lifecycleBatch struct {
+	id       uuid.UUID
+	tenantID uuid.UUID
+	next     int
+}
+
+func newLifecycleBatch(tenantID uuid.UUID) *lifecycleBatch {
+	return &lifecycleBatch{id: uuid.New(), tenantID: tenantID}
+}
+
+func (b *lifecycleBatch) queue(tx *sqlx.Tx, installationID, moduleID uuid.UUID, event, version string, fromVersion *string) error {
+	_, err := tx.Exec(`
+		INSERT INTO module_lifecycle_jobs (installation_id, tenant_id, module_id, batch_id, position, event, version, from_version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		installationID, b.tenantID, moduleID, b.id, b.next, event, version, fromVersion)
 	if err != nil {
-		return fmt.Errorf("failed to get dependencies: %w", err)
+		return fmt.Errorf("failed to queue %s hook: %w", event, err)
 	}
+	b.next++
+	return nil
+}
 
-	for _, dep := range dependencies {
-		var tenantModule models.TenantModule
-		err = s.db.Get(&tenantModule,
-			"SELECT * FROM tenant_modules WHERE tenant_id = $1 AND module_id = $2 AND is_enabled = true",
-			tenantID, dep.DependsOnID)
-		if err != nil {
-			var depModule models.Module
-			s.db.Get(&depModule, "SELECT name FROM modules WHERE id = $1", dep.DependsOnID)
-			return fmt.Errorf("required dependency '%s' is not installed or enabled", depModule.Name)
-		}
+// queueUpgrade queues the upgrade job of an upgrade, or its rollback job
+func (b *lifecycleBatch) queueUpgrade(tx *sqlx.Tx, upgrade *models.ModuleUpgrade, event string) error {
+	version, fromVersion := upgrade.ToVersion, upgrade.FromVersion
+	if event == models.ModuleEventRollback {
+		version, fromVersion = upgrade.FromVersion, upgrade.ToVersion
 	}
 
+	_, err := tx.Exec(`
+		INSERT INTO module_lifecycle_jobs (installation_id, tenant_id, module_id, batch_id, position, event, version, from_version, upgrade_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		upgrade.InstallationID, b.tenantID, upgrade.ModuleID, b.id, b.next, event, version, fromVersion, upgrade.ID)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s hook: %w", event, err)
+	}
+	b.next++
+	return nil
+}
+
+// lockTenantModules serializes changes of a tenant's modules until the
+// transaction ends
+func lockTenantModules(tx *sqlx.Tx, tenantID uuid.UUID) error {
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", "tenant_modules:"+tenantID.String()); err != nil {
+		return fmt.Errorf("failed to lock tenant modules: %w", err)
+	}
 	return nil
 }
 
+// loadCatalog loads every module and dependency and the modules the tenant
+// has installed
+func (s *ModuleService) loadCatalog(q sqlx.Queryer, tenantID uuid.UUID) (*moduleCatalog, error) {
+	var modules []models.Module
+	if err := sqlx.Select(q, &modules, "SELECT * FROM modules"); err != nil {
+		return nil, fmt.Errorf("failed to get modules: %w", err)
+	}
+
+	var dependencies []models.ModuleDependency
+	if err := sqlx.Select(q, &dependencies, "SELECT * FROM module_dependencies"); err != nil {
+		return nil, fmt.Errorf("failed to get dependencies: %w", err)
+	}
+
+	var rows []struct {
+		ModuleID  uuid.UUID `db:"module_id"`
+		Version   string    `db:"version"`
+		IsEnabled bool      `db:"is_enabled"`
+	}
+	query := `
+		SELECT mi.module_id, mi.version, COALESCE(tm.is_enabled, false) AS is_enabled
+		FROM module_installations mi
+		LEFT JOIN tenant_modules tm ON tm.tenant_id = mi.tenant_id AND tm.module_id = mi.module_id
+		WHERE mi.tenant_id = $1 AND mi.uninstalled_at IS NULL`
+	if err := sqlx.Select(q, &rows, query, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to get installed modules: %w", err)
+	}
+
+	installed := make(map[uuid.UUID]installedModule, len(rows))
+	for _, row := range rows {
+		installed[row.ModuleID] = installedModule{Version: row.Version, Enabled: row.IsEnabled}
+	}
+
+	return newModuleCatalog(modules, dependencies, installed), nil
+}
+
 // getDependentModules gets modules that depend on the given module
 func (s *ModuleService) getDependentModules(tenantID, moduleID uuid.UUID) ([]models.TenantModule, error) {
 	var dependentModules []models.TenantModule
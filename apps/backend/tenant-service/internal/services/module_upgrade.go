@@ -0,0 +1,399 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+
+	"zplus-saas/apps/backend/shared/semver"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+)
+
+// defaultRolloutCohort is how many tenants advancing a rollout upgrades
+// unless asked for another number
+const defaultRolloutCohort = 10
+
+// UpgradeModule upgrades a tenant's module to the version in the catalog.
+// The installation is updating until the lifecycle worker ran the upgrade
+// hook, which migrates the tenant's data; an upgrade whose hook gives up is
+// rolled back to the version it started from.
+func (s *ModuleService) UpgradeModule(tenantID, moduleID, userID uuid.UUID, version string) (*models.ModuleUpgrade, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockTenantModules(tx, tenantID); err != nil {
+		return nil, err
+	}
+	catalog, err := s.loadCatalog(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	module, ok := catalog.modules[moduleID]
+	if !ok || !module.IsActive {
+		return nil, fmt.Errorf("module not found or not active")
+	}
+	if version != "" && version != module.Version {
+		return nil, fmt.Errorf("version %s of module %s is not available", version, module.Name)
+	}
+	installation, err := currentInstallation(tx, tenantID, moduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	upgrade, err := startUpgrade(tx, catalog, installation, &userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return upgrade, nil
+}
+
+// RollbackModule undoes a tenant's latest upgrade of a module, moving it
+// back to the version the upgrade started from
+func (s *ModuleService) RollbackModule(tenantID, moduleID uuid.UUID) (*models.ModuleUpgrade, error) {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockTenantModules(tx, tenantID); err != nil {
+		return nil, err
+	}
+	installation, err := currentInstallation(tx, tenantID, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	if installation.Status != models.ModuleStatusInstalled {
+		return nil, fmt.Errorf("cannot roll back module while it is %s", installation.Status)
+	}
+
+	var upgrade models.ModuleUpgrade
+	err = tx.Get(&upgrade, "SELECT * FROM module_upgrades WHERE installation_id = $1 ORDER BY started_at DESC LIMIT 1", installation.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get upgrade: %w", err)
+	}
+	if err == sql.ErrNoRows || upgrade.Status != models.ModuleUpgradeCompleted || upgrade.ToVersion != installation.Version {
+		return nil, fmt.Errorf("no completed upgrade to roll back")
+	}
+
+	catalog, err := s.loadCatalog(tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if conflicts := versionConflicts(catalog, moduleID, upgrade.FromVersion, false); len(conflicts) > 0 {
+		return nil, fmt.Errorf("cannot roll back module: %s", strings.Join(conflicts, "; "))
+	}
+
+	err = tx.Get(&upgrade, "UPDATE module_upgrades SET status = $1, finished_at = NULL WHERE id = $2 RETURNING *",
+		models.ModuleUpgradeRollingBack, upgrade.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update upgrade status: %w", err)
+	}
+	_, err = tx.Exec("UPDATE module_installations SET status = $1, error_message = NULL, updated_at = $2 WHERE id = $3",
+		models.ModuleStatusUpdating, time.Now(), installation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update installation status: %w", err)
+	}
+	if err := newLifecycleBatch(tenantID).queueUpgrade(tx, &upgrade, models.ModuleEventRollback); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &upgrade, nil
+}
+
+// GetUpgradeHistory returns a tenant's upgrades of a module, latest first
+func (s *ModuleService) GetUpgradeHistory(tenantID, moduleID uuid.UUID) ([]models.ModuleUpgrade, error) {
+	upgrades := []models.ModuleUpgrade{}
+	err := s.db.Select(&upgrades, "SELECT * FROM module_upgrades WHERE tenant_id = $1 AND module_id = $2 ORDER BY started_at DESC",
+		tenantID, moduleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upgrades: %w", err)
+	}
+	return upgrades, nil
+}
+
+// CreateRollout starts a staged rollout of a module's catalog version to
+// the tenants having an older one. Nothing is upgraded until it advances.
+func (s *ModuleService) CreateRollout(moduleID, userID uuid.UUID, maxFailures int) (*models.ModuleRollout, error) {
+	if maxFailures <= 0 {
+		maxFailures = 1
+	}
+
+	var module models.Module
+	err := s.db.Get(&module, "SELECT * FROM modules WHERE id = $1 AND is_active = true", moduleID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("module not found or not active")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get module: %w", err)
+	}
+
+	var rollout models.ModuleRollout
+	err = s.db.Get(&rollout, `
+		INSERT INTO module_rollouts (module_id, to_version, status, max_failures, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`,
+		moduleID, module.Version, models.ModuleRolloutActive, maxFailures, userID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return nil, fmt.Errorf("module %s already has a rollout in progress", module.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rollout: %w", err)
+	}
+	return &rollout, nil
+}
+
+// GetRollout returns a rollout with how far its upgrades got
+func (s *ModuleService) GetRollout(rolloutID uuid.UUID) (*models.ModuleRolloutProgress, error) {
+	rollout, err := getRollout(s.db, rolloutID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err = s.db.Select(&counts, "SELECT status, COUNT(*) AS count FROM module_upgrades WHERE rollout_id = $1 GROUP BY status", rolloutID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count upgrades: %w", err)
+	}
+	candidates, err := rolloutCandidates(s.db, rollout)
+	if err != nil {
+		return nil, err
+	}
+
+	progress := &models.ModuleRolloutProgress{Rollout: rollout, Remaining: len(candidates)}
+	for _, c := range counts {
+		switch c.Status {
+		case models.ModuleUpgradeUpgrading, models.ModuleUpgradeRollingBack:
+			progress.Upgrading += c.Count
+		case models.ModuleUpgradeCompleted:
+			progress.Completed += c.Count
+		case models.ModuleUpgradeRolledBack:
+			progress.RolledBack += c.Count
+		case models.ModuleUpgradeFailed:
+			progress.Failed += c.Count
+		}
+	}
+	return progress, nil
+}
+
+// AdvanceRollout upgrades the next cohort of tenants: size of them, or the
+// given ones. Tenants whose module is busy or whose other modules do not
+// allow the upgrade are skipped. A rollout with no tenants left completes.
+func (s *ModuleService) AdvanceRollout(rolloutID uuid.UUID, size int, tenantIDs []uuid.UUID) (*models.ModuleRolloutCohort, error) {
+	if size <= 0 {
+		size = defaultRolloutCohort
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rollout, err := getRollout(tx, rolloutID, true)
+	if err != nil {
+		return nil, err
+	}
+	if rollout.Status != models.ModuleRolloutActive {
+		return nil, fmt.Errorf("rollout is %s", rollout.Status)
+	}
+
+	candidates, err := rolloutCandidates(tx, rollout)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenantIDs) > 0 {
+		picked := map[uuid.UUID]bool{}
+		for _, id := range tenantIDs {
+			picked[id] = true
+		}
+		cohort := candidates[:0]
+		for _, installation := range candidates {
+			if picked[installation.TenantID] {
+				cohort = append(cohort, installation)
+			}
+		}
+		candidates = cohort
+	}
+
+	result := &models.ModuleRolloutCohort{Upgrades: []*models.ModuleUpgrade{}, Skipped: map[string]string{}}
+	for i := range candidates {
+		if len(result.Upgrades) == size {
+			break
+		}
+		installation := &candidates[i]
+
+		if err := lockTenantModules(tx, installation.TenantID); err != nil {
+			return nil, err
+		}
+		catalog, err := s.loadCatalog(tx, installation.TenantID)
+		if err != nil {
+			return nil, err
+		}
+		upgrade, err := startUpgrade(tx, catalog, installation, rollout.CreatedBy, &rollout.ID)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "failed to") {
+				return nil, err
+			}
+			result.Skipped[installation.TenantID.String()] = err.Error()
+			continue
+		}
+		result.Upgrades = append(result.Upgrades, upgrade)
+	}
+
+	if len(candidates) == 0 && len(tenantIDs) == 0 {
+		var running int
+		err = tx.Get(&running, "SELECT COUNT(*) FROM module_upgrades WHERE rollout_id = $1 AND status IN ($2, $3)",
+			rollout.ID, models.ModuleUpgradeUpgrading, models.ModuleUpgradeRollingBack)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count upgrades: %w", err)
+		}
+		if running == 0 {
+			_, err = tx.Exec("UPDATE module_rollouts SET status = $1, updated_at = $2 WHERE id = $3",
+				models.ModuleRolloutCompleted, time.Now(), rollout.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to complete rollout: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return result, nil
+}
+
+// SetRolloutStatus pauses, resumes or cancels a rollout. Upgrades already
+// started carry on.
+func (s *ModuleService) SetRolloutStatus(rolloutID uuid.UUID, status string) (*models.ModuleRollout, error) {
+	switch status {
+	case models.ModuleRolloutActive, models.ModuleRolloutPaused, models.ModuleRolloutCancelled:
+	default:
+		return nil, fmt.Errorf("invalid rollout status %q", status)
+	}
+
+	var rollout models.ModuleRollout
+	err := s.db.Get(&rollout, `
+		UPDATE module_rollouts SET status = $1, updated_at = $2
+		WHERE id = $3 AND status IN ($4, $5)
+		RETURNING *`,
+		status, time.Now(), rolloutID, models.ModuleRolloutActive, models.ModuleRolloutPaused)
+	if err == sql.ErrNoRows {
+		current, err := getRollout(s.db, rolloutID, false)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("rollout is %s", current.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update rollout: %w", err)
+	}
+	return &rollout, nil
+}
+
+// startUpgrade records an upgrade of an installation to the module's
+// catalog version and queues its upgrade hook
+func startUpgrade(tx *sqlx.Tx, catalog *moduleCatalog, installation *models.ModuleInstallation, requestedBy, rolloutID *uuid.UUID) (*models.ModuleUpgrade, error) {
+	module := catalog.modules[installation.ModuleID]
+	if installation.Status != models.ModuleStatusInstalled {
+		return nil, fmt.Errorf("cannot upgrade module while it is %s", installation.Status)
+	}
+	newer, err := versionAfter(module.Version, installation.Version)
+	if err != nil {
+		return nil, err
+	}
+	if !newer {
+		return nil, fmt.Errorf("module %s is already at version %s", module.Name, installation.Version)
+	}
+	if conflicts := versionConflicts(catalog, module.ID, module.Version, true); len(conflicts) > 0 {
+		return nil, fmt.Errorf("cannot upgrade module: %s", strings.Join(conflicts, "; "))
+	}
+
+	var upgrade models.ModuleUpgrade
+	err = tx.Get(&upgrade, `
+		INSERT INTO module_upgrades (installation_id, tenant_id, module_id, rollout_id, from_version, to_version, status, requested_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING *`,
+		installation.ID, installation.TenantID, installation.ModuleID, rolloutID, installation.Version, module.Version,
+		models.ModuleUpgradeUpgrading, requestedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record upgrade: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE module_installations SET status = $1, error_message = NULL, updated_at = $2 WHERE id = $3",
+		models.ModuleStatusUpdating, time.Now(), installation.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update installation status: %w", err)
+	}
+	if err := newLifecycleBatch(installation.TenantID).queueUpgrade(tx, &upgrade, models.ModuleEventUpgrade); err != nil {
+		return nil, err
+	}
+	return &upgrade, nil
+}
+
+// versionAfter reports whether version a is later than b
+func versionAfter(a, b string) (bool, error) {
+	cmp, err := semver.Compare(a, b)
+	return cmp > 0, err
+}
+
+func getRollout(q sqlx.Queryer, rolloutID uuid.UUID, forUpdate bool) (*models.ModuleRollout, error) {
+	query := "SELECT * FROM module_rollouts WHERE id = $1"
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var rollout models.ModuleRollout
+	err := sqlx.Get(q, &rollout, query, rolloutID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("rollout not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rollout: %w", err)
+	}
+	return &rollout, nil
+}
+
+// rolloutCandidates returns the installations a rollout has yet to upgrade:
+// those of the module at an older version without an upgrade of the
+// rollout, longest installed first
+func rolloutCandidates(q sqlx.Queryer, rollout *models.ModuleRollout) ([]models.ModuleInstallation, error) {
+	var installations []models.ModuleInstallation
+	err := sqlx.Select(q, &installations, `
+		SELECT mi.* FROM module_installations mi
+		WHERE mi.module_id = $1 AND mi.uninstalled_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM module_upgrades u WHERE u.rollout_id = $2 AND u.installation_id = mi.id)
+		ORDER BY mi.installed_at`,
+		rollout.ModuleID, rollout.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get installations: %w", err)
+	}
+
+	candidates := []models.ModuleInstallation{}
+	for _, installation := range installations {
+		if older, err := versionAfter(rollout.ToVersion, installation.Version); err == nil && older {
+			candidates = append(candidates, installation)
+		}
+	}
+	return candidates, nil
+}
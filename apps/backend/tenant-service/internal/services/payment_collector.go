@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"zplus-saas/apps/backend/shared/config"
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+)
+
+// PaymentCollector charges an invoice with the tenant's payment method on
+// file. A declined charge is a result, not an error; an error means the
+// charge could not be attempted.
+type PaymentCollector interface {
+	Charge(ctx context.Context, invoice *models.Invoice) (*models.ChargeResult, error)
+}
+
+// NewPaymentCollector charges invoices through BILLING_CHARGE_URL. Without
+// it every charge fails, so invoices are only paid by recording a payment.
+func NewPaymentCollector(cfg *config.Config) PaymentCollector {
+	if cfg.BillingChargeURL == "" {
+		return unconfiguredCollector{}
+	}
+	return &httpPaymentCollector{
+		cfg: cfg,
+		url: cfg.BillingChargeURL,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+type unconfiguredCollector struct{}
+
+func (unconfiguredCollector) Charge(ctx context.Context, invoice *models.Invoice) (*models.ChargeResult, error) {
+	return nil, fmt.Errorf("no payment provider is configured")
+}
+
+type httpPaymentCollector struct {
+	cfg        *config.Config
+	url        string
+	httpClient *http.Client
+}
+
+type chargeRequest struct {
+	InvoiceID     string  `json:"invoice_id"`
+	InvoiceNumber string  `json:"invoice_number"`
+	TenantID      string  `json:"tenant_id"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+}
+
+func (c *httpPaymentCollector) Charge(ctx context.Context, invoice *models.Invoice) (*models.ChargeResult, error) {
+	payload, err := json.Marshal(&chargeRequest{
+		InvoiceID:     invoice.ID.String(),
+		InvoiceNumber: invoice.Number,
+		TenantID:      invoice.TenantID.String(),
+		Amount:        invoice.Total,
+		Currency:      invoice.Currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := sharedmiddleware.NewServiceToken(c.cfg, "tenant-service", invoice.TenantID.String(), nil, authServiceTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue service token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	// Retrying the same invoice must not charge it twice
+	req.Header.Set("Idempotency-Key", invoice.ID.String())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("payment provider request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("payment provider returned status %d", resp.StatusCode)
+	}
+
+	var result models.ChargeResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid payment provider response: %w", err)
+	}
+	return &result, nil
+}
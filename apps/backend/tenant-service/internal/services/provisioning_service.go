@@ -0,0 +1,571 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// ErrProvisioningFailed is returned when a provisioning step failed and the
+// saga was rolled back. The returned provisioning says which step failed.
+var ErrProvisioningFailed = errors.New("provisioning failed")
+
+const (
+	// provisioningStaleAfter is how long a saga may run without progress
+	// before it is treated as interrupted and rolled back
+	provisioningStaleAfter = 10 * time.Minute
+	// provisioningCompensationTimeout bounds a rollback, which must run even
+	// when the request that started the saga is gone
+	provisioningCompensationTimeout = time.Minute
+	maxTrialDays                    = 365
+	// stepInterrupted is the error of a step that was running when its saga
+	// stopped
+	stepInterrupted = "interrupted"
+)
+
+// ProvisioningService provisions tenants as a saga: each step is recorded
+// as it completes and, when a step fails, the completed steps are undone in
+// reverse order.
+type ProvisioningService interface {
+	Provision(ctx context.Context, req *models.ProvisionTenantRequest) (*models.TenantProvisioning, error)
+	GetProvisioning(ctx context.Context, id uuid.UUID) (*models.TenantProvisioning, error)
+	// RecoverStale rolls back sagas interrupted mid-way, e.g. by a restart,
+	// and returns how many it rolled back
+	RecoverStale(ctx context.Context) (int, error)
+}
+
+type provisioningService struct {
+	provisioningRepo repositories.ProvisioningRepository
+	tenantRepo       repositories.TenantRepository
+	subscriptionRepo repositories.SubscriptionRepository
+	planRepo         repositories.PlanRepository
+	setupRepo        repositories.TenantSetupRepository
+	authClient       AuthClient
+	now              func() time.Time
+}
+
+func NewProvisioningService(
+	provisioningRepo repositories.ProvisioningRepository,
+	tenantRepo repositories.TenantRepository,
+	subscriptionRepo repositories.SubscriptionRepository,
+	planRepo repositories.PlanRepository,
+	setupRepo repositories.TenantSetupRepository,
+	authClient AuthClient,
+) ProvisioningService {
+	return &provisioningService{
+		provisioningRepo: provisioningRepo,
+		tenantRepo:       tenantRepo,
+		subscriptionRepo: subscriptionRepo,
+		planRepo:         planRepo,
+		setupRepo:        setupRepo,
+		authClient:       authClient,
+		now:              time.Now,
+	}
+}
+
+// sagaStep runs one provisioning step and undoes it. run reports a detail
+// for the step record and whether the step had nothing to do. Compensations
+// are scoped to the tenant and succeed when there is nothing left to undo.
+type sagaStep struct {
+	run        func(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (detail string, skipped bool, err error)
+	compensate func(ctx context.Context, p *models.TenantProvisioning) error
+}
+
+func (s *provisioningService) sagaSteps() map[string]sagaStep {
+	return map[string]sagaStep{
+		models.ProvisioningStepTenant:        {run: s.createTenant, compensate: s.deleteTenant},
+		models.ProvisioningStepConfiguration: {run: s.createConfiguration, compensate: s.deleteConfiguration},
+		models.ProvisioningStepSubscription:  {run: s.createSubscription, compensate: s.deleteSubscription},
+		models.ProvisioningStepModules:       {run: s.enableModules, compensate: s.deleteModules},
+		models.ProvisioningStepAdminUser:     {run: s.createAdmin, compensate: s.deleteAdmin},
+		models.ProvisioningStepSeedData:      {run: s.seedData, compensate: s.deleteSeedData},
+	}
+}
+
+func (s *provisioningService) Provision(ctx context.Context, req *models.ProvisionTenantRequest) (*models.TenantProvisioning, error) {
+	resolved, err := s.resolveRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stored request never holds the admin password
+	stored := *resolved
+	if resolved.Admin != nil {
+		admin := *resolved.Admin
+		admin.Password = ""
+		stored.Admin = &admin
+	}
+
+	p := &models.TenantProvisioning{
+		Subdomain: resolved.Subdomain,
+		Status:    models.ProvisioningStatusRunning,
+		Request:   &stored,
+	}
+	for _, name := range models.ProvisioningSteps {
+		p.Steps = append(p.Steps, &models.ProvisioningStep{Name: name, Status: models.StepStatusPending})
+	}
+	if err := s.provisioningRepo.Create(ctx, p); err != nil {
+		return nil, fmt.Errorf("failed to start provisioning: %w", err)
+	}
+
+	steps := s.sagaSteps()
+	for _, step := range p.Steps {
+		if err := s.runStep(ctx, p, step, steps[step.Name], resolved); err != nil {
+			return s.rollBack(ctx, p, fmt.Sprintf("%s step failed: %v", step.Name, err))
+		}
+	}
+
+	// The tenant becomes usable only once every step has completed
+	if err := s.tenantRepo.UpdateStatus(ctx, *p.TenantID, models.TenantStatusTrial); err != nil {
+		return s.rollBack(ctx, p, fmt.Sprintf("failed to activate tenant: %v", err))
+	}
+
+	completedAt := s.now()
+	p.Status = models.ProvisioningStatusCompleted
+	p.CompletedAt = &completedAt
+	if err := s.provisioningRepo.Update(ctx, p); err != nil {
+		log.Printf("Provisioning %s: failed to record completion: %v", p.ID, err)
+	}
+
+	return p, nil
+}
+
+func (s *provisioningService) GetProvisioning(ctx context.Context, id uuid.UUID) (*models.TenantProvisioning, error) {
+	return s.provisioningRepo.GetByID(ctx, id)
+}
+
+func (s *provisioningService) RecoverStale(ctx context.Context) (int, error) {
+	recovered := 0
+	for {
+		p, err := s.provisioningRepo.ClaimStale(ctx, s.now().Add(-provisioningStaleAfter))
+		if err != nil {
+			return recovered, err
+		}
+		if p == nil {
+			return recovered, nil
+		}
+
+		// The step that was running when the saga stopped may have been
+		// partly applied; its compensation is safe to run either way
+		for _, step := range p.Steps {
+			if step.Status == models.StepStatusPending && step.StartedAt != nil {
+				step.Status = models.StepStatusFailed
+				step.Error = stepInterrupted
+			}
+		}
+
+		s.rollBack(ctx, p, "provisioning was interrupted")
+		recovered++
+	}
+}
+
+// runStep runs a step and saves the saga state, so a restart knows what to undo
+func (s *provisioningService) runStep(ctx context.Context, p *models.TenantProvisioning, step *models.ProvisioningStep, saga sagaStep, req *models.ProvisionTenantRequest) error {
+	startedAt := s.now()
+	step.StartedAt = &startedAt
+	if err := s.provisioningRepo.Update(ctx, p); err != nil {
+		return err
+	}
+
+	detail, skipped, err := saga.run(ctx, p, req)
+	completedAt := s.now()
+	step.CompletedAt = &completedAt
+	step.Detail = detail
+	switch {
+	case err != nil:
+		step.Status = models.StepStatusFailed
+		step.Error = err.Error()
+	case skipped:
+		step.Status = models.StepStatusSkipped
+	default:
+		step.Status = models.StepStatusCompleted
+	}
+
+	if saveErr := s.provisioningRepo.Update(ctx, p); saveErr != nil && err == nil {
+		return saveErr
+	}
+
+	return err
+}
+
+// rollBack compensates the completed steps in reverse order and records the
+// outcome. A failed step was not applied, except one interrupted mid-way,
+// so it is compensated too.
+func (s *provisioningService) rollBack(ctx context.Context, p *models.TenantProvisioning, reason string) (*models.TenantProvisioning, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), provisioningCompensationTimeout)
+	defer cancel()
+
+	steps := s.sagaSteps()
+	failed := false
+	for i := len(p.Steps) - 1; i >= 0; i-- {
+		step := p.Steps[i]
+		interrupted := step.Status == models.StepStatusFailed && step.Error == stepInterrupted
+		if step.Status != models.StepStatusCompleted && !interrupted {
+			continue
+		}
+
+		if err := steps[step.Name].compensate(ctx, p); err != nil {
+			step.Status = models.StepStatusCompensationFailed
+			step.Error = err.Error()
+			failed = true
+			log.Printf("Provisioning %s: failed to compensate %s: %v", p.ID, step.Name, err)
+			continue
+		}
+		if !interrupted {
+			step.Status = models.StepStatusCompensated
+		}
+	}
+
+	completedAt := s.now()
+	p.Status = models.ProvisioningStatusRolledBack
+	if failed {
+		p.Status = models.ProvisioningStatusRollbackFailed
+	}
+	p.Error = &reason
+	p.CompletedAt = &completedAt
+	if err := s.provisioningRepo.Update(ctx, p); err != nil {
+		log.Printf("Provisioning %s: failed to record rollback: %v", p.ID, err)
+	}
+
+	return p, fmt.Errorf("%w: %s", ErrProvisioningFailed, reason)
+}
+
+// resolveRequest validates a request and fills in its defaults, so that a
+// bad request is refused before anything is created
+func (s *provisioningService) resolveRequest(ctx context.Context, req *models.ProvisionTenantRequest) (*models.ProvisionTenantRequest, error) {
+	resolved := *req
+	resolved.Name = strings.TrimSpace(req.Name)
+	if len(resolved.Name) < 2 || len(resolved.Name) > 255 {
+		return nil, fmt.Errorf("name must be between 2 and 255 characters")
+	}
+
+	if resolved.Subdomain == "" {
+		resolved.Subdomain = "org-" + uuid.New().String()[:8]
+	} else if err := validateSubdomain(resolved.Subdomain); err != nil {
+		return nil, err
+	}
+	resolved.Subdomain = strings.ToLower(resolved.Subdomain)
+
+	if existing, _ := s.tenantRepo.GetBySubdomain(ctx, resolved.Subdomain); existing != nil {
+		return nil, fmt.Errorf("subdomain already exists")
+	}
+	if req.Domain != nil && *req.Domain != "" {
+		if existing, _ := s.tenantRepo.GetByDomain(ctx, *req.Domain); existing != nil {
+			return nil, fmt.Errorf("domain already exists")
+		}
+	} else {
+		resolved.Domain = nil
+	}
+
+	plan, err := s.resolvePlan(ctx, req.PlanID)
+	if err != nil {
+		return nil, err
+	}
+	planID := plan.ID.String()
+	resolved.PlanID = &planID
+
+	trialDays := models.DefaultTrialDays
+	if req.TrialDays != nil {
+		trialDays = *req.TrialDays
+	}
+	if trialDays < 0 || trialDays > maxTrialDays {
+		return nil, fmt.Errorf("trial_days must be between 0 and %d", maxTrialDays)
+	}
+	resolved.TrialDays = &trialDays
+
+	if resolved.Modules, err = s.resolveModules(ctx, req.Modules); err != nil {
+		return nil, err
+	}
+
+	if req.Admin != nil {
+		admin := *req.Admin
+		admin.Email = strings.ToLower(strings.TrimSpace(admin.Email))
+		if !strings.Contains(admin.Email, "@") {
+			return nil, fmt.Errorf("admin email is invalid")
+		}
+		if strings.TrimSpace(admin.FirstName) == "" || strings.TrimSpace(admin.LastName) == "" {
+			return nil, fmt.Errorf("admin first and last name are required")
+		}
+		if admin.Password == "" {
+			return nil, fmt.Errorf("admin password is required")
+		}
+		resolved.Admin = &admin
+	}
+
+	return &resolved, nil
+}
+
+// resolvePlan returns the requested plan, or the cheapest active plan
+func (s *provisioningService) resolvePlan(ctx context.Context, planID *string) (*models.Plan, error) {
+	if planID != nil && *planID != "" {
+		id, err := uuid.Parse(*planID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plan ID: %w", err)
+		}
+		plan, err := s.planRepo.GetByID(ctx, id)
+		if err != nil || !plan.IsActive {
+			return nil, fmt.Errorf("plan not found")
+		}
+		return plan, nil
+	}
+
+	plans, err := s.planRepo.ListActive(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plans: %w", err)
+	}
+
+	var cheapest *models.Plan
+	for _, plan := range plans {
+		if cheapest == nil || plan.Price < cheapest.Price {
+			cheapest = plan
+		}
+	}
+	if cheapest == nil {
+		return nil, fmt.Errorf("no active plan to subscribe to")
+	}
+
+	return cheapest, nil
+}
+
+// resolveModules checks the requested modules are active; without any,
+// every active module is enabled
+func (s *provisioningService) resolveModules(ctx context.Context, names []string) ([]string, error) {
+	modules, err := s.setupRepo.ListActiveModules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list modules: %w", err)
+	}
+
+	active := make(map[string]bool, len(modules))
+	var all []string
+	for _, module := range modules {
+		active[module.Name] = true
+		all = append(all, module.Name)
+	}
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	var resolved []string
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !active[name] {
+			return nil, fmt.Errorf("unknown module: %s", name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			resolved = append(resolved, name)
+		}
+	}
+
+	return resolved, nil
+}
+
+// Saga steps
+
+func (s *provisioningService) createTenant(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (string, bool, error) {
+	tenant := &models.Tenant{
+		Name:      req.Name,
+		Subdomain: req.Subdomain,
+		Domain:    req.Domain,
+		Status:    models.TenantStatusProvisioning,
+		Settings:  "{}",
+	}
+	if err := s.tenantRepo.Create(ctx, tenant); err != nil {
+		return "", false, err
+	}
+
+	p.TenantID = &tenant.ID
+	return tenant.ID.String(), false, nil
+}
+
+// deleteTenant also removes what the other steps left behind, as the
+// tenant's subscriptions, modules, configuration and users cascade with it
+func (s *provisioningService) deleteTenant(ctx context.Context, p *models.TenantProvisioning) error {
+	tenantID := p.TenantID
+	if tenantID == nil {
+		// Interrupted before the tenant ID was recorded: find the tenant by
+		// its subdomain, unless the subdomain has since been taken for good
+		tenant, err := s.tenantRepo.GetBySubdomain(ctx, p.Subdomain)
+		if err != nil || tenant.Status != models.TenantStatusProvisioning {
+			return nil
+		}
+		tenantID = &tenant.ID
+	}
+	return s.tenantRepo.Delete(ctx, *tenantID)
+}
+
+func (s *provisioningService) createConfiguration(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (string, bool, error) {
+	return "", false, s.setupRepo.CreateDefaultConfiguration(ctx, *p.TenantID)
+}
+
+func (s *provisioningService) deleteConfiguration(ctx context.Context, p *models.TenantProvisioning) error {
+	return s.setupRepo.DeleteConfiguration(ctx, *p.TenantID)
+}
+
+func (s *provisioningService) createSubscription(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (string, bool, error) {
+	plan, err := s.planRepo.GetByID(ctx, uuid.MustParse(*req.PlanID))
+	if err != nil {
+		return "", false, err
+	}
+
+	// The trial is a period of its own, so the billing engine invoices the
+	// first paid period when the trial ends
+	now := s.now()
+	subscription := &models.Subscription{
+		TenantID:           *p.TenantID,
+		PlanID:             plan.ID,
+		Status:             models.SubscriptionStatusActive,
+		CurrentPeriodStart: now,
+		CurrentPeriodEnd:   addBillingCycle(now, plan.BillingCycle),
+		BillingAnchor:      now,
+	}
+	if *req.TrialDays > 0 {
+		trialEnd := now.AddDate(0, 0, *req.TrialDays)
+		subscription.TrialEndAt = &trialEnd
+		subscription.CurrentPeriodEnd = trialEnd
+		subscription.BillingAnchor = trialEnd
+	}
+
+	if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
+		return "", false, err
+	}
+
+	p.SubscriptionID = &subscription.ID
+	return fmt.Sprintf("plan %s, %d day trial", *req.PlanID, *req.TrialDays), false, nil
+}
+
+func (s *provisioningService) deleteSubscription(ctx context.Context, p *models.TenantProvisioning) error {
+	if p.SubscriptionID == nil {
+		return nil
+	}
+	return s.subscriptionRepo.Delete(ctx, *p.SubscriptionID)
+}
+
+func (s *provisioningService) enableModules(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (string, bool, error) {
+	if len(req.Modules) == 0 {
+		return "no modules", true, nil
+	}
+
+	modules, err := s.setupRepo.ListActiveModules(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	var ids []uuid.UUID
+	for _, module := range modules {
+		if containsName(req.Modules, module.Name) {
+			ids = append(ids, module.ID)
+		}
+	}
+	if len(ids) != len(req.Modules) {
+		return "", false, fmt.Errorf("a requested module is no longer active")
+	}
+
+	if err := s.setupRepo.EnableModules(ctx, *p.TenantID, ids); err != nil {
+		return "", false, err
+	}
+
+	return strings.Join(req.Modules, ", "), false, nil
+}
+
+func (s *provisioningService) deleteModules(ctx context.Context, p *models.TenantProvisioning) error {
+	return s.setupRepo.DeleteModules(ctx, *p.TenantID)
+}
+
+func (s *provisioningService) createAdmin(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (string, bool, error) {
+	if req.Admin == nil {
+		return "no admin requested", true, nil
+	}
+
+	userID, err := s.authClient.CreateTenantAdmin(ctx, *p.TenantID, req.Admin)
+	if err != nil {
+		return "", false, err
+	}
+
+	p.AdminUserID = &userID
+	return req.Admin.Email, false, nil
+}
+
+func (s *provisioningService) deleteAdmin(ctx context.Context, p *models.TenantProvisioning) error {
+	if p.AdminUserID == nil {
+		return nil
+	}
+	return s.authClient.DeleteTenantUser(ctx, *p.TenantID, *p.AdminUserID)
+}
+
+func (s *provisioningService) seedData(ctx context.Context, p *models.TenantProvisioning, req *models.ProvisionTenantRequest) (string, bool, error) {
+	var seeded, unavailable []string
+	for _, module := range req.Modules {
+		ok, err := s.setupRepo.SeedModule(ctx, *p.TenantID, module)
+		switch {
+		case errors.Is(err, repositories.ErrSeedUnavailable):
+			unavailable = append(unavailable, module)
+		case err != nil:
+			return "", false, err
+		case ok:
+			seeded = append(seeded, module)
+		}
+	}
+
+	detail := "seeded: " + strings.Join(seeded, ", ")
+	if len(unavailable) > 0 {
+		detail += "; not installed: " + strings.Join(unavailable, ", ")
+	}
+	return detail, len(seeded) == 0, nil
+}
+
+func (s *provisioningService) deleteSeedData(ctx context.Context, p *models.TenantProvisioning) error {
+	for _, module := range p.Request.Modules {
+		if err := s.setupRepo.DeleteSeedData(ctx, *p.TenantID, module); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsName(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ProvisioningWorker rolls back provisioning sagas that stopped mid-way
+type ProvisioningWorker struct {
+	provisioningService ProvisioningService
+}
+
+func NewProvisioningWorker(provisioningService ProvisioningService) *ProvisioningWorker {
+	return &ProvisioningWorker{provisioningService: provisioningService}
+}
+
+// Run recovers interrupted sagas until ctx is cancelled
+func (w *ProvisioningWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if recovered, err := w.provisioningService.RecoverStale(ctx); err != nil {
+			log.Printf("Provisioning recovery: %v", err)
+		} else if recovered > 0 {
+			log.Printf("Provisioning recovery: rolled back %d interrupted provisioning(s)", recovered)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
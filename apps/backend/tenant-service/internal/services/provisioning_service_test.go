@@ -0,0 +1,507 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type provisioningFixture struct {
+	service       *provisioningService
+	provisionings *fakeProvisioningRepository
+	tenants       *fakeTenantRepository
+	subscriptions *fakeSubscriptionRepository
+	setup         *fakeTenantSetupRepository
+	auth          *fakeAuthClient
+	now           time.Time
+}
+
+func newProvisioningFixture() *provisioningFixture {
+	free, pro := uuid.New(), uuid.New()
+	f := &provisioningFixture{
+		provisionings: &fakeProvisioningRepository{provisionings: map[uuid.UUID]*models.TenantProvisioning{}},
+		tenants:       &fakeTenantRepository{tenants: map[uuid.UUID]*models.Tenant{}},
+		subscriptions: &fakeSubscriptionRepository{subscriptions: map[uuid.UUID]*models.Subscription{}},
+		setup: &fakeTenantSetupRepository{
+			modules: []*models.Module{
+				{ID: uuid.New(), Name: "checkin", IsActive: true},
+				{ID: uuid.New(), Name: "crm", IsActive: true},
+				{ID: uuid.New(), Name: "hrm", IsActive: true},
+			},
+			configurations: map[uuid.UUID]bool{},
+			enabled:        map[uuid.UUID][]uuid.UUID{},
+			seeded:         map[uuid.UUID][]string{},
+		},
+		auth: &fakeAuthClient{users: map[uuid.UUID]uuid.UUID{}},
+		now:  time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+	}
+	plans := &fakePlanRepository{plans: map[uuid.UUID]*models.Plan{
+		pro:  {ID: pro, Name: "Pro", Price: 49, IsActive: true},
+		free: {ID: free, Name: "Free", Price: 0, IsActive: true},
+	}}
+
+	f.provisionings.now = func() time.Time { return f.now }
+	service := NewProvisioningService(f.provisionings, f.tenants, f.subscriptions, plans, f.setup, f.auth).(*provisioningService)
+	service.now = func() time.Time { return f.now }
+	f.service = service
+	return f
+}
+
+func provisionRequest() *models.ProvisionTenantRequest {
+	return &models.ProvisionTenantRequest{
+		Name:      "Acme",
+		Subdomain: "acme",
+		Admin:     &models.ProvisionAdmin{Email: "Owner@Acme.test", FirstName: "Ola", LastName: "Berg", Password: "Correct1Pass"},
+	}
+}
+
+func stepStatuses(p *models.TenantProvisioning) map[string]string {
+	statuses := make(map[string]string)
+	for _, step := range p.Steps {
+		statuses[step.Name] = step.Status
+	}
+	return statuses
+}
+
+func TestProvisionRunsEveryStep(t *testing.T) {
+	f := newProvisioningFixture()
+
+	p, err := f.service.Provision(context.Background(), provisionRequest())
+	require.NoError(t, err)
+	assert.Equal(t, models.ProvisioningStatusCompleted, p.Status)
+	for _, name := range models.ProvisioningSteps {
+		assert.Equal(t, models.StepStatusCompleted, p.Step(name).Status, name)
+	}
+
+	tenant := f.tenants.tenants[*p.TenantID]
+	assert.Equal(t, models.TenantStatusTrial, tenant.Status, "the tenant is usable once provisioned")
+	assert.True(t, f.setup.configurations[tenant.ID])
+	assert.Len(t, f.setup.enabled[tenant.ID], 3, "every active module is enabled by default")
+	assert.ElementsMatch(t, []string{"checkin", "hrm"}, f.setup.seeded[tenant.ID])
+
+	subscription := f.subscriptions.subscriptions[*p.SubscriptionID]
+	assert.Equal(t, "Free", f.planName(subscription.PlanID), "the cheapest plan is used by default")
+	require.NotNil(t, subscription.TrialEndAt)
+	assert.Equal(t, f.now.AddDate(0, 0, models.DefaultTrialDays), *subscription.TrialEndAt)
+
+	assert.Equal(t, f.auth.users[*p.AdminUserID], tenant.ID)
+	assert.Equal(t, "owner@acme.test", f.auth.emails[0])
+
+	stored := f.provisionings.provisionings[p.ID]
+	assert.Empty(t, stored.Request.Admin.Password, "the admin password is not stored")
+}
+
+func TestProvisionRollsBackCompletedStepsInReverse(t *testing.T) {
+	f := newProvisioningFixture()
+	f.auth.err = errors.New("auth-service: password was found in a data breach")
+
+	p, err := f.service.Provision(context.Background(), provisionRequest())
+	require.ErrorIs(t, err, ErrProvisioningFailed)
+	require.NotNil(t, p)
+	assert.Equal(t, models.ProvisioningStatusRolledBack, p.Status)
+	assert.Contains(t, *p.Error, "admin_user step failed")
+	assert.Equal(t, map[string]string{
+		models.ProvisioningStepTenant:        models.StepStatusCompensated,
+		models.ProvisioningStepConfiguration: models.StepStatusCompensated,
+		models.ProvisioningStepSubscription:  models.StepStatusCompensated,
+		models.ProvisioningStepModules:       models.StepStatusCompensated,
+		models.ProvisioningStepAdminUser:     models.StepStatusFailed,
+		models.ProvisioningStepSeedData:      models.StepStatusPending,
+	}, stepStatuses(p))
+
+	assert.Empty(t, f.tenants.tenants)
+	assert.Empty(t, f.subscriptions.subscriptions)
+	assert.Empty(t, f.setup.configurations)
+	assert.Empty(t, f.setup.enabled)
+	assert.Equal(t, []string{"modules", "configuration"}, f.setup.compensations, "compensations run in reverse order")
+
+	// The outcome stays queryable
+	stored, err := f.service.GetProvisioning(context.Background(), p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ProvisioningStatusRolledBack, stored.Status)
+}
+
+func TestProvisionRecordsFailedCompensation(t *testing.T) {
+	f := newProvisioningFixture()
+	f.setup.seedErr = errors.New("connection reset")
+	f.auth.deleteErr = errors.New("auth-service unavailable")
+
+	p, err := f.service.Provision(context.Background(), provisionRequest())
+	require.ErrorIs(t, err, ErrProvisioningFailed)
+	assert.Equal(t, models.ProvisioningStatusRollbackFailed, p.Status)
+	assert.Equal(t, models.StepStatusCompensationFailed, p.Step(models.ProvisioningStepAdminUser).Status)
+	assert.Equal(t, "auth-service unavailable", p.Step(models.ProvisioningStepAdminUser).Error)
+	assert.Equal(t, models.StepStatusCompensated, p.Step(models.ProvisioningStepTenant).Status, "earlier steps are still undone")
+}
+
+func TestProvisionValidatesBeforeCreatingAnything(t *testing.T) {
+	f := newProvisioningFixture()
+	ctx := context.Background()
+	f.tenants.tenants[uuid.New()] = &models.Tenant{Subdomain: "taken", Status: models.TenantStatusActive}
+
+	cases := map[string]func(req *models.ProvisionTenantRequest){
+		"subdomain already exists":         func(req *models.ProvisionTenantRequest) { req.Subdomain = "taken" },
+		"subdomain 'admin' is reserved":    func(req *models.ProvisionTenantRequest) { req.Subdomain = "admin" },
+		"unknown module: lms":              func(req *models.ProvisionTenantRequest) { req.Modules = []string{"crm", "lms"} },
+		"trial_days must be between 0 and": func(req *models.ProvisionTenantRequest) { days := -1; req.TrialDays = &days },
+		"plan not found":                   func(req *models.ProvisionTenantRequest) { id := uuid.NewString(); req.PlanID = &id },
+		"admin password is required":       func(req *models.ProvisionTenantRequest) { req.Admin.Password = "" },
+	}
+	for message, mutate := range cases {
+		req := provisionRequest()
+		mutate(req)
+		p, err := f.service.Provision(ctx, req)
+		assert.ErrorContains(t, err, message)
+		assert.Nil(t, p)
+	}
+	assert.Empty(t, f.provisionings.provisionings)
+	assert.Len(t, f.tenants.tenants, 1)
+}
+
+func TestProvisionWithoutAdmin(t *testing.T) {
+	f := newProvisioningFixture()
+	req := provisionRequest()
+	req.Subdomain = ""
+	req.Admin = nil
+	req.Modules = []string{"CRM"}
+
+	p, err := f.service.Provision(context.Background(), req)
+	require.NoError(t, err)
+	assert.Regexp(t, `^org-[0-9a-f]{8}$`, p.Subdomain)
+	assert.Equal(t, models.StepStatusSkipped, p.Step(models.ProvisioningStepAdminUser).Status)
+	assert.Equal(t, models.StepStatusSkipped, p.Step(models.ProvisioningStepSeedData).Status, "crm has no seed data")
+	assert.Equal(t, []string{"crm"}, p.Request.Modules)
+	assert.Nil(t, p.AdminUserID)
+}
+
+func TestRecoverStaleRollsBackInterruptedProvisioning(t *testing.T) {
+	f := newProvisioningFixture()
+	ctx := context.Background()
+
+	// A saga that stopped while enabling modules
+	f.setup.enableHook = func() { panic("crash") }
+	assert.Panics(t, func() { f.service.Provision(ctx, provisionRequest()) })
+	f.setup.enableHook = nil
+	require.Len(t, f.tenants.tenants, 1)
+
+	recovered, err := f.service.RecoverStale(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, recovered, "a saga is not recovered while it may still be running")
+
+	f.now = f.now.Add(provisioningStaleAfter + time.Minute)
+	recovered, err = f.service.RecoverStale(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+
+	var p *models.TenantProvisioning
+	for _, stored := range f.provisionings.provisionings {
+		p = stored
+	}
+	assert.Equal(t, models.ProvisioningStatusRolledBack, p.Status)
+	assert.Equal(t, models.StepStatusFailed, p.Step(models.ProvisioningStepModules).Status)
+	assert.Equal(t, models.StepStatusCompensated, p.Step(models.ProvisioningStepTenant).Status)
+	assert.Empty(t, f.tenants.tenants)
+	assert.Contains(t, f.setup.compensations, "modules", "the interrupted step is compensated too")
+}
+
+func (f *provisioningFixture) planName(id uuid.UUID) string {
+	plan, _ := f.service.planRepo.GetByID(context.Background(), id)
+	return plan.Name
+}
+
+// In-memory repositories
+
+type fakeProvisioningRepository struct {
+	provisionings map[uuid.UUID]*models.TenantProvisioning
+	now           func() time.Time
+}
+
+func (r *fakeProvisioningRepository) Create(ctx context.Context, p *models.TenantProvisioning) error {
+	p.ID = uuid.New()
+	p.CreatedAt = r.now()
+	p.UpdatedAt = p.CreatedAt
+	r.provisionings[p.ID] = p
+	return nil
+}
+
+func (r *fakeProvisioningRepository) Update(ctx context.Context, p *models.TenantProvisioning) error {
+	if _, ok := r.provisionings[p.ID]; !ok {
+		return fmt.Errorf("provisioning not found")
+	}
+	p.UpdatedAt = r.now()
+	return nil
+}
+
+func (r *fakeProvisioningRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.TenantProvisioning, error) {
+	p, ok := r.provisionings[id]
+	if !ok {
+		return nil, fmt.Errorf("provisioning not found")
+	}
+	return p, nil
+}
+
+func (r *fakeProvisioningRepository) ClaimStale(ctx context.Context, before time.Time) (*models.TenantProvisioning, error) {
+	for _, p := range r.provisionings {
+		if p.Status == models.ProvisioningStatusRunning && p.UpdatedAt.Before(before) {
+			p.UpdatedAt = r.now()
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+type fakeTenantRepository struct {
+	tenants map[uuid.UUID]*models.Tenant
+}
+
+func (r *fakeTenantRepository) Create(ctx context.Context, tenant *models.Tenant) error {
+	tenant.ID = uuid.New()
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
+
+func (r *fakeTenantRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Tenant, error) {
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("tenant not found")
+	}
+	return tenant, nil
+}
+
+func (r *fakeTenantRepository) GetBySubdomain(ctx context.Context, subdomain string) (*models.Tenant, error) {
+	for _, tenant := range r.tenants {
+		if tenant.Subdomain == subdomain {
+			return tenant, nil
+		}
+	}
+	return nil, fmt.Errorf("tenant not found")
+}
+
+func (r *fakeTenantRepository) GetByDomain(ctx context.Context, domain string) (*models.Tenant, error) {
+	for _, tenant := range r.tenants {
+		if tenant.Domain != nil && *tenant.Domain == domain {
+			return tenant, nil
+		}
+	}
+	return nil, fmt.Errorf("tenant not found")
+}
+
+func (r *fakeTenantRepository) List(ctx context.Context, limit, offset int) ([]*models.Tenant, int, error) {
+	return nil, len(r.tenants), nil
+}
+
+func (r *fakeTenantRepository) Update(ctx context.Context, tenant *models.Tenant) error {
+	r.tenants[tenant.ID] = tenant
+	return nil
+}
+
+func (r *fakeTenantRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(r.tenants, id)
+	return nil
+}
+
+func (r *fakeTenantRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	if tenant, ok := r.tenants[id]; ok {
+		tenant.Status = status
+	}
+	return nil
+}
+
+func (r *fakeTenantRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	return map[string]int{}, nil
+}
+
+func (r *fakeTenantRepository) CountCreatedBetween(ctx context.Context, from, to time.Time) (int, error) {
+	return 0, nil
+}
+
+type fakeSubscriptionRepository struct {
+	subscriptions map[uuid.UUID]*models.Subscription
+}
+
+func (r *fakeSubscriptionRepository) Create(ctx context.Context, subscription *models.Subscription) error {
+	subscription.ID = uuid.New()
+	r.subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	return subscription, nil
+}
+
+func (r *fakeSubscriptionRepository) GetByTenantID(ctx context.Context, tenantID uuid.UUID) (*models.Subscription, error) {
+	for _, subscription := range r.subscriptions {
+		if subscription.TenantID == tenantID {
+			return subscription, nil
+		}
+	}
+	return nil, fmt.Errorf("subscription not found")
+}
+
+func (r *fakeSubscriptionRepository) List(ctx context.Context, limit, offset int) ([]*models.Subscription, int, error) {
+	return nil, len(r.subscriptions), nil
+}
+
+func (r *fakeSubscriptionRepository) Update(ctx context.Context, subscription *models.Subscription) error {
+	r.subscriptions[subscription.ID] = subscription
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(r.subscriptions, id)
+	return nil
+}
+
+func (r *fakeSubscriptionRepository) GetExpiring(ctx context.Context, days int) ([]*models.Subscription, error) {
+	return nil, nil
+}
+
+func (r *fakeSubscriptionRepository) RevenueAt(ctx context.Context, at time.Time) ([]*models.SubscriptionRevenue, error) {
+	return nil, nil
+}
+
+func (r *fakeSubscriptionRepository) CountTrialing(ctx context.Context, at time.Time) (int, error) {
+	return 0, nil
+}
+
+type fakePlanRepository struct {
+	plans map[uuid.UUID]*models.Plan
+}
+
+func (r *fakePlanRepository) Create(ctx context.Context, plan *models.Plan) error {
+	plan.ID = uuid.New()
+	r.plans[plan.ID] = plan
+	return nil
+}
+
+func (r *fakePlanRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Plan, error) {
+	plan, ok := r.plans[id]
+	if !ok {
+		return nil, fmt.Errorf("plan not found")
+	}
+	return plan, nil
+}
+
+func (r *fakePlanRepository) List(ctx context.Context, limit, offset int) ([]*models.Plan, int, error) {
+	plans, err := r.ListActive(ctx)
+	return plans, len(plans), err
+}
+
+func (r *fakePlanRepository) ListActive(ctx context.Context) ([]*models.Plan, error) {
+	var plans []*models.Plan
+	for _, plan := range r.plans {
+		if plan.IsActive {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+func (r *fakePlanRepository) Update(ctx context.Context, plan *models.Plan) error {
+	r.plans[plan.ID] = plan
+	return nil
+}
+
+func (r *fakePlanRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(r.plans, id)
+	return nil
+}
+
+type fakeTenantSetupRepository struct {
+	modules        []*models.Module
+	configurations map[uuid.UUID]bool
+	enabled        map[uuid.UUID][]uuid.UUID
+	seeded         map[uuid.UUID][]string
+	seedErr        error
+	enableHook     func()
+	// compensations records the compensations in the order they ran
+	compensations []string
+}
+
+func (r *fakeTenantSetupRepository) CreateDefaultConfiguration(ctx context.Context, tenantID uuid.UUID) error {
+	r.configurations[tenantID] = true
+	return nil
+}
+
+func (r *fakeTenantSetupRepository) DeleteConfiguration(ctx context.Context, tenantID uuid.UUID) error {
+	r.compensations = append(r.compensations, "configuration")
+	delete(r.configurations, tenantID)
+	return nil
+}
+
+func (r *fakeTenantSetupRepository) ListActiveModules(ctx context.Context) ([]*models.Module, error) {
+	return r.modules, nil
+}
+
+func (r *fakeTenantSetupRepository) EnableModules(ctx context.Context, tenantID uuid.UUID, moduleIDs []uuid.UUID) error {
+	if r.enableHook != nil {
+		r.enableHook()
+	}
+	r.enabled[tenantID] = moduleIDs
+	return nil
+}
+
+func (r *fakeTenantSetupRepository) DeleteModules(ctx context.Context, tenantID uuid.UUID) error {
+	r.compensations = append(r.compensations, "modules")
+	delete(r.enabled, tenantID)
+	return nil
+}
+
+func (r *fakeTenantSetupRepository) SeedModule(ctx context.Context, tenantID uuid.UUID, module string) (bool, error) {
+	if r.seedErr != nil {
+		return false, r.seedErr
+	}
+	if module != "hrm" && module != "checkin" {
+		return false, nil
+	}
+	r.seeded[tenantID] = append(r.seeded[tenantID], module)
+	return true, nil
+}
+
+func (r *fakeTenantSetupRepository) DeleteSeedData(ctx context.Context, tenantID uuid.UUID, module string) error {
+	delete(r.seeded, tenantID)
+	return nil
+}
+
+type fakeAuthClient struct {
+	users     map[uuid.UUID]uuid.UUID // user ID to tenant ID
+	emails    []string
+	notices   []string // templates of the notices sent to tenant admins
+	err       error
+	deleteErr error
+}
+
+func (c *fakeAuthClient) CreateTenantAdmin(ctx context.Context, tenantID uuid.UUID, admin *models.ProvisionAdmin) (uuid.UUID, error) {
+	if c.err != nil {
+		return uuid.Nil, c.err
+	}
+	userID := uuid.New()
+	c.users[userID] = tenantID
+	c.emails = append(c.emails, admin.Email)
+	return userID, nil
+}
+
+func (c *fakeAuthClient) DeleteTenantUser(ctx context.Context, tenantID, userID uuid.UUID) error {
+	if c.deleteErr != nil {
+		return c.deleteErr
+	}
+	delete(c.users, userID)
+	return nil
+}
+
+func (c *fakeAuthClient) NotifyTenantAdmins(ctx context.Context, tenantID uuid.UUID, notification *models.TenantNotification) error {
+	c.notices = append(c.notices, notification.Template)
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+	"zplus-saas/apps/backend/tenant-service/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// QuotaService enforces the limits of a tenant's plan: seats (MaxUsers) and
+// bytes stored (MaxStorage). Services ask it before they add users or files,
+// so usage is measured live rather than kept in counters that drift.
+type QuotaService interface {
+	GetUsage(ctx context.Context, tenantID uuid.UUID) (*models.TenantUsage, error)
+	// CheckQuota reports whether the tenant may add the requested amount of
+	// a resource. Going over a limit is an answer, not an error.
+	CheckQuota(ctx context.Context, tenantID uuid.UUID, req *models.QuotaCheckRequest) (*models.QuotaCheck, error)
+}
+
+type quotaService struct {
+	quotaRepo        repositories.QuotaRepository
+	subscriptionRepo repositories.SubscriptionRepository
+	planRepo         repositories.PlanRepository
+	now              func() time.Time
+}
+
+func NewQuotaService(
+	quotaRepo repositories.QuotaRepository,
+	subscriptionRepo repositories.SubscriptionRepository,
+	planRepo repositories.PlanRepository,
+) QuotaService {
+	return &quotaService{
+		quotaRepo:        quotaRepo,
+		subscriptionRepo: subscriptionRepo,
+		planRepo:         planRepo,
+		now:              time.Now,
+	}
+}
+
+func (s *quotaService) GetUsage(ctx context.Context, tenantID uuid.UUID) (*models.TenantUsage, error) {
+	plan, err := s.currentPlan(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.TenantUsage{
+		TenantID:   tenantID,
+		MeasuredAt: s.now(),
+	}
+
+	if usage.ActiveUsers, err = s.quotaRepo.CountActiveUsers(ctx, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if usage.PendingInvitations, err = s.quotaRepo.CountPendingInvitations(ctx, tenantID, usage.MeasuredAt); err != nil {
+		return nil, fmt.Errorf("failed to count invitations: %w", err)
+	}
+	usage.Users.Used = usage.ActiveUsers + usage.PendingInvitations
+
+	if usage.Storage.Used, err = s.quotaRepo.SumStoredBytes(ctx, tenantID); err != nil {
+		return nil, fmt.Errorf("failed to measure storage: %w", err)
+	}
+
+	if plan == nil {
+		return usage, nil
+	}
+
+	usage.PlanID = &plan.ID
+	usage.PlanName = plan.Name
+	if plan.MaxUsers != nil {
+		maxUsers := int64(*plan.MaxUsers)
+		usage.Users.Limit = &maxUsers
+	}
+	usage.Storage.Limit = plan.MaxStorage
+
+	return usage, nil
+}
+
+func (s *quotaService) CheckQuota(ctx context.Context, tenantID uuid.UUID, req *models.QuotaCheckRequest) (*models.QuotaCheck, error) {
+	if req.Amount < 0 {
+		return nil, fmt.Errorf("amount must not be negative")
+	}
+	switch req.Resource {
+	case models.QuotaResourceUsers, models.QuotaResourceStorage:
+	default:
+		return nil, fmt.Errorf("unknown quota resource %q", req.Resource)
+	}
+
+	usage, err := s.GetUsage(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var resource models.QuotaUsage
+	switch req.Resource {
+	case models.QuotaResourceUsers:
+		resource = usage.Users
+	case models.QuotaResourceStorage:
+		resource = usage.Storage
+	}
+
+	return &models.QuotaCheck{
+		Resource:  req.Resource,
+		Used:      resource.Used,
+		Requested: req.Amount,
+		Limit:     resource.Limit,
+		Allowed:   !resource.Exceeds(req.Amount),
+	}, nil
+}
+
+// currentPlan returns the plan of the tenant's active or past due
+// subscription, or nil if it has none
+func (s *quotaService) currentPlan(ctx context.Context, tenantID uuid.UUID) (*models.Plan, error) {
+	subscription, err := s.subscriptionRepo.GetByTenantID(ctx, tenantID)
+	if err != nil {
+		if err.Error() == "subscription not found" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load subscription: %w", err)
+	}
+	if subscription.Plan != nil && subscription.Plan.ID == subscription.PlanID {
+		return subscription.Plan, nil
+	}
+	return s.planRepo.GetByID(ctx, subscription.PlanID)
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"zplus-saas/apps/backend/tenant-service/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newQuotaFixture(plan *models.Plan) (*quotaService, *fakeQuotaRepository, uuid.UUID) {
+	tenantID := uuid.New()
+	quotas := &fakeQuotaRepository{}
+	subscriptions := &fakeSubscriptionRepository{subscriptions: map[uuid.UUID]*models.Subscription{}}
+	plans := &fakePlanRepository{plans: map[uuid.UUID]*models.Plan{}}
+	if plan != nil {
+		plans.plans[plan.ID] = plan
+		_ = subscriptions.Create(context.Background(), &models.Subscription{
+			TenantID: tenantID,
+			PlanID:   plan.ID,
+			Status:   models.SubscriptionStatusActive,
+		})
+	}
+
+	service := NewQuotaService(quotas, subscriptions, plans).(*quotaService)
+	service.now = func() time.Time { return time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC) }
+	return service, quotas, tenantID
+}
+
+func TestQuotaCountsPendingInvitationsAsSeats(t *testing.T) {
+	maxUsers := 5
+	maxStorage := int64(1 << 30)
+	plan := &models.Plan{ID: uuid.New(), Name: "Basic", MaxUsers: &maxUsers, MaxStorage: &maxStorage}
+	service, quotas, tenantID := newQuotaFixture(plan)
+	quotas.activeUsers = 3
+	quotas.pendingInvitations = 2
+	quotas.storedBytes = maxStorage - 100
+
+	usage, err := service.GetUsage(context.Background(), tenantID)
+	require.NoError(t, err)
+	assert.Equal(t, plan.ID, *usage.PlanID)
+	assert.Equal(t, int64(5), usage.Users.Used)
+	assert.Equal(t, int64(5), *usage.Users.Limit)
+
+	invite, err := service.CheckQuota(context.Background(), tenantID, &models.QuotaCheckRequest{Resource: models.QuotaResourceUsers, Amount: 1})
+	require.NoError(t, err)
+	assert.False(t, invite.Allowed, "every seat is taken or held by an invitation")
+
+	accept, err := service.CheckQuota(context.Background(), tenantID, &models.QuotaCheckRequest{Resource: models.QuotaResourceUsers})
+	require.NoError(t, err)
+	assert.True(t, accept.Allowed, "an accepted invitation uses the seat it holds")
+
+	upload, err := service.CheckQuota(context.Background(), tenantID, &models.QuotaCheckRequest{Resource: models.QuotaResourceStorage, Amount: 100})
+	require.NoError(t, err)
+	assert.True(t, upload.Allowed)
+	upload, err = service.CheckQuota(context.Background(), tenantID, &models.QuotaCheckRequest{Resource: models.QuotaResourceStorage, Amount: 101})
+	require.NoError(t, err)
+	assert.False(t, upload.Allowed)
+	assert.Equal(t, maxStorage, *upload.Limit)
+}
+
+func TestQuotaWithoutSubscriptionIsUnlimited(t *testing.T) {
+	service, quotas, tenantID := newQuotaFixture(nil)
+	quotas.activeUsers = 500
+
+	usage, err := service.GetUsage(context.Background(), tenantID)
+	require.NoError(t, err)
+	assert.Nil(t, usage.PlanID)
+	assert.Nil(t, usage.Users.Limit)
+	assert.Nil(t, usage.Storage.Limit)
+
+	check, err := service.CheckQuota(context.Background(), tenantID, &models.QuotaCheckRequest{Resource: models.QuotaResourceUsers, Amount: 1})
+	require.NoError(t, err)
+	assert.True(t, check.Allowed)
+
+	_, err = service.CheckQuota(context.Background(), tenantID, &models.QuotaCheckRequest{Resource: "records", Amount: 1})
+	assert.Error(t, err)
+}
+
+// fakeQuotaRepository measures a single tenant
+type fakeQuotaRepository struct {
+	activeUsers        int64
+	pendingInvitations int64
+	storedBytes        int64
+}
+
+func (r *fakeQuotaRepository) CountActiveUsers(ctx context.Context, tenantID uuid.UUID) (int64, error) {
+	return r.activeUsers, nil
+}
+
+func (r *fakeQuotaRepository) CountPendingInvitations(ctx context.Context, tenantID uuid.UUID, at time.Time) (int64, error) {
+	return r.pendingInvitations, nil
+}
+
+func (r *fakeQuotaRepository) SumStoredBytes(ctx context.Context, tenantID uuid.UUID) (int64, error) {
+	return r.storedBytes, nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
+	sharedmiddleware "zplus-saas/apps/backend/shared/middleware"
 	"zplus-saas/apps/backend/tenant-service/internal/models"
 )
 
@@ -37,7 +38,7 @@ func (s *TenantConfigService) GetTenantConfiguration(tenantID uuid.UUID) (*model
 			FeatureFlags:       "{}",
 			DataRetentionDays:  365,
 			TwoFactorRequired:  false,
-			PasswordPolicy:     `{"minLength": 8, "requireUppercase": true, "requireLowercase": true, "requireNumbers": true, "requireSpecialChars": false}`,
+			PasswordPolicy:     models.DefaultPasswordPolicy,
 			SessionTimeoutMins: 480, // 8 hours
 			CreatedAt:          time.Now(),
 			UpdatedAt:          time.Now(),
@@ -79,7 +80,7 @@ func (s *TenantConfigService) UpdateTenantConfiguration(tenantID uuid.UUID, req
 	}
 
 	if req.SecurityConfig != nil {
-		err := s.validateJSONConfig(*req.SecurityConfig)
+		err := s.validateSecurityConfig(*req.SecurityConfig)
 		if err != nil {
 			return fmt.Errorf("invalid security config: %w", err)
 		}
@@ -113,6 +114,14 @@ func (s *TenantConfigService) UpdateTenantConfiguration(tenantID uuid.UUID, req
 		}
 	}
 
+	// The gateway and auth-service enforce allowed_ips, see
+	// sharedmiddleware.IPAllowlist for the accepted formats
+	if req.AllowedIPs != nil {
+		if _, err := sharedmiddleware.ParseIPAllowlist(*req.AllowedIPs); err != nil {
+			return fmt.Errorf("invalid allowed IPs: %w", err)
+		}
+	}
+
 	// Build update query dynamically
 	setParts := []string{}
 	args := []interface{}{}
@@ -336,7 +345,8 @@ func (s *TenantConfigService) validateJSONConfig(config string) error {
 	return nil
 }
 
-// validatePasswordPolicy validates password policy configuration
+// validatePasswordPolicy validates password policy configuration. auth-service
+// enforces the policy wherever a password is set.
 func (s *TenantConfigService) validatePasswordPolicy(policy string) error {
 	var policyMap map[string]interface{}
 	err := json.Unmarshal([]byte(policy), &policyMap)
@@ -344,12 +354,76 @@ func (s *TenantConfigService) validatePasswordPolicy(policy string) error {
 		return fmt.Errorf("invalid JSON format: %w", err)
 	}
 
-	// Validate required fields
-	if minLength, exists := policyMap["minLength"]; exists {
-		if length, ok := minLength.(float64); ok && length < 6 {
-			return fmt.Errorf("minimum password length must be at least 6")
+	// bcrypt only uses the first 72 bytes of a password, so longer minimums
+	// cannot be enforced
+	err = validateIntRanges(policyMap, []intRange{
+		{"minLength", 6, 72},
+		{"historyCount", 0, 24},
+		{"maxAgeDays", 0, 3650},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range []string{"requireUppercase", "requireLowercase", "requireNumbers", "requireSpecialChars", "checkBreached"} {
+		if value, exists := policyMap[key]; exists {
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s must be true or false", key)
+			}
 		}
 	}
 
 	return nil
 }
+
+// validateSecurityConfig validates security configuration. auth-service reads
+// the "lockout" thresholds for brute-force protection of password logins.
+func (s *TenantConfigService) validateSecurityConfig(config string) error {
+	var configMap map[string]interface{}
+	err := json.Unmarshal([]byte(config), &configMap)
+	if err != nil {
+		return fmt.Errorf("invalid JSON format: %w", err)
+	}
+
+	lockout, exists := configMap["lockout"]
+	if !exists || lockout == nil {
+		return nil
+	}
+
+	lockoutMap, ok := lockout.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("lockout must be an object")
+	}
+
+	return validateIntRanges(lockoutMap, []intRange{
+		{"max_failed_attempts", 1, 100},
+		{"max_failed_attempts_per_ip", 1, 10000},
+		{"failure_window_minutes", 1, 1440},
+		{"lockout_minutes", 1, 1440},
+		{"delay_after_attempts", 0, 100},
+		{"max_delay_seconds", 1, 300},
+	})
+}
+
+// intRange is the allowed range of an integer setting in a JSON config
+type intRange struct {
+	key      string
+	min, max float64
+}
+
+func validateIntRanges(config map[string]interface{}, ranges []intRange) error {
+	for _, r := range ranges {
+		value, exists := config[r.key]
+		if !exists {
+			continue
+		}
+		number, ok := value.(float64)
+		if !ok || number != float64(int(number)) {
+			return fmt.Errorf("%s must be a whole number", r.key)
+		}
+		if number < r.min || number > r.max {
+			return fmt.Errorf("%s must be between %d and %d", r.key, int(r.min), int(r.max))
+		}
+	}
+	return nil
+}
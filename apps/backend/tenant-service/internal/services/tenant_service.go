@@ -38,96 +38,54 @@ type TenantService interface {
 	UpdateSubscription(ctx context.Context, tenantID uuid.UUID, req *models.UpdateSubscriptionRequest) (*models.Subscription, error)
 	CancelSubscription(ctx context.Context, tenantID uuid.UUID) error
 	GetExpiringSubscriptions(ctx context.Context, days int) ([]*models.Subscription, error)
+
+	// Statistics
+	GetStats(ctx context.Context, days int) (*models.TenantStats, error)
 }
 
 type tenantService struct {
 	tenantRepo       repositories.TenantRepository
 	subscriptionRepo repositories.SubscriptionRepository
 	planRepo         repositories.PlanRepository
+	provisioning     ProvisioningService
 }
 
 func NewTenantService(
 	tenantRepo repositories.TenantRepository,
 	subscriptionRepo repositories.SubscriptionRepository,
 	planRepo repositories.PlanRepository,
+	provisioning ProvisioningService,
 ) TenantService {
 	return &tenantService{
 		tenantRepo:       tenantRepo,
 		subscriptionRepo: subscriptionRepo,
 		planRepo:         planRepo,
+		provisioning:     provisioning,
 	}
 }
 
 // Tenant management
+
+// CreateTenant provisions the tenant with its configuration, a trial
+// subscription and modules. A failed provisioning is rolled back and leaves
+// no tenant behind.
 func (s *tenantService) CreateTenant(ctx context.Context, req *models.CreateTenantRequest) (*models.Tenant, error) {
-	// Validate subdomain
-	if err := s.validateSubdomain(req.Subdomain); err != nil {
+	// Validate subdomain; provisioning would generate a missing one
+	if err := validateSubdomain(req.Subdomain); err != nil {
 		return nil, err
 	}
 
-	// Check if subdomain already exists
-	existing, _ := s.tenantRepo.GetBySubdomain(ctx, req.Subdomain)
-	if existing != nil {
-		return nil, fmt.Errorf("subdomain already exists")
-	}
-
-	// Check domain if provided
-	if req.Domain != nil && *req.Domain != "" {
-		existing, _ := s.tenantRepo.GetByDomain(ctx, *req.Domain)
-		if existing != nil {
-			return nil, fmt.Errorf("domain already exists")
-		}
-	}
-
-	tenant := &models.Tenant{
+	provisioning, err := s.provisioning.Provision(ctx, &models.ProvisionTenantRequest{
 		Name:      req.Name,
-		Subdomain: strings.ToLower(req.Subdomain),
+		Subdomain: req.Subdomain,
 		Domain:    req.Domain,
-		Status:    models.TenantStatusTrial, // Start with trial
-		Settings:  "{}",
-	}
-
-	if err := s.tenantRepo.Create(ctx, tenant); err != nil {
-		return nil, fmt.Errorf("failed to create tenant: %w", err)
-	}
-
-	// Create default subscription if plan is provided
-	if req.PlanID != nil && *req.PlanID != "" {
-		planUUID, err := uuid.Parse(*req.PlanID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid plan ID: %w", err)
-		}
-
-		// Verify plan exists
-		_, err = s.planRepo.GetByID(ctx, planUUID)
-		if err != nil {
-			return nil, fmt.Errorf("plan not found: %w", err)
-		}
-
-		// Create subscription
-		now := time.Now()
-		subscription := &models.Subscription{
-			TenantID:           tenant.ID,
-			PlanID:             planUUID,
-			Status:             models.SubscriptionStatusActive,
-			TrialEndAt:         &time.Time{}, // 14 days trial
-			CurrentPeriodStart: now,
-			CurrentPeriodEnd:   now.AddDate(0, 1, 0), // 1 month
-			CancelAtPeriodEnd:  false,
-		}
-
-		// Set trial end date (14 days)
-		trialEnd := now.AddDate(0, 0, 14)
-		subscription.TrialEndAt = &trialEnd
-
-		if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
-			// If subscription creation fails, we should still return the tenant
-			// but log the error
-			// TODO: Add proper logging
-		}
+		PlanID:    req.PlanID,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return tenant, nil
+	return s.tenantRepo.GetByID(ctx, *provisioning.TenantID)
 }
 
 func (s *tenantService) GetTenant(ctx context.Context, id uuid.UUID) (*models.Tenant, error) {
@@ -314,9 +272,9 @@ func (s *tenantService) CreateSubscription(ctx context.Context, tenantID uuid.UU
 		return nil, fmt.Errorf("plan not found: %w", err)
 	}
 
-	// Cancel existing active subscription
+	// Cancel existing active or past due subscription
 	existing, _ := s.subscriptionRepo.GetByTenantID(ctx, tenantID)
-	if existing != nil && existing.Status == models.SubscriptionStatusActive {
+	if existing != nil {
 		existing.Status = models.SubscriptionStatusCancelled
 		s.subscriptionRepo.Update(ctx, existing)
 	}
@@ -328,8 +286,13 @@ func (s *tenantService) CreateSubscription(ctx context.Context, tenantID uuid.UU
 		TrialEndAt:         req.TrialEndAt,
 		CurrentPeriodStart: req.CurrentPeriodStart,
 		CurrentPeriodEnd:   req.CurrentPeriodEnd,
+		BillingAnchor:      req.CurrentPeriodStart,
 		CancelAtPeriodEnd:  false,
 	}
+	if req.TrialEndAt != nil && req.TrialEndAt.After(req.CurrentPeriodStart) {
+		// Paid periods are counted from the end of the trial
+		subscription.BillingAnchor = *req.TrialEndAt
+	}
 
 	if err := s.subscriptionRepo.Create(ctx, subscription); err != nil {
 		return nil, fmt.Errorf("failed to create subscription: %w", err)
@@ -348,19 +311,9 @@ func (s *tenantService) UpdateSubscription(ctx context.Context, tenantID uuid.UU
 		return nil, err
 	}
 
-	// Update fields if provided
-	if req.PlanID != nil {
-		planUUID, err := uuid.Parse(*req.PlanID)
-		if err != nil {
-			return nil, fmt.Errorf("invalid plan ID: %w", err)
-		}
-
-		_, err = s.planRepo.GetByID(ctx, planUUID)
-		if err != nil {
-			return nil, fmt.Errorf("plan not found: %w", err)
-		}
-
-		subscription.PlanID = planUUID
+	// Plan changes are prorated by the billing engine
+	if req.PlanID != nil && *req.PlanID != subscription.PlanID.String() {
+		return nil, fmt.Errorf("use change-plan to change the plan of a subscription")
 	}
 
 	if req.Status != nil {
@@ -370,7 +323,9 @@ func (s *tenantService) UpdateSubscription(ctx context.Context, tenantID uuid.UU
 		subscription.TrialEndAt = req.TrialEndAt
 	}
 	if req.CurrentPeriodStart != nil {
+		// Moving the period moves the day later periods start on
 		subscription.CurrentPeriodStart = *req.CurrentPeriodStart
+		subscription.BillingAnchor = *req.CurrentPeriodStart
 	}
 	if req.CurrentPeriodEnd != nil {
 		subscription.CurrentPeriodEnd = *req.CurrentPeriodEnd
@@ -392,7 +347,7 @@ func (s *tenantService) CancelSubscription(ctx context.Context, tenantID uuid.UU
 		return err
 	}
 
-	subscription.Status = models.SubscriptionStatusCancelled
+	// The billing engine cancels the subscription when its period ends
 	subscription.CancelAtPeriodEnd = true
 
 	return s.subscriptionRepo.Update(ctx, subscription)
@@ -402,8 +357,76 @@ func (s *tenantService) GetExpiringSubscriptions(ctx context.Context, days int)
 	return s.subscriptionRepo.GetExpiring(ctx, days)
 }
 
+// Statistics
+func (s *tenantService) GetStats(ctx context.Context, days int) (*models.TenantStats, error) {
+	if days < 1 || days > 365 {
+		return nil, fmt.Errorf("days must be between 1 and 365")
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+	previousSince := since.AddDate(0, 0, -days)
+
+	byStatus, err := s.tenantRepo.CountByStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tenants: %w", err)
+	}
+
+	stats := &models.TenantStats{
+		Days:            days,
+		TenantsByStatus: byStatus,
+		GeneratedAt:     now,
+	}
+	for _, count := range byStatus {
+		stats.TotalTenants += count
+	}
+
+	if stats.NewTenants, err = s.tenantRepo.CountCreatedBetween(ctx, since, now); err != nil {
+		return nil, fmt.Errorf("failed to count new tenants: %w", err)
+	}
+	if stats.PreviousNewTenants, err = s.tenantRepo.CountCreatedBetween(ctx, previousSince, since); err != nil {
+		return nil, fmt.Errorf("failed to count new tenants: %w", err)
+	}
+	if stats.TrialSubscriptions, err = s.subscriptionRepo.CountTrialing(ctx, now); err != nil {
+		return nil, fmt.Errorf("failed to count trial subscriptions: %w", err)
+	}
+
+	current, err := s.subscriptionRepo.RevenueAt(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute revenue: %w", err)
+	}
+	previous, err := s.subscriptionRepo.RevenueAt(ctx, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute revenue: %w", err)
+	}
+
+	// A currency only billed in the previous period still shows, with no MRR
+	byCurrency := make(map[string]*models.SubscriptionRevenue)
+	for _, revenue := range current {
+		revenue.ARR = revenue.MRR * 12
+		byCurrency[revenue.Currency] = revenue
+		stats.ActiveSubscriptions += revenue.Subscriptions
+		stats.Revenue = append(stats.Revenue, revenue)
+	}
+	for _, revenue := range previous {
+		if existing, ok := byCurrency[revenue.Currency]; ok {
+			existing.PreviousMRR = revenue.MRR
+			continue
+		}
+		stats.Revenue = append(stats.Revenue, &models.SubscriptionRevenue{
+			Currency:    revenue.Currency,
+			PreviousMRR: revenue.MRR,
+		})
+	}
+	if stats.Revenue == nil {
+		stats.Revenue = []*models.SubscriptionRevenue{}
+	}
+
+	return stats, nil
+}
+
 // Helper functions
-func (s *tenantService) validateSubdomain(subdomain string) error {
+func validateSubdomain(subdomain string) error {
 	// Basic validation
 	if len(subdomain) < 3 || len(subdomain) > 63 {
 		return fmt.Errorf("subdomain must be between 3 and 63 characters")
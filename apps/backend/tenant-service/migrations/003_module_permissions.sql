@@ -0,0 +1,63 @@
+-- Fine-grained module permissions ("<module>.<resource>.<action>")
+-- Replaces the coarse read/write/delete permissions seeded in 002. Tenants build
+-- custom roles in auth-service from the permissions active modules declare.
+
+INSERT INTO module_permissions (module_id, permission, description, category)
+SELECT m.id, p.permission, p.description, p.category
+FROM (VALUES
+    ('crm', 'crm.lead.read', 'View leads', 'lead'),
+    ('crm', 'crm.lead.write', 'Create and edit leads', 'lead'),
+    ('crm', 'crm.lead.delete', 'Delete leads', 'lead'),
+    ('crm', 'crm.customer.read', 'View customers', 'customer'),
+    ('crm', 'crm.customer.write', 'Create and edit customers', 'customer'),
+    ('crm', 'crm.customer.delete', 'Delete customers', 'customer'),
+    ('crm', 'crm.opportunity.read', 'View opportunities', 'opportunity'),
+    ('crm', 'crm.opportunity.write', 'Create and edit opportunities', 'opportunity'),
+    ('hrm', 'hrm.employee.read', 'View employees', 'employee'),
+    ('hrm', 'hrm.employee.write', 'Create and edit employees', 'employee'),
+    ('hrm', 'hrm.employee.delete', 'Delete employees', 'employee'),
+    ('hrm', 'hrm.department.read', 'View departments', 'department'),
+    ('hrm', 'hrm.department.write', 'Create and edit departments', 'department'),
+    ('hrm', 'hrm.leave.read', 'View leave requests', 'leave'),
+    ('hrm', 'hrm.leave.write', 'Submit leave requests', 'leave'),
+    ('hrm', 'hrm.leave.approve', 'Approve and reject leave requests', 'leave'),
+    ('hrm', 'hrm.salary.read', 'View salaries', 'salary'),
+    ('hrm', 'hrm.salary.write', 'Change salaries', 'salary'),
+    ('pos', 'pos.sale.read', 'View sales', 'sale'),
+    ('pos', 'pos.sale.write', 'Ring up sales', 'sale'),
+    ('pos', 'pos.sale.refund', 'Refund sales', 'sale'),
+    ('pos', 'pos.product.read', 'View products', 'product'),
+    ('pos', 'pos.product.write', 'Create and edit products', 'product'),
+    ('pos', 'pos.inventory.read', 'View inventory', 'inventory'),
+    ('pos', 'pos.inventory.write', 'Adjust inventory', 'inventory'),
+    ('lms', 'lms.course.read', 'View courses', 'course'),
+    ('lms', 'lms.course.write', 'Create and edit courses', 'course'),
+    ('lms', 'lms.enrollment.read', 'View enrollments', 'enrollment'),
+    ('lms', 'lms.enrollment.write', 'Enroll learners', 'enrollment'),
+    ('checkin', 'checkin.attendance.read', 'View attendance', 'attendance'),
+    ('checkin', 'checkin.attendance.write', 'Check in and out', 'attendance'),
+    ('checkin', 'checkin.attendance.manage', 'Correct attendance records', 'attendance'),
+    ('payment', 'payment.transaction.read', 'View transactions', 'transaction'),
+    ('payment', 'payment.transaction.write', 'Create transactions', 'transaction'),
+    ('payment', 'payment.refund.write', 'Issue refunds', 'refund'),
+    ('accounting', 'accounting.ledger.read', 'View the ledger', 'ledger'),
+    ('accounting', 'accounting.ledger.write', 'Post journal entries', 'ledger'),
+    ('accounting', 'accounting.report.read', 'View financial reports', 'report'),
+    ('ecommerce', 'ecommerce.product.read', 'View store products', 'product'),
+    ('ecommerce', 'ecommerce.product.write', 'Create and edit store products', 'product'),
+    ('ecommerce', 'ecommerce.product.delete', 'Delete store products', 'product'),
+    ('ecommerce', 'ecommerce.order.read', 'View orders', 'order'),
+    ('ecommerce', 'ecommerce.order.write', 'Fulfil and edit orders', 'order')
+) AS p(module, permission, description, category)
+JOIN modules m ON m.name = p.module
+ON CONFLICT (module_id, permission) DO NOTHING;
+
+-- modules.permissions is what auth-service grants from; module_permissions
+-- only describes each entry
+UPDATE modules m
+SET permissions = COALESCE((
+        SELECT json_agg(mp.permission ORDER BY mp.permission)::text
+        FROM module_permissions mp
+        WHERE mp.module_id = m.id
+    ), '[]'),
+    updated_at = NOW();
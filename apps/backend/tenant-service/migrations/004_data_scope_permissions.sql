@@ -0,0 +1,25 @@
+-- Record-level data scope and sensitive field permissions
+-- Without a scope permission, CRM leads/opportunities and HRM employees are
+-- limited to the caller's own records.
+
+INSERT INTO module_permissions (module_id, permission, description, category)
+SELECT m.id, p.permission, p.description, p.category
+FROM (VALUES
+    ('crm', 'crm.lead.scope.team', 'View and edit leads of own team', 'lead'),
+    ('crm', 'crm.lead.scope.tenant', 'View and edit all leads', 'lead'),
+    ('crm', 'crm.opportunity.scope.team', 'View and edit opportunities of own team', 'opportunity'),
+    ('crm', 'crm.opportunity.scope.tenant', 'View and edit all opportunities', 'opportunity'),
+    ('hrm', 'hrm.employee.scope.team', 'View and edit employees of own department and direct reports', 'employee'),
+    ('hrm', 'hrm.employee.scope.tenant', 'View and edit all employees', 'employee'),
+    ('hrm', 'hrm.employee.emergency.read', 'View employee emergency contacts', 'employee')
+) AS p(module, permission, description, category)
+JOIN modules m ON m.name = p.module
+ON CONFLICT (module_id, permission) DO NOTHING;
+
+UPDATE modules m
+SET permissions = COALESCE((
+        SELECT json_agg(mp.permission ORDER BY mp.permission)::text
+        FROM module_permissions mp
+        WHERE mp.module_id = m.id
+    ), '[]'),
+    updated_at = NOW();
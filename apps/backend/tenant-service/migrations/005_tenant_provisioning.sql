@@ -0,0 +1,36 @@
+-- Migration: 005_tenant_provisioning.sql
+-- Description: Track tenant provisioning sagas and reconcile the tenants table
+-- shared with auth-service
+
+-- auth-service and tenant-service both create tenants; whichever migration
+-- ran first decided the columns, so add the ones the other service reads
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS logo TEXT;
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS status VARCHAR(20) DEFAULT 'trial';
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS plan_type VARCHAR(50) DEFAULT 'free';
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS is_active BOOLEAN DEFAULT true;
+
+-- Tenants are 'provisioning' until every provisioning step has completed
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_status_check;
+ALTER TABLE tenants ADD CONSTRAINT tenants_status_check
+    CHECK (status IN ('active', 'suspended', 'trial', 'provisioning'));
+
+-- One row per provisioning attempt. tenant_id has no foreign key: the row
+-- outlives the tenant when the saga is rolled back.
+CREATE TABLE IF NOT EXISTS tenant_provisionings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID,
+    subdomain VARCHAR(100) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'running'
+        CHECK (status IN ('running', 'completed', 'rolled_back', 'rollback_failed')),
+    steps JSONB NOT NULL DEFAULT '[]',
+    request JSONB NOT NULL DEFAULT '{}', -- never holds the admin password
+    subscription_id UUID,
+    admin_user_id UUID,
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_provisionings_tenant_id ON tenant_provisionings(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_tenant_provisionings_running ON tenant_provisionings(updated_at) WHERE status = 'running';
@@ -0,0 +1,46 @@
+-- Migration: 006_subscription_billing.sql
+-- Description: Invoices generated by the billing engine and the past_due
+-- subscription status
+
+-- Subscriptions with an overdue invoice are past_due until it is paid
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_status_check;
+ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_status_check
+    CHECK (status IN ('active', 'past_due', 'cancelled', 'expired'));
+
+CREATE SEQUENCE IF NOT EXISTS invoice_number_seq;
+
+-- One invoice per billed period or plan change. A negative subtotal is a
+-- credit: the invoice is paid when issued and later invoices consume the
+-- credit through credit_applied.
+CREATE TABLE IF NOT EXISTS invoices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    number VARCHAR(20) UNIQUE NOT NULL,
+    reason VARCHAR(30) NOT NULL
+        CHECK (reason IN ('subscription_create', 'subscription_cycle', 'trial_conversion', 'plan_change')),
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'paid', 'void')),
+    currency VARCHAR(3) NOT NULL,
+    lines JSONB NOT NULL DEFAULT '[]',
+    subtotal DECIMAL(10,2) NOT NULL,
+    credit_applied DECIMAL(10,2) NOT NULL DEFAULT 0,
+    total DECIMAL(10,2) NOT NULL,
+    period_start TIMESTAMPTZ NOT NULL,
+    period_end TIMESTAMPTZ NOT NULL,
+    issued_at TIMESTAMPTZ NOT NULL,
+    due_at TIMESTAMPTZ NOT NULL,
+    paid_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_tenant_id ON invoices(tenant_id, issued_at DESC);
+CREATE INDEX IF NOT EXISTS idx_invoices_subscription_period ON invoices(subscription_id, period_start);
+CREATE INDEX IF NOT EXISTS idx_invoices_open_due ON invoices(due_at) WHERE status = 'open';
+
+-- The billing engine issues at most one invoice per subscription period
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoices_period_unique ON invoices(subscription_id, period_start)
+    WHERE reason IN ('subscription_create', 'subscription_cycle', 'trial_conversion');
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS invoice_id UUID REFERENCES invoices(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_invoice ON payments(invoice_id);
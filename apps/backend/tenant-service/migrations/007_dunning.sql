@@ -0,0 +1,34 @@
+-- Migration: 007_dunning.sql
+-- Description: Dunning cases collecting unpaid invoices before the tenant is
+-- suspended
+
+CREATE TABLE IF NOT EXISTS dunning_cases (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    subscription_id UUID NOT NULL REFERENCES subscriptions(id) ON DELETE CASCADE,
+    invoice_id UUID NOT NULL REFERENCES invoices(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open'
+        CHECK (status IN ('open', 'suspended', 'recovered', 'closed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ,
+    last_attempt_at TIMESTAMPTZ,
+    last_error TEXT,
+    reminders_sent INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL,
+    grace_ends_at TIMESTAMPTZ NOT NULL,
+    suspended_at TIMESTAMPTZ,
+    resolved_at TIMESTAMPTZ,
+    -- A worker processing the case holds it until then
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_dunning_cases_tenant ON dunning_cases(tenant_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_dunning_cases_next_attempt ON dunning_cases(next_attempt_at)
+    WHERE status IN ('open', 'suspended');
+CREATE INDEX IF NOT EXISTS idx_dunning_cases_grace ON dunning_cases(grace_ends_at) WHERE status = 'open';
+
+-- An invoice is collected by one case at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dunning_cases_invoice_active ON dunning_cases(invoice_id)
+    WHERE status IN ('open', 'suspended');
@@ -0,0 +1,34 @@
+-- Migration: 009_metering.sql
+-- Description: Usage events reported by the services and the metered price
+-- components of plans, billed in arrears on the next invoice
+
+CREATE TABLE IF NOT EXISTS usage_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL,
+    quantity DECIMAL(20,6) NOT NULL CHECK (quantity > 0),
+    occurred_at TIMESTAMPTZ NOT NULL,
+    -- A retried report carries the same key and is counted once
+    idempotency_key VARCHAR(200) NOT NULL,
+    source VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tenant_id, metric, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_events_tenant_occurred ON usage_events(tenant_id, occurred_at);
+
+-- Usage beyond the included quantity is billed at unit_price, alongside the
+-- plan's flat price
+CREATE TABLE IF NOT EXISTS plan_metered_prices (
+    plan_id UUID NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+    metric VARCHAR(50) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    unit_price DECIMAL(12,6) NOT NULL CHECK (unit_price >= 0),
+    included_quantity DECIMAL(20,6) NOT NULL DEFAULT 0 CHECK (included_quantity >= 0),
+    PRIMARY KEY (plan_id, metric)
+);
+
+-- The usage of a subscription's last period is billed when it is cancelled
+ALTER TABLE invoices DROP CONSTRAINT IF EXISTS invoices_reason_check;
+ALTER TABLE invoices ADD CONSTRAINT invoices_reason_check
+    CHECK (reason IN ('subscription_create', 'subscription_cycle', 'trial_conversion', 'plan_change', 'usage'));
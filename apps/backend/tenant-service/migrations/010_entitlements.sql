@@ -0,0 +1,31 @@
+-- Migration: 010_entitlements.sql
+-- Description: Versioned entitlements of plans and per tenant overrides.
+-- plans.features stays the marketing feature list shown on pricing pages.
+
+CREATE TABLE IF NOT EXISTS plan_entitlement_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    plan_id UUID NOT NULL REFERENCES plans(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL CHECK (version > 0),
+    features JSONB NOT NULL DEFAULT '{}',
+    limits JSONB NOT NULL DEFAULT '{}',
+    modules JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (plan_id, version)
+);
+
+-- A subscription without a version follows the latest version of its plan.
+-- Publishing a version pins the plan's subscribers to the version they had,
+-- and changing plans unpins.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS entitlement_version INTEGER;
+
+CREATE TABLE IF NOT EXISTS tenant_entitlement_overrides (
+    tenant_id UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    features JSONB NOT NULL DEFAULT '{}',
+    -- A null limit lifts the plan's limit
+    limits JSONB NOT NULL DEFAULT '{}',
+    modules JSONB NOT NULL DEFAULT '{}',
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
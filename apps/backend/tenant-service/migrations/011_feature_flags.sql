@@ -0,0 +1,27 @@
+-- Migration: 011_feature_flags.sql
+-- Description: Feature flags evaluated by the services from a cached
+-- ruleset. tenant_configurations.feature_flags is superseded by targeting
+-- rules on the tenant.
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    key VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('boolean', 'multivariate')),
+    variations JSONB NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    off_variation VARCHAR(100) NOT NULL,
+    rules JSONB NOT NULL DEFAULT '[]',
+    fallthrough JSONB NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The version of the ruleset increases on every flag change, so clients
+-- can tell whether their copy is current
+CREATE TABLE IF NOT EXISTS feature_flag_ruleset (
+    id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+    version BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO feature_flag_ruleset (id, version) VALUES (true, 0) ON CONFLICT DO NOTHING;
@@ -0,0 +1,32 @@
+-- Migration: 012_module_lifecycle.sql
+-- Description: Lifecycle hooks the services implementing a module run for a
+-- tenant. Installing, upgrading, enabling, disabling and uninstalling queue
+-- jobs that a worker delivers, retrying failed hooks with backoff.
+
+-- A module is installing, updating or uninstalling until its hook succeeds
+-- and failed once the hook gave up; an uninstalling module gets its
+-- uninstalled_at when the uninstall hook succeeded.
+CREATE TABLE IF NOT EXISTS module_lifecycle_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    installation_id UUID NOT NULL REFERENCES module_installations(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    module_id UUID NOT NULL REFERENCES modules(id) ON DELETE CASCADE,
+    -- Jobs of a batch, e.g. a module and its dependencies, run in position
+    -- order, and a failed job fails the jobs after it
+    batch_id UUID NOT NULL,
+    position INTEGER NOT NULL,
+    event VARCHAR(20) NOT NULL CHECK (event IN ('install', 'upgrade', 'enable', 'disable', 'uninstall')),
+    version VARCHAR(20) NOT NULL,
+    from_version VARCHAR(20),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'succeeded', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    error_message TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ,
+    UNIQUE (batch_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS idx_module_lifecycle_jobs_due ON module_lifecycle_jobs(next_attempt_at) WHERE status IN ('pending', 'running');
+CREATE INDEX IF NOT EXISTS idx_module_lifecycle_jobs_installation_id ON module_lifecycle_jobs(installation_id);
@@ -0,0 +1,48 @@
+-- Migration: 013_module_upgrades.sql
+-- Description: Upgrades of tenants' modules to the catalog version and back,
+-- with their history, and staged rollouts upgrading a cohort of tenants at a
+-- time. Upgrades run through the module lifecycle jobs; an upgrade whose hook
+-- gave up is rolled back to the version it started from.
+
+-- A rollout of a module version. Advancing it upgrades the next cohort of
+-- tenants; it pauses once max_failures of its upgrades rolled back or failed.
+CREATE TABLE IF NOT EXISTS module_rollouts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    module_id UUID NOT NULL REFERENCES modules(id) ON DELETE CASCADE,
+    to_version VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'completed', 'cancelled')),
+    max_failures INTEGER NOT NULL DEFAULT 1 CHECK (max_failures > 0),
+    created_by UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One rollout of a module at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_module_rollouts_module_open ON module_rollouts(module_id) WHERE status IN ('active', 'paused');
+
+-- An upgrade of a tenant's module from one version to another, rolled back
+-- automatically when it fails or on request once it completed
+CREATE TABLE IF NOT EXISTS module_upgrades (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    installation_id UUID NOT NULL REFERENCES module_installations(id) ON DELETE CASCADE,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    module_id UUID NOT NULL REFERENCES modules(id) ON DELETE CASCADE,
+    rollout_id UUID REFERENCES module_rollouts(id) ON DELETE SET NULL,
+    from_version VARCHAR(20) NOT NULL,
+    to_version VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'upgrading' CHECK (status IN ('upgrading', 'completed', 'rolling_back', 'rolled_back', 'failed')),
+    error_message TEXT,
+    requested_by UUID,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_module_upgrades_installation_id ON module_upgrades(installation_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_module_upgrades_rollout_id ON module_upgrades(rollout_id) WHERE rollout_id IS NOT NULL;
+
+-- Upgrade and rollback jobs belong to an upgrade. A rollback hook moves the
+-- tenant's data from from_version back down to version.
+ALTER TABLE module_lifecycle_jobs ADD COLUMN IF NOT EXISTS upgrade_id UUID REFERENCES module_upgrades(id) ON DELETE CASCADE;
+ALTER TABLE module_lifecycle_jobs DROP CONSTRAINT IF EXISTS module_lifecycle_jobs_event_check;
+ALTER TABLE module_lifecycle_jobs ADD CONSTRAINT module_lifecycle_jobs_event_check
+    CHECK (event IN ('install', 'upgrade', 'enable', 'disable', 'uninstall', 'rollback'));
@@ -0,0 +1,17 @@
+-- Migration: 014_billing_anchor.sql
+-- Description: The day a subscription's billing periods are counted from, so a
+-- period clamped to the end of a short month does not move every later renewal
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS billing_anchor TIMESTAMPTZ;
+
+-- Existing subscriptions are anchored on their current period, or on the end
+-- of the trial they are still in. Periods already clamped (e.g. renewed on
+-- the 28th after a January 31 start) keep that day.
+UPDATE subscriptions
+SET billing_anchor = CASE
+    WHEN trial_end_at > current_period_start THEN trial_end_at
+    ELSE current_period_start
+END
+WHERE billing_anchor IS NULL;
+
+ALTER TABLE subscriptions ALTER COLUMN billing_anchor SET NOT NULL;
@@ -0,0 +1,6 @@
+-- Migration: 015_module_versions.sql
+-- Description: Publishes version 1.1.0 of the CRM and HRM modules. Tenants
+-- stay on 1.0.0 until they upgrade or a rollout upgrades them; the upgrade
+-- hooks migrate their data (CRM lead sources, HRM leave policies).
+
+UPDATE modules SET version = '1.1.0', updated_at = NOW() WHERE name IN ('crm', 'hrm') AND version = '1.0.0';